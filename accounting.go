@@ -115,6 +115,11 @@ func NewAccountingRequestFromBytes(data []byte) (*AcctRequest, error) {
 
 // Validate all fields on this type
 func (a *AcctRequest) Validate() error {
+	return a.validate(0)
+}
+
+// validate all fields on this type, using the arg length limits implied by flags
+func (a *AcctRequest) validate(flags HeaderFlag) error {
 	// validate
 	for _, t := range []Field{a.Method, a.PrivLvl, a.Type, a.Service, a.User, a.Port, a.RemAddr, a.Flags} {
 		if err := t.Validate(nil); err != nil {
@@ -122,7 +127,7 @@ func (a *AcctRequest) Validate() error {
 		}
 	}
 	for _, t := range a.Args {
-		if err := AcctArg(t).Validate(nil); err != nil {
+		if err := AcctArg(t).Validate(flags); err != nil {
 			return err
 		}
 	}
@@ -131,8 +136,18 @@ func (a *AcctRequest) Validate() error {
 
 // MarshalBinary marshals AccountingRequest to tacacs bytes
 func (a *AcctRequest) MarshalBinary() ([]byte, error) {
+	return a.marshal(0)
+}
+
+// MarshalBinaryExtended marshals AccountingRequest to tacacs bytes using the non-rfc
+// ExtendedArgLength encoding
+func (a *AcctRequest) MarshalBinaryExtended() ([]byte, error) {
+	return a.marshal(ExtendedArgLength)
+}
+
+func (a *AcctRequest) marshal(flags HeaderFlag) ([]byte, error) {
 	// validate
-	if err := a.Validate(); err != nil {
+	if err := a.validate(flags); err != nil {
 		return nil, err
 	}
 	buf := make([]byte, 0, AcctRequestLen)
@@ -148,7 +163,7 @@ func (a *AcctRequest) MarshalBinary() ([]byte, error) {
 	buf = append(buf, uint8(len(a.Args)))
 
 	for _, arg := range a.Args {
-		buf = append(buf, uint8(arg.Len()))
+		buf = appendArgLen(buf, arg.Len(), flags)
 	}
 
 	buf = append(buf, a.User...)
@@ -164,8 +179,18 @@ func (a *AcctRequest) MarshalBinary() ([]byte, error) {
 
 // UnmarshalBinary unmarshals decrypted tacacs bytes to AccountingRequest
 func (a *AcctRequest) UnmarshalBinary(data []byte) error {
+	return a.unmarshal(data, 0)
+}
+
+// UnmarshalBinaryExtended unmarshals decrypted tacacs bytes that use the non-rfc
+// ExtendedArgLength encoding to AccountingRequest
+func (a *AcctRequest) UnmarshalBinaryExtended(data []byte) error {
+	return a.unmarshal(data, ExtendedArgLength)
+}
+
+func (a *AcctRequest) unmarshal(data []byte, flags HeaderFlag) error {
 	if len(data) < AcctRequestLen {
-		return fmt.Errorf("acctRequest size [%v] is too small for the minimum size [%v]", len(data), AcctRequestLen)
+		return fmt.Errorf("%w; acctRequest size [%v] is too small for the minimum size [%v]", ErrTruncatedPacket, len(data), AcctRequestLen)
 	}
 	a.Flags = AcctRequestFlag(data[0])
 	a.Method = AuthenMethod(data[1])
@@ -183,7 +208,7 @@ func (a *AcctRequest) UnmarshalBinary(data []byte) error {
 	var totalArgLen int
 	argLens := make([]int, 0, argCnt)
 	for i := 0; i < argCnt; i++ {
-		aLen := buf.int()
+		aLen := buf.argLen(flags)
 		totalArgLen += aLen
 		argLens = append(argLens, aLen)
 	}
@@ -201,7 +226,7 @@ func (a *AcctRequest) UnmarshalBinary(data []byte) error {
 		return NewBadSecretErr("bad secret detected acctrequest")
 	}
 	// validate
-	if err := a.Validate(); err != nil {
+	if err := a.validate(flags); err != nil {
 		return err
 	}
 	return nil
@@ -313,7 +338,7 @@ func (a *AcctReply) MarshalBinary() ([]byte, error) {
 // UnmarshalBinary unmarshals decrypted tacacs bytes to AcctReply
 func (a *AcctReply) UnmarshalBinary(data []byte) error {
 	if len(data) < AcctReplyLen {
-		return fmt.Errorf("acctReply size [%v] is too small for the minimum size [%v]", len(data), AcctReplyLen)
+		return fmt.Errorf("%w; acctReply size [%v] is too small for the minimum size [%v]", ErrTruncatedPacket, len(data), AcctReplyLen)
 	}
 	buf := readBuffer(data)
 	serverMsgLen := buf.uint16()
@@ -31,7 +31,7 @@ func (t AcctReplyStatus) Validate(condition interface{}) error {
 	case AcctReplyStatusSuccess, AcctReplyStatusError:
 		return nil
 	}
-	return fmt.Errorf("unknown AcctReplyStatus value [%v]", t)
+	return invalidField("AcctReplyStatus", "value [%v] is unknown", t)
 }
 
 // Len returns the length of AcctReplyStatus.
@@ -62,7 +62,7 @@ func (t AcctServerMsg) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AcctServerMsg is not all ascii, but it must be, [%v]", t)
+	return invalidField("AcctServerMsg", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AcctServerMsg.
@@ -88,7 +88,7 @@ func (t AcctData) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AcctData is not all ascii, but it must be, [%v]", t)
+	return invalidField("AcctData", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AcctData.
@@ -150,7 +150,7 @@ func (t AcctTaskID) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AcctTaskID is not all ascii, but it must be, [%v]", t)
+	return invalidField("AcctTaskID", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AcctTaskID.
@@ -172,7 +172,7 @@ func (t AcctTimezone) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AcctTimezone is not all ascii, but it must be, [%v]", t)
+	return invalidField("AcctTimezone", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AcctTimezone.
@@ -197,7 +197,7 @@ func (t AcctEvent) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AcctEvent is not all ascii, but it must be, [%v]", t)
+	return invalidField("AcctEvent", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AcctEvent.
@@ -219,7 +219,7 @@ func (t AcctReason) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AcctReason is not all ascii, but it must be, [%v]", t)
+	return invalidField("AcctReason", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AcctReason.
@@ -242,7 +242,7 @@ func (t AcctErrMsg) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AcctErrMsg is not all ascii, but it must be, [%v]", t)
+	return invalidField("AcctErrMsg", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AcctErrMsg.
@@ -432,7 +432,7 @@ func (t AcctRequestFlag) String() string {
 // Validate checks for the correct flags to be set
 func (t AcctRequestFlag) Validate(condition interface{}) error {
 	if t.Has(AcctFlagStop) && t.Has(AcctFlagWatchdog) {
-		return fmt.Errorf("stop and watchdog flags are both set")
+		return invalidField("AcctRequestFlag", "sets both the stop and watchdog flags")
 	}
 	return nil
 }
@@ -448,11 +448,11 @@ type AcctArg string
 // Validate characterics of type based on rfc and usage.
 func (t AcctArg) Validate(condition interface{}) error {
 	if !isAllASCII(string(t)) {
-		return fmt.Errorf("Arg is not all ascii, but it must be, [%v]", t)
+		return invalidField("Arg", "is not all ascii, but it must be, [%v]", t)
 	}
 
-	if len(t) > 255 {
-		return fmt.Errorf("invalid arg length. valid range [0-255], found [%v]", len(t))
+	if max := maxArgLen(condition); len(t) > max {
+		return invalidField("AcctArg", "length [%v] is not in the range 0-%v", len(t), max)
 	}
 
 	return nil
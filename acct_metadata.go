@@ -0,0 +1,41 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import "context"
+
+// AcctMetadata are fields that describe an accounting record but are not part of the packet, eg
+// the hostname of the device that sent it.  Servers add them to the request context with
+// WithAcctMetadata, and accounters write them along with the record.
+type AcctMetadata map[string]string
+
+// WithAcctMetadata returns a copy of ctx holding m
+func WithAcctMetadata(ctx context.Context, m AcctMetadata) context.Context {
+	return context.WithValue(ctx, ContextAcctMetadata, m)
+}
+
+// AcctMetadataFromContext returns the metadata held by ctx, nil if there is none
+func AcctMetadataFromContext(ctx context.Context) AcctMetadata {
+	if ctx == nil {
+		return nil
+	}
+	m, _ := ctx.Value(ContextAcctMetadata).(AcctMetadata)
+	return m
+}
+
+// AcctRecord is an accounting request as accounters write it, along with its metadata.  Records
+// without metadata encode exactly as the request does.
+type AcctRecord struct {
+	AcctRequest
+	Metadata AcctMetadata `json:"metadata,omitempty"`
+}
+
+// NewAcctRecord returns the record of body, with the metadata held by ctx
+func NewAcctRecord(ctx context.Context, body AcctRequest) AcctRecord {
+	return AcctRecord{AcctRequest: body, Metadata: AcctMetadataFromContext(ctx)}
+}
@@ -103,7 +103,7 @@ type AuthenStart struct {
 func (a *AuthenStart) Validate() error {
 	// validate
 	if a.Type == AuthenTypeNotSet {
-		return fmt.Errorf("bad value for AuthenType; AuthenTypeNotSet not allowed for AuthenStart packets")
+		return invalidField("AuthenType", "AuthenTypeNotSet is not allowed for AuthenStart packets")
 	}
 	for _, t := range []Field{a.Action, a.PrivLvl, a.Type, a.Service, a.User, a.Port, a.RemAddr, a.Data} {
 		if err := t.Validate(a.Type); err != nil {
@@ -141,7 +141,7 @@ func (a *AuthenStart) MarshalBinary() ([]byte, error) {
 // UnmarshalBinary decodes decrypted tacacs bytes to AuthenStart
 func (a *AuthenStart) UnmarshalBinary(data []byte) error {
 	if len(data) < AuthenStartLen {
-		return fmt.Errorf("authenStart size [%v] is too small for the minimum size [%v]", len(data), AuthenStartLen)
+		return fmt.Errorf("%w; authenStart size [%v] is too small for the minimum size [%v]", ErrTruncatedPacket, len(data), AuthenStartLen)
 	}
 	a.Action = AuthenAction(data[0])
 	a.PrivLvl = PrivLvl(data[1])
@@ -273,7 +273,7 @@ func (a *AuthenContinue) MarshalBinary() ([]byte, error) {
 // UnmarshalBinary decodes decrypted tacacs bytes to AuthenContinue
 func (a *AuthenContinue) UnmarshalBinary(data []byte) error {
 	if len(data) < AuthenContinueLen {
-		return fmt.Errorf("authenContinue size [%v] is too small for the minimum size [%v]", len(data), AuthenContinueLen)
+		return fmt.Errorf("%w; authenContinue size [%v] is too small for the minimum size [%v]", ErrTruncatedPacket, len(data), AuthenContinueLen)
 	}
 	buf := readBuffer(data)
 	userMessageLen := buf.uint16()
@@ -394,7 +394,7 @@ func (a *AuthenReply) MarshalBinary() ([]byte, error) {
 // UnmarshalBinary decodes decrypted tacacs bytes to AuthenReply
 func (a *AuthenReply) UnmarshalBinary(data []byte) error {
 	if len(data) < AuthenReplyLen {
-		return fmt.Errorf("authenReply size [%v] is too small for the minimum size [%v]", len(data), AuthenReplyLen)
+		return fmt.Errorf("%w; authenReply size [%v] is too small for the minimum size [%v]", ErrTruncatedPacket, len(data), AuthenReplyLen)
 	}
 	a.Status = AuthenStatus(data[0])
 	a.Flags = AuthenReplyFlag(data[1])
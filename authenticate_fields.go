@@ -54,7 +54,7 @@ func (t AuthenAction) Validate(condition interface{}) error {
 	case AuthenActionLogin, AuthenActionPass, AuthenActionSendAuth:
 		return nil
 	}
-	return fmt.Errorf("unknown AuthenAction value [%v]", t)
+	return invalidField("AuthenAction", "value [%v] is unknown", t)
 }
 
 // Len returns the length of AuthenAction.
@@ -100,7 +100,7 @@ func (t PrivLvl) Validate(condition interface{}) error {
 	if t <= 15 {
 		return nil
 	}
-	return fmt.Errorf("invalid PrivLvl: [%v]", t)
+	return invalidField("PrivLvl", "[%v] is not in the range 0-15", t)
 }
 
 // String returns PrivLvl as string.
@@ -143,7 +143,7 @@ func (t AuthenType) Validate(condition interface{}) error {
 	case AuthenTypeNotSet, AuthenTypeASCII, AuthenTypePAP, AuthenTypeCHAP, AuthenTypeARAP, AuthenTypeMSCHAP, AuthenTypeMSCHAPV2:
 		return nil
 	}
-	return fmt.Errorf("unknown AuthenType value [%v]", t)
+	return invalidField("AuthenType", "value [%v] is unknown", t)
 }
 
 // Len returns the length of AuthenType.
@@ -209,7 +209,7 @@ func (t AuthenService) Validate(condition interface{}) error {
 	case AuthenServiceNone, AuthenServiceLogin, AuthenServiceEnable, AuthenServicePPP, AuthenServiceARAP, AuthenServicePT, AuthenServiceRCMD, AuthenServiceX25, AuthenServiceNASI, AuthenServiceFwProxy:
 		return nil
 	}
-	return fmt.Errorf("unknown AuthenService value [%v]", t)
+	return invalidField("AuthenService", "value [%v] is unknown", t)
 }
 
 // Len returns the length of AuthenService.
@@ -270,7 +270,7 @@ func (t AuthenStatus) Validate(condition interface{}) error {
 	case AuthenStatusPass, AuthenStatusFail, AuthenStatusGetData, AuthenStatusGetUser, AuthenStatusGetPass, AuthenStatusRestart, AuthenStatusError:
 		return nil
 	}
-	return fmt.Errorf("unknown AuthenStatus value [%v]", t)
+	return invalidField("AuthenStatus", "value [%v] is unknown", t)
 }
 
 // Len returns the length of AuthenStatus.
@@ -329,7 +329,7 @@ func (t AuthenUserMessage) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthenUserMessage is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthenUserMessage", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthenUserMessage.
@@ -362,7 +362,7 @@ func (t AuthenData) Validate(condition interface{}) error {
 		switch atype {
 		case AuthenTypeASCII:
 			if !isAllASCII(string(t)) {
-				return fmt.Errorf("AuthenData is not all ascii, but it must be for AuthenTypeASCII, [%v]", t)
+				return invalidField("AuthenData", "is not all ascii, but it must be for AuthenTypeASCII, [%v]", t)
 			}
 		}
 	}
@@ -383,7 +383,7 @@ func (t AuthenUser) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthenUser is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthenUser", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthenUser.
@@ -405,7 +405,7 @@ func (t AuthenPort) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthenPort is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthenPort", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthenPort.
@@ -427,7 +427,7 @@ func (t AuthenRemAddr) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthenRemAddr is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthenRemAddr", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthenRemAddr.
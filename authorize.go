@@ -101,6 +101,11 @@ type AuthorRequest struct {
 
 // Validate all fields on this type
 func (a *AuthorRequest) Validate() error {
+	return a.validate(0)
+}
+
+// validate all fields on this type, using the arg length limits implied by flags
+func (a *AuthorRequest) validate(flags HeaderFlag) error {
 	// validate
 	for _, t := range []Field{a.Method, a.PrivLvl, a.Type, a.Service, a.User, a.Port, a.RemAddr} {
 		if err := t.Validate(a.Type); err != nil {
@@ -108,7 +113,7 @@ func (a *AuthorRequest) Validate() error {
 		}
 	}
 	for _, t := range a.Args {
-		if err := t.Validate(nil); err != nil {
+		if err := t.Validate(flags); err != nil {
 			return err
 		}
 	}
@@ -117,8 +122,18 @@ func (a *AuthorRequest) Validate() error {
 
 // MarshalBinary encodes AuthroRequest into tacacs bytes
 func (a *AuthorRequest) MarshalBinary() ([]byte, error) {
+	return a.marshal(0)
+}
+
+// MarshalBinaryExtended encodes AuthorRequest into tacacs bytes using the non-rfc
+// ExtendedArgLength encoding
+func (a *AuthorRequest) MarshalBinaryExtended() ([]byte, error) {
+	return a.marshal(ExtendedArgLength)
+}
+
+func (a *AuthorRequest) marshal(flags HeaderFlag) ([]byte, error) {
 	// validate we have good data before encoding
-	if err := a.Validate(); err != nil {
+	if err := a.validate(flags); err != nil {
 		return nil, err
 	}
 	buf := make([]byte, 0, AuthorRequestLen+len(a.Args))
@@ -133,7 +148,7 @@ func (a *AuthorRequest) MarshalBinary() ([]byte, error) {
 	buf = append(buf, uint8(len(a.Args)))
 
 	for _, arg := range a.Args {
-		buf = append(buf, uint8(arg.Len()))
+		buf = appendArgLen(buf, arg.Len(), flags)
 	}
 
 	buf = append(buf, a.User...)
@@ -149,8 +164,18 @@ func (a *AuthorRequest) MarshalBinary() ([]byte, error) {
 
 // UnmarshalBinary decodes decrypted tacacs bytes into AuthorRequest
 func (a *AuthorRequest) UnmarshalBinary(data []byte) error {
+	return a.unmarshal(data, 0)
+}
+
+// UnmarshalBinaryExtended decodes decrypted tacacs bytes that use the non-rfc
+// ExtendedArgLength encoding into AuthorRequest
+func (a *AuthorRequest) UnmarshalBinaryExtended(data []byte) error {
+	return a.unmarshal(data, ExtendedArgLength)
+}
+
+func (a *AuthorRequest) unmarshal(data []byte, flags HeaderFlag) error {
 	if len(data) < AuthorRequestLen {
-		return fmt.Errorf("authorRequest size [%v] is too small for the minimum size [%v]", len(data), AuthorRequestLen)
+		return fmt.Errorf("%w; authorRequest size [%v] is too small for the minimum size [%v]", ErrTruncatedPacket, len(data), AuthorRequestLen)
 	}
 	a.Method = AuthenMethod(data[0])
 	a.PrivLvl = PrivLvl(data[1])
@@ -166,7 +191,7 @@ func (a *AuthorRequest) UnmarshalBinary(data []byte) error {
 	var totalArgLen int
 	argLens := make([]int, 0, argCnt)
 	for i := 0; i < argCnt; i++ {
-		aLen := buf.int()
+		aLen := buf.argLen(flags)
 		totalArgLen += aLen
 		argLens = append(argLens, aLen)
 	}
@@ -185,7 +210,7 @@ func (a *AuthorRequest) UnmarshalBinary(data []byte) error {
 		return NewBadSecretErr("bad secret detected authorrequest")
 	}
 	// validate
-	if err := a.Validate(); err != nil {
+	if err := a.validate(flags); err != nil {
 		return err
 	}
 	return nil
@@ -280,6 +305,11 @@ func NewAuthorReplyFromBytes(data []byte) (*AuthorReply, error) {
 
 // Validate all fields on this type
 func (a *AuthorReply) Validate() error {
+	return a.validate(0)
+}
+
+// validate all fields on this type, using the arg length limits implied by flags
+func (a *AuthorReply) validate(flags HeaderFlag) error {
 	// validate
 	for _, t := range []Field{a.Status, a.ServerMsg, a.Data} {
 		if err := t.Validate(nil); err != nil {
@@ -287,7 +317,7 @@ func (a *AuthorReply) Validate() error {
 		}
 	}
 	for _, t := range a.Args {
-		if err := t.Validate(nil); err != nil {
+		if err := t.Validate(flags); err != nil {
 			return err
 		}
 	}
@@ -296,8 +326,18 @@ func (a *AuthorReply) Validate() error {
 
 // MarshalBinary encodes AuthorReply into tacacs bytes
 func (a *AuthorReply) MarshalBinary() ([]byte, error) {
+	return a.marshal(0)
+}
+
+// MarshalBinaryExtended encodes AuthorReply into tacacs bytes using the non-rfc
+// ExtendedArgLength encoding
+func (a *AuthorReply) MarshalBinaryExtended() ([]byte, error) {
+	return a.marshal(ExtendedArgLength)
+}
+
+func (a *AuthorReply) marshal(flags HeaderFlag) ([]byte, error) {
 	// validate
-	if err := a.Validate(); err != nil {
+	if err := a.validate(flags); err != nil {
 		return nil, err
 	}
 	buf := make([]byte, 0, AuthorReplyLen)
@@ -307,7 +347,7 @@ func (a *AuthorReply) MarshalBinary() ([]byte, error) {
 	buf = appendUint16(buf, a.Data.Len())
 
 	for _, arg := range a.Args {
-		buf = append(buf, uint8(arg.Len()))
+		buf = appendArgLen(buf, arg.Len(), flags)
 	}
 
 	buf = append(buf, a.ServerMsg...)
@@ -322,8 +362,18 @@ func (a *AuthorReply) MarshalBinary() ([]byte, error) {
 
 // UnmarshalBinary decodes decrypted tacacs bytes into AuthorReply
 func (a *AuthorReply) UnmarshalBinary(data []byte) error {
+	return a.unmarshal(data, 0)
+}
+
+// UnmarshalBinaryExtended decodes decrypted tacacs bytes that use the non-rfc
+// ExtendedArgLength encoding into AuthorReply
+func (a *AuthorReply) UnmarshalBinaryExtended(data []byte) error {
+	return a.unmarshal(data, ExtendedArgLength)
+}
+
+func (a *AuthorReply) unmarshal(data []byte, flags HeaderFlag) error {
 	if len(data) < AuthorReplyLen {
-		return fmt.Errorf("authorReply size [%v] is too small for the minimum size [%v]", len(data), AuthorReplyLen)
+		return fmt.Errorf("%w; authorReply size [%v] is too small for the minimum size [%v]", ErrTruncatedPacket, len(data), AuthorReplyLen)
 	}
 
 	buf := readBuffer(data)
@@ -336,7 +386,7 @@ func (a *AuthorReply) UnmarshalBinary(data []byte) error {
 	var totalArgLen int
 	argLens := make([]int, 0, argCnt)
 	for i := 0; i < argCnt; i++ {
-		aLen := buf.int()
+		aLen := buf.argLen(flags)
 		totalArgLen += aLen
 		argLens = append(argLens, aLen)
 	}
@@ -353,7 +403,7 @@ func (a *AuthorReply) UnmarshalBinary(data []byte) error {
 		return NewBadSecretErr("bad secret detected authorreply")
 	}
 	// validate
-	if err := a.Validate(); err != nil {
+	if err := a.validate(flags); err != nil {
 		return err
 	}
 	return nil
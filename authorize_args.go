@@ -0,0 +1,204 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// argValue is an authorization argument value, see the Author types of authorize_fields.go
+type argValue interface {
+	Validate(condition interface{}) error
+	String() string
+}
+
+// newArg validates v and encodes it as the mandatory argument attr=v.
+// https://datatracker.ietf.org/doc/html/rfc8907#section-6.1
+func newArg(attr string, v argValue) (Arg, error) {
+	if err := v.Validate(nil); err != nil {
+		return "", fmt.Errorf("invalid %v argument; %v", attr, err)
+	}
+	arg := Arg(attr + "=" + v.String())
+	if err := arg.Validate(nil); err != nil {
+		return "", fmt.Errorf("invalid %v argument; %v", attr, err)
+	}
+	return arg, nil
+}
+
+// Optional returns t as an optional argument, attr*value, which a client may ignore if it does
+// not support it.  Other args are returned unchanged.
+func (t Arg) Optional() Arg {
+	a, s, v := t.ASV()
+	if s != "=" {
+		return t
+	}
+	return Arg(a + "*" + v)
+}
+
+// NewArgService returns a service argument, eg shell.  Every authorization request must include one.
+func NewArgService(service string) (Arg, error) {
+	if service == "" {
+		return "", fmt.Errorf("invalid service argument; a service is required")
+	}
+	return newArg("service", AuthorService(service))
+}
+
+// NewArgProtocol returns a protocol argument, the subset of a service, eg ip
+func NewArgProtocol(protocol string) (Arg, error) {
+	return newArg("protocol", AuthorProtocol(protocol))
+}
+
+// NewArgCmd returns a cmd argument, the shell command to authorize.  An empty cmd requests session
+// based authorization.
+func NewArgCmd(cmd string) (Arg, error) {
+	return newArg("cmd", AuthorCmd(cmd))
+}
+
+// NewArgCmdArg returns a cmd-arg argument, one argument of the shell command
+func NewArgCmdArg(arg string) (Arg, error) {
+	return newArg("cmd-arg", AuthorCmdArg(arg))
+}
+
+// NewArgACL returns an acl argument, the number of a connection access list
+func NewArgACL(n int) (Arg, error) {
+	return newArg("acl", AuthorACL(n))
+}
+
+// NewArgInACL returns an inacl argument, the name of an interface input access list
+func NewArgInACL(name string) (Arg, error) {
+	return newArg("inacl", AuthorInACL(name))
+}
+
+// NewArgOutACL returns an outacl argument, the name of an interface output access list
+func NewArgOutACL(name string) (Arg, error) {
+	return newArg("outacl", AuthorOutACL(name))
+}
+
+// NewArgAddr returns an addr argument, an ipv4 or ipv6 network address
+func NewArgAddr(ip net.IP) (Arg, error) {
+	return newArg("addr", AuthorAddr(ip))
+}
+
+// NewArgAddrPool returns an addr-pool argument, the pool the client assigns an address from
+func NewArgAddrPool(pool string) (Arg, error) {
+	return newArg("addr-pool", AuthorAddrPool(pool))
+}
+
+// NewArgTimeout returns a timeout argument, an absolute timeout for the connection in minutes.
+// Zero is no timeout.
+func NewArgTimeout(minutes int) (Arg, error) {
+	return newArg("timeout", AuthorTimeout(minutes))
+}
+
+// NewArgIdleTime returns an idletime argument, an idle timeout for the connection in minutes.  Zero
+// is no timeout.
+func NewArgIdleTime(minutes int) (Arg, error) {
+	return newArg("idletime", AuthorIdleTime(minutes))
+}
+
+// NewArgAutoCmd returns an autocmd argument, the command run at the start of the session
+func NewArgAutoCmd(cmd string) (Arg, error) {
+	return newArg("autocmd", AuthorAutoCmd(cmd))
+}
+
+// NewArgNoEscape returns a noescape argument, preventing the user from using an escape character
+func NewArgNoEscape(v bool) (Arg, error) {
+	return newArg("noescape", AuthorNoEscape(v))
+}
+
+// NewArgNoHangup returns a nohangup argument, not disconnecting after an autocmd
+func NewArgNoHangup(v bool) (Arg, error) {
+	return newArg("nohangup", AuthorNoHangup(v))
+}
+
+// Lookup returns the value and separator of the first name argument, = if it is mandatory or * if
+// it is optional.  ok is false if there is none.
+func (t Args) Lookup(name string) (value string, sep string, ok bool) {
+	for _, arg := range t {
+		a, s, v := arg.ASV()
+		if a == name {
+			return v, s, true
+		}
+	}
+	return "", "", false
+}
+
+// Map returns the value of every attribute, the first if it is repeated.  Attributes that carry a
+// list, eg cmd-arg, have their own accessors.
+func (t Args) Map() map[string]string {
+	m := make(map[string]string, len(t))
+	for _, arg := range t {
+		a, s, v := arg.ASV()
+		if s == "" {
+			continue
+		}
+		if _, ok := m[a]; !ok {
+			m[a] = v
+		}
+	}
+	return m
+}
+
+// lookupInt returns the first name argument as a non negative integer, ok is false if it is
+// missing or not a number
+func (t Args) lookupInt(name string) (int, bool) {
+	v, _, ok := t.Lookup(name)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// PrivLvl returns the priv-lvl argument, ok is false if it is missing or not a valid privilege level
+func (t Args) PrivLvl() (PrivLvl, bool) {
+	n, ok := t.lookupInt("priv-lvl")
+	if !ok || n > int(PrivLvlMax) {
+		return 0, false
+	}
+	return PrivLvl(n), true
+}
+
+// Timeout returns the timeout argument in minutes, ok is false if it is missing or invalid
+func (t Args) Timeout() (AuthorTimeout, bool) {
+	n, ok := t.lookupInt("timeout")
+	return AuthorTimeout(n), ok
+}
+
+// IdleTime returns the idletime argument in minutes, ok is false if it is missing or invalid
+func (t Args) IdleTime() (AuthorIdleTime, bool) {
+	n, ok := t.lookupInt("idletime")
+	return AuthorIdleTime(n), ok
+}
+
+// ACL returns the acl argument, ok is false if it is missing or invalid
+func (t Args) ACL() (AuthorACL, bool) {
+	n, ok := t.lookupInt("acl")
+	return AuthorACL(n), ok
+}
+
+// Addr returns the addr argument, ok is false if it is missing or not an ipv4 or ipv6 address
+func (t Args) Addr() (AuthorAddr, bool) {
+	v, _, ok := t.Lookup("addr")
+	if !ok {
+		return nil, false
+	}
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return nil, false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return AuthorAddr(ip), true
+}
@@ -45,7 +45,7 @@ func (t AuthenMethod) Validate(condition interface{}) error {
 	case AuthenMethodNotSet, AuthenMethodNone, AuthenMethodKrb5, AuthenMethodLine, AuthenMethodEnable, AuthenMethodLocal, AuthenMethodTacacsPlus, AuthenMethodGuest, AuthenMethodRadius:
 		return nil
 	}
-	return fmt.Errorf("unknown AuthenMethod value [%v]", t)
+	return invalidField("AuthenMethod", "value [%v] is unknown", t)
 }
 
 // Len returns the length of AuthenMethod.
@@ -85,11 +85,12 @@ type Arg string
 func (t Arg) Validate(condition interface{}) error {
 	// https://datatracker.ietf.org/doc/html/rfc8907#section-3.6
 	if !isAllASCII(string(t)) {
-		return fmt.Errorf("Arg is not all ascii, but it must be, [%v]", t)
+		return invalidField("Arg", "is not all ascii, but it must be, [%v]", t)
 	}
 
-	if len(t) < 2 || len(t) > 255 {
-		return fmt.Errorf("invalid arg length. valid range [2-255], found [%v]", len(t))
+	max := maxArgLen(condition)
+	if len(t) < 2 || len(t) > max {
+		return invalidField("Arg", "length [%v] is not in the range 2-%v", len(t), max)
 	}
 	return nil
 }
@@ -128,7 +129,7 @@ func (t Args) Len() int {
 func (t Args) Validate(condition interface{}) error {
 	for _, arg := range t {
 		if !isAllASCII(string(arg)) {
-			return fmt.Errorf("Args are not all ASCII")
+			return invalidField("Args", "are not all ascii")
 		}
 	}
 	return nil
@@ -143,43 +144,35 @@ func (t Args) String() string {
 	return b.String()
 }
 
-// Service joins all service args into a single string.
+// Service returns the value of the service arg, or a zero value if not present
 func (t Args) Service() string {
-	var s string
-	for _, arg := range t {
-		a, _, v := arg.ASV()
-		if a == "service" {
-			return v
-		}
-	}
-	return s
+	v, _, _ := t.Lookup("service")
+	return v
+}
+
+// TaskID returns the value of the task_id accounting arg, or a zero value if not present
+func (t Args) TaskID() string {
+	v, _, _ := t.Lookup("task_id")
+	return v
 }
 
 // CommandSplit returns the attribute, separator and value of
 // cmd= or cmd* or cmd=show or cmd*show.  Zero values are returned
 // if not found
 func (t Args) CommandSplit() (string, string, string) {
-	for _, arg := range t {
-		a, s, v := arg.ASV()
-		if a == "cmd" {
-			return a, s, v
-		}
+	v, s, ok := t.Lookup("cmd")
+	if !ok {
+		return "", "", ""
 	}
-	return "", "", ""
+	return "cmd", s, v
 }
 
 // Command returns the cmd only if cmd=foo or cmd= or cmd*, etc is provided
 // the delimiter is immaterial to this function returning a value
 // the returned value will be a zero value if cmd is not present
 func (t Args) Command() string {
-	var cmd string
-	for _, arg := range t {
-		a, _, v := arg.ASV()
-		if a == "cmd" {
-			return v
-		}
-	}
-	return cmd
+	v, _, _ := t.Lookup("cmd")
+	return v
 }
 
 // CommandArgs joins all cmd-arg args into a single string.
@@ -271,7 +264,7 @@ func (t AuthorStatus) Validate(condition interface{}) error {
 	case AuthorStatusPassAdd, AuthorStatusPassRepl, AuthorStatusFail, AuthorStatusError:
 		return nil
 	}
-	return fmt.Errorf("unknown AuthorStatus value [%v]", t)
+	return invalidField("AuthorStatus", "value [%v] is unknown", t)
 }
 
 // Len returns the length of AuthorStatus.
@@ -303,7 +296,7 @@ func (t AuthorServerMsg) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthorServerMsg is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthorServerMsg", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthorServerMsg.
@@ -327,7 +320,7 @@ func (t AuthorData) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthorData is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthorData", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthorData.
@@ -354,7 +347,7 @@ func (t AuthorService) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthorService is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthorService", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthorService.
@@ -377,7 +370,7 @@ func (t AuthorProtocol) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthorProtocol is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthorProtocol", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthorProtocol.
@@ -416,7 +409,7 @@ func (t AuthorCmd) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthorCmd is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthorCmd", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthorCmd.
@@ -441,7 +434,7 @@ func (t AuthorCmdArg) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthorCmdArg is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthorCmdArg", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthorCmdArg.
@@ -463,6 +456,9 @@ type AuthorACL int
 
 // Validate characterics of type based on rfc and usage.
 func (t AuthorACL) Validate(condition interface{}) error {
+	if t < 0 {
+		return invalidField("AuthorACL", "must not be negative, [%v]", int(t))
+	}
 	return nil
 }
 
@@ -488,7 +484,7 @@ func (t AuthorInACL) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthorInACL is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthorInACL", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthorInACL.
@@ -513,7 +509,7 @@ func (t AuthorOutACL) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthorOutACL is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthorOutACL", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthorOutACL.
@@ -526,12 +522,15 @@ func (t AuthorOutACL) String() string {
 	return string(t)
 }
 
-// AuthorAddr A network address.
+// AuthorAddr A network address, ipv4 or ipv6.
 // https://datatracker.ietf.org/doc/html/rfc8907#section-3.7
 type AuthorAddr net.IP
 
 // Validate characterics of type based on rfc and usage.
 func (t AuthorAddr) Validate(condition interface{}) error {
+	if len(t) != net.IPv4len && len(t) != net.IPv6len {
+		return invalidField("AuthorAddr", "is not an ipv4 or ipv6 address, found [%v] bytes", len(t))
+	}
 	return nil
 }
 
@@ -540,9 +539,9 @@ func (t AuthorAddr) Len() int {
 	return len(t)
 }
 
-// String returns AuthorAddr as a string.
+// String returns AuthorAddr in its text form, eg 192.0.2.1 or 2001:db8::1.
 func (t AuthorAddr) String() string {
-	return string(t)
+	return net.IP(t).String()
 }
 
 // AuthorAddrPool The identifier of an address pool from which the client can assign an address.
@@ -555,7 +554,7 @@ func (t AuthorAddrPool) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthorAddrPool is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthorAddrPool", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthorAddrPool.
@@ -574,6 +573,9 @@ type AuthorTimeout int
 
 // Validate characterics of type based on rfc and usage.
 func (t AuthorTimeout) Validate(condition interface{}) error {
+	if t < 0 {
+		return invalidField("AuthorTimeout", "must not be negative, [%v]", int(t))
+	}
 	return nil
 }
 
@@ -593,6 +595,9 @@ type AuthorIdleTime int
 
 // Validate characterics of type based on rfc and usage.
 func (t AuthorIdleTime) Validate(condition interface{}) error {
+	if t < 0 {
+		return invalidField("AuthorIdleTime", "must not be negative, [%v]", int(t))
+	}
 	return nil
 }
 
@@ -616,7 +621,7 @@ func (t AuthorAutoCmd) Validate(condition interface{}) error {
 	if isAllASCII(string(t)) {
 		return nil
 	}
-	return fmt.Errorf("AuthorAutoCmd is not all ascii, but it must be, [%v]", t)
+	return invalidField("AuthorAutoCmd", "is not all ascii, but it must be, [%v]", t)
 }
 
 // Len returns the length of AuthorAutoCmd.
@@ -8,7 +8,11 @@
 package tacquito
 
 import (
+	"net"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestArgsStripCR(t *testing.T) {
@@ -48,3 +52,112 @@ func TestArgsStripCRInMiddle(t *testing.T) {
 		t.Fatalf("failed to get command args, expected %s, got %s", expected, v)
 	}
 }
+
+func TestAuthorAddr(t *testing.T) {
+	tests := []struct {
+		addr AuthorAddr
+		want string
+	}{
+		{addr: AuthorAddr(net.ParseIP("192.0.2.1")), want: "192.0.2.1"},
+		{addr: AuthorAddr(net.ParseIP("192.0.2.1").To4()), want: "192.0.2.1"},
+		{addr: AuthorAddr(net.ParseIP("2001:db8::1")), want: "2001:db8::1"},
+	}
+	for _, tc := range tests {
+		assert.NoError(t, tc.addr.Validate(nil))
+		assert.Equal(t, tc.want, tc.addr.String())
+	}
+	assert.Error(t, AuthorAddr(nil).Validate(nil))
+	assert.Error(t, AuthorAddr([]byte{192, 0, 2}).Validate(nil))
+}
+
+func TestNewArg(t *testing.T) {
+	build := func(arg Arg, err error) Arg {
+		assert.NoError(t, err)
+		return arg
+	}
+	assert.Equal(t, Arg("service=shell"), build(NewArgService("shell")))
+	assert.Equal(t, Arg("protocol=ip"), build(NewArgProtocol("ip")))
+	assert.Equal(t, Arg("cmd="), build(NewArgCmd("")))
+	assert.Equal(t, Arg("cmd-arg=running-config"), build(NewArgCmdArg("running-config")))
+	assert.Equal(t, Arg("acl=101"), build(NewArgACL(101)))
+	assert.Equal(t, Arg("inacl=edge-in"), build(NewArgInACL("edge-in")))
+	assert.Equal(t, Arg("outacl=edge-out"), build(NewArgOutACL("edge-out")))
+	assert.Equal(t, Arg("addr=192.0.2.1"), build(NewArgAddr(net.ParseIP("192.0.2.1"))))
+	assert.Equal(t, Arg("addr=2001:db8::1"), build(NewArgAddr(net.ParseIP("2001:db8::1"))))
+	assert.Equal(t, Arg("addr-pool=dialup"), build(NewArgAddrPool("dialup")))
+	assert.Equal(t, Arg("timeout=30"), build(NewArgTimeout(30)))
+	assert.Equal(t, Arg("idletime=0"), build(NewArgIdleTime(0)))
+	assert.Equal(t, Arg("autocmd=telnet 192.0.2.1"), build(NewArgAutoCmd("telnet 192.0.2.1")))
+	assert.Equal(t, Arg("noescape=true"), build(NewArgNoEscape(true)))
+	assert.Equal(t, Arg("nohangup=false"), build(NewArgNoHangup(false)))
+	assert.Equal(t, Arg("timeout*30"), build(NewArgTimeout(30)).Optional())
+	assert.Equal(t, Arg("timeout*30"), Arg("timeout*30").Optional())
+
+	for name, build := range map[string]func() (Arg, error){
+		"no service":       func() (Arg, error) { return NewArgService("") },
+		"non ascii cmd":    func() (Arg, error) { return NewArgCmd("shöw") },
+		"invalid address":  func() (Arg, error) { return NewArgAddr(net.IP{192, 0, 2}) },
+		"missing address":  func() (Arg, error) { return NewArgAddr(nil) },
+		"negative timeout": func() (Arg, error) { return NewArgTimeout(-1) },
+		"negative idle":    func() (Arg, error) { return NewArgIdleTime(-1) },
+		"negative acl":     func() (Arg, error) { return NewArgACL(-1) },
+		"too long":         func() (Arg, error) { return NewArgCmdArg(strings.Repeat("x", MaxArgLength)) },
+	} {
+		_, err := build()
+		assert.Error(t, err, name)
+	}
+}
+
+func TestArgsAccessors(t *testing.T) {
+	args := Args{"service=shell", "cmd*show", "priv-lvl=15", "timeout=30", "idletime=5", "acl=101", "addr=2001:db8::1", "cmd-arg=version", "service=ppp", "noseparator"}
+
+	v, s, ok := args.Lookup("cmd")
+	assert.True(t, ok)
+	assert.Equal(t, "show", v)
+	assert.Equal(t, "*", s)
+	v, s, ok = args.Lookup("service")
+	assert.True(t, ok)
+	assert.Equal(t, "shell", v, "the first value wins")
+	assert.Equal(t, "=", s)
+	_, _, ok = args.Lookup("protocol")
+	assert.False(t, ok)
+
+	assert.Equal(t, map[string]string{
+		"service": "shell", "cmd": "show", "priv-lvl": "15", "timeout": "30", "idletime": "5", "acl": "101", "addr": "2001:db8::1", "cmd-arg": "version",
+	}, args.Map())
+
+	privLvl, ok := args.PrivLvl()
+	assert.True(t, ok)
+	assert.Equal(t, PrivLvlRoot, privLvl)
+	timeout, ok := args.Timeout()
+	assert.True(t, ok)
+	assert.Equal(t, AuthorTimeout(30), timeout)
+	idle, ok := args.IdleTime()
+	assert.True(t, ok)
+	assert.Equal(t, AuthorIdleTime(5), idle)
+	acl, ok := args.ACL()
+	assert.True(t, ok)
+	assert.Equal(t, AuthorACL(101), acl)
+	addr, ok := args.Addr()
+	assert.True(t, ok)
+	assert.Equal(t, "2001:db8::1", addr.String())
+
+	addr, ok = Args{"addr=192.0.2.1"}.Addr()
+	assert.True(t, ok)
+	assert.Len(t, addr, net.IPv4len)
+
+	// missing and malformed values are not ok
+	invalid := Args{"priv-lvl=16", "timeout=-1", "idletime=soon", "acl=", "addr=192.0.2"}
+	_, ok = invalid.PrivLvl()
+	assert.False(t, ok)
+	_, ok = invalid.Timeout()
+	assert.False(t, ok)
+	_, ok = invalid.IdleTime()
+	assert.False(t, ok)
+	_, ok = invalid.ACL()
+	assert.False(t, ok)
+	_, ok = invalid.Addr()
+	assert.False(t, ok)
+	_, ok = Args{}.PrivLvl()
+	assert.False(t, ok)
+}
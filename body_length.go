@@ -0,0 +1,92 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// bodyTooLargeServerMsg is the server msg of the reply to a packet whose body is too large
+const bodyTooLargeServerMsg = "packet body exceeds the maximum length"
+
+// SetMaxBodyLength sets the longest packet body the server accepts, MaxBodyLength by default and
+// at most.  A packet with a longer body is replied to with an error status and its body is
+// discarded, leaving the connection usable.  Bodies beyond MaxBodyLength are not read at all, the
+// connection is closed after the reply.  SecretProviders may set the limit of a client's
+// connection instead, see SetConnMaxBodyLength.
+func SetMaxBodyLength(n uint32) Option {
+	return func(s *Server) {
+		s.maxBodyLength = n
+	}
+}
+
+// bodyLimitKey is the context key of a bodyLimit
+type bodyLimitKey struct{}
+
+// bodyLimit receives the max body length a SecretProvider sets for a connection during the lookup
+// of its secret.  Lookups may complete on another goroutine, so it is locked.
+type bodyLimit struct {
+	sync.Mutex
+	n uint32
+}
+
+func (b *bodyLimit) set(n uint32) {
+	b.Lock()
+	defer b.Unlock()
+	b.n = n
+}
+
+func (b *bodyLimit) get() uint32 {
+	b.Lock()
+	defer b.Unlock()
+	return b.n
+}
+
+// SetConnMaxBodyLength overrides the server's max body length for the connection whose secret
+// is being looked up with ctx.  SecretProviders call it from Get to apply a per client limit, it
+// does nothing with any other context.  Zero keeps the server's limit.
+func SetConnMaxBodyLength(ctx context.Context, n uint32) {
+	if b, ok := ctx.Value(bodyLimitKey{}).(*bodyLimit); ok {
+		b.set(n)
+	}
+}
+
+// bodyLengthError is returned by crypter.receive when a packet's header indicates a body longer
+// than the connection accepts
+type bodyLengthError struct {
+	header Header
+	length uint32
+	limit  uint32
+	// discarded is set when the body was read and dropped, so the next packet may be read
+	discarded bool
+}
+
+// newBodyLengthError decodes the header h of a packet whose body is too long.  The length field
+// is excluded, header validation would reject it when it exceeds MaxBodyLength.
+func newBodyLengthError(h []byte, limit uint32, discarded bool) error {
+	length := binary.BigEndian.Uint32(h[8:])
+	trimmed := append([]byte{}, h...)
+	binary.BigEndian.PutUint32(trimmed[8:], 0)
+	var header Header
+	if err := header.UnmarshalBinary(trimmed); err != nil {
+		return fmt.Errorf("%w; packet body length [%v] exceeds the maximum of [%v] and the header is invalid; %v", ErrOversizePacket, length, limit, err)
+	}
+	return &bodyLengthError{header: header, length: length, limit: limit, discarded: discarded}
+}
+
+func (e *bodyLengthError) Error() string {
+	return fmt.Sprintf("packet body length [%v] exceeds the maximum of [%v]", e.length, e.limit)
+}
+
+// Is reports whether target is ErrOversizePacket
+func (e *bodyLengthError) Is(target error) bool {
+	return target == ErrOversizePacket
+}
@@ -8,19 +8,30 @@
 package tacquito
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/tacquito/proxy"
 )
 
 // ClientOption is a setter type for Client
 type ClientOption func(c *Client) error
 
+// errDialerSet is returned when more than one dialer option is provided
+var errDialerSet = fmt.Errorf("only one dialer option may be set")
+
 // SetClientDialer see net.ResolveTCPAddr for details, this follows
 // the same input requirements for network and address.  It will then use net.DialTCP
 // with a nil source addr and a constructed TCPAddr from the provided network and address.
 // A secret for the connection must also be provided.
 func SetClientDialer(network, address string, secret []byte) ClientOption {
 	return func(c *Client) error {
+		if c.crypter != nil || c.failover != nil {
+			return errDialerSet
+		}
 		tcpAddr, err := net.ResolveTCPAddr(network, address)
 		if err != nil {
 			return err
@@ -42,6 +53,9 @@ func SetClientDialer(network, address string, secret []byte) ClientOption {
 // A secret for the connection must also be provided.
 func SetClientDialerWithLocalAddr(network, raddr, laddr string, secret []byte) ClientOption {
 	return func(c *Client) error {
+		if c.crypter != nil || c.failover != nil {
+			return errDialerSet
+		}
 		localAddr, err := net.ResolveTCPAddr(network, laddr)
 		if err != nil {
 			fmt.Printf("unable to assign local address %v:%v, a default address will be chosen", laddr, err)
@@ -59,38 +73,170 @@ func SetClientDialerWithLocalAddr(network, raddr, laddr string, secret []byte) C
 	}
 }
 
-// NewClient creates a new client
+// SetClientProxyHeader writes a PROXY protocol header of version v before every packet, matching
+// the server's proxy processing.  source is the original client address and destination is the
+// address it connected to; nil values default to the local and remote addresses of the dialed
+// connection.  This option must follow a dialer option.
+func SetClientProxyHeader(v proxy.Version, source, destination net.Addr) ClientOption {
+	return func(c *Client) error {
+		if c.crypter == nil {
+			return fmt.Errorf("SetClientProxyHeader must follow a dialer option")
+		}
+		if source == nil {
+			source = c.crypter.LocalAddr()
+		}
+		if destination == nil {
+			destination = c.crypter.RemoteAddr()
+		}
+		b, err := proxy.NewHeader(source, destination).Marshal(v)
+		if err != nil {
+			return err
+		}
+		c.crypter.proxyHeader = b
+		return nil
+	}
+}
+
+// SetClientUnencrypted sends every packet with the UnencryptedFlag set, leaving its body
+// unobfuscated, for interop debugging with packet captures.  rfc 8907 only allows this for
+// testing, and servers reject such packets unless configured otherwise, see SetUnencryptedPolicy.
+// The secret of the dialer is still used for replies the server obfuscates.
+func SetClientUnencrypted() ClientOption {
+	return func(c *Client) error {
+		c.unencrypted = true
+		return nil
+	}
+}
+
+// NewClient creates a new client.  Exactly one dialer option is required.  If any option fails or
+// the options conflict, the dialed connection is closed and an error returned.
 func NewClient(opts ...ClientOption) (*Client, error) {
 	c := &Client{}
 	defaults := []ClientOption{}
 	opts = append(defaults, opts...)
 	for _, opt := range opts {
 		if err := opt(c); err != nil {
+			c.close()
 			return nil, err
 		}
 	}
+	if err := c.validate(); err != nil {
+		c.close()
+		return nil, err
+	}
+	if c.crypter != nil {
+		c.crypter.unencrypted = c.unencrypted
+	}
+	if c.failover != nil {
+		// dial the first server that answers, as the first session would
+		var err error
+		for _, i := range c.failover.candidates(time.Now()) {
+			if err = c.connect(context.Background(), i); err == nil {
+				return c, nil
+			}
+			c.failover.down[i] = time.Now().Add(c.failover.deadTime)
+		}
+		return nil, fmt.Errorf("no server available; %w", err)
+	}
 	return c, nil
 }
 
+// close releases the connection of a client that failed to build
+func (c *Client) close() {
+	if c.crypter != nil {
+		c.crypter.Close()
+	}
+}
+
 // Client base client implementation for server/client communication
 type Client struct {
 	crypter *crypter
+	// mux is set when single-connect is requested
+	mux *demux
+	// failover is set when a list of servers is given, crypter then being the connection to
+	// the current server
+	failover *failover
+	// unencrypted if set, sends every packet with the UnencryptedFlag
+	unencrypted bool
 }
 
 // Send sends a packet to the server and decodes the response.  If multiple packet exchanges are
 // necessary, the caller will need to call this method repeatedly to achieve the desired
-// result.
+// result.  Send is only safe for concurrent use with SetClientSingleConnect.
 func (c *Client) Send(p *Packet) (*Packet, error) {
-	_, err := c.crypter.write(p)
-	if err != nil {
+	return c.SendContext(context.Background(), p)
+}
+
+// SendContext is Send bounded by ctx.  The deadline of ctx is applied to the reads and writes of
+// the connection, and cancelling ctx interrupts the exchange, returning an error wrapping
+// ctx.Err().  The server may still answer an interrupted exchange, so without single-connect the
+// connection is left in an unknown state and should be closed.  Single-connect clients drop the
+// late reply and remain usable, unless the write itself was interrupted.
+func (c *Client) SendContext(ctx context.Context, p *Packet) (*Packet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.mux != nil {
+		return c.sendMux(ctx, p)
+	}
+	if c.failover != nil {
+		return c.sendFailover(ctx, p)
+	}
+	if ctx.Done() == nil {
+		// never cancelled, so there is no deadline to watch
+		return c.exchange(p)
+	}
+	stop := watchDeadline(ctx, c.crypter.SetDeadline)
+	resp, err := c.exchange(p)
+	if ctxErr := stop(); err != nil && ctxErr != nil {
+		return nil, fmt.Errorf("exchange interrupted; %w", ctxErr)
+	}
+	return resp, err
+}
+
+// exchange writes p and reads its reply
+func (c *Client) exchange(p *Packet) (*Packet, error) {
+	if _, err := c.crypter.write(p); err != nil {
 		return nil, err
 	}
 	return c.crypter.read()
+}
 
+// watchDeadline applies the deadline of ctx with set, and expires it when ctx is cancelled so a
+// blocked read or write returns.  The returned stop clears the deadline and reports ctx.Err() if
+// ctx ended before it was called.
+func watchDeadline(ctx context.Context, set func(time.Time) error) (stop func() error) {
+	deadline, _ := ctx.Deadline()
+	set(deadline)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			// any time in the past fails pending and future io immediately
+			set(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() error {
+		close(done)
+		wg.Wait()
+		set(time.Time{})
+		return ctx.Err()
+	}
 }
 
 // SendOnly sends a packet to the server. It does not decode the response.
 func (c *Client) SendOnly(p *Packet) error {
+	if c.mux != nil {
+		c.mux.write.Lock()
+		defer c.mux.write.Unlock()
+	}
+	if c.crypter == nil {
+		return errNotConnected
+	}
 	_, err := c.crypter.write(p)
 	if err != nil {
 		return err
@@ -100,5 +246,9 @@ func (c *Client) SendOnly(p *Packet) error {
 
 // Close ...
 func (c *Client) Close() error {
+	if c.crypter == nil {
+		// a failover client whose every server failed
+		return nil
+	}
 	return c.crypter.Close()
 }
@@ -0,0 +1,138 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxASCIIPrompts bounds the replies an ascii login may prompt with before it is given up on
+const maxASCIIPrompts = 8
+
+// AuthenticatePAP logs user in with password in a single pap exchange and returns the server's
+// reply.  opts are applied after the defaults of a login at PrivLvlUser, eg SetAuthenStartPort.
+func (c *Client) AuthenticatePAP(ctx context.Context, user, password string, opts ...AuthenStartOption) (*AuthenReply, error) {
+	body := NewAuthenStart(append([]AuthenStartOption{
+		SetAuthenStartAction(AuthenActionLogin),
+		SetAuthenStartPrivLvl(PrivLvlUser),
+		SetAuthenStartType(AuthenTypePAP),
+		SetAuthenStartService(AuthenServiceLogin),
+		SetAuthenStartUser(AuthenUser(user)),
+		SetAuthenStartData(AuthenData(password)),
+	}, opts...)...)
+	resp, err := c.start(ctx, Authenticate, body)
+	if err != nil {
+		return nil, err
+	}
+	var reply AuthenReply
+	if err := Unmarshal(resp.Body, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// AuthenticateASCII logs user in with password, answering the server's username and password
+// prompts, and returns the reply that ends the login.  A server asking for other data, eg a
+// token, cannot be answered, so the login is aborted and an error returned along with that
+// reply.  opts are applied after the defaults of a login at PrivLvlUser, eg SetAuthenStartPort.
+func (c *Client) AuthenticateASCII(ctx context.Context, user, password string, opts ...AuthenStartOption) (*AuthenReply, error) {
+	body := NewAuthenStart(append([]AuthenStartOption{
+		SetAuthenStartAction(AuthenActionLogin),
+		SetAuthenStartPrivLvl(PrivLvlUser),
+		SetAuthenStartType(AuthenTypeASCII),
+		SetAuthenStartService(AuthenServiceLogin),
+		SetAuthenStartUser(AuthenUser(user)),
+	}, opts...)...)
+	s, err := NewSession(Authenticate)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.SendSession(ctx, s, body)
+	for prompts := 0; ; prompts++ {
+		if err != nil {
+			return nil, err
+		}
+		var reply AuthenReply
+		if err := Unmarshal(resp.Body, &reply); err != nil {
+			return nil, err
+		}
+		var answer *AuthenContinue
+		switch reply.Status {
+		case AuthenStatusGetUser:
+			answer = NewAuthenContinue(SetAuthenContinueUserMessage(AuthenUserMessage(user)))
+		case AuthenStatusGetPass:
+			answer = NewAuthenContinue(SetAuthenContinueUserMessage(AuthenUserMessage(password)))
+		case AuthenStatusGetData:
+			c.SendSession(ctx, s, NewAuthenContinue(SetAuthenContinueFlag(AuthenContinueFlagAbort)))
+			return &reply, fmt.Errorf("ascii login of [%v] aborted, unable to answer prompt [%v]", user, reply.ServerMsg)
+		default:
+			return &reply, nil
+		}
+		if prompts == maxASCIIPrompts {
+			c.SendSession(ctx, s, NewAuthenContinue(SetAuthenContinueFlag(AuthenContinueFlagAbort)))
+			return &reply, fmt.Errorf("ascii login of [%v] aborted after [%v] prompts", user, prompts)
+		}
+		resp, err = c.SendSession(ctx, s, answer)
+	}
+}
+
+// Authorize asks the server to authorize args for user and returns its reply.  opts are
+// applied after the defaults of a tacacs+ login at PrivLvlUser, eg SetAuthorRequestPort.
+func (c *Client) Authorize(ctx context.Context, user string, args Args, opts ...AuthorRequestOption) (*AuthorReply, error) {
+	body := NewAuthorRequest(append([]AuthorRequestOption{
+		SetAuthorRequestMethod(AuthenMethodTacacsPlus),
+		SetAuthorRequestPrivLvl(PrivLvlUser),
+		SetAuthorRequestType(AuthenTypeASCII),
+		SetAuthorRequestService(AuthenServiceLogin),
+		SetAuthorRequestUser(AuthenUser(user)),
+		SetAuthorRequestArgs(args),
+	}, opts...)...)
+	resp, err := c.start(ctx, Authorize, body)
+	if err != nil {
+		return nil, err
+	}
+	var reply AuthorReply
+	if err := UnmarshalWithFlags(resp.Body, resp.Header.Flags, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// Account sends an accounting record of args for user, flags being AcctFlagStart, AcctFlagStop or
+// AcctFlagWatchdog, and returns the server's reply.  opts are applied after the defaults of a
+// tacacs+ login at PrivLvlUser, eg SetAcctRequestPort.
+func (c *Client) Account(ctx context.Context, user string, flags AcctRequestFlag, args Args, opts ...AcctRequestOption) (*AcctReply, error) {
+	body := NewAcctRequest(append([]AcctRequestOption{
+		SetAcctRequestFlag(flags),
+		SetAcctRequestMethod(AuthenMethodTacacsPlus),
+		SetAcctRequestPrivLvl(PrivLvlUser),
+		SetAcctRequestType(AuthenTypeASCII),
+		SetAcctRequestService(AuthenServiceLogin),
+		SetAcctRequestUser(AuthenUser(user)),
+		SetAcctRequestArgs(args),
+	}, opts...)...)
+	resp, err := c.start(ctx, Accounting, body)
+	if err != nil {
+		return nil, err
+	}
+	var reply AcctReply
+	if err := UnmarshalWithFlags(resp.Body, resp.Header.Flags, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// start sends body as the first packet of a new session of type t
+func (c *Client) start(ctx context.Context, t HeaderType, body EncoderDecoder) (*Packet, error) {
+	s, err := NewSession(t)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendSession(ctx, s, body)
+}
@@ -0,0 +1,289 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// ClientServer is one server of a failover list
+type ClientServer struct {
+	// Address is the host:port of the server
+	Address string
+	// Secret is the secret shared with the server
+	Secret []byte
+}
+
+// FailoverPolicy selects the failures that move a client on to the next server of its list
+type FailoverPolicy uint8
+
+const (
+	// FailoverTimeout fails over when a server does not answer in time
+	FailoverTimeout FailoverPolicy = 1 << iota
+	// FailoverRefused fails over when a server refuses the connection or closes it without
+	// answering
+	FailoverRefused
+	// FailoverBadSecret fails over when a server's reply does not decrypt with its secret
+	FailoverBadSecret
+	// FailoverAll fails over on every failure above
+	FailoverAll = FailoverTimeout | FailoverRefused | FailoverBadSecret
+)
+
+// errNotConnected is returned by failover clients whose every server failed
+var errNotConnected = errors.New("not connected to a server")
+
+// SetClientServers dials the first available server of an ordered list, mirroring the server
+// lists of network devices, see SetClientDialer for network and address.  When a session cannot
+// start on a server, for a reason selected by SetClientFailoverPolicy, the server is marked down
+// for SetClientDeadTime and the session is started on the next server.  Once the dead time of an
+// earlier server passes, the client returns to it at the start of the next session.  Packets
+// continuing a session are never failed over.  This is a dialer option and cannot be combined
+// with SetClientSingleConnect; use a ClientPool to spread sessions across servers instead.
+func SetClientServers(network string, servers ...ClientServer) ClientOption {
+	return func(c *Client) error {
+		if c.crypter != nil || c.failover != nil {
+			return errDialerSet
+		}
+		if len(servers) == 0 {
+			return fmt.Errorf("SetClientServers requires at least one server")
+		}
+		c.failover = &failover{
+			network:  network,
+			servers:  servers,
+			policy:   FailoverAll,
+			timeout:  5 * time.Second,
+			deadTime: time.Minute,
+			down:     make([]time.Time, len(servers)),
+			current:  -1,
+		}
+		return nil
+	}
+}
+
+// SetClientFailoverPolicy sets the failures that fail over to the next server, defaults to
+// FailoverAll.  This option must follow SetClientServers.
+func SetClientFailoverPolicy(p FailoverPolicy) ClientOption {
+	return func(c *Client) error {
+		if c.failover == nil {
+			return fmt.Errorf("SetClientFailoverPolicy must follow SetClientServers")
+		}
+		c.failover.policy = p
+		return nil
+	}
+}
+
+// SetClientServerTimeout sets how long each server has to accept a connection, and to answer the
+// first packet of a session, before it times out.  Defaults to 5s.  This option must follow
+// SetClientServers.
+func SetClientServerTimeout(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		if c.failover == nil {
+			return fmt.Errorf("SetClientServerTimeout must follow SetClientServers")
+		}
+		c.failover.timeout = d
+		return nil
+	}
+}
+
+// SetClientDeadTime sets how long a server that failed is skipped before it is tried again,
+// defaults to 1m.  This option must follow SetClientServers.
+func SetClientDeadTime(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		if c.failover == nil {
+			return fmt.Errorf("SetClientDeadTime must follow SetClientServers")
+		}
+		c.failover.deadTime = d
+		return nil
+	}
+}
+
+// failover is the server list of a client created with SetClientServers
+type failover struct {
+	network  string
+	servers  []ClientServer
+	policy   FailoverPolicy
+	timeout  time.Duration
+	deadTime time.Duration
+	// down holds the time each server was marked down until
+	down []time.Time
+	// current is the index of the server the client last connected to, -1 if none
+	current int
+	// fresh is set until the connection to current carries its first exchange
+	fresh bool
+}
+
+// Server returns the address of the server the client is connected to, empty if it is not
+// connected
+func (c *Client) Server() string {
+	if c.crypter == nil {
+		return ""
+	}
+	if c.failover != nil {
+		return c.failover.servers[c.failover.current].Address
+	}
+	return c.crypter.RemoteAddr().String()
+}
+
+// sendFailover implements SendContext for clients created with SetClientServers
+func (c *Client) sendFailover(ctx context.Context, p *Packet) (*Packet, error) {
+	f := c.failover
+	if p == nil || p.Header == nil {
+		return nil, fmt.Errorf("packet and header cannot be nil")
+	}
+	if p.Header.SeqNo > 1 {
+		// the session lives on the server it started on
+		if c.crypter == nil {
+			return nil, errNotConnected
+		}
+		resp, err := c.exchangeWithin(ctx, p, 0)
+		if err != nil {
+			c.disconnect()
+		}
+		return resp, err
+	}
+	var err error
+	for _, i := range f.candidates(time.Now()) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var resp *Packet
+		resp, err = c.startOn(ctx, i, p)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil || !f.policy.matches(err) {
+			return nil, err
+		}
+		clientFailover.Inc()
+		f.down[i] = time.Now().Add(f.deadTime)
+	}
+	return nil, fmt.Errorf("no server available; %w", err)
+}
+
+// startOn exchanges p, the first packet of a session, with server i.  A reused connection that
+// was closed is redialed once, servers closing idle connections is expected.  p is left as it
+// was, since writing a packet crypts its body in place.
+func (c *Client) startOn(ctx context.Context, i int, p *Packet) (*Packet, error) {
+	f := c.failover
+	if c.crypter == nil || f.current != i {
+		if i < f.current {
+			clientFailoverRestored.Inc()
+		}
+		c.disconnect()
+		if err := c.connect(ctx, i); err != nil {
+			return nil, err
+		}
+	}
+	reused := !f.fresh
+	f.fresh = false
+	resp, err := c.exchangeWithin(ctx, clonePacket(p), f.timeout)
+	if err != nil {
+		c.disconnect()
+		if reused && ctx.Err() == nil && closed(err) {
+			if err := c.connect(ctx, i); err != nil {
+				return nil, err
+			}
+			f.fresh = false
+			resp, err = c.exchangeWithin(ctx, clonePacket(p), f.timeout)
+			if err != nil {
+				c.disconnect()
+			}
+		}
+	}
+	return resp, err
+}
+
+// clonePacket copies the header and body of p
+func clonePacket(p *Packet) *Packet {
+	header := *p.Header
+	return &Packet{Header: &header, Body: append([]byte(nil), p.Body...)}
+}
+
+// candidates returns the servers to try in order, skipping those marked down at now unless every
+// server is
+func (f *failover) candidates(now time.Time) []int {
+	var up, down []int
+	for i := range f.servers {
+		if now.Before(f.down[i]) {
+			down = append(down, i)
+			continue
+		}
+		up = append(up, i)
+	}
+	if len(up) == 0 {
+		return down
+	}
+	return up
+}
+
+// connect dials server i within the server timeout
+func (c *Client) connect(ctx context.Context, i int) error {
+	f := c.failover
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, f.network, f.servers[i].Address)
+	if err != nil {
+		return err
+	}
+	c.crypter = newCrypter(f.servers[i].Secret, conn, false)
+	c.crypter.unencrypted = c.unencrypted
+	f.current, f.fresh = i, true
+	return nil
+}
+
+// disconnect closes the connection to the current server
+func (c *Client) disconnect() {
+	if c.crypter != nil {
+		c.crypter.Close()
+		c.crypter = nil
+	}
+}
+
+// exchangeWithin exchanges p within ctx, further bounded by timeout if it is not zero
+func (c *Client) exchangeWithin(ctx context.Context, p *Packet, timeout time.Duration) (*Packet, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	stop := watchDeadline(ctx, c.crypter.SetDeadline)
+	resp, err := c.exchange(p)
+	if ctxErr := stop(); err != nil && ctxErr != nil {
+		return nil, fmt.Errorf("exchange with [%v] interrupted; %w", c.Server(), ctxErr)
+	}
+	return resp, err
+}
+
+// matches reports whether err is a failure selected by the policy
+func (f FailoverPolicy) matches(err error) bool {
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrBadSecret):
+		return f&FailoverBadSecret != 0
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return f&FailoverTimeout != 0
+	case errors.Is(err, syscall.ECONNREFUSED), closed(err):
+		return f&FailoverRefused != 0
+	}
+	return false
+}
+
+// closed reports whether err is the peer closing the connection
+func closed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,203 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SetClientSingleConnect requests rfc8907 single-connection mode on every packet.  Send becomes
+// safe for concurrent use.  If the server advertises single-connect in its first reply, sessions
+// are multiplexed on the connection and replies are demultiplexed by SessionID.  Otherwise, Send
+// calls are serialized and only one session is in flight at a time.
+func SetClientSingleConnect() ClientOption {
+	return func(c *Client) error {
+		c.mux = &demux{pending: make(map[SessionID]*pendingReply)}
+		return nil
+	}
+}
+
+// errNotSent wraps the errors of packets that were never written to the connection, which are
+// safe to send again on another one
+var errNotSent = errors.New("packet not sent")
+
+// negotiation states for single-connect
+const (
+	muxUnknown = iota
+	muxNegotiated
+	muxDeclined
+)
+
+// pendingReply is a session waiting on its next packet from the server
+type pendingReply struct {
+	seqNo SequenceNumber
+	reply chan *Packet
+}
+
+// demux tracks sessions in flight on a single connection
+type demux struct {
+	// gate serializes Sends until the server agrees to single-connect, and for the life of
+	// the connection if it declines
+	gate sync.Mutex
+	// write serializes packet writes onto the connection
+	write sync.Mutex
+
+	mu      sync.Mutex
+	state   int
+	pending map[SessionID]*pendingReply
+	reading bool
+	err     error
+}
+
+// Multiplexed reports whether the server agreed to single-connect mode.  It is false until
+// the first reply is received.
+func (c *Client) Multiplexed() bool {
+	if c.mux == nil {
+		return false
+	}
+	c.mux.mu.Lock()
+	defer c.mux.mu.Unlock()
+	return c.mux.state == muxNegotiated
+}
+
+// closedErr returns the error that closed a single-connect connection, nil while it is open
+func (c *Client) closedErr() error {
+	if c.mux == nil {
+		return nil
+	}
+	c.mux.mu.Lock()
+	defer c.mux.mu.Unlock()
+	return c.mux.err
+}
+
+// sendMux implements Send for single-connect clients
+func (c *Client) sendMux(ctx context.Context, p *Packet) (*Packet, error) {
+	if p == nil || p.Header == nil {
+		return nil, fmt.Errorf("packet and header cannot be nil")
+	}
+	p.Header.Flags.Set(SingleConnect)
+	c.mux.gate.Lock()
+	c.mux.mu.Lock()
+	state := c.mux.state
+	c.mux.mu.Unlock()
+	if state == muxNegotiated {
+		c.mux.gate.Unlock()
+		return c.roundTrip(ctx, p)
+	}
+	defer c.mux.gate.Unlock()
+	resp, err := c.roundTrip(ctx, p)
+	if err == nil && state == muxUnknown {
+		c.mux.mu.Lock()
+		if resp.Header.Flags.Has(SingleConnect) {
+			c.mux.state = muxNegotiated
+		} else {
+			c.mux.state = muxDeclined
+		}
+		c.mux.mu.Unlock()
+	}
+	return resp, err
+}
+
+// roundTrip writes p and waits for the server's reply to that session.  Other sessions share the
+// connection's reads, so ctx only bounds the write and the wait for the reply.
+func (c *Client) roundTrip(ctx context.Context, p *Packet) (*Packet, error) {
+	id := p.Header.SessionID
+	pr := &pendingReply{seqNo: p.Header.SeqNo, reply: make(chan *Packet, 1)}
+	c.mux.mu.Lock()
+	if c.mux.err != nil {
+		err := c.mux.err
+		c.mux.mu.Unlock()
+		return nil, fmt.Errorf("%w; %v", errNotSent, err)
+	}
+	if _, inflight := c.mux.pending[id]; inflight {
+		c.mux.mu.Unlock()
+		return nil, fmt.Errorf("session [%v] already has a packet in flight", id)
+	}
+	c.mux.pending[id] = pr
+	if !c.mux.reading {
+		c.mux.reading = true
+		go c.readLoop()
+	}
+	c.mux.mu.Unlock()
+
+	c.mux.write.Lock()
+	var ctxErr error
+	var err error
+	if ctx.Done() == nil {
+		_, err = c.crypter.write(p)
+	} else {
+		stop := watchDeadline(ctx, c.crypter.SetWriteDeadline)
+		_, err = c.crypter.write(p)
+		ctxErr = stop()
+	}
+	c.mux.write.Unlock()
+	if err != nil {
+		c.forget(id, pr)
+		if ctxErr != nil {
+			return nil, fmt.Errorf("session [%v] interrupted; %w", id, ctxErr)
+		}
+		return nil, err
+	}
+	var resp *Packet
+	var ok bool
+	select {
+	case resp, ok = <-pr.reply:
+	case <-ctx.Done():
+		c.forget(id, pr)
+		return nil, fmt.Errorf("session [%v] interrupted; %w", id, ctx.Err())
+	}
+	if !ok {
+		c.mux.mu.Lock()
+		defer c.mux.mu.Unlock()
+		return nil, c.mux.err
+	}
+	// the server replies with the next sequence number, or restarts the session at 1
+	if resp.Header.SeqNo != pr.seqNo+1 && resp.Header.SeqNo != 1 {
+		return nil, fmt.Errorf("session [%v] reply has sequence [%v], expected [%v]", id, resp.Header.SeqNo, pr.seqNo+1)
+	}
+	return resp, nil
+}
+
+// forget stops waiting on the reply of session id, unless the session is already waiting on
+// another packet
+func (c *Client) forget(id SessionID, pr *pendingReply) {
+	c.mux.mu.Lock()
+	defer c.mux.mu.Unlock()
+	if c.mux.pending[id] == pr {
+		delete(c.mux.pending, id)
+	}
+}
+
+// readLoop demultiplexes replies to their waiting sessions until the connection fails
+func (c *Client) readLoop() {
+	for {
+		p, err := c.crypter.read()
+		c.mux.mu.Lock()
+		if err != nil {
+			c.mux.err = fmt.Errorf("single-connect connection closed; %w", err)
+			for id, pr := range c.mux.pending {
+				close(pr.reply)
+				delete(c.mux.pending, id)
+			}
+			c.mux.mu.Unlock()
+			return
+		}
+		pr, ok := c.mux.pending[p.Header.SessionID]
+		if ok {
+			delete(c.mux.pending, p.Header.SessionID)
+		}
+		c.mux.mu.Unlock()
+		if ok {
+			pr.reply <- p
+		}
+		// replies for unknown sessions are dropped, the server may be answering a SendOnly
+	}
+}
@@ -0,0 +1,319 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ClientPoolOption is a setter type for ClientPool
+type ClientPoolOption func(p *ClientPool) error
+
+// SetClientPoolSize sets the number of connections kept to each server, defaults to 2
+func SetClientPoolSize(n int) ClientPoolOption {
+	return func(p *ClientPool) error {
+		if n < 1 {
+			return fmt.Errorf("client pool size [%v] must be at least 1", n)
+		}
+		p.size = n
+		return nil
+	}
+}
+
+// SetClientPoolDialer sets the dialer option used to connect to each server address, eg a
+// SetClientTLSDialer.  Defaults to SetClientDialer with the pool's network and secret.
+func SetClientPoolDialer(dialer func(address string) ClientOption) ClientPoolOption {
+	return func(p *ClientPool) error {
+		p.dialer = dialer
+		return nil
+	}
+}
+
+// SetClientPoolClientOptions adds opts to every client of the pool, after the dialer, eg
+// SetClientProxyHeader
+func SetClientPoolClientOptions(opts ...ClientOption) ClientPoolOption {
+	return func(p *ClientPool) error {
+		p.clientOpts = append(p.clientOpts, opts...)
+		return nil
+	}
+}
+
+// SetClientPoolMaxIdle sets how long a connection may sit unused before it is redialed instead of
+// reused.  Servers close idle connections, tacquito after its read timeout, so keep this below
+// theirs.  Defaults to 10s, zero never redials idle connections.
+func SetClientPoolMaxIdle(d time.Duration) ClientPoolOption {
+	return func(p *ClientPool) error {
+		p.maxIdle = d
+		return nil
+	}
+}
+
+// SetClientPoolRetryInterval sets how long a connection that failed to dial is skipped before it
+// is dialed again, defaults to 5s
+func SetClientPoolRetryInterval(d time.Duration) ClientPoolOption {
+	return func(p *ClientPool) error {
+		p.retryInterval = d
+		return nil
+	}
+}
+
+// NewClientPool creates a pool of size connections to each of addresses, see SetClientDialer for
+// network and address.  Connections are dialed when first needed, with single-connect requested,
+// and redialed once they fail or idle too long.  Sessions are spread across the connections by
+// SessionID, and every packet of a session is sent on the connection that started it.
+func NewClientPool(network string, addresses []string, secret []byte, opts ...ClientPoolOption) (*ClientPool, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("client pool requires at least one server address")
+	}
+	p := &ClientPool{
+		size:          2,
+		maxIdle:       10 * time.Second,
+		retryInterval: 5 * time.Second,
+		dialer: func(address string) ClientOption {
+			return SetClientDialer(network, address, secret)
+		},
+		sessions: make(map[SessionID]*poolConn),
+		wake:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < p.size; i++ {
+		for _, address := range addresses {
+			p.conns = append(p.conns, &poolConn{address: address})
+		}
+	}
+	return p, nil
+}
+
+// ClientPool spreads sessions across connections to one or more servers.  It is safe for
+// concurrent use.  Servers that decline single-connect close the connection after each session,
+// so each of their connections carries one session at a time.
+type ClientPool struct {
+	size          int
+	maxIdle       time.Duration
+	retryInterval time.Duration
+	dialer        func(address string) ClientOption
+	clientOpts    []ClientOption
+
+	mu       sync.Mutex
+	conns    []*poolConn
+	sessions map[SessionID]*poolConn
+	// wake is closed and replaced whenever a connection is released, waking sessions waiting
+	// on a busy pool
+	wake   chan struct{}
+	closed bool
+}
+
+// poolConn is one connection of a ClientPool
+type poolConn struct {
+	address string
+	// client is nil until dialed
+	client *Client
+	// dialing is set while client is dialed outside of the pool's lock
+	dialing bool
+	// sessions is the number of sessions in progress
+	sessions int
+	lastUsed time.Time
+	retryAt  time.Time
+	dialErr  error
+}
+
+// available reports whether c can take a new session at now
+func (c *poolConn) available(now time.Time) bool {
+	if c.dialing || now.Before(c.retryAt) {
+		return false
+	}
+	// until the server agrees to single-connect, a connection serves one session at a time
+	return c.client == nil || c.sessions == 0 || c.client.Multiplexed()
+}
+
+// stale reports whether the client of c should be redialed before its next session
+func (c *poolConn) stale(now time.Time, maxIdle time.Duration) bool {
+	if c.client == nil || c.sessions > 0 {
+		return false
+	}
+	return c.client.closedErr() != nil || (maxIdle > 0 && now.Sub(c.lastUsed) > maxIdle)
+}
+
+// Send sends p on the connection of its session and returns the reply.  The first packet of a
+// session picks a connection, waiting for one to free up if every connection is busy, and is
+// sent again on another connection if the one picked had closed before p was written.
+func (p *ClientPool) Send(ctx context.Context, packet *Packet) (*Packet, error) {
+	if packet == nil || packet.Header == nil {
+		return nil, fmt.Errorf("packet and header cannot be nil")
+	}
+	id := packet.Header.SessionID
+	for retried := false; ; retried = true {
+		c, started, err := p.conn(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.client.SendContext(ctx, packet)
+		if err != nil {
+			p.release(id, c, true)
+			if started && !retried && errors.Is(err, errNotSent) {
+				clientPoolRetried.Inc()
+				continue
+			}
+			return nil, err
+		}
+		if !sessionContinues(resp) {
+			p.release(id, c, false)
+		}
+		return resp, nil
+	}
+}
+
+// conn returns the connection of session id, picking and dialing one if the session is new
+func (p *ClientPool) conn(ctx context.Context, id SessionID) (c *poolConn, started bool, err error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, false, fmt.Errorf("client pool is closed")
+		}
+		if c, ok := p.sessions[id]; ok {
+			p.mu.Unlock()
+			return c, false, nil
+		}
+		c, err := p.pick(id)
+		if err != nil {
+			p.mu.Unlock()
+			return nil, false, err
+		}
+		if c == nil {
+			wake := p.wake
+			p.mu.Unlock()
+			select {
+			case <-wake:
+				continue
+			case <-ctx.Done():
+				return nil, false, fmt.Errorf("no pooled connection for session [%v]; %w", id, ctx.Err())
+			}
+		}
+		c.sessions++
+		p.sessions[id] = c
+		if c.client != nil {
+			c.lastUsed = time.Now()
+			p.mu.Unlock()
+			return c, true, nil
+		}
+		c.dialing = true
+		p.mu.Unlock()
+
+		client, err := NewClient(append([]ClientOption{p.dialer(c.address), SetClientSingleConnect()}, p.clientOpts...)...)
+		p.mu.Lock()
+		c.dialing = false
+		if err != nil {
+			clientPoolDialError.Inc()
+			c.dialErr = fmt.Errorf("unable to dial [%v]; %v", c.address, err)
+			c.retryAt = time.Now().Add(p.retryInterval)
+			p.forget(id, c)
+			p.mu.Unlock()
+			continue
+		}
+		clientPoolDialed.Inc()
+		if p.closed {
+			client.Close()
+			p.forget(id, c)
+			p.mu.Unlock()
+			return nil, false, fmt.Errorf("client pool is closed")
+		}
+		c.client, c.lastUsed = client, time.Now()
+		p.mu.Unlock()
+		return c, true, nil
+	}
+}
+
+// pick chooses the connection of a new session, starting from the one its id hashes to so that
+// sessions spread evenly.  It returns nil if every connection is busy, and an error if every
+// connection failed to dial and is waiting to be retried.  p.mu must be held.
+func (p *ClientPool) pick(id SessionID) (*poolConn, error) {
+	now := time.Now()
+	start := int(uint32(id) % uint32(len(p.conns)))
+	var err error
+	down := 0
+	for i := range p.conns {
+		c := p.conns[(start+i)%len(p.conns)]
+		if c.stale(now, p.maxIdle) {
+			c.client.Close()
+			c.client = nil
+		}
+		if c.available(now) {
+			return c, nil
+		}
+		if c.sessions == 0 && !c.dialing && now.Before(c.retryAt) {
+			down++
+			err = c.dialErr
+		}
+	}
+	if down == len(p.conns) {
+		return nil, fmt.Errorf("no server available; %v", err)
+	}
+	return nil, nil
+}
+
+// release ends session id on c.  A broken connection is closed, and redialed by its next session,
+// as is one the server declined single-connect on, since the server closes it after the session.
+func (p *ClientPool) release(id SessionID, c *poolConn, broken bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c.client != nil && (broken || !c.client.Multiplexed()) {
+		c.client.Close()
+		c.client = nil
+	}
+	p.forget(id, c)
+}
+
+// forget removes session id from c and wakes sessions waiting on a busy pool.  p.mu must be held.
+func (p *ClientPool) forget(id SessionID, c *poolConn) {
+	if p.sessions[id] != c {
+		return
+	}
+	delete(p.sessions, id)
+	c.sessions--
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// Close closes every connection of the pool.  Sessions in progress fail.
+func (p *ClientPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, c := range p.conns {
+		if c.client != nil {
+			c.client.Close()
+			c.client = nil
+		}
+	}
+	return nil
+}
+
+// sessionContinues reports whether the server expects another packet in the session resp answers
+func sessionContinues(resp *Packet) bool {
+	if resp.Header == nil || resp.Header.Type != Authenticate {
+		return false
+	}
+	var body AuthenReply
+	if err := Unmarshal(resp.Body, &body); err != nil {
+		return false
+	}
+	switch body.Status {
+	case AuthenStatusGetData, AuthenStatusGetUser, AuthenStatusGetPass:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+// SessionOption is used to inject options when creating new Session types
+type SessionOption func(*Session)
+
+// SetSessionID sets the session id rather than generating one, eg to resume a session
+func SetSessionID(v SessionID) SessionOption {
+	return func(s *Session) {
+		s.id = v
+	}
+}
+
+// SetSessionVersion sets the version of every packet of the session rather than choosing it from
+// the first packet's body
+func SetSessionVersion(v Version) SessionOption {
+	return func(s *Session) {
+		s.version = &v
+	}
+}
+
+// SetSessionFlags sets the header flags of every packet of the session, eg SingleConnect or
+// ExtendedArgLength, whose bodies are then encoded accordingly
+func SetSessionFlags(v HeaderFlag) SessionOption {
+	return func(s *Session) {
+		s.flags = v
+	}
+}
+
+// Session builds the headers of the packets a client sends in one session, and checks the
+// replies it receives.  The session id is generated with crypto/rand, as rfc 8907 requires,
+// sequence numbers follow each reply, and the minor version is chosen per rfc 8907 from the
+// first packet, https://datatracker.ietf.org/doc/html/rfc8907#section-4.1.  Sessions are not
+// safe for concurrent use, the packets of a session are sent one at a time.
+type Session struct {
+	t       HeaderType
+	id      SessionID
+	version *Version
+	flags   HeaderFlag
+	// seqNo is the sequence number of the last packet sent or received
+	seqNo SequenceNumber
+	// waiting is set once a packet is sent, until its reply is received
+	waiting bool
+}
+
+// NewSession starts a session of type t, eg Authenticate
+func NewSession(t HeaderType, opts ...SessionOption) (*Session, error) {
+	if err := t.Validate(nil); err != nil {
+		return nil, err
+	}
+	s := &Session{t: t}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.id == 0 {
+		b := make([]byte, 4)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("unable to generate a session id; %v", err)
+		}
+		s.id = SessionID(binary.BigEndian.Uint32(b))
+	}
+	return s, nil
+}
+
+// ID returns the session id
+func (s *Session) ID() SessionID {
+	return s.id
+}
+
+// Version returns the version of the session's packets, the zero Version until the first packet
+// chooses it
+func (s *Session) Version() Version {
+	if s.version == nil {
+		return Version{}
+	}
+	return *s.version
+}
+
+// Packet returns the next packet of the session, carrying body.  The first packet is numbered 1,
+// later ones follow the last reply, so each must wait for the reply to the one before it.
+func (s *Session) Packet(body EncoderDecoder) (*Packet, error) {
+	if s.waiting {
+		return nil, fmt.Errorf("session [%v] is waiting for the reply to sequence number [%v]", s.id, s.seqNo)
+	}
+	if s.seqNo >= 254 {
+		return nil, fmt.Errorf("session [%v] has reached the maximum sequence number, it must restart", s.id)
+	}
+	if s.version == nil {
+		s.version = &Version{MajorVersion: MajorVersion, MinorVersion: minorVersion(body)}
+	}
+	b, err := MarshalWithFlags(s.flags, body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal [%T]; %v", body, err)
+	}
+	header := NewHeader(
+		SetHeaderVersion(*s.version),
+		SetHeaderType(s.t),
+		SetHeaderSeqNo(int(s.seqNo)+1),
+		SetHeaderSessionID(s.id),
+		SetHeaderFlag(s.flags),
+	)
+	s.seqNo++
+	s.waiting = true
+	return NewPacket(SetPacketHeader(header), SetPacketBody(b)), nil
+}
+
+// Reply checks that p replies to the last packet of the session, and moves the session on so the
+// next packet follows it.  A server that replies with another minor version, as servers do when
+// they do not support the one asked for, is followed for the rest of the session.
+func (s *Session) Reply(p *Packet) error {
+	if p == nil || p.Header == nil {
+		return fmt.Errorf("reply to session [%v] has no header", s.id)
+	}
+	h := p.Header
+	switch {
+	case !s.waiting:
+		return fmt.Errorf("session [%v] is not waiting for a reply", s.id)
+	case h.SessionID != s.id:
+		return fmt.Errorf("reply is for session [%v], expected [%v]", h.SessionID, s.id)
+	case h.Type != s.t:
+		return fmt.Errorf("reply to session [%v] is of type [%v], expected [%v]", s.id, h.Type, s.t)
+	case h.SeqNo != s.seqNo+1:
+		return fmt.Errorf("%w; reply to session [%v] has sequence number [%v], expected [%v]", ErrSequence, s.id, h.SeqNo, s.seqNo+1)
+	case h.Version.MajorVersion != MajorVersion:
+		return fmt.Errorf("reply to session [%v] has major version [%v]", s.id, h.Version.MajorVersion)
+	}
+	s.version = &h.Version
+	s.seqNo = h.SeqNo
+	s.waiting = false
+	return nil
+}
+
+// minorVersion is the minor version rfc 8907 gives the session a packet starts.  Logins exchanging
+// the password in the start packet use MinorVersionOne, everything else MinorVersionDefault.
+func minorVersion(body EncoderDecoder) uint8 {
+	if start, ok := body.(*AuthenStart); ok {
+		switch start.Type {
+		case AuthenTypePAP, AuthenTypeCHAP, AuthenTypeARAP, AuthenTypeMSCHAP, AuthenTypeMSCHAPV2:
+			return MinorVersionOne
+		}
+	}
+	return MinorVersionDefault
+}
+
+// SendSession sends body as the next packet of s and returns the server's reply, once s has
+// checked it
+func (c *Client) SendSession(ctx context.Context, s *Session, body EncoderDecoder) (*Packet, error) {
+	p, err := s.Packet(body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.SendContext(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Reply(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
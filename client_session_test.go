@@ -0,0 +1,95 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replyTo returns the reply a server would send to p, with version v
+func replyTo(p *Packet, v Version) *Packet {
+	return NewPacket(SetPacketHeader(NewHeader(
+		SetHeaderVersion(v),
+		SetHeaderType(p.Header.Type),
+		SetHeaderSeqNo(int(p.Header.SeqNo)+1),
+		SetHeaderSessionID(p.Header.SessionID),
+	)), SetPacketBody([]byte{}))
+}
+
+func TestSessionSequence(t *testing.T) {
+	s, err := NewSession(Authenticate)
+	require.NoError(t, err)
+	assert.NotZero(t, s.ID())
+
+	// an ascii login is a default version session
+	p, err := s.Packet(NewAuthenStart(SetAuthenStartType(AuthenTypeASCII), SetAuthenStartAction(AuthenActionLogin), SetAuthenStartService(AuthenServiceLogin)))
+	require.NoError(t, err)
+	assert.Equal(t, SequenceNumber(1), p.Header.SeqNo)
+	assert.Equal(t, s.ID(), p.Header.SessionID)
+	assert.Equal(t, Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionDefault}, p.Header.Version)
+	assert.Equal(t, uint32(len(p.Body)), p.Header.Length)
+
+	// the next packet waits for the reply
+	_, err = s.Packet(NewAuthenContinue())
+	assert.Error(t, err)
+	assert.Error(t, s.Reply(replyTo(p, Version{MajorVersion: 0x1})))
+	wrong := replyTo(p, p.Header.Version)
+	wrong.Header.SeqNo = 4
+	assert.Error(t, s.Reply(wrong))
+	wrong = replyTo(p, p.Header.Version)
+	wrong.Header.SessionID++
+	assert.Error(t, s.Reply(wrong))
+	require.NoError(t, s.Reply(replyTo(p, p.Header.Version)))
+	assert.Error(t, s.Reply(replyTo(p, p.Header.Version)))
+
+	p, err = s.Packet(NewAuthenContinue(SetAuthenContinueUserMessage("alice")))
+	require.NoError(t, err)
+	assert.Equal(t, SequenceNumber(3), p.Header.SeqNo)
+	assert.Equal(t, s.ID(), p.Header.SessionID)
+}
+
+func TestSessionVersion(t *testing.T) {
+	// pap starts a minor version one session
+	s, err := NewSession(Authenticate, SetSessionID(42))
+	require.NoError(t, err)
+	p, err := s.Packet(NewAuthenStart(SetAuthenStartType(AuthenTypePAP), SetAuthenStartAction(AuthenActionLogin), SetAuthenStartService(AuthenServiceLogin), SetAuthenStartData("secret")))
+	require.NoError(t, err)
+	assert.Equal(t, SessionID(42), p.Header.SessionID)
+	assert.Equal(t, uint8(MinorVersionOne), p.Header.Version.MinorVersion)
+
+	// a server that only supports the default version is followed
+	require.NoError(t, s.Reply(replyTo(p, Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionDefault})))
+	assert.Equal(t, uint8(MinorVersionDefault), s.Version().MinorVersion)
+
+	// versions and flags may be set
+	s, err = NewSession(Authorize, SetSessionVersion(Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionOne}), SetSessionFlags(SingleConnect))
+	require.NoError(t, err)
+	p, err = s.Packet(NewAuthorRequest(SetAuthorRequestMethod(AuthenMethodTacacsPlus), SetAuthorRequestType(AuthenTypeASCII), SetAuthorRequestService(AuthenServiceLogin), SetAuthorRequestUser("alice"), SetAuthorRequestArgs(Args{"service=shell"})))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(MinorVersionOne), p.Header.Version.MinorVersion)
+	assert.True(t, p.Header.Flags.Has(SingleConnect))
+
+	_, err = NewSession(HeaderType(9))
+	assert.Error(t, err)
+}
+
+func TestSessionMaxSequence(t *testing.T) {
+	s, err := NewSession(Authenticate)
+	require.NoError(t, err)
+	for i := 0; i < 127; i++ {
+		p, err := s.Packet(NewAuthenContinue())
+		require.NoError(t, err)
+		require.NoError(t, s.Reply(replyTo(p, p.Header.Version)))
+	}
+	// the next packet would be numbered 255
+	_, err = s.Packet(NewAuthenContinue())
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main provides a basic tacacs test client for use with tacacs servers and tacquito
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+func chap(c *tq.Client, s step) (*tq.AuthenReply, error) {
+	body, err := newCHAPStart(s)
+	if err != nil {
+		return nil, err
+	}
+	session, err := tq.NewSession(tq.Authenticate)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := exchangeContext()
+	defer cancel()
+	resp, err := c.SendSession(ctx, session, body)
+	if err != nil {
+		return nil, err
+	}
+	var reply tq.AuthenReply
+	if err := tq.Unmarshal(resp.Body, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// newCHAPStart builds the data field as the ppp id, a random challenge and the md5 response
+func newCHAPStart(s step) (*tq.AuthenStart, error) {
+	challenge := make([]byte, 1+16)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	id, challenge := challenge[0], challenge[1:]
+	h := md5.New()
+	h.Write([]byte{id})
+	h.Write([]byte(s.password()))
+	h.Write(challenge)
+	data := append([]byte{id}, challenge...)
+	data = append(data, h.Sum(nil)...)
+	return tq.NewAuthenStart(
+		tq.SetAuthenStartType(tq.AuthenTypeCHAP),
+		tq.SetAuthenStartAction(tq.AuthenActionLogin),
+		tq.SetAuthenStartPrivLvl(tq.PrivLvl(*s.PrivLvl)),
+		tq.SetAuthenStartPort(tq.AuthenPort(s.Port)),
+		tq.SetAuthenStartRemAddr(tq.AuthenRemAddr(s.RemAddr)),
+		tq.SetAuthenStartUser(tq.AuthenUser(s.Username)),
+		tq.SetAuthenStartData(tq.AuthenData(data)),
+	), nil
+}
@@ -9,49 +9,85 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"time"
 
 	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/proxy"
 
 	"golang.org/x/term"
 )
 
 var (
-	username   = flag.String("username", "", "the username to use when authenticating.")
-	password   = flag.String("password", "", "the password to use when authenticating.")
-	privLvl    = flag.Int("priv-lvl", 1, "the priv lvl that the client is requesting to auth with.")
-	network    = flag.String("network", "tcp6", "listen on tcp or tcp6")
-	address    = flag.String("address", ":2046", "listen on the provided address:port")
-	port       = flag.String("port", "", "the port the client is sourced from, tty0 for example.")
-	remAddr    = flag.String("rem-addr", "", "the remote address the client is coming from.")
-	secret     = flag.String("secret", "fooman", "the tacacs secret to be used.")
-	authenMode = flag.String("authen-mode", "pap", "valid choices, [pap ascii]")
+	username    = flag.String("username", "", "the username to use when authenticating.")
+	password    = flag.String("password", "", "the password to use when authenticating.")
+	privLvl     = flag.Int("priv-lvl", 1, "the priv lvl that the client is requesting to auth with.")
+	network     = flag.String("network", "tcp6", "listen on tcp or tcp6")
+	address     = flag.String("address", ":2046", "listen on the provided address:port")
+	port        = flag.String("port", "", "the port the client is sourced from, tty0 for example.")
+	remAddr     = flag.String("rem-addr", "", "the remote address the client is coming from.")
+	secret      = flag.String("secret", "fooman", "the tacacs secret to be used.")
+	authenMode  = flag.String("authen-mode", "pap", "valid choices, [pap ascii chap]")
+	mode        = flag.String("mode", "authen", "the request to send, valid choices, [authen author acct]")
+	acctFlag    = flag.String("acct-flag", "stop", "the accounting record to send in acct mode, valid choices, [start stop watchdog]")
+	scenario    = flag.String("scenario", "", "a yaml file of steps to run in order, instead of a single request")
+	repl        = flag.Bool("interactive", false, "read requests from stdin, one a line; type help for the commands")
+	proxyMode   = flag.String("proxy-header", "", "send a PROXY protocol header before each packet, valid choices, [v1 v2]")
+	proxySrc    = flag.String("proxy-source", "", "the original client address:port to report in the PROXY header; defaults to the local address")
+	unencrypted = flag.Bool("unencrypted", false, "send packets with the unencrypted flag and unobfuscated bodies, for debugging with packet captures; servers must allow it")
+	timeout     = flag.Duration("timeout", 10*time.Second, "how long each packet exchange with the server may take; 0 waits forever")
+	args        argList
 )
 
+func init() {
+	flag.Var(&args, "arg", "an attribute value pair to send in author and acct modes, eg service=shell; may be repeated")
+}
+
 func main() {
 	flag.Parse()
 	verifyFlags()
 
-	c, err := tq.NewClient(tq.SetClientDialer(*network, *address, []byte(*secret)))
+	opts := []tq.ClientOption{tq.SetClientDialer(*network, *address, []byte(*secret))}
+	if *proxyMode != "" {
+		opts = append(opts, proxyHeader())
+	}
+	if *unencrypted {
+		opts = append(opts, tq.SetClientUnencrypted())
+	}
+	c, err := tq.NewClient(opts...)
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		os.Exit(1)
 	}
 	defer c.Close()
-	switch *authenMode {
-	case "pap":
-		pap(c)
-	case "ascii":
-		ascii(c)
+	switch {
+	case *scenario != "":
+		steps, err := loadScenario(*scenario)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		if failed := runScenario(c, steps, os.Stdout); failed > 0 {
+			os.Exit(1)
+		}
+	case *repl:
+		interactive(c, os.Stdin, os.Stdout)
 	default:
-		fmt.Printf("%v is an invalid mode", *authenMode)
+		o, err := run(c, flagStep())
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\n%+v\n", o.reply)
 	}
 }
 
 func verifyFlags() {
-	if *username == "" {
+	if *username == "" && *scenario == "" && !*repl {
 		fmt.Println("invalid username, please provide one")
 		os.Exit(1)
 	}
@@ -61,6 +97,37 @@ func verifyFlags() {
 	}
 }
 
+func proxyHeader() tq.ClientOption {
+	var v proxy.Version
+	switch *proxyMode {
+	case "v1":
+		v = proxy.V1
+	case "v2":
+		v = proxy.V2
+	default:
+		fmt.Printf("%v is an invalid proxy header version\n", *proxyMode)
+		os.Exit(1)
+	}
+	var source net.Addr
+	if *proxySrc != "" {
+		addr, err := net.ResolveTCPAddr(*network, *proxySrc)
+		if err != nil {
+			fmt.Printf("invalid proxy source; %v\n", err)
+			os.Exit(1)
+		}
+		source = addr
+	}
+	return tq.SetClientProxyHeader(v, source, nil)
+}
+
+// exchangeContext bounds an exchange with the server by -timeout
+func exchangeContext() (context.Context, context.CancelFunc) {
+	if *timeout > 0 {
+		return context.WithTimeout(context.Background(), *timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
 func getPassword() string {
 	if *password != "" {
 		return *password
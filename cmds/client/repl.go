@@ -0,0 +1,145 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main provides a basic tacacs test client for use with tacacs servers and tacquito
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+const replHelp = `commands:
+  authen [pap|ascii|chap] [username [password]]
+  author [username] avp...                      eg author alice service=shell cmd=show
+  acct start|stop|watchdog [username] avp...
+  set username|password|port|rem-addr|priv-lvl value
+  run scenario.yaml
+  help
+  quit`
+
+// interactive reads commands from r until it closes or quit is given, sending each request to c
+func interactive(c *tq.Client, r io.Reader, w io.Writer) {
+	var base step
+	scanner := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(w, "tacquito> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "quit", "exit":
+			return
+		case "help":
+			fmt.Fprintln(w, replHelp)
+		case "set":
+			if err := base.set(fields[1:]); err != nil {
+				fmt.Fprintln(w, err)
+			}
+		case "run":
+			if len(fields) != 2 {
+				fmt.Fprintln(w, "run takes a scenario file")
+				continue
+			}
+			steps, err := loadScenario(fields[1])
+			if err != nil {
+				fmt.Fprintln(w, err)
+				continue
+			}
+			runScenario(c, steps, w)
+		default:
+			s, err := parseCommand(fields, base)
+			if err != nil {
+				fmt.Fprintln(w, err)
+				continue
+			}
+			o, err := run(c, s.withDefaults())
+			if err != nil {
+				fmt.Fprintln(w, err)
+				continue
+			}
+			fmt.Fprintf(w, "%+v\n", o.reply)
+		}
+	}
+}
+
+// set changes a field every later command uses
+func (s *step) set(fields []string) error {
+	if len(fields) != 2 {
+		return fmt.Errorf("set takes a field and a value")
+	}
+	v := fields[1]
+	switch fields[0] {
+	case "username":
+		s.Username = v
+	case "password":
+		s.Password = v
+	case "port":
+		s.Port = v
+	case "rem-addr":
+		s.RemAddr = v
+	case "priv-lvl":
+		n, err := strconv.Atoi(v)
+		if err != nil || tq.PrivLvl(n).Validate(nil) != nil {
+			return fmt.Errorf("%v is an invalid priv-lvl", v)
+		}
+		s.PrivLvl = &n
+	default:
+		return fmt.Errorf("%v cannot be set", fields[0])
+	}
+	return nil
+}
+
+// parseCommand returns the request of an authen, author or acct command, with the fields that are
+// not given taken from base
+func parseCommand(fields []string, base step) (step, error) {
+	s := base
+	s.Mode, fields = fields[0], fields[1:]
+	switch s.Mode {
+	case "authen":
+		if len(fields) > 0 {
+			s.AuthenMode, fields = fields[0], fields[1:]
+		}
+		if len(fields) > 2 {
+			return step{}, fmt.Errorf("authen takes a mode, username and password")
+		}
+		if len(fields) > 0 {
+			s.Username = fields[0]
+		}
+		if len(fields) > 1 {
+			s.Password = fields[1]
+		}
+		return s, nil
+	case "acct":
+		if len(fields) == 0 {
+			return step{}, fmt.Errorf("acct takes start, stop or watchdog")
+		}
+		s.AcctFlag, fields = fields[0], fields[1:]
+	case "author":
+	default:
+		return step{}, fmt.Errorf("unknown command %v, try help", s.Mode)
+	}
+	// avps have an = or *, the username does not
+	if len(fields) > 0 && !strings.ContainsAny(fields[0], "=*") {
+		s.Username, fields = fields[0], fields[1:]
+	}
+	s.Args = fields
+	if s.Args == nil {
+		s.Args = []string{}
+	}
+	return s, nil
+}
@@ -0,0 +1,185 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main provides a basic tacacs test client for use with tacacs servers and tacquito
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// step is one request to the server, given by flags, a scenario file or an interactive command.
+// Empty fields are taken from the flags.
+type step struct {
+	Name       string   `yaml:"name"`
+	Mode       string   `yaml:"mode"`
+	AuthenMode string   `yaml:"authen-mode"`
+	Username   string   `yaml:"username"`
+	Password   string   `yaml:"password"`
+	Port       string   `yaml:"port"`
+	RemAddr    string   `yaml:"rem-addr"`
+	PrivLvl    *int     `yaml:"priv-lvl"`
+	Args       []string `yaml:"args"`
+	AcctFlag   string   `yaml:"acct-flag"`
+	// Expect is the reply status the step must receive to pass, eg pass, fail, pass-add or
+	// success; any status passes when empty
+	Expect string `yaml:"expect"`
+}
+
+// flagStep is the request given by the flags
+func flagStep() step {
+	return step{}.withDefaults()
+}
+
+// withDefaults fills the empty fields of s from the flags
+func (s step) withDefaults() step {
+	fill := func(v *string, d string) {
+		if *v == "" {
+			*v = d
+		}
+	}
+	fill(&s.Mode, *mode)
+	fill(&s.AuthenMode, *authenMode)
+	fill(&s.Username, *username)
+	fill(&s.Port, *port)
+	fill(&s.RemAddr, *remAddr)
+	fill(&s.AcctFlag, *acctFlag)
+	if s.PrivLvl == nil {
+		s.PrivLvl = privLvl
+	}
+	if s.Args == nil {
+		s.Args = args
+	}
+	return s
+}
+
+// password returns the password of s, prompting for it if neither the step nor -password give one
+func (s step) password() string {
+	if s.Password != "" {
+		return s.Password
+	}
+	return getPassword()
+}
+
+// startOptions are the authen start fields of s
+func (s step) startOptions() []tq.AuthenStartOption {
+	return []tq.AuthenStartOption{
+		tq.SetAuthenStartPrivLvl(tq.PrivLvl(*s.PrivLvl)),
+		tq.SetAuthenStartPort(tq.AuthenPort(s.Port)),
+		tq.SetAuthenStartRemAddr(tq.AuthenRemAddr(s.RemAddr)),
+	}
+}
+
+// avps are the args of s
+func (s step) avps() tq.Args {
+	avps := make(tq.Args, 0, len(s.Args))
+	for _, a := range s.Args {
+		avps = append(avps, tq.Arg(a))
+	}
+	return avps
+}
+
+// outcome is the reply to a step
+type outcome struct {
+	// status is the reply status without its type, lower cased, eg pass or passadd
+	status string
+	reply  interface{}
+}
+
+// passed reports whether the outcome is the status s expects
+func (o outcome) passed(s step) bool {
+	if s.Expect == "" {
+		return true
+	}
+	return o.status == normalizeStatus(s.Expect)
+}
+
+// normalizeStatus lower cases a status and drops its type and separators, so pass-add,
+// PassAdd and AuthorStatusPassAdd are the same status
+func normalizeStatus(v string) string {
+	v = strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(v))
+	for _, prefix := range []string{"authenstatus", "authorstatus", "acctreplystatus"} {
+		v = strings.TrimPrefix(v, prefix)
+	}
+	return v
+}
+
+// run sends the request of s and returns the reply
+func run(c *tq.Client, s step) (outcome, error) {
+	switch s.Mode {
+	case "authen":
+		var reply *tq.AuthenReply
+		var err error
+		switch s.AuthenMode {
+		case "pap":
+			reply, err = pap(c, s)
+		case "ascii":
+			reply, err = ascii(c, s)
+		case "chap":
+			reply, err = chap(c, s)
+		default:
+			return outcome{}, fmt.Errorf("%v is an invalid authen mode", s.AuthenMode)
+		}
+		if err != nil {
+			return outcome{}, err
+		}
+		return outcome{status: normalizeStatus(reply.Status.String()), reply: *reply}, nil
+	case "author":
+		ctx, cancel := exchangeContext()
+		defer cancel()
+		reply, err := c.Authorize(ctx, s.Username, s.avps(),
+			tq.SetAuthorRequestPrivLvl(tq.PrivLvl(*s.PrivLvl)),
+			tq.SetAuthorRequestPort(tq.AuthenPort(s.Port)),
+			tq.SetAuthorRequestRemAddr(tq.AuthenRemAddr(s.RemAddr)),
+		)
+		if err != nil {
+			return outcome{}, err
+		}
+		return outcome{status: normalizeStatus(reply.Status.String()), reply: *reply}, nil
+	case "acct":
+		var flags tq.AcctRequestFlag
+		switch s.AcctFlag {
+		case "start":
+			flags = tq.AcctFlagStart
+		case "stop":
+			flags = tq.AcctFlagStop
+		case "watchdog":
+			flags = tq.AcctFlagWatchdog
+		default:
+			return outcome{}, fmt.Errorf("%v is an invalid acct flag", s.AcctFlag)
+		}
+		ctx, cancel := exchangeContext()
+		defer cancel()
+		reply, err := c.Account(ctx, s.Username, flags, s.avps(),
+			tq.SetAcctRequestPrivLvl(tq.PrivLvl(*s.PrivLvl)),
+			tq.SetAcctRequestPort(tq.AuthenPort(s.Port)),
+			tq.SetAcctRequestRemAddr(tq.AuthenRemAddr(s.RemAddr)),
+		)
+		if err != nil {
+			return outcome{}, err
+		}
+		return outcome{status: normalizeStatus(reply.Status.String()), reply: *reply}, nil
+	}
+	return outcome{}, fmt.Errorf("%v is an invalid mode", s.Mode)
+}
+
+// argList is a flag that may be given more than once
+type argList []string
+
+// String implements flag.Value
+func (a *argList) String() string {
+	return strings.Join(*a, ",")
+}
+
+// Set implements flag.Value
+func (a *argList) Set(v string) error {
+	*a = append(*a, v)
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main provides a basic tacacs test client for use with tacacs servers and tacquito
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadScenario reads a yaml list of steps
+func loadScenario(path string) ([]step, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read scenario [%v]; %v", path, err)
+	}
+	var steps []step
+	if err := yaml.Unmarshal(b, &steps); err != nil {
+		return nil, fmt.Errorf("unable to parse scenario [%v]; %v", path, err)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("scenario [%v] has no steps", path)
+	}
+	return steps, nil
+}
+
+// runScenario runs every step in order, writing whether each received the status it expects, and
+// returns the number of steps that did not
+func runScenario(c *tq.Client, steps []step, w io.Writer) int {
+	failed := 0
+	for i, s := range steps {
+		s = s.withDefaults()
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("step %v, %v %v", i+1, s.Mode, s.Username)
+		}
+		o, err := run(c, s)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(w, "FAIL %v; %v\n", name, err)
+		case !o.passed(s):
+			failed++
+			fmt.Fprintf(w, "FAIL %v; expected %v, got %v\n\t%+v\n", name, normalizeStatus(s.Expect), o.status, o.reply)
+		default:
+			fmt.Fprintf(w, "ok   %v; %v\n", name, o.status)
+		}
+	}
+	fmt.Fprintf(w, "%v passed, %v failed\n", len(steps)-failed, failed)
+	return failed
+}
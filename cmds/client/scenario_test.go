@@ -0,0 +1,152 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})      {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{})     {}
+func (mockLogger) Debugf(ctx context.Context, format string, args ...interface{})     {}
+func (mockLogger) Record(ctx context.Context, r map[string]string, obscure ...string) {}
+
+// mockProvider serves every client with a handler that passes alice's pap logins and show
+// commands, and accepts every accounting record
+type mockProvider struct{}
+
+func (mockProvider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler, error) {
+	return []byte("fooman"), tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		switch request.Header.Type {
+		case tq.Authenticate:
+			var body tq.AuthenStart
+			if err := tq.Unmarshal(request.Body, &body); err != nil {
+				response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusError)))
+				return
+			}
+			status := tq.AuthenStatusFail
+			if body.User == "alice" && string(body.Data) == "secret" {
+				status = tq.AuthenStatusPass
+			}
+			response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(status)))
+		case tq.Authorize:
+			var body tq.AuthorRequest
+			if err := tq.Unmarshal(request.Body, &body); err != nil {
+				response.Reply(tq.NewAuthorReply(tq.SetAuthorReplyStatus(tq.AuthorStatusError)))
+				return
+			}
+			status := tq.AuthorStatusFail
+			if body.User == "alice" && body.Args.Command() == "show" {
+				status = tq.AuthorStatusPassAdd
+			}
+			response.Reply(tq.NewAuthorReply(tq.SetAuthorReplyStatus(status)))
+		case tq.Accounting:
+			response.Reply(tq.NewAcctReply(tq.SetAcctReplyStatus(tq.AcctReplyStatusSuccess)))
+		}
+	}), nil
+}
+
+func newTestClient(t *testing.T) *tq.Client {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go tq.NewServer(mockLogger{}, mockProvider{}).Serve(ctx, listener.(*net.TCPListener))
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+- name: login
+  mode: authen
+  username: alice
+  password: secret
+  expect: pass
+- name: show is allowed
+  mode: author
+  username: alice
+  args: [service=shell, cmd=show, cmd-arg=version]
+  expect: pass-add
+- name: configure is allowed
+  mode: author
+  username: alice
+  args: [service=shell, cmd=configure]
+  expect: pass-add
+- mode: acct
+  username: alice
+  acct-flag: stop
+  args: [service=shell, task_id=1]
+  expect: success
+`), 0600))
+	steps, err := loadScenario(path)
+	require.NoError(t, err)
+	require.Len(t, steps, 4)
+
+	var out bytes.Buffer
+	assert.Equal(t, 1, runScenario(newTestClient(t), steps, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, "ok   login; pass", lines[0])
+	assert.Equal(t, "ok   show is allowed; passadd", lines[1])
+	assert.Equal(t, "FAIL configure is allowed; expected passadd, got fail", lines[2])
+	assert.Equal(t, "ok   step 4, acct alice; success", lines[4])
+	assert.Equal(t, "3 passed, 1 failed", lines[5])
+}
+
+func TestInteractive(t *testing.T) {
+	in := strings.NewReader("set username alice\nauthen pap alice wrong\nauthor service=shell cmd=show\nacct bogus\nset priv-lvl 16\nquit\n")
+	var out bytes.Buffer
+	interactive(newTestClient(t), in, &out)
+	assert.Contains(t, out.String(), "Status:AuthenStatusFail")
+	assert.Contains(t, out.String(), "Status:AuthorStatusPassAdd")
+	assert.Contains(t, out.String(), "bogus is an invalid acct flag")
+	assert.Contains(t, out.String(), "16 is an invalid priv-lvl")
+}
+
+func TestParseCommand(t *testing.T) {
+	base := step{Username: "bob", Port: "tty0"}
+	s, err := parseCommand([]string{"author", "service=shell", "cmd*show"}, base)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", s.Username)
+	assert.Equal(t, "tty0", s.Port)
+	assert.Equal(t, []string{"service=shell", "cmd*show"}, s.Args)
+
+	s, err = parseCommand([]string{"acct", "start", "alice", "task_id=1"}, base)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", s.Username)
+	assert.Equal(t, "start", s.AcctFlag)
+
+	s, err = parseCommand([]string{"authen", "ascii", "alice", "pw"}, base)
+	require.NoError(t, err)
+	assert.Equal(t, step{Mode: "authen", AuthenMode: "ascii", Username: "alice", Password: "pw", Port: "tty0"}, s)
+
+	_, err = parseCommand([]string{"login"}, base)
+	assert.Error(t, err)
+}
+
+func TestNormalizeStatus(t *testing.T) {
+	for _, v := range []string{"pass-add", "PassAdd", "AuthorStatusPassAdd", "pass_add"} {
+		assert.Equal(t, "passadd", normalizeStatus(v), v)
+	}
+}
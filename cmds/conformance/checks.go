@@ -0,0 +1,561 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// level is the rfc 8907 requirement level a check verifies, failing a should check is a warning
+type level string
+
+const (
+	must   level = "MUST"
+	should level = "SHOULD"
+)
+
+// skipped is returned by checks that cannot run against the target, eg for want of credentials
+type skipped string
+
+func (s skipped) Error() string {
+	return string(s)
+}
+
+// noCredentials skips the checks that need a user the server knows
+const noCredentials = skipped("needs -username and -password")
+
+// unknownUser is a user no server should know
+const unknownUser = "tacquito-conformance-unknown"
+
+// noTLS skips the checks of tacacs+ over tls
+const noTLS = skipped("needs -tls")
+
+// tls13 is the section of the checks of draft-ietf-opsawg-tacacs-tls13, tacacs+ over tls
+const tls13 = "tls13"
+
+// check is one scenario run against the server.  run returns nil if the server behaved as rfc
+// 8907 section requires, or draft-ietf-opsawg-tacacs-tls13 for the tls13 section.
+type check struct {
+	name    string
+	section string
+	level   level
+	run     func(ctx context.Context, t *target) error
+}
+
+// target is the server under test
+type target struct {
+	network, address string
+	secret           []byte
+	// username and password are a user the server authenticates, and authorArgs a request it
+	// authorizes for them; the checks needing them are skipped if they are not given
+	username, password string
+	authorArgs         tq.Args
+	timeout            time.Duration
+	// tls if set, connects over tls with this config
+	tls *tls.Config
+}
+
+// dial connects to the server, each check has a connection of its own
+func (t *target) dial() (*tq.Client, error) {
+	dialer := tq.SetClientDialer(t.network, t.address, t.secret)
+	if t.tls != nil {
+		dialer = tq.SetClientTLSDialer(t.network, t.address, t.tls, t.secret)
+	}
+	c, err := tq.NewClient(dialer)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to [%v]; %v", t.address, err)
+	}
+	return c, nil
+}
+
+// dialTLS performs a tls handshake with the server with config, bypassing the client so packets
+// can be sent as they are
+func (t *target) dialTLS(config *tls.Config) (*tls.Conn, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: t.timeout}, t.network, t.address, config)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(t.timeout))
+	return conn, nil
+}
+
+// rawExchange writes p to conn as it is and reads the reply, which is deobfuscated unless it has
+// the UnencryptedFlag
+func (t *target) rawExchange(conn net.Conn, p *tq.Packet) (*tq.Packet, error) {
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(b); err != nil {
+		return nil, err
+	}
+	raw := make([]byte, tq.MaxHeaderLength)
+	if _, err := io.ReadFull(conn, raw); err != nil {
+		return nil, err
+	}
+	h := &tq.Header{}
+	if err := h.UnmarshalBinary(raw); err != nil {
+		return nil, err
+	}
+	if h.Length > tq.MaxBodyLength {
+		return nil, fmt.Errorf("reply body length [%v] exceeds [%v]", h.Length, tq.MaxBodyLength)
+	}
+	body := make([]byte, h.Length)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+	reply := tq.NewPacket(tq.SetPacketHeader(h), tq.SetPacketBody(body))
+	if err := tq.Crypt(t.secret, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// asciiStartPacket is asciiStart as the first packet of a new session, with flags
+func asciiStartPacket(flags tq.HeaderFlag) (*tq.Packet, error) {
+	s, err := tq.NewSession(tq.Authenticate)
+	if err != nil {
+		return nil, err
+	}
+	b, err := asciiStart().MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return tq.NewPacket(
+		tq.SetPacketHeader(tq.NewHeader(
+			tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionDefault}),
+			tq.SetHeaderType(tq.Authenticate),
+			tq.SetHeaderSeqNo(1),
+			tq.SetHeaderFlag(flags),
+			tq.SetHeaderSessionID(s.ID()),
+		)),
+		tq.SetPacketBody(b),
+	), nil
+}
+
+// user is the configured username, or one no server knows
+func (t *target) user() string {
+	if t.username == "" {
+		return unknownUser
+	}
+	return t.username
+}
+
+// exchange sends body as the next packet of s within the timeout
+func (t *target) exchange(ctx context.Context, c *tq.Client, s *tq.Session, body tq.EncoderDecoder) (*tq.Packet, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return c.SendSession(ctx, s, body)
+}
+
+// authenReply decodes the authen reply resp
+func authenReply(resp *tq.Packet) (tq.AuthenReply, error) {
+	var reply tq.AuthenReply
+	if err := tq.UnmarshalWithFlags(resp.Body, resp.Header.Flags, &reply); err != nil {
+		return reply, fmt.Errorf("unable to decode the reply; %v", err)
+	}
+	return reply, nil
+}
+
+// expectAuthen returns an error unless the reply to a packet has one of statuses
+func expectAuthen(resp *tq.Packet, err error, statuses ...tq.AuthenStatus) error {
+	if err != nil {
+		return err
+	}
+	reply, err := authenReply(resp)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if reply.Status == status {
+			return nil
+		}
+	}
+	return fmt.Errorf("replied [%v], expected %v", reply.Status, statuses)
+}
+
+// expectRefused returns an error if the server answered a packet it should not have with anything
+// but an error or failure.  Closing the connection or not replying at all are refusals.
+func expectRefused(resp *tq.Packet, err error) error {
+	if err != nil {
+		return nil
+	}
+	reply, err := authenReply(resp)
+	if err != nil {
+		return nil
+	}
+	if reply.Status == tq.AuthenStatusError || reply.Status == tq.AuthenStatusFail {
+		return nil
+	}
+	return fmt.Errorf("replied [%v], expected the packet to be refused", reply.Status)
+}
+
+// asciiStart is the first packet of an ascii login, without the username so it is prompted for
+func asciiStart() *tq.AuthenStart {
+	return tq.NewAuthenStart(
+		tq.SetAuthenStartAction(tq.AuthenActionLogin),
+		tq.SetAuthenStartPrivLvl(tq.PrivLvlUser),
+		tq.SetAuthenStartType(tq.AuthenTypeASCII),
+		tq.SetAuthenStartService(tq.AuthenServiceLogin),
+		tq.SetAuthenStartPort("tty0"),
+		tq.SetAuthenStartRemAddr("conformance"),
+	)
+}
+
+// papStart is a pap login of user with password
+func papStart(user, password string) *tq.AuthenStart {
+	return tq.NewAuthenStart(
+		tq.SetAuthenStartAction(tq.AuthenActionLogin),
+		tq.SetAuthenStartPrivLvl(tq.PrivLvlUser),
+		tq.SetAuthenStartType(tq.AuthenTypePAP),
+		tq.SetAuthenStartService(tq.AuthenServiceLogin),
+		tq.SetAuthenStartPort("tty0"),
+		tq.SetAuthenStartRemAddr("conformance"),
+		tq.SetAuthenStartUser(tq.AuthenUser(user)),
+		tq.SetAuthenStartData(tq.AuthenData(password)),
+	)
+}
+
+// withClient runs fn with a connection of its own
+func withClient(t *target, fn func(c *tq.Client) error) error {
+	c, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return fn(c)
+}
+
+// asciiAbort aborts an ascii login at its prompts-th prompt, the username prompt being the first
+func asciiAbort(prompts int) func(ctx context.Context, t *target) error {
+	return func(ctx context.Context, t *target) error {
+		return withClient(t, func(c *tq.Client) error {
+			s, err := tq.NewSession(tq.Authenticate)
+			if err != nil {
+				return err
+			}
+			resp, err := t.exchange(ctx, c, s, asciiStart())
+			if err := expectAuthen(resp, err, tq.AuthenStatusGetUser); err != nil {
+				return skipped(fmt.Sprintf("the login could not start; %v", err))
+			}
+			if prompts > 1 {
+				resp, err = t.exchange(ctx, c, s, tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage(tq.AuthenUserMessage(t.user()))))
+				if err := expectAuthen(resp, err, tq.AuthenStatusGetPass); err != nil {
+					return skipped(fmt.Sprintf("the server did not prompt for the password; %v", err))
+				}
+			}
+			resp, err = t.exchange(ctx, c, s, tq.NewAuthenContinue(tq.SetAuthenContinueFlag(tq.AuthenContinueFlagAbort), tq.SetAuthenContinueData("aborted")))
+			return expectRefused(resp, err)
+		})
+	}
+}
+
+// checks are run in order
+var checks = []check{
+	{
+		name:    "ascii login prompts for the username",
+		section: "5.4.2.1",
+		level:   must,
+		run: func(ctx context.Context, t *target) error {
+			return withClient(t, func(c *tq.Client) error {
+				s, err := tq.NewSession(tq.Authenticate)
+				if err != nil {
+					return err
+				}
+				resp, err := t.exchange(ctx, c, s, asciiStart())
+				return expectAuthen(resp, err, tq.AuthenStatusGetUser)
+			})
+		},
+	},
+	{
+		name:    "ascii login passes",
+		section: "5.4.2.1",
+		level:   must,
+		run: func(ctx context.Context, t *target) error {
+			if t.username == "" || t.password == "" {
+				return noCredentials
+			}
+			return withClient(t, func(c *tq.Client) error {
+				ctx, cancel := context.WithTimeout(ctx, t.timeout)
+				defer cancel()
+				reply, err := c.AuthenticateASCII(ctx, t.username, t.password)
+				if err != nil {
+					return err
+				}
+				if reply.Status != tq.AuthenStatusPass {
+					return fmt.Errorf("replied [%v], expected [%v]", reply.Status, tq.AuthenStatusPass)
+				}
+				return nil
+			})
+		},
+	},
+	{
+		name:    "ascii login aborted at the username prompt fails",
+		section: "5.4.3",
+		level:   must,
+		run:     asciiAbort(1),
+	},
+	{
+		name:    "ascii login aborted at the password prompt fails",
+		section: "5.4.3",
+		level:   must,
+		run:     asciiAbort(2),
+	},
+	{
+		name:    "pap login passes",
+		section: "5.4.2.2",
+		level:   must,
+		run: func(ctx context.Context, t *target) error {
+			if t.username == "" || t.password == "" {
+				return noCredentials
+			}
+			return withClient(t, func(c *tq.Client) error {
+				s, err := tq.NewSession(tq.Authenticate)
+				if err != nil {
+					return err
+				}
+				resp, err := t.exchange(ctx, c, s, papStart(t.username, t.password))
+				return expectAuthen(resp, err, tq.AuthenStatusPass)
+			})
+		},
+	},
+	{
+		name:    "pap login with a wrong password fails",
+		section: "5.4.2.2",
+		level:   must,
+		run: func(ctx context.Context, t *target) error {
+			return withClient(t, func(c *tq.Client) error {
+				s, err := tq.NewSession(tq.Authenticate)
+				if err != nil {
+					return err
+				}
+				resp, err := t.exchange(ctx, c, s, papStart(t.user(), "not-"+t.password))
+				return expectAuthen(resp, err, tq.AuthenStatusFail, tq.AuthenStatusError)
+			})
+		},
+	},
+	{
+		name:    "pap login with the default minor version is refused",
+		section: "5.4.1",
+		level:   should,
+		run: func(ctx context.Context, t *target) error {
+			if t.username == "" || t.password == "" {
+				return noCredentials
+			}
+			return withClient(t, func(c *tq.Client) error {
+				s, err := tq.NewSession(tq.Authenticate, tq.SetSessionVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionDefault}))
+				if err != nil {
+					return err
+				}
+				resp, err := t.exchange(ctx, c, s, papStart(t.username, t.password))
+				return expectRefused(resp, err)
+			})
+		},
+	},
+	{
+		name:    "authorization of an unknown user fails",
+		section: "6.2",
+		level:   must,
+		run: func(ctx context.Context, t *target) error {
+			return withClient(t, func(c *tq.Client) error {
+				ctx, cancel := context.WithTimeout(ctx, t.timeout)
+				defer cancel()
+				reply, err := c.Authorize(ctx, unknownUser, tq.Args{"service=shell", "cmd="})
+				if err != nil {
+					return err
+				}
+				if reply.Status != tq.AuthorStatusFail && reply.Status != tq.AuthorStatusError {
+					return fmt.Errorf("replied [%v], expected [%v]", reply.Status, tq.AuthorStatusFail)
+				}
+				return nil
+			})
+		},
+	},
+	{
+		name:    "authorization passes",
+		section: "6.2",
+		level:   must,
+		run: func(ctx context.Context, t *target) error {
+			if t.username == "" || len(t.authorArgs) == 0 {
+				return skipped("needs -username and -author-args")
+			}
+			return withClient(t, func(c *tq.Client) error {
+				ctx, cancel := context.WithTimeout(ctx, t.timeout)
+				defer cancel()
+				reply, err := c.Authorize(ctx, t.username, t.authorArgs)
+				if err != nil {
+					return err
+				}
+				if reply.Status != tq.AuthorStatusPassAdd && reply.Status != tq.AuthorStatusPassRepl {
+					return fmt.Errorf("replied [%v], expected [%v] or [%v]", reply.Status, tq.AuthorStatusPassAdd, tq.AuthorStatusPassRepl)
+				}
+				return nil
+			})
+		},
+	},
+	{
+		name:    "accounting start, watchdog and stop records are replied to",
+		section: "7.2",
+		level:   must,
+		run: func(ctx context.Context, t *target) error {
+			return withClient(t, func(c *tq.Client) error {
+				taskID := fmt.Sprintf("task_id=%v", time.Now().UnixNano())
+				for _, flag := range []tq.AcctRequestFlag{tq.AcctFlagStart, tq.AcctFlagWatchdog, tq.AcctFlagStop} {
+					ctx, cancel := context.WithTimeout(ctx, t.timeout)
+					_, err := c.Account(ctx, t.user(), flag, tq.Args{tq.Arg(taskID), "service=shell", "cmd=conformance"})
+					cancel()
+					if err != nil {
+						return fmt.Errorf("[%v] was not replied to; %v", flag, err)
+					}
+				}
+				return nil
+			})
+		},
+	},
+	{
+		name:    "packets with even sequence numbers are refused",
+		section: "4.1",
+		level:   should,
+		run:     sequenceCheck(2),
+	},
+	{
+		name:    "sessions not starting at sequence number 1 are refused",
+		section: "4.1",
+		level:   should,
+		run:     sequenceCheck(3),
+	},
+	{
+		name:    "unencrypted packets are refused",
+		section: "4.5",
+		level:   should,
+		run: func(ctx context.Context, t *target) error {
+			if t.tls != nil {
+				return skipped("not applicable over tls, where packets are unencrypted")
+			}
+			return withClient(t, func(c *tq.Client) error {
+				s, err := tq.NewSession(tq.Authenticate, tq.SetSessionFlags(tq.UnencryptedFlag))
+				if err != nil {
+					return err
+				}
+				resp, err := t.exchange(ctx, c, s, asciiStart())
+				return expectRefused(resp, err)
+			})
+		},
+	},
+	{
+		name:    "tls versions older than 1.3 are refused",
+		section: tls13,
+		level:   must,
+		run: func(ctx context.Context, t *target) error {
+			if t.tls == nil {
+				return noTLS
+			}
+			config := t.tls.Clone()
+			config.MinVersion, config.MaxVersion = tls.VersionTLS12, tls.VersionTLS12
+			conn, err := t.dialTLS(config)
+			if err != nil {
+				// the handshake failing is a refusal
+				return nil
+			}
+			defer conn.Close()
+			p, err := asciiStartPacket(tq.UnencryptedFlag)
+			if err != nil {
+				return err
+			}
+			if _, err := t.rawExchange(conn, p); err == nil {
+				return fmt.Errorf("a tls 1.2 session was served")
+			}
+			return nil
+		},
+	},
+	{
+		name:    "obfuscated packets over tls are refused",
+		section: tls13,
+		level:   must,
+		run: func(ctx context.Context, t *target) error {
+			if t.tls == nil {
+				return noTLS
+			}
+			conn, err := t.dialTLS(t.tls)
+			if err != nil {
+				return fmt.Errorf("unable to connect to [%v]; %v", t.address, err)
+			}
+			defer conn.Close()
+			p, err := asciiStartPacket(tq.HeaderFlag(0))
+			if err != nil {
+				return err
+			}
+			if err := tq.Crypt(t.secret, p); err != nil {
+				return err
+			}
+			resp, err := t.rawExchange(conn, p)
+			return expectRefused(resp, err)
+		},
+	},
+	{
+		name:    "packets over tls are served unobfuscated",
+		section: tls13,
+		level:   must,
+		run: func(ctx context.Context, t *target) error {
+			if t.tls == nil {
+				return noTLS
+			}
+			return withClient(t, func(c *tq.Client) error {
+				s, err := tq.NewSession(tq.Authenticate)
+				if err != nil {
+					return err
+				}
+				resp, err := t.exchange(ctx, c, s, asciiStart())
+				if err := expectAuthen(resp, err, tq.AuthenStatusGetUser); err != nil {
+					return err
+				}
+				if !resp.Header.Flags.Has(tq.UnencryptedFlag) {
+					return fmt.Errorf("the reply does not have the UnencryptedFlag")
+				}
+				return nil
+			})
+		},
+	},
+}
+
+// sequenceCheck starts an ascii login with sequence number seqNo, which breaks rfc 8907 if it is
+// not 1.  The header is built by hand, as a Session will not break the rules.
+func sequenceCheck(seqNo int) func(ctx context.Context, t *target) error {
+	return func(ctx context.Context, t *target) error {
+		return withClient(t, func(c *tq.Client) error {
+			s, err := tq.NewSession(tq.Authenticate)
+			if err != nil {
+				return err
+			}
+			b, err := asciiStart().MarshalBinary()
+			if err != nil {
+				return err
+			}
+			p := tq.NewPacket(
+				tq.SetPacketHeader(tq.NewHeader(
+					tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionDefault}),
+					tq.SetHeaderType(tq.Authenticate),
+					tq.SetHeaderSeqNo(seqNo),
+					tq.SetHeaderSessionID(s.ID()),
+				)),
+				tq.SetPacketBody(b),
+			)
+			ctx, cancel := context.WithTimeout(ctx, t.timeout)
+			defer cancel()
+			resp, err := c.SendContext(ctx, p)
+			return expectRefused(resp, err)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+	"github.com/facebookincubator/tacquito/cmds/server/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConformance runs every check against tacquito itself
+func TestConformance(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := test.MockSecretProvider(ctx, logger, "../server/test/testdata/test_config.yaml")
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	go tq.NewServer(logger, sp, tq.SetStrictSequence(true)).Serve(ctx, listener.(*net.TCPListener))
+
+	tg := &target{
+		network:    "tcp6",
+		address:    listener.Addr().String(),
+		secret:     []byte("fooman"),
+		username:   "mr_uses_group",
+		password:   "password",
+		authorArgs: tq.Args{"service=shell", "cmd=configure", "cmd-arg=terminal"},
+		timeout:    time.Second,
+	}
+	r := runChecks(ctx, tg, checks)
+	var out bytes.Buffer
+	r.write(&out)
+	t.Log(out.String())
+	assert.True(t, r.Compliant)
+	// with strict sequence and unencrypted packets rejected, tacquito passes the should checks too.
+	// the tls checks are skipped without tls.
+	for _, res := range r.Results {
+		if res.Section == tls13 {
+			assert.Equal(t, skip, res.Outcome, res.Name)
+			continue
+		}
+		assert.Equal(t, pass, res.Outcome, res.Name)
+	}
+
+	// without credentials the checks needing them are skipped
+	tg.username, tg.password = "", ""
+	r = runChecks(ctx, tg, checks)
+	assert.Equal(t, skip, r.Results[1].Outcome)
+	assert.Equal(t, noCredentials.Error(), r.Results[1].Detail)
+}
+
+// TestConformanceTLS runs every check against tacquito over tls
+func TestConformanceTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "tacquito"},
+		IPAddresses:  []net.IP{net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := test.MockSecretProvider(ctx, logger, "../server/test/testdata/test_config.yaml")
+	require.NoError(t, err)
+	l, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	listener := tq.NewTLSListener(l.(*net.TCPListener), &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}})
+	go tq.NewServer(logger, sp, tq.SetStrictSequence(true), tq.SetReadTimeout(time.Second)).Serve(ctx, listener)
+
+	tg := &target{
+		network:    "tcp6",
+		address:    listener.Addr().String(),
+		secret:     []byte("fooman"),
+		username:   "mr_uses_group",
+		password:   "password",
+		authorArgs: tq.Args{"service=shell", "cmd=configure", "cmd-arg=terminal"},
+		timeout:    time.Second,
+		tls:        &tls.Config{RootCAs: roots},
+	}
+	r := runChecks(ctx, tg, checks)
+	var out bytes.Buffer
+	r.write(&out)
+	t.Log(out.String())
+	assert.True(t, r.Compliant)
+	// the rfc 8907 check of unencrypted packets is the only one that does not apply over tls
+	for _, res := range r.Results {
+		if res.Section == "4.5" {
+			assert.Equal(t, skip, res.Outcome, res.Name)
+			continue
+		}
+		assert.Equal(t, pass, res.Outcome, res.Name)
+	}
+}
+
+func TestReport(t *testing.T) {
+	failing := []check{
+		{name: "a", section: "4.1", level: should, run: func(context.Context, *target) error { return assert.AnError }},
+		{name: "b", section: "5.1", level: must, run: func(context.Context, *target) error { return nil }},
+	}
+	r := runChecks(context.Background(), &target{address: "server:49"}, failing)
+	assert.True(t, r.Compliant, "failed should checks are warnings")
+	var out bytes.Buffer
+	r.write(&out)
+	assert.Contains(t, out.String(), "WARN  SHOULD  4.1       a; ")
+	assert.Contains(t, out.String(), "1 of 1 MUST checks passed, 0 of 1 SHOULD checks passed, 0 skipped")
+
+	failing[1].run = func(context.Context, *target) error { return assert.AnError }
+	assert.False(t, runChecks(context.Background(), &target{}, failing).Compliant)
+}
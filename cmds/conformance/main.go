@@ -0,0 +1,118 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main runs rfc 8907 conformance checks against any tacacs server, and reports which it
+// passes.  With -tls, the checks run over tls and the draft-ietf-opsawg-tacacs-tls13 checks are
+// added.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+var (
+	network    = flag.String("network", "tcp6", "connect over tcp or tcp6")
+	address    = flag.String("address", ":2046", "the address:port of the server to check")
+	secret     = flag.String("secret", "fooman", "the tacacs secret to be used")
+	username   = flag.String("username", "", "a user the server authenticates; the checks of successful logins are skipped without one")
+	password   = flag.String("password", "", "the password of -username")
+	authorArgs = flag.String("author-args", "", "comma separated args the server authorizes -username for, eg service=shell,cmd=show")
+	timeout    = flag.Duration("timeout", 5*time.Second, "how long each packet may wait for a reply; servers dropping a packet silently make its check wait this long")
+	jsonOutput = flag.Bool("json", false, "write the report as json")
+
+	useTLS        = flag.Bool("tls", false, "connect with tls and run the tacacs+ over tls checks; -address defaults to port 300 if it has no port")
+	tlsCA         = flag.String("tls-ca", "", "the pem bundle the server's certificate is verified with; the system roots if empty")
+	tlsCert       = flag.String("tls-cert", "", "a pem client certificate to present to the server")
+	tlsKey        = flag.String("tls-key", "", "the pem key of -tls-cert")
+	tlsServerName = flag.String("tls-server-name", "", "the name the server's certificate is verified for; the host of -address if empty")
+	tlsInsecure   = flag.Bool("tls-insecure", false, "do not verify the server's certificate, for lab servers only")
+)
+
+func main() {
+	flag.Parse()
+	if *secret == "" {
+		fmt.Fprintf(os.Stderr, "invalid secret, you must provide one\n")
+		os.Exit(2)
+	}
+	t := &target{
+		network:  *network,
+		address:  *address,
+		secret:   []byte(*secret),
+		username: *username,
+		password: *password,
+		timeout:  *timeout,
+	}
+	if *useTLS {
+		config, err := tlsConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid tls options; %v\n", err)
+			os.Exit(2)
+		}
+		t.tls = config
+		if _, _, err := net.SplitHostPort(t.address); err != nil {
+			t.address = net.JoinHostPort(strings.Trim(t.address, "[]"), strconv.Itoa(tq.TLSPort))
+		}
+	}
+	if *authorArgs != "" {
+		for _, arg := range strings.Split(*authorArgs, ",") {
+			t.authorArgs = append(t.authorArgs, tq.Arg(strings.TrimSpace(arg)))
+		}
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	r := runChecks(ctx, t, checks)
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode the report; %v\n", err)
+			os.Exit(2)
+		}
+	} else {
+		r.write(os.Stdout)
+	}
+	if !r.Compliant {
+		os.Exit(1)
+	}
+}
+
+// tlsConfig returns the tls config of the -tls-* flags
+func tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{ServerName: *tlsServerName, InsecureSkipVerify: *tlsInsecure, MinVersion: tls.VersionTLS13}
+	if *tlsCA != "" {
+		b, err := os.ReadFile(*tlsCA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in [%v]", *tlsCA)
+		}
+	}
+	if *tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the client certificate; %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
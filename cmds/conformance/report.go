@@ -0,0 +1,88 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// outcomes of a check
+const (
+	pass = "pass"
+	fail = "fail"
+	skip = "skip"
+)
+
+// result is the outcome of one check
+type result struct {
+	Name    string `json:"name"`
+	Section string `json:"section"`
+	Level   level  `json:"level"`
+	Outcome string `json:"outcome"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// report holds the results of every check.  A server is compliant if it passes every must check
+// that ran, should checks that fail are warnings.
+type report struct {
+	Server    string   `json:"server"`
+	Results   []result `json:"results"`
+	Compliant bool     `json:"compliant"`
+}
+
+// runChecks runs checks against t in order
+func runChecks(ctx context.Context, t *target, checks []check) report {
+	r := report{Server: t.address, Compliant: true}
+	for _, c := range checks {
+		res := result{Name: c.name, Section: c.section, Level: c.level, Outcome: pass}
+		var s skipped
+		switch err := c.run(ctx, t); {
+		case err == nil:
+		case errors.As(err, &s):
+			res.Outcome, res.Detail = skip, err.Error()
+		default:
+			res.Outcome, res.Detail = fail, err.Error()
+			if c.level == must {
+				r.Compliant = false
+			}
+		}
+		r.Results = append(r.Results, res)
+	}
+	return r
+}
+
+// write writes a line for each result, followed by a summary
+func (r report) write(w io.Writer) {
+	counts := map[level]map[string]int{must: {}, should: {}}
+	for _, res := range r.Results {
+		label := map[string]string{pass: "PASS", fail: "FAIL", skip: "SKIP"}[res.Outcome]
+		if res.Outcome == fail && res.Level == should {
+			label = "WARN"
+		}
+		fmt.Fprintf(w, "%-4v  %-6v  %-8v  %v", label, res.Level, res.Section, res.Name)
+		if res.Detail != "" {
+			fmt.Fprintf(w, "; %v", res.Detail)
+		}
+		fmt.Fprintln(w)
+		counts[res.Level][res.Outcome]++
+	}
+	fmt.Fprintf(w, "\nrfc 8907 conformance of [%v]: %v of %v MUST checks passed, %v of %v SHOULD checks passed, %v skipped\n",
+		r.Server,
+		counts[must][pass], counts[must][pass]+counts[must][fail],
+		counts[should][pass], counts[should][pass]+counts[should][fail],
+		counts[must][skip]+counts[should][skip],
+	)
+	if r.Compliant {
+		fmt.Fprintln(w, "compliant")
+	} else {
+		fmt.Fprintln(w, "not compliant")
+	}
+}
@@ -0,0 +1,295 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// enableUser is the tac_plus user holding the enable password of users without their own
+	enableUser = "$enable$"
+	// defaultScope matches every client that has no host block of its own
+	defaultScope = "default"
+	// defaultPermitGroup is appended to the groups of users with default service = permit
+	defaultPermitGroup = "default_service_permit"
+)
+
+// converted is a tacquito config converted from a tac_plus.conf
+type converted struct {
+	config.ServerConfig
+	// groups in the order they were declared, shared by the users in ServerConfig
+	groups   []config.Group
+	warnings []string
+}
+
+// converter converts a parsed tac_plus.conf
+type converter struct {
+	*tacplus
+	groups   map[string]*entity
+	built    map[string]config.Group
+	warnings []string
+}
+
+// convert turns a parsed tac_plus.conf into a tacquito config.  Anything that has no tacquito
+// equivalent is left out and reported as a warning.
+func convert(t *tacplus) (converted, error) {
+	c := &converter{tacplus: t, groups: map[string]*entity{}, built: map[string]config.Group{}, warnings: t.warnings}
+	for _, g := range t.groups {
+		if _, exists := c.groups[g.name]; exists {
+			return converted{}, fmt.Errorf("group [%v] is declared more than once", g.name)
+		}
+		c.groups[g.name] = g
+	}
+	if t.accountingFile != "" {
+		c.warn("accounting file [%v] is not converted, set it with the server's -acct-log-path", t.accountingFile)
+	}
+	var out converted
+	out.Secrets = c.secrets()
+	scopes := make([]string, 0, len(out.Secrets))
+	for _, s := range out.Secrets {
+		scopes = append(scopes, s.Name)
+	}
+	var enable *config.Authenticator
+	for _, u := range t.users {
+		if u.name == enableUser {
+			enable = c.authenticator(u.name, u.login)
+		}
+	}
+	permit := false
+	for _, u := range t.users {
+		if u.name == enableUser {
+			continue
+		}
+		user, err := c.user(u, scopes, enable)
+		if err != nil {
+			return converted{}, err
+		}
+		for _, g := range user.Groups {
+			permit = permit || g.Name == defaultPermitGroup
+		}
+		out.Users = append(out.Users, user)
+	}
+	for _, g := range t.groups {
+		if built, ok := c.built[g.name]; ok {
+			out.groups = append(out.groups, built)
+		}
+	}
+	if permit {
+		out.groups = append(out.groups, c.built[defaultPermitGroup])
+	}
+	out.warnings = c.warnings
+	return out, nil
+}
+
+func (c *converter) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// secrets creates a scope per host block with a key, matched by the host's address, and a default
+// scope with the global key for every other client
+func (c *converter) secrets() []config.SecretConfig {
+	var secrets []config.SecretConfig
+	for _, h := range c.hosts {
+		if h.key == "" {
+			continue
+		}
+		prefix := h.name
+		if ip := net.ParseIP(h.name); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			prefix = fmt.Sprintf("%v/%v", h.name, bits)
+		} else if _, _, err := net.ParseCIDR(h.name); err != nil {
+			c.warn("host [%v] is not an address, its key is not converted", h.name)
+			continue
+		}
+		secrets = append(secrets, scope(h.name, h.key, prefix))
+	}
+	if c.key != "" {
+		secrets = append(secrets, scope(defaultScope, c.key, "0.0.0.0/0", "::/0"))
+	}
+	if len(secrets) == 0 {
+		c.warn("no key is set, add secrets by hand")
+		return secrets
+	}
+	c.warn("keys are written in the clear as the secret key of each scope, move them to your keychain")
+	return secrets
+}
+
+func scope(name, key string, prefixes ...string) config.SecretConfig {
+	b, _ := json.Marshal(prefixes)
+	return config.SecretConfig{
+		Name:    name,
+		Secret:  config.Keychain{Group: "tacquito", Key: key},
+		Handler: config.Handler{Type: config.START},
+		Type:    config.PREFIX,
+		Options: map[string]string{"prefixes": string(b)},
+	}
+}
+
+// user converts a user block.  tacquito groups do not inherit other groups, so the groups a user
+// is a member of, directly or through other groups, are flattened into the user's group list.
+func (c *converter) user(u *entity, scopes []string, enable *config.Authenticator) (config.User, error) {
+	user := config.User{
+		Name:          u.name,
+		Scopes:        scopes,
+		Commands:      c.commands(u.cmds),
+		Services:      services(u.services),
+		Authenticator: c.authenticator(u.name, u.login),
+		Enable:        c.authenticator(u.name, u.enable),
+		Accounter:     &config.Accounter{Name: "tac_plus", Type: config.FILE, Options: map[string]string{}},
+	}
+	defaultService := u.defaultService
+	seen := map[string]bool{}
+	var walk func(members []string) error
+	walk = func(members []string) error {
+		for _, name := range members {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			g, ok := c.groups[name]
+			if !ok {
+				return fmt.Errorf("user [%v] is a member of undeclared group [%v]", u.name, name)
+			}
+			user.Groups = append(user.Groups, c.group(g))
+			if defaultService == "" {
+				defaultService = g.defaultService
+			}
+			if err := walk(g.members); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(u.members); err != nil {
+		return config.User{}, err
+	}
+	if defaultService == "permit" {
+		// commands are checked user first, then group by group, so a catch all permit in a
+		// group of its own, last, only applies to commands no other rule matched
+		permit, ok := c.built[defaultPermitGroup]
+		if !ok {
+			permit = config.Group{
+				Name:     defaultPermitGroup,
+				Commands: []config.Command{{Name: "*", Action: config.PERMIT}},
+				Comment:  "default service = permit",
+			}
+			c.built[defaultPermitGroup] = permit
+		}
+		user.Groups = append(user.Groups, permit)
+	}
+	hasAuthenticator, hasEnable := user.Authenticator != nil, user.Enable != nil
+	for _, g := range user.Groups {
+		hasAuthenticator = hasAuthenticator || g.Authenticator != nil
+		hasEnable = hasEnable || g.Enable != nil
+	}
+	if !hasEnable && enable != nil {
+		user.Enable = enable
+	}
+	if !hasAuthenticator {
+		c.warn("user [%v] has no login that can be converted, it cannot authenticate", u.name)
+	}
+	return user, nil
+}
+
+// group converts a group block once, later calls return the same group
+func (c *converter) group(g *entity) config.Group {
+	if built, ok := c.built[g.name]; ok {
+		return built
+	}
+	built := config.Group{
+		Name:          g.name,
+		Commands:      c.commands(g.cmds),
+		Services:      services(g.services),
+		Authenticator: c.authenticator(g.name, g.login),
+		Enable:        c.authenticator(g.name, g.enable),
+	}
+	c.built[g.name] = built
+	return built
+}
+
+// authenticator converts cleartext passwords to bcrypt hashes.  Other password types can not be
+// converted since tacquito has no des or system password authenticators.
+func (c *converter) authenticator(owner string, pw *password) *config.Authenticator {
+	if pw == nil {
+		return nil
+	}
+	if pw.kind != "cleartext" {
+		c.warn("[%v] password on [%v] cannot be converted, set an authenticator by hand", pw.kind, owner)
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw.value), bcrypt.DefaultCost)
+	if err != nil {
+		c.warn("unable to hash the password of [%v]; %v", owner, err)
+		return nil
+	}
+	return &config.Authenticator{Type: config.BCRYPT, Options: map[string]string{"hash": hex.EncodeToString(hash)}}
+}
+
+// commands converts cmd blocks.  tac_plus denies a command that has a cmd block but matches none
+// of its rules, where tacquito would move on to the next command, so each block ends in a deny.
+func (c *converter) commands(cmds []cmd) []config.Command {
+	var commands []config.Command
+	for _, cmd := range cmds {
+		if len(cmd.rules) == 0 {
+			c.warn("cmd [%v] has no rules and is not converted", cmd.name)
+			continue
+		}
+		var last string
+		for _, r := range cmd.rules {
+			action := config.DENY
+			if r.permit {
+				action = config.PERMIT
+			}
+			last = anchor(r.regex)
+			commands = append(commands, config.Command{Name: cmd.name, Match: []string{last}, Action: action})
+		}
+		if last != ".*" {
+			commands = append(commands, config.Command{Name: cmd.name, Action: config.DENY})
+		}
+	}
+	return commands
+}
+
+// anchor converts a tac_plus regex, which may match anywhere in the arguments, to a tacquito
+// regex, which is anchored to the start and end of the arguments
+func anchor(regex string) string {
+	if !strings.HasPrefix(regex, "^") && !strings.HasPrefix(regex, ".*") {
+		regex = ".*" + regex
+	}
+	if !strings.HasSuffix(regex, "$") && !strings.HasSuffix(regex, ".*") {
+		regex += ".*"
+	}
+	return regex
+}
+
+func services(svcs []service) []config.Service {
+	var services []config.Service
+	for _, s := range svcs {
+		service := config.Service{Name: s.name}
+		for _, m := range s.match {
+			service.Match = append(service.Match, config.Value{Name: m.name, Values: []string{m.value}})
+		}
+		for _, a := range s.attrs {
+			service.SetValues = append(service.SetValues, config.Value{Name: a.name, Values: []string{a.value}, Optional: a.optional})
+		}
+		services = append(services, service)
+	}
+	return services
+}
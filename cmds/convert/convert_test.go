@@ -0,0 +1,139 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+func checkHash(t *testing.T, a *config.Authenticator, password string) {
+	require.NotNil(t, a)
+	assert.Equal(t, config.BCRYPT, a.Type)
+	hash, err := hex.DecodeString(a.Options["hash"])
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword(hash, []byte(password)))
+}
+
+func TestConvert(t *testing.T) {
+	b, err := os.ReadFile("testdata/tac_plus.conf")
+	require.NoError(t, err)
+	parsed, err := parse(string(b))
+	require.NoError(t, err)
+	c, err := convert(parsed)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"line [8]: [prompt = Welcome\\n] on host [10.1.1.1] is ignored",
+		"line [56]: [expires = Jan 1 2030] on [bob] is ignored",
+		"accounting file [/var/log/tac_plus.acct] is not converted, set it with the server's -acct-log-path",
+		"keys are written in the clear as the secret key of each scope, move them to your keychain",
+		"[des] password on [bob] cannot be converted, set an authenticator by hand",
+		"user [bob] has no login that can be converted, it cannot authenticate",
+	}, c.warnings)
+
+	// host keys come before the global key, which matches every other client
+	require.Len(t, c.Secrets, 3)
+	for i, expected := range []struct{ name, key, prefixes string }{
+		{"10.1.1.1", "router-key", `["10.1.1.1/32"]`},
+		{"2401:db00::1", "v6 key", `["2401:db00::1/128"]`},
+		{"default", "global secret", `["0.0.0.0/0","::/0"]`},
+	} {
+		assert.Equal(t, expected.name, c.Secrets[i].Name)
+		assert.Equal(t, expected.key, c.Secrets[i].Secret.Key)
+		assert.Equal(t, expected.prefixes, c.Secrets[i].Options["prefixes"])
+		assert.Equal(t, config.PREFIX, c.Secrets[i].Type)
+		assert.Equal(t, config.START, c.Secrets[i].Handler.Type)
+	}
+
+	require.Len(t, c.Users, 2)
+	alice, bob := c.Users[0], c.Users[1]
+	assert.Equal(t, []string{"10.1.1.1", "2401:db00::1", "default"}, alice.Scopes)
+	checkHash(t, alice.Authenticator, "alice pw")
+	checkHash(t, alice.Enable, "alice-enable")
+	require.Len(t, alice.Groups, 2)
+	assert.Equal(t, "netops", alice.Groups[0].Name)
+	assert.Equal(t, []config.Command{{Name: "reload", Match: []string{".*"}, Action: config.DENY}}, alice.Groups[0].Commands)
+	assert.Equal(t, []config.Service{{Name: "exec", SetValues: []config.Value{{Name: "priv-lvl", Values: []string{"15"}}}}}, alice.Groups[0].Services)
+	assert.Equal(t, defaultPermitGroup, alice.Groups[1].Name)
+
+	// des can not be converted, the $enable$ password is used for users without an enable
+	assert.Nil(t, bob.Authenticator)
+	checkHash(t, bob.Enable, "enablepw")
+	assert.Equal(t, []config.Command{
+		{Name: "configure", Match: []string{".*terminal.*"}, Action: config.PERMIT},
+		{Name: "configure", Action: config.DENY},
+	}, bob.Commands)
+	// group members are flattened
+	require.Len(t, bob.Groups, 2)
+	assert.Equal(t, "readonly", bob.Groups[0].Name)
+	assert.Equal(t, []config.Command{
+		{Name: "show", Match: []string{"^ip (route|bgp).*"}, Action: config.PERMIT},
+		{Name: "show", Match: []string{".*running-config.*"}, Action: config.DENY},
+		{Name: "show", Match: []string{".*"}, Action: config.PERMIT},
+	}, bob.Groups[0].Commands)
+	assert.Equal(t, []config.Service{{
+		Name:      "ppp",
+		Match:     []config.Value{{Name: "protocol", Values: []string{"ip"}}},
+		SetValues: []config.Value{{Name: "addr", Values: []string{"10.0.0.1"}, Optional: true}},
+	}}, bob.Groups[1].Services)
+
+	// the rendered yaml, with groups as aliases, unmarshals to the same config
+	y, err := render(c, "testdata/tac_plus.conf")
+	require.NoError(t, err)
+	var rendered config.ServerConfig
+	require.NoError(t, yaml.Unmarshal(y, &rendered))
+	assert.Equal(t, c.ServerConfig, rendered)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{name: "unknown directive", config: "key = a\nfoo = bar\n", expected: "line [2]: unknown directive [foo]"},
+		{name: "unterminated string", config: "key = \"abc\n", expected: "line [1]: unterminated quoted string"},
+		{name: "missing equals", config: "user alice {\n}\n", expected: "line [1]: expected [=], got [alice]"},
+		{name: "bad cmd rule", config: "user = alice {\n cmd = show {\n  allow .*\n }\n}\n", expected: "line [3]: expected permit or deny in cmd [show], got [allow]"},
+		{name: "unclosed block", config: "user = alice {\n login = cleartext a\n", expected: "line [2]: unexpected end of config"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parse(test.config)
+			assert.EqualError(t, err, test.expected)
+		})
+	}
+
+	parsed, err := parse("user = alice {\n member = missing\n}\n")
+	require.NoError(t, err)
+	_, err = convert(parsed)
+	assert.EqualError(t, err, "user [alice] is a member of undeclared group [missing]")
+}
+
+func TestAnchor(t *testing.T) {
+	for regex, expected := range map[string]string{
+		".*":        ".*",
+		"^show":     "^show.*",
+		"version$":  ".*version$",
+		"^exact$":   "^exact$",
+		"ip (a|b)":  ".*ip (a|b).*",
+		".*tail.*$": ".*tail.*$",
+		"^grep .*":  "^grep .*",
+	} {
+		assert.Equal(t, expected, anchor(regex), regex)
+	}
+}
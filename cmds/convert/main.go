@@ -0,0 +1,55 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main converts classic tac_plus.conf files to tacquito yaml configs
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+var (
+	in  = flag.String("in", "tac_plus.conf", "the tac_plus.conf to convert")
+	out = flag.String("out", "", "where to write the tacquito yaml config; empty writes to stdout")
+)
+
+func main() {
+	flag.Parse()
+	b, err := os.ReadFile(*in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	t, err := parse(string(b))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to parse [%v]; %v\n", *in, err)
+		os.Exit(1)
+	}
+	c, err := convert(t)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to convert [%v]; %v\n", *in, err)
+		os.Exit(1)
+	}
+	for _, w := range c.warnings {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", w)
+	}
+	y, err := render(c, *in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if *out == "" {
+		fmt.Print(string(y))
+		return
+	}
+	if err := os.WriteFile(*out, y, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,495 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tacplus is a parsed tac_plus.conf
+type tacplus struct {
+	key            string
+	accountingFile string
+	hosts          []host
+	groups         []*entity
+	users          []*entity
+	// warnings are directives that were understood but have no tacquito equivalent
+	warnings []string
+}
+
+// host is a host block, a per device key
+type host struct {
+	name string
+	key  string
+}
+
+// entity is a user or group block, they share the same directives
+type entity struct {
+	name           string
+	members        []string
+	defaultService string
+	login          *password
+	enable         *password
+	cmds           []cmd
+	services       []service
+}
+
+// password is a login or enable directive, eg cleartext foo or des XyZ
+type password struct {
+	kind  string
+	value string
+}
+
+// cmd is a cmd block, its rules are evaluated in order
+type cmd struct {
+	name  string
+	rules []rule
+}
+
+type rule struct {
+	permit bool
+	regex  string
+}
+
+// service is a service block, eg service = ppp protocol = ip { addr = 10.0.0.1 }
+type service struct {
+	name  string
+	match []attr
+	attrs []attr
+}
+
+type attr struct {
+	name     string
+	value    string
+	optional bool
+}
+
+type token struct {
+	value  string
+	quoted bool
+	line   int
+}
+
+// lex splits a tac_plus.conf into tokens.  =, { and } are tokens of their own, # starts a
+// comment outside of quoted strings, and quoted strings may escape quotes and backslashes with a
+// backslash.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	r := []rune(src)
+	for i := 0; i < len(r); i++ {
+		switch c := r[i]; {
+		case c == '\n':
+			line++
+		case unicode.IsSpace(c):
+		case c == '#':
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '=' || c == '{' || c == '}':
+			tokens = append(tokens, token{value: string(c), line: line})
+		case c == '"':
+			start := line
+			var b strings.Builder
+			for i++; ; i++ {
+				if i >= len(r) {
+					return nil, fmt.Errorf("line [%v]: unterminated quoted string", start)
+				}
+				if r[i] == '\\' && i+1 < len(r) && (r[i+1] == '"' || r[i+1] == '\\') {
+					i++
+				} else if r[i] == '"' {
+					break
+				}
+				if r[i] == '\n' {
+					line++
+				}
+				b.WriteRune(r[i])
+			}
+			tokens = append(tokens, token{value: b.String(), quoted: true, line: start})
+		default:
+			var b strings.Builder
+			for ; i < len(r) && !unicode.IsSpace(r[i]) && !strings.ContainsRune("={}#\"", r[i]); i++ {
+				b.WriteRune(r[i])
+			}
+			i--
+			tokens = append(tokens, token{value: b.String(), line: line})
+		}
+	}
+	return tokens, nil
+}
+
+// parser is a recursive descent parser over the tac_plus grammar
+type parser struct {
+	tokens []token
+	pos    int
+	config *tacplus
+}
+
+// parse parses a tac_plus.conf
+func parse(src string) (*tacplus, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, config: &tacplus{}}
+	if err := p.top(); err != nil {
+		return nil, err
+	}
+	return p.config, nil
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) line() int {
+	if p.done() {
+		if len(p.tokens) == 0 {
+			return 1
+		}
+		return p.tokens[len(p.tokens)-1].line
+	}
+	return p.tokens[p.pos].line
+}
+
+// peek returns the next unquoted word, or an empty string
+func (p *parser) peek() string {
+	if p.done() || p.tokens[p.pos].quoted {
+		return ""
+	}
+	return p.tokens[p.pos].value
+}
+
+// next returns the next token, quoted or not
+func (p *parser) next() (string, error) {
+	if p.done() {
+		return "", fmt.Errorf("line [%v]: unexpected end of config", p.line())
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t.value, nil
+}
+
+// expect consumes the unquoted word want
+func (p *parser) expect(want string) error {
+	line := p.line()
+	if p.peek() != want {
+		got, _ := p.next()
+		return fmt.Errorf("line [%v]: expected [%v], got [%v]", line, want, got)
+	}
+	p.pos++
+	return nil
+}
+
+// assignment consumes "= value" and returns value
+func (p *parser) assignment() (string, error) {
+	if err := p.expect("="); err != nil {
+		return "", err
+	}
+	return p.next()
+}
+
+func (p *parser) warn(format string, args ...interface{}) {
+	p.config.warnings = append(p.config.warnings, fmt.Sprintf("line [%v]: ", p.line())+fmt.Sprintf(format, args...))
+}
+
+// skipBlock consumes a { ... } block, including nested blocks
+func (p *parser) skipBlock() error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for depth := 1; depth > 0; {
+		t, err := p.next()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+	return nil
+}
+
+func (p *parser) top() error {
+	for !p.done() {
+		line := p.line()
+		word, err := p.next()
+		if err != nil {
+			return err
+		}
+		switch word {
+		case "key":
+			if p.config.key, err = p.assignment(); err != nil {
+				return err
+			}
+		case "accounting":
+			if err := p.expect("file"); err != nil {
+				return err
+			}
+			if p.config.accountingFile, err = p.assignment(); err != nil {
+				return err
+			}
+		case "default":
+			if err := p.expect("authentication"); err != nil {
+				return err
+			}
+			spec, err := p.password()
+			if err != nil {
+				return err
+			}
+			p.warn("default authentication [%v] is not supported, users without a login are not converted", spec.kind)
+		case "logging", "authorization", "accounting_syslog":
+			v, err := p.assignment()
+			if err != nil {
+				return err
+			}
+			p.warn("[%v = %v] is ignored", word, v)
+		case "host":
+			if err := p.host(); err != nil {
+				return err
+			}
+		case "group", "user":
+			e, err := p.entity()
+			if err != nil {
+				return err
+			}
+			if word == "group" {
+				p.config.groups = append(p.config.groups, e)
+			} else {
+				p.config.users = append(p.config.users, e)
+			}
+		case "acl":
+			name, err := p.assignment()
+			if err != nil {
+				return err
+			}
+			p.warn("acl [%v] is not supported, use prefix_allow and prefix_deny instead", name)
+			if err := p.skipBlock(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("line [%v]: unknown directive [%v]", line, word)
+		}
+	}
+	return nil
+}
+
+func (p *parser) host() error {
+	name, err := p.assignment()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	h := host{name: name}
+	for p.peek() != "}" {
+		word, err := p.next()
+		if err != nil {
+			return err
+		}
+		switch word {
+		case "key":
+			if h.key, err = p.assignment(); err != nil {
+				return err
+			}
+		case "enable":
+			if _, err := p.password(); err != nil {
+				return err
+			}
+			p.warn("per host enable passwords on host [%v] are not supported", name)
+		default:
+			v, err := p.assignment()
+			if err != nil {
+				return err
+			}
+			p.warn("[%v = %v] on host [%v] is ignored", word, v, name)
+		}
+	}
+	p.pos++
+	p.config.hosts = append(p.config.hosts, h)
+	return nil
+}
+
+// password parses "= kind [value]"
+func (p *parser) password() (*password, error) {
+	kind, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	pw := &password{kind: kind}
+	switch kind {
+	case "cleartext", "des", "file":
+		if pw.value, err = p.next(); err != nil {
+			return nil, err
+		}
+	}
+	return pw, nil
+}
+
+func (p *parser) entity() (*entity, error) {
+	name, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	e := &entity{name: name}
+	for p.peek() != "}" {
+		line := p.line()
+		word, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch word {
+		case "member":
+			member, err := p.assignment()
+			if err != nil {
+				return nil, err
+			}
+			e.members = append(e.members, member)
+		case "default":
+			if err := p.expect("service"); err != nil {
+				return nil, err
+			}
+			if e.defaultService, err = p.assignment(); err != nil {
+				return nil, err
+			}
+		case "login", "enable":
+			pw, err := p.password()
+			if err != nil {
+				return nil, err
+			}
+			if word == "login" {
+				e.login = pw
+			} else {
+				e.enable = pw
+			}
+		case "pap", "chap", "arap", "ms-chap", "opap", "global":
+			pw, err := p.password()
+			if err != nil {
+				return nil, err
+			}
+			p.warn("[%v = %v] on [%v] is not supported, only login and enable passwords are converted", word, pw.kind, name)
+		case "cmd":
+			c, err := p.cmd()
+			if err != nil {
+				return nil, err
+			}
+			e.cmds = append(e.cmds, c)
+		case "service":
+			s, err := p.service()
+			if err != nil {
+				return nil, err
+			}
+			e.services = append(e.services, s)
+		case "name", "expires", "acl", "before", "after", "maxsess":
+			if word == "before" || word == "after" {
+				if err := p.expect("authorization"); err != nil {
+					return nil, err
+				}
+			}
+			v, err := p.assignment()
+			if err != nil {
+				return nil, err
+			}
+			if word != "name" {
+				p.warn("[%v = %v] on [%v] is ignored", word, v, name)
+			}
+		default:
+			return nil, fmt.Errorf("line [%v]: unknown directive [%v] in [%v]", line, word, name)
+		}
+	}
+	p.pos++
+	return e, nil
+}
+
+func (p *parser) cmd() (cmd, error) {
+	name, err := p.assignment()
+	if err != nil {
+		return cmd{}, err
+	}
+	if err := p.expect("{"); err != nil {
+		return cmd{}, err
+	}
+	c := cmd{name: name}
+	for p.peek() != "}" {
+		line := p.line()
+		action, err := p.next()
+		if err != nil {
+			return cmd{}, err
+		}
+		if action != "permit" && action != "deny" {
+			return cmd{}, fmt.Errorf("line [%v]: expected permit or deny in cmd [%v], got [%v]", line, name, action)
+		}
+		regex, err := p.next()
+		if err != nil {
+			return cmd{}, err
+		}
+		c.rules = append(c.rules, rule{permit: action == "permit", regex: regex})
+	}
+	p.pos++
+	return c, nil
+}
+
+func (p *parser) service() (service, error) {
+	name, err := p.assignment()
+	if err != nil {
+		return service{}, err
+	}
+	s := service{name: name}
+	// attributes the service must match, eg protocol = ip
+	for p.peek() != "{" {
+		a, err := p.next()
+		if err != nil {
+			return service{}, err
+		}
+		v, err := p.assignment()
+		if err != nil {
+			return service{}, err
+		}
+		s.match = append(s.match, attr{name: a, value: v})
+	}
+	p.pos++
+	for p.peek() != "}" {
+		a := attr{}
+		if a.name, err = p.next(); err != nil {
+			return service{}, err
+		}
+		if a.name == "optional" {
+			a.optional = true
+			if a.name, err = p.next(); err != nil {
+				return service{}, err
+			}
+		}
+		if a.name == "default" {
+			if err := p.expect("attribute"); err != nil {
+				return service{}, err
+			}
+			v, err := p.assignment()
+			if err != nil {
+				return service{}, err
+			}
+			p.warn("[default attribute = %v] in service [%v] is ignored", v, name)
+			continue
+		}
+		if a.value, err = p.assignment(); err != nil {
+			return service{}, err
+		}
+		s.attrs = append(s.attrs, a)
+	}
+	p.pos++
+	return s, nil
+}
@@ -0,0 +1,81 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+var anchorUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// render writes c as yaml.  Groups are declared once as top level anchors, as tacquito.yaml does,
+// and users refer to them by alias.
+func render(c converted, source string) ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(key string, value interface{}) (*yaml.Node, error) {
+		node := &yaml.Node{}
+		if err := node.Encode(value); err != nil {
+			return nil, fmt.Errorf("unable to encode [%v]; %v", key, err)
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, node)
+		return node, nil
+	}
+	groups := make(map[string]*yaml.Node, len(c.groups))
+	for _, g := range c.groups {
+		name := "group_" + anchorUnsafe.ReplaceAllString(g.Name, "_")
+		for i := 1; groups[name] != nil; i++ {
+			name = fmt.Sprintf("group_%v_%v", anchorUnsafe.ReplaceAllString(g.Name, "_"), i)
+		}
+		node, err := add(name, g)
+		if err != nil {
+			return nil, err
+		}
+		node.Anchor = name
+		groups[g.Name] = node
+	}
+	if _, err := add("secrets", c.Secrets); err != nil {
+		return nil, err
+	}
+	users := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, u := range c.Users {
+		memberOf := u.Groups
+		u.Groups = nil
+		node := &yaml.Node{}
+		if err := node.Encode(u); err != nil {
+			return nil, fmt.Errorf("unable to encode user [%v]; %v", u.Name, err)
+		}
+		if len(memberOf) > 0 {
+			aliases := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for _, g := range memberOf {
+				aliases.Content = append(aliases.Content, &yaml.Node{Kind: yaml.AliasNode, Value: groups[g.Name].Anchor, Alias: groups[g.Name]})
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "groups"}, aliases)
+		}
+		users.Content = append(users.Content, node)
+	}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "users"}, users)
+	doc := &yaml.Node{
+		Kind:        yaml.DocumentNode,
+		HeadComment: fmt.Sprintf("converted from %v, check it with tacquito -validate before serving it", source),
+		Content:     []*yaml.Node{root},
+	}
+	var b bytes.Buffer
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,262 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// redacted replaces passwords in the decoded fields
+const redacted = "<redacted>"
+
+// maxPending is the number of out of order segments a stream holds before giving up on the segment
+// it waits for, which the capture likely dropped
+const maxPending = 64
+
+// exchange is one decoded tacacs packet
+type exchange struct {
+	Time      time.Time         `json:"time"`
+	Client    string            `json:"client"`
+	Server    string            `json:"server"`
+	Direction string            `json:"direction"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// stream reassembles one direction of a tcp connection
+type stream struct {
+	synced  bool
+	next    uint32
+	pending map[uint32][]byte
+	buf     []byte
+}
+
+// decoder decodes the tacacs packets of the tcp segments it is given
+type decoder struct {
+	secret []byte
+	// port is the server port, it tells requests from replies
+	port uint16
+	// showPasswords disables redaction
+	showPasswords bool
+	emit          func(exchange)
+
+	streams map[string]*stream
+	// status holds the last authentication reply status of the sessions in progress, it tells a
+	// continue carrying a username from one carrying a password
+	status map[string]tq.AuthenStatus
+
+	decoded, failed int
+}
+
+func newDecoder(secret []byte, port uint16, showPasswords bool, emit func(exchange)) *decoder {
+	return &decoder{
+		secret:        secret,
+		port:          port,
+		showPasswords: showPasswords,
+		emit:          emit,
+		streams:       make(map[string]*stream),
+		status:        make(map[string]tq.AuthenStatus),
+	}
+}
+
+// segment adds a tcp segment to its stream and decodes the packets it completes
+func (d *decoder) segment(t time.Time, s segment) {
+	var client, server string
+	src := net.JoinHostPort(s.src.String(), strconv.Itoa(int(s.srcPort)))
+	dst := net.JoinHostPort(s.dst.String(), strconv.Itoa(int(s.dstPort)))
+	switch {
+	case s.dstPort == d.port:
+		client, server = src, dst
+	case s.srcPort == d.port:
+		client, server = dst, src
+	default:
+		return
+	}
+	key := src + ">" + dst
+	if s.rst {
+		delete(d.streams, key)
+		return
+	}
+	st, ok := d.streams[key]
+	if !ok {
+		st = &stream{pending: make(map[uint32][]byte)}
+		d.streams[key] = st
+	}
+	switch {
+	case s.syn:
+		st.synced, st.next, st.buf = true, s.seq+1, nil
+		st.pending = make(map[uint32][]byte)
+	case !st.synced:
+		// the capture started mid connection, hope it is at a packet boundary; the framing
+		// resyncs if it is not
+		st.synced, st.next = true, s.seq
+	}
+	if len(s.payload) > 0 && !s.syn {
+		if p, ok := st.pending[s.seq]; !ok || len(p) < len(s.payload) {
+			st.pending[s.seq] = s.payload
+		}
+	}
+	st.reassemble()
+	d.frames(t, client, server, st)
+	if s.fin {
+		delete(d.streams, key)
+	}
+}
+
+// reassemble moves the pending segments that continue the stream to buf, trimming retransmitted bytes
+func (st *stream) reassemble() {
+	for progress := true; progress; {
+		progress = false
+		for seq, p := range st.pending {
+			ahead := int32(seq - st.next)
+			if ahead > 0 {
+				continue
+			}
+			delete(st.pending, seq)
+			if int(-ahead) >= len(p) {
+				continue
+			}
+			p = p[-ahead:]
+			st.buf = append(st.buf, p...)
+			st.next += uint32(len(p))
+			progress = true
+		}
+	}
+	if len(st.pending) <= maxPending {
+		return
+	}
+	// skip the gap to the earliest segment held, what was buffered cannot be completed
+	first := true
+	for seq := range st.pending {
+		if first || int32(seq-st.next) < 0 {
+			st.next, first = seq, false
+		}
+	}
+	st.buf = nil
+	st.reassemble()
+}
+
+// frames decodes the complete packets in st.buf
+func (d *decoder) frames(t time.Time, client, server string, st *stream) {
+	for len(st.buf) >= tq.MaxHeaderLength {
+		var h tq.Header
+		if err := h.UnmarshalBinary(st.buf[:tq.MaxHeaderLength]); err != nil {
+			d.failed++
+			d.emit(exchange{Time: t, Client: client, Server: server, Error: fmt.Sprintf("lost the packet framing, dropped [%v] bytes; %v", len(st.buf), err)})
+			st.buf = nil
+			return
+		}
+		n := tq.MaxHeaderLength + int(h.Length)
+		if len(st.buf) < n {
+			return
+		}
+		raw := make([]byte, n)
+		copy(raw, st.buf)
+		st.buf = st.buf[n:]
+		d.packet(t, client, server, raw)
+	}
+}
+
+// packet decodes one raw tacacs packet
+func (d *decoder) packet(t time.Time, client, server string, raw []byte) {
+	e := exchange{Time: t, Client: client, Server: server}
+	defer func() { d.emit(e) }()
+	p := &tq.Packet{}
+	if err := p.UnmarshalBinary(raw); err != nil {
+		d.failed++
+		e.Error = fmt.Sprintf("unable to decode the packet; %v", err)
+		return
+	}
+	if err := tq.Crypt(d.secret, p); err != nil {
+		d.failed++
+		e.Error = fmt.Sprintf("unable to deobfuscate the packet; %v", err)
+		return
+	}
+	e.Fields = p.Header.Fields()
+	delete(e.Fields, "header-length")
+	e.Direction = "reply"
+	if p.Header.SeqNo%2 == 1 {
+		e.Direction = "request"
+	}
+	session := client + "/" + p.Header.SessionID.String()
+	body := d.body(p.Header)
+	if body == nil {
+		d.failed++
+		e.Error = fmt.Sprintf("unknown packet type [%v]", p.Header.Type)
+		return
+	}
+	if err := tq.UnmarshalWithFlags(p.Body, p.Header.Flags, body.(tq.EncoderDecoder)); err != nil {
+		d.failed++
+		e.Error = fmt.Sprintf("unable to decode the body, is the secret right?; %v", err)
+		return
+	}
+	d.decoded++
+	for k, v := range body.Fields() {
+		e.Fields[k] = v
+	}
+	switch b := body.(type) {
+	case *tq.AuthenReply:
+		switch b.Status {
+		case tq.AuthenStatusGetData, tq.AuthenStatusGetUser, tq.AuthenStatusGetPass:
+			d.status[session] = b.Status
+		default:
+			delete(d.status, session)
+		}
+	case *tq.AuthorReply, *tq.AcctReply:
+		delete(d.status, session)
+	}
+	if !d.showPasswords {
+		d.redact(e.Fields, body, d.status[session])
+	}
+}
+
+// body returns the type the body of the packet of h decodes to, requests have odd sequence numbers
+func (d *decoder) body(h *tq.Header) interface{ Fields() map[string]string } {
+	request := h.SeqNo%2 == 1
+	switch {
+	case h.Type == tq.Authenticate && h.SeqNo == 1:
+		return &tq.AuthenStart{}
+	case h.Type == tq.Authenticate && request:
+		return &tq.AuthenContinue{}
+	case h.Type == tq.Authenticate:
+		return &tq.AuthenReply{}
+	case h.Type == tq.Authorize && request:
+		return &tq.AuthorRequest{}
+	case h.Type == tq.Authorize:
+		return &tq.AuthorReply{}
+	case h.Type == tq.Accounting && request:
+		return &tq.AcctRequest{}
+	case h.Type == tq.Accounting:
+		return &tq.AcctReply{}
+	}
+	return nil
+}
+
+// redact replaces the passwords in fields.  status is the last authentication reply of the session,
+// a continue answering GetUser carries the username rather than a password.
+func (d *decoder) redact(fields map[string]string, body interface{}, status tq.AuthenStatus) {
+	switch b := body.(type) {
+	case *tq.AuthenStart:
+		// pap passwords, chap responses and the like
+		if len(b.Data) > 0 {
+			fields["data"] = redacted
+		}
+	case *tq.AuthenContinue:
+		if status != tq.AuthenStatusGetUser && len(b.UserMessage) > 0 {
+			fields["user-msg"] = redacted
+		}
+		if len(b.Data) > 0 {
+			fields["data"] = redacted
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	clientIP = net.IPv4(10, 0, 0, 1).To4()
+	serverIP = net.IPv4(10, 0, 0, 2).To4()
+)
+
+// tcpFrame returns an ethernet frame carrying a tcp segment
+func tcpFrame(fromClient bool, seq uint32, flags byte, payload []byte) []byte {
+	src, dst, srcPort, dstPort := clientIP, serverIP, uint16(40000), uint16(49)
+	if !fromClient {
+		src, dst, srcPort, dstPort = serverIP, clientIP, 49, 40000
+	}
+	tcp := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp, srcPort)
+	binary.BigEndian.PutUint16(tcp[2:], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12], tcp[13] = 5<<4, flags
+	tcp = append(tcp, payload...)
+
+	ip := make([]byte, 20, 20+len(tcp))
+	ip[0], ip[8], ip[9] = 0x45, 64, 6
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+	copy(ip[12:], src)
+	copy(ip[16:], dst)
+	ip = append(ip, tcp...)
+
+	eth := make([]byte, 14, 14+len(ip))
+	binary.BigEndian.PutUint16(eth[12:], 0x0800)
+	return append(eth, ip...)
+}
+
+// tacacs returns an obfuscated tacacs packet
+func tacacs(t *testing.T, secret string, seq int, body tq.EncoderDecoder) []byte {
+	p := tq.NewPacket(
+		tq.SetPacketHeader(tq.NewHeader(tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionDefault}), tq.SetHeaderType(headerType(body)), tq.SetHeaderSeqNo(seq), tq.SetHeaderSessionID(12345))),
+		tq.SetPacketBodyUnsafe(body),
+	)
+	require.NoError(t, tq.Crypt([]byte(secret), p))
+	b, err := p.MarshalBinary()
+	require.NoError(t, err)
+	return b
+}
+
+func headerType(body tq.EncoderDecoder) tq.HeaderType {
+	switch body.(type) {
+	case *tq.AuthorRequest, *tq.AuthorReply:
+		return tq.Authorize
+	case *tq.AcctRequest, *tq.AcctReply:
+		return tq.Accounting
+	}
+	return tq.Authenticate
+}
+
+// login returns the frames of an ascii login, with one packet split over two segments, a
+// retransmission and a segment captured out of order
+func login(t *testing.T) [][]byte {
+	start := tacacs(t, "fooman", 1, tq.NewAuthenStart(tq.SetAuthenStartAction(tq.AuthenActionLogin), tq.SetAuthenStartType(tq.AuthenTypeASCII), tq.SetAuthenStartService(tq.AuthenServiceLogin)))
+	getUser := tacacs(t, "fooman", 2, tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusGetUser)))
+	user := tacacs(t, "fooman", 3, tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage("alice")))
+	getPass := tacacs(t, "fooman", 4, tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusGetPass)))
+	pass := tacacs(t, "fooman", 5, tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage("hunter2")))
+	passed := tacacs(t, "fooman", 6, tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusPass)))
+
+	c, s := uint32(1000), uint32(5000)
+	frames := [][]byte{
+		tcpFrame(true, c-1, 0x02, nil),
+		tcpFrame(false, s-1, 0x12, nil),
+		tcpFrame(true, c, 0x18, start[:7]),
+		tcpFrame(true, c+7, 0x18, start[7:]),
+		tcpFrame(false, s, 0x18, getUser),
+		tcpFrame(false, s, 0x18, getUser),
+	}
+	c, s = c+uint32(len(start)), s+uint32(len(getUser))
+	frames = append(frames,
+		tcpFrame(true, c, 0x18, user),
+		tcpFrame(false, s, 0x18, getPass),
+		// the password is captured before the packet it follows
+		tcpFrame(true, c+uint32(len(user))+3, 0x18, pass[3:]),
+		tcpFrame(true, c+uint32(len(user)), 0x18, pass[:3]),
+		tcpFrame(false, s+uint32(len(getPass)), 0x19, passed),
+	)
+	return frames
+}
+
+// pcap returns a pcap capture of frames
+func pcap(frames [][]byte) []byte {
+	var b bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkEthernet)
+	b.Write(header)
+	for i, f := range frames {
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record, 1700000000)
+		binary.LittleEndian.PutUint32(record[4:], uint32(i))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(f)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(f)))
+		b.Write(record)
+		b.Write(f)
+	}
+	return b.Bytes()
+}
+
+// pcapng returns a big endian pcapng capture of frames
+func pcapng(frames [][]byte) []byte {
+	var b bytes.Buffer
+	block := func(typ uint32, body []byte) {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		n := uint32(12 + len(body))
+		binary.Write(&b, binary.BigEndian, typ)
+		binary.Write(&b, binary.BigEndian, n)
+		b.Write(body)
+		binary.Write(&b, binary.BigEndian, n)
+	}
+	block(0x0a0d0d0a, []byte{0x1a, 0x2b, 0x3c, 0x4d, 0, 1, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	// an interface with nanosecond timestamps
+	block(1, []byte{0, linkEthernet, 0, 0, 0, 0, 0xff, 0xff, 0, 9, 0, 1, 9, 0, 0, 0, 0, 0, 0, 0})
+	for _, f := range frames {
+		body := make([]byte, 20, 20+len(f))
+		binary.BigEndian.PutUint64(body[4:], 1700000000*1e9)
+		binary.BigEndian.PutUint32(body[12:], uint32(len(f)))
+		binary.BigEndian.PutUint32(body[16:], uint32(len(f)))
+		block(6, append(body, f...))
+	}
+	return b.Bytes()
+}
+
+func decodeAll(t *testing.T, capture []byte, secret string, showPasswords bool) ([]exchange, *decoder) {
+	r, err := newCaptureReader(bytes.NewReader(capture))
+	require.NoError(t, err)
+	var exchanges []exchange
+	d := newDecoder([]byte(secret), 49, showPasswords, func(e exchange) { exchanges = append(exchanges, e) })
+	require.NoError(t, decodeCapture(r, d))
+	return exchanges, d
+}
+
+func TestDecode(t *testing.T) {
+	for name, capture := range map[string][]byte{"pcap": pcap(login(t)), "pcapng": pcapng(login(t))} {
+		exchanges, d := decodeAll(t, capture, "fooman", false)
+		assert.Equal(t, 6, d.decoded, name)
+		assert.Equal(t, 0, d.failed, name)
+		require.Len(t, exchanges, 6, name)
+		for i, e := range exchanges {
+			assert.Equal(t, "10.0.0.1:40000", e.Client, name)
+			assert.Equal(t, "10.0.0.2:49", e.Server, name)
+			assert.Equal(t, 1700000000, int(e.Time.Unix()), name)
+			assert.Equal(t, tq.SequenceNumber(i+1).String(), e.Fields["header-seq-no"], name)
+		}
+		assert.Equal(t, "request", exchanges[0].Direction, name)
+		assert.Equal(t, "AuthenStart", exchanges[0].Fields["packet-type"], name)
+		assert.Equal(t, "reply", exchanges[1].Direction, name)
+		// the username is shown, the password is not
+		assert.Equal(t, "alice", exchanges[2].Fields["user-msg"], name)
+		assert.Equal(t, redacted, exchanges[4].Fields["user-msg"], name)
+		assert.Equal(t, "AuthenReply", exchanges[5].Fields["packet-type"], name)
+	}
+
+	exchanges, _ := decodeAll(t, pcap(login(t)), "fooman", true)
+	assert.Equal(t, "hunter2", exchanges[4].Fields["user-msg"])
+}
+
+func TestDecodeWrongSecret(t *testing.T) {
+	exchanges, d := decodeAll(t, pcap(login(t)), "barman", false)
+	assert.Equal(t, 6, d.failed)
+	require.Len(t, exchanges, 6)
+	assert.Contains(t, exchanges[0].Error, "is the secret right?")
+}
+
+func TestDecodeResync(t *testing.T) {
+	// a capture starting mid packet drops what it cannot frame, then decodes the packets that follow
+	frames := login(t)
+	_, d := decodeAll(t, pcap(append([][]byte{tcpFrame(true, 988, 0x18, bytes.Repeat([]byte{0xff}, 12))}, frames[2:]...)), "fooman", false)
+	assert.Equal(t, 1, d.failed)
+	assert.Equal(t, 6, d.decoded)
+}
+
+func TestParseFrame(t *testing.T) {
+	s, ok := parseFrame(frame{link: linkEthernet, data: tcpFrame(true, 7, 0x02, nil)})
+	require.True(t, ok)
+	assert.True(t, s.syn)
+	assert.Equal(t, uint32(7), s.seq)
+	assert.Equal(t, uint16(49), s.dstPort)
+
+	// vlan tagged
+	f := tcpFrame(false, 7, 0x18, []byte("x"))
+	tagged := append(append(append([]byte{}, f[:12]...), 0x81, 0x00, 0, 1), f[12:]...)
+	s, ok = parseFrame(frame{link: linkEthernet, data: tagged})
+	require.True(t, ok)
+	assert.Equal(t, []byte("x"), s.payload)
+	assert.Equal(t, uint16(49), s.srcPort)
+
+	// raw ip
+	s, ok = parseFrame(frame{link: linkRaw, data: f[14:]})
+	require.True(t, ok)
+	assert.Equal(t, serverIP, s.src.To4())
+
+	_, ok = parseFrame(frame{link: 999, data: f})
+	assert.False(t, ok)
+}
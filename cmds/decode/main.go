@@ -0,0 +1,115 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main decodes the tacacs exchanges of a packet capture, for debugging device interop
+// without instrumenting the server
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+var (
+	in            = flag.String("in", "-", "the pcap or pcapng capture to decode, - reads stdin")
+	secret        = flag.String("secret", "fooman", "the tacacs secret the capture's packets were obfuscated with")
+	port          = flag.Uint("port", 49, "the server port, it tells requests from replies")
+	showPasswords = flag.Bool("show-passwords", false, "print passwords and other authentication data rather than redacting them")
+	jsonOutput    = flag.Bool("json", false, "write one json object per packet")
+)
+
+func main() {
+	flag.Parse()
+	if *port == 0 || *port > 65535 {
+		fmt.Fprintf(os.Stderr, "-port must be a tcp port\n")
+		os.Exit(2)
+	}
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		defer f.Close()
+		r = f
+	}
+	capture, err := newCaptureReader(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	emit := printText(os.Stdout)
+	if *jsonOutput {
+		emit = printJSON(os.Stdout)
+	}
+	d := newDecoder([]byte(*secret), uint16(*port), *showPasswords, emit)
+	err = decodeCapture(capture, d)
+	fmt.Fprintf(os.Stderr, "decoded %v packets, failed %v\n", d.decoded, d.failed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "decode stopped; %v\n", err)
+		os.Exit(2)
+	}
+	if d.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// decodeCapture decodes every frame of capture
+func decodeCapture(capture captureReader, d *decoder) error {
+	for {
+		f, err := capture.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if s, ok := parseFrame(f); ok {
+			d.segment(f.time, s)
+		}
+	}
+}
+
+// printText writes an exchange as a summary line followed by its fields
+func printText(w io.Writer) func(exchange) {
+	return func(e exchange) {
+		fmt.Fprintf(w, "%v %v -> %v", e.Time.Format(time.RFC3339Nano), e.Client, e.Server)
+		if e.Direction != "" {
+			fmt.Fprintf(w, " %v %v", e.Direction, e.Fields["packet-type"])
+		}
+		fmt.Fprintln(w)
+		if e.Error != "" {
+			fmt.Fprintf(w, "\terror: %v\n", e.Error)
+		}
+		keys := make([]string, 0, len(e.Fields))
+		for k := range e.Fields {
+			if k != "packet-type" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "\t%v: %v\n", k, e.Fields[k])
+		}
+	}
+}
+
+// printJSON writes an exchange as a line of json
+func printJSON(w io.Writer) func(exchange) {
+	enc := json.NewEncoder(w)
+	return func(e exchange) {
+		if err := enc.Encode(e); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to encode the exchange; %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// link layer types of the captures we read, see https://www.tcpdump.org/linktypes.html
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkSLL      = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+	linkSLL2     = 276
+)
+
+// frame is a captured frame and the link layer it starts with
+type frame struct {
+	time time.Time
+	link uint32
+	data []byte
+}
+
+// captureReader reads the frames of a capture file
+type captureReader interface {
+	next() (frame, error)
+}
+
+// newCaptureReader reads a pcap or pcapng capture, telling them apart by their magic
+func newCaptureReader(r io.Reader) (captureReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the capture header; %v", err)
+	}
+	switch {
+	case binary.BigEndian.Uint32(magic) == 0x0a0d0d0a:
+		return &pcapngReader{r: br, tsresol: map[uint32]float64{}}, nil
+	default:
+		return newPcapReader(br)
+	}
+}
+
+// pcapReader reads classic pcap files
+type pcapReader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	// nanos is set for files with nanosecond timestamps
+	nanos bool
+	link  uint32
+}
+
+func newPcapReader(r io.Reader) (*pcapReader, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("unable to read the pcap header; %v", err)
+	}
+	p := &pcapReader{r: r}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header) {
+		case 0xa1b2c3d4:
+			p.order = order
+		case 0xa1b23c4d:
+			p.order, p.nanos = order, true
+		}
+	}
+	if p.order == nil {
+		return nil, fmt.Errorf("not a pcap or pcapng file, magic [%x]", header[:4])
+	}
+	p.link = p.order.Uint32(header[20:]) & 0xffff
+	return p, nil
+}
+
+// next implements captureReader
+func (p *pcapReader) next() (frame, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("truncated pcap record header")
+		}
+		return frame{}, err
+	}
+	sec, frac := p.order.Uint32(header), p.order.Uint32(header[4:])
+	n := p.order.Uint32(header[8:])
+	if n > 1<<24 {
+		return frame{}, fmt.Errorf("pcap record length [%v] is too large", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return frame{}, fmt.Errorf("truncated pcap record; %v", err)
+	}
+	if !p.nanos {
+		frac *= 1000
+	}
+	return frame{time: time.Unix(int64(sec), int64(frac)).UTC(), link: p.link, data: data}, nil
+}
+
+// pcapngReader reads pcapng files, see https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html
+type pcapngReader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	// links and tsresol are the link types and timestamp resolutions, in seconds, of the
+	// interfaces of the current section
+	links   []uint32
+	tsresol map[uint32]float64
+}
+
+// next implements captureReader
+func (p *pcapngReader) next() (frame, error) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(p.r, header); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = fmt.Errorf("truncated pcapng block header")
+			}
+			return frame{}, err
+		}
+		blockType := binary.BigEndian.Uint32(header)
+		if blockType == 0x0a0d0d0a {
+			// a section header sets the byte order of its section
+			magic := make([]byte, 4)
+			if _, err := io.ReadFull(p.r, magic); err != nil {
+				return frame{}, fmt.Errorf("truncated pcapng section header; %v", err)
+			}
+			switch binary.LittleEndian.Uint32(magic) {
+			case 0x1a2b3c4d:
+				p.order = binary.LittleEndian
+			case 0x4d3c2b1a:
+				p.order = binary.BigEndian
+			default:
+				return frame{}, fmt.Errorf("bad pcapng byte order magic [%x]", magic)
+			}
+			p.links, p.tsresol = nil, map[uint32]float64{}
+			if err := p.skip(int(p.order.Uint32(header[4:])) - 12); err != nil {
+				return frame{}, err
+			}
+			continue
+		}
+		if p.order == nil {
+			return frame{}, fmt.Errorf("pcapng block before the section header")
+		}
+		blockType = p.order.Uint32(header)
+		length := int(p.order.Uint32(header[4:]))
+		if length < 12 || length > 1<<24 {
+			return frame{}, fmt.Errorf("bad pcapng block length [%v]", length)
+		}
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(p.r, body); err != nil {
+			return frame{}, fmt.Errorf("truncated pcapng block; %v", err)
+		}
+		body = body[:len(body)-4]
+		switch blockType {
+		case 1:
+			// interface description
+			if len(body) < 8 {
+				return frame{}, fmt.Errorf("truncated pcapng interface description")
+			}
+			p.tsresol[uint32(len(p.links))] = p.resolution(body[8:])
+			p.links = append(p.links, uint32(p.order.Uint16(body)))
+		case 6:
+			// enhanced packet
+			if len(body) < 20 {
+				return frame{}, fmt.Errorf("truncated pcapng enhanced packet")
+			}
+			iface, n := p.order.Uint32(body), p.order.Uint32(body[12:])
+			if int(iface) >= len(p.links) || int(n) > len(body)-20 {
+				return frame{}, fmt.Errorf("bad pcapng enhanced packet")
+			}
+			ts := uint64(p.order.Uint32(body[4:]))<<32 | uint64(p.order.Uint32(body[8:]))
+			seconds := float64(ts) * p.tsresol[iface]
+			sec, frac := math.Modf(seconds)
+			return frame{time: time.Unix(int64(sec), int64(frac*1e9)).UTC(), link: p.links[iface], data: body[20 : 20+n]}, nil
+		case 3:
+			// simple packet, of the first interface and without a timestamp
+			if len(body) < 4 || len(p.links) == 0 {
+				return frame{}, fmt.Errorf("bad pcapng simple packet")
+			}
+			n := int(p.order.Uint32(body))
+			if n > len(body)-4 {
+				n = len(body) - 4
+			}
+			return frame{link: p.links[0], data: body[4 : 4+n]}, nil
+		}
+	}
+}
+
+// resolution returns the timestamp resolution of the if_tsresol option, microseconds by default
+func (p *pcapngReader) resolution(options []byte) float64 {
+	for len(options) >= 4 {
+		code, n := p.order.Uint16(options), int(p.order.Uint16(options[2:]))
+		if code == 0 || 4+n > len(options) {
+			break
+		}
+		if code == 9 && n == 1 {
+			v := options[4]
+			if v&0x80 != 0 {
+				return math.Pow(2, -float64(v&0x7f))
+			}
+			return math.Pow(10, -float64(v))
+		}
+		options = options[4+(n+3)/4*4:]
+	}
+	return 1e-6
+}
+
+// skip discards n bytes
+func (p *pcapngReader) skip(n int) error {
+	if n < 0 {
+		return fmt.Errorf("bad pcapng block length")
+	}
+	_, err := io.CopyN(io.Discard, p.r, int64(n))
+	return err
+}
+
+// segment is a tcp segment
+type segment struct {
+	src, dst         net.IP
+	srcPort, dstPort uint16
+	seq              uint32
+	syn, fin, rst    bool
+	payload          []byte
+}
+
+// parseFrame returns the tcp segment carried by f, ok is false if it carries none
+func parseFrame(f frame) (segment, bool) {
+	data := f.data
+	var ethertype uint16
+	switch f.link {
+	case linkEthernet:
+		if len(data) < 14 {
+			return segment{}, false
+		}
+		ethertype, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		// vlan tags
+		for (ethertype == 0x8100 || ethertype == 0x88a8) && len(data) >= 4 {
+			ethertype, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case linkSLL:
+		if len(data) < 16 {
+			return segment{}, false
+		}
+		ethertype, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case linkSLL2:
+		if len(data) < 20 {
+			return segment{}, false
+		}
+		ethertype, data = binary.BigEndian.Uint16(data), data[20:]
+	case linkNull, linkLoop:
+		// the address family, in either byte order; the ip version tells them apart anyway
+		if len(data) < 4 {
+			return segment{}, false
+		}
+		data = data[4:]
+	case linkRaw, linkIPv4, linkIPv6:
+	default:
+		return segment{}, false
+	}
+	if len(data) < 1 {
+		return segment{}, false
+	}
+	switch {
+	case ethertype == 0x0800 || (ethertype == 0 && data[0]>>4 == 4):
+		return parseIPv4(data)
+	case ethertype == 0x86dd || (ethertype == 0 && data[0]>>4 == 6):
+		return parseIPv6(data)
+	}
+	return segment{}, false
+}
+
+func parseIPv4(data []byte) (segment, bool) {
+	if len(data) < 20 {
+		return segment{}, false
+	}
+	ihl := int(data[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(data[2:]))
+	// fragments are not reassembled, tacacs+ segments are well under the mtu
+	if data[9] != 6 || ihl < 20 || binary.BigEndian.Uint16(data[6:])&0x3fff != 0 {
+		return segment{}, false
+	}
+	if total > len(data) || total < ihl {
+		// some captures pad short frames, others truncate, trust what was captured
+		total = len(data)
+	}
+	return parseTCP(net.IP(data[12:16]), net.IP(data[16:20]), data[ihl:total])
+}
+
+func parseIPv6(data []byte) (segment, bool) {
+	if len(data) < 40 {
+		return segment{}, false
+	}
+	src, dst := net.IP(data[8:24]), net.IP(data[24:40])
+	next, payload := data[6], data[40:]
+	if n := int(binary.BigEndian.Uint16(data[4:])); n < len(payload) {
+		payload = payload[:n]
+	}
+	// hop by hop, routing and destination options headers
+	for next == 0 || next == 43 || next == 60 {
+		if len(payload) < 8 {
+			return segment{}, false
+		}
+		n := (int(payload[1]) + 1) * 8
+		if n > len(payload) {
+			return segment{}, false
+		}
+		next, payload = payload[0], payload[n:]
+	}
+	if next != 6 {
+		return segment{}, false
+	}
+	return parseTCP(src, dst, payload)
+}
+
+func parseTCP(src, dst net.IP, data []byte) (segment, bool) {
+	if len(data) < 20 {
+		return segment{}, false
+	}
+	offset := int(data[12]>>4) * 4
+	if offset < 20 || offset > len(data) {
+		return segment{}, false
+	}
+	flags := data[13]
+	return segment{
+		src:     src,
+		dst:     dst,
+		srcPort: binary.BigEndian.Uint16(data),
+		dstPort: binary.BigEndian.Uint16(data[2:]),
+		seq:     binary.BigEndian.Uint32(data[4:]),
+		fin:     flags&0x01 != 0,
+		syn:     flags&0x02 != 0,
+		rst:     flags&0x04 != 0,
+		payload: data[offset:],
+	}, true
+}
@@ -0,0 +1,128 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// buckets are the upper bounds of the latency histogram, doubling from 50µs to about 6.5s.
+// Latencies above the last bound are counted in an overflow bucket.
+var buckets = func() []time.Duration {
+	b := make([]time.Duration, 18)
+	b[0] = 50 * time.Microsecond
+	for i := 1; i < len(b); i++ {
+		b[i] = 2 * b[i-1]
+	}
+	return b
+}()
+
+// histogram counts latencies in buckets.  The zero histogram is empty and ready to use, and it is
+// safe for concurrent use.
+type histogram struct {
+	sync.Mutex
+	counts []int64
+	total  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// observe counts latency d
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(buckets) && d > buckets[i] {
+		i++
+	}
+	h.Lock()
+	defer h.Unlock()
+	if h.counts == nil {
+		h.counts = make([]int64, len(buckets)+1)
+	}
+	h.counts[i]++
+	h.total++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// quantile estimates the latency q of the observed latencies are below, interpolating within the
+// bucket it falls in.  Estimates never exceed the largest latency observed.
+func (h *histogram) quantile(q float64) time.Duration {
+	h.Lock()
+	defer h.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	rank := q * float64(h.total)
+	var seen float64
+	for i, n := range h.counts {
+		if n == 0 || seen+float64(n) < rank {
+			seen += float64(n)
+			continue
+		}
+		var lower time.Duration
+		if i > 0 {
+			lower = buckets[i-1]
+		}
+		upper := h.max
+		if i < len(buckets) && buckets[i] < upper {
+			upper = buckets[i]
+		}
+		d := lower + time.Duration((rank-seen)/float64(n)*float64(upper-lower))
+		if d > h.max {
+			return h.max
+		}
+		return d
+	}
+	return h.max
+}
+
+// mean is the average of the observed latencies
+func (h *histogram) mean() time.Duration {
+	h.Lock()
+	defer h.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// bucket is the count of latencies up to an upper bound, zero for the overflow bucket
+type bucket struct {
+	UpperBound time.Duration `json:"le_ns"`
+	Count      int64         `json:"count"`
+}
+
+// buckets returns the buckets from the first to the last with a count
+func (h *histogram) buckets() []bucket {
+	h.Lock()
+	defer h.Unlock()
+	first, last := -1, -1
+	for i, n := range h.counts {
+		if n > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return nil
+	}
+	b := make([]bucket, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		var upper time.Duration
+		if i < len(buckets) {
+			upper = buckets[i]
+		}
+		b = append(b, bucket{UpperBound: upper, Count: h.counts[i]})
+	}
+	return b
+}
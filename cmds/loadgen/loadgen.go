@@ -0,0 +1,229 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// kind is the type of session the load generator runs
+type kind int
+
+const (
+	authen kind = iota
+	author
+	acct
+)
+
+var kinds = []string{"authen", "author", "acct"}
+
+func (k kind) String() string {
+	return kinds[k]
+}
+
+// mix weights the kinds of session run, indexed by kind
+type mix [3]int
+
+// parseMix parses weights such as authen=2,author=1,acct=1; kinds left out are not run
+func parseMix(s string) (mix, error) {
+	var m mix
+	for _, field := range strings.Split(s, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return m, fmt.Errorf("invalid mix [%v], expected kind=weight", field)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return m, fmt.Errorf("invalid weight [%v] for [%v]", weight, name)
+		}
+		i := 0
+		for i < len(kinds) && kinds[i] != name {
+			i++
+		}
+		if i == len(kinds) {
+			return m, fmt.Errorf("invalid kind [%v], valid choices, %v", name, kinds)
+		}
+		m[i] = w
+	}
+	if m[authen]+m[author]+m[acct] == 0 {
+		return m, fmt.Errorf("mix [%v] runs no sessions", s)
+	}
+	return m, nil
+}
+
+// pick chooses the kind of the next session at random, in proportion to the weights
+func (m mix) pick(r *rand.Rand) kind {
+	n := r.Intn(m[authen] + m[author] + m[acct])
+	for k, w := range m {
+		if n < w {
+			return kind(k)
+		}
+		n -= w
+	}
+	return acct
+}
+
+// outcomes are the sessions of one kind run so far, and the latency of those that were replied to
+type outcomes struct {
+	// passed sessions got the reply a valid user expects, failed ones another reply, and
+	// errored ones no reply, eg the connection was refused or the exchange timed out
+	passed  int64
+	failed  int64
+	errored int64
+	latency histogram
+}
+
+func (o *outcomes) sessions() int64 {
+	return atomic.LoadInt64(&o.passed) + atomic.LoadInt64(&o.failed) + atomic.LoadInt64(&o.errored)
+}
+
+// generator runs sessions against a server from a number of clients, each holding one connection
+type generator struct {
+	// dial connects a new client to the server
+	dial    func() (*tq.Client, error)
+	clients int
+	// rampUp is the time taken to start every client, evenly spaced
+	rampUp time.Duration
+	// sessions is the number of sessions run and duration how long they are started for, the
+	// first reached ending the run; zero is unlimited
+	sessions int
+	duration time.Duration
+	mix      mix
+	timeout  time.Duration
+	username string
+	password string
+	pap      bool
+	// authorArgs are authorized by author sessions, and acctArgs are accounted by acct sessions
+	authorArgs tq.Args
+	acctArgs   tq.Args
+	results    [3]outcomes
+	// errorf reports sessions that errored
+	errorf func(format string, args ...interface{})
+}
+
+// run starts the clients and runs sessions until g.sessions have been started, g.duration has
+// passed or ctx is done, then waits for the sessions started to end
+func (g *generator) run(ctx context.Context) {
+	if g.errorf == nil {
+		g.errorf = func(string, ...interface{}) {}
+	}
+	queue := make(chan kind)
+	var wg sync.WaitGroup
+	for i := 0; i < g.clients; i++ {
+		wg.Add(1)
+		go func(delay time.Duration) {
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			g.client(ctx, queue)
+		}(g.rampUp * time.Duration(i) / time.Duration(g.clients))
+	}
+	var stop <-chan time.Time
+	if g.duration > 0 {
+		timer := time.NewTimer(g.duration)
+		defer timer.Stop()
+		stop = timer.C
+	}
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+start:
+	for n := 0; g.sessions == 0 || n < g.sessions; n++ {
+		select {
+		case <-ctx.Done():
+			break start
+		case <-stop:
+			break start
+		case queue <- g.mix.pick(r):
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// client runs the sessions received on queue one at a time on its connection.  The connection is
+// redialed after a session that errored, its state being unknown.
+func (g *generator) client(ctx context.Context, queue <-chan kind) {
+	var c *tq.Client
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+	for k := range queue {
+		o := &g.results[k]
+		if c == nil {
+			var err error
+			if c, err = g.dial(); err != nil {
+				atomic.AddInt64(&o.errored, 1)
+				g.errorf("unable to connect; %v", err)
+				continue
+			}
+		}
+		started := time.Now()
+		passed, err := g.session(ctx, c, k)
+		if err != nil {
+			atomic.AddInt64(&o.errored, 1)
+			g.errorf("%v session errored; %v", k, err)
+			c.Close()
+			c = nil
+			continue
+		}
+		o.latency.observe(time.Since(started))
+		if passed {
+			atomic.AddInt64(&o.passed, 1)
+		} else {
+			atomic.AddInt64(&o.failed, 1)
+		}
+	}
+}
+
+// session runs a session of kind k on c, reporting whether it got the reply a valid user expects
+func (g *generator) session(ctx context.Context, c *tq.Client, k kind) (bool, error) {
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	switch k {
+	case authen:
+		login := c.AuthenticateASCII
+		if g.pap {
+			login = c.AuthenticatePAP
+		}
+		reply, err := login(ctx, g.username, g.password)
+		if err != nil {
+			return false, err
+		}
+		return reply.Status == tq.AuthenStatusPass, nil
+	case author:
+		reply, err := c.Authorize(ctx, g.username, g.authorArgs)
+		if err != nil {
+			return false, err
+		}
+		return reply.Status == tq.AuthorStatusPassAdd || reply.Status == tq.AuthorStatusPassRepl, nil
+	default:
+		var flags tq.AcctRequestFlag
+		flags.Set(tq.AcctFlagStart)
+		reply, err := c.Account(ctx, g.username, flags, g.acctArgs)
+		if err != nil {
+			return false, err
+		}
+		return reply.Status == tq.AcctReplyStatusSuccess, nil
+	}
+}
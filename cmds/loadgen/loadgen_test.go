@@ -0,0 +1,143 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+	"github.com/facebookincubator/tacquito/cmds/server/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGenerator(t *testing.T) *generator {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	sp, err := test.MockSecretProvider(ctx, logger, "../server/test/testdata/test_config.yaml")
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	go tq.NewServer(logger, sp).Serve(ctx, listener.(*net.TCPListener))
+	return &generator{
+		dial: func() (*tq.Client, error) {
+			return tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+		},
+		clients:    10,
+		mix:        mix{1, 1, 1},
+		timeout:    5 * time.Second,
+		username:   "mr_uses_group",
+		password:   "password",
+		authorArgs: tq.Args{"service=shell", "cmd=configure", "cmd-arg=terminal", "cmd-arg=<cr>"},
+		acctArgs:   tq.Args{"service=shell", "cmd=show", "cmd-arg=system"},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	g := newGenerator(t)
+	g.sessions = 150
+	g.rampUp = 50 * time.Millisecond
+	g.run(context.Background())
+
+	r := g.report("server", time.Second)
+	assert.Equal(t, int64(150), r.Sessions)
+	assert.Zero(t, r.Errors)
+	require.Len(t, r.Kinds, 3)
+	for _, s := range r.Kinds {
+		assert.Equal(t, s.Sessions, s.Passed, s.Kind)
+		var n int64
+		for _, b := range s.Buckets {
+			n += b.Count
+		}
+		assert.Equal(t, s.Sessions, n, s.Kind)
+		assert.True(t, s.P50 <= s.P99 && s.P99 <= s.Max, s.Kind)
+	}
+	var out bytes.Buffer
+	r.write(&out)
+	assert.Contains(t, out.String(), "150 sessions against [server] from 10 clients in 1s, 150.0/s, 0 errors")
+}
+
+func TestLoadDuration(t *testing.T) {
+	g := newGenerator(t)
+	g.duration = 200 * time.Millisecond
+	g.mix = mix{0, 1, 0}
+	g.authorArgs = tq.Args{"service=shell", "cmd=reload"}
+	started := time.Now()
+	g.run(context.Background())
+	assert.Less(t, time.Since(started), 2*time.Second)
+
+	r := g.report("server", time.Since(started))
+	require.Len(t, r.Kinds, 1)
+	assert.Equal(t, "author", r.Kinds[0].Kind)
+	assert.NotZero(t, r.Kinds[0].Failed)
+	assert.Zero(t, r.Kinds[0].Passed)
+	assert.Zero(t, r.Errors)
+}
+
+func TestLoadErrors(t *testing.T) {
+	g := newGenerator(t)
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+	g.dial = func() (*tq.Client, error) {
+		return tq.NewClient(tq.SetClientDialer("tcp6", address, []byte("fooman")))
+	}
+	g.sessions = 20
+	g.run(context.Background())
+	r := g.report("server", time.Second)
+	assert.Equal(t, int64(20), r.Errors)
+	assert.Empty(t, r.Kinds[0].Buckets)
+}
+
+func TestParseMix(t *testing.T) {
+	m, err := parseMix("authen=2, acct=1")
+	require.NoError(t, err)
+	assert.Equal(t, mix{2, 0, 1}, m)
+	r := rand.New(rand.NewSource(1))
+	var counts [3]int
+	for i := 0; i < 3000; i++ {
+		counts[m.pick(r)]++
+	}
+	assert.Zero(t, counts[author])
+	assert.InDelta(t, 2000, counts[authen], 150)
+
+	for _, v := range []string{"authen", "authen=-1", "login=1", "authen=0"} {
+		_, err := parseMix(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	assert.Zero(t, h.quantile(0.5))
+	for i := 1; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	h.observe(time.Minute)
+	assert.Equal(t, time.Minute, h.quantile(1))
+	p50 := h.quantile(0.5)
+	assert.True(t, p50 > 25*time.Millisecond && p50 <= 102400*time.Microsecond, p50)
+	b := h.buckets()
+	assert.Equal(t, 1600*time.Microsecond, b[0].UpperBound)
+	assert.Equal(t, bucket{Count: 1}, b[len(b)-1])
+	var n int64
+	for _, v := range b {
+		n += v.Count
+	}
+	assert.Equal(t, int64(101), n)
+}
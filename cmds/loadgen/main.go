@@ -0,0 +1,165 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main generates authentication, authorization and accounting load against a tacacs
+// server and reports the latency of its replies, for capacity planning
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+var (
+	network       = flag.String("network", "tcp6", "connect over tcp or tcp6")
+	address       = flag.String("address", ":2046", "the address:port of the server to load")
+	secret        = flag.String("secret", "fooman", "the tacacs secret to be used")
+	clients       = flag.Int("clients", 75, "the clients run at once, each with its own connection and one session at a time")
+	sessions      = flag.Int("sessions", 1500, "the sessions run; 0 runs sessions until -duration has passed")
+	duration      = flag.Duration("duration", 0, "how long sessions are started for; 0 runs -sessions sessions")
+	rampUp        = flag.Duration("ramp-up", 0, "the time taken to start every client, evenly spaced")
+	sessionMix    = flag.String("mix", "authen=1,author=1,acct=1", "the weights the kinds of session are chosen with at random, kinds left out are not run")
+	username      = flag.String("username", "mr_uses_group", "the user every session is for")
+	password      = flag.String("password", "password", "the password authen sessions log in with")
+	authenType    = flag.String("authen-type", "ascii", "how authen sessions log in, valid choices, [ascii pap]")
+	authorArgs    = flag.String("author-args", "service=shell,cmd=configure,cmd-arg=terminal,cmd-arg=<cr>", "the comma separated args author sessions ask to authorize")
+	acctArgs      = flag.String("acct-args", "service=shell,cmd=show,cmd-arg=system", "the comma separated args of the start records acct sessions send")
+	timeout       = flag.Duration("timeout", 10*time.Second, "how long each session may take; 0 waits forever")
+	useTLS        = flag.Bool("tls", false, "connect with tls")
+	tlsCA         = flag.String("tls-ca", "", "the pem bundle the server's certificate is verified with; the system roots if empty")
+	tlsCert       = flag.String("tls-cert", "", "a pem client certificate to present to the server")
+	tlsKey        = flag.String("tls-key", "", "the pem key of -tls-cert")
+	tlsServerName = flag.String("tls-server-name", "", "the name the server's certificate is verified for; the host of -address if empty")
+	tlsInsecure   = flag.Bool("tls-insecure", false, "do not verify the server's certificate, for lab servers only")
+	jsonOutput    = flag.Bool("json", false, "write the report as json")
+	progress      = flag.Duration("progress", 5*time.Second, "how often progress is written to stderr; 0 disables")
+	verbose       = flag.Bool("v", false, "write every session that errored to stderr")
+)
+
+func main() {
+	flag.Parse()
+	if *clients < 1 || *sessions < 0 || (*sessions == 0 && *duration <= 0) {
+		fmt.Fprintf(os.Stderr, "-clients must be positive, and -sessions or -duration must limit the run\n")
+		os.Exit(2)
+	}
+	m, err := parseMix(*sessionMix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if *authenType != "ascii" && *authenType != "pap" {
+		fmt.Fprintf(os.Stderr, "%v is an invalid authen type\n", *authenType)
+		os.Exit(2)
+	}
+	dial, err := dialer()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	g := &generator{
+		dial:       dial,
+		clients:    *clients,
+		rampUp:     *rampUp,
+		sessions:   *sessions,
+		duration:   *duration,
+		mix:        m,
+		timeout:    *timeout,
+		username:   *username,
+		password:   *password,
+		pap:        *authenType == "pap",
+		authorArgs: splitArgs(*authorArgs),
+		acctArgs:   splitArgs(*acctArgs),
+	}
+	if *verbose {
+		g.errorf = func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	started := time.Now()
+	if *progress > 0 {
+		ticker := time.NewTicker(*progress)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				var n, errored int64
+				for k := range g.results {
+					n += g.results[k].sessions()
+					errored += atomic.LoadInt64(&g.results[k].errored)
+				}
+				fmt.Fprintf(os.Stderr, "sessions %v, errors %v, %.1f/s\n", n, errored, float64(n)/time.Since(started).Seconds())
+			}
+		}()
+	}
+	g.run(ctx)
+	r := g.report(*address, time.Since(started))
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(r)
+	} else {
+		r.write(os.Stdout)
+	}
+	if r.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// dialer returns the func clients connect to the server with, over tls if -tls is set
+func dialer() (func() (*tq.Client, error), error) {
+	if !*useTLS {
+		return func() (*tq.Client, error) {
+			return tq.NewClient(tq.SetClientDialer(*network, *address, []byte(*secret)))
+		}, nil
+	}
+	config := &tls.Config{ServerName: *tlsServerName, InsecureSkipVerify: *tlsInsecure}
+	if *tlsCA != "" {
+		b, err := os.ReadFile(*tlsCA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in [%v]", *tlsCA)
+		}
+	}
+	if *tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the client certificate; %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return func() (*tq.Client, error) {
+		return tq.NewClient(tq.SetClientTLSDialer(*network, *address, config, []byte(*secret)))
+	}, nil
+}
+
+// splitArgs splits comma separated args
+func splitArgs(s string) tq.Args {
+	var args tq.Args
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			args = append(args, tq.Arg(v))
+		}
+	}
+	return args
+}
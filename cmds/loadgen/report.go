@@ -0,0 +1,110 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// summary is the outcome of the sessions of one kind, durations being in nanoseconds when encoded
+type summary struct {
+	Kind      string        `json:"kind"`
+	Sessions  int64         `json:"sessions"`
+	Passed    int64         `json:"passed"`
+	Failed    int64         `json:"failed"`
+	Errors    int64         `json:"errors"`
+	PerSecond float64       `json:"per_second"`
+	Mean      time.Duration `json:"mean_ns"`
+	P50       time.Duration `json:"p50_ns"`
+	P90       time.Duration `json:"p90_ns"`
+	P99       time.Duration `json:"p99_ns"`
+	Max       time.Duration `json:"max_ns"`
+	Buckets   []bucket      `json:"buckets"`
+}
+
+// report is the outcome of a run
+type report struct {
+	Server   string        `json:"server"`
+	Clients  int           `json:"clients"`
+	Elapsed  time.Duration `json:"elapsed_ns"`
+	Sessions int64         `json:"sessions"`
+	Errors   int64         `json:"errors"`
+	Kinds    []summary     `json:"kinds"`
+}
+
+// report summarizes the sessions run in elapsed, for each kind in the mix
+func (g *generator) report(server string, elapsed time.Duration) report {
+	r := report{Server: server, Clients: g.clients, Elapsed: elapsed}
+	for k := range g.results {
+		if g.mix[k] == 0 {
+			continue
+		}
+		o := &g.results[k]
+		s := summary{
+			Kind:    kind(k).String(),
+			Passed:  atomic.LoadInt64(&o.passed),
+			Failed:  atomic.LoadInt64(&o.failed),
+			Errors:  atomic.LoadInt64(&o.errored),
+			Mean:    o.latency.mean(),
+			P50:     o.latency.quantile(0.5),
+			P90:     o.latency.quantile(0.9),
+			P99:     o.latency.quantile(0.99),
+			Buckets: o.latency.buckets(),
+		}
+		s.Sessions = s.Passed + s.Failed + s.Errors
+		s.Max = o.latency.quantile(1)
+		if elapsed > 0 {
+			s.PerSecond = float64(s.Sessions) / elapsed.Seconds()
+		}
+		r.Sessions += s.Sessions
+		r.Errors += s.Errors
+		r.Kinds = append(r.Kinds, s)
+	}
+	return r
+}
+
+// write writes r as text, with a latency histogram for each kind
+func (r report) write(w io.Writer) {
+	for _, s := range r.Kinds {
+		fmt.Fprintf(w, "%v: %v sessions, %v passed, %v failed, %v errors, %.1f/s\n", s.Kind, s.Sessions, s.Passed, s.Failed, s.Errors, s.PerSecond)
+		if len(s.Buckets) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "  latency mean %v, p50 %v, p90 %v, p99 %v, max %v\n", round(s.Mean), round(s.P50), round(s.P90), round(s.P99), round(s.Max))
+		var most int64
+		for _, b := range s.Buckets {
+			if b.Count > most {
+				most = b.Count
+			}
+		}
+		for _, b := range s.Buckets {
+			le := "+Inf"
+			if b.UpperBound > 0 {
+				le = b.UpperBound.String()
+			}
+			fmt.Fprintf(w, "  <= %-10v %8v %v\n", le, b.Count, strings.Repeat("#", int(40*b.Count/most)))
+		}
+	}
+	var rate float64
+	if r.Elapsed > 0 {
+		rate = float64(r.Sessions) / r.Elapsed.Seconds()
+	}
+	fmt.Fprintf(w, "%v sessions against [%v] from %v clients in %v, %.1f/s, %v errors\n", r.Sessions, r.Server, r.Clients, r.Elapsed.Round(time.Millisecond), rate, r.Errors)
+}
+
+// round shortens latencies for display
+func round(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,119 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main replays the accounting log of the local accounter against a tacacs server, for
+// load testing and validating a migration to another accounting sink
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+var (
+	in          = flag.String("in", "/tmp/tacquito_accounting.log", "the accounting log to replay, - reads stdin")
+	network     = flag.String("network", "tcp6", "connect over tcp or tcp6")
+	address     = flag.String("address", ":2046", "the address:port of the server to replay to")
+	secret      = flag.String("secret", "fooman", "the tacacs secret to be used")
+	rate        = flag.Float64("rate", 100, "the records sent a second; 0 sends as fast as the server replies")
+	concurrency = flag.Int("concurrency", 8, "the records that may wait for a reply at once")
+	connections = flag.Int("connections", 2, "the connections opened to the server; servers that decline single-connect carry one record per connection at a time")
+	timeout     = flag.Duration("timeout", 10*time.Second, "how long each record may wait for a reply; 0 waits forever")
+	progress    = flag.Duration("progress", 5*time.Second, "how often progress is written to stderr; 0 disables")
+	verbose     = flag.Bool("v", false, "write every record that is not replayed successfully to stderr")
+)
+
+func main() {
+	flag.Parse()
+	if *concurrency < 1 || *connections < 1 || *rate < 0 {
+		fmt.Fprintf(os.Stderr, "-concurrency and -connections must be positive, and -rate cannot be negative\n")
+		os.Exit(2)
+	}
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		defer f.Close()
+		r = f
+	}
+	pool, err := tq.NewClientPool(*network, []string{*address}, []byte(*secret), tq.SetClientPoolSize(*connections))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	defer pool.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	rp := &replayer{
+		sender:      pool,
+		rate:        *rate,
+		concurrency: *concurrency,
+		timeout:     *timeout,
+		errorf:      func(string, ...interface{}) {},
+	}
+	if *verbose {
+		rp.errorf = func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		}
+	}
+
+	started := time.Now()
+	if *progress > 0 {
+		ticker := time.NewTicker(*progress)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				fmt.Fprintf(os.Stderr, "%v, %.1f/s\n", &rp.counters, perSecond(&rp.counters, started))
+			}
+		}()
+	}
+	records := make(chan record, *concurrency)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rp.replay(ctx, records)
+	}()
+	skipped, err := readRecords(r, func(rec record) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case records <- rec:
+			return nil
+		}
+	})
+	close(records)
+	<-done
+	fmt.Printf("%v, skipped %v, in %v, %.1f/s\n", &rp.counters, skipped, time.Since(started).Round(time.Millisecond), perSecond(&rp.counters, started))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay stopped; %v\n", err)
+		os.Exit(2)
+	}
+	if c := rp.load(); c.success != c.sent {
+		os.Exit(1)
+	}
+}
+
+// perSecond is the rate records have been sent at since started
+func perSecond(c *counters, started time.Time) float64 {
+	elapsed := time.Since(started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(c.load().sent) / elapsed
+}
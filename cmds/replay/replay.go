@@ -0,0 +1,196 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// record is an accounting request read from the log, and the line it is on
+type record struct {
+	line int
+	body tq.AcctRequest
+}
+
+// readRecords reads the log lines of the local accounter from r and calls fn with each accounting
+// request.  Any prefix the log sink adds before the record, such as a timestamp, is ignored, hash
+// chained records are unwrapped, and lines that are not accounting requests, eg task summaries, are
+// skipped and counted.
+func readRecords(r io.Reader, fn func(record) error) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var line, skipped int
+	for scanner.Scan() {
+		line++
+		text := scanner.Bytes()
+		start := bytes.IndexByte(text, '{')
+		if start < 0 {
+			skipped++
+			continue
+		}
+		body, ok, err := decode(text[start:])
+		if err != nil {
+			return skipped, fmt.Errorf("line [%v] is not a json record; %v", line, err)
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+		if err := fn(record{line: line, body: body}); err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, scanner.Err()
+}
+
+// decode returns the accounting request encoded in b, false if b holds another kind of record
+func decode(b []byte) (tq.AcctRequest, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return tq.AcctRequest{}, false, err
+	}
+	if chained, ok := fields["record"]; ok && fields["hash"] != nil {
+		return decode(chained)
+	}
+	if _, ok := fields["Flags"]; !ok {
+		return tq.AcctRequest{}, false, nil
+	}
+	// metadata the server enriched the record with is not part of the request
+	var r tq.AcctRecord
+	if err := json.Unmarshal(b, &r); err != nil {
+		return tq.AcctRequest{}, false, err
+	}
+	return r.AcctRequest, true, nil
+}
+
+// sender exchanges a packet with the target server
+type sender interface {
+	Send(ctx context.Context, packet *tq.Packet) (*tq.Packet, error)
+}
+
+// counters are the outcomes of the records replayed so far
+type counters struct {
+	sent    int64
+	success int64
+	// failed records were replied to with an error status, errored records were not replied to
+	failed  int64
+	errored int64
+}
+
+// load returns a copy of c that is safe to read
+func (c *counters) load() counters {
+	return counters{
+		sent:    atomic.LoadInt64(&c.sent),
+		success: atomic.LoadInt64(&c.success),
+		failed:  atomic.LoadInt64(&c.failed),
+		errored: atomic.LoadInt64(&c.errored),
+	}
+}
+
+func (c *counters) String() string {
+	l := c.load()
+	return fmt.Sprintf("sent %v, success %v, failed %v, errors %v", l.sent, l.success, l.failed, l.errored)
+}
+
+// replayer sends records to a server, at most rate a second from concurrency goroutines
+type replayer struct {
+	sender      sender
+	rate        float64
+	concurrency int
+	timeout     time.Duration
+	// errorf reports records that were not replayed successfully
+	errorf func(format string, args ...interface{})
+	counters
+}
+
+// replay sends every record received on records, returning once records is closed and every
+// record has been sent, or ctx is done
+func (r *replayer) replay(ctx context.Context, records <-chan record) {
+	var pace <-chan time.Time
+	if r.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / r.rate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+	paced := make(chan record)
+	var wg sync.WaitGroup
+	for i := 0; i < r.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range paced {
+				r.send(ctx, rec)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(paced)
+	for rec := range records {
+		if pace != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-pace:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case paced <- rec:
+		}
+	}
+}
+
+// send replays rec as a new accounting session
+func (r *replayer) send(ctx context.Context, rec record) {
+	atomic.AddInt64(&r.sent, 1)
+	b, err := rec.body.MarshalBinary()
+	if err != nil {
+		atomic.AddInt64(&r.errored, 1)
+		r.errorf("line [%v] cannot be encoded; %v", rec.line, err)
+		return
+	}
+	header := tq.NewHeader(
+		tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionDefault}),
+		tq.SetHeaderType(tq.Accounting),
+		tq.SetHeaderRandomSessionID(),
+	)
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	resp, err := r.sender.Send(ctx, tq.NewPacket(tq.SetPacketHeader(header), tq.SetPacketBody(b)))
+	if err != nil {
+		atomic.AddInt64(&r.errored, 1)
+		r.errorf("line [%v] was not replied to; %v", rec.line, err)
+		return
+	}
+	var reply tq.AcctReply
+	if err := tq.UnmarshalWithFlags(resp.Body, resp.Header.Flags, &reply); err != nil {
+		atomic.AddInt64(&r.errored, 1)
+		r.errorf("line [%v] reply cannot be decoded; %v", rec.line, err)
+		return
+	}
+	if reply.Status != tq.AcctReplyStatusSuccess {
+		atomic.AddInt64(&r.failed, 1)
+		r.errorf("line [%v] for user [%v] failed with [%v] %v", rec.line, rec.body.User, reply.Status, reply.ServerMsg)
+		return
+	}
+	atomic.AddInt64(&r.success, 1)
+}
@@ -0,0 +1,113 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer replies to accounting records, failing those of users in fail and not replying to
+// those of users in drop
+type fakeServer struct {
+	sync.Mutex
+	users      []string
+	fail, drop string
+}
+
+func (s *fakeServer) Send(ctx context.Context, packet *tq.Packet) (*tq.Packet, error) {
+	var body tq.AcctRequest
+	if err := tq.Unmarshal(packet.Body, &body); err != nil {
+		return nil, err
+	}
+	s.Lock()
+	s.users = append(s.users, string(body.User))
+	s.Unlock()
+	if string(body.User) == s.drop {
+		return nil, fmt.Errorf("connection reset")
+	}
+	status := tq.AcctReplyStatusSuccess
+	if string(body.User) == s.fail {
+		status = tq.AcctReplyStatusError
+	}
+	b, err := tq.NewAcctReply(tq.SetAcctReplyStatus(status)).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return tq.NewPacket(tq.SetPacketHeader(packet.Header), tq.SetPacketBody(b)), nil
+}
+
+func read(t *testing.T) ([]record, int) {
+	f, err := os.Open("testdata/accounting.log")
+	require.NoError(t, err)
+	defer f.Close()
+	var records []record
+	skipped, err := readRecords(f, func(r record) error {
+		records = append(records, r)
+		return nil
+	})
+	require.NoError(t, err)
+	return records, skipped
+}
+
+func TestReadRecords(t *testing.T) {
+	records, skipped := read(t)
+	// the task summary is not a request
+	assert.Equal(t, 1, skipped)
+	require.Len(t, records, 3)
+	for i, expected := range []struct {
+		line  int
+		user  string
+		flags tq.AcctRequestFlag
+	}{{1, "alice", tq.AcctFlagStart}, {2, "bob", tq.AcctFlagStop}, {3, "carol", tq.AcctFlagWatchdog}} {
+		assert.Equal(t, expected.line, records[i].line)
+		assert.Equal(t, tq.AuthenUser(expected.user), records[i].body.User)
+		assert.Equal(t, expected.flags, records[i].body.Flags)
+		assert.Equal(t, []string{"task_id=1", "service=shell", "cmd=show version"}, records[i].body.Args.Args())
+	}
+
+	_, err := readRecords(strings.NewReader("not json {\n"), func(record) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestReplay(t *testing.T) {
+	records, _ := read(t)
+	replay := func(rp *replayer) {
+		rp.concurrency, rp.errorf = 2, func(string, ...interface{}) {}
+		c := make(chan record, len(records))
+		for _, r := range records {
+			c <- r
+		}
+		close(c)
+		rp.replay(context.Background(), c)
+	}
+
+	s := &fakeServer{fail: "bob", drop: "carol"}
+	rp := &replayer{sender: s}
+	replay(rp)
+	assert.ElementsMatch(t, []string{"alice", "bob", "carol"}, s.users)
+	assert.Equal(t, counters{sent: 3, success: 1, failed: 1, errored: 1}, rp.load())
+
+	// records are paced by rate
+	s = &fakeServer{}
+	rp = &replayer{sender: s, rate: 20}
+	start := time.Now()
+	replay(rp)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, counters{sent: 3, success: 3}, rp.load())
+}
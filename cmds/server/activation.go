@@ -0,0 +1,117 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// activation holds the sockets passed by systemd socket activation, see sd_listen_fds(3).  Systemd
+// binds them, so the server may listen on privileged ports such as 49 without running as root.
+type activation struct {
+	files []*os.File
+	names []string
+	used  []bool
+}
+
+// systemdSockets returns the sockets passed to the process by systemd.  The LISTEN_* environment
+// is cleared so child processes do not inherit them.
+func systemdSockets() (*activation, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("no sockets were passed by systemd socket activation")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS [%v] passed by systemd socket activation", os.Getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	a := &activation{used: make([]bool, n)}
+	for i := 0; i < n; i++ {
+		// systemd names sockets without a FileDescriptorName after their unit
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		a.names = append(a.names, name)
+		a.files = append(a.files, os.NewFile(uintptr(listenFDsStart+i), name))
+	}
+	return a, nil
+}
+
+// listener returns the passed socket named name, or at index name if it is a number.  Names must
+// be unique, give each socket its own FileDescriptorName or use indexes otherwise.
+func (a *activation) listener(name string) (tq.DeadlineListener, error) {
+	i, err := a.index(name)
+	if err != nil {
+		return nil, err
+	}
+	if a.used[i] {
+		return nil, fmt.Errorf("systemd socket [%v] is used by more than one listener", name)
+	}
+	// FileListener duplicates the descriptor, the original is closed along with the unused ones
+	l, err := net.FileListener(a.files[i])
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket [%v] is not a listening socket; %v", name, err)
+	}
+	dl, ok := l.(tq.DeadlineListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("systemd socket [%v] must be a tcp or unix stream socket", name)
+	}
+	a.used[i] = true
+	return dl, nil
+}
+
+// index returns the index of the socket named name
+func (a *activation) index(name string) (int, error) {
+	if i, err := strconv.Atoi(name); err == nil {
+		if i < 0 || i >= len(a.files) {
+			return 0, fmt.Errorf("systemd socket index [%v] is out of range, [%v] sockets were passed", i, len(a.files))
+		}
+		return i, nil
+	}
+	found := -1
+	for i, n := range a.names {
+		if n != name {
+			continue
+		}
+		if found >= 0 {
+			return 0, fmt.Errorf("systemd socket name [%v] is shared by several sockets, set FileDescriptorName or use their index", name)
+		}
+		found = i
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("no systemd socket is named [%v], sockets passed are %v", name, a.names)
+	}
+	return found, nil
+}
+
+// closeUnused closes every passed descriptor, logging the sockets no listener uses
+func (a *activation) closeUnused(ctx context.Context, logger loggerProvider) {
+	for i, f := range a.files {
+		if !a.used[i] {
+			logger.Errorf(ctx, "systemd socket [%v] at index [%v] is not used by any -listen, closing it", a.names[i], i)
+		}
+		f.Close()
+	}
+}
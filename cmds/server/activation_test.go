@@ -0,0 +1,49 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivationIndex(t *testing.T) {
+	a := &activation{files: make([]*os.File, 3), names: []string{"tacquito.socket", "acct", "acct"}, used: make([]bool, 3)}
+	tests := []struct {
+		name string
+		want int
+		err  bool
+	}{
+		{name: "tacquito.socket", want: 0},
+		{name: "2", want: 2},
+		{name: "acct", err: true},
+		{name: "3", err: true},
+		{name: "-1", err: true},
+		{name: "missing", err: true},
+	}
+	for _, test := range tests {
+		got, err := a.index(test.name)
+		if test.err {
+			assert.Error(t, err, test.name)
+			continue
+		}
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.want, got, test.name)
+	}
+}
+
+func TestSystemdSocketsPID(t *testing.T) {
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	_, err := systemdSockets()
+	assert.Error(t, err)
+	_, ok := os.LookupEnv("LISTEN_FDS")
+	assert.False(t, ok)
+}
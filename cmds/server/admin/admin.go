@@ -0,0 +1,243 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package admin provides the http admin api for tacquito.  Every endpoint is registered with
+// the minimum Role required to call it.  Callers are authenticated by one or more
+// IdentityProviders (static tokens, mTLS identities or oidc) and every call, allowed or not, is
+// written to the audit log.
+//
+// By convention, endpoints that only read state require ReadOnly, operational actions such as
+// config reload and drain require Operator, and config mutations require Admin.
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/compat"
+)
+
+func init() {
+	tq.RegisterCapability(tq.CapabilityAdminAPI)
+}
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Record(ctx context.Context, r map[string]string, obscure ...string)
+}
+
+// contextKey is used to store the caller Identity on the request context
+type contextKey string
+
+const identityKey contextKey = "admin-identity"
+
+// IdentityFromContext returns the authenticated caller of an admin api request
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey).(Identity)
+	return id, ok
+}
+
+// StatsPath is where the runtime stats of the servers, a tq.Stats, are served
+const StatsPath = "/v1/stats"
+
+// Option is used to set optional behaviors on the admin server
+type Option func(s *Server)
+
+// SetIdentityProviders sets the providers consulted, in order, to authenticate callers
+func SetIdentityProviders(p ...IdentityProvider) Option {
+	return func(s *Server) {
+		s.providers = append(s.providers, p...)
+	}
+}
+
+// SetAuditor sets where audit records are written.  By default they are written via the
+// loggerProvider's Record method.
+func SetAuditor(a auditor) Option {
+	return func(s *Server) {
+		s.auditor = a
+	}
+}
+
+// auditor records admin actions
+type auditor interface {
+	Record(ctx context.Context, r map[string]string, obscure ...string)
+}
+
+// New creates an admin api server.  Without identity providers, every call is rejected.
+func New(l loggerProvider, opts ...Option) *Server {
+	s := &Server{loggerProvider: l, auditor: l, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Handle("/v1/whoami", "whoami", ReadOnly, http.HandlerFunc(whoami))
+	s.Handle("/v1/version", "version", ReadOnly, http.HandlerFunc(version))
+	return s
+}
+
+// Server is the admin api http.Handler
+type Server struct {
+	loggerProvider
+	auditor   auditor
+	providers []IdentityProvider
+	mux       *http.ServeMux
+}
+
+// Handle registers h at pattern.  action names the operation in audit records and role is the
+// minimum role required to call it.
+func (s *Server) Handle(pattern, action string, role Role, h http.Handler) {
+	s.mux.Handle(pattern, s.authorize(action, role, h))
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// identify walks the identity providers until one recognizes the request's credentials
+func (s *Server) identify(r *http.Request) (Identity, error) {
+	for _, p := range s.providers {
+		id, err := p.Identify(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return id, err
+	}
+	return Identity{}, ErrNoCredentials
+}
+
+// authorize wraps h with authentication, role checks and auditing
+func (s *Server) authorize(action string, role Role, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		record := map[string]string{
+			"admin-action":   action,
+			"admin-method":   r.Method,
+			"admin-path":     r.URL.Path,
+			"admin-remote":   r.RemoteAddr,
+			"admin-required": role.String(),
+		}
+		id, err := s.identify(r)
+		if err != nil {
+			adminUnauthenticated.Inc()
+			record["admin-result"] = "unauthenticated"
+			record["admin-reason"] = err.Error()
+			s.auditor.Record(r.Context(), record)
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		record["admin-identity"] = id.Name
+		record["admin-auth"] = id.Method
+		record["admin-role"] = id.Role.String()
+		if !id.Role.Allows(role) {
+			adminDenied.Inc()
+			record["admin-result"] = "denied"
+			s.auditor.Record(r.Context(), record)
+			http.Error(w, fmt.Sprintf("%v requires role %v", action, role), http.StatusForbidden)
+			return
+		}
+		adminAllowed.Inc()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), identityKey, id)))
+		record["admin-result"] = "allowed"
+		record["admin-status"] = strconv.Itoa(sw.status)
+		record["admin-duration-ms"] = strconv.FormatInt(time.Since(start).Milliseconds(), 10)
+		s.auditor.Record(r.Context(), record)
+	})
+}
+
+// ListenAndServe serves the admin api on address until ctx is cancelled.  If config is not nil
+// the listener uses tls; set config.ClientAuth to tls.RequireAndVerifyClientCert for mTLS identities.
+func (s *Server) ListenAndServe(ctx context.Context, address string, config *tls.Config) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		ln = tls.NewListener(ln, withHTTP2(config))
+	}
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	s.Infof(ctx, "starting admin api, listening [%v]", address)
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// withHTTP2 offers http/2, which grpc services mounted on the admin api require, unless config
+// already sets its protocols.  Configs returned per handshake, eg by a certificate reloader, are
+// covered too.
+func withHTTP2(config *tls.Config) *tls.Config {
+	protos := []string{"h2", "http/1.1"}
+	config = config.Clone()
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = protos
+	}
+	if get := config.GetConfigForClient; get != nil {
+		config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := get(hello)
+			if c != nil && len(c.NextProtos) == 0 {
+				c = c.Clone()
+				c.NextProtos = protos
+			}
+			return c, err
+		}
+	}
+	return config
+}
+
+// statusWriter captures the status code written by a handler for auditing
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// whoami reports the caller's identity and role
+func whoami(w http.ResponseWriter, r *http.Request) {
+	id, _ := IdentityFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Identity
+		Role string `json:"role"`
+	}{Identity: id, Role: id.Role.String()})
+}
+
+// VersionInfo is the body returned by /v1/version
+type VersionInfo struct {
+	Version      string          `json:"version"`
+	Capabilities []tq.Capability `json:"capabilities"`
+	// Deprecations are the deprecated apis this process has constructed
+	Deprecations []compat.Deprecation `json:"deprecations,omitempty"`
+}
+
+// version reports the release version and capabilities of this build, and the deprecated apis
+// it uses
+func version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VersionInfo{Version: tq.ReleaseVersion(), Capabilities: tq.Capabilities(), Deprecations: compat.Used()})
+}
@@ -0,0 +1,157 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/compat"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLogger struct {
+	records []map[string]string
+}
+
+func (m *mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (m *mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (m *mockLogger) Record(ctx context.Context, r map[string]string, obscure ...string) {
+	m.records = append(m.records, r)
+}
+
+type mockVerifier struct{}
+
+func (mockVerifier) Verify(ctx context.Context, raw string) (string, map[string]interface{}, error) {
+	if raw != "oidc-token" {
+		return "", nil, fmt.Errorf("bad signature")
+	}
+	return "alice@example.com", map[string]interface{}{"groups": []interface{}{"netops", "netops-oncall"}}, nil
+}
+
+func TestAuthorization(t *testing.T) {
+	logger := &mockLogger{}
+	s := New(logger, SetIdentityProviders(
+		NewStaticTokens(map[string]Identity{
+			"ro-token": {Name: "dashboard", Role: ReadOnly},
+			"op-token": {Name: "oncall", Role: Operator},
+		}),
+		NewCertIdentities(map[string]Role{"admin.example.com": Admin}),
+		NewOIDC(mockVerifier{}, "groups", map[string]Role{"netops": ReadOnly, "netops-oncall": Operator}),
+	))
+	s.Handle("/v1/reload", "reload", Operator, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFromContext(r.Context())
+		assert.True(t, ok)
+		fmt.Fprint(w, id.Name)
+	}))
+
+	adminCert := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "admin.example.com"}}}}}
+	strangerCert := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "stranger"}}}}}
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		tls      *tls.ConnectionState
+		expected int
+		result   string
+	}{
+		{name: "no credentials", path: "/v1/whoami", expected: http.StatusUnauthorized, result: "unauthenticated"},
+		{name: "unknown token", path: "/v1/whoami", token: "nope", expected: http.StatusUnauthorized, result: "unauthenticated"},
+		{name: "read-only whoami", path: "/v1/whoami", token: "ro-token", expected: http.StatusOK, result: "allowed"},
+		{name: "read-only reload", path: "/v1/reload", token: "ro-token", expected: http.StatusForbidden, result: "denied"},
+		{name: "operator reload", path: "/v1/reload", token: "op-token", expected: http.StatusOK, result: "allowed"},
+		{name: "mtls admin reload", path: "/v1/reload", tls: adminCert, expected: http.StatusOK, result: "allowed"},
+		{name: "mtls unmapped", path: "/v1/reload", tls: strangerCert, expected: http.StatusUnauthorized, result: "unauthenticated"},
+		{name: "oidc operator reload", path: "/v1/reload", token: "oidc-token", expected: http.StatusOK, result: "allowed"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, test.path, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		r.TLS = test.tls
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, test.expected, w.Code, test.name)
+		if assert.NotEmpty(t, logger.records, test.name) {
+			last := logger.records[len(logger.records)-1]
+			assert.Equal(t, test.result, last["admin-result"], test.name)
+		}
+	}
+	assert.Len(t, logger.records, len(tests), "every call is audited")
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/whoami", nil)
+	r.Header.Set("Authorization", "Bearer op-token")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.True(t, strings.Contains(w.Body.String(), `"role":"operator"`), w.Body.String())
+}
+
+func TestRoles(t *testing.T) {
+	assert.True(t, Admin.Allows(Operator))
+	assert.True(t, Operator.Allows(Operator))
+	assert.False(t, ReadOnly.Allows(Operator))
+	assert.False(t, Admin.Allows(None), "endpoints must declare a role")
+	for _, v := range []string{"read-only", "operator", "admin"} {
+		role, err := ParseRole(v)
+		assert.NoError(t, err)
+		assert.Equal(t, v, role.String())
+	}
+	_, err := ParseRole("root")
+	assert.Error(t, err)
+}
+
+func TestVersion(t *testing.T) {
+	s := New(&mockLogger{}, SetIdentityProviders(NewStaticTokens(map[string]Identity{"ro-token": {Name: "dashboard", Role: ReadOnly}})))
+	r := httptest.NewRequest(http.MethodGet, "/v1/version", nil)
+	r.Header.Set("Authorization", "Bearer ro-token")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var info VersionInfo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, tq.ReleaseVersion(), info.Version)
+	assert.Contains(t, info.Capabilities, tq.CapabilityAdminAPI)
+	assert.Contains(t, info.Capabilities, tq.CapabilitySingleConnect)
+	assert.Empty(t, info.Deprecations)
+
+	// deprecated apis constructed by the process are reported
+	old := compat.Deprecation{API: "tq.Old", Since: "v0.6.0", Replacement: "tq.New"}
+	compat.Warn(context.Background(), nil, old)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, []compat.Deprecation{old}, info.Deprecations)
+}
+
+func TestWithHTTP2(t *testing.T) {
+	protos := []string{"h2", "http/1.1"}
+	c := withHTTP2(&tls.Config{})
+	assert.Equal(t, protos, c.NextProtos)
+	c = withHTTP2(&tls.Config{NextProtos: []string{"http/1.1"}})
+	assert.Equal(t, []string{"http/1.1"}, c.NextProtos)
+
+	// configs chosen per handshake offer http/2 too
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	c = withHTTP2(&tls.Config{GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) { return base, nil }})
+	hc, err := c.GetConfigForClient(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, protos, hc.NextProtos)
+	assert.Equal(t, uint16(tls.VersionTLS12), hc.MinVersion)
+	assert.Empty(t, base.NextProtos)
+}
@@ -0,0 +1,245 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package admin
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ErrNoCredentials is returned by an IdentityProvider when the request does not carry the
+// credential type it handles.  The next provider is then consulted.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Identity is an authenticated caller of the admin api
+type Identity struct {
+	// Name identifies the caller in audit records
+	Name string `json:"name"`
+	// Role is the privilege granted to the caller
+	Role Role `json:"-"`
+	// Method is the credential type that produced this identity, eg token, mtls, oidc
+	Method string `json:"method"`
+}
+
+// IdentityProvider authenticates an admin api request.  Implementations return ErrNoCredentials
+// if the request does not contain their credential type, and any other error if the credential
+// is present but invalid.
+type IdentityProvider interface {
+	Identify(r *http.Request) (Identity, error)
+}
+
+// bearer returns the bearer token from an Authorization header
+func bearer(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[7:]), true
+}
+
+// NewStaticTokens creates a token IdentityProvider.  tokens maps a bearer token to the identity
+// it grants.
+func NewStaticTokens(tokens map[string]Identity) *StaticTokens {
+	s := &StaticTokens{}
+	for token, id := range tokens {
+		id.Method = "token"
+		s.tokens = append(s.tokens, staticToken{token: []byte(token), identity: id})
+	}
+	return s
+}
+
+// LoadStaticTokens reads a token file.  Each line holds a role, a name and a token separated by
+// whitespace.  Blank lines and lines starting with # are ignored.
+//
+//	operator oncall-bot 3f1c...
+func LoadStaticTokens(path string) (*StaticTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tokens := make(map[string]Identity)
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("admin token file [%v] line [%v] must be: role name token", path, line)
+		}
+		role, err := ParseRole(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("admin token file [%v] line [%v]; %v", path, line, err)
+		}
+		tokens[fields[2]] = Identity{Name: fields[1], Role: role}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewStaticTokens(tokens), nil
+}
+
+type staticToken struct {
+	token    []byte
+	identity Identity
+}
+
+// StaticTokens authenticates callers that present a known bearer token
+type StaticTokens struct {
+	tokens []staticToken
+}
+
+// Identify implements IdentityProvider.  Every token is compared in constant time.
+func (s *StaticTokens) Identify(r *http.Request) (Identity, error) {
+	token, ok := bearer(r)
+	if !ok {
+		return Identity{}, ErrNoCredentials
+	}
+	var found *Identity
+	for i := range s.tokens {
+		if subtle.ConstantTimeCompare(s.tokens[i].token, []byte(token)) == 1 {
+			found = &s.tokens[i].identity
+		}
+	}
+	if found == nil {
+		// the token may belong to another bearer provider, such as oidc
+		return Identity{}, fmt.Errorf("unknown bearer token; %w", ErrNoCredentials)
+	}
+	return *found, nil
+}
+
+// NewCertIdentities creates an mTLS IdentityProvider.  identities maps a verified client
+// certificate's subject common name, dns san or uri san to a role.  The admin listener must
+// be configured to require and verify client certificates.
+func NewCertIdentities(identities map[string]Role) *CertIdentities {
+	return &CertIdentities{identities: identities}
+}
+
+// LoadCertIdentities reads an identity file.  Each line holds a role and a certificate identity
+// separated by whitespace.  Blank lines and lines starting with # are ignored.
+//
+//	admin spiffe://example.com/netops/admin
+func LoadCertIdentities(path string) (*CertIdentities, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	identities := make(map[string]Role)
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("admin identity file [%v] line [%v] must be: role identity", path, line)
+		}
+		role, err := ParseRole(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("admin identity file [%v] line [%v]; %v", path, line, err)
+		}
+		identities[fields[1]] = role
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewCertIdentities(identities), nil
+}
+
+// CertIdentities authenticates callers by their verified client certificate
+type CertIdentities struct {
+	identities map[string]Role
+}
+
+// Identify implements IdentityProvider
+func (c *CertIdentities) Identify(r *http.Request) (Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	names := []string{leaf.Subject.CommonName}
+	names = append(names, leaf.DNSNames...)
+	for _, u := range leaf.URIs {
+		names = append(names, u.String())
+	}
+	for _, name := range names {
+		if role, ok := c.identities[name]; ok && name != "" {
+			return Identity{Name: name, Role: role, Method: "mtls"}, nil
+		}
+	}
+	return Identity{}, fmt.Errorf("client certificate [%v] is not mapped to a role", leaf.Subject.CommonName)
+}
+
+// TokenVerifier validates an oidc id token, including its signature, issuer, audience and
+// expiry, and returns its subject and claims.  A verifier backed by the issuer's discovery
+// document and jwks should be injected by the caller.
+type TokenVerifier interface {
+	Verify(ctx context.Context, rawToken string) (subject string, claims map[string]interface{}, err error)
+}
+
+// NewOIDC creates an oidc IdentityProvider.  claim names a string or string list claim, such as
+// groups, and roles maps values of that claim to a role.  The highest matching role is granted.
+func NewOIDC(v TokenVerifier, claim string, roles map[string]Role) *OIDC {
+	return &OIDC{verifier: v, claim: claim, roles: roles}
+}
+
+// OIDC authenticates callers that present an oidc id token as a bearer token
+type OIDC struct {
+	verifier TokenVerifier
+	claim    string
+	roles    map[string]Role
+}
+
+// Identify implements IdentityProvider
+func (o *OIDC) Identify(r *http.Request) (Identity, error) {
+	token, ok := bearer(r)
+	if !ok {
+		return Identity{}, ErrNoCredentials
+	}
+	subject, claims, err := o.verifier.Verify(r.Context(), token)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid oidc token; %v", err)
+	}
+	var values []string
+	switch v := claims[o.claim].(type) {
+	case string:
+		values = []string{v}
+	case []string:
+		values = v
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	id := Identity{Name: subject, Method: "oidc"}
+	for _, value := range values {
+		if role := o.roles[value]; role > id.Role {
+			id.Role = role
+		}
+	}
+	if id.Role == None {
+		return Identity{}, fmt.Errorf("oidc subject [%v] has no admin role", subject)
+	}
+	return id, nil
+}
@@ -0,0 +1,61 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package admin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Role is an ordered privilege level on the admin api.  A role is granted every
+// action available to the roles below it.
+type Role int
+
+const (
+	// None grants nothing; it is the zero value of Role
+	None Role = 0
+	// ReadOnly may inspect state such as config, sessions and stats
+	ReadOnly Role = 1
+	// Operator may additionally perform operational actions such as config reload and drain
+	Operator Role = 2
+	// Admin may additionally modify config
+	Admin Role = 3
+)
+
+// String returns the role as a string
+func (r Role) String() string {
+	switch r {
+	case None:
+		return "none"
+	case ReadOnly:
+		return "read-only"
+	case Operator:
+		return "operator"
+	case Admin:
+		return "admin"
+	}
+	return fmt.Sprintf("unknown role[%d]", int(r))
+}
+
+// Allows reports whether r is at least required
+func (r Role) Allows(required Role) bool {
+	return required > None && r >= required
+}
+
+// ParseRole converts a role name into a Role
+func ParseRole(v string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "read-only", "readonly", "ro":
+		return ReadOnly, nil
+	case "operator", "op":
+		return Operator, nil
+	case "admin":
+		return Admin, nil
+	}
+	return None, fmt.Errorf("unknown admin role [%v]", v)
+}
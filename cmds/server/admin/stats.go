@@ -0,0 +1,36 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package admin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	adminAllowed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "admin_request_allowed",
+		Help:      "number of admin api requests that passed authorization",
+	})
+	adminDenied = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "admin_request_denied",
+		Help:      "number of admin api requests rejected for insufficient role",
+	})
+	adminUnauthenticated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "admin_request_unauthenticated",
+		Help:      "number of admin api requests without valid credentials",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(adminAllowed)
+	prometheus.MustRegister(adminDenied)
+	prometheus.MustRegister(adminUnauthenticated)
+}
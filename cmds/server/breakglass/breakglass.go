@@ -0,0 +1,415 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package breakglass serves the admin api endpoints that inspect and change the running config,
+// for when the config pipeline is down.  Users and scopes are added, replaced and disabled in the
+// loader's overlay, which is layered on every config the loader builds until it is cleared; the
+// config file itself is never written.  Changes that introduce config errors are rejected.
+//
+// Endpoints that only read require admin.ReadOnly, reloading the config requires admin.Operator
+// and every change requires admin.Admin.  Option values of authenticators, accounters,
+// authorizers, handlers and scopes, and the keychain keys of scopes, are redacted from
+// responses, as they may hold hashes or credentials.
+package breakglass
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/facebookincubator/tacquito/cmds/server/admin"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+)
+
+const (
+	// ScopesPath lists the scopes being served
+	ScopesPath = "/v1/scopes"
+	// SetScopePath adds or replaces the scope in the request body
+	SetScopePath = "/v1/scopes/set"
+	// RemoveScopePath removes the scope query parameter from the overlay
+	RemoveScopePath = "/v1/scopes/remove"
+	// EffectiveUserPath reports the user query parameter as it is served in each of its scopes
+	EffectiveUserPath = "/v1/users/effective"
+	// SetUserPath adds or replaces the user in the request body
+	SetUserPath = "/v1/users/set"
+	// RemoveUserPath removes the user query parameter from the overlay
+	RemoveUserPath = "/v1/users/remove"
+	// DisableUserPath stops serving the user query parameter
+	DisableUserPath = "/v1/users/disable"
+	// EnableUserPath serves a disabled user query parameter again
+	EnableUserPath = "/v1/users/enable"
+	// OverlayPath lists every runtime change
+	OverlayPath = "/v1/overlay"
+	// ClearOverlayPath drops every runtime change
+	ClearOverlayPath = "/v1/overlay/clear"
+	// ReloadPath loads the config from its source again
+	ReloadPath = "/v1/reload"
+)
+
+// maxBodySize bounds the size of a user or scope in a request body
+const maxBodySize = 1 << 20
+
+// redacted replaces option values in responses
+const redacted = "redacted"
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+// store holds the running config and its overlay, *loader.Loader implements it
+type store interface {
+	Snapshot(ctx context.Context) (loader.Snapshot, error)
+	Effective(c config.ServerConfig, name string) []loader.EffectiveUser
+	SetUser(ctx context.Context, u config.User) (loader.PushResult, error)
+	RemoveUser(ctx context.Context, name string) (loader.PushResult, error)
+	DisableUser(ctx context.Context, name string) (loader.PushResult, error)
+	EnableUser(ctx context.Context, name string) (loader.PushResult, error)
+	SetSecret(ctx context.Context, s config.SecretConfig) (loader.PushResult, error)
+	RemoveSecret(ctx context.Context, name string) (loader.PushResult, error)
+	ClearOverlay(ctx context.Context) (loader.PushResult, error)
+	Reload() error
+}
+
+// registrar registers endpoints, *admin.Server implements it
+type registrar interface {
+	Handle(pattern, action string, role admin.Role, h http.Handler)
+}
+
+// New returns the break glass endpoints, which change the config held by s
+func New(l loggerProvider, s store) *Service {
+	return &Service{loggerProvider: l, store: s}
+}
+
+// Service serves the break glass endpoints
+type Service struct {
+	loggerProvider
+	store store
+}
+
+// Register registers every endpoint on api with the role it requires
+func (s *Service) Register(api registrar) {
+	api.Handle(ScopesPath, "scope-list", admin.ReadOnly, http.HandlerFunc(s.serveScopes))
+	api.Handle(SetScopePath, "scope-set", admin.Admin, http.HandlerFunc(s.serveSetScope))
+	api.Handle(RemoveScopePath, "scope-remove", admin.Admin, s.byName("scope", "remove", s.store.RemoveSecret))
+	api.Handle(EffectiveUserPath, "user-effective", admin.ReadOnly, http.HandlerFunc(s.serveEffectiveUser))
+	api.Handle(SetUserPath, "user-set", admin.Admin, http.HandlerFunc(s.serveSetUser))
+	api.Handle(RemoveUserPath, "user-remove", admin.Admin, s.byName("user", "remove", s.store.RemoveUser))
+	api.Handle(DisableUserPath, "user-disable", admin.Admin, s.byName("user", "disable", s.store.DisableUser))
+	api.Handle(EnableUserPath, "user-enable", admin.Admin, s.byName("user", "enable", s.store.EnableUser))
+	api.Handle(OverlayPath, "overlay-list", admin.ReadOnly, http.HandlerFunc(s.serveOverlay))
+	api.Handle(ClearOverlayPath, "overlay-clear", admin.Admin, http.HandlerFunc(s.serveClearOverlay))
+	api.Handle(ReloadPath, "config-reload", admin.Operator, http.HandlerFunc(s.serveReload))
+}
+
+// Scope is a scope being served, as listed by ScopesPath
+type Scope struct {
+	Name    string              `json:"name"`
+	Type    config.ProviderType `json:"type"`
+	Handler config.HandlerType  `json:"handler"`
+	// Overlay is true if the scope was set at runtime
+	Overlay bool `json:"overlay,omitempty"`
+}
+
+// Result is the response to a change
+type Result struct {
+	Applied     bool         `json:"applied"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// Diagnostic is a problem found validating a change
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (s *Service) serveScopes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	snapshot, err := s.store.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	overlay := map[string]bool{}
+	for _, sc := range snapshot.Overlay.Secrets {
+		overlay[sc.Name] = true
+	}
+	scopes := make([]Scope, 0, len(snapshot.Config.Secrets))
+	for _, sc := range snapshot.Config.Secrets {
+		scopes = append(scopes, Scope{Name: sc.Name, Type: sc.Type, Handler: sc.Handler.Type, Overlay: overlay[sc.Name]})
+	}
+	writeJSON(w, http.StatusOK, scopes)
+}
+
+func (s *Service) serveEffectiveUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("user")
+	if name == "" {
+		http.Error(w, "the user query parameter is required", http.StatusBadRequest)
+		return
+	}
+	snapshot, err := s.store.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	effective := s.store.Effective(snapshot.Config, name)
+	if len(effective) == 0 {
+		for _, d := range snapshot.Overlay.Disabled {
+			if d == name {
+				http.Error(w, fmt.Sprintf("user [%v] is disabled", name), http.StatusNotFound)
+				return
+			}
+		}
+		http.Error(w, fmt.Sprintf("user [%v] is not served in any scope", name), http.StatusNotFound)
+		return
+	}
+	for i := range effective {
+		effective[i].User = redactUser(effective[i].User)
+	}
+	writeJSON(w, http.StatusOK, effective)
+}
+
+func (s *Service) serveOverlay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	snapshot, err := s.store.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	o := snapshot.Overlay
+	users := make([]config.User, 0, len(o.Users))
+	for _, u := range o.Users {
+		users = append(users, redactUser(u))
+	}
+	secrets := make([]config.SecretConfig, 0, len(o.Secrets))
+	for _, sc := range o.Secrets {
+		secrets = append(secrets, redactScope(sc))
+	}
+	o.Users, o.Secrets = users, secrets
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (s *Service) serveSetUser(w http.ResponseWriter, r *http.Request) {
+	var u config.User
+	if !decode(w, r, &u) {
+		return
+	}
+	result, err := s.store.SetUser(r.Context(), u)
+	s.reply(w, r, fmt.Sprintf("set user [%v]", u.Name), result, err)
+}
+
+func (s *Service) serveSetScope(w http.ResponseWriter, r *http.Request) {
+	var sc config.SecretConfig
+	if !decode(w, r, &sc) {
+		return
+	}
+	result, err := s.store.SetSecret(r.Context(), sc)
+	s.reply(w, r, fmt.Sprintf("set scope [%v]", sc.Name), result, err)
+}
+
+func (s *Service) serveClearOverlay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	result, err := s.store.ClearOverlay(r.Context())
+	s.reply(w, r, "clear overlay", result, err)
+}
+
+func (s *Service) serveReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.store.Reload(); err != nil {
+		breakglassReloadError.Inc()
+		s.Errorf(r.Context(), "config reload requested by the admin api failed; %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.Infof(r.Context(), "config reloaded by the admin api")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// byName serves the change, described by verb, of the key query parameter
+func (s *Service) byName(key, verb string, change func(ctx context.Context, name string) (loader.PushResult, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := r.URL.Query().Get(key)
+		if name == "" {
+			http.Error(w, fmt.Sprintf("the %v query parameter is required", key), http.StatusBadRequest)
+			return
+		}
+		result, err := change(r.Context(), name)
+		s.reply(w, r, fmt.Sprintf("%v %v [%v]", verb, key, name), result, err)
+	})
+}
+
+// reply writes the result of the change described by what
+func (s *Service) reply(w http.ResponseWriter, r *http.Request, what string, result loader.PushResult, err error) {
+	if err != nil {
+		breakglassChangeError.Inc()
+		if errors.Is(err, loader.ErrNotInOverlay) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := Result{Applied: result.Applied}
+	for _, d := range result.Diagnostics {
+		resp.Diagnostics = append(resp.Diagnostics, Diagnostic{Severity: d.Severity.String(), Message: d.Message})
+	}
+	if !result.Applied {
+		breakglassChangeRejected.Inc()
+		s.Infof(r.Context(), "admin api change not applied, it introduces errors; %v", what)
+		writeJSON(w, http.StatusUnprocessableEntity, resp)
+		return
+	}
+	breakglassChangeApplied.Inc()
+	s.Infof(r.Context(), "admin api change applied; %v", what)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// decode reads the json request body into v, replying with an error if it cannot
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	d := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		breakglassChangeError.Inc()
+		http.Error(w, fmt.Sprintf("unable to decode request body; %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// redactOptions returns a copy of options with every value redacted
+func redactOptions(options map[string]string) map[string]string {
+	if options == nil {
+		return nil
+	}
+	r := make(map[string]string, len(options))
+	for k := range options {
+		r[k] = redacted
+	}
+	return r
+}
+
+func redactAuthenticator(a *config.Authenticator) *config.Authenticator {
+	if a == nil {
+		return nil
+	}
+	r := *a
+	r.Options = redactOptions(a.Options)
+	return &r
+}
+
+func redactAccounter(a *config.Accounter) *config.Accounter {
+	if a == nil {
+		return nil
+	}
+	r := *a
+	r.Options = redactOptions(a.Options)
+	return &r
+}
+
+func redactAuthorizer(a *config.Authorizer) *config.Authorizer {
+	if a == nil {
+		return nil
+	}
+	r := *a
+	r.Options = redactOptions(a.Options)
+	return &r
+}
+
+func redactGroup(g config.Group) config.Group {
+	g.Authenticator = redactAuthenticator(g.Authenticator)
+	g.Enable = redactAuthenticator(g.Enable)
+	g.Accounter = redactAccounter(g.Accounter)
+	g.Authorizer = redactAuthorizer(g.Authorizer)
+	if g.Groups != nil {
+		groups := make([]config.Group, 0, len(g.Groups))
+		for _, i := range g.Groups {
+			groups = append(groups, redactGroup(i))
+		}
+		g.Groups = groups
+	}
+	return g
+}
+
+// redactKeychain returns a copy of k without its key
+func redactKeychain(k *config.Keychain) *config.Keychain {
+	if k == nil {
+		return nil
+	}
+	r := *k
+	if r.Key != "" {
+		r.Key = redacted
+	}
+	return &r
+}
+
+// redactScope returns a copy of sc without its keys or option values, which may hold secrets
+func redactScope(sc config.SecretConfig) config.SecretConfig {
+	sc.Secret = *redactKeychain(&sc.Secret)
+	sc.SecondarySecret = redactKeychain(sc.SecondarySecret)
+	sc.Options = redactOptions(sc.Options)
+	sc.Handler.Options = redactOptions(sc.Handler.Options)
+	sc.Accounter = redactAccounter(sc.Accounter)
+	if sc.Budget != nil {
+		b := *sc.Budget
+		if b.FallbackKey != "" {
+			b.FallbackKey = redacted
+		}
+		sc.Budget = &b
+	}
+	return sc
+}
+
+// redactUser returns a copy of u without option values, which may hold hashes or credentials
+func redactUser(u config.User) config.User {
+	u.Authenticator = redactAuthenticator(u.Authenticator)
+	u.Enable = redactAuthenticator(u.Enable)
+	u.Accounter = redactAccounter(u.Accounter)
+	u.Authorizer = redactAuthorizer(u.Authorizer)
+	if u.Groups != nil {
+		groups := make([]config.Group, 0, len(u.Groups))
+		for _, g := range u.Groups {
+			groups = append(groups, redactGroup(g))
+		}
+		u.Groups = groups
+	}
+	return u
+}
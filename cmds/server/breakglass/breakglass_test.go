@@ -0,0 +1,188 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package breakglass
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/tacquito/cmds/server/admin"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// fakeStore applies changes to an overlay without validating them, users named bad are rejected
+type fakeStore struct {
+	config  config.ServerConfig
+	overlay loader.Overlay
+	reloads int
+}
+
+func (f *fakeStore) Snapshot(ctx context.Context) (loader.Snapshot, error) {
+	return loader.Snapshot{Config: f.config, Overlay: f.overlay}, nil
+}
+
+func (f *fakeStore) Effective(c config.ServerConfig, name string) []loader.EffectiveUser {
+	var effective []loader.EffectiveUser
+	for _, u := range c.Users {
+		if u.Name == name {
+			effective = append(effective, loader.EffectiveUser{Scope: u.Scopes[0], User: u})
+		}
+	}
+	return effective
+}
+
+func (f *fakeStore) SetUser(ctx context.Context, u config.User) (loader.PushResult, error) {
+	if u.Name == "bad" {
+		return loader.PushResult{Diagnostics: []loader.Diagnostic{{Severity: loader.SeverityError, Message: "bad user"}}}, nil
+	}
+	f.overlay.Users = append(f.overlay.Users, u)
+	f.config.Users = append(f.config.Users, u)
+	return loader.PushResult{Applied: true}, nil
+}
+
+func (f *fakeStore) RemoveUser(ctx context.Context, name string) (loader.PushResult, error) {
+	return loader.PushResult{}, fmt.Errorf("user [%v] %w", name, loader.ErrNotInOverlay)
+}
+
+func (f *fakeStore) DisableUser(ctx context.Context, name string) (loader.PushResult, error) {
+	f.overlay.Disabled = append(f.overlay.Disabled, name)
+	return loader.PushResult{Applied: true}, nil
+}
+
+func (f *fakeStore) EnableUser(ctx context.Context, name string) (loader.PushResult, error) {
+	return loader.PushResult{Applied: true}, nil
+}
+
+func (f *fakeStore) SetSecret(ctx context.Context, s config.SecretConfig) (loader.PushResult, error) {
+	f.overlay.Secrets = append(f.overlay.Secrets, s)
+	f.config.Secrets = append(f.config.Secrets, s)
+	return loader.PushResult{Applied: true}, nil
+}
+
+func (f *fakeStore) RemoveSecret(ctx context.Context, name string) (loader.PushResult, error) {
+	return loader.PushResult{Applied: true}, nil
+}
+
+func (f *fakeStore) ClearOverlay(ctx context.Context) (loader.PushResult, error) {
+	f.overlay = loader.Overlay{}
+	return loader.PushResult{Applied: true}, nil
+}
+
+func (f *fakeStore) Reload() error {
+	f.reloads++
+	return nil
+}
+
+// mux registers endpoints without authentication, recording the role each requires
+type mux struct {
+	*http.ServeMux
+	roles map[string]admin.Role
+}
+
+func (m mux) Handle(pattern, action string, role admin.Role, h http.Handler) {
+	m.roles[pattern] = role
+	m.ServeMux.Handle(pattern, h)
+}
+
+func serve(m mux, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestBreakGlass(t *testing.T) {
+	store := &fakeStore{config: config.ServerConfig{
+		Secrets: []config.SecretConfig{{Name: "lab", Type: config.PREFIX, Handler: config.Handler{Type: config.START}}},
+		Users: []config.User{{
+			Name:          "alice",
+			Scopes:        []string{"lab"},
+			Authenticator: &config.Authenticator{Type: config.BCRYPT, Options: map[string]string{"hash": "$2a$10$secret"}},
+			Groups:        []config.Group{{Name: "noc", Accounter: &config.Accounter{Type: config.FILE, Options: map[string]string{"token": "secret"}}}},
+		}},
+	}}
+	m := mux{ServeMux: http.NewServeMux(), roles: map[string]admin.Role{}}
+	New(mockLogger{}, store).Register(m)
+	assert.Equal(t, admin.ReadOnly, m.roles[EffectiveUserPath])
+	assert.Equal(t, admin.Operator, m.roles[ReloadPath])
+	assert.Equal(t, admin.Admin, m.roles[SetUserPath])
+
+	w := serve(m, http.MethodGet, ScopesPath, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"name":"lab","type":1,"handler":1}]`, w.Body.String())
+
+	// option values are redacted
+	w = serve(m, http.MethodGet, EffectiveUserPath+"?user=alice", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+	var effective []loader.EffectiveUser
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &effective))
+	require.Len(t, effective, 1)
+	assert.Equal(t, map[string]string{"hash": redacted}, effective[0].User.Authenticator.Options)
+	assert.Equal(t, "$2a$10$secret", store.config.Users[0].Authenticator.Options["hash"])
+	assert.Equal(t, http.StatusNotFound, serve(m, http.MethodGet, EffectiveUserPath+"?user=bob", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(m, http.MethodGet, EffectiveUserPath, "").Code)
+
+	w = serve(m, http.MethodPost, SetUserPath, `{"name":"bob","scopes":["lab"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"applied":true}`, w.Body.String())
+	assert.Equal(t, http.StatusOK, serve(m, http.MethodGet, EffectiveUserPath+"?user=bob", "").Code)
+
+	w = serve(m, http.MethodPost, SetUserPath, `{"name":"bad"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{"applied":false,"diagnostics":[{"severity":"error","message":"bad user"}]}`, w.Body.String())
+	assert.Equal(t, http.StatusBadRequest, serve(m, http.MethodPost, SetUserPath, `{"name":"bob","scope":["lab"]}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(m, http.MethodGet, SetUserPath, "").Code)
+
+	assert.Equal(t, http.StatusOK, serve(m, http.MethodPost, DisableUserPath+"?user=alice", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(m, http.MethodPost, DisableUserPath, "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(m, http.MethodPost, RemoveUserPath+"?user=carol", "").Code)
+	assert.Equal(t, http.StatusOK, serve(m, http.MethodPost, SetScopePath, `{
+		"name":"dr","type":1,"handler":{"type":1,"options":{"token":"secret-handler"}},
+		"secret":{"group":"tacquito","key":"secret-key"},
+		"secondary_secret":{"group":"tacquito","key":"secret-secondary"},
+		"options":{"password":"secret-option"},
+		"budget":{"fallback_key":"secret-fallback"},
+		"accounter":{"name":"kafka","type":1,"options":{"sasl_password":"secret-accounter"}}
+	}`).Code)
+
+	w = serve(m, http.MethodGet, OverlayPath, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	// no key material or option value is returned
+	assert.NotContains(t, w.Body.String(), "secret-")
+	var o loader.Overlay
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &o))
+	require.Len(t, o.Secrets, 1)
+	assert.Equal(t, config.Keychain{Group: "tacquito", Key: redacted}, o.Secrets[0].Secret)
+	assert.Equal(t, map[string]string{"sasl_password": redacted}, o.Secrets[0].Accounter.Options)
+	assert.Equal(t, "secret-key", store.overlay.Secrets[0].Secret.Key)
+	assert.Len(t, o.Users, 1)
+	assert.Equal(t, []string{"alice"}, o.Disabled)
+	assert.Len(t, o.Secrets, 1)
+	w = serve(m, http.MethodGet, ScopesPath, "")
+	assert.JSONEq(t, `[{"name":"lab","type":1,"handler":1},{"name":"dr","type":1,"handler":1,"overlay":true}]`, w.Body.String())
+
+	assert.Equal(t, http.StatusOK, serve(m, http.MethodPost, ClearOverlayPath, "").Code)
+	assert.Equal(t, loader.Overlay{}, store.overlay)
+
+	assert.Equal(t, http.StatusNoContent, serve(m, http.MethodPost, ReloadPath, "").Code)
+	assert.Equal(t, 1, store.reloads)
+}
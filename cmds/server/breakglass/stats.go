@@ -0,0 +1,44 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package breakglass
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// gauges and counters
+	breakglassChangeApplied = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "breakglass_change_applied",
+		Help:      "number of admin api config changes applied",
+	})
+	breakglassChangeRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "breakglass_change_rejected",
+		Help:      "number of admin api config changes not applied as they introduce config errors",
+	})
+	breakglassChangeError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "breakglass_change_error",
+		Help:      "number of admin api config changes that failed before validation, eg undecodable requests",
+	})
+	breakglassReloadError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "breakglass_reload_error",
+		Help:      "number of config reloads requested through the admin api that failed",
+	})
+)
+
+func init() {
+	// gauges and counters
+	prometheus.MustRegister(breakglassChangeApplied)
+	prometheus.MustRegister(breakglassChangeRejected)
+	prometheus.MustRegister(breakglassChangeError)
+	prometheus.MustRegister(breakglassReloadError)
+}
@@ -8,6 +8,8 @@
 package config
 
 import (
+	"context"
+
 	tq "github.com/facebookincubator/tacquito"
 )
 
@@ -41,6 +43,13 @@ func SetAAAAuthenticator(h tq.Handler) AAAOption {
 	}
 }
 
+// SetAAAEnable sets the enable authenticator
+func SetAAAEnable(h tq.Handler) AAAOption {
+	return func(a *AAA) {
+		a.Enable = h
+	}
+}
+
 // SetAAAAuthorizer sets the authorizer
 func SetAAAAuthorizer(h tq.Handler) AAAOption {
 	return func(a *AAA) {
@@ -66,6 +75,10 @@ func NewAAA(opts ...AAAOption) *AAA {
 	for _, opt := range opts {
 		opt(a)
 	}
+	if a.Enable == nil {
+		// without a distinct enable authenticator, enable requests use the login authenticator
+		a.Enable = a.Authenticate
+	}
 	return a
 }
 
@@ -75,10 +88,22 @@ type AAA struct {
 	User
 	loggerProvider
 	Authenticate tq.Handler
+	Enable       tq.Handler
 	Authorizer   tq.Handler
 	Accounting   tq.Handler
 }
 
+// PasswordWriter is implemented by authenticators whose backend can change passwords, eg ldap or
+// sql.  Ascii chpass requests, and ascii logins by users who must change their password, walk the
+// user through a password change with it.
+type PasswordWriter interface {
+	// MustChangePassword reports if username must change their password before logging in
+	MustChangePassword(ctx context.Context, username string) bool
+	// ChangePassword replaces the password of username.  old is the current password, which the
+	// backend must verify.
+	ChangePassword(ctx context.Context, username, old, new string) error
+}
+
 type defaultAuthenticator struct{}
 
 // Authenticate default deny implementation
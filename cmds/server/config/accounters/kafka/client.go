@@ -0,0 +1,115 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+const clientID = "tacquito"
+
+// sasl mechanisms
+const (
+	saslPlain       = "PLAIN"
+	saslSCRAMSHA256 = "SCRAM-SHA-256"
+	saslSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+// client produces records to a single topic.  franz-go routes each record to its partition's
+// leader, refreshing metadata and retrying when partitions move.
+type client struct {
+	opts supportedOptions
+	kc   *kgo.Client
+}
+
+func newClient(ctx context.Context, l loggerProvider, opts supportedOptions, tlsConfig *tls.Config) (*client, error) {
+	kopts := []kgo.Opt{
+		kgo.WithLogger(logger{ctx: ctx, loggerProvider: l}),
+		kgo.SeedBrokers(opts.brokers()...),
+		kgo.ClientID(clientID),
+		kgo.DefaultProduceTopic(opts.topic),
+		kgo.ProduceRequestTimeout(opts.timeout),
+		// each record is small and is sent as soon as it is handled
+		kgo.ProducerBatchCompression(kgo.NoCompression()),
+		kgo.WithHooks(hooks{}),
+	}
+	if opts.acks == 1 {
+		// idempotent writes require acks from every in sync replica
+		kopts = append(kopts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	} else {
+		kopts = append(kopts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	}
+	if tlsConfig != nil {
+		kopts = append(kopts, kgo.DialTLSConfig(tlsConfig))
+	}
+	switch opts.saslMechanism {
+	case saslPlain:
+		kopts = append(kopts, kgo.SASL(plain.Auth{User: opts.saslUsername, Pass: opts.saslPassword}.AsMechanism()))
+	case saslSCRAMSHA256:
+		kopts = append(kopts, kgo.SASL(scram.Auth{User: opts.saslUsername, Pass: opts.saslPassword}.AsSha256Mechanism()))
+	case saslSCRAMSHA512:
+		kopts = append(kopts, kgo.SASL(scram.Auth{User: opts.saslUsername, Pass: opts.saslPassword}.AsSha512Mechanism()))
+	}
+	kc, err := kgo.NewClient(kopts...)
+	if err != nil {
+		return nil, err
+	}
+	return &client{opts: opts, kc: kc}, nil
+}
+
+// produce publishes a record and waits for kafka to acknowledge it.  Records with the same key,
+// eg a task, always land in the same partition, keeping them in order.
+func (c *client) produce(ctx context.Context, key, value []byte, t time.Time) error {
+	return c.kc.ProduceSync(ctx, &kgo.Record{Key: key, Value: value, Timestamp: t}).FirstErr()
+}
+
+// close closes every broker connection
+func (c *client) close() {
+	c.kc.Close()
+}
+
+// hooks count the client's metadata refreshes
+type hooks struct{}
+
+// OnBrokerWrite implements kgo.HookBrokerWrite
+func (hooks) OnBrokerWrite(meta kgo.BrokerMetadata, key int16, bytesWritten int, writeWait, timeToWrite time.Duration, err error) {
+	if key == (&kmsg.MetadataRequest{}).Key() && err == nil {
+		kafkaMetadataRefresh.Inc()
+	}
+}
+
+// logger logs the client's warnings and errors, such as unreachable brokers, which are retried
+// until a record times out, so would otherwise go unseen
+type logger struct {
+	ctx context.Context
+	loggerProvider
+}
+
+// Level implements kgo.Logger
+func (l logger) Level() kgo.LogLevel {
+	return kgo.LogLevelWarn
+}
+
+// Log implements kgo.Logger
+func (l logger) Log(level kgo.LogLevel, msg string, keyvals ...interface{}) {
+	for i := 1; i < len(keyvals); i += 2 {
+		if err, ok := keyvals[i].(error); ok && (errors.Is(err, kerr.SaslAuthenticationFailed) || errors.Is(err, kerr.UnsupportedSaslMechanism)) {
+			kafkaAuthError.Inc()
+		}
+	}
+	l.Errorf(l.ctx, "kafka client: %v %v", msg, keyvals)
+}
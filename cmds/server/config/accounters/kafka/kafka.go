@@ -0,0 +1,306 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package kafka supports publishing Accounting data in JSON format to a kafka topic with the
+// franz-go client.  Each record is acknowledged by kafka before the device is told accounting
+// succeeded.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// loggerProvider provides the logging implementation for local server events
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+const (
+	defaultTimeout = 5 * time.Second
+	// minTimeout is the shortest produce request timeout franz-go accepts
+	minTimeout = 100 * time.Millisecond
+	// acks -1 waits for every in sync replica
+	defaultAcks int16 = -1
+)
+
+// supportedOptions map will be unmarshaled into this type
+//
+// brokers - comma separated host:port bootstrap brokers, required
+// topic - the topic records are published to, required
+// acks - all (the default) or 1, the leader only
+// timeout - time to wait for each record to be acknowledged, a go duration, at least 100ms
+// tls - true to connect to brokers with tls
+// tls_ca - optional, a pem file of cas used to verify brokers, the system pool by default
+// tls_cert, tls_key - optional, a pem client certificate and key
+// tls_insecure_skip_verify - true disables broker certificate verification, for testing only
+// sasl_mechanism - optional, PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512
+// sasl_username, sasl_password - the sasl credentials
+func newSupportedOptions(options map[string]string) (supportedOptions, error) {
+	var brokers []string
+	for _, b := range strings.Split(options["brokers"], ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			brokers = append(brokers, b)
+		}
+	}
+	opts := supportedOptions{
+		brokerList:    strings.Join(brokers, ","),
+		topic:         options["topic"],
+		acks:          defaultAcks,
+		timeout:       defaultTimeout,
+		tlsCA:         options["tls_ca"],
+		tlsCert:       options["tls_cert"],
+		tlsKey:        options["tls_key"],
+		saslMechanism: strings.ToUpper(options["sasl_mechanism"]),
+		saslUsername:  options["sasl_username"],
+		saslPassword:  options["sasl_password"],
+	}
+	switch v := options["acks"]; v {
+	case "", "all", "-1":
+	case "1":
+		opts.acks = 1
+	default:
+		return opts, fmt.Errorf("invalid acks option [%v] for kafka accounter, must be all or 1", v)
+	}
+	if v, ok := options["timeout"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid timeout option [%v] for kafka accounter; %v", v, err)
+		}
+		opts.timeout = d
+	}
+	for _, b := range []struct {
+		name string
+		v    *bool
+	}{{"tls", &opts.tls}, {"tls_insecure_skip_verify", &opts.tlsInsecureSkipVerify}} {
+		if v, ok := options[b.name]; ok {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %v option [%v] for kafka accounter; %v", b.name, v, err)
+			}
+			*b.v = parsed
+		}
+	}
+	return opts, nil
+}
+
+// supportedOptions is comparable, so identically configured users share a client
+type supportedOptions struct {
+	brokerList            string
+	topic                 string
+	acks                  int16
+	timeout               time.Duration
+	tls                   bool
+	tlsCA                 string
+	tlsCert               string
+	tlsKey                string
+	tlsInsecureSkipVerify bool
+	saslMechanism         string
+	saslUsername          string
+	saslPassword          string
+}
+
+// brokers returns the bootstrap brokers
+func (s supportedOptions) brokers() []string {
+	return strings.Split(s.brokerList, ",")
+}
+
+func (s supportedOptions) validate() error {
+	if s.brokerList == "" {
+		return fmt.Errorf("missing required option [brokers] for kafka accounter")
+	}
+	for _, b := range s.brokers() {
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			return fmt.Errorf("invalid broker [%v] for kafka accounter; %v", b, err)
+		}
+	}
+	if s.topic == "" {
+		return fmt.Errorf("missing required option [topic] for kafka accounter")
+	}
+	if s.timeout < minTimeout {
+		return fmt.Errorf("timeout must be at least %v for kafka accounter", minTimeout)
+	}
+	if (s.tlsCert == "") != (s.tlsKey == "") {
+		return fmt.Errorf("tls_cert and tls_key must be set together for kafka accounter")
+	}
+	switch s.saslMechanism {
+	case "":
+	case saslPlain, saslSCRAMSHA256, saslSCRAMSHA512:
+		if s.saslUsername == "" {
+			return fmt.Errorf("missing required option [sasl_username] for kafka accounter")
+		}
+	default:
+		return fmt.Errorf("unsupported sasl_mechanism [%v] for kafka accounter", s.saslMechanism)
+	}
+	return nil
+}
+
+// tlsConfig builds the tls config for broker connections, or nil if tls is disabled
+func (s supportedOptions) tlsConfig() (*tls.Config, error) {
+	if !s.tls {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: s.tlsInsecureSkipVerify}
+	if s.tlsCA != "" {
+		pem, err := os.ReadFile(s.tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read tls_ca [%v]; %v", s.tlsCA, err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls_ca [%v]", s.tlsCA)
+		}
+	}
+	if s.tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(s.tlsCert, s.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load tls_cert and tls_key; %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// New kafka Accounter.  Broker connections are closed once ctx is done.
+func New(ctx context.Context, l loggerProvider) *Accounter {
+	a := &Accounter{ctx: ctx, loggerProvider: l, clients: &clients{m: make(map[supportedOptions]*client)}}
+	go func() {
+		<-ctx.Done()
+		a.clients.Lock()
+		defer a.clients.Unlock()
+		for _, c := range a.clients.m {
+			c.close()
+		}
+	}()
+	return a
+}
+
+// clients holds a client per distinct set of options.  A client survives config reloads.
+type clients struct {
+	sync.Mutex
+	m map[supportedOptions]*client
+}
+
+// Accounter publishes accounting records to kafka
+type Accounter struct {
+	loggerProvider
+	ctx     context.Context
+	clients *clients
+	client  *client
+}
+
+// New creates a new kafka accounter.  Invalid options are logged and produce an accounter that
+// replies with errors, since accounting would otherwise be silently lost.
+func (a Accounter) New(options map[string]string) tq.Handler {
+	opts, err := newSupportedOptions(options)
+	if err == nil {
+		err = opts.validate()
+	}
+	var tlsConfig *tls.Config
+	if err == nil {
+		tlsConfig, err = opts.tlsConfig()
+	}
+	if err != nil {
+		a.Errorf(a.ctx, "kafka accounter is unavailable; %v", err)
+		kafkaBadConfig.Inc()
+		return &Accounter{loggerProvider: a.loggerProvider, ctx: a.ctx}
+	}
+	a.clients.Lock()
+	defer a.clients.Unlock()
+	c, ok := a.clients.m[opts]
+	if !ok {
+		if c, err = newClient(a.ctx, a.loggerProvider, opts, tlsConfig); err != nil {
+			a.Errorf(a.ctx, "kafka accounter is unavailable; %v", err)
+			kafkaBadConfig.Inc()
+			return &Accounter{loggerProvider: a.loggerProvider, ctx: a.ctx}
+		}
+		a.clients.m[opts] = c
+	}
+	return &Accounter{loggerProvider: a.loggerProvider, ctx: a.ctx, client: c}
+}
+
+// Record is a single accounting record as published to kafka
+type Record struct {
+	Time time.Time `json:"time"`
+	// Client is the address of the device that sent the record
+	Client string         `json:"client,omitempty"`
+	Record tq.AcctRequest `json:"record"`
+	// Metadata are the fields the server enriched the record with, if any
+	Metadata tq.AcctMetadata `json:"metadata,omitempty"`
+}
+
+// Handle ...
+func (a Accounter) Handle(response tq.Response, request tq.Request) {
+	var body tq.AcctRequest
+	if err := request.Unmarshal(&body); err != nil {
+		response.Reply(
+			tq.NewAcctReply(
+				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+				tq.SetAcctReplyServerMsg("accounting failure"),
+			),
+		)
+		return
+	}
+	if a.client == nil {
+		response.Reply(
+			tq.NewAcctReply(
+				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+				tq.SetAcctReplyServerMsg("accounting is misconfigured"),
+			),
+		)
+		return
+	}
+	client, _ := request.Context.Value(tq.ContextConnRemoteAddr).(string)
+	now := time.Now()
+	value, err := json.Marshal(Record{Time: now, Client: client, Record: body, Metadata: tq.AcctMetadataFromContext(request.Context)})
+	if err != nil {
+		response.Reply(
+			tq.NewAcctReply(
+				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+				tq.SetAcctReplyServerMsg("failed to log accounting message"),
+			),
+		)
+		a.Errorf(request.Context, "failed to marshal accounting record: %v", err)
+		return
+	}
+	// the records of a task share a key, so they are published to a partition in order
+	key := client + "|" + body.Args.TaskID()
+	if body.Args.TaskID() == "" {
+		key = client + "|" + string(body.User)
+	}
+	ctx, cancel := context.WithTimeout(request.Context, a.client.opts.timeout)
+	defer cancel()
+	if err := a.client.produce(ctx, []byte(key), value, now); err != nil {
+		kafkaProduceError.Inc()
+		a.Errorf(request.Context, "failed to publish accounting record to kafka topic [%v]; %v", a.client.opts.topic, err)
+		response.Reply(
+			tq.NewAcctReply(
+				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+				tq.SetAcctReplyServerMsg("failed to log accounting message"),
+			),
+		)
+		return
+	}
+	kafkaProduced.Inc()
+	response.Reply(
+		tq.NewAcctReply(
+			tq.SetAcctReplyStatus(tq.AcctReplyStatusSuccess),
+		),
+	)
+}
@@ -0,0 +1,332 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// fakeBroker is a single node cluster with two partitions of one topic
+type fakeBroker struct {
+	t        *testing.T
+	listener net.Listener
+	topic    string
+	// plain if set, requires sasl plain authentication with these credentials
+	plain string
+	// failProduce is returned as the error code of the next produce requests
+	failProduce []int16
+
+	mu       sync.Mutex
+	records  map[int32][]string
+	keys     map[int32][]string
+	metadata int
+}
+
+func newFakeBroker(t *testing.T, topic, plain string) *fakeBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	b := &fakeBroker{t: t, listener: l, topic: topic, plain: plain, records: make(map[int32][]string), keys: make(map[int32][]string)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(c)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return b
+}
+
+// supported are the requests the fake broker answers
+var supported = []kmsg.Request{
+	&kmsg.ApiVersionsRequest{},
+	&kmsg.SASLHandshakeRequest{},
+	&kmsg.SASLAuthenticateRequest{},
+	&kmsg.MetadataRequest{},
+	&kmsg.InitProducerIDRequest{},
+	&kmsg.ProduceRequest{},
+}
+
+func (b *fakeBroker) serve(c net.Conn) {
+	defer c.Close()
+	authenticated := b.plain == ""
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(c, size[:]); err != nil {
+			return
+		}
+		msg := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(c, msg); err != nil {
+			return
+		}
+		// request header: key, version, correlation id, client id, then tags if flexible
+		key := int16(binary.BigEndian.Uint16(msg))
+		version := int16(binary.BigEndian.Uint16(msg[2:]))
+		correlationID := msg[4:8]
+		body := msg[10+int(binary.BigEndian.Uint16(msg[8:])):]
+		req := kmsg.RequestForKey(key)
+		if !assert.NotNil(b.t, req, "key %d", key) {
+			return
+		}
+		req.SetVersion(version)
+		if req.IsFlexible() {
+			_, n := binary.Uvarint(body)
+			body = body[n:]
+		}
+		require.NoError(b.t, req.ReadFrom(body))
+		resp := req.ResponseKind()
+		switch r := req.(type) {
+		case *kmsg.ApiVersionsRequest:
+			v := resp.(*kmsg.ApiVersionsResponse)
+			for _, s := range supported {
+				v.ApiKeys = append(v.ApiKeys, kmsg.ApiVersionsResponseApiKey{ApiKey: s.Key(), MaxVersion: s.MaxVersion()})
+			}
+		case *kmsg.SASLHandshakeRequest:
+			assert.Equal(b.t, saslPlain, r.Mechanism)
+			resp.(*kmsg.SASLHandshakeResponse).SupportedMechanisms = []string{saslPlain}
+		case *kmsg.SASLAuthenticateRequest:
+			if string(r.SASLAuthBytes) == b.plain {
+				authenticated = true
+			} else {
+				v := resp.(*kmsg.SASLAuthenticateResponse)
+				v.ErrorCode = kerr.SaslAuthenticationFailed.Code
+				v.ErrorMessage = kmsg.StringPtr("bad credentials")
+			}
+		case *kmsg.MetadataRequest:
+			if !authenticated {
+				return
+			}
+			b.mu.Lock()
+			b.metadata++
+			b.mu.Unlock()
+			host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+			p, _ := strconv.Atoi(port)
+			v := resp.(*kmsg.MetadataResponse)
+			v.Brokers = []kmsg.MetadataResponseBroker{{NodeID: 1, Host: host, Port: int32(p)}}
+			v.ControllerID = 1
+			topic := kmsg.NewMetadataResponseTopic()
+			topic.Topic = kmsg.StringPtr(b.topic)
+			for i := int32(0); i < 2; i++ {
+				partition := kmsg.NewMetadataResponseTopicPartition()
+				partition.Partition, partition.Leader, partition.Replicas, partition.ISR = i, 1, []int32{1}, []int32{1}
+				topic.Partitions = append(topic.Partitions, partition)
+			}
+			v.Topics = []kmsg.MetadataResponseTopic{topic}
+		case *kmsg.InitProducerIDRequest:
+			resp.(*kmsg.InitProducerIDResponse).ProducerID = 1
+		case *kmsg.ProduceRequest:
+			if !authenticated {
+				return
+			}
+			assert.Equal(b.t, int16(-1), r.Acks, "acks")
+			v := resp.(*kmsg.ProduceResponse)
+			for _, topic := range r.Topics {
+				rt := kmsg.NewProduceResponseTopic()
+				rt.Topic = topic.Topic
+				for _, partition := range topic.Partitions {
+					rp := kmsg.NewProduceResponseTopicPartition()
+					rp.Partition = partition.Partition
+					b.mu.Lock()
+					if len(b.failProduce) > 0 {
+						rp.ErrorCode, b.failProduce = b.failProduce[0], b.failProduce[1:]
+					} else {
+						keys, values := decodeBatch(b.t, partition.Records)
+						rp.BaseOffset = int64(len(b.records[partition.Partition]))
+						b.records[partition.Partition] = append(b.records[partition.Partition], values...)
+						b.keys[partition.Partition] = append(b.keys[partition.Partition], keys...)
+					}
+					b.mu.Unlock()
+					rt.Partitions = append(rt.Partitions, rp)
+				}
+				v.Topics = append(v.Topics, rt)
+			}
+		default:
+			return
+		}
+		// response header: correlation id, then tags if flexible, except for api versions
+		out := append([]byte{0, 0, 0, 0}, correlationID...)
+		if resp.IsFlexible() && key != (&kmsg.ApiVersionsRequest{}).Key() {
+			out = append(out, 0)
+		}
+		out = resp.AppendTo(out)
+		binary.BigEndian.PutUint32(out, uint32(len(out)-4))
+		if _, err := c.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+// decodeBatch checks the crc of a v2 record batch and returns its keys and values
+func decodeBatch(t *testing.T, records []byte) ([]string, []string) {
+	var batch kmsg.RecordBatch
+	require.NoError(t, batch.ReadFrom(records))
+	assert.Equal(t, int8(2), batch.Magic)
+	assert.Equal(t, int32(crc32.Checksum(records[21:], crc32.MakeTable(crc32.Castagnoli))), batch.CRC, "crc")
+	var keys, values []string
+	raw := batch.Records
+	for i := int32(0); i < batch.NumRecords; i++ {
+		length, n := binary.Varint(raw)
+		var r kmsg.Record
+		require.NoError(t, r.ReadFrom(raw[:n+int(length)]))
+		raw = raw[n+int(length):]
+		keys = append(keys, string(r.Key))
+		values = append(values, string(r.Value))
+	}
+	return keys, values
+}
+
+func (b *fakeBroker) all() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var all []string
+	for _, r := range b.records {
+		all = append(all, r...)
+	}
+	return all
+}
+
+func newRequest(t *testing.T, flags tq.AcctRequestFlag, taskID string) tq.Request {
+	b, err := tq.NewAcctRequest(
+		tq.SetAcctRequestFlag(flags),
+		tq.SetAcctRequestUser("mr_uses_group"),
+		tq.SetAcctRequestArgs(tq.Args{tq.Arg("task_id=" + taskID), "service=shell"}),
+	).MarshalBinary()
+	require.NoError(t, err)
+	return tq.Request{Body: b, Context: context.WithValue(context.Background(), tq.ContextConnRemoteAddr, "192.0.2.1")}
+}
+
+func handle(t *testing.T, h tq.Handler, request tq.Request) tq.AcctReplyStatus {
+	resp := &configtest.Response{}
+	h.Handle(resp, request)
+	require.NotNil(t, resp.Acct)
+	return resp.Acct.Status
+}
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]string
+		valid   bool
+	}{
+		{name: "defaults", options: map[string]string{"brokers": "k1:9092, k2:9092", "topic": "acct"}, valid: true},
+		{name: "sasl", options: map[string]string{"brokers": "k1:9092", "topic": "acct", "sasl_mechanism": "scram-sha-512", "sasl_username": "u"}, valid: true},
+		{name: "missing brokers", options: map[string]string{"topic": "acct"}},
+		{name: "missing port", options: map[string]string{"brokers": "k1", "topic": "acct"}},
+		{name: "missing topic", options: map[string]string{"brokers": "k1:9092"}},
+		{name: "short timeout", options: map[string]string{"brokers": "k1:9092", "topic": "acct", "timeout": "10ms"}},
+		{name: "bad acks", options: map[string]string{"brokers": "k1:9092", "topic": "acct", "acks": "0"}},
+		{name: "unknown sasl", options: map[string]string{"brokers": "k1:9092", "topic": "acct", "sasl_mechanism": "GSSAPI", "sasl_username": "u"}},
+		{name: "cert without key", options: map[string]string{"brokers": "k1:9092", "topic": "acct", "tls": "true", "tls_cert": "c.pem"}},
+	}
+	for _, test := range tests {
+		opts, err := newSupportedOptions(test.options)
+		if err == nil {
+			err = opts.validate()
+		}
+		assert.Equal(t, test.valid, err == nil, "%v; %v", test.name, err)
+	}
+}
+
+func TestProduce(t *testing.T) {
+	b := newFakeBroker(t, "acct", "\x00tacquito\x00secret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := New(ctx, mockLogger{})
+	options := map[string]string{"brokers": b.listener.Addr().String(), "topic": "acct", "sasl_mechanism": "plain", "sasl_username": "tacquito", "sasl_password": "secret"}
+	h := a.New(options)
+	assert.Same(t, h.(*Accounter).client, a.New(options).(*Accounter).client)
+
+	for _, flags := range []tq.AcctRequestFlag{tq.AcctFlagStart, tq.AcctFlagWatchdog, tq.AcctFlagStop} {
+		assert.Equal(t, tq.AcctReplyStatusSuccess, handle(t, h, newRequest(t, flags, "7")))
+	}
+	handle(t, h, newRequest(t, tq.AcctFlagStart, "8"))
+	records := b.all()
+	require.Len(t, records, 4)
+	var r Record
+	require.NoError(t, json.Unmarshal([]byte(records[0]), &r))
+	assert.Equal(t, "192.0.2.1", r.Client)
+	assert.Equal(t, tq.AuthenUser("mr_uses_group"), r.Record.User)
+	// every record of a task is in one partition
+	for _, keys := range b.keys {
+		for _, k := range keys {
+			if k == "192.0.2.1|7" {
+				assert.Equal(t, []string{k, k, k}, keys[:3])
+				break
+			}
+		}
+	}
+
+	// a moved partition refreshes metadata and retries
+	b.mu.Lock()
+	b.failProduce = []int16{kerr.NotLeaderForPartition.Code}
+	refreshes := b.metadata
+	b.mu.Unlock()
+	assert.Equal(t, tq.AcctReplyStatusSuccess, handle(t, h, newRequest(t, tq.AcctFlagStart, "9")))
+	assert.Len(t, b.all(), 5)
+	b.mu.Lock()
+	assert.Greater(t, b.metadata, refreshes)
+	b.mu.Unlock()
+
+	// other errors are reported to the device
+	b.mu.Lock()
+	b.failProduce = []int16{kerr.MessageTooLarge.Code}
+	b.mu.Unlock()
+	assert.Equal(t, tq.AcctReplyStatusError, handle(t, h, newRequest(t, tq.AcctFlagStart, "10")))
+}
+
+func TestBadCredentials(t *testing.T) {
+	b := newFakeBroker(t, "acct", "\x00tacquito\x00secret")
+	failures := testutil.ToFloat64(kafkaAuthError)
+	h := New(context.Background(), mockLogger{}).New(map[string]string{
+		"brokers": b.listener.Addr().String(), "topic": "acct", "sasl_mechanism": "PLAIN", "sasl_username": "tacquito", "sasl_password": "wrong", "timeout": "1s",
+	})
+	assert.Equal(t, tq.AcctReplyStatusError, handle(t, h, newRequest(t, tq.AcctFlagStart, "1")))
+	assert.Empty(t, b.all())
+	assert.Greater(t, testutil.ToFloat64(kafkaAuthError), failures)
+}
+
+func TestMisconfigured(t *testing.T) {
+	h := New(context.Background(), mockLogger{}).New(map[string]string{"topic": "acct"})
+	assert.Equal(t, tq.AcctReplyStatusError, handle(t, h, newRequest(t, tq.AcctFlagStart, "1")))
+}
+
+func TestUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	start := time.Now()
+	h := New(context.Background(), mockLogger{}).New(map[string]string{"brokers": addr, "topic": "acct", "timeout": "1s"})
+	assert.Equal(t, tq.AcctReplyStatusError, handle(t, h, newRequest(t, tq.AcctFlagStart, "1")))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
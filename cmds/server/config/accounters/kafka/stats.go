@@ -0,0 +1,48 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package kafka
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	kafkaProduced = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "kafka_produced",
+		Help:      "number of accounting records acknowledged by kafka",
+	})
+	kafkaProduceError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "kafka_produce_error",
+		Help:      "number of accounting records that could not be published to kafka",
+	})
+	kafkaMetadataRefresh = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "kafka_metadata_refresh",
+		Help:      "number of kafka topic metadata refreshes",
+	})
+	kafkaAuthError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "kafka_auth_error",
+		Help:      "number of failed sasl authentications with kafka brokers",
+	})
+	kafkaBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "kafka_bad_config",
+		Help:      "number of kafka accounters created with invalid options",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(kafkaProduced)
+	prometheus.MustRegister(kafkaProduceError)
+	prometheus.MustRegister(kafkaMetadataRefresh)
+	prometheus.MustRegister(kafkaAuthError)
+	prometheus.MustRegister(kafkaBadConfig)
+}
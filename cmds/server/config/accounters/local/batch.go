@@ -0,0 +1,213 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package local
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultFlushInterval is the flush interval of batching configured with only a flush size
+	defaultFlushInterval = time.Second
+	// defaultFlushSize is the flush size of batching configured with only a flush interval
+	defaultFlushSize = 256 << 10
+	// defaultQueueSize is the queue size of batching when unset
+	defaultQueueSize = 65536
+)
+
+// FsyncPolicy is when writes to a RotatingFile are synced to disk
+type FsyncPolicy struct {
+	// Flush syncs after every write to the file, each batch when batching
+	Flush bool
+	// Interval syncs at most once per interval, on the first write after it has elapsed
+	Interval time.Duration
+}
+
+// Batching buffers writes to a RotatingFile in memory, writing them to the file in the background
+// in batches, so a write does not wait on the disk.  A zero FlushInterval disables batching.
+type Batching struct {
+	// FlushInterval is the longest a write is buffered before it is written to the file
+	FlushInterval time.Duration
+	// FlushSize writes the buffer to the file once it holds this many bytes
+	FlushSize int
+	// QueueSize is the most writes waiting to be buffered, writes beyond it are dropped
+	QueueSize int
+	// Fsync applies whether or not writes are batched
+	Fsync FsyncPolicy
+}
+
+// newBatching parses batching settings from accounter options
+//
+// flush_interval - a go duration, eg 100ms
+// flush_size - bytes, with an optional K, M or G suffix, eg 256K
+// queue_size - the number of writes waiting to be buffered
+// fsync - none, flush, or a go duration to sync at most that often
+//
+// Setting any of flush_interval, flush_size or queue_size enables batching, the others default.
+func newBatching(options map[string]string) (Batching, error) {
+	var b Batching
+	if v, ok := options["flush_interval"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return b, fmt.Errorf("invalid flush_interval option [%v] for file accounter; must be a positive duration", v)
+		}
+		b.FlushInterval = d
+	}
+	if v, ok := options["flush_size"]; ok {
+		n, err := parseSize(v)
+		if err != nil || n <= 0 {
+			return b, fmt.Errorf("invalid flush_size option [%v] for file accounter; must be a positive size", v)
+		}
+		b.FlushSize = int(n)
+	}
+	if v, ok := options["queue_size"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return b, fmt.Errorf("invalid queue_size option [%v] for file accounter; must be a positive number", v)
+		}
+		b.QueueSize = n
+	}
+	if b.FlushInterval > 0 || b.FlushSize > 0 || b.QueueSize > 0 {
+		if b.FlushInterval == 0 {
+			b.FlushInterval = defaultFlushInterval
+		}
+		if b.FlushSize == 0 {
+			b.FlushSize = defaultFlushSize
+		}
+		if b.QueueSize == 0 {
+			b.QueueSize = defaultQueueSize
+		}
+	}
+	if v, ok := options["fsync"]; ok {
+		switch strings.ToLower(v) {
+		case "none":
+		case "flush":
+			b.Fsync.Flush = true
+		default:
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return b, fmt.Errorf("invalid fsync option [%v] for file accounter; must be none, flush or a positive duration", v)
+			}
+			b.Fsync.Interval = d
+		}
+	}
+	return b, nil
+}
+
+// batcher is the background writer of a RotatingFile with batching enabled
+type batcher struct {
+	Batching
+	queue chan []byte
+	done  chan struct{}
+}
+
+// SetBatching changes the batching and fsync settings, eg after a config reload.  Writes buffered
+// under the previous settings are flushed before it returns.
+func (r *RotatingFile) SetBatching(batching Batching) {
+	r.mu.Lock()
+	r.fsync = batching.Fsync
+	if (r.batch == nil && batching.FlushInterval == 0) || (r.batch != nil && r.batch.Batching == batching) {
+		// unchanged, every user sharing the file applies its settings on each load
+		r.mu.Unlock()
+		return
+	}
+	previous := r.batch
+	r.batch = nil
+	if batching.FlushInterval > 0 {
+		r.batch = &batcher{Batching: batching, queue: make(chan []byte, batching.QueueSize), done: make(chan struct{})}
+		go r.run(r.batch, previous)
+	}
+	if previous != nil {
+		// writes enqueue under mu, so none can race the close
+		close(previous.queue)
+	}
+	r.mu.Unlock()
+	if previous != nil {
+		<-previous.done
+	}
+}
+
+// enqueue hands a copy of p to the batcher, as the caller may reuse p.  p is refused with an
+// error if the queue is full, or if the last batch could not be written to the file, so the
+// device is not told its record was stored.  callers must hold mu
+func (r *RotatingFile) enqueue(p []byte) (int, error) {
+	if r.flushErr != nil {
+		localBatchDropped.Inc()
+		return 0, fmt.Errorf("accounting file [%v] is failing writes, record dropped; %v", r.path, r.flushErr)
+	}
+	select {
+	case r.batch.queue <- append([]byte(nil), p...):
+		return len(p), nil
+	default:
+		localBatchDropped.Inc()
+		return 0, fmt.Errorf("accounting file [%v] write queue is full, record dropped", r.path)
+	}
+}
+
+// run buffers the writes queued on b, writing them to the file once FlushSize bytes are buffered
+// or every FlushInterval.  It flushes and returns once the queue is closed.  Writes are kept in
+// order by waiting for the previous batcher, if any, to flush first.  A batch that fails to be
+// written is kept and written again on the next flush, since its writes were acknowledged.
+func (r *RotatingFile) run(b *batcher, previous *batcher) {
+	defer close(b.done)
+	if previous != nil {
+		<-previous.done
+	}
+	ticker := time.NewTicker(b.FlushInterval)
+	defer ticker.Stop()
+	buf := make([]byte, 0, b.FlushSize)
+	flush := func() {
+		if len(buf) == 0 {
+			return
+		}
+		r.mu.Lock()
+		n, err := r.write(buf)
+		r.flushErr = err
+		r.mu.Unlock()
+		if err != nil {
+			localBatchError.Inc()
+			buf = buf[:copy(buf, buf[n:])]
+			return
+		}
+		localBatchFlushed.Inc()
+		buf = buf[:0]
+	}
+	for {
+		select {
+		case p, ok := <-b.queue:
+			if !ok {
+				flush()
+				return
+			}
+			buf = append(buf, p...)
+			if len(buf) >= b.FlushSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// sync applies the fsync policy after a write.  callers must hold mu
+func (r *RotatingFile) sync() {
+	switch {
+	case r.fsync.Flush:
+	case r.fsync.Interval > 0 && r.now().Sub(r.synced) >= r.fsync.Interval:
+	default:
+		return
+	}
+	if err := r.f.Sync(); err != nil {
+		localFsyncError.Inc()
+		return
+	}
+	r.synced = r.now()
+}
@@ -0,0 +1,197 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchingOptions(t *testing.T) {
+	b, err := newBatching(map[string]string{"flush_interval": "100ms", "flush_size": "64K", "queue_size": "1000", "fsync": "flush"})
+	require.NoError(t, err)
+	assert.Equal(t, Batching{FlushInterval: 100 * time.Millisecond, FlushSize: 64 << 10, QueueSize: 1000, Fsync: FsyncPolicy{Flush: true}}, b)
+
+	b, err = newBatching(map[string]string{"flush_size": "1M", "fsync": "5s"})
+	require.NoError(t, err)
+	assert.Equal(t, Batching{FlushInterval: defaultFlushInterval, FlushSize: 1 << 20, QueueSize: defaultQueueSize, Fsync: FsyncPolicy{Interval: 5 * time.Second}}, b)
+
+	b, err = newBatching(map[string]string{"fsync": "none"})
+	require.NoError(t, err)
+	assert.Equal(t, Batching{}, b)
+
+	for _, bad := range []map[string]string{{"flush_interval": "0s"}, {"flush_size": "lots"}, {"queue_size": "-1"}, {"fsync": "always"}} {
+		_, err := newBatching(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestBatchingFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acct.log")
+	f, err := OpenRotatingFile(path)
+	require.NoError(t, err)
+	f.SetBatching(Batching{FlushInterval: time.Hour, FlushSize: 30, QueueSize: 100})
+
+	// log.Logger reuses its buffer, the batcher must copy each write
+	l := log.New(f, "", 0)
+	l.Printf("first")
+	l.Printf("second")
+	time.Sleep(10 * time.Millisecond)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, b, "writes below the flush size wait for the interval")
+
+	flushed := testutil.ToFloat64(localBatchFlushed)
+	l.Printf("third, past the flush size")
+	assert.Eventually(t, func() bool {
+		b, _ := os.ReadFile(path)
+		return string(b) == "first\nsecond\nthird, past the flush size\n"
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, flushed+1, testutil.ToFloat64(localBatchFlushed))
+
+	l.Printf("fourth")
+	require.NoError(t, f.Close())
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\nthird, past the flush size\nfourth\n", string(b), "close flushes")
+}
+
+func TestBatchingInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acct.log")
+	f, err := OpenRotatingFile(path)
+	require.NoError(t, err)
+	defer f.Close()
+	f.SetBatching(Batching{FlushInterval: 10 * time.Millisecond, FlushSize: 1 << 20, QueueSize: 100, Fsync: FsyncPolicy{Flush: true}})
+	_, err = f.Write([]byte("record\n"))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		b, _ := os.ReadFile(path)
+		return string(b) == "record\n"
+	}, time.Second, time.Millisecond)
+}
+
+func TestBatchingDropped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acct.log")
+	f, err := OpenRotatingFile(path)
+	require.NoError(t, err)
+	// a batcher that is not running never drains its queue
+	f.batch = &batcher{queue: make(chan []byte, 1)}
+	_, err = f.Write([]byte("queued\n"))
+	require.NoError(t, err)
+	dropped := testutil.ToFloat64(localBatchDropped)
+	_, err = f.Write([]byte("dropped\n"))
+	assert.Error(t, err)
+	assert.Equal(t, dropped+1, testutil.ToFloat64(localBatchDropped))
+	f.batch = nil
+	require.NoError(t, f.Close())
+}
+
+func TestBatchingErrorReply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acct.log")
+	a, err := New(nopLogger{}, SetLogSinkDefault(path, ""))
+	require.NoError(t, err)
+	defer a.Close()
+	f := a.files.m[path]
+	handle := func(user string) tq.AcctReplyStatus {
+		b, err := tq.NewAcctRequest(tq.SetAcctRequestFlag(tq.AcctFlagStart), tq.SetAcctRequestUser(tq.AuthenUser(user))).MarshalBinary()
+		require.NoError(t, err)
+		var response configtest.Response
+		a.Handle(&response, tq.Request{Body: b, Context: context.Background()})
+		require.NotNil(t, response.Acct)
+		return response.Acct.Status
+	}
+
+	// a batcher that is not running never drains its queue
+	f.mu.Lock()
+	f.batch = &batcher{queue: make(chan []byte, 1)}
+	f.mu.Unlock()
+	assert.Equal(t, tq.AcctReplyStatusSuccess, handle("queued"))
+	assert.Equal(t, tq.AcctReplyStatusError, handle("dropped"), "a full queue fails the record")
+	f.mu.Lock()
+	f.batch = nil
+	f.mu.Unlock()
+
+	// a batch that cannot be written fails the records after it until it is written
+	f.SetBatching(Batching{FlushInterval: time.Millisecond, FlushSize: 1, QueueSize: 10})
+	f.mu.Lock()
+	f.f.Close()
+	f.mu.Unlock()
+	assert.Equal(t, tq.AcctReplyStatusSuccess, handle("acknowledged"))
+	assert.Eventually(t, func() bool { return handle("refused") == tq.AcctReplyStatusError }, time.Second, time.Millisecond)
+	f.mu.Lock()
+	require.NoError(t, f.open())
+	f.mu.Unlock()
+	assert.Eventually(t, func() bool { return handle("recovered") == tq.AcctReplyStatusSuccess }, time.Second, time.Millisecond)
+	f.SetBatching(Batching{})
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "acknowledged", "the failed batch is written once the file recovers")
+	assert.NotContains(t, string(b), "dropped")
+	assert.NotContains(t, string(b), "refused")
+}
+
+func TestBatchingOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acct.log")
+	f, err := OpenRotatingFile(path)
+	require.NoError(t, err)
+	f.SetBatching(Batching{FlushInterval: time.Millisecond, FlushSize: 512, QueueSize: 10000})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			fmt.Fprintf(f, "%d\n", i)
+		}
+	}()
+	// reconfiguring mid stream must not reorder writes
+	for i := 0; i < 10; i++ {
+		f.SetBatching(Batching{FlushInterval: time.Millisecond, FlushSize: 512 + i, QueueSize: 10000})
+	}
+	wg.Wait()
+	require.NoError(t, f.Close())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 1000)
+	for i, line := range lines {
+		assert.Equal(t, fmt.Sprint(i), line)
+	}
+}
+
+func BenchmarkBatchingWrite(b *testing.B) {
+	record := []byte(strings.Repeat("x", 255) + "\n")
+	for _, batching := range []Batching{{}, {FlushInterval: 100 * time.Millisecond, FlushSize: 256 << 10, QueueSize: 1 << 20}} {
+		b.Run(fmt.Sprintf("batched=%v", batching.FlushInterval > 0), func(b *testing.B) {
+			f, err := OpenRotatingFile(filepath.Join(b.TempDir(), "acct.log"))
+			require.NoError(b, err)
+			f.SetBatching(batching)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				f.Write(record)
+			}
+			require.NoError(b, f.Close())
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ChainedRecord wraps a record with the hash of the record written before it.  Editing,
+// removing or reordering any record breaks every hash that follows it.
+type ChainedRecord struct {
+	Seq    uint64          `json:"seq"`
+	Prev   string          `json:"prev"`
+	Hash   string          `json:"hash"`
+	Record json.RawMessage `json:"record"`
+}
+
+// Anchor is written to a separate sink every N records.  Anchors should be shipped somewhere
+// the accounting file's owner cannot modify, so a rewritten chain can be detected.  Path names
+// the file of a chain forked for a path option, it is empty for the default file.
+type Anchor struct {
+	Time time.Time `json:"time"`
+	Path string    `json:"path,omitempty"`
+	Seq  uint64    `json:"seq"`
+	Hash string    `json:"hash"`
+}
+
+// NewChain creates a hash chain.  anchors may be nil, in which case no anchors are written.
+// every controls how many records are written between anchors.
+func NewChain(anchors acctLogger, every uint64) *Chain {
+	return &Chain{anchors: anchors, every: every}
+}
+
+// Chain links each record it seals to the previous one with a sha256 hash.  Chain is safe
+// for concurrent use and should be shared by all writers of a single sink.  The chain continues
+// across rotations of the sink's file, so a rotated file starts mid-chain.
+type Chain struct {
+	anchors acctLogger
+	every   uint64
+	path    string
+
+	mu   sync.Mutex
+	seq  uint64
+	prev string
+}
+
+// fork creates a new chain for the file at path, writing anchors to the same sink
+func (c *Chain) fork(path string) *Chain {
+	return &Chain{anchors: c.anchors, every: c.every, path: path}
+}
+
+// chainHash computes the hash of a record given the previous hash
+func chainHash(seq uint64, prev string, record []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%s|", seq, prev)
+	h.Write(record)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Seal wraps record in a ChainedRecord and passes its encoding to sink.  sink is called while the
+// chain is locked, so records reach the sink in chain order.  If sink fails the chain does not
+// advance, so the next record links to the last one written.
+func (c *Chain) Seal(record []byte, sink func(line string) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seq := c.seq + 1
+	r := ChainedRecord{Seq: seq, Prev: c.prev, Hash: chainHash(seq, c.prev, record), Record: record}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := sink(string(b)); err != nil {
+		return err
+	}
+	c.seq, c.prev = seq, r.Hash
+	if c.anchors != nil && c.every > 0 && seq%c.every == 0 {
+		a, err := json.Marshal(Anchor{Time: time.Now(), Path: c.path, Seq: seq, Hash: r.Hash})
+		if err != nil {
+			return err
+		}
+		c.anchors.Printf("%s", a)
+	}
+	return nil
+}
+
+// VerifyChain reads log lines from r and validates every chained record.  Any prefix the log
+// sink adds before the record, such as a timestamp, is ignored.  A record with seq 1 starts a
+// new chain, which happens on every process restart.  The first record may also continue a chain
+// begun in a previous file, eg one that was rotated, in which case its prev hash is not checked;
+// use VerifyChainFrom to check it.  Compare against anchors to detect truncation.  The number of
+// verified records is returned.
+func VerifyChain(r io.Reader) (int, error) {
+	_, verified, err := verifyChain(r, nil)
+	return verified, err
+}
+
+// VerifyChainFrom validates the chained records of r as VerifyChain does, but requires the first
+// record to follow from, unless it starts a new chain.  from is an anchor recorded for the
+// record before the segment, or the last record of the previous segment as returned by an
+// earlier VerifyChainFrom, so the rotated files of a chain may be verified in order.  The last
+// verified record is returned as an Anchor, or from if there are none.
+func VerifyChainFrom(r io.Reader, from Anchor) (Anchor, int, error) {
+	return verifyChain(r, &from)
+}
+
+// verifyChain validates the records of r.  The first record must follow from, if set.
+func verifyChain(r io.Reader, from *Anchor) (Anchor, int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var (
+		last     Anchor
+		verified int
+		line     int
+		seq      uint64
+		prev     string
+	)
+	if from != nil {
+		last, seq, prev = *from, from.Seq, from.Hash
+	}
+	for scanner.Scan() {
+		line++
+		text := scanner.Bytes()
+		start := bytes.IndexByte(text, '{')
+		if start < 0 {
+			continue
+		}
+		var cr ChainedRecord
+		if err := json.Unmarshal(text[start:], &cr); err != nil {
+			return last, verified, fmt.Errorf("line [%v] is not a chained record; %v", line, err)
+		}
+		switch {
+		case cr.Seq == 1:
+			// a new chain
+			seq, prev = 0, ""
+		case verified == 0 && from == nil:
+			// a segment that continues a chain from an earlier file
+			seq, prev = cr.Seq-1, cr.Prev
+		}
+		if cr.Seq != seq+1 {
+			return last, verified, fmt.Errorf("line [%v] has seq [%v], expected [%v]", line, cr.Seq, seq+1)
+		}
+		if cr.Prev != prev {
+			return last, verified, fmt.Errorf("line [%v] prev hash does not match the preceding record", line)
+		}
+		if cr.Hash != chainHash(cr.Seq, cr.Prev, cr.Record) {
+			return last, verified, fmt.Errorf("line [%v] hash does not match its contents", line)
+		}
+		seq, prev = cr.Seq, cr.Hash
+		last.Seq, last.Hash = cr.Seq, cr.Hash
+		verified++
+	}
+	return last, verified, scanner.Err()
+}
@@ -0,0 +1,143 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	var records, anchors bytes.Buffer
+	sink := log.New(&records, "tacquito", log.Ldate|log.Ltime)
+	c := NewChain(log.New(&anchors, "", 0), 2)
+	for i := 0; i < 5; i++ {
+		err := c.Seal([]byte(fmt.Sprintf(`{"user":"user%d"}`, i)), func(line string) error { return sink.Output(1, line) })
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, strings.Count(anchors.String(), "\n"), "anchors are written every 2 records")
+
+	n, err := VerifyChain(strings.NewReader(records.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	// a restart begins a new chain
+	restarted := NewChain(nil, 0)
+	restarted.Seal([]byte(`{"user":"restart"}`), func(line string) error { return sink.Output(1, line) })
+	n, err = VerifyChain(strings.NewReader(records.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, 6, n)
+
+	tests := []struct {
+		name   string
+		tamper func(lines []string) []string
+	}{
+		{
+			name: "edited record",
+			tamper: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "user1", "admin", 1)
+				return lines
+			},
+		},
+		{
+			name: "removed record",
+			tamper: func(lines []string) []string {
+				return append(lines[:2], lines[3:]...)
+			},
+		},
+		{
+			name: "reordered records",
+			tamper: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+		},
+	}
+	for _, test := range tests {
+		lines := strings.Split(strings.TrimSpace(records.String()), "\n")
+		tampered := strings.Join(test.tamper(lines), "\n")
+		_, err := VerifyChain(strings.NewReader(tampered))
+		assert.Error(t, err, test.name)
+	}
+}
+
+func TestChainRotation(t *testing.T) {
+	dir := t.TempDir()
+	path, noc := filepath.Join(dir, "acct.log"), filepath.Join(dir, "noc.log")
+	var anchors bytes.Buffer
+	a, err := New(nopLogger{}, SetLogSinkDefault(path, "tacquito"), SetHashChain(NewChain(log.New(&anchors, "", 0), 1)))
+	require.NoError(t, err)
+	h := a.New(map[string]string{"max_size": "1K"}).(*Accounter)
+	n := a.New(map[string]string{"path": noc}).(*Accounter)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, h.write([]byte(fmt.Sprintf(`{"user":"user%d"}`, i))))
+		if i%5 == 0 {
+			require.NoError(t, n.write([]byte(fmt.Sprintf(`{"user":"noc%d"}`, i))))
+		}
+	}
+	require.NoError(t, a.Close())
+
+	rotated, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Greater(t, len(rotated), 1)
+	sort.Strings(rotated)
+	segments := append(rotated, path)
+
+	// every segment verifies on its own, and in order from the previous one
+	var from Anchor
+	total := 0
+	for _, segment := range segments {
+		b, err := os.ReadFile(segment)
+		require.NoError(t, err)
+		_, err = VerifyChain(bytes.NewReader(b))
+		assert.NoError(t, err, segment)
+		var verified int
+		from, verified, err = VerifyChainFrom(bytes.NewReader(b), from)
+		require.NoError(t, err, segment)
+		total += verified
+	}
+	assert.Equal(t, 20, total)
+
+	// a segment that starts mid-chain verifies from the anchor recorded for the record before it
+	recorded := map[string]map[uint64]Anchor{}
+	for _, line := range strings.Split(strings.TrimSpace(anchors.String()), "\n") {
+		var anchor Anchor
+		require.NoError(t, json.Unmarshal([]byte(line), &anchor))
+		if recorded[anchor.Path] == nil {
+			recorded[anchor.Path] = map[uint64]Anchor{}
+		}
+		recorded[anchor.Path][anchor.Seq] = anchor
+	}
+	b, err := os.ReadFile(segments[1])
+	require.NoError(t, err)
+	var first ChainedRecord
+	require.NoError(t, json.Unmarshal(b[bytes.IndexByte(b, '{'):bytes.IndexByte(b, '\n')], &first))
+	require.Greater(t, first.Seq, uint64(1))
+	_, _, err = VerifyChainFrom(bytes.NewReader(b), recorded[""][first.Seq-1])
+	assert.NoError(t, err)
+	_, _, err = VerifyChainFrom(bytes.NewReader(b), recorded[""][first.Seq-2])
+	assert.Error(t, err, "the segment does not follow the anchor")
+
+	// the file of a path option has a chain of its own
+	b, err = os.ReadFile(noc)
+	require.NoError(t, err)
+	last, verified, err := VerifyChainFrom(bytes.NewReader(b), Anchor{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, verified)
+	assert.Equal(t, recorded[noc][4].Hash, last.Hash)
+}
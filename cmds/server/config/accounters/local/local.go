@@ -13,7 +13,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
+	"sync"
 
 	tq "github.com/facebookincubator/tacquito"
 )
@@ -29,18 +29,47 @@ type acctLogger interface {
 	Printf(format string, args ...interface{})
 }
 
+// outputLogger is implemented by log.Logger, whose Output returns the error of the write that
+// Printf discards
+type outputLogger interface {
+	Output(calldepth int, s string) error
+}
+
+// output writes line to l, returning the error of the write if l reports one
+func output(l acctLogger, line string) error {
+	if o, ok := l.(outputLogger); ok {
+		return o.Output(2, line)
+	}
+	l.Printf("%s", line)
+	return nil
+}
+
 // Option is the setter type for Accounter
 type Option func(a *Accounter)
 
-// SetLogSinkDefault will create a file object for writing logs to and attach it to the accounting logger
+// logFlags are the log.Logger flags used for accounting files
+const logFlags = log.Ldate | log.Ltime | log.Llongfile
+
+// NewLogSink will create a file object for writing logs to, wrapped in a log.Logger
+func NewLogSink(path, prefix string) (*log.Logger, error) {
+	f, err := OpenRotatingFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return log.New(f, prefix, logFlags), nil
+}
+
+// SetLogSinkDefault will create a file object for writing logs to and attach it to the accounting logger.
+// The file is rotated according to the accounter's options in config.
 func SetLogSinkDefault(path, prefix string) Option {
 	return func(a *Accounter) {
 		// open file for accounting data
-		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		f, err := a.files.open(path)
 		if err != nil {
 			return
 		}
-		a.sink = log.New(f, prefix, log.Ldate|log.Ltime|log.Llongfile)
+		a.sink = log.New(f, prefix, logFlags)
+		a.path, a.prefix = path, prefix
 	}
 }
 
@@ -51,16 +80,81 @@ func SetLogSink(l acctLogger) Option {
 	}
 }
 
+// SetHashChain will wrap every record written to the sink in a ChainedRecord, linking it to the
+// record before it for tamper evidence.  Copies of the accounter writing to another file, with
+// the path option, chain their records in a chain forked from c.
+func SetHashChain(c *Chain) Option {
+	return func(a *Accounter) {
+		a.chain = c
+	}
+}
+
+// SetSummarizer will roll up the watchdog records of accounting tasks into a Summary, written
+// when the task stops
+func SetSummarizer(s *Summarizer) Option {
+	return func(a *Accounter) {
+		a.summarizer = s
+	}
+}
+
+// SetRawSink will write every accounting record, unsummarized and unchained, to l
+func SetRawSink(l acctLogger) Option {
+	return func(a *Accounter) {
+		a.raw = l
+	}
+}
+
+// files holds every file written by copies of an accounter, by path, so users configured with
+// the same path share a file, and the hash chain of each
+type files struct {
+	sync.Mutex
+	m      map[string]*RotatingFile
+	chains map[string]*Chain
+}
+
+// chain returns the hash chain of the file at path, forking it from c.  Every file has a chain
+// of its own, so each verifies on its own.
+func (f *files) chain(path string, c *Chain) *Chain {
+	f.Lock()
+	defer f.Unlock()
+	if forked, ok := f.chains[path]; ok {
+		return forked
+	}
+	forked := c.fork(path)
+	f.chains[path] = forked
+	return forked
+}
+
+// open returns the file for path, opening it if needed
+func (f *files) open(path string) (*RotatingFile, error) {
+	f.Lock()
+	defer f.Unlock()
+	if r, ok := f.m[path]; ok {
+		return r, nil
+	}
+	r, err := OpenRotatingFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f.m[path] = r
+	return r, nil
+}
+
 // Accounter that writes to system log service
 type Accounter struct {
-	loggerProvider            // local server event logger
-	sink           acctLogger // accounting log destination
+	loggerProvider             // local server event logger
+	sink           acctLogger  // accounting log destination
+	chain          *Chain      // optional hash chain shared by all copies of this accounter writing to the same file
+	summarizer     *Summarizer // optional summarizer shared by all copies of this accounter
+	raw            acctLogger  // optional destination for every record when summarizing
+	files          *files      // files opened by SetLogSinkDefault or the path option
+	path, prefix   string      // the default file, if SetLogSinkDefault was used
 }
 
 // New creates a new accounter.
 // TODO: Implement log rotation
 func New(l loggerProvider, opts ...Option) (*Accounter, error) {
-	a := &Accounter{loggerProvider: l}
+	a := &Accounter{loggerProvider: l, files: &files{m: make(map[string]*RotatingFile), chains: make(map[string]*Chain)}}
 	for _, opt := range opts {
 		opt(a)
 	}
@@ -70,15 +164,128 @@ func New(l loggerProvider, opts ...Option) (*Accounter, error) {
 	return a, nil
 }
 
-// New creates a new local file accounter
+// New creates a new local file accounter.  Supported options:
+//
+// path - optional, the file to write to instead of the default file
+// max_size, max_age, compress, retention, max_files - optional, rotation of the file, see newRotation
+// flush_interval, flush_size, queue_size, fsync - optional, batching of writes to the file, see newBatching
+//
+// Rotation and batching settings apply to every user writing to the same file, the most recently loaded wins.
 func (a Accounter) New(options map[string]string) tq.Handler {
-	return &Accounter{loggerProvider: a.loggerProvider, sink: a.sink}
+	n := &Accounter{loggerProvider: a.loggerProvider, sink: a.sink, chain: a.chain, summarizer: a.summarizer, raw: a.raw, files: a.files, path: a.path, prefix: a.prefix}
+	rotation, rotationErr := newRotation(options)
+	if rotationErr != nil {
+		a.Errorf(context.Background(), "ignoring rotation options; %v", rotationErr)
+	}
+	path := options["path"]
+	if path == "" {
+		path = a.path
+	}
+	if path == "" {
+		// a custom sink, set by SetLogSink, is not a file we can rotate
+		return n
+	}
+	f, err := a.files.open(path)
+	if err != nil {
+		a.Errorf(context.Background(), "unable to open accounting file [%v], using the default; %v", path, err)
+		return n
+	}
+	if rotationErr == nil && hasRotation(options) {
+		f.SetRotation(rotation)
+	}
+	if batching, err := newBatching(options); err != nil {
+		a.Errorf(context.Background(), "ignoring batching options; %v", err)
+	} else if hasBatching(options) {
+		f.SetBatching(batching)
+	}
+	if path != a.path {
+		n.sink = log.New(f, a.prefix, logFlags)
+		if a.chain != nil {
+			n.chain = a.files.chain(path, a.chain)
+		}
+	}
+	return n
+}
+
+// Close flushes and closes every file opened by the accounter and its copies.  Records written
+// after Close are lost.
+func (a *Accounter) Close() error {
+	a.files.Lock()
+	defer a.files.Unlock()
+	var err error
+	for path, f := range a.files.m {
+		if closeErr := f.Close(); closeErr != nil {
+			err = fmt.Errorf("unable to close accounting file [%v]; %v", path, closeErr)
+		}
+		delete(a.files.m, path)
+	}
+	return err
+}
+
+// hasRotation reports whether any rotation options are set
+func hasRotation(options map[string]string) bool {
+	for _, k := range []string{"max_size", "max_age", "compress", "retention", "max_files"} {
+		if _, ok := options[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBatching reports whether any batching or fsync options are set
+func hasBatching(options map[string]string) bool {
+	for _, k := range []string{"flush_interval", "flush_size", "queue_size", "fsync"} {
+		if _, ok := options[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// write logs a record to the sink, sealing it in the hash chain if there is one.  Records the
+// sink fails to write, eg because the file's write queue is full, return an error.
+func (a Accounter) write(record []byte) error {
+	if a.chain != nil {
+		return a.chain.Seal(record, func(line string) error { return output(a.sink, line) })
+	}
+	return output(a.sink, string(record))
+}
+
+// writeAll logs the records required by body, which is every record if there is no summarizer
+func (a Accounter) writeAll(request tq.Request, body tq.AcctRequest, record []byte) error {
+	if a.raw != nil {
+		a.raw.Printf("%s", record)
+	}
+	if a.summarizer == nil {
+		return a.write(record)
+	}
+	client, _ := request.Context.Value(tq.ContextConnRemoteAddr).(string)
+	write, summary := a.summarizer.observe(client, body)
+	if write {
+		if err := a.write(record); err != nil {
+			return err
+		}
+	}
+	summaries := a.summarizer.expire()
+	if summary != nil {
+		summaries = append(summaries, summary)
+	}
+	for _, s := range summaries {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if err := a.write(b); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Handle ...
 func (a Accounter) Handle(response tq.Response, request tq.Request) {
 	var body tq.AcctRequest
-	if err := tq.Unmarshal(request.Body, &body); err != nil {
+	if err := request.Unmarshal(&body); err != nil {
 		response.Reply(
 			tq.NewAcctReply(
 				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
@@ -88,7 +295,7 @@ func (a Accounter) Handle(response tq.Response, request tq.Request) {
 		return
 	}
 
-	jsonLog, err := json.Marshal(body)
+	jsonLog, err := json.Marshal(tq.NewAcctRecord(request.Context, body))
 	if err != nil {
 		response.Reply(
 			tq.NewAcctReply(
@@ -102,7 +309,16 @@ func (a Accounter) Handle(response tq.Response, request tq.Request) {
 	}
 
 	// log accounting data
-	a.sink.Printf(string(jsonLog))
+	if err := a.writeAll(request, body, jsonLog); err != nil {
+		response.Reply(
+			tq.NewAcctReply(
+				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+				tq.SetAcctReplyServerMsg("failed to log accounting message"),
+			),
+		)
+		a.Errorf(request.Context, "failed to write accounting record: %v", err)
+		return
+	}
 
 	// start/stop/watchdog don't actually log anything, this is up to you
 	switch body.Flags {
@@ -123,16 +339,8 @@ func (a Accounter) Handle(response tq.Response, request tq.Request) {
 		)
 		return
 	case tq.AcctFlagWatchdog:
-		if int(request.Header.SeqNo) != 1 {
-			// cannot be seqno > 1
-			response.Reply(
-				tq.NewAcctReply(
-					tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
-					tq.SetAcctReplyServerMsg("invalid sequence number"),
-				),
-			)
-			return
-		}
+		// every accounting record is a single request and reply, so watchdogs, with or without
+		// updates, always arrive with seqno 1
 		response.Reply(
 			tq.NewAcctReply(
 				tq.SetAcctReplyStatus(tq.AcctReplyStatusSuccess),
@@ -141,16 +349,6 @@ func (a Accounter) Handle(response tq.Response, request tq.Request) {
 		)
 		return
 	case tq.AcctFlagWatchdogWithUpdate:
-		if int(request.Header.SeqNo) < 3 {
-			// cannot be seqno 1 or 2
-			response.Reply(
-				tq.NewAcctReply(
-					tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
-					tq.SetAcctReplyServerMsg("invalid sequence number"),
-				),
-			)
-			return
-		}
 		response.Reply(
 			tq.NewAcctReply(
 				tq.SetAcctReplyStatus(tq.AcctReplyStatusSuccess),
@@ -0,0 +1,310 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package local
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat suffixes rotated files.  It sorts lexically in time order.
+const rotatedTimeFormat = "20060102T150405.000000000"
+
+// Rotation controls when a RotatingFile is rotated and how long rotated files are kept.  Zero
+// values disable the corresponding limit.
+type Rotation struct {
+	// MaxSize rotates the file before a write would take it past this many bytes
+	MaxSize int64
+	// MaxAge rotates the file once it has been open this long
+	MaxAge time.Duration
+	// Compress gzips rotated files
+	Compress bool
+	// Retention removes rotated files older than this
+	Retention time.Duration
+	// MaxFiles keeps at most this many rotated files, removing the oldest
+	MaxFiles int
+}
+
+// newRotation parses rotation settings from accounter options
+//
+// max_size - bytes, with an optional K, M or G suffix, eg 100M
+// max_age - a go duration, eg 24h
+// compress - true to gzip rotated files
+// retention - a go duration, eg 720h
+// max_files - the number of rotated files to keep
+func newRotation(options map[string]string) (Rotation, error) {
+	var r Rotation
+	var err error
+	if v, ok := options["max_size"]; ok {
+		if r.MaxSize, err = parseSize(v); err != nil {
+			return r, fmt.Errorf("invalid max_size option [%v] for file accounter; %v", v, err)
+		}
+	}
+	for _, d := range []struct {
+		name string
+		v    *time.Duration
+	}{{"max_age", &r.MaxAge}, {"retention", &r.Retention}} {
+		if v, ok := options[d.name]; ok {
+			if *d.v, err = time.ParseDuration(v); err != nil {
+				return r, fmt.Errorf("invalid %v option [%v] for file accounter; %v", d.name, v, err)
+			}
+		}
+	}
+	if v, ok := options["compress"]; ok {
+		if r.Compress, err = strconv.ParseBool(v); err != nil {
+			return r, fmt.Errorf("invalid compress option [%v] for file accounter; %v", v, err)
+		}
+	}
+	if v, ok := options["max_files"]; ok {
+		if r.MaxFiles, err = strconv.Atoi(v); err != nil {
+			return r, fmt.Errorf("invalid max_files option [%v] for file accounter; %v", v, err)
+		}
+	}
+	if r.MaxSize < 0 || r.MaxAge < 0 || r.Retention < 0 || r.MaxFiles < 0 {
+		return r, fmt.Errorf("rotation options for file accounter cannot be negative")
+	}
+	return r, nil
+}
+
+// parseSize parses a byte count with an optional K, M or G suffix
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+// OpenRotatingFile opens path for appending.  It does not rotate until SetRotation is called.
+func OpenRotatingFile(path string) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, now: time.Now}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// RotatingFile is an append only file that is renamed aside, to path.<timestamp>, once it is too
+// large or too old.  Compression and removal of rotated files happens in the background, so
+// writers are not held up.
+type RotatingFile struct {
+	path string
+	now  func() time.Time
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	opened   time.Time
+	rotation Rotation
+	fsync    FsyncPolicy
+	synced   time.Time
+	// batch is the background writer when batching is enabled
+	batch *batcher
+	// flushErr is the error of the last batch written, writes are refused until a batch is written
+	flushErr error
+
+	// maintenance serializes compression and removal of rotated files
+	maintenance sync.Mutex
+	wg          sync.WaitGroup
+}
+
+// SetRotation changes the rotation settings, eg after a config reload
+func (r *RotatingFile) SetRotation(rotation Rotation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rotation = rotation
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.opened = f, info.Size(), r.now()
+	return nil
+}
+
+// Write appends p, rotating first if p would exceed the size limit or the file is too old.  With
+// batching enabled p is queued instead, and written to the file in the background.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.batch != nil {
+		return r.enqueue(p)
+	}
+	return r.write(p)
+}
+
+// write appends p to the file.  callers must hold mu
+func (r *RotatingFile) write(p []byte) (int, error) {
+	if r.size > 0 && r.due(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			localRotateError.Inc()
+			// keep writing to the current file rather than losing records
+			if r.f == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		r.sync()
+	}
+	return n, err
+}
+
+// due reports whether the file must be rotated before writing n bytes.  callers must hold mu
+func (r *RotatingFile) due(n int64) bool {
+	if r.rotation.MaxSize > 0 && r.size+n > r.rotation.MaxSize {
+		return true
+	}
+	return r.rotation.MaxAge > 0 && r.now().Sub(r.opened) >= r.rotation.MaxAge
+}
+
+// rotate renames the file aside and opens a new one.  callers must hold mu
+func (r *RotatingFile) rotate() error {
+	rotated := r.path + "." + r.now().UTC().Format(rotatedTimeFormat)
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(r.path, rotated); err != nil {
+		// reopen the original so writes continue
+		r.f = nil
+		if openErr := r.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	r.f = nil
+	if err := r.open(); err != nil {
+		return err
+	}
+	localRotate.Inc()
+	rotation := r.rotation
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.maintenance.Lock()
+		defer r.maintenance.Unlock()
+		if rotation.Compress {
+			if err := compress(rotated); err != nil {
+				localRotateError.Inc()
+			}
+		}
+		r.prune(rotation)
+	}()
+	return nil
+}
+
+// compress gzips path to path.gz and removes path
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// rotated returns the rotated files of path, oldest first
+func (r *RotatingFile) rotated() ([]string, error) {
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, m := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(m, r.path+"."), ".gz")
+		if _, err := time.Parse(rotatedTimeFormat, suffix); err == nil {
+			files = append(files, m)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i] < files[j] })
+	return files, nil
+}
+
+// prune removes rotated files beyond the retention limits
+func (r *RotatingFile) prune(rotation Rotation) {
+	if rotation.Retention == 0 && rotation.MaxFiles == 0 {
+		return
+	}
+	files, err := r.rotated()
+	if err != nil {
+		return
+	}
+	now := r.now()
+	for i, f := range files {
+		remove := rotation.MaxFiles > 0 && len(files)-i > rotation.MaxFiles
+		if !remove && rotation.Retention > 0 {
+			suffix := strings.TrimSuffix(strings.TrimPrefix(f, r.path+"."), ".gz")
+			if t, err := time.Parse(rotatedTimeFormat, suffix); err == nil && now.Sub(t) > rotation.Retention {
+				remove = true
+			}
+		}
+		if remove {
+			if err := os.Remove(f); err == nil {
+				localRotatePruned.Inc()
+			}
+		}
+	}
+}
+
+// Close flushes batched writes, waits for background compression and closes the file
+func (r *RotatingFile) Close() error {
+	r.SetBatching(Batching{})
+	r.wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
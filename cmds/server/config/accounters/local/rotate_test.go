@@ -0,0 +1,116 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package local
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotationOptions(t *testing.T) {
+	r, err := newRotation(map[string]string{"max_size": "10M", "max_age": "24h", "compress": "true", "retention": "720h", "max_files": "7"})
+	require.NoError(t, err)
+	assert.Equal(t, Rotation{MaxSize: 10 << 20, MaxAge: 24 * time.Hour, Compress: true, Retention: 720 * time.Hour, MaxFiles: 7}, r)
+	for _, bad := range []map[string]string{{"max_size": "lots"}, {"max_age": "1d"}, {"compress": "gzip"}, {"max_files": "-1"}} {
+		_, err := newRotation(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRotateSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acct.log")
+	now := time.Unix(0, 0)
+	f, err := OpenRotatingFile(path)
+	require.NoError(t, err)
+	f.now = func() time.Time { now = now.Add(time.Second); return now }
+	f.SetRotation(Rotation{MaxSize: 10, Compress: true, MaxFiles: 2})
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "fourth\n", string(b))
+	rotated, err := f.rotated()
+	require.NoError(t, err)
+	require.Len(t, rotated, 2, "the oldest rotated file is pruned")
+	var contents []string
+	for _, r := range rotated {
+		require.True(t, strings.HasSuffix(r, ".gz"), r)
+		gz, err := os.Open(r)
+		require.NoError(t, err)
+		zr, err := gzip.NewReader(gz)
+		require.NoError(t, err)
+		b, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		gz.Close()
+		contents = append(contents, string(b))
+	}
+	assert.Equal(t, []string{"second\n", "third\n"}, contents)
+}
+
+func TestRotateAgeAndRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acct.log")
+	now := time.Unix(0, 0)
+	f, err := OpenRotatingFile(path)
+	require.NoError(t, err)
+	f.now = func() time.Time { return now }
+	f.opened = now
+	f.SetRotation(Rotation{MaxAge: time.Hour, Retention: 90 * time.Minute})
+
+	f.Write([]byte("first\n"))
+	f.Write([]byte("still first\n"))
+	now = now.Add(time.Hour)
+	f.Write([]byte("second\n"))
+	f.wg.Wait()
+	rotated, err := f.rotated()
+	require.NoError(t, err)
+	require.Len(t, rotated, 1)
+	b, err := os.ReadFile(rotated[0])
+	require.NoError(t, err)
+	assert.Equal(t, "first\nstill first\n", string(b))
+
+	// the first rotated file ages out when the next rotation happens
+	now = now.Add(2 * time.Hour)
+	f.Write([]byte("third\n"))
+	require.NoError(t, f.Close())
+	rotated, err = f.rotated()
+	require.NoError(t, err)
+	require.Len(t, rotated, 1)
+	b, err = os.ReadFile(rotated[0])
+	require.NoError(t, err)
+	assert.Equal(t, "second\n", string(b))
+}
+
+func TestAccounterPathOption(t *testing.T) {
+	dir := t.TempDir()
+	a, err := New(nopLogger{}, SetLogSinkDefault(filepath.Join(dir, "default.log"), ""))
+	require.NoError(t, err)
+	h := a.New(map[string]string{"path": filepath.Join(dir, "noc.log"), "max_size": "1K"}).(*Accounter)
+	h.sink.Printf("noc record")
+	a.New(map[string]string{}).(*Accounter).sink.Printf("default record")
+
+	noc, err := os.ReadFile(filepath.Join(dir, "noc.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(noc), "noc record")
+	def, err := os.ReadFile(filepath.Join(dir, "default.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(def), "default record")
+	assert.Equal(t, int64(1<<10), a.files.m[filepath.Join(dir, "noc.log")].rotation.MaxSize)
+}
@@ -0,0 +1,78 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package local
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	localSummaryRollup = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "local_summary_rollup",
+		Help:      "number of watchdog records rolled up into a summary instead of being written",
+	})
+	localSummaryWritten = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "local_summary_written",
+		Help:      "number of summaries written for stopped accounting tasks",
+	})
+	localSummaryExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "local_summary_expired",
+		Help:      "number of summaries written for accounting tasks that expired without a stop",
+	})
+	localRotate = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "local_rotate",
+		Help:      "number of accounting file rotations",
+	})
+	localRotateError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "local_rotate_error",
+		Help:      "number of failed accounting file rotations or compressions",
+	})
+	localRotatePruned = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "local_rotate_pruned",
+		Help:      "number of rotated accounting files removed by retention",
+	})
+	localBatchFlushed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "local_batch_flushed",
+		Help:      "number of batches of accounting records written to file",
+	})
+	localBatchDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "local_batch_dropped",
+		Help:      "number of accounting records refused because the write queue of their file was full or its last batch failed to write",
+	})
+	localBatchError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "local_batch_error",
+		Help:      "number of batches of accounting records that failed to write to file",
+	})
+	localFsyncError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "local_fsync_error",
+		Help:      "number of failed syncs of an accounting file to disk",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(localSummaryRollup)
+	prometheus.MustRegister(localSummaryWritten)
+	prometheus.MustRegister(localSummaryExpired)
+	prometheus.MustRegister(localRotate)
+	prometheus.MustRegister(localRotateError)
+	prometheus.MustRegister(localRotatePruned)
+	prometheus.MustRegister(localBatchFlushed)
+	prometheus.MustRegister(localBatchDropped)
+	prometheus.MustRegister(localBatchError)
+	prometheus.MustRegister(localFsyncError)
+}
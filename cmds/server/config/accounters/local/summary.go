@@ -0,0 +1,173 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package local
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// Summary rolls up every record of an accounting task, from START to STOP, into a single record.
+// It is written in place of the task's WATCHDOG and STOP records.
+type Summary struct {
+	TaskID string `json:"task_id"`
+	User   string `json:"user"`
+	Port   string `json:"port"`
+	// RemAddr is the rem_addr field of the task's records, Client is the address of the device
+	RemAddr string    `json:"rem_addr"`
+	Client  string    `json:"client"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	// Duration is the time between the first and last record seen, in seconds.  It is shorter
+	// than the task if the START was missed, see StartMissed
+	Duration    float64 `json:"duration"`
+	StartMissed bool    `json:"start_missed,omitempty"`
+	// ElapsedTime, BytesIn and BytesOut are the last values the device reported
+	ElapsedTime uint64 `json:"elapsed_time,omitempty"`
+	BytesIn     uint64 `json:"bytes_in,omitempty"`
+	BytesOut    uint64 `json:"bytes_out,omitempty"`
+	// Watchdogs counts WATCHDOG records, Updates counts those that carried updated args
+	Watchdogs int `json:"watchdogs"`
+	Updates   int `json:"updates"`
+	// Expired is set if no STOP arrived before the task expired, Stop is absent in that case
+	Expired bool            `json:"expired,omitempty"`
+	Stop    *tq.AcctRequest `json:"stop,omitempty"`
+}
+
+// summaryKey identifies a task.  task_ids are only unique per client
+type summaryKey struct {
+	client string
+	taskID string
+}
+
+// NewSummarizer creates a Summarizer.  Tasks with no record for expiry are summarized as expired,
+// 0 never expires them.
+func NewSummarizer(expiry time.Duration) *Summarizer {
+	return &Summarizer{expiry: expiry, tasks: make(map[summaryKey]*Summary), now: time.Now}
+}
+
+// Summarizer reduces the records written for long lived tasks on chatty devices.  START records
+// are written as usual, WATCHDOG records are rolled up and a Summary is written at STOP time.
+// Records without a task_id are always written.  Summarizer is safe for concurrent use and should
+// be shared by all writers of a single sink.
+type Summarizer struct {
+	expiry time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	tasks     map[summaryKey]*Summary
+	lastSweep time.Time
+}
+
+// observe accounts for a record from client.  It reports whether the record should be written
+// and returns the summary of the task if the record ended it.
+func (s *Summarizer) observe(client string, body tq.AcctRequest) (bool, *Summary) {
+	id := body.Args.TaskID()
+	if id == "" {
+		return true, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	key := summaryKey{client: client, taskID: id}
+	summary := s.tasks[key]
+	// flags are compared whole, AcctFlagWatchdogWithUpdate is the watchdog and start bits together
+	switch body.Flags {
+	case tq.AcctFlagStart:
+		s.tasks[key] = newSummary(client, id, body, now, false)
+		return true, nil
+	case tq.AcctFlagWatchdog, tq.AcctFlagWatchdogWithUpdate:
+		if summary == nil {
+			summary = newSummary(client, id, body, now, true)
+			s.tasks[key] = summary
+		}
+		summary.Watchdogs++
+		if body.Flags == tq.AcctFlagWatchdogWithUpdate {
+			summary.Updates++
+		}
+		summary.update(body, now)
+		localSummaryRollup.Inc()
+		return false, nil
+	case tq.AcctFlagStop:
+		if summary == nil {
+			// the task was never seen, there is nothing to summarize
+			return true, nil
+		}
+		delete(s.tasks, key)
+		summary.update(body, now)
+		summary.Stop = &body
+		localSummaryWritten.Inc()
+		return false, summary
+	}
+	return true, nil
+}
+
+// expire removes and returns the summaries of tasks that have not been heard from within the
+// expiry, at most once a minute
+func (s *Summarizer) expire() []*Summary {
+	if s.expiry <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.lastSweep) < time.Minute {
+		return nil
+	}
+	s.lastSweep = now
+	var expired []*Summary
+	for key, summary := range s.tasks {
+		if now.Sub(summary.End) > s.expiry {
+			summary.Expired = true
+			expired = append(expired, summary)
+			delete(s.tasks, key)
+			localSummaryExpired.Inc()
+		}
+	}
+	return expired
+}
+
+func newSummary(client, id string, body tq.AcctRequest, now time.Time, startMissed bool) *Summary {
+	s := &Summary{
+		TaskID:      id,
+		User:        string(body.User),
+		Port:        string(body.Port),
+		RemAddr:     string(body.RemAddr),
+		Client:      client,
+		Start:       now,
+		StartMissed: startMissed,
+	}
+	s.update(body, now)
+	return s
+}
+
+// update records the counters carried in a record's args
+func (s *Summary) update(body tq.AcctRequest, now time.Time) {
+	s.End = now
+	s.Duration = now.Sub(s.Start).Seconds()
+	for _, arg := range body.Args {
+		a, _, v := arg.ASV()
+		var field *uint64
+		switch a {
+		case "elapsed_time":
+			field = &s.ElapsedTime
+		case "bytes_in":
+			field = &s.BytesIn
+		case "bytes_out":
+			field = &s.BytesOut
+		default:
+			continue
+		}
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			*field = n
+		}
+	}
+}
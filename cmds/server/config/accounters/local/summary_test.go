@@ -0,0 +1,94 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (nopLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+func TestSummarizer(t *testing.T) {
+	var records, raw bytes.Buffer
+	now := time.Unix(0, 0).UTC()
+	s := NewSummarizer(time.Hour)
+	s.now = func() time.Time { return now }
+	a, err := New(nopLogger{}, SetLogSink(log.New(&records, "", 0)), SetRawSink(log.New(&raw, "", 0)), SetSummarizer(s))
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), tq.ContextConnRemoteAddr, "192.0.2.1")
+	record := func(flags tq.AcctRequestFlag, args ...string) {
+		var as tq.Args
+		as.Append(args...)
+		body := *tq.NewAcctRequest(tq.SetAcctRequestFlag(flags), tq.SetAcctRequestUser("user"), tq.SetAcctRequestArgs(as))
+		b, err := json.Marshal(body)
+		require.NoError(t, err)
+		require.NoError(t, a.writeAll(tq.Request{Context: ctx}, body, b))
+	}
+	lines := func(b *bytes.Buffer) []string {
+		return strings.Split(strings.TrimSpace(b.String()), "\n")
+	}
+
+	record(tq.AcctFlagStart, "task_id=1", "service=shell")
+	for i := 1; i <= 3; i++ {
+		now = now.Add(10 * time.Minute)
+		record(tq.AcctFlagWatchdogWithUpdate, "task_id=1", "bytes_in=100", "elapsed_time=600")
+	}
+	now = now.Add(10 * time.Minute)
+	record(tq.AcctFlagWatchdog, "task_id=1")
+	now = now.Add(time.Minute)
+	record(tq.AcctFlagStop, "task_id=1", "bytes_in=500", "bytes_out=20", "elapsed_time=2460")
+	// records without a task_id are not summarized
+	record(tq.AcctFlagWatchdog, "service=shell")
+
+	assert.Len(t, lines(&raw), 7, "the raw sink has every record")
+	written := lines(&records)
+	require.Len(t, written, 3, "start, summary and the record without a task_id")
+	var summary Summary
+	require.NoError(t, json.Unmarshal([]byte(written[1]), &summary))
+	assert.Equal(t, "1", summary.TaskID)
+	assert.Equal(t, "user", summary.User)
+	assert.Equal(t, "192.0.2.1", summary.Client)
+	assert.Equal(t, float64(41*60), summary.Duration)
+	assert.Equal(t, uint64(2460), summary.ElapsedTime)
+	assert.Equal(t, uint64(500), summary.BytesIn)
+	assert.Equal(t, uint64(20), summary.BytesOut)
+	assert.Equal(t, 4, summary.Watchdogs)
+	assert.Equal(t, 3, summary.Updates)
+	assert.False(t, summary.StartMissed)
+	assert.NotNil(t, summary.Stop)
+
+	// a task that never stops is summarized once it expires
+	records.Reset()
+	record(tq.AcctFlagWatchdog, "task_id=2")
+	now = now.Add(2 * time.Hour)
+	record(tq.AcctFlagStart, "task_id=3")
+	written = lines(&records)
+	require.Len(t, written, 2)
+	summary = Summary{}
+	require.NoError(t, json.Unmarshal([]byte(written[1]), &summary))
+	assert.Equal(t, "2", summary.TaskID)
+	assert.True(t, summary.Expired)
+	assert.True(t, summary.StartMissed)
+	assert.Nil(t, summary.Stop)
+	assert.Len(t, s.tasks, 1)
+}
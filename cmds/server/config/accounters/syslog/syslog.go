@@ -41,7 +41,7 @@ func (a Accounter) New(options map[string]string) tq.Handler {
 // Handle ...
 func (a Accounter) Handle(response tq.Response, request tq.Request) {
 	var body tq.AcctRequest
-	if err := tq.Unmarshal(request.Body, &body); err != nil {
+	if err := request.Unmarshal(&body); err != nil {
 		response.Reply(
 			tq.NewAcctReply(
 				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
@@ -51,7 +51,7 @@ func (a Accounter) Handle(response tq.Response, request tq.Request) {
 		return
 	}
 
-	jsonLog, err := json.Marshal(body)
+	jsonLog, err := json.Marshal(tq.NewAcctRecord(request.Context, body))
 	if err != nil {
 		response.Reply(
 			tq.NewAcctReply(
@@ -0,0 +1,189 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	backoffInitial = 500 * time.Millisecond
+	backoffMax     = 30 * time.Second
+	// shutdownTimeout bounds the final delivery attempt once the server is stopping
+	shutdownTimeout = 5 * time.Second
+)
+
+// batch is the body of each POST
+type batch struct {
+	Records []json.RawMessage `json:"records"`
+}
+
+// permanentError is a response that will not succeed on retry, eg a 400 for a malformed batch
+type permanentError struct{ error }
+
+func newSender(l loggerProvider, c *http.Client, opts supportedOptions) *sender {
+	return &sender{loggerProvider: l, client: c, opts: opts, notify: make(chan struct{}, 1), backoff: backoffInitial}
+}
+
+// sender queues records in memory and POSTs them in batches.  The queue spills records while
+// the endpoint is unavailable, up to queue_size, after which new records are rejected.
+type sender struct {
+	loggerProvider
+	client *http.Client
+	opts   supportedOptions
+	notify chan struct{}
+	// backoff is the first delay between retries, doubling on each attempt
+	backoff time.Duration
+
+	mu    sync.Mutex
+	queue []json.RawMessage
+}
+
+// enqueue adds a record to the queue, returning false if the queue is full
+func (s *sender) enqueue(record []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) >= s.opts.queueSize {
+		webhookQueueFull.Inc()
+		return false
+	}
+	s.queue = append(s.queue, record)
+	webhookEnqueued.Inc()
+	webhookQueueDepth.Inc()
+	if len(s.queue) >= s.opts.batchSize {
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// next removes up to batch_size records from the front of the queue
+func (s *sender) next() []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.queue)
+	if n > s.opts.batchSize {
+		n = s.opts.batchSize
+	}
+	records := make([]json.RawMessage, n)
+	copy(records, s.queue)
+	s.queue = s.queue[n:]
+	return records
+}
+
+// requeue returns records that failed delivery to the front of the queue, so order is kept
+func (s *sender) requeue(records []json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(records, s.queue...)
+}
+
+// run flushes the queue every flush_interval, or sooner once a batch is ready, until ctx is done
+func (s *sender) run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			s.flush(final)
+			cancel()
+			return
+		case <-ticker.C:
+		case <-s.notify:
+		}
+		s.flush(ctx)
+	}
+}
+
+// flush sends every queued record, stopping at the first batch that cannot be delivered
+func (s *sender) flush(ctx context.Context) {
+	for {
+		records := s.next()
+		if len(records) == 0 {
+			return
+		}
+		err := s.send(ctx, records)
+		if err == nil {
+			webhookPosted.Add(float64(len(records)))
+			webhookQueueDepth.Sub(float64(len(records)))
+			continue
+		}
+		if _, ok := err.(permanentError); ok {
+			s.Errorf(ctx, "webhook [%v] rejected a batch of [%v] records, dropping it; %v", s.opts.url, len(records), err)
+			webhookDropped.Add(float64(len(records)))
+			webhookQueueDepth.Sub(float64(len(records)))
+			continue
+		}
+		s.Errorf(ctx, "unable to deliver [%v] records to webhook [%v], they remain queued; %v", len(records), s.opts.url, err)
+		s.requeue(records)
+		return
+	}
+}
+
+// send POSTs records, retrying with exponential backoff
+func (s *sender) send(ctx context.Context, records []json.RawMessage) error {
+	body, err := json.Marshal(batch{Records: records})
+	if err != nil {
+		return permanentError{err}
+	}
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		err = s.post(ctx, body)
+		if _, ok := err.(permanentError); err == nil || ok || attempt >= s.opts.retries {
+			return err
+		}
+		webhookRetry.Inc()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > backoffMax {
+			backoff = backoffMax
+		}
+	}
+}
+
+func (s *sender) post(ctx context.Context, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.opts.authorization != "" {
+		req.Header.Set("Authorization", s.opts.authorization)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		webhookPostError.Inc()
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		webhookPostError.Inc()
+		return fmt.Errorf("unexpected status [%v]", resp.Status)
+	}
+	webhookPostError.Inc()
+	return permanentError{fmt.Errorf("unexpected status [%v]", resp.Status)}
+}
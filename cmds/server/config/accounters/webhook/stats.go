@@ -0,0 +1,66 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package webhook
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	webhookEnqueued = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "webhook_enqueued",
+		Help:      "number of accounting records queued for the webhook",
+	})
+	webhookQueueFull = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "webhook_queue_full",
+		Help:      "number of accounting records rejected because the webhook queue was full",
+	})
+	webhookQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "webhook_queue_depth",
+		Help:      "number of accounting records waiting to be sent to the webhook",
+	})
+	webhookPosted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "webhook_posted",
+		Help:      "number of accounting records delivered to the webhook",
+	})
+	webhookDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "webhook_dropped",
+		Help:      "number of accounting records dropped after the webhook permanently rejected them",
+	})
+	webhookPostError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "webhook_post_error",
+		Help:      "number of failed webhook POSTs",
+	})
+	webhookRetry = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "webhook_retry",
+		Help:      "number of webhook POSTs retried after a failure",
+	})
+	webhookBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "webhook_bad_config",
+		Help:      "number of webhook accounters created with invalid options",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(webhookEnqueued)
+	prometheus.MustRegister(webhookQueueFull)
+	prometheus.MustRegister(webhookQueueDepth)
+	prometheus.MustRegister(webhookPosted)
+	prometheus.MustRegister(webhookDropped)
+	prometheus.MustRegister(webhookPostError)
+	prometheus.MustRegister(webhookRetry)
+	prometheus.MustRegister(webhookBadConfig)
+}
@@ -0,0 +1,241 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package webhook supports sending Accounting data in JSON format to an HTTP endpoint.  Records
+// are batched and POSTed in the background, with retries, so a slow or unavailable endpoint does
+// not hold up accounting replies to devices.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// loggerProvider provides the logging implementation for local server events
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultTimeout       = 10 * time.Second
+	defaultRetries       = 3
+	defaultQueueSize     = 10000
+)
+
+// supportedOptions map will be unmarshaled into this type
+//
+// url - the http or https endpoint records are POSTed to, required
+// batch_size - the maximum number of records sent in one POST
+// flush_interval - how often queued records are sent, a go duration, eg 1s
+// timeout - time to wait for each POST, a go duration
+// retries - the number of additional attempts, with backoff, after a POST fails
+// queue_size - the number of records held in memory while the endpoint is unavailable
+// authorization - optional, sent as the Authorization header, eg "Bearer <token>"
+func newSupportedOptions(options map[string]string) (supportedOptions, error) {
+	opts := supportedOptions{
+		url:           options["url"],
+		authorization: options["authorization"],
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		timeout:       defaultTimeout,
+		retries:       defaultRetries,
+		queueSize:     defaultQueueSize,
+	}
+	for _, d := range []struct {
+		name string
+		v    *time.Duration
+	}{{"flush_interval", &opts.flushInterval}, {"timeout", &opts.timeout}} {
+		if v, ok := options[d.name]; ok {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %v option [%v] for webhook accounter; %v", d.name, v, err)
+			}
+			*d.v = parsed
+		}
+	}
+	for _, n := range []struct {
+		name string
+		v    *int
+	}{{"batch_size", &opts.batchSize}, {"retries", &opts.retries}, {"queue_size", &opts.queueSize}} {
+		if v, ok := options[n.name]; ok {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %v option [%v] for webhook accounter; %v", n.name, v, err)
+			}
+			*n.v = parsed
+		}
+	}
+	return opts, nil
+}
+
+type supportedOptions struct {
+	url           string
+	authorization string
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	retries       int
+	queueSize     int
+}
+
+func (s supportedOptions) validate() error {
+	if s.url == "" {
+		return fmt.Errorf("missing required option [url] for webhook accounter")
+	}
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return fmt.Errorf("invalid url option [%v] for webhook accounter; %v", s.url, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url option [%v] for webhook accounter must be http or https", s.url)
+	}
+	if s.batchSize <= 0 || s.queueSize <= 0 {
+		return fmt.Errorf("batch_size and queue_size must be positive for webhook accounter")
+	}
+	if s.flushInterval <= 0 || s.timeout <= 0 {
+		return fmt.Errorf("flush_interval and timeout must be positive for webhook accounter")
+	}
+	if s.retries < 0 {
+		return fmt.Errorf("retries cannot be negative for webhook accounter")
+	}
+	return nil
+}
+
+// Option is the setter type for Accounter
+type Option func(a *Accounter)
+
+// SetHTTPClient overrides the client used to POST records, eg to configure tls
+func SetHTTPClient(c *http.Client) Option {
+	return func(a *Accounter) {
+		a.client = c
+	}
+}
+
+// New webhook Accounter.  Senders run until ctx is done, when queued records are given one last
+// attempt at delivery.
+func New(ctx context.Context, l loggerProvider, opts ...Option) *Accounter {
+	a := &Accounter{
+		ctx:            ctx,
+		loggerProvider: l,
+		client:         &http.Client{},
+		senders:        &senders{m: make(map[supportedOptions]*sender)},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// senders holds a sender per distinct set of options.  Users configured with the same options
+// share a sender, and a sender survives config reloads.
+type senders struct {
+	sync.Mutex
+	m map[supportedOptions]*sender
+}
+
+// Accounter POSTs accounting records to a webhook
+type Accounter struct {
+	loggerProvider
+	ctx     context.Context
+	client  *http.Client
+	senders *senders
+	sender  *sender
+}
+
+// New creates a new webhook accounter.  Invalid options are logged and produce an accounter that
+// replies with errors, since accounting would otherwise be silently lost.
+func (a Accounter) New(options map[string]string) tq.Handler {
+	opts, err := newSupportedOptions(options)
+	if err == nil {
+		err = opts.validate()
+	}
+	if err != nil {
+		a.Errorf(a.ctx, "webhook accounter is unavailable; %v", err)
+		webhookBadConfig.Inc()
+		return &Accounter{loggerProvider: a.loggerProvider, ctx: a.ctx}
+	}
+	a.senders.Lock()
+	defer a.senders.Unlock()
+	s, ok := a.senders.m[opts]
+	if !ok {
+		s = newSender(a.loggerProvider, a.client, opts)
+		a.senders.m[opts] = s
+		go s.run(a.ctx)
+	}
+	return &Accounter{loggerProvider: a.loggerProvider, ctx: a.ctx, sender: s}
+}
+
+// Record is a single accounting record as sent to the webhook
+type Record struct {
+	Time time.Time `json:"time"`
+	// Client is the address of the device that sent the record
+	Client string         `json:"client,omitempty"`
+	Record tq.AcctRequest `json:"record"`
+	// Metadata are the fields the server enriched the record with, if any
+	Metadata tq.AcctMetadata `json:"metadata,omitempty"`
+}
+
+// Handle ...
+func (a Accounter) Handle(response tq.Response, request tq.Request) {
+	var body tq.AcctRequest
+	if err := request.Unmarshal(&body); err != nil {
+		response.Reply(
+			tq.NewAcctReply(
+				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+				tq.SetAcctReplyServerMsg("accounting failure"),
+			),
+		)
+		return
+	}
+	if a.sender == nil {
+		response.Reply(
+			tq.NewAcctReply(
+				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+				tq.SetAcctReplyServerMsg("accounting is misconfigured"),
+			),
+		)
+		return
+	}
+	client, _ := request.Context.Value(tq.ContextConnRemoteAddr).(string)
+	record, err := json.Marshal(Record{Time: time.Now(), Client: client, Record: body, Metadata: tq.AcctMetadataFromContext(request.Context)})
+	if err != nil {
+		response.Reply(
+			tq.NewAcctReply(
+				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+				tq.SetAcctReplyServerMsg("failed to log accounting message"),
+			),
+		)
+		a.Errorf(request.Context, "failed to marshal accounting record: %v", err)
+		return
+	}
+	if !a.sender.enqueue(record) {
+		// the device may send the record to another server instead
+		response.Reply(
+			tq.NewAcctReply(
+				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+				tq.SetAcctReplyServerMsg("accounting queue is full"),
+			),
+		)
+		return
+	}
+	response.Reply(
+		tq.NewAcctReply(
+			tq.SetAcctReplyStatus(tq.AcctReplyStatusSuccess),
+		),
+	)
+}
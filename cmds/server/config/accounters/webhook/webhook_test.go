@@ -0,0 +1,178 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// fakeWebhook records the batches it receives, failing the first fail requests
+type fakeWebhook struct {
+	sync.Mutex
+	fail     int
+	status   int
+	batches  []batch
+	requests int
+	auth     string
+}
+
+func (f *fakeWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests++
+	f.auth = r.Header.Get("Authorization")
+	if f.fail > 0 {
+		f.fail--
+		w.WriteHeader(f.status)
+		return
+	}
+	var b batch
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.batches = append(f.batches, b)
+}
+
+func (f *fakeWebhook) records() int {
+	f.Lock()
+	defer f.Unlock()
+	var n int
+	for _, b := range f.batches {
+		n += len(b.Records)
+	}
+	return n
+}
+
+func newRequest(t *testing.T, user string) tq.Request {
+	b, err := tq.NewAcctRequest(
+		tq.SetAcctRequestFlag(tq.AcctFlagStart),
+		tq.SetAcctRequestUser(tq.AuthenUser(user)),
+		tq.SetAcctRequestArgs(tq.Args{"task_id=1", "service=shell"}),
+	).MarshalBinary()
+	require.NoError(t, err)
+	return tq.Request{Body: b, Context: context.WithValue(context.Background(), tq.ContextConnRemoteAddr, "192.0.2.1")}
+}
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]string
+		valid   bool
+	}{
+		{name: "defaults", options: map[string]string{"url": "https://audit.example.com/tacacs"}, valid: true},
+		{name: "missing url", options: map[string]string{}},
+		{name: "bad scheme", options: map[string]string{"url": "ftp://audit.example.com"}},
+		{name: "bad duration", options: map[string]string{"url": "http://a", "flush_interval": "soon"}},
+		{name: "bad batch size", options: map[string]string{"url": "http://a", "batch_size": "0"}},
+		{name: "negative retries", options: map[string]string{"url": "http://a", "retries": "-1"}},
+	}
+	for _, test := range tests {
+		opts, err := newSupportedOptions(test.options)
+		if err == nil {
+			err = opts.validate()
+		}
+		assert.Equal(t, test.valid, err == nil, "%v; %v", test.name, err)
+	}
+}
+
+func TestBatching(t *testing.T) {
+	hook := &fakeWebhook{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := New(ctx, mockLogger{})
+	h := a.New(map[string]string{"url": server.URL, "batch_size": "2", "flush_interval": "1h", "authorization": "Bearer secret"})
+	// the same options share a sender
+	assert.Same(t, h.(*Accounter).sender, a.New(map[string]string{"url": server.URL, "batch_size": "2", "flush_interval": "1h", "authorization": "Bearer secret"}).(*Accounter).sender)
+
+	for i := 0; i < 4; i++ {
+		resp := &configtest.Response{}
+		h.Handle(resp, newRequest(t, "mr_uses_group"))
+		require.NotNil(t, resp.Acct)
+		assert.Equal(t, tq.AcctReplyStatusSuccess, resp.Acct.Status)
+	}
+	assert.Eventually(t, func() bool { return hook.records() == 4 }, 5*time.Second, 10*time.Millisecond)
+	hook.Lock()
+	defer hook.Unlock()
+	assert.Equal(t, "Bearer secret", hook.auth)
+	for _, b := range hook.batches {
+		assert.LessOrEqual(t, len(b.Records), 2)
+	}
+	var r Record
+	require.NoError(t, json.Unmarshal(hook.batches[0].Records[0], &r))
+	assert.Equal(t, "192.0.2.1", r.Client)
+	assert.Equal(t, tq.AuthenUser("mr_uses_group"), r.Record.User)
+}
+
+func TestSpill(t *testing.T) {
+	hook := &fakeWebhook{fail: 3, status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+	opts, err := newSupportedOptions(map[string]string{"url": server.URL, "batch_size": "10", "retries": "1", "queue_size": "3"})
+	require.NoError(t, err)
+	s := newSender(mockLogger{}, server.Client(), opts)
+	s.backoff = time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, s.enqueue([]byte(`{}`)))
+	}
+	assert.False(t, s.enqueue([]byte(`{}`)), "the queue is full")
+
+	// a retry then give up, the records stay queued
+	s.flush(context.Background())
+	assert.Len(t, s.queue, 3)
+	assert.Equal(t, 2, hook.requests)
+
+	// the endpoint recovers after one more failure, which the retry covers
+	s.flush(context.Background())
+	assert.Empty(t, s.queue)
+	assert.Equal(t, 3, hook.records())
+}
+
+func TestPermanentFailure(t *testing.T) {
+	hook := &fakeWebhook{fail: 1, status: http.StatusBadRequest}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+	opts, err := newSupportedOptions(map[string]string{"url": server.URL, "retries": "3"})
+	require.NoError(t, err)
+	s := newSender(mockLogger{}, server.Client(), opts)
+	s.backoff = time.Millisecond
+
+	assert.True(t, s.enqueue([]byte(`{}`)))
+	s.flush(context.Background())
+	assert.Empty(t, s.queue, "rejected batches are dropped")
+	assert.Equal(t, 1, hook.requests, "rejected batches are not retried")
+}
+
+func TestMisconfigured(t *testing.T) {
+	h := New(context.Background(), mockLogger{}).New(map[string]string{})
+	resp := &configtest.Response{}
+	h.Handle(resp, newRequest(t, "mr_uses_group"))
+	require.NotNil(t, resp.Acct)
+	assert.Equal(t, tq.AcctReplyStatusError, resp.Acct.Status)
+}
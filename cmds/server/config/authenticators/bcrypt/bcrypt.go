@@ -74,9 +74,23 @@ func (s supportedOptions) validate() error {
 	return nil
 }
 
+// Option is the setter type for Authenticator
+type Option func(a *Authenticator)
+
+// SetPool runs verifications on a bounded pool of workers instead of the request goroutine
+func SetPool(p *Pool) Option {
+	return func(a *Authenticator) {
+		a.pool = p
+	}
+}
+
 // New Bcrypt Authenticator
-func New(l loggerProvider, s getSecret) *Authenticator {
-	return &Authenticator{loggerProvider: l}
+func New(l loggerProvider, s getSecret, opts ...Option) *Authenticator {
+	a := &Authenticator{loggerProvider: l}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 // Authenticator with bcrypt password hashing used for validation
@@ -87,6 +101,8 @@ type Authenticator struct {
 	supportedOptions
 
 	getSecret
+	// pool if set, bounds concurrent verifications
+	pool *Pool
 }
 
 // New creates a new bcrypt authenticator which implements tq.Config
@@ -95,7 +111,7 @@ func (a Authenticator) New(username string, options map[string]string) (tq.Handl
 	if err := opts.validate(); err != nil {
 		return nil, err
 	}
-	return &Authenticator{loggerProvider: a.loggerProvider, username: username, supportedOptions: opts}, nil
+	return &Authenticator{loggerProvider: a.loggerProvider, username: username, supportedOptions: opts, pool: a.pool}, nil
 }
 
 // Handle handles all authenticate message types, scoped to the uid
@@ -139,7 +155,18 @@ func (a Authenticator) Handle(response tq.Response, request tq.Request) {
 		expectedHash = secret
 	}
 
-	if err := bcrypt.CompareHashAndPassword(expectedHash, []byte(password)); err == nil {
+	err = a.compare(request.Context, expectedHash, []byte(password))
+	if err == errSaturated || err == errQueueTimeout {
+		a.Errorf(request.Context, "unable to validate the user [%v] using a bcrypt password; %v", a.username, err)
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("server busy, try again"),
+			),
+		)
+		return
+	}
+	if err == nil {
 		a.Infof(request.Context, "accepting user [%v] using a bcrypt password", a.username)
 		response.Reply(
 			tq.NewAuthenReply(
@@ -157,3 +184,11 @@ func (a Authenticator) Handle(response tq.Response, request tq.Request) {
 		),
 	)
 }
+
+// compare checks password against hash, on the pool if there is one
+func (a Authenticator) compare(ctx context.Context, hash, password []byte) error {
+	if a.pool == nil {
+		return bcrypt.CompareHashAndPassword(hash, password)
+	}
+	return a.pool.compare(ctx, hash, password)
+}
@@ -5,7 +5,8 @@
  LICENSE file in the root directory of this source tree.
 */
 
-// Package main provides a utility to create or verify bcrypt strings used by the bcrypt authenticator
+// Package main provides a utility to create or verify bcrypt strings used by the bcrypt authenticator,
+// and argon2id or scrypt PHC strings used by the phc authenticators
 package main
 
 import (
@@ -14,14 +15,18 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/phc"
+
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/term"
 )
 
 var (
-	mode = flag.String("mode", "", "supported password hashing modes: [bcrypt, verify-bcrypt]")
+	mode = flag.String("mode", "", "supported password hashing modes: "+modes)
 )
 
+const modes = "[bcrypt, verify-bcrypt, argon2id, scrypt, verify]"
+
 func main() {
 	flag.Parse()
 	verifyFlags()
@@ -47,6 +52,28 @@ func main() {
 			os.Exit(1)
 		}
 		fmt.Println("password validation success")
+	case "argon2id", "scrypt":
+		password := getPassword("Enter Password (echo is off): ")
+		var encoded string
+		var err error
+		if *mode == "argon2id" {
+			encoded, err = phc.HashArgon2id(password, phc.DefaultArgon2Params)
+		} else {
+			encoded, err = phc.HashScrypt(password, phc.DefaultScryptParams)
+		}
+		if err != nil {
+			fmt.Printf("hash generation failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%v phc string: %v\n", *mode, encoded)
+	case "verify":
+		password := getPassword("Enter Password (echo is off): ")
+		encoded := getPassword("Enter phc string or bcrypt hash (echo is off): ")
+		if err := phc.Verify(encoded, password); err != nil {
+			fmt.Printf("password validation failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%v password validation success\n", phc.Scheme(encoded))
 	default:
 		fmt.Printf("unknown mode [%v]\n", *mode)
 	}
@@ -54,7 +81,7 @@ func main() {
 
 func verifyFlags() {
 	if *mode == "" {
-		fmt.Println("supported password hashing modes: [bcrypt, verify-bcrypt], please provide one")
+		fmt.Printf("supported password hashing modes: %v, please provide one\n", modes)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,105 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package bcrypt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// errSaturated is returned when the pool's queue is full
+	errSaturated = errors.New("bcrypt verification queue is full")
+	// errQueueTimeout is returned when a verification waited too long for a worker
+	errQueueTimeout = errors.New("timed out waiting for a bcrypt worker")
+)
+
+// verification is a single password check, queued for a worker
+type verification struct {
+	ctx      context.Context
+	hash     []byte
+	password []byte
+	result   chan error
+}
+
+// NewPool starts workers goroutines dedicated to bcrypt verification.  Up to queue verifications
+// wait for a worker, for at most wait, before being rejected.  A wait of 0 waits as long as the
+// request allows.
+func NewPool(workers, queue int, wait time.Duration) *Pool {
+	p := &Pool{queue: make(chan verification, queue), wait: wait, done: make(chan struct{})}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Pool bounds the cpu spent on bcrypt.  Bcrypt is deliberately expensive, and a burst of logins
+// would otherwise take every core, adding latency to authorization and accounting traffic served
+// by the same process.  Workers are started up front so the first logins don't pay for them.
+type Pool struct {
+	queue chan verification
+	wait  time.Duration
+	done  chan struct{}
+	once  sync.Once
+	wg    sync.WaitGroup
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.done:
+			return
+		case v := <-p.queue:
+			bcryptPoolQueueDepth.Set(float64(len(p.queue)))
+			if v.ctx.Err() != nil {
+				// the caller gave up while queued, don't spend cpu on it
+				continue
+			}
+			bcryptPoolActive.Inc()
+			v.result <- bcrypt.CompareHashAndPassword(v.hash, v.password)
+			bcryptPoolActive.Dec()
+		}
+	}
+}
+
+// compare has a worker run bcrypt.CompareHashAndPassword.  It fails fast with errSaturated if the
+// queue is full.
+func (p *Pool) compare(ctx context.Context, hash, password []byte) error {
+	if p.wait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.wait)
+		defer cancel()
+	}
+	v := verification{ctx: ctx, hash: hash, password: password, result: make(chan error, 1)}
+	select {
+	case p.queue <- v:
+		bcryptPoolQueueDepth.Set(float64(len(p.queue)))
+	default:
+		bcryptPoolRejected.Inc()
+		return errSaturated
+	}
+	select {
+	case err := <-v.result:
+		return err
+	case <-ctx.Done():
+		bcryptPoolTimeout.Inc()
+		return errQueueTimeout
+	}
+}
+
+// Close stops the workers, queued verifications time out
+func (p *Pool) Close() {
+	p.once.Do(func() { close(p.done) })
+	p.wg.Wait()
+}
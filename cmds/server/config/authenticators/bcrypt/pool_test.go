@@ -0,0 +1,54 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package bcrypt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPool(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	p := NewPool(2, 4, 0)
+	defer p.Close()
+	assert.NoError(t, p.compare(context.Background(), hash, []byte("password")))
+	assert.Equal(t, bcrypt.ErrMismatchedHashAndPassword, p.compare(context.Background(), hash, []byte("wrong")))
+}
+
+func TestPoolSaturated(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	// no workers, so the single queue slot is never drained
+	p := NewPool(0, 1, 100*time.Millisecond)
+	defer p.Close()
+	queued := make(chan error)
+	go func() { queued <- p.compare(context.Background(), hash, []byte("password")) }()
+	require.Eventually(t, func() bool { return len(p.queue) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, errSaturated, p.compare(context.Background(), hash, []byte("password")))
+	assert.Equal(t, errQueueTimeout, <-queued)
+}
+
+func TestPoolSkipsAbandoned(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	p := NewPool(0, 1, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, errQueueTimeout, p.compare(ctx, hash, []byte("password")))
+	// a worker started now finds the abandoned verification and discards it
+	p.wg.Add(1)
+	go p.work()
+	require.Eventually(t, func() bool { return len(p.queue) == 0 }, time.Second, time.Millisecond)
+	p.Close()
+}
@@ -0,0 +1,42 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package bcrypt
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	bcryptPoolQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "bcrypt_pool_queue_depth",
+		Help:      "number of bcrypt verifications waiting for a worker",
+	})
+	bcryptPoolActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "bcrypt_pool_active",
+		Help:      "number of bcrypt verifications in progress",
+	})
+	bcryptPoolRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "bcrypt_pool_rejected",
+		Help:      "number of bcrypt verifications rejected because the queue was full",
+	})
+	bcryptPoolTimeout = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "bcrypt_pool_timeout",
+		Help:      "number of bcrypt verifications that timed out waiting for a worker",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(bcryptPoolQueueDepth)
+	prometheus.MustRegister(bcryptPoolActive)
+	prometheus.MustRegister(bcryptPoolRejected)
+	prometheus.MustRegister(bcryptPoolTimeout)
+}
@@ -0,0 +1,357 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package cache implements an authenticator that remembers the results of another authenticator
+// for a short time, so slow backends such as radius or kerberos are not asked again for the same
+// credentials, eg by a storm of ascii login retries.  Ascii logins are remembered by their final
+// result, keyed by every password the client gave in the session.  Only a keyed hash of the credentials is
+// kept, never the password.  Operators may flush the cache through the admin api.
+package cache
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+)
+
+// FlushPath flushes the cached results of the user query parameter, or every result without it
+const FlushPath = "/v1/authenticator-cache/flush"
+
+const (
+	defaultTTL         = 5 * time.Minute
+	defaultNegativeTTL = 30 * time.Second
+	defaultMaxEntries  = 10000
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+// supportedOptions are parsed from the authenticator options, every option is also passed to the
+// wrapped authenticator
+//
+// authenticator - the type of the wrapped authenticator, eg 3 for radius, required
+// cache_ttl - how long a passed password is remembered, a go duration, defaults to 5m, 0 disables
+// cache_negative_ttl - how long a failed password is remembered, defaults to 30s, 0 disables
+type supportedOptions struct {
+	authenticator config.AuthenticatorType
+	ttl           time.Duration
+	negativeTTL   time.Duration
+}
+
+func newSupportedOptions(options map[string]string) (supportedOptions, error) {
+	opts := supportedOptions{ttl: defaultTTL, negativeTTL: defaultNegativeTTL}
+	n, err := strconv.Atoi(options["authenticator"])
+	if err != nil {
+		return opts, fmt.Errorf("invalid authenticator option [%v] for cache authenticator, the wrapped authenticator type is required", options["authenticator"])
+	}
+	opts.authenticator = config.AuthenticatorType(n)
+	for name, dst := range map[string]*time.Duration{"cache_ttl": &opts.ttl, "cache_negative_ttl": &opts.negativeTTL} {
+		if v, ok := options[name]; ok {
+			if *dst, err = time.ParseDuration(v); err != nil || *dst < 0 {
+				return opts, fmt.Errorf("invalid %v option [%v] for cache authenticator", name, v)
+			}
+		}
+	}
+	return opts, nil
+}
+
+// Option is the setter type for Authenticator
+type Option func(a *Authenticator)
+
+// SetMaxEntries bounds the number of cached results, the oldest are evicted first.  Defaults to
+// 10000.
+func SetMaxEntries(n int) Option {
+	return func(a *Authenticator) {
+		a.store.max = n
+	}
+}
+
+// New cache Authenticator, wrapping the authenticators of factories
+func New(l loggerProvider, factories map[config.AuthenticatorType]authenticators.Factory, opts ...Option) *Authenticator {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("unable to generate the cache key; %v", err))
+	}
+	a := &Authenticator{
+		loggerProvider: l,
+		factories:      factories,
+		store:          &store{key: key, entries: make(map[string]*entry), max: defaultMaxEntries, now: time.Now},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Authenticator remembers the pass and fail replies of the wrapped authenticator
+type Authenticator struct {
+	loggerProvider
+	authenticators.Methods
+	factories map[config.AuthenticatorType]authenticators.Factory
+	// store is shared by every user, and survives config reloads
+	store *store
+
+	username string
+	supportedOptions
+	// fingerprint changes with the user's options, eg a new password hash, so a reloaded config
+	// does not reuse results of the old one
+	fingerprint []byte
+	next        tq.Handler
+}
+
+// New creates a new cache authenticator for username which implements tq.Handler
+func (a Authenticator) New(username string, options map[string]string) (tq.Handler, error) {
+	opts, err := newSupportedOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := a.factories[opts.authenticator]
+	if !ok {
+		return nil, fmt.Errorf("cache authenticator cannot wrap authenticator type [%v]", opts.authenticator)
+	}
+	next, err := f.New(username, options)
+	if err != nil {
+		return nil, err
+	}
+	a.username = username
+	a.supportedOptions = opts
+	a.fingerprint = fingerprint(options)
+	a.next = next
+	return &a, nil
+}
+
+// fingerprint hashes options in a stable order
+func fingerprint(options map[string]string) []byte {
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%d:%v%d:%v", len(k), k, len(options[k]), options[k])
+	}
+	return h.Sum(nil)
+}
+
+// Handle answers from the cache, or asks the wrapped authenticator and remembers its answer.  CHAP
+// requests are always passed through, their responses differ on every login.  Ascii logins reach
+// the cache with the continue packet holding the password, from the ascii handler, or with a start
+// packet that holds none when the wrapped authenticator prompts itself; the continue packets its
+// prompts are answered with are then looked up by every answer the client gave so far.
+func (a *Authenticator) Handle(response tq.Response, request tq.Request) {
+	a.handle(a.next, nil, response, request)
+}
+
+// handle answers request from the cache, or passes it to next.  answers are the passwords the
+// client gave earlier in the session, to the prompts of the wrapped authenticator.
+func (a *Authenticator) handle(next tq.Handler, answers []string, response tq.Response, request tq.Request) {
+	password, err := a.GetPassword(request)
+	if err != nil {
+		next.Handle(response, request)
+		return
+	}
+	if password == "" {
+		// nothing to look up, eg an ascii start, but the client's answers to prompts may be
+		next.Handle(tq.WrapResponse(&cacheResponse{Response: response, a: a, answers: answers}, response), request)
+		return
+	}
+	answers = append(answers[:len(answers):len(answers)], password)
+	k := a.store.hash(a.username, answers, a.fingerprint)
+	if pass, ok := a.store.get(k); ok {
+		status, result := tq.AuthenStatusFail, "fail"
+		if pass {
+			status, result = tq.AuthenStatusPass, "pass"
+		}
+		cacheHit.WithLabelValues(result).Inc()
+		a.Infof(request.Context, "answering user [%v] with a cached %v", a.username, result)
+		reply := tq.NewAuthenReply(tq.SetAuthenReplyStatus(status))
+		if !pass {
+			reply.ServerMsg = tq.AuthenServerMsg("login failure")
+		}
+		response.Reply(reply)
+		return
+	}
+	cacheMiss.Inc()
+	next.Handle(tq.WrapResponse(&cacheResponse{Response: response, a: a, key: k, answers: answers}, response), request)
+}
+
+// cacheResponse remembers the final reply of the wrapped authenticator, and passes the client's
+// answers to its prompts through the cache
+type cacheResponse struct {
+	tq.Response
+	a *Authenticator
+	// key is empty if the request had no password to remember the reply by
+	key     string
+	answers []string
+}
+
+// Next implements tq.Response
+func (r *cacheResponse) Next(next tq.Handler) {
+	r.Response.Next(tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		r.a.handle(next, r.answers, response, request)
+	}))
+}
+
+// Reply implements tq.Response
+func (r *cacheResponse) Reply(v tq.EncoderDecoder) (int, error) {
+	r.remember(v)
+	return r.Response.Reply(v)
+}
+
+// ReplyWithContext implements tq.Response
+func (r *cacheResponse) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writers ...tq.Writer) (int, error) {
+	r.remember(v)
+	return r.Response.ReplyWithContext(ctx, v, writers...)
+}
+
+// remember stores pass and fail replies, errors, eg an unreachable backend, are never cached
+func (r *cacheResponse) remember(v tq.EncoderDecoder) {
+	reply, ok := v.(*tq.AuthenReply)
+	if !ok || r.key == "" {
+		return
+	}
+	switch {
+	case reply.Status == tq.AuthenStatusPass && r.a.ttl > 0:
+		r.a.store.set(r.key, r.a.username, true, r.a.ttl)
+	case reply.Status == tq.AuthenStatusFail && r.a.negativeTTL > 0:
+		r.a.store.set(r.key, r.a.username, false, r.a.negativeTTL)
+	}
+}
+
+// Flush drops the cached results of user, or every result if user is empty, returning how many
+func (a *Authenticator) Flush(user string) int {
+	return a.store.flush(user)
+}
+
+// ServeFlush flushes the cached results of the user query parameter, or every result without it
+func (a *Authenticator) ServeFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := r.URL.Query().Get("user")
+	n := a.Flush(user)
+	if user == "" {
+		a.Infof(r.Context(), "the authenticator cache was flushed by the admin api, [%v] results dropped", n)
+	} else {
+		a.Infof(r.Context(), "the cached results of user [%v] were flushed by the admin api, [%v] results dropped", user, n)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "{\"flushed\":%d}\n", n)
+}
+
+// store holds the cached results by a keyed hash of the credentials
+type store struct {
+	// key makes the hashes useless to anyone reading the process memory without it
+	key []byte
+	max int
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	user    string
+	pass    bool
+	expires time.Time
+}
+
+// hash returns the cache key of a user's credentials, the passwords given in a session in order
+func (s *store) hash(user string, passwords []string, fingerprint []byte) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%d:%v", len(user), user)
+	for _, password := range passwords {
+		fmt.Fprintf(mac, "%d:%v", len(password), password)
+	}
+	mac.Write(fingerprint)
+	return string(mac.Sum(nil))
+}
+
+// get returns the cached result of k, if it has not expired
+func (s *store) get(k string) (bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[k]
+	if !ok {
+		return false, false
+	}
+	if !s.now().Before(e.expires) {
+		delete(s.entries, k)
+		cacheEntries.Set(float64(len(s.entries)))
+		return false, false
+	}
+	return e.pass, true
+}
+
+// set caches a result of user for ttl, making room if the cache is full
+func (s *store) set(k, user string, pass bool, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if _, ok := s.entries[k]; !ok && len(s.entries) >= s.max {
+		s.evict(now)
+	}
+	if s.max > 0 {
+		s.entries[k] = &entry{user: user, pass: pass, expires: now.Add(ttl)}
+	}
+	cacheEntries.Set(float64(len(s.entries)))
+}
+
+// evict drops the expired results, or if none have, the one closest to expiring.  The caller must
+// hold the lock.
+func (s *store) evict(now time.Time) {
+	var oldest string
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+			continue
+		}
+		if oldest == "" || e.expires.Before(s.entries[oldest].expires) {
+			oldest = k
+		}
+	}
+	if len(s.entries) >= s.max && oldest != "" {
+		delete(s.entries, oldest)
+		cacheEvicted.Inc()
+	}
+}
+
+// flush drops the results of user, or every result if user is empty, returning how many had not
+// expired
+func (s *store) flush(user string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	n := 0
+	for k, e := range s.entries {
+		if user == "" || e.user == user {
+			delete(s.entries, k)
+			if now.Before(e.expires) {
+				n++
+			}
+		}
+	}
+	cacheFlushed.Add(float64(n))
+	cacheEntries.Set(float64(len(s.entries)))
+	return n
+}
@@ -0,0 +1,195 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// backend passes the password option, counting how often it is asked.  It answers with an error
+// while down, and prompts for the password of ascii starts if prompt is set.
+type backend struct {
+	calls  int
+	down   bool
+	prompt bool
+}
+
+func (b *backend) New(username string, options map[string]string) (tq.Handler, error) {
+	return &backendAuthenticator{backend: b, password: options["password"]}, nil
+}
+
+type backendAuthenticator struct {
+	authenticators.Methods
+	*backend
+	password string
+}
+
+func (a *backendAuthenticator) Handle(response tq.Response, request tq.Request) {
+	a.calls++
+	if password, _ := a.GetPassword(request); a.prompt && password == "" {
+		response.Next(a)
+		response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusGetPass)))
+		return
+	}
+	status := tq.AuthenStatusFail
+	if a.down {
+		status = tq.AuthenStatusError
+	} else if password, _ := a.GetPassword(request); password == a.password {
+		status = tq.AuthenStatusPass
+	}
+	response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(status)))
+}
+
+func TestCache(t *testing.T) {
+	b := &backend{}
+	a := New(mockLogger{}, map[config.AuthenticatorType]authenticators.Factory{config.RADIUS: b})
+	now := time.Unix(1700000000, 0)
+	a.store.now = func() time.Time { return now }
+	h, err := a.New("alice", map[string]string{"authenticator": "3", "password": "hunter2"})
+	require.NoError(t, err)
+
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, h, configtest.AuthenStart("hunter2")).Authen.Status)
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, h, configtest.AuthenContinue("hunter2")).Authen.Status, "ascii logins share the cache")
+	assert.Equal(t, 1, b.calls)
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, h, configtest.AuthenContinue("hunter3")).Authen.Status)
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, h, configtest.AuthenContinue("hunter3")).Authen.Status)
+	assert.Equal(t, 2, b.calls, "failures are cached too")
+
+	// failures are forgotten sooner than passes
+	now = now.Add(time.Minute)
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, h, configtest.AuthenContinue("hunter3")).Authen.Status)
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, h, configtest.AuthenContinue("hunter2")).Authen.Status)
+	assert.Equal(t, 3, b.calls)
+	now = now.Add(5 * time.Minute)
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, h, configtest.AuthenContinue("hunter2")).Authen.Status)
+	assert.Equal(t, 4, b.calls)
+
+	// errors are never cached
+	b.down = true
+	assert.Equal(t, tq.AuthenStatusError, configtest.Login(t, h, configtest.AuthenStart("swordfish")).Authen.Status)
+	b.down = false
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, h, configtest.AuthenStart("swordfish")).Authen.Status)
+	assert.Equal(t, 6, b.calls)
+
+	// a reloaded config with new options does not reuse the old results
+	h, err = a.New("alice", map[string]string{"authenticator": "3", "password": "swordfish"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, h, configtest.AuthenStart("swordfish")).Authen.Status)
+	assert.Equal(t, 7, b.calls)
+
+	// flushing forgets the results of a user
+	other, err := a.New("bob", map[string]string{"authenticator": "3", "password": "swordfish"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, other, configtest.AuthenStart("swordfish")).Authen.Status)
+	assert.Equal(t, 8, b.calls)
+	w := httptest.NewRecorder()
+	a.ServeFlush(w, httptest.NewRequest(http.MethodPost, FlushPath+"?user=alice", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var flushed struct{ Flushed int }
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &flushed))
+	assert.Equal(t, 3, flushed.Flushed)
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, h, configtest.AuthenStart("swordfish")).Authen.Status)
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, other, configtest.AuthenStart("swordfish")).Authen.Status)
+	assert.Equal(t, 9, b.calls)
+	assert.Equal(t, 2, a.Flush(""))
+
+	w = httptest.NewRecorder()
+	a.ServeFlush(w, httptest.NewRequest(http.MethodGet, FlushPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestCacheASCII(t *testing.T) {
+	b := &backend{prompt: true}
+	a := New(mockLogger{}, map[config.AuthenticatorType]authenticators.Factory{config.RADIUS: b})
+	h, err := a.New("alice", map[string]string{"authenticator": "3", "password": "hunter2"})
+	require.NoError(t, err)
+
+	// an empty pap password is not remembered, it would answer the starts of ascii logins
+	b.prompt = false
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, h, configtest.AuthenStart("")).Authen.Status)
+	b.prompt = true
+
+	// the wrapped authenticator prompts, and the answer goes through the cache
+	ascii := func(password string) tq.AuthenStatus {
+		var response configtest.Response
+		h.Handle(&response, configtest.AuthenStart(""))
+		require.Equal(t, tq.AuthenStatusGetPass, response.Authen.Status)
+		require.NotNil(t, response.NextHandler)
+		next := response.NextHandler
+		response = configtest.Response{}
+		next.Handle(&response, configtest.AuthenContinue(password))
+		require.NotNil(t, response.Authen)
+		return response.Authen.Status
+	}
+	assert.Equal(t, tq.AuthenStatusPass, ascii("hunter2"))
+	assert.Equal(t, 3, b.calls)
+	assert.Equal(t, tq.AuthenStatusPass, ascii("hunter2"))
+	assert.Equal(t, 4, b.calls, "only the prompt reached the backend")
+	assert.Equal(t, tq.AuthenStatusFail, ascii("hunter3"))
+	assert.Equal(t, tq.AuthenStatusFail, ascii("hunter3"))
+	assert.Equal(t, 7, b.calls)
+
+	// passwords prompted for by the ascii handler share the results
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, h, configtest.AuthenContinue("hunter2")).Authen.Status)
+	assert.Equal(t, 7, b.calls)
+}
+
+func TestCacheLimits(t *testing.T) {
+	b := &backend{}
+	a := New(mockLogger{}, map[config.AuthenticatorType]authenticators.Factory{config.RADIUS: b}, SetMaxEntries(2))
+	h, err := a.New("alice", map[string]string{"authenticator": "3", "password": "hunter2", "cache_negative_ttl": "0"})
+	require.NoError(t, err)
+	configtest.Login(t, h, configtest.AuthenStart("wrong"))
+	configtest.Login(t, h, configtest.AuthenStart("wrong"))
+	assert.Equal(t, 2, b.calls, "negative caching is disabled")
+
+	// the result closest to expiring is evicted once the cache is full
+	for _, user := range []string{"alice", "bob", "carol"} {
+		h, err := a.New(user, map[string]string{"authenticator": "3", "password": "hunter2"})
+		require.NoError(t, err)
+		configtest.Login(t, h, configtest.AuthenStart("hunter2"))
+		time.Sleep(time.Millisecond)
+	}
+	a.store.mu.Lock()
+	assert.Len(t, a.store.entries, 2)
+	a.store.mu.Unlock()
+	assert.Equal(t, 0, a.Flush("alice"))
+}
+
+func TestOptions(t *testing.T) {
+	a := New(mockLogger{}, map[config.AuthenticatorType]authenticators.Factory{config.RADIUS: &backend{}})
+	for _, options := range []map[string]string{
+		{},
+		{"authenticator": "1"},
+		{"authenticator": "3", "cache_ttl": "soon"},
+		{"authenticator": "3", "cache_negative_ttl": "-1s"},
+	} {
+		_, err := a.New("alice", options)
+		assert.Error(t, err, options)
+	}
+	_, err := a.New("alice", map[string]string{"authenticator": "3", "cache_ttl": "1m", "cache_negative_ttl": "0"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,48 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheHit = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authcache_hit",
+		Help:      "number of authentications answered from the authenticator cache, by cached result: pass or fail",
+	}, []string{"result"})
+	cacheMiss = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authcache_miss",
+		Help:      "number of authentications passed to the wrapped authenticator",
+	})
+	cacheEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "authcache_entries",
+		Help:      "number of results held by the authenticator cache",
+	})
+	cacheEvicted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authcache_evicted",
+		Help:      "number of unexpired results evicted because the authenticator cache was full",
+	})
+	cacheFlushed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authcache_flushed",
+		Help:      "number of results dropped by flushes of the authenticator cache",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(cacheHit)
+	prometheus.MustRegister(cacheMiss)
+	prometheus.MustRegister(cacheEntries)
+	prometheus.MustRegister(cacheEvicted)
+	prometheus.MustRegister(cacheFlushed)
+}
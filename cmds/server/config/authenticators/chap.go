@@ -0,0 +1,66 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package authenticators
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"fmt"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// chapResponseLength is the length of an md5 chap response
+const chapResponseLength = 16
+
+// CHAP holds the fields of a CHAP authenstart data field.
+// See https://datatracker.ietf.org/doc/html/rfc8907#section-5.4.2.3
+type CHAP struct {
+	ID        byte
+	Challenge []byte
+	Response  []byte
+}
+
+// ParseCHAP splits data into the ppp id, the challenge and the response.  The id is always
+// one octet and the response is always 16 octets; the challenge is the remainder.
+func ParseCHAP(data []byte) (*CHAP, error) {
+	if len(data) < 1+1+chapResponseLength {
+		return nil, fmt.Errorf("chap data is too short [%v]", len(data))
+	}
+	return &CHAP{
+		ID:        data[0],
+		Challenge: data[1 : len(data)-chapResponseLength],
+		Response:  data[len(data)-chapResponseLength:],
+	}, nil
+}
+
+// NewCHAPResponse computes the md5 chap response for password, per rfc1994
+func NewCHAPResponse(id byte, password string, challenge []byte) []byte {
+	h := md5.New()
+	h.Write([]byte{id})
+	h.Write([]byte(password))
+	h.Write(challenge)
+	return h.Sum(nil)
+}
+
+// Verify reports whether the response was computed with password.  Only authenticators with
+// access to the plaintext password can verify chap.
+func (c CHAP) Verify(password string) bool {
+	return subtle.ConstantTimeCompare(NewCHAPResponse(c.ID, password, c.Challenge), c.Response) == 1
+}
+
+// GetCHAP returns the chap fields of a CHAP authenstart packet.  ok is false if the request is not
+// a CHAP authenstart.
+func (m Methods) GetCHAP(request tq.Request) (c *CHAP, ok bool, err error) {
+	body := m.getAuthenStart(request)
+	if body == nil || body.Type != tq.AuthenTypeCHAP {
+		return nil, false, nil
+	}
+	c, err = ParseCHAP([]byte(body.Data))
+	return c, true, err
+}
@@ -0,0 +1,122 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package keychain implements an authenticator that compares passwords with the user's plaintext
+// password, looked up in the keychain rather than held in config.  Having the plaintext, it is the
+// local authenticator that can verify CHAP logins, whose responses are an md5 of the password.
+package keychain
+
+import (
+	"context"
+	"crypto/subtle"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+// getSecret is the expected behavior for fetching passwords from keychain
+// types that implement this should be thread safe
+type getSecret interface {
+	GetSecret(ctx context.Context, name, group string) ([]byte, error)
+}
+
+// supportedOptions are parsed from the authenticator options
+//
+// keychain_group - the group within keychain that holds the password
+// keychain_key - the key in the group within keychain, defaults to the username
+type supportedOptions struct {
+	group string
+	key   string
+}
+
+func newSupportedOptions(username string, options map[string]string) supportedOptions {
+	opts := supportedOptions{group: options["keychain_group"], key: options["keychain_key"]}
+	if opts.key == "" {
+		opts.key = username
+	}
+	return opts
+}
+
+// New keychain Authenticator.  s holds the passwords.
+func New(l loggerProvider, s getSecret) *Authenticator {
+	return &Authenticator{loggerProvider: l, getSecret: s}
+}
+
+// Authenticator compares the password of pap, ascii and enable requests, and the response of chap
+// requests, with the user's password in the keychain
+type Authenticator struct {
+	loggerProvider
+	authenticators.Methods
+	getSecret
+
+	username string
+	supportedOptions
+}
+
+// New creates a new keychain authenticator for username which implements tq.Handler
+func (a Authenticator) New(username string, options map[string]string) (tq.Handler, error) {
+	a.username = username
+	a.supportedOptions = newSupportedOptions(username, options)
+	return &a, nil
+}
+
+// Handle verifies the password or chap response of request
+func (a *Authenticator) Handle(response tq.Response, request tq.Request) {
+	chap, isCHAP, err := a.GetCHAP(request)
+	if err != nil {
+		keychainVerify.WithLabelValues("error").Inc()
+		a.Errorf(request.Context, "malformed chap data for user [%v]; %v", a.username, err)
+		a.reply(response, tq.AuthenStatusFail)
+		return
+	}
+	var password string
+	if !isCHAP {
+		if password, err = a.GetPassword(request); err != nil {
+			keychainVerify.WithLabelValues("error").Inc()
+			a.Errorf(request.Context, "unable to get the password of user [%v]; %v", a.username, err)
+			a.reply(response, tq.AuthenStatusFail)
+			return
+		}
+	}
+	secret, err := a.GetSecret(request.Context, a.key, a.group)
+	if err != nil {
+		keychainVerify.WithLabelValues("error").Inc()
+		a.Errorf(request.Context, "failure in keychain query for the password of user [%v]; %v", a.username, err)
+		a.reply(response, tq.AuthenStatusError)
+		return
+	}
+	var ok bool
+	if isCHAP {
+		ok = chap.Verify(string(secret))
+	} else {
+		ok = subtle.ConstantTimeCompare([]byte(password), secret) == 1
+	}
+	if !ok {
+		keychainVerify.WithLabelValues("fail").Inc()
+		a.Errorf(request.Context, "failed to validate the user [%v] using a keychain password", a.username)
+		a.reply(response, tq.AuthenStatusFail)
+		return
+	}
+	keychainVerify.WithLabelValues("pass").Inc()
+	a.Infof(request.Context, "successfully validated the user [%v] using a keychain password", a.username)
+	a.reply(response, tq.AuthenStatusPass)
+}
+
+// reply answers with status, failures do not say why
+func (a *Authenticator) reply(response tq.Response, status tq.AuthenStatus) {
+	reply := tq.NewAuthenReply(tq.SetAuthenReplyStatus(status))
+	if status != tq.AuthenStatusPass {
+		reply.ServerMsg = tq.AuthenServerMsg("login failure")
+	}
+	response.Reply(reply)
+}
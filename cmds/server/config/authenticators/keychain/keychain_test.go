@@ -0,0 +1,75 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package keychain
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// keychain holds passwords by group and name
+type keychain map[string]string
+
+func (k keychain) GetSecret(ctx context.Context, name, group string) ([]byte, error) {
+	v, ok := k[group+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("no secret [%v] in group [%v]", name, group)
+	}
+	return []byte(v), nil
+}
+
+// chap returns the data of a chap start answering challenge with password
+func chap(password string) []byte {
+	challenge := []byte("0123456789abcdef")
+	return append(append([]byte{7}, challenge...), authenticators.NewCHAPResponse(7, password, challenge)...)
+}
+
+func TestKeychain(t *testing.T) {
+	a := New(mockLogger{}, keychain{"users/alice": "hunter2", "shared/noc": "swordfish"})
+	alice, err := a.New("alice", map[string]string{"keychain_group": "users"})
+	require.NoError(t, err)
+	noc, err := a.New("alice", map[string]string{"keychain_group": "shared", "keychain_key": "noc"})
+	require.NoError(t, err)
+	bob, err := a.New("bob", map[string]string{"keychain_group": "users"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		h       tq.Handler
+		request tq.Request
+		want    tq.AuthenStatus
+	}{
+		{name: "pap", h: alice, request: configtest.AuthenStartUser(tq.AuthenTypePAP, "alice", "hunter2"), want: tq.AuthenStatusPass},
+		{name: "pap with a wrong password", h: alice, request: configtest.AuthenStartUser(tq.AuthenTypePAP, "alice", "hunter3"), want: tq.AuthenStatusFail},
+		{name: "ascii", h: alice, request: configtest.AuthenContinue("hunter2"), want: tq.AuthenStatusPass},
+		{name: "chap", h: alice, request: configtest.AuthenStartUser(tq.AuthenTypeCHAP, "alice", string(chap("hunter2"))), want: tq.AuthenStatusPass},
+		{name: "chap with a wrong password", h: alice, request: configtest.AuthenStartUser(tq.AuthenTypeCHAP, "alice", string(chap("hunter3"))), want: tq.AuthenStatusFail},
+		{name: "malformed chap", h: alice, request: configtest.AuthenStartUser(tq.AuthenTypeCHAP, "alice", "short"), want: tq.AuthenStatusFail},
+		{name: "keychain_key", h: noc, request: configtest.AuthenStartUser(tq.AuthenTypeCHAP, "alice", string(chap("swordfish"))), want: tq.AuthenStatusPass},
+		{name: "no password in the keychain", h: bob, request: configtest.AuthenStartUser(tq.AuthenTypePAP, "alice", "hunter2"), want: tq.AuthenStatusError},
+	}
+	for _, test := range tests {
+		var response configtest.Response
+		test.h.Handle(&response, test.request)
+		require.NotNil(t, response.Authen, test.name)
+		assert.Equal(t, test.want, response.Authen.Status, test.name)
+	}
+}
@@ -0,0 +1,24 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package keychain
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	keychainVerify = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "keychain_authenticator_verify",
+		Help:      "number of keychain password checks, by result: pass, fail or error",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(keychainVerify)
+}
@@ -0,0 +1,136 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package krb5
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+)
+
+// rejection is returned when the KDC refuses the credentials, as opposed to being unreachable
+type rejection struct {
+	reason string
+	// unverified is set when the service ticket could not be verified, eg the KDC was spoofed
+	unverified bool
+}
+
+// Error implements error
+func (r rejection) Error() string {
+	return r.reason
+}
+
+// rejections are the KDC errors that mean the credentials are not valid
+var rejections = []string{
+	"KDC_ERR_C_PRINCIPAL_UNKNOWN",
+	"KDC_ERR_CLIENT_REVOKED",
+	"KDC_ERR_KEY_EXPIRED",
+	"KDC_ERR_PREAUTH_FAILED",
+	"KRB_AP_ERR_BAD_INTEGRITY",
+}
+
+// client validates passwords against the KDCs of a realm as pam_krb5 does with validate set: an AS
+// exchange gets a ticket granting ticket for the user with the password, then a TGS exchange gets
+// a ticket for service, which must decrypt with the service's key in keytab.  An AS reply that
+// decrypts with the password proves nothing on its own, whoever answers for the KDC, eg with
+// spoofed udp, can make one for any password; only the real KDC knows the service key.
+type client struct {
+	realm    string
+	kdcs     []string
+	protocol string
+	timeout  time.Duration
+	service  string
+	keytab   *keytab.Keytab
+}
+
+// config returns the krb5.conf of the realm, limited to the aes cts-hmac-sha1-96 encryption types
+func (c client) config() *krbconfig.Config {
+	cfg := krbconfig.New()
+	cfg.LibDefaults.DefaultRealm = c.realm
+	cfg.LibDefaults.DNSLookupKDC = false
+	cfg.LibDefaults.DNSLookupRealm = false
+	etypes := []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96"}
+	ids := []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96}
+	cfg.LibDefaults.DefaultTktEnctypes, cfg.LibDefaults.DefaultTktEnctypeIDs = etypes, ids
+	cfg.LibDefaults.DefaultTGSEnctypes, cfg.LibDefaults.DefaultTGSEnctypeIDs = etypes, ids
+	cfg.LibDefaults.PermittedEnctypes, cfg.LibDefaults.PermittedEnctypeIDs = etypes, ids
+	if c.protocol == "tcp" {
+		cfg.LibDefaults.UDPPreferenceLimit = 1
+	}
+	cfg.Realms = []krbconfig.Realm{{Realm: c.realm, KDC: c.kdcs}}
+	return cfg
+}
+
+// login validates the password of principal.  It returns a rejection if the KDC refuses the
+// password, the AS reply does not decrypt with it, or the service ticket does not decrypt with
+// the keytab.
+func (c client) login(ctx context.Context, principal, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.validate(principal, password)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("no kdc of %v answered in time; %v", c.kdcs, ctx.Err())
+	}
+}
+
+// validate runs the AS and TGS exchanges for principal, and checks the service ticket
+func (c client) validate(principal, password string) error {
+	cl := krbclient.NewWithPassword(principal, c.realm, password, c.config(), krbclient.DisablePAFXFAST(true))
+	defer cl.Destroy()
+	if err := cl.Login(); err != nil {
+		return classify(err)
+	}
+	tkt, _, err := cl.GetServiceTicket(c.service)
+	if err != nil {
+		return classify(err)
+	}
+	if err := tkt.DecryptEncPart(c.keytab, nil); err != nil {
+		return rejection{reason: fmt.Sprintf("the ticket for [%v] does not decrypt with the keytab, the kdc may be spoofed; %v", c.service, err), unverified: true}
+	}
+	part := tkt.DecryptedEncPart
+	if !part.CName.Equal(cl.Credentials.CName()) || part.CRealm != c.realm {
+		return rejection{reason: fmt.Sprintf("the ticket for [%v] was issued to [%v@%v]", c.service, part.CName.PrincipalNameString(), part.CRealm), unverified: true}
+	}
+	if ok, err := tkt.Valid(cl.Config.LibDefaults.Clockskew); !ok {
+		return rejection{reason: fmt.Sprintf("the ticket for [%v] is not valid; %v", c.service, err), unverified: true}
+	}
+	return nil
+}
+
+// classify returns a rejection for the errors that mean the credentials are not valid: the KDC's
+// refusals, and replies that do not decrypt with the password
+func classify(err error) error {
+	e, ok := err.(krberror.Krberror)
+	if !ok {
+		return err
+	}
+	if e.RootCause == krberror.DecryptingError {
+		return rejection{reason: e.Error()}
+	}
+	if e.RootCause == krberror.KDCError {
+		for _, r := range rejections {
+			if strings.Contains(e.Error(), r) {
+				return rejection{reason: e.Error()}
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package krb5 implements an authenticator that validates passwords against a Kerberos KDC the
+// way pam_krb5 does with validate set: it requests a ticket granting ticket for the user with the
+// password, then a ticket for a service whose key is in a keytab, and accepts the password only if
+// that ticket decrypts with the key.  The aes128 and aes256 cts-hmac-sha1-96 encryption types are
+// supported.
+package krb5
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+const (
+	defaultTimeout  = 5 * time.Second
+	defaultProtocol = "tcp"
+	defaultKDCPort  = "88"
+)
+
+// supportedOptions map will be unmarshaled into this type
+//
+// realm - the kerberos realm, eg EXAMPLE.COM, required
+// kdc - comma separated host[:port] of the realm's KDCs, tried in order, required
+// keytab - path to a keytab holding the key of service, required
+// service - the service principal without the realm, eg host/tacacs.example.com, required
+// principal - the user's principal name without the realm, defaults to the username
+// protocol - tcp, the default, or udp.  Replies too big for udp are fetched over tcp.
+// timeout - time to wait for the whole validation, a go duration, eg 5s
+func newSupportedOptions(username string, options map[string]string) (supportedOptions, error) {
+	opts := supportedOptions{
+		principal: options["principal"],
+		client: client{
+			realm:    options["realm"],
+			protocol: options["protocol"],
+			service:  options["service"],
+			timeout:  defaultTimeout,
+		},
+	}
+	if opts.principal == "" {
+		opts.principal = username
+	}
+	if opts.realm == "" {
+		return opts, fmt.Errorf("missing required option [realm] for krb5 authenticator")
+	}
+	for _, kdc := range strings.Split(options["kdc"], ",") {
+		kdc = strings.TrimSpace(kdc)
+		if kdc == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(kdc); err != nil {
+			kdc = net.JoinHostPort(strings.Trim(kdc, "[]"), defaultKDCPort)
+		}
+		opts.kdcs = append(opts.kdcs, kdc)
+	}
+	if len(opts.kdcs) == 0 {
+		return opts, fmt.Errorf("missing required option [kdc] for krb5 authenticator")
+	}
+	if opts.service == "" {
+		return opts, fmt.Errorf("missing required option [service] for krb5 authenticator, passwords cannot be validated without a service ticket")
+	}
+	path := options["keytab"]
+	if path == "" {
+		return opts, fmt.Errorf("missing required option [keytab] for krb5 authenticator, passwords cannot be validated without a service key")
+	}
+	kt, err := keytab.Load(path)
+	if err != nil {
+		return opts, fmt.Errorf("unable to load keytab [%v] for krb5 authenticator; %v", path, err)
+	}
+	opts.keytab = kt
+	switch opts.protocol {
+	case "":
+		opts.protocol = defaultProtocol
+	case "udp", "tcp":
+	default:
+		return opts, fmt.Errorf("invalid protocol option [%v] for krb5 authenticator, must be udp or tcp", opts.protocol)
+	}
+	if v, ok := options["timeout"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("invalid timeout option [%v] for krb5 authenticator", v)
+		}
+		opts.timeout = d
+	}
+	return opts, nil
+}
+
+type supportedOptions struct {
+	principal string
+	client
+}
+
+// New Kerberos Authenticator
+func New(l loggerProvider) *Authenticator {
+	return &Authenticator{loggerProvider: l}
+}
+
+// Authenticator validates passwords against a Kerberos KDC
+type Authenticator struct {
+	loggerProvider
+	authenticators.Methods
+	username string
+	supportedOptions
+}
+
+// New creates a new krb5 authenticator which implements tq.Handler
+func (a Authenticator) New(username string, options map[string]string) (tq.Handler, error) {
+	opts, err := newSupportedOptions(username, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{loggerProvider: a.loggerProvider, username: username, supportedOptions: opts}, nil
+}
+
+// Handle handles all authenticate message types, scoped to the uid.  CHAP cannot be validated, the
+// KDC needs the password itself.
+func (a Authenticator) Handle(response tq.Response, request tq.Request) {
+	password, err := a.GetPassword(request)
+	if err != nil {
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg(fmt.Sprintf("%v", err)),
+			),
+		)
+		return
+	}
+	if password == "" {
+		krb5Reject.Inc()
+		a.Errorf(request.Context, "refusing an empty password for user [%v]", a.username)
+		a.fail(response)
+		return
+	}
+	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
+		krb5Duration.Observe(v * 1000)
+	}))
+	err = a.login(request.Context, a.principal, password)
+	timer.ObserveDuration()
+	if r, ok := err.(rejection); ok {
+		if r.unverified {
+			krb5Unverified.Inc()
+		}
+		krb5Reject.Inc()
+		a.Errorf(request.Context, "kdc rejected user [%v] as [%v@%v]; %v", a.username, a.principal, a.realm, err)
+		a.fail(response)
+		return
+	}
+	if err != nil {
+		krb5Error.Inc()
+		a.Errorf(request.Context, "kerberos exchange with %v failed for user [%v]; %v", a.kdcs, a.username, err)
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("authentication backend unavailable"),
+			),
+		)
+		return
+	}
+	krb5Accept.Inc()
+	a.Infof(request.Context, "accepting user [%v] as [%v@%v] via kerberos", a.username, a.principal, a.realm)
+	response.Reply(
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusPass),
+		),
+	)
+}
+
+// fail replies with a login failure that does not say why
+func (a Authenticator) fail(response tq.Response) {
+	response.Reply(
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+			tq.SetAuthenReplyServerMsg("login failure"),
+		),
+	)
+}
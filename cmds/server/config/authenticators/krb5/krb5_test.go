@@ -0,0 +1,295 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package krb5
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+const (
+	realm   = "EXAMPLE.COM"
+	service = "host/tacacs.example.com"
+)
+
+// newKeytab returns a keytab holding the aes256 key of principal derived from password
+func newKeytab(t *testing.T, principal, password string) *keytab.Keytab {
+	kt := keytab.New()
+	require.NoError(t, kt.AddEntry(principal, realm, password, time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96))
+	return kt
+}
+
+// writeKeytab writes kt to a file, returning its path
+func writeKeytab(t *testing.T, kt *keytab.Keytab) string {
+	b, err := kt.Marshal()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "krb5.keytab")
+	require.NoError(t, os.WriteFile(path, b, 0600))
+	return path
+}
+
+// fakeKDC answers AS-REQs for its users and TGS-REQs for the tickets it granted
+type fakeKDC struct {
+	t         *testing.T
+	passwords map[string]string
+	krbtgt    *keytab.Keytab
+	// service holds the key the service tickets are encrypted with
+	service *keytab.Keytab
+	// spoofed accepts any password, as whoever answers for a KDC can
+	spoofed bool
+	// tooBig answers every udp request with RESPONSE_TOO_BIG
+	tooBig bool
+}
+
+func newFakeKDC(t *testing.T, service *keytab.Keytab) *fakeKDC {
+	return &fakeKDC{
+		t:         t,
+		passwords: map[string]string{"alice": "hunter2", "bob/admin": "swordfish"},
+		krbtgt:    newKeytab(t, "krbtgt/"+realm, "krbtgt-password"),
+		service:   service,
+	}
+}
+
+func (k *fakeKDC) krbError(code int32) []byte {
+	e := messages.NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+realm), realm, code, "")
+	b, err := e.Marshal()
+	require.NoError(k.t, err)
+	return b
+}
+
+// ticket grants a ticket for sname, encrypted with the key of sname in kt
+func (k *fakeKDC) ticket(cname, sname types.PrincipalName, kt *keytab.Keytab) (messages.Ticket, messages.EncKDCRepPart) {
+	now := time.Now().UTC()
+	f := types.NewKrbFlags()
+	tkt, key, err := messages.NewTicket(cname, realm, sname, realm, f, kt, etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	require.NoError(k.t, err)
+	return tkt, messages.EncKDCRepPart{
+		Key:       key,
+		LastReqs:  []messages.LastReq{},
+		Flags:     f,
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+		SRealm:    realm,
+		SName:     sname,
+	}
+}
+
+func (k *fakeKDC) asRep(req messages.ASReq) []byte {
+	principal := req.ReqBody.CName.PrincipalNameString()
+	password, ok := k.passwords[principal]
+	if k.spoofed {
+		password, ok = "anything", true
+	}
+	if !ok {
+		return k.krbError(errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN)
+	}
+	key, _, err := crypto.GetKeyFromPassword(password, req.ReqBody.CName, realm, etypeID.AES256_CTS_HMAC_SHA1_96, nil)
+	require.NoError(k.t, err)
+	tkt, part := k.ticket(req.ReqBody.CName, req.ReqBody.SName, k.krbtgt)
+	part.Nonce = req.ReqBody.Nonce
+	b, err := part.Marshal()
+	require.NoError(k.t, err)
+	ed, err := crypto.GetEncryptedData(b, key, keyusage.AS_REP_ENCPART, 1)
+	require.NoError(k.t, err)
+	rep := messages.ASRep{KDCRepFields: messages.KDCRepFields{
+		PVNO: 5, MsgType: msgtype.KRB_AS_REP, CRealm: realm, CName: req.ReqBody.CName, Ticket: tkt, EncPart: ed,
+	}}
+	b, err = rep.Marshal()
+	require.NoError(k.t, err)
+	return b
+}
+
+func (k *fakeKDC) tgsRep(req messages.TGSReq) []byte {
+	var apReq messages.APReq
+	for _, pa := range req.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			require.NoError(k.t, apReq.Unmarshal(pa.PADataValue))
+		}
+	}
+	tgt := apReq.Ticket
+	require.NoError(k.t, tgt.DecryptEncPart(k.krbtgt, nil))
+	cname := tgt.DecryptedEncPart.CName
+	tkt, part := k.ticket(cname, req.ReqBody.SName, k.service)
+	part.Nonce = req.ReqBody.Nonce
+	b, err := part.Marshal()
+	require.NoError(k.t, err)
+	ed, err := crypto.GetEncryptedData(b, tgt.DecryptedEncPart.Key, keyusage.TGS_REP_ENCPART_SESSION_KEY, 0)
+	require.NoError(k.t, err)
+	rep := messages.TGSRep{KDCRepFields: messages.KDCRepFields{
+		PVNO: 5, MsgType: msgtype.KRB_TGS_REP, CRealm: realm, CName: cname, Ticket: tkt, EncPart: ed,
+	}}
+	b, err = rep.Marshal()
+	require.NoError(k.t, err)
+	return b
+}
+
+func (k *fakeKDC) answer(msg []byte, network string) []byte {
+	if network == "udp" && k.tooBig {
+		return k.krbError(errorcode.KRB_ERR_RESPONSE_TOO_BIG)
+	}
+	var as messages.ASReq
+	if err := as.Unmarshal(msg); err == nil {
+		return k.asRep(as)
+	}
+	var tgs messages.TGSReq
+	require.NoError(k.t, tgs.Unmarshal(msg))
+	return k.tgsRep(tgs)
+}
+
+// serve answers on udp and tcp at the same port, returning the address
+func (k *fakeKDC) serve(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		buf := make([]byte, 1<<16)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(k.answer(buf[:n], "udp"), addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var length uint32
+			if binary.Read(conn, binary.BigEndian, &length) == nil {
+				msg := make([]byte, length)
+				if _, err := io.ReadFull(conn, msg); err == nil {
+					reply := k.answer(msg, "tcp")
+					binary.Write(conn, binary.BigEndian, uint32(len(reply)))
+					conn.Write(reply)
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestAuthenticator(t *testing.T) {
+	kt := newKeytab(t, service, "service-password")
+	addr := newFakeKDC(t, kt).serve(t)
+	// nothing listens on the discard port, the next kdc is tried
+	options := map[string]string{"realm": realm, "kdc": "127.0.0.1:9, " + addr, "keytab": writeKeytab(t, kt), "service": service}
+
+	// whoever answers for the kdc cannot make a ticket that decrypts with the service key
+	spoofed := newFakeKDC(t, newKeytab(t, service, "guessed-password"))
+	spoofed.spoofed = true
+
+	tests := []struct {
+		name     string
+		username string
+		options  map[string]string
+		password string
+		expected tq.AuthenStatus
+	}{
+		{name: "pass", username: "alice", password: "hunter2", expected: tq.AuthenStatusPass},
+		{name: "wrong password", username: "alice", password: "hunter3", expected: tq.AuthenStatusFail},
+		{name: "empty password", username: "alice", password: "", expected: tq.AuthenStatusFail},
+		{name: "unknown principal", username: "mallory", password: "hunter2", expected: tq.AuthenStatusFail},
+		{name: "principal option", username: "bob", options: map[string]string{"principal": "bob/admin"}, password: "swordfish", expected: tq.AuthenStatusPass},
+		{name: "udp", username: "alice", options: map[string]string{"protocol": "udp"}, password: "hunter2", expected: tq.AuthenStatusPass},
+		{name: "spoofed kdc", username: "alice", options: map[string]string{"kdc": spoofed.serve(t)}, password: "anything", expected: tq.AuthenStatusFail},
+		{name: "unreachable", username: "alice", options: map[string]string{"kdc": "127.0.0.1:9", "timeout": "1s"}, password: "hunter2", expected: tq.AuthenStatusError},
+	}
+	for _, test := range tests {
+		merged := map[string]string{}
+		for k, v := range options {
+			merged[k] = v
+		}
+		for k, v := range test.options {
+			merged[k] = v
+		}
+		h, err := New(mockLogger{}).New(test.username, merged)
+		require.NoError(t, err, test.name)
+		var response configtest.Response
+		h.Handle(&response, configtest.AuthenStartUser(tq.AuthenTypePAP, test.username, test.password))
+		if assert.NotNil(t, response.Authen, test.name) {
+			assert.Equal(t, test.expected, response.Authen.Status, test.name)
+		}
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(krb5Unverified))
+
+	// replies too big for udp are fetched again over tcp
+	big := newFakeKDC(t, kt)
+	big.tooBig = true
+	merged := map[string]string{"protocol": "udp", "kdc": big.serve(t)}
+	for k, v := range options {
+		if _, ok := merged[k]; !ok {
+			merged[k] = v
+		}
+	}
+	h, err := New(mockLogger{}).New("alice", merged)
+	require.NoError(t, err)
+	var response configtest.Response
+	h.Handle(&response, configtest.AuthenStartUser(tq.AuthenTypePAP, "alice", "hunter2"))
+	require.NotNil(t, response.Authen)
+	assert.Equal(t, tq.AuthenStatusPass, response.Authen.Status)
+}
+
+func TestOptions(t *testing.T) {
+	path := writeKeytab(t, newKeytab(t, service, "service-password"))
+	for _, options := range []map[string]string{
+		{},
+		{"realm": realm},
+		{"kdc": "kdc.example.com"},
+		{"realm": realm, "kdc": "kdc.example.com"},
+		{"realm": realm, "kdc": "kdc.example.com", "service": service},
+		{"realm": realm, "kdc": "kdc.example.com", "keytab": path},
+		{"realm": realm, "kdc": "kdc.example.com", "service": service, "keytab": path + ".missing"},
+		{"realm": realm, "kdc": "kdc.example.com", "service": service, "keytab": path, "protocol": "sctp"},
+		{"realm": realm, "kdc": "kdc.example.com", "service": service, "keytab": path, "timeout": "-1s"},
+	} {
+		_, err := New(mockLogger{}).New("alice", options)
+		assert.Error(t, err, options)
+	}
+	opts, err := newSupportedOptions("alice", map[string]string{"realm": realm, "kdc": "kdc1.example.com, kdc2.example.com:750,[2001:db8::1]", "service": service, "keytab": path})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kdc1.example.com:88", "kdc2.example.com:750", "[2001:db8::1]:88"}, opts.kdcs)
+	assert.Equal(t, "alice", opts.principal)
+	assert.Equal(t, "tcp", opts.protocol)
+}
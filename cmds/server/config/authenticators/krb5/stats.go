@@ -0,0 +1,49 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package krb5
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	krb5Accept = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "krb5_accept",
+		Help:      "number of passwords accepted by a kerberos kdc",
+	})
+	krb5Reject = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "krb5_reject",
+		Help:      "number of passwords rejected by a kerberos kdc",
+	})
+	krb5Unverified = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "krb5_unverified",
+		Help:      "number of passwords rejected because the service ticket did not verify with the keytab",
+	})
+	krb5Error = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "krb5_error",
+		Help:      "number of failed exchanges with kerberos kdcs",
+	})
+	krb5Duration = prometheus.NewSummary(prometheus.SummaryOpts{
+		Namespace:  "tacquito",
+		Name:       "krb5_exchange_duration_milliseconds",
+		Help:       "the time in milliseconds to validate a password with a kerberos kdc",
+		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	})
+)
+
+func init() {
+	prometheus.MustRegister(krb5Accept)
+	prometheus.MustRegister(krb5Reject)
+	prometheus.MustRegister(krb5Unverified)
+	prometheus.MustRegister(krb5Error)
+	prometheus.MustRegister(krb5Duration)
+}
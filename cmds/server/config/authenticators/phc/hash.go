@@ -0,0 +1,279 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package phc
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// Argon2id is the scheme id of argon2id hashes
+	Argon2id = "argon2id"
+	// Scrypt is the scheme id of scrypt hashes
+	Scrypt = "scrypt"
+	// Bcrypt is the scheme of bcrypt hashes, whose modular crypt format is not a PHC string
+	Bcrypt = "bcrypt"
+)
+
+// ErrMismatch is returned by Verify when the password does not match the hash
+var ErrMismatch = errors.New("password does not match the hash")
+
+// b64 is the base64 encoding of salts and hashes in PHC strings
+var b64 = base64.RawStdEncoding
+
+// Hash is a parsed PHC string,
+// $<id>[$v=<version>][$<param>=<value>(,<param>=<value>)*][$<salt>[$<hash>]]
+// https://github.com/P-H-C/phc-string-format/blob/master/phc-sf-spec.md
+type Hash struct {
+	ID string
+	// Version is zero if the string has none
+	Version int
+	Params  map[string]string
+	Salt    []byte
+	Sum     []byte
+}
+
+// Parse parses a PHC string
+func Parse(encoded string) (Hash, error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 2 || fields[0] != "" || fields[1] == "" {
+		return Hash{}, fmt.Errorf("not a phc string, expected $<id>$...")
+	}
+	h := Hash{ID: fields[1], Params: map[string]string{}}
+	fields = fields[2:]
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "v=") {
+		v, err := strconv.Atoi(strings.TrimPrefix(fields[0], "v="))
+		if err != nil {
+			return Hash{}, fmt.Errorf("bad version [%v]; %v", fields[0], err)
+		}
+		h.Version = v
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && strings.Contains(fields[0], "=") {
+		for _, param := range strings.Split(fields[0], ",") {
+			name, value, ok := strings.Cut(param, "=")
+			if !ok || name == "" {
+				return Hash{}, fmt.Errorf("bad parameter [%v]", param)
+			}
+			h.Params[name] = value
+		}
+		fields = fields[1:]
+	}
+	for _, dst := range []*[]byte{&h.Salt, &h.Sum} {
+		if len(fields) == 0 {
+			break
+		}
+		b, err := b64.DecodeString(strings.TrimRight(fields[0], "="))
+		if err != nil {
+			return Hash{}, fmt.Errorf("bad base64 field [%v]; %v", fields[0], err)
+		}
+		*dst = b
+		fields = fields[1:]
+	}
+	if len(fields) > 0 {
+		return Hash{}, fmt.Errorf("unexpected fields after the hash")
+	}
+	return h, nil
+}
+
+// uintParam returns the named parameter as an integer between 1 and max
+func (h Hash) uintParam(name string, max uint64) (uint64, error) {
+	v, ok := h.Params[name]
+	if !ok {
+		return 0, fmt.Errorf("missing %v parameter [%v]", h.ID, name)
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || n < 1 || n > max {
+		return 0, fmt.Errorf("bad %v parameter [%v=%v], must be between 1 and %v", h.ID, name, v, max)
+	}
+	return n, nil
+}
+
+// Scheme returns the scheme of an encoded hash, Argon2id, Scrypt, Bcrypt or the id of a PHC string
+// of another scheme.  It returns an empty string if encoded is neither.
+func Scheme(encoded string) string {
+	if isBcrypt(encoded) {
+		return Bcrypt
+	}
+	h, err := Parse(encoded)
+	if err != nil {
+		return ""
+	}
+	return h.ID
+}
+
+// isBcrypt reports if encoded is a bcrypt hash, $2a$, $2b$ or $2y$
+func isBcrypt(encoded string) bool {
+	return len(encoded) > 4 && encoded[0] == '$' && encoded[1] == '2' && encoded[3] == '$' && strings.ContainsRune("aby", rune(encoded[2]))
+}
+
+// Check validates the parameters of an encoded hash without a password, so bad hashes are found
+// when the config loads rather than at login
+func Check(encoded string) error {
+	if isBcrypt(encoded) {
+		_, err := bcrypt.Cost([]byte(encoded))
+		return err
+	}
+	h, err := Parse(encoded)
+	if err != nil {
+		return err
+	}
+	_, err = h.key(nil)
+	return err
+}
+
+// Verify checks password against an argon2id or scrypt PHC string, or a bcrypt hash.  It returns
+// ErrMismatch if the password is wrong.
+func Verify(encoded, password string) error {
+	if isBcrypt(encoded) {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return ErrMismatch
+		}
+		return err
+	}
+	h, err := Parse(encoded)
+	if err != nil {
+		return err
+	}
+	sum, err := h.key([]byte(password))
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(sum, h.Sum) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// key derives the hash of password with the scheme and parameters of h.  A nil password only
+// validates them.
+func (h Hash) key(password []byte) ([]byte, error) {
+	if len(h.Salt) == 0 || len(h.Sum) == 0 {
+		return nil, fmt.Errorf("%v hash is missing its salt or hash", h.ID)
+	}
+	switch h.ID {
+	case Argon2id:
+		if h.Version != argon2.Version {
+			return nil, fmt.Errorf("unsupported argon2id version [%v]", h.Version)
+		}
+		m, err := h.uintParam("m", maxArgon2Memory)
+		if err != nil {
+			return nil, err
+		}
+		t, err := h.uintParam("t", 1<<16)
+		if err != nil {
+			return nil, err
+		}
+		p, err := h.uintParam("p", 255)
+		if err != nil {
+			return nil, err
+		}
+		if password == nil {
+			return nil, nil
+		}
+		return argon2.IDKey(password, h.Salt, uint32(t), uint32(m), uint8(p), uint32(len(h.Sum))), nil
+	case Scrypt:
+		ln, err := h.uintParam("ln", 30)
+		if err != nil {
+			return nil, err
+		}
+		r, err := h.uintParam("r", 1<<10)
+		if err != nil {
+			return nil, err
+		}
+		p, err := h.uintParam("p", 1<<10)
+		if err != nil {
+			return nil, err
+		}
+		if password == nil {
+			// scrypt validates its parameters before hashing, run it with the cheapest cost
+			_, err := scrypt.Key(nil, h.Salt, 2, int(r), int(p), len(h.Sum))
+			return nil, err
+		}
+		return scrypt.Key(password, h.Salt, 1<<ln, int(r), int(p), len(h.Sum))
+	}
+	return nil, fmt.Errorf("unsupported hash scheme [%v]", h.ID)
+}
+
+// maxArgon2Memory bounds the argon2id memory parameter, in KiB, to 4GiB
+const maxArgon2Memory = 1 << 22
+
+// Argon2Params are the cost parameters of new argon2id hashes
+type Argon2Params struct {
+	// Memory in KiB
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2Params are the second recommended option of rfc9106, 64MiB of memory and 3 passes
+// https://datatracker.ietf.org/doc/html/rfc9106#section-7.4
+var DefaultArgon2Params = Argon2Params{Memory: 64 << 10, Time: 3, Threads: 4, SaltLen: 16, KeyLen: 32}
+
+// ScryptParams are the cost parameters of new scrypt hashes
+type ScryptParams struct {
+	// LogN is the log2 of the cpu/memory cost N
+	LogN    uint8
+	R, P    int
+	SaltLen int
+	KeyLen  int
+}
+
+// DefaultScryptParams cost N=2^15, r=8, p=1, 32MiB of memory
+var DefaultScryptParams = ScryptParams{LogN: 15, R: 8, P: 1, SaltLen: 16, KeyLen: 32}
+
+// salt returns n random bytes
+func salt(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("unable to generate a salt; %v", err)
+	}
+	return b, nil
+}
+
+// HashArgon2id hashes password with argon2id, returning its PHC string
+func HashArgon2id(password string, p Argon2Params) (string, error) {
+	if p.Memory < 1 || p.Memory > maxArgon2Memory || p.Time < 1 || p.Threads < 1 || p.SaltLen < 8 || p.KeyLen < 16 {
+		return "", fmt.Errorf("bad argon2id parameters %+v", p)
+	}
+	s, err := salt(int(p.SaltLen))
+	if err != nil {
+		return "", err
+	}
+	sum := argon2.IDKey([]byte(password), s, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return fmt.Sprintf("$%v$v=%d$m=%d,t=%d,p=%d$%v$%v", Argon2id, argon2.Version, p.Memory, p.Time, p.Threads, b64.EncodeToString(s), b64.EncodeToString(sum)), nil
+}
+
+// HashScrypt hashes password with scrypt, returning its PHC string
+func HashScrypt(password string, p ScryptParams) (string, error) {
+	if p.LogN < 1 || p.LogN > 30 || p.SaltLen < 8 || p.KeyLen < 16 {
+		return "", fmt.Errorf("bad scrypt parameters %+v", p)
+	}
+	s, err := salt(p.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	sum, err := scrypt.Key([]byte(password), s, 1<<p.LogN, p.R, p.P, p.KeyLen)
+	if err != nil {
+		return "", fmt.Errorf("bad scrypt parameters; %v", err)
+	}
+	return fmt.Sprintf("$%v$ln=%d,r=%d,p=%d$%v$%v", Scrypt, p.LogN, p.R, p.P, b64.EncodeToString(s), b64.EncodeToString(sum)), nil
+}
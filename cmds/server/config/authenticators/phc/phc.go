@@ -0,0 +1,168 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package phc implements authenticators for passwords hashed with argon2id or scrypt, stored as
+// PHC strings, eg $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.  The generic authenticator also
+// verifies bcrypt hashes, so users can be moved off bcrypt one at a time.
+package phc
+
+import (
+	"context"
+	"fmt"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+// getSecret is the expected behavior for fetching hashes from keychain
+// types that implement this should be thread safe
+type getSecret interface {
+	GetSecret(ctx context.Context, name, group string) ([]byte, error)
+}
+
+// supportedOptions are parsed from the authenticator options
+//
+// hash - the PHC string, if present the keychain is not asked
+// group - the group within keychain that holds the hash
+// key - the key in the group within keychain, defaults to the username
+type supportedOptions struct {
+	hash  string
+	group string
+	key   string
+}
+
+func newSupportedOptions(username string, options map[string]string) supportedOptions {
+	opts := supportedOptions{hash: options["hash"], group: options["group"], key: options["key"]}
+	if opts.key == "" {
+		opts.key = username
+	}
+	return opts
+}
+
+// New returns the generic PHC authenticator, which verifies argon2id, scrypt and bcrypt hashes
+func New(l loggerProvider, s getSecret) *Authenticator {
+	return &Authenticator{loggerProvider: l, getSecret: s}
+}
+
+// NewArgon2id returns an authenticator that only accepts argon2id hashes
+func NewArgon2id(l loggerProvider, s getSecret) *Authenticator {
+	return &Authenticator{loggerProvider: l, getSecret: s, schemes: []string{Argon2id}}
+}
+
+// NewScrypt returns an authenticator that only accepts scrypt hashes
+func NewScrypt(l loggerProvider, s getSecret) *Authenticator {
+	return &Authenticator{loggerProvider: l, getSecret: s, schemes: []string{Scrypt}}
+}
+
+// Authenticator verifies passwords against PHC string hashes
+type Authenticator struct {
+	loggerProvider
+	authenticators.Methods
+	getSecret
+	username string
+	supportedOptions
+	// schemes if set, are the only hash schemes accepted
+	schemes []string
+}
+
+// New creates a new authenticator for username which implements tq.Handler
+func (a Authenticator) New(username string, options map[string]string) (tq.Handler, error) {
+	opts := newSupportedOptions(username, options)
+	if opts.hash != "" {
+		if err := a.check(opts.hash); err != nil {
+			return nil, fmt.Errorf("invalid hash option for user [%v]; %v", username, err)
+		}
+	} else if a.getSecret == nil {
+		return nil, fmt.Errorf("missing required option [hash], there is no keychain to look it up in")
+	}
+	return &Authenticator{loggerProvider: a.loggerProvider, getSecret: a.getSecret, username: username, supportedOptions: opts, schemes: a.schemes}, nil
+}
+
+// check returns an error if encoded is not a valid hash of an accepted scheme
+func (a Authenticator) check(encoded string) error {
+	scheme := Scheme(encoded)
+	if !a.accepts(scheme) {
+		return fmt.Errorf("hash scheme [%v] is not one of %v", scheme, a.schemes)
+	}
+	return Check(encoded)
+}
+
+// accepts reports if hashes of scheme are accepted
+func (a Authenticator) accepts(scheme string) bool {
+	if len(a.schemes) == 0 {
+		return scheme == Argon2id || scheme == Scrypt || scheme == Bcrypt
+	}
+	for _, s := range a.schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle handles all authenticate message types, scoped to the uid
+func (a Authenticator) Handle(response tq.Response, request tq.Request) {
+	password, err := a.GetPassword(request)
+	if err != nil {
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg(fmt.Sprintf("%v", err)),
+			),
+		)
+		return
+	}
+	encoded := a.hash
+	if encoded == "" {
+		secret, err := a.GetSecret(request.Context, a.key, a.group)
+		if err != nil {
+			a.Errorf(request.Context, "failure in keychain query for user [%v]; %v", a.username, err)
+			a.fail(response)
+			return
+		}
+		encoded = string(secret)
+		if err := a.check(encoded); err != nil {
+			a.Errorf(request.Context, "invalid hash in keychain for user [%v]; %v", a.username, err)
+			a.fail(response)
+			return
+		}
+	}
+	scheme := Scheme(encoded)
+	if err := Verify(encoded, password); err != nil {
+		phcVerify.WithLabelValues(scheme, "fail").Inc()
+		if err != ErrMismatch {
+			a.Errorf(request.Context, "unable to validate the user [%v] using a %v password; %v", a.username, scheme, err)
+		} else {
+			a.Errorf(request.Context, "failed to validate the user [%v] using a %v password", a.username, scheme)
+		}
+		a.fail(response)
+		return
+	}
+	phcVerify.WithLabelValues(scheme, "pass").Inc()
+	a.Infof(request.Context, "accepting user [%v] using a %v password", a.username, scheme)
+	response.Reply(
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusPass),
+		),
+	)
+}
+
+// fail replies with a login failure that does not say why
+func (a Authenticator) fail(response tq.Response) {
+	response.Reply(
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+			tq.SetAuthenReplyServerMsg("login failure"),
+		),
+	)
+}
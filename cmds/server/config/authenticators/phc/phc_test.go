@@ -0,0 +1,119 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package phc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// keychain holds hashes by group and name
+type keychain map[string]string
+
+func (k keychain) GetSecret(ctx context.Context, name, group string) ([]byte, error) {
+	v, ok := k[group+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("no secret [%v] in group [%v]", name, group)
+	}
+	return []byte(v), nil
+}
+
+// cheap parameters keep the tests fast
+var (
+	testArgon2Params = Argon2Params{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+	testScryptParams = ScryptParams{LogN: 4, R: 8, P: 1, SaltLen: 16, KeyLen: 32}
+)
+
+func TestVerify(t *testing.T) {
+	// the reference argon2id test vector, password "password" and salt "somesalt"
+	assert.NoError(t, Verify("$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "password"))
+
+	argon, err := HashArgon2id("hunter2", testArgon2Params)
+	require.NoError(t, err)
+	scrypted, err := HashScrypt("hunter2", testScryptParams)
+	require.NoError(t, err)
+	bcrypted, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	require.NoError(t, err)
+	for scheme, encoded := range map[string]string{Argon2id: argon, Scrypt: scrypted, Bcrypt: string(bcrypted)} {
+		assert.Equal(t, scheme, Scheme(encoded))
+		assert.NoError(t, Check(encoded), scheme)
+		assert.NoError(t, Verify(encoded, "hunter2"), scheme)
+		assert.Equal(t, ErrMismatch, Verify(encoded, "hunter3"), scheme)
+	}
+
+	for _, bad := range []string{
+		"",
+		"argon2id",
+		"$md5$salt$hash",
+		"$argon2id$v=16$m=64,t=1,p=1$c29tZXNhbHQ$CTFhFdXP",
+		"$argon2id$v=19$m=64,t=0,p=1$c29tZXNhbHQ$CTFhFdXP",
+		"$argon2id$v=19$m=64,t=1$c29tZXNhbHQ$CTFhFdXP",
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ",
+		"$scrypt$ln=4,r=8,p=1$!!!$CTFhFdXP",
+		"$scrypt$ln=31,r=8,p=1$c29tZXNhbHQ$CTFhFdXP",
+		"$scrypt$ln=4,r=8,p=1$c29tZXNhbHQ$CTFhFdXP$extra",
+	} {
+		assert.Error(t, Check(bad), bad)
+		assert.Error(t, Verify(bad, "password"), bad)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	argon, err := HashArgon2id("hunter2", testArgon2Params)
+	require.NoError(t, err)
+	scrypted, err := HashScrypt("hunter2", testScryptParams)
+	require.NoError(t, err)
+	keys := keychain{"users/alice": argon, "users/bob": "not a hash"}
+
+	tests := []struct {
+		name     string
+		a        *Authenticator
+		options  map[string]string
+		password string
+		expected tq.AuthenStatus
+	}{
+		{name: "argon2id hash", a: NewArgon2id(mockLogger{}, keys), options: map[string]string{"hash": argon}, password: "hunter2", expected: tq.AuthenStatusPass},
+		{name: "wrong password", a: NewArgon2id(mockLogger{}, keys), options: map[string]string{"hash": argon}, password: "hunter3", expected: tq.AuthenStatusFail},
+		{name: "scrypt hash", a: NewScrypt(mockLogger{}, keys), options: map[string]string{"hash": scrypted}, password: "hunter2", expected: tq.AuthenStatusPass},
+		{name: "generic", a: New(mockLogger{}, keys), options: map[string]string{"hash": scrypted}, password: "hunter2", expected: tq.AuthenStatusPass},
+		{name: "keychain", a: New(mockLogger{}, keys), options: map[string]string{"group": "users"}, password: "hunter2", expected: tq.AuthenStatusPass},
+		{name: "keychain scheme", a: NewScrypt(mockLogger{}, keys), options: map[string]string{"group": "users"}, password: "hunter2", expected: tq.AuthenStatusFail},
+		{name: "keychain bad hash", a: New(mockLogger{}, keys), options: map[string]string{"group": "users", "key": "bob"}, password: "hunter2", expected: tq.AuthenStatusFail},
+		{name: "keychain missing", a: New(mockLogger{}, keys), options: map[string]string{"group": "admins"}, password: "hunter2", expected: tq.AuthenStatusFail},
+	}
+	for _, test := range tests {
+		h, err := test.a.New("alice", test.options)
+		require.NoError(t, err, test.name)
+		var response configtest.Response
+		h.Handle(&response, configtest.AuthenStart(test.password))
+		if assert.NotNil(t, response.Authen, test.name) {
+			assert.Equal(t, test.expected, response.Authen.Status, test.name)
+		}
+	}
+
+	// hashes of another scheme, or with bad parameters, are refused when the config loads
+	_, err = NewArgon2id(mockLogger{}, keys).New("alice", map[string]string{"hash": scrypted})
+	assert.Error(t, err)
+	_, err = New(mockLogger{}, keys).New("alice", map[string]string{"hash": "$argon2id$v=19$m=64,t=0,p=1$c29tZXNhbHQ$CTFhFdXP"})
+	assert.Error(t, err)
+	_, err = New(mockLogger{}, nil).New("alice", nil)
+	assert.Error(t, err)
+}
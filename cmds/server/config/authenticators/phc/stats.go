@@ -0,0 +1,24 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package phc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	phcVerify = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "phc_verify",
+		Help:      "number of password verifications against phc hashes, by scheme and result",
+	}, []string{"scheme", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(phcVerify)
+}
@@ -0,0 +1,174 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Login describes the login a user is asked to approve
+type Login struct {
+	User string `json:"user"`
+	// Device is the address of the device the user is logging in to
+	Device  string `json:"device,omitempty"`
+	RemAddr string `json:"rem_addr,omitempty"`
+	Port    string `json:"port,omitempty"`
+}
+
+// provider sends a push to the user and waits for their answer
+type provider interface {
+	// push blocks until the user approves or denies the login, or ctx is done
+	push(ctx context.Context, c *http.Client, l Login) (bool, error)
+}
+
+// maxResponse bounds the response bodies read from providers
+const maxResponse = 1 << 16
+
+// webhook POSTs the Login as json to url, and expects the endpoint to hold the request until the
+// user answers, replying {"result": "allow"} or {"result": "deny"}
+type webhook struct {
+	url           string
+	authorization string
+}
+
+// WebhookResponse is the response expected from push webhooks
+type WebhookResponse struct {
+	Result string `json:"result"`
+}
+
+func (w webhook) push(ctx context.Context, c *http.Client, l Login) (bool, error) {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(b))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.authorization != "" {
+		req.Header.Set("Authorization", w.authorization)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("push webhook returned status [%v]", resp.Status)
+	}
+	var r WebhookResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&r); err != nil {
+		return false, fmt.Errorf("bad push webhook response; %v", err)
+	}
+	switch r.Result {
+	case "allow":
+		return true, nil
+	case "deny":
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown push webhook result [%v]", r.Result)
+}
+
+// duo sends pushes with the Duo auth api, https://duo.com/docs/authapi#/auth.  The request is
+// synchronous, Duo answers once the user approves or denies the push.
+type duo struct {
+	host string
+	ikey string
+	skey string
+	// scheme is https, tests override it
+	scheme string
+}
+
+// duoPath is the auth api endpoint
+const duoPath = "/auth/v2/auth"
+
+// duoResponse is the envelope of Duo auth api responses
+type duoResponse struct {
+	Stat     string `json:"stat"`
+	Message  string `json:"message"`
+	Response struct {
+		Result    string `json:"result"`
+		StatusMsg string `json:"status_msg"`
+	} `json:"response"`
+}
+
+func (d duo) push(ctx context.Context, c *http.Client, l Login) (bool, error) {
+	params := url.Values{"username": {l.User}, "factor": {"push"}, "device": {"auto"}}
+	if l.Device != "" {
+		params.Set("type", "tacacs login to "+l.Device)
+	}
+	body := duoEncode(params)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.scheme+"://"+d.host+duoPath, strings.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	date := time.Now().UTC().Format(time.RFC1123Z)
+	req.Header.Set("Date", date)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(d.ikey, d.sign(date, http.MethodPost, duoPath, body))
+	resp, err := c.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	var r duoResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&r); err != nil {
+		return false, fmt.Errorf("bad duo response, status [%v]; %v", resp.Status, err)
+	}
+	if r.Stat != "OK" {
+		return false, fmt.Errorf("duo returned status [%v]; %v", resp.Status, r.Message)
+	}
+	switch r.Response.Result {
+	case "allow":
+		return true, nil
+	case "deny":
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown duo result [%v]; %v", r.Response.Result, r.Response.StatusMsg)
+}
+
+// sign returns the hex hmac-sha512 of the canonical request, keyed by the secret key
+func (d duo) sign(date, method, path, params string) string {
+	canon := strings.Join([]string{date, strings.ToUpper(method), strings.ToLower(d.host), path, params}, "\n")
+	mac := hmac.New(sha512.New, []byte(d.skey))
+	mac.Write([]byte(canon))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// duoEncode encodes params sorted by key, with spaces as %20 as Duo's canonical form requires
+func duoEncode(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		for _, v := range params[k] {
+			pairs = append(pairs, duoEscape(k)+"="+duoEscape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func duoEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
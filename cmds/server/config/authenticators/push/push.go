@@ -0,0 +1,288 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package push implements an authenticator that asks users to approve their login on a second
+// device, with a Duo push or a generic webhook, once the password passes another authenticator.
+// Ascii logins are told the push was sent and may check back while it is pending; PAP logins wait
+// for the answer.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+const (
+	// providerWebhook POSTs logins to push_url
+	providerWebhook = "webhook"
+	// providerDuo uses the Duo auth api
+	providerDuo = "duo"
+
+	defaultTimeout = 60 * time.Second
+	defaultPoll    = 5 * time.Second
+)
+
+// supportedOptions are parsed from the authenticator options, every option is also passed to the
+// wrapped authenticator
+//
+// authenticator - the type of the wrapped authenticator, eg 1 for bcrypt, required
+// push_provider - webhook, the default, or duo
+// push_url - the webhook url, required for webhook
+// push_authorization - the Authorization header sent to the webhook
+// duo_host, duo_ikey, duo_skey - the Duo api hostname, integration and secret keys, required for duo
+// push_username - the name the provider knows the user by, defaults to the username
+// push_timeout - how long the user has to answer, a go duration, defaults to 60s
+type supportedOptions struct {
+	authenticator config.AuthenticatorType
+	providerName  string
+	provider      provider
+	pushUsername  string
+	timeout       time.Duration
+}
+
+func newSupportedOptions(username string, options map[string]string) (supportedOptions, error) {
+	opts := supportedOptions{providerName: options["push_provider"], pushUsername: options["push_username"], timeout: defaultTimeout}
+	if opts.pushUsername == "" {
+		opts.pushUsername = username
+	}
+	n, err := strconv.Atoi(options["authenticator"])
+	if err != nil {
+		return opts, fmt.Errorf("invalid authenticator option [%v] for push authenticator, the wrapped authenticator type is required", options["authenticator"])
+	}
+	opts.authenticator = config.AuthenticatorType(n)
+	switch opts.providerName {
+	case "", providerWebhook:
+		opts.providerName = providerWebhook
+		u, err := url.Parse(options["push_url"])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return opts, fmt.Errorf("invalid push_url option [%v] for push authenticator, an http or https url is required", options["push_url"])
+		}
+		opts.provider = webhook{url: options["push_url"], authorization: options["push_authorization"]}
+	case providerDuo:
+		d := duo{host: options["duo_host"], ikey: options["duo_ikey"], skey: options["duo_skey"], scheme: "https"}
+		if d.host == "" || d.ikey == "" || d.skey == "" {
+			return opts, fmt.Errorf("missing required options [duo_host, duo_ikey, duo_skey] for push authenticator")
+		}
+		opts.provider = d
+	default:
+		return opts, fmt.Errorf("invalid push_provider option [%v] for push authenticator, must be webhook or duo", opts.providerName)
+	}
+	if v, ok := options["push_timeout"]; ok {
+		if opts.timeout, err = time.ParseDuration(v); err != nil || opts.timeout <= 0 {
+			return opts, fmt.Errorf("invalid push_timeout option [%v] for push authenticator", v)
+		}
+	}
+	return opts, nil
+}
+
+// Option is the setter type for Authenticator
+type Option func(a *Authenticator)
+
+// SetHTTPClient overrides the client used to call the push providers, eg to configure tls
+func SetHTTPClient(c *http.Client) Option {
+	return func(a *Authenticator) {
+		a.client = c
+	}
+}
+
+// SetPoll sets how long an ascii login that checks back waits for the push to be answered before
+// it is told the push is still pending.  Defaults to 5s.
+func SetPoll(d time.Duration) Option {
+	return func(a *Authenticator) {
+		a.poll = d
+	}
+}
+
+// New push Authenticator, wrapping the authenticators of factories
+func New(l loggerProvider, factories map[config.AuthenticatorType]authenticators.Factory, opts ...Option) *Authenticator {
+	a := &Authenticator{loggerProvider: l, factories: factories, client: &http.Client{}, poll: defaultPoll}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Authenticator requires users to approve a push once the wrapped authenticator passes their password
+type Authenticator struct {
+	loggerProvider
+	factories map[config.AuthenticatorType]authenticators.Factory
+	client    *http.Client
+	poll      time.Duration
+
+	username string
+	supportedOptions
+	next tq.Handler
+}
+
+// New creates a new push authenticator for username which implements tq.Handler
+func (a Authenticator) New(username string, options map[string]string) (tq.Handler, error) {
+	opts, err := newSupportedOptions(username, options)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := a.factories[opts.authenticator]
+	if !ok {
+		return nil, fmt.Errorf("push authenticator cannot wrap authenticator type [%v]", opts.authenticator)
+	}
+	next, err := f.New(username, options)
+	if err != nil {
+		return nil, err
+	}
+	a.username = username
+	a.supportedOptions = opts
+	a.next = next
+	return &a, nil
+}
+
+// Handle checks the password with the wrapped authenticator, then sends the push
+func (a *Authenticator) Handle(response tq.Response, request tq.Request) {
+	a.next.Handle(tq.WrapResponse(&pushResponse{Response: response, a: a, request: request}, response), request)
+}
+
+// login describes the login of request to the provider
+func (a *Authenticator) login(request tq.Request) Login {
+	l := Login{User: a.pushUsername}
+	l.Device, _ = request.Context.Value(tq.ContextConnRemoteAddr).(string)
+	var start tq.AuthenStart
+	if err := tq.Unmarshal(request.Body, &start); err == nil {
+		l.RemAddr, l.Port = string(start.RemAddr), string(start.Port)
+	}
+	return l
+}
+
+// send starts the push in the background, it is abandoned after the timeout
+func (a *Authenticator) send(request tq.Request) *pending {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	p := &pending{a: a, ctx: request.Context, cancel: cancel, done: make(chan struct{})}
+	login := a.login(request)
+	a.Infof(request.Context, "sending a %v push to user [%v]", a.providerName, a.username)
+	pushPending.Inc()
+	go func() {
+		defer close(p.done)
+		defer pushPending.Dec()
+		defer cancel()
+		p.approved, p.err = a.provider.push(ctx, a.client, login)
+	}()
+	return p
+}
+
+// pending is a push waiting for the user's answer
+type pending struct {
+	a        *Authenticator
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	approved bool
+	err      error
+}
+
+// await answers the continue packets of an ascii login while the push is pending
+func (p *pending) await(response tq.Response, request tq.Request) {
+	var body tq.AuthenContinue
+	if err := tq.Unmarshal(request.Body, &body); err != nil || body.Flags.Has(tq.AuthenContinueFlagAbort) {
+		p.cancel()
+		response.Reply(p.wait())
+		return
+	}
+	select {
+	case <-p.done:
+		response.Reply(p.reply())
+	case <-time.After(p.a.poll):
+		response.Next(tq.HandlerFunc(p.await))
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusGetData),
+				tq.SetAuthenReplyServerMsg("still waiting for the push to be approved, press enter to check again"),
+			),
+		)
+	}
+}
+
+// wait blocks until the push is answered or times out, and returns the reply
+func (p *pending) wait() *tq.AuthenReply {
+	<-p.done
+	return p.reply()
+}
+
+// reply returns the reply for the answered push
+func (p *pending) reply() *tq.AuthenReply {
+	result := "deny"
+	switch {
+	case p.err == nil && p.approved:
+		result = "allow"
+	case errors.Is(p.err, context.DeadlineExceeded):
+		result = "timeout"
+	case errors.Is(p.err, context.Canceled):
+		result = "abort"
+	case p.err != nil:
+		result = "error"
+		p.a.Errorf(p.ctx, "unable to send a %v push to user [%v]; %v", p.a.providerName, p.a.username, p.err)
+	}
+	pushResult.WithLabelValues(p.a.providerName, result).Inc()
+	if result != "allow" {
+		p.a.Errorf(p.ctx, "push to user [%v] was not approved, result [%v]", p.a.username, result)
+		return tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+			tq.SetAuthenReplyServerMsg("login failure, the push was not approved"),
+		)
+	}
+	p.a.Infof(p.ctx, "push to user [%v] was approved", p.a.username)
+	return tq.NewAuthenReply(
+		tq.SetAuthenReplyStatus(tq.AuthenStatusPass),
+	)
+}
+
+// pushResponse holds back the pass reply of the wrapped authenticator until the push is approved
+type pushResponse struct {
+	tq.Response
+	a       *Authenticator
+	request tq.Request
+}
+
+// Reply implements tq.Response
+func (r *pushResponse) Reply(v tq.EncoderDecoder) (int, error) {
+	return r.Response.Reply(r.intercept(v))
+}
+
+// ReplyWithContext implements tq.Response
+func (r *pushResponse) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writers ...tq.Writer) (int, error) {
+	return r.Response.ReplyWithContext(ctx, r.intercept(v), writers...)
+}
+
+// intercept returns the reply to send in place of v
+func (r *pushResponse) intercept(v tq.EncoderDecoder) tq.EncoderDecoder {
+	reply, ok := v.(*tq.AuthenReply)
+	if !ok || reply.Status != tq.AuthenStatusPass {
+		return v
+	}
+	p := r.a.send(r.request)
+	var start tq.AuthenStart
+	if tq.Unmarshal(r.request.Body, &start) == nil {
+		// a single packet login, eg pap, cannot be told about the push, it waits for the answer
+		return p.wait()
+	}
+	r.Response.Next(tq.HandlerFunc(p.await))
+	return tq.NewAuthenReply(
+		tq.SetAuthenReplyStatus(tq.AuthenStatusGetData),
+		tq.SetAuthenReplyServerMsg("push sent, approve the login on your device then press enter"),
+	)
+}
@@ -0,0 +1,160 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// passwordFactory creates authenticators that pass the password "password"
+type passwordFactory struct{}
+
+func (passwordFactory) New(username string, options map[string]string) (tq.Handler, error) {
+	return passwordAuthenticator{}, nil
+}
+
+type passwordAuthenticator struct {
+	authenticators.Methods
+}
+
+func (a passwordAuthenticator) Handle(response tq.Response, request tq.Request) {
+	status := tq.AuthenStatusFail
+	if password, _ := a.GetPassword(request); password == "password" {
+		status = tq.AuthenStatusPass
+	}
+	response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(status)))
+}
+
+func TestWebhook(t *testing.T) {
+	var pushes int32
+	answer := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pushes, 1)
+		var l Login
+		if r.Header.Get("Authorization") != "Bearer token" || json.NewDecoder(r.Body).Decode(&l) != nil || l.User != "alice" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		select {
+		case result := <-answer:
+			json.NewEncoder(w).Encode(WebhookResponse{Result: result})
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	a := New(mockLogger{}, map[config.AuthenticatorType]authenticators.Factory{config.BCRYPT: passwordFactory{}}, SetPoll(10*time.Millisecond))
+	h, err := a.New("alice", map[string]string{"authenticator": "1", "push_url": server.URL, "push_authorization": "Bearer token", "push_timeout": "2s"})
+	require.NoError(t, err)
+
+	// pap logins wait for the answer
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, h, configtest.AuthenStart("wrong")).Authen.Status)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&pushes), "no push without the password")
+	answer <- "allow"
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, h, configtest.AuthenStart("password")).Authen.Status)
+	answer <- "deny"
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, h, configtest.AuthenStart("password")).Authen.Status)
+	answer <- "maybe"
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, h, configtest.AuthenStart("password")).Authen.Status)
+
+	// ascii logins are told the push was sent, and may check back until it is answered
+	response := configtest.Login(t, h, configtest.AuthenContinue("password"))
+	assert.Equal(t, tq.AuthenStatusGetData, response.Authen.Status)
+	assert.Contains(t, string(response.Authen.ServerMsg), "push sent")
+	require.NotNil(t, response.NextHandler)
+	response = configtest.Login(t, response.NextHandler, configtest.AuthenContinue(""))
+	assert.Equal(t, tq.AuthenStatusGetData, response.Authen.Status, "still pending")
+	require.NotNil(t, response.NextHandler)
+	answer <- "allow"
+	assert.Eventually(t, func() bool {
+		response = configtest.Login(t, response.NextHandler, configtest.AuthenContinue(""))
+		return response.Authen.Status != tq.AuthenStatusGetData
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, tq.AuthenStatusPass, response.Authen.Status)
+
+	// aborting gives up on the push
+	response = configtest.Login(t, h, configtest.AuthenContinue("password"))
+	require.NotNil(t, response.NextHandler)
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, response.NextHandler, configtest.AuthenContinue("", tq.AuthenContinueFlagAbort)).Authen.Status)
+
+	// unanswered pushes time out
+	h, err = a.New("alice", map[string]string{"authenticator": "1", "push_url": server.URL, "push_authorization": "Bearer token", "push_timeout": "50ms"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, h, configtest.AuthenStart("password")).Authen.Status)
+}
+
+func TestDuo(t *testing.T) {
+	var d duo
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ikey, sig, _ := r.BasicAuth()
+		if r.URL.Path != duoPath || ikey != "DIXXXXXXXXXXXXXXXXXX" || sig != d.sign(r.Header.Get("Date"), r.Method, duoPath, string(body)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"stat": "FAIL", "code": 40103, "message": "Invalid signature in request credentials"}`))
+			return
+		}
+		result := "deny"
+		if strings.Contains(string(body), "username=alice") {
+			result = "allow"
+		}
+		w.Write([]byte(`{"stat": "OK", "response": {"result": "` + result + `", "status": "` + result + `"}}`))
+	}))
+	d = duo{host: server.Listener.Addr().String(), ikey: "DIXXXXXXXXXXXXXXXXXX", skey: "secret", scheme: "http"}
+	server.Start()
+	defer server.Close()
+
+	a := New(mockLogger{}, map[config.AuthenticatorType]authenticators.Factory{config.BCRYPT: passwordFactory{}})
+	for user, expected := range map[string]tq.AuthenStatus{"alice": tq.AuthenStatusPass, "bob": tq.AuthenStatusFail} {
+		h, err := a.New(user, map[string]string{"authenticator": "1", "push_provider": "duo", "duo_host": "api-xxxxxxxx.duosecurity.com", "duo_ikey": "DIXXXXXXXXXXXXXXXXXX", "duo_skey": "secret"})
+		require.NoError(t, err)
+		// point the authenticator at the test server
+		h.(*Authenticator).provider = d
+		assert.Equal(t, expected, configtest.Login(t, h, configtest.AuthenStart("password")).Authen.Status, user)
+	}
+
+	assert.Equal(t, "device=auto&factor=push&type=tacacs%20login&username=al%26ice", duoEncode(map[string][]string{"username": {"al&ice"}, "factor": {"push"}, "device": {"auto"}, "type": {"tacacs login"}}))
+}
+
+func TestOptions(t *testing.T) {
+	a := New(mockLogger{}, map[config.AuthenticatorType]authenticators.Factory{config.BCRYPT: passwordFactory{}})
+	for _, options := range []map[string]string{
+		{},
+		{"authenticator": "3", "push_url": "https://push.example.com"},
+		{"authenticator": "1"},
+		{"authenticator": "1", "push_url": "push.example.com"},
+		{"authenticator": "1", "push_provider": "sms", "push_url": "https://push.example.com"},
+		{"authenticator": "1", "push_provider": "duo", "duo_host": "api-xxxxxxxx.duosecurity.com"},
+		{"authenticator": "1", "push_url": "https://push.example.com", "push_timeout": "soon"},
+	} {
+		_, err := a.New("alice", options)
+		assert.Error(t, err, options)
+	}
+	_, err := a.New("alice", map[string]string{"authenticator": "1", "push_url": "https://push.example.com", "push_timeout": "30s"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,30 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package push
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	pushResult = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "push_result",
+		Help:      "number of mfa pushes, by provider and result: allow, deny, timeout or error",
+	}, []string{"provider", "result"})
+	pushPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "push_pending",
+		Help:      "number of mfa pushes waiting for the user to answer",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pushResult)
+	prometheus.MustRegister(pushPending)
+}
@@ -0,0 +1,236 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package radius
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+//
+// a minimal rfc2865 client encoding, just enough for Access-Request exchanges
+// https://datatracker.ietf.org/doc/html/rfc2865
+//
+
+// code is the radius packet type
+type code uint8
+
+const (
+	codeAccessRequest   code = 1
+	codeAccessAccept    code = 2
+	codeAccessReject    code = 3
+	codeAccessChallenge code = 11
+)
+
+// String returns code as a string
+func (c code) String() string {
+	switch c {
+	case codeAccessRequest:
+		return "Access-Request"
+	case codeAccessAccept:
+		return "Access-Accept"
+	case codeAccessReject:
+		return "Access-Reject"
+	case codeAccessChallenge:
+		return "Access-Challenge"
+	}
+	return fmt.Sprintf("unknown code[%d]", uint8(c))
+}
+
+// attribute types used by this client
+const (
+	attrUserName             = 1
+	attrUserPassword         = 2
+	attrCHAPPassword         = 3
+	attrCallingStationID     = 31
+	attrNASIdentifier        = 32
+	attrCHAPChallenge        = 60
+	attrMessageAuthenticator = 80
+	attrNASPortID            = 87
+)
+
+const (
+	// headerLen is code, identifier, length and authenticator
+	headerLen = 20
+	// maxPacketLen per rfc
+	maxPacketLen = 4096
+	// maxPasswordLen per rfc, User-Password is at most 128 bytes
+	maxPasswordLen = 128
+)
+
+// attribute is a single radius type, length, value
+type attribute struct {
+	typ   uint8
+	value []byte
+}
+
+// packet is a radius packet
+type packet struct {
+	code          code
+	identifier    uint8
+	authenticator [16]byte
+	attributes    []attribute
+}
+
+// newAccessRequest creates an Access-Request with a random request authenticator
+func newAccessRequest(identifier uint8) (*packet, error) {
+	p := &packet{code: codeAccessRequest, identifier: identifier}
+	if _, err := rand.Read(p.authenticator[:]); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// add appends an attribute, values longer than 253 bytes are rejected
+func (p *packet) add(typ uint8, value []byte) error {
+	if len(value) > 253 {
+		return fmt.Errorf("radius attribute [%v] is too long [%v]", typ, len(value))
+	}
+	p.attributes = append(p.attributes, attribute{typ: typ, value: value})
+	return nil
+}
+
+// get returns the first attribute value of typ
+func (p *packet) get(typ uint8) ([]byte, bool) {
+	for _, a := range p.attributes {
+		if a.typ == typ {
+			return a.value, true
+		}
+	}
+	return nil, false
+}
+
+// marshal encodes p.  If a Message-Authenticator attribute is present, it is computed
+// over the encoded packet per rfc3579.
+func (p *packet) marshal(secret []byte) ([]byte, error) {
+	buf := make([]byte, headerLen, maxPacketLen)
+	buf[0] = uint8(p.code)
+	buf[1] = p.identifier
+	copy(buf[4:20], p.authenticator[:])
+	maOffset := -1
+	for _, a := range p.attributes {
+		if a.typ == attrMessageAuthenticator {
+			maOffset = len(buf) + 2
+			buf = append(buf, a.typ, 18)
+			buf = append(buf, make([]byte, 16)...)
+			continue
+		}
+		buf = append(buf, a.typ, uint8(len(a.value)+2))
+		buf = append(buf, a.value...)
+	}
+	if len(buf) > maxPacketLen {
+		return nil, fmt.Errorf("radius packet is too large [%v]", len(buf))
+	}
+	binary.BigEndian.PutUint16(buf[2:4], uint16(len(buf)))
+	if maOffset > 0 {
+		mac := hmac.New(md5.New, secret)
+		mac.Write(buf)
+		copy(buf[maOffset:maOffset+16], mac.Sum(nil))
+	}
+	return buf, nil
+}
+
+// unmarshal decodes a radius packet
+func unmarshal(b []byte) (*packet, error) {
+	if len(b) < headerLen {
+		return nil, fmt.Errorf("radius packet is too small [%v]", len(b))
+	}
+	length := int(binary.BigEndian.Uint16(b[2:4]))
+	if length < headerLen || length > len(b) || length > maxPacketLen {
+		return nil, fmt.Errorf("radius packet has an invalid length [%v]", length)
+	}
+	p := &packet{code: code(b[0]), identifier: b[1]}
+	copy(p.authenticator[:], b[4:20])
+	attrs := b[headerLen:length]
+	for len(attrs) > 0 {
+		if len(attrs) < 2 || int(attrs[1]) < 2 || int(attrs[1]) > len(attrs) {
+			return nil, fmt.Errorf("radius packet has a malformed attribute")
+		}
+		p.attributes = append(p.attributes, attribute{typ: attrs[0], value: attrs[2:attrs[1]]})
+		attrs = attrs[attrs[1]:]
+	}
+	return p, nil
+}
+
+// encryptPassword hides a User-Password per rfc2865 section 5.2
+func encryptPassword(password, secret []byte, authenticator [16]byte) ([]byte, error) {
+	if len(password) > maxPasswordLen {
+		return nil, fmt.Errorf("radius password is too long")
+	}
+	// pad to a multiple of 16, an empty password is a single block of nulls
+	n := (len(password) + 15) / 16 * 16
+	if n == 0 {
+		n = 16
+	}
+	padded := make([]byte, n)
+	copy(padded, password)
+	out := make([]byte, 0, n)
+	last := authenticator[:]
+	for i := 0; i < n; i += 16 {
+		h := md5.New()
+		h.Write(secret)
+		h.Write(last)
+		b := h.Sum(nil)
+		for j := 0; j < 16; j++ {
+			b[j] ^= padded[i+j]
+		}
+		out = append(out, b...)
+		last = b
+	}
+	return out, nil
+}
+
+// verifyResponse validates the response authenticator and, if present, the
+// Message-Authenticator of a reply to request
+func verifyResponse(raw []byte, request *packet, secret []byte) error {
+	if len(raw) < headerLen {
+		return fmt.Errorf("radius response is too small")
+	}
+	length := int(binary.BigEndian.Uint16(raw[2:4]))
+	if length < headerLen || length > len(raw) {
+		return fmt.Errorf("radius response has an invalid length [%v]", length)
+	}
+	raw = raw[:length]
+	// ResponseAuth = MD5(Code+ID+Length+RequestAuth+Attributes+Secret)
+	h := md5.New()
+	h.Write(raw[:4])
+	h.Write(request.authenticator[:])
+	h.Write(raw[headerLen:])
+	h.Write(secret)
+	if !hmac.Equal(h.Sum(nil), raw[4:20]) {
+		return fmt.Errorf("radius response authenticator mismatch, check the shared secret")
+	}
+	reply, err := unmarshal(raw)
+	if err != nil {
+		return err
+	}
+	if ma, ok := reply.get(attrMessageAuthenticator); ok {
+		if len(ma) != 16 {
+			return fmt.Errorf("radius response has a malformed message-authenticator")
+		}
+		// the message-authenticator is computed with the request authenticator in place
+		// and the attribute value zeroed
+		check := append([]byte(nil), raw...)
+		copy(check[4:20], request.authenticator[:])
+		i := bytes.Index(check[headerLen:], append([]byte{attrMessageAuthenticator, 18}, ma...))
+		if i < 0 {
+			return fmt.Errorf("radius response has a malformed message-authenticator")
+		}
+		copy(check[headerLen+i+2:headerLen+i+18], make([]byte, 16))
+		mac := hmac.New(md5.New, secret)
+		mac.Write(check)
+		if !hmac.Equal(mac.Sum(nil), ma) {
+			return fmt.Errorf("radius response message-authenticator mismatch")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package radius implements an authenticator that proxies password verification to an
+// upstream RADIUS server using rfc2865 Access-Request exchanges.  This lets tacquito
+// front an existing RADIUS estate while migrating devices to TACACS+.
+package radius
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+const (
+	defaultTimeout       = 3 * time.Second
+	defaultRetries       = 2
+	defaultNASIdentifier = "tacquito"
+)
+
+// supportedOptions map will be unmarshaled into this type
+//
+// address - host:port of the upstream radius server, required
+// secret - the radius shared secret, required
+// timeout - time to wait for each attempt, a go duration, eg 3s
+// retries - the number of additional attempts after the first times out
+// nas_identifier - the NAS-Identifier sent upstream
+func newSupportedOptions(options map[string]string) (supportedOptions, error) {
+	opts := supportedOptions{
+		address:       options["address"],
+		secret:        []byte(options["secret"]),
+		timeout:       defaultTimeout,
+		retries:       defaultRetries,
+		nasIdentifier: options["nas_identifier"],
+	}
+	if v, ok := options["timeout"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid timeout option [%v] for radius authenticator; %v", v, err)
+		}
+		opts.timeout = d
+	}
+	if v, ok := options["retries"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid retries option [%v] for radius authenticator; %v", v, err)
+		}
+		opts.retries = n
+	}
+	if opts.nasIdentifier == "" {
+		opts.nasIdentifier = defaultNASIdentifier
+	}
+	return opts, nil
+}
+
+type supportedOptions struct {
+	address       string
+	secret        []byte
+	timeout       time.Duration
+	retries       int
+	nasIdentifier string
+}
+
+func (s supportedOptions) validate() error {
+	if s.address == "" {
+		return fmt.Errorf("missing required option [address] for radius authenticator")
+	}
+	if _, _, err := net.SplitHostPort(s.address); err != nil {
+		return fmt.Errorf("invalid address option [%v] for radius authenticator; %v", s.address, err)
+	}
+	if len(s.secret) == 0 {
+		return fmt.Errorf("missing required option [secret] for radius authenticator")
+	}
+	if s.timeout <= 0 {
+		return fmt.Errorf("timeout must be positive for radius authenticator")
+	}
+	if s.retries < 0 {
+		return fmt.Errorf("retries cannot be negative for radius authenticator")
+	}
+	return nil
+}
+
+// New RADIUS Authenticator
+func New(l loggerProvider) *Authenticator {
+	return &Authenticator{loggerProvider: l, identifier: new(uint32)}
+}
+
+// Authenticator proxies password validation to an upstream radius server
+type Authenticator struct {
+	loggerProvider
+	authenticators.Methods
+	username string
+	supportedOptions
+
+	// identifier is shared by all users of a registered authenticator so concurrent
+	// requests to the same upstream are less likely to collide
+	identifier *uint32
+}
+
+// New creates a new radius authenticator which implements tq.Handler
+func (a Authenticator) New(username string, options map[string]string) (tq.Handler, error) {
+	opts, err := newSupportedOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	return &Authenticator{loggerProvider: a.loggerProvider, username: username, supportedOptions: opts, identifier: a.identifier}, nil
+}
+
+// Handle handles all authenticate message types, scoped to the uid.  CHAP exchanges are
+// passed upstream as CHAP-Password and CHAP-Challenge attributes.
+func (a Authenticator) Handle(response tq.Response, request tq.Request) {
+	chap, isCHAP, err := a.GetCHAP(request)
+	var password string
+	if err == nil && !isCHAP {
+		password, err = a.GetPassword(request)
+	}
+	if err != nil {
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg(fmt.Sprintf("%v", err)),
+			),
+		)
+		return
+	}
+	fields := a.GetFields(request)
+	req, err := a.accessRequest(password, chap, fields["rem-addr"], fields["port"])
+	if err != nil {
+		radiusError.Inc()
+		a.Errorf(request.Context, "unable to build radius request for user [%v]; %v", a.username, err)
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+				tq.SetAuthenReplyServerMsg("login failure"),
+			),
+		)
+		return
+	}
+	reply, err := a.exchange(request.Context, req)
+	if err != nil {
+		a.Errorf(request.Context, "radius exchange with [%v] failed for user [%v]; %v", a.address, a.username, err)
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("authentication backend unavailable"),
+			),
+		)
+		return
+	}
+	switch reply.code {
+	case codeAccessAccept:
+		radiusAccept.Inc()
+		a.Infof(request.Context, "accepting user [%v] via radius server [%v]", a.username, a.address)
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusPass),
+			),
+		)
+		return
+	case codeAccessChallenge:
+		// challenge/response flows are not proxied, treat them as a failure
+		radiusChallenge.Inc()
+		a.Errorf(request.Context, "radius server [%v] sent an unsupported challenge for user [%v]", a.address, a.username)
+	default:
+		radiusReject.Inc()
+		a.Errorf(request.Context, "radius server [%v] rejected user [%v] with [%v]", a.address, a.username, reply.code)
+	}
+	response.Reply(
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+			tq.SetAuthenReplyServerMsg("login failure"),
+		),
+	)
+}
+
+// accessRequest builds an Access-Request for the user.  If chap is not nil, it is sent instead
+// of password.  remAddr and port are passed upstream when the device provided them.
+func (a Authenticator) accessRequest(password string, chap *authenticators.CHAP, remAddr, port string) (*packet, error) {
+	p, err := newAccessRequest(uint8(atomic.AddUint32(a.identifier, 1)))
+	if err != nil {
+		return nil, err
+	}
+	if err := p.add(attrUserName, []byte(a.username)); err != nil {
+		return nil, err
+	}
+	if chap != nil {
+		if err := p.add(attrCHAPPassword, append([]byte{chap.ID}, chap.Response...)); err != nil {
+			return nil, err
+		}
+		if err := p.add(attrCHAPChallenge, chap.Challenge); err != nil {
+			return nil, err
+		}
+	} else {
+		hidden, err := encryptPassword([]byte(password), a.secret, p.authenticator)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.add(attrUserPassword, hidden); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.add(attrNASIdentifier, []byte(a.nasIdentifier)); err != nil {
+		return nil, err
+	}
+	if remAddr != "" {
+		if err := p.add(attrCallingStationID, []byte(remAddr)); err != nil {
+			return nil, err
+		}
+	}
+	if port != "" {
+		if err := p.add(attrNASPortID, []byte(port)); err != nil {
+			return nil, err
+		}
+	}
+	// rfc3579 Message-Authenticator, computed during marshal
+	if err := p.add(attrMessageAuthenticator, nil); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// exchange sends req to the upstream server and waits for a verified reply, retrying on timeouts.
+// The same packet is resent on each attempt so the server may detect duplicates.
+func (a Authenticator) exchange(ctx context.Context, req *packet) (*packet, error) {
+	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
+		radiusDuration.Observe(v * 1000)
+	}))
+	defer timer.ObserveDuration()
+	b, err := req.marshal(a.secret)
+	if err != nil {
+		radiusError.Inc()
+		return nil, err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", a.address)
+	if err != nil {
+		radiusError.Inc()
+		return nil, err
+	}
+	defer conn.Close()
+	buf := make([]byte, maxPacketLen)
+	for attempt := 0; attempt <= a.retries; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt > 0 {
+			radiusRetry.Inc()
+		}
+		if _, err := conn.Write(b); err != nil {
+			radiusError.Inc()
+			return nil, err
+		}
+		deadline := time.Now().Add(a.timeout)
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			radiusError.Inc()
+			return nil, err
+		}
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				radiusError.Inc()
+				return nil, err
+			}
+			reply, err := unmarshal(buf[:n])
+			if err != nil || reply.identifier != req.identifier {
+				// stray or stale datagram, keep waiting for ours
+				radiusDiscarded.Inc()
+				continue
+			}
+			if err := verifyResponse(buf[:n], req, a.secret); err != nil {
+				radiusDiscarded.Inc()
+				a.Errorf(ctx, "discarding radius reply from [%v]; %v", a.address, err)
+				continue
+			}
+			return reply, nil
+		}
+	}
+	radiusTimeout.Inc()
+	return nil, fmt.Errorf("no reply after [%v] attempts", a.retries+1)
+}
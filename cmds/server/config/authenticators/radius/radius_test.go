@@ -0,0 +1,191 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package radius
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// decryptPassword reverses encryptPassword, as an upstream server would
+func decryptPassword(hidden, secret []byte, authenticator [16]byte) []byte {
+	out := make([]byte, 0, len(hidden))
+	last := authenticator[:]
+	for i := 0; i < len(hidden); i += 16 {
+		h := md5.New()
+		h.Write(secret)
+		h.Write(last)
+		b := h.Sum(nil)
+		for j := 0; j < 16; j++ {
+			b[j] ^= hidden[i+j]
+		}
+		out = append(out, b...)
+		last = hidden[i : i+16]
+	}
+	return bytes.TrimRight(out, "\x00")
+}
+
+// fakeServer is a radius server that accepts a single username and password.  The first
+// drop datagrams are ignored to exercise retries.
+func fakeServer(t *testing.T, secret []byte, username, password string, drop int32) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	var seen int32
+	go func() {
+		buf := make([]byte, maxPacketLen)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if atomic.AddInt32(&seen, 1) <= drop {
+				continue
+			}
+			req, err := unmarshal(buf[:n])
+			if err != nil {
+				continue
+			}
+			user, _ := req.get(attrUserName)
+			code := codeAccessReject
+			if hidden, ok := req.get(attrUserPassword); ok {
+				if string(user) == username && string(decryptPassword(hidden, secret, req.authenticator)) == password {
+					code = codeAccessAccept
+				}
+			}
+			if chapPassword, ok := req.get(attrCHAPPassword); ok && len(chapPassword) == 17 {
+				challenge, _ := req.get(attrCHAPChallenge)
+				chap := authenticators.CHAP{ID: chapPassword[0], Challenge: challenge, Response: chapPassword[1:]}
+				if string(user) == username && chap.Verify(password) {
+					code = codeAccessAccept
+				}
+			}
+			reply := &packet{code: code, identifier: req.identifier, authenticator: req.authenticator}
+			b, _ := reply.marshal(secret)
+			h := md5.New()
+			h.Write(b)
+			h.Write(secret)
+			copy(b[4:20], h.Sum(nil))
+			conn.WriteTo(b, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func newCHAPAuthenStart(password string) tq.Request {
+	challenge := []byte("0123456789abcdef")
+	data := append([]byte{7}, challenge...)
+	data = append(data, authenticators.NewCHAPResponse(7, password, challenge)...)
+	return configtest.AuthenStartUser(tq.AuthenTypeCHAP, "alice", string(data))
+}
+
+func TestRadiusAuthenticator(t *testing.T) {
+	secret := []byte("fooman")
+	address, stop := fakeServer(t, secret, "alice", "a much longer password than sixteen bytes", 1)
+	defer stop()
+
+	tests := []struct {
+		name     string
+		options  map[string]string
+		password string
+		request  tq.Request
+		expected tq.AuthenStatus
+	}{
+		{
+			name:     "accept after retry",
+			options:  map[string]string{"address": address, "secret": string(secret), "timeout": "100ms"},
+			password: "a much longer password than sixteen bytes",
+			expected: tq.AuthenStatusPass,
+		},
+		{
+			name:     "reject",
+			options:  map[string]string{"address": address, "secret": string(secret), "timeout": "100ms"},
+			password: "wrong",
+			expected: tq.AuthenStatusFail,
+		},
+		{
+			name:     "chap accept",
+			options:  map[string]string{"address": address, "secret": string(secret), "timeout": "100ms"},
+			request:  newCHAPAuthenStart("a much longer password than sixteen bytes"),
+			expected: tq.AuthenStatusPass,
+		},
+		{
+			name:     "chap reject",
+			options:  map[string]string{"address": address, "secret": string(secret), "timeout": "100ms"},
+			request:  newCHAPAuthenStart("wrong"),
+			expected: tq.AuthenStatusFail,
+		},
+		{
+			name:     "wrong shared secret",
+			options:  map[string]string{"address": address, "secret": "nope", "timeout": "50ms", "retries": "1"},
+			password: "a much longer password than sixteen bytes",
+			expected: tq.AuthenStatusError,
+		},
+	}
+	a := New(mockLogger{})
+	for _, test := range tests {
+		h, err := a.New("alice", test.options)
+		assert.NoError(t, err, test.name)
+		var response configtest.Response
+		request := test.request
+		if request.Body == nil {
+			request = configtest.AuthenStart(test.password)
+		}
+		h.Handle(&response, request)
+		if assert.NotNil(t, response.Authen, test.name) {
+			assert.Equal(t, test.expected, response.Authen.Status, test.name)
+		}
+	}
+}
+
+func TestRadiusOptions(t *testing.T) {
+	a := New(mockLogger{})
+	for _, options := range []map[string]string{
+		{"secret": "fooman"},
+		{"address": "localhost", "secret": "fooman"},
+		{"address": "localhost:1812"},
+		{"address": "localhost:1812", "secret": "fooman", "timeout": "soon"},
+		{"address": "localhost:1812", "secret": "fooman", "retries": "-1"},
+	} {
+		_, err := a.New("alice", options)
+		assert.Error(t, err, options)
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	p, err := newAccessRequest(7)
+	assert.NoError(t, err)
+	assert.NoError(t, p.add(attrUserName, []byte("alice")))
+	assert.NoError(t, p.add(attrMessageAuthenticator, nil))
+	b, err := p.marshal([]byte("fooman"))
+	assert.NoError(t, err)
+	got, err := unmarshal(b)
+	assert.NoError(t, err)
+	assert.Equal(t, p.identifier, got.identifier)
+	user, ok := got.get(attrUserName)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", string(user))
+	ma, ok := got.get(attrMessageAuthenticator)
+	assert.True(t, ok)
+	assert.Len(t, ma, 16)
+	assert.NotEqual(t, make([]byte, 16), ma)
+}
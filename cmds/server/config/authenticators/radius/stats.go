@@ -0,0 +1,67 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package radius
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	radiusAccept = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "radius_access_accept",
+		Help:      "number of Access-Accept replies from upstream radius servers",
+	})
+	radiusReject = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "radius_access_reject",
+		Help:      "number of Access-Reject replies from upstream radius servers",
+	})
+	radiusChallenge = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "radius_access_challenge",
+		Help:      "number of unsupported Access-Challenge replies from upstream radius servers",
+	})
+	radiusRetry = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "radius_retry",
+		Help:      "number of Access-Request retransmissions",
+	})
+	radiusTimeout = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "radius_timeout",
+		Help:      "number of Access-Requests that exhausted all retries",
+	})
+	radiusDiscarded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "radius_discarded",
+		Help:      "number of replies discarded due to mismatched identifiers or authenticators",
+	})
+	radiusError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "radius_error",
+		Help:      "number of errors communicating with upstream radius servers",
+	})
+	radiusDuration = prometheus.NewSummary(prometheus.SummaryOpts{
+		Namespace:  "tacquito",
+		Name:       "radius_exchange_duration_milliseconds",
+		Help:       "the time in milliseconds to complete a radius exchange, including retries",
+		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	})
+)
+
+func init() {
+	prometheus.MustRegister(radiusAccept)
+	prometheus.MustRegister(radiusReject)
+	prometheus.MustRegister(radiusChallenge)
+	prometheus.MustRegister(radiusRetry)
+	prometheus.MustRegister(radiusTimeout)
+	prometheus.MustRegister(radiusDiscarded)
+	prometheus.MustRegister(radiusError)
+	prometheus.MustRegister(radiusDuration)
+}
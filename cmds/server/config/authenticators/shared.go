@@ -15,6 +15,13 @@ import (
 	tq "github.com/facebookincubator/tacquito"
 )
 
+// Factory creates the per user authenticators of an authenticator type, see
+// loader.RegisterAuthenticator.  Authenticators that wrap others, eg totp, are given the factories
+// of the types they may wrap.
+type Factory interface {
+	New(username string, options map[string]string) (tq.Handler, error)
+}
+
 // Methods is a stateless, bag of functionality, meant to be composed into
 // specific authenticator types to reduce boilerplate
 type Methods struct{}
@@ -48,9 +55,13 @@ func (m Methods) getAuthenContinue(request tq.Request) *tq.AuthenContinue {
 	return &body
 }
 
-// GetPassword will get the password from an authenstart or authencontinue packet
+// GetPassword will get the password from an authenstart or authencontinue packet.  CHAP
+// authenstart packets do not carry a password, see GetCHAP.
 func (m Methods) GetPassword(request tq.Request) (string, error) {
 	if body := m.getAuthenStart(request); body != nil {
+		if body.Type == tq.AuthenTypeCHAP {
+			return "", fmt.Errorf("chap is not supported by this authenticator")
+		}
 		return string(body.Data), nil
 	}
 	if body := m.getAuthenContinue(request); body != nil {
@@ -0,0 +1,96 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// step is the time step of codes, the rfc6238 default
+const step = 30 * time.Second
+
+// ParseSecret decodes a base32 totp secret, as shown to users enrolling an authenticator app.
+// Case, spaces and padding are ignored.
+func ParseSecret(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.ToUpper(strings.ReplaceAll(s, " ", "")), "=")
+	b, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("totp secret is not base32; %v", err)
+	}
+	if len(b) < 10 {
+		return nil, fmt.Errorf("totp secret is %v bytes, at least 10 are required", len(b))
+	}
+	return b, nil
+}
+
+// counter returns the time step counter of t
+func counter(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(step/time.Second)
+}
+
+// hotp returns the rfc4226 code of secret at counter c
+// https://datatracker.ietf.org/doc/html/rfc4226#section-5.3
+func hotp(secret []byte, c uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], c)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, code%mod)
+}
+
+// Code returns the rfc6238 code of secret at t
+// https://datatracker.ietf.org/doc/html/rfc6238
+func Code(secret []byte, t time.Time, digits int) string {
+	return hotp(secret, counter(t), digits)
+}
+
+// match returns the counter code matches at t, allowing skew steps of clock drift either way.  ok
+// is false if it matches none.
+func match(secret []byte, code string, t time.Time, digits, skew int) (uint64, bool) {
+	now := counter(t)
+	for i := -skew; i <= skew; i++ {
+		c := now + uint64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, c, digits)), []byte(code)) == 1 {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// usedCodes remembers the last counter each user logged in with, a code is only accepted once
+type usedCodes struct {
+	sync.Mutex
+	last map[string]uint64
+}
+
+// accept records that user logged in with counter c.  It returns false if user already logged in
+// with c or a later counter.
+func (u *usedCodes) accept(user string, c uint64) bool {
+	u.Lock()
+	defer u.Unlock()
+	if last, ok := u.last[user]; ok && c <= last {
+		return false
+	}
+	u.last[user] = c
+	return true
+}
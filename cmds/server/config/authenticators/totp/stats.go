@@ -0,0 +1,24 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package totp
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	totpVerify = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "totp_verify",
+		Help:      "number of totp code checks, by result: pass, fail, replay or error",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(totpVerify)
+}
@@ -0,0 +1,302 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package totp implements an authenticator that requires a time based one time password, rfc6238,
+// on top of the password checked by another authenticator.  Users append the code to their
+// password, or for ascii logins may be prompted for it once their password passes.  Per user totp
+// secrets are looked up in the keychain.
+package totp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+// getSecret is the expected behavior for fetching totp secrets from keychain
+// types that implement this should be thread safe
+type getSecret interface {
+	GetSecret(ctx context.Context, name, group string) ([]byte, error)
+}
+
+const (
+	// modeAppend takes the code from the end of the password
+	modeAppend = "append"
+	// modePrompt asks for the code once the password passes, ascii logins only
+	modePrompt = "prompt"
+)
+
+// supportedOptions are parsed from the authenticator options, every option is also passed to the
+// wrapped authenticator
+//
+// authenticator - the type of the wrapped authenticator, eg 1 for bcrypt, required
+// totp_group - the group within keychain that holds the base32 totp secret
+// totp_key - the key in the group within keychain, defaults to the username
+// totp_mode - append, the default, or prompt
+// totp_digits - 6, the default, or 8
+type supportedOptions struct {
+	authenticator config.AuthenticatorType
+	group         string
+	key           string
+	mode          string
+	digits        int
+}
+
+func newSupportedOptions(username string, options map[string]string) (supportedOptions, error) {
+	opts := supportedOptions{group: options["totp_group"], key: options["totp_key"], mode: options["totp_mode"], digits: 6}
+	if opts.key == "" {
+		opts.key = username
+	}
+	n, err := strconv.Atoi(options["authenticator"])
+	if err != nil {
+		return opts, fmt.Errorf("invalid authenticator option [%v] for totp authenticator, the wrapped authenticator type is required", options["authenticator"])
+	}
+	opts.authenticator = config.AuthenticatorType(n)
+	switch opts.mode {
+	case "":
+		opts.mode = modeAppend
+	case modeAppend, modePrompt:
+	default:
+		return opts, fmt.Errorf("invalid totp_mode option [%v] for totp authenticator, must be append or prompt", opts.mode)
+	}
+	if v, ok := options["totp_digits"]; ok {
+		opts.digits, err = strconv.Atoi(v)
+		if err != nil || (opts.digits != 6 && opts.digits != 8) {
+			return opts, fmt.Errorf("invalid totp_digits option [%v] for totp authenticator, must be 6 or 8", v)
+		}
+	}
+	return opts, nil
+}
+
+// Option is the setter type for Authenticator
+type Option func(a *Authenticator)
+
+// SetSkew accepts codes up to steps 30 second steps either side of the server's clock.  Defaults
+// to 1.
+func SetSkew(steps int) Option {
+	return func(a *Authenticator) {
+		a.skew = steps
+	}
+}
+
+// New TOTP Authenticator, wrapping the authenticators of factories.  s holds the totp secrets.
+func New(l loggerProvider, s getSecret, factories map[config.AuthenticatorType]authenticators.Factory, opts ...Option) *Authenticator {
+	a := &Authenticator{
+		loggerProvider: l,
+		getSecret:      s,
+		factories:      factories,
+		used:           &usedCodes{last: make(map[string]uint64)},
+		now:            time.Now,
+		skew:           1,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Authenticator requires a totp code once the wrapped authenticator passes a user's password
+type Authenticator struct {
+	loggerProvider
+	authenticators.Methods
+	getSecret
+	factories map[config.AuthenticatorType]authenticators.Factory
+	// used is shared by every user, so a code cannot be replayed across config reloads
+	used *usedCodes
+	now  func() time.Time
+	skew int
+
+	username string
+	supportedOptions
+	next tq.Handler
+}
+
+// New creates a new totp authenticator for username which implements tq.Handler
+func (a Authenticator) New(username string, options map[string]string) (tq.Handler, error) {
+	opts, err := newSupportedOptions(username, options)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := a.factories[opts.authenticator]
+	if !ok {
+		return nil, fmt.Errorf("totp authenticator cannot wrap authenticator type [%v]", opts.authenticator)
+	}
+	next, err := f.New(username, options)
+	if err != nil {
+		return nil, err
+	}
+	a.username = username
+	a.supportedOptions = opts
+	a.next = next
+	return &a, nil
+}
+
+// Handle checks the password, without the code if one is appended, with the wrapped authenticator,
+// then the code
+func (a *Authenticator) Handle(response tq.Response, request tq.Request) {
+	var start tq.AuthenStart
+	isStart := tq.Unmarshal(request.Body, &start) == nil
+	if isStart && start.Type == tq.AuthenTypeCHAP {
+		totpVerify.WithLabelValues("error").Inc()
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("chap is not supported by this authenticator"),
+			),
+		)
+		return
+	}
+	if a.mode == modePrompt && !isStart {
+		// an ascii login, which can be asked for the code with another prompt
+		a.next.Handle(tq.WrapResponse(&codeResponse{Response: response, a: a, ctx: request.Context}, response), request)
+		return
+	}
+	password, err := a.GetPassword(request)
+	if err != nil || len(password) <= a.digits {
+		totpVerify.WithLabelValues("fail").Inc()
+		a.fail(response)
+		return
+	}
+	code := password[len(password)-a.digits:]
+	request, err = withPassword(request, password[:len(password)-a.digits])
+	if err != nil {
+		totpVerify.WithLabelValues("error").Inc()
+		a.Errorf(request.Context, "unable to strip the totp code from the password of user [%v]; %v", a.username, err)
+		a.fail(response)
+		return
+	}
+	a.next.Handle(tq.WrapResponse(&codeResponse{Response: response, a: a, ctx: request.Context, code: code}, response), request)
+}
+
+// verify reports if code is the user's current code, and was not used before
+func (a *Authenticator) verify(ctx context.Context, code string) bool {
+	raw, err := a.GetSecret(ctx, a.key, a.group)
+	if err != nil {
+		totpVerify.WithLabelValues("error").Inc()
+		a.Errorf(ctx, "failure in keychain query for the totp secret of user [%v]; %v", a.username, err)
+		return false
+	}
+	secret, err := ParseSecret(string(raw))
+	if err != nil {
+		totpVerify.WithLabelValues("error").Inc()
+		a.Errorf(ctx, "invalid totp secret for user [%v]; %v", a.username, err)
+		return false
+	}
+	c, ok := match(secret, code, a.now(), a.digits, a.skew)
+	if !ok {
+		totpVerify.WithLabelValues("fail").Inc()
+		a.Errorf(ctx, "failed to validate the totp code of user [%v]", a.username)
+		return false
+	}
+	if !a.used.accept(a.username, c) {
+		totpVerify.WithLabelValues("replay").Inc()
+		a.Errorf(ctx, "refusing a totp code of user [%v] that was already used", a.username)
+		return false
+	}
+	totpVerify.WithLabelValues("pass").Inc()
+	a.Infof(ctx, "accepting the totp code of user [%v]", a.username)
+	return true
+}
+
+// checkCode checks the code answering the prompt of an ascii login
+func (a *Authenticator) checkCode(response tq.Response, request tq.Request) {
+	var body tq.AuthenContinue
+	if err := tq.Unmarshal(request.Body, &body); err != nil || body.Flags.Has(tq.AuthenContinueFlagAbort) {
+		a.fail(response)
+		return
+	}
+	if !a.verify(request.Context, string(body.UserMessage)) {
+		a.fail(response)
+		return
+	}
+	response.Reply(
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusPass),
+		),
+	)
+}
+
+// fail replies with a login failure that does not say if the password or the code was wrong
+func (a *Authenticator) fail(response tq.Response) {
+	response.Reply(
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+			tq.SetAuthenReplyServerMsg("login failure"),
+		),
+	)
+}
+
+// withPassword returns request with its password, the data of a start packet or the user msg of a
+// continue packet, replaced by password
+func withPassword(request tq.Request, password string) (tq.Request, error) {
+	var start tq.AuthenStart
+	if err := tq.Unmarshal(request.Body, &start); err == nil {
+		start.Data = tq.AuthenData(password)
+		request.Body, err = start.MarshalBinary()
+		return request, err
+	}
+	var body tq.AuthenContinue
+	if err := tq.Unmarshal(request.Body, &body); err != nil {
+		return request, err
+	}
+	body.UserMessage = tq.AuthenUserMessage(password)
+	var err error
+	request.Body, err = body.MarshalBinary()
+	return request, err
+}
+
+// codeResponse holds back the pass reply of the wrapped authenticator until the code is checked
+type codeResponse struct {
+	tq.Response
+	a   *Authenticator
+	ctx context.Context
+	// code is the code appended to the password, empty to prompt for it
+	code string
+}
+
+// Reply implements tq.Response
+func (r *codeResponse) Reply(v tq.EncoderDecoder) (int, error) {
+	return r.Response.Reply(r.intercept(v))
+}
+
+// ReplyWithContext implements tq.Response
+func (r *codeResponse) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writers ...tq.Writer) (int, error) {
+	return r.Response.ReplyWithContext(ctx, r.intercept(v), writers...)
+}
+
+// intercept returns the reply to send in place of v
+func (r *codeResponse) intercept(v tq.EncoderDecoder) tq.EncoderDecoder {
+	reply, ok := v.(*tq.AuthenReply)
+	if !ok || reply.Status != tq.AuthenStatusPass {
+		return v
+	}
+	if r.code == "" {
+		r.Response.Next(tq.HandlerFunc(r.a.checkCode))
+		return tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusGetData),
+			tq.SetAuthenReplyServerMsg("verification code:"),
+		)
+	}
+	if !r.a.verify(r.ctx, r.code) {
+		return tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+			tq.SetAuthenReplyServerMsg("login failure"),
+		)
+	}
+	return v
+}
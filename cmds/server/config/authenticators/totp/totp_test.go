@@ -0,0 +1,130 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package totp
+
+import (
+	"context"
+	"encoding/base32"
+	"fmt"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// keychain holds base32 totp secrets by group and name
+type keychain map[string]string
+
+func (k keychain) GetSecret(ctx context.Context, name, group string) ([]byte, error) {
+	v, ok := k[group+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("no secret [%v] in group [%v]", name, group)
+	}
+	return []byte(v), nil
+}
+
+// passwordFactory creates authenticators that pass the password "password"
+type passwordFactory struct{}
+
+func (passwordFactory) New(username string, options map[string]string) (tq.Handler, error) {
+	return passwordAuthenticator{}, nil
+}
+
+type passwordAuthenticator struct {
+	authenticators.Methods
+}
+
+func (a passwordAuthenticator) Handle(response tq.Response, request tq.Request) {
+	status := tq.AuthenStatusFail
+	if password, _ := a.GetPassword(request); password == "password" {
+		status = tq.AuthenStatusPass
+	}
+	response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(status)))
+}
+
+// TestCode checks the sha1 test vectors of rfc6238 appendix B
+func TestCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	for unix, code := range map[int64]string{59: "94287082", 1111111109: "07081804", 1234567890: "89005924", 2000000000: "69279037"} {
+		assert.Equal(t, code, Code(secret, time.Unix(unix, 0), 8), unix)
+	}
+	b, err := ParseSecret("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	require.NoError(t, err)
+	assert.Equal(t, secret, b)
+	_, err = ParseSecret("GEZDGNBV")
+	assert.Error(t, err, "too short")
+	_, err = ParseSecret("not base32!")
+	assert.Error(t, err)
+}
+
+func TestAuthenticator(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	keys := keychain{"totp/alice": base32.StdEncoding.EncodeToString(secret)}
+	now := time.Unix(1234567890, 0)
+	newAuthenticator := func(options map[string]string) tq.Handler {
+		a := New(mockLogger{}, keys, map[config.AuthenticatorType]authenticators.Factory{config.BCRYPT: passwordFactory{}})
+		a.now = func() time.Time { return now }
+		h, err := a.New("alice", options)
+		require.NoError(t, err)
+		return h
+	}
+	appended := newAuthenticator(map[string]string{"authenticator": "1", "totp_group": "totp"})
+
+	code := Code(secret, now, 6)
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, appended, configtest.AuthenStart("password")).Authen.Status, "missing code")
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, appended, configtest.AuthenStart("passwrd"+code)).Authen.Status, "wrong password")
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, appended, configtest.AuthenStart("password000000")).Authen.Status, "wrong code")
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, appended, configtest.AuthenStart("password"+code)).Authen.Status)
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, appended, configtest.AuthenStart("password"+code)).Authen.Status, "replayed code")
+
+	// codes of the previous step are accepted too, but never twice
+	now = now.Add(step)
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, appended, configtest.AuthenStart("password"+code)).Authen.Status, "replayed code")
+	now = now.Add(step)
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, appended, configtest.AuthenStart("password"+Code(secret, now.Add(-step), 6))).Authen.Status)
+
+	// prompt mode asks ascii logins for the code once the password passes
+	prompted := newAuthenticator(map[string]string{"authenticator": "1", "totp_group": "totp", "totp_mode": "prompt"})
+	now = now.Add(10 * step)
+	response := configtest.Login(t, prompted, configtest.AuthenContinue("password"))
+	assert.Equal(t, tq.AuthenStatusGetData, response.Authen.Status)
+	require.NotNil(t, response.NextHandler)
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, response.NextHandler, configtest.AuthenContinue(Code(secret, now, 6))).Authen.Status)
+	response = configtest.Login(t, prompted, configtest.AuthenContinue("password"))
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, response.NextHandler, configtest.AuthenContinue("000000")).Authen.Status)
+	assert.Equal(t, tq.AuthenStatusFail, configtest.Login(t, prompted, configtest.AuthenContinue("wrong")).Authen.Status)
+	// pap logins carry a single password, the code is appended whatever the mode
+	now = now.Add(step)
+	assert.Equal(t, tq.AuthenStatusPass, configtest.Login(t, prompted, configtest.AuthenStart("password"+Code(secret, now, 6))).Authen.Status)
+}
+
+func TestAuthenticatorOptions(t *testing.T) {
+	a := New(mockLogger{}, keychain{}, map[config.AuthenticatorType]authenticators.Factory{config.BCRYPT: passwordFactory{}})
+	for _, options := range []map[string]string{
+		{},
+		{"authenticator": "3"},
+		{"authenticator": "1", "totp_mode": "sms"},
+		{"authenticator": "1", "totp_digits": "7"},
+	} {
+		_, err := a.New("alice", options)
+		assert.Error(t, err, options)
+	}
+	_, err := a.New("alice", map[string]string{"authenticator": "1", "totp_digits": "8", "totp_mode": "prompt"})
+	assert.NoError(t, err)
+}
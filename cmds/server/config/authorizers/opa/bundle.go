@@ -0,0 +1,217 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package opa
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config/authorizers/policy"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/loader"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// maxBundleSize bounds the size of a downloaded bundle
+const maxBundleSize = 64 << 20
+
+// regoPolicy is the compiled query of a source, reloaded when the source changes
+type regoPolicy struct {
+	loggerProvider
+	client *http.Client
+	source source
+
+	mu          sync.RWMutex
+	query       rego.PreparedEvalQuery
+	revision    string
+	fingerprint string
+	etag        string
+}
+
+func newRegoPolicy(l loggerProvider, c *http.Client, s source) *regoPolicy {
+	return &regoPolicy{loggerProvider: l, client: c, source: s}
+}
+
+// run reloads the policy every reload interval until ctx is done.  A bundle that fails to load
+// leaves the previous policy in place.
+func (p *regoPolicy) run(ctx context.Context) {
+	t := time.NewTicker(p.source.reloadInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := p.load(ctx); err != nil {
+				opaBundleLoadError.Inc()
+				p.Errorf(ctx, "unable to reload bundle [%v], keeping the last loaded policy; %v", p.source.bundle, err)
+			}
+		}
+	}
+}
+
+// load compiles the bundle if it changed since it was last loaded
+func (p *regoPolicy) load(ctx context.Context) error {
+	var opts []func(*rego.Rego)
+	var revision, fingerprint string
+	var err error
+	if p.source.remote() {
+		opts, revision, fingerprint, err = p.download(ctx)
+	} else {
+		opts, revision, fingerprint, err = p.read()
+	}
+	if err != nil || opts == nil {
+		return err
+	}
+	p.mu.RLock()
+	unchanged := fingerprint == p.fingerprint
+	p.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	q, err := rego.New(append(opts, rego.Query(p.source.query))...).PrepareForEval(ctx)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.query, p.revision, p.fingerprint = q, revision, fingerprint
+	p.mu.Unlock()
+	opaBundleLoad.Inc()
+	p.Infof(ctx, "loaded bundle [%v] at revision [%v]", p.source.bundle, revision)
+	return nil
+}
+
+// read loads a local .rego file, bundle directory or bundle file.  The fingerprint covers the
+// name, size and modification time of every file.
+func (p *regoPolicy) read() ([]func(*rego.Rego), string, string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(p.source.bundle, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%v %v %v\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+	fingerprint := fmt.Sprintf("%x", h.Sum(nil))
+	if strings.HasSuffix(p.source.bundle, ".rego") {
+		b, err := os.ReadFile(p.source.bundle)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return []func(*rego.Rego){rego.Module(p.source.bundle, string(b))}, "", fingerprint, nil
+	}
+	b, err := loader.NewFileLoader().AsBundle(p.source.bundle)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return []func(*rego.Rego){rego.ParsedBundle(p.source.bundle, b)}, b.Manifest.Revision, fingerprint, nil
+}
+
+// download fetches a .tar.gz bundle.  Unmodified bundles return no options.  The fingerprint is
+// the hash of the bundle.
+func (p *regoPolicy) download(ctx context.Context) ([]func(*rego.Rego), string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.source.bundle, nil)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if p.source.authorization != "" {
+		req.Header.Set("Authorization", p.source.authorization)
+	}
+	p.mu.RLock()
+	if p.etag != "" {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	p.mu.RUnlock()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, "", "", nil
+	case http.StatusOK:
+	default:
+		return nil, "", "", fmt.Errorf("unexpected status [%v]", resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxBundleSize+1))
+	if err != nil {
+		return nil, "", "", err
+	}
+	if len(raw) > maxBundleSize {
+		return nil, "", "", fmt.Errorf("bundle exceeds the [%v] byte limit", maxBundleSize)
+	}
+	b, err := bundle.NewReader(bytes.NewReader(raw)).Read()
+	if err != nil {
+		return nil, "", "", err
+	}
+	p.mu.Lock()
+	p.etag = resp.Header.Get("ETag")
+	p.mu.Unlock()
+	return []func(*rego.Rego){rego.ParsedBundle(p.source.bundle, &b)}, b.Manifest.Revision, fmt.Sprintf("%x", sha256.Sum256(raw)), nil
+}
+
+// eval evaluates the query with input, returning the decision and the revision of the bundle
+// that made it
+func (p *regoPolicy) eval(ctx context.Context, input policy.Request) (policy.Decision, string, error) {
+	var d policy.Decision
+	p.mu.RLock()
+	q, revision := p.query, p.revision
+	p.mu.RUnlock()
+	rs, err := q.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return d, revision, err
+	}
+	// undefined results deny
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		d.Status = policy.StatusFail
+		return d, revision, nil
+	}
+	switch v := rs[0].Expressions[0].Value.(type) {
+	case bool:
+		d.Status = policy.StatusFail
+		if v {
+			d.Status = policy.StatusPassAdd
+		}
+		return d, revision, nil
+	case map[string]interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return d, revision, err
+		}
+		if err := json.Unmarshal(b, &d); err != nil {
+			return d, revision, fmt.Errorf("unable to decode decision; %v", err)
+		}
+	default:
+		return d, revision, fmt.Errorf("query returned a [%T], expected a bool or an object", v)
+	}
+	switch d.Status {
+	case policy.StatusPassAdd, policy.StatusPassRepl, policy.StatusFail:
+		return d, revision, nil
+	}
+	return d, revision, fmt.Errorf("unknown decision status [%v]", d.Status)
+}
@@ -0,0 +1,258 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package opa authorizes requests by evaluating a rego policy with an embedded open policy agent.
+// Users select it with an authorizer of type config.REGO.  It is only wired into servers built
+// with the opa tag.
+//
+// The policy is given a policy.Request as input and its query must return either a bool, which
+// permits (pass_add) or denies the request, or an object shaped as a policy.Decision.  An undefined
+// result denies the request.
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authorizers/policy"
+)
+
+const (
+	defaultQuery          = "data.tacquito.authz.decision"
+	defaultTimeout        = time.Second
+	defaultReloadInterval = 30 * time.Second
+	// unavailableMsg is the server message of requests failed closed
+	unavailableMsg = "policy unavailable"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+}
+
+// supportedOptions map will be unmarshaled into this type
+//
+// bundle - the policy, required.  A .rego file, a bundle directory or .tar.gz file, or the http(s)
+// url of a .tar.gz bundle
+// query - optional, the rego query evaluated, defaults to data.tacquito.authz.decision
+// reload_interval - optional, how often the bundle is checked for changes, a go duration, defaults
+// to 30s.  0s disables reloading
+// authorization - optional, sent as the Authorization header when downloading url bundles
+// timeout - optional, time allowed to evaluate a request, a go duration, defaults to 1s
+// fail_open - optional, true permits requests the policy fails to evaluate, false, the default,
+// denies them
+// decision_log - optional, true logs every decision, with its input and the bundle revision
+type supportedOptions struct {
+	source      source
+	timeout     time.Duration
+	failOpen    bool
+	decisionLog bool
+}
+
+// source identifies a compiled policy.  Users configured with the same source share its policy.
+type source struct {
+	bundle         string
+	query          string
+	reloadInterval time.Duration
+	authorization  string
+}
+
+// remote is true if the bundle is downloaded
+func (s source) remote() bool {
+	u, err := url.Parse(s.bundle)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+func newSupportedOptions(options map[string]string) (supportedOptions, error) {
+	opts := supportedOptions{
+		source: source{
+			bundle:         options["bundle"],
+			query:          defaultQuery,
+			reloadInterval: defaultReloadInterval,
+			authorization:  options["authorization"],
+		},
+		timeout: defaultTimeout,
+	}
+	var err error
+	if opts.source.bundle == "" {
+		return opts, fmt.Errorf("missing required option [bundle] for opa authorizer")
+	}
+	if v, ok := options["query"]; ok {
+		opts.source.query = v
+	}
+	if v, ok := options["reload_interval"]; ok {
+		if opts.source.reloadInterval, err = time.ParseDuration(v); err != nil || opts.source.reloadInterval < 0 {
+			return opts, fmt.Errorf("invalid reload_interval option [%v] for opa authorizer", v)
+		}
+	}
+	if v, ok := options["timeout"]; ok {
+		if opts.timeout, err = time.ParseDuration(v); err != nil || opts.timeout <= 0 {
+			return opts, fmt.Errorf("invalid timeout option [%v] for opa authorizer", v)
+		}
+	}
+	if v, ok := options["fail_open"]; ok {
+		if opts.failOpen, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid fail_open option [%v] for opa authorizer; %v", v, err)
+		}
+	}
+	if v, ok := options["decision_log"]; ok {
+		if opts.decisionLog, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid decision_log option [%v] for opa authorizer; %v", v, err)
+		}
+	}
+	return opts, nil
+}
+
+// Option is the setter type for Authorizer
+type Option func(a *Authorizer)
+
+// SetHTTPClient overrides the client used to download url bundles, eg to configure tls
+func SetHTTPClient(c *http.Client) Option {
+	return func(a *Authorizer) {
+		a.client = c
+	}
+}
+
+// New opa Authorizer.  Bundles are reloaded until ctx is done.
+func New(ctx context.Context, l loggerProvider, opts ...Option) *Authorizer {
+	a := &Authorizer{
+		ctx:            ctx,
+		loggerProvider: l,
+		client:         &http.Client{},
+		policies:       &policies{m: make(map[source]*regoPolicy)},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// policies holds a compiled policy per source.  A policy survives config reloads, and is only
+// loaded again when its bundle changes.
+type policies struct {
+	sync.Mutex
+	m map[source]*regoPolicy
+}
+
+// Authorizer evaluates a rego policy to authorize the requests of a user
+type Authorizer struct {
+	loggerProvider
+	ctx      context.Context
+	client   *http.Client
+	policies *policies
+	policy   *regoPolicy
+	opts     supportedOptions
+	user     config.User
+}
+
+// New creates the authorizer of user, configured with options.  The first user of a bundle loads
+// it, and an error is returned if it cannot be loaded or compiled.
+func (a Authorizer) New(user config.User, options map[string]string) (tq.Handler, error) {
+	opts, err := newSupportedOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	a.policies.Lock()
+	defer a.policies.Unlock()
+	p, ok := a.policies.m[opts.source]
+	if !ok {
+		p = newRegoPolicy(a.loggerProvider, a.client, opts.source)
+		if err := p.load(a.ctx); err != nil {
+			opaBundleLoadError.Inc()
+			return nil, fmt.Errorf("unable to load bundle [%v]; %v", opts.source.bundle, err)
+		}
+		a.policies.m[opts.source] = p
+		if opts.source.reloadInterval > 0 {
+			go p.run(a.ctx)
+		}
+	}
+	return &Authorizer{loggerProvider: a.loggerProvider, ctx: a.ctx, policy: p, opts: opts, user: user}, nil
+}
+
+// Handle evaluates the policy for request and replies with its decision
+func (a *Authorizer) Handle(response tq.Response, request tq.Request) {
+	var body tq.AuthorRequest
+	if err := request.Unmarshal(&body); err != nil {
+		opaHandleError.Inc()
+		response.Reply(
+			tq.NewAuthorReply(
+				tq.SetAuthorReplyStatus(tq.AuthorStatusError),
+				tq.SetAuthorReplyServerMsg("unable to decode AuthorRequest packet"),
+			),
+		)
+		return
+	}
+	ctx, cancel := context.WithTimeout(request.Context, a.opts.timeout)
+	defer cancel()
+	input := policy.NewRequest(request.Context, a.user, body)
+	start := time.Now()
+	d, revision, err := a.policy.eval(ctx, input)
+	opaEvalDuration.Observe(float64(time.Since(start).Milliseconds()))
+	if a.opts.decisionLog {
+		a.logDecision(request.Context, input, d, revision, time.Since(start), err)
+	}
+	if err != nil {
+		opaHandleError.Inc()
+		a.Errorf(request.Context, "unable to evaluate policy [%v] for user [%v]; %v", a.opts.source.bundle, body.User, err)
+		if a.opts.failOpen {
+			opaHandleFailOpen.Inc()
+			response.Reply(tq.NewAuthorReply(tq.SetAuthorReplyStatus(tq.AuthorStatusPassAdd)))
+			return
+		}
+		response.Reply(
+			tq.NewAuthorReply(
+				tq.SetAuthorReplyStatus(tq.AuthorStatusFail),
+				tq.SetAuthorReplyServerMsg(unavailableMsg),
+			),
+		)
+		return
+	}
+	switch d.Status {
+	case policy.StatusPassAdd:
+		opaHandlePassAdd.Inc()
+	case policy.StatusPassRepl:
+		opaHandlePassRepl.Inc()
+	default:
+		opaHandleFail.Inc()
+	}
+	response.Reply(d.Reply())
+}
+
+// decisionLog is a single decision as logged with the decision_log option
+type decisionLog struct {
+	Bundle   string          `json:"bundle"`
+	Revision string          `json:"revision,omitempty"`
+	Query    string          `json:"query"`
+	Input    policy.Request  `json:"input"`
+	Result   policy.Decision `json:"result"`
+	Error    string          `json:"error,omitempty"`
+	Duration time.Duration   `json:"duration_ns"`
+}
+
+// logDecision logs a decision as json
+func (a *Authorizer) logDecision(ctx context.Context, input policy.Request, d policy.Decision, revision string, took time.Duration, err error) {
+	entry := decisionLog{Bundle: a.opts.source.bundle, Revision: revision, Query: a.opts.source.query, Input: input, Result: d, Duration: took}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		a.Errorf(ctx, "unable to marshal opa decision log; %v", err)
+		return
+	}
+	a.Infof(ctx, "opa decision %s", b)
+}
@@ -0,0 +1,255 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package opa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authorizers/policy"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockLogger records Infof lines
+type mockLogger struct {
+	sync.Mutex
+	info []string
+}
+
+func (m *mockLogger) Infof(ctx context.Context, format string, args ...interface{}) {
+	m.Lock()
+	defer m.Unlock()
+	m.info = append(m.info, fmt.Sprintf(format, args...))
+}
+func (m *mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (m *mockLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+const authz = `package tacquito.authz
+
+default decision = {"status": "fail", "server_msg": "denied by policy"}
+
+decision = {"status": "pass_add", "args": ["priv-lvl=15"]} {
+	input.scope == "lab"
+	input.args[_] == "cmd=show"
+}
+
+decision = {"status": "pass_repl", "args": ["service=shell", "cmd=configure"]} {
+	input.user == "alice"
+	input.args[_] == "cmd=configure"
+}
+
+allow {
+	input.device == "2001:db8::1"
+}
+`
+
+// authorize runs an authorization request for alice through h
+func authorize(t *testing.T, h tq.Handler, args ...string) *tq.AuthorReply {
+	body := tq.NewAuthorRequest(
+		tq.SetAuthorRequestMethod(tq.AuthenMethodTacacsPlus),
+		tq.SetAuthorRequestPrivLvl(tq.PrivLvlUser),
+		tq.SetAuthorRequestType(tq.AuthenTypeASCII),
+		tq.SetAuthorRequestService(tq.AuthenServiceLogin),
+		tq.SetAuthorRequestUser("alice"),
+		tq.SetAuthorRequestPort("tty0"),
+		tq.SetAuthorRequestRemAddr("192.0.2.1"),
+		tq.SetAuthorRequestArgs(tq.Args{}),
+	)
+	for _, arg := range args {
+		body.Args.Append(arg)
+	}
+	b, err := body.MarshalBinary()
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tq.ContextConnRemoteAddr, "2001:db8::1")
+	r := &configtest.Response{}
+	h.Handle(r, tq.Request{Header: *tq.NewHeader(tq.SetHeaderType(tq.Authorize)), Body: b, Context: ctx})
+	require.NotNil(t, r.Author)
+	return r.Author
+}
+
+func writePolicy(t *testing.T, path, policy string) {
+	require.NoError(t, os.WriteFile(path, []byte(policy), 0644))
+	// file systems with coarse modification times would otherwise hide the change
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+}
+
+func TestOPA(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "authz.rego")
+	writePolicy(t, path, authz)
+	l := &mockLogger{}
+	a := New(ctx, l)
+	u := config.User{Name: "alice", Scopes: []string{"lab"}}
+
+	h, err := a.New(u, map[string]string{"bundle": path, "decision_log": "true"})
+	require.NoError(t, err)
+	reply := authorize(t, h, "service=shell", "cmd=show")
+	assert.Equal(t, tq.AuthorStatusPassAdd, reply.Status)
+	assert.Equal(t, tq.Args{"priv-lvl=15"}, reply.Args)
+	reply = authorize(t, h, "service=shell", "cmd=configure")
+	assert.Equal(t, tq.AuthorStatusPassRepl, reply.Status)
+	assert.Equal(t, tq.Args{"service=shell", "cmd=configure"}, reply.Args)
+	reply = authorize(t, h, "service=shell", "cmd=reload")
+	assert.Equal(t, tq.AuthorStatusFail, reply.Status)
+	assert.Equal(t, tq.AuthorServerMsg("denied by policy"), reply.ServerMsg)
+
+	l.Lock()
+	decisions := 0
+	for _, line := range l.info {
+		if strings.HasPrefix(line, "opa decision ") {
+			decisions++
+			assert.Contains(t, line, `"user":"alice"`)
+		}
+	}
+	l.Unlock()
+	assert.Equal(t, 3, decisions)
+
+	// bool queries permit or deny
+	h, err = a.New(u, map[string]string{"bundle": path, "query": "data.tacquito.authz.allow"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusPassAdd, authorize(t, h, "service=shell", "cmd=show").Status)
+
+	// undefined results deny, even when failing open
+	h, err = a.New(u, map[string]string{"bundle": path, "query": "data.tacquito.authz.missing", "fail_open": "true"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusFail, authorize(t, h, "service=shell", "cmd=show").Status)
+
+	// results that are not decisions are errors
+	h, err = a.New(u, map[string]string{"bundle": path, "query": "input.args"})
+	require.NoError(t, err)
+	reply = authorize(t, h, "service=shell", "cmd=show")
+	assert.Equal(t, tq.AuthorStatusFail, reply.Status)
+	assert.Equal(t, tq.AuthorServerMsg(unavailableMsg), reply.ServerMsg)
+	h, err = a.New(u, map[string]string{"bundle": path, "query": "input.args", "fail_open": "true"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusPassAdd, authorize(t, h, "service=shell", "cmd=show").Status)
+}
+
+func TestOPAReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "authz.rego")
+	writePolicy(t, path, "package tacquito.authz\n\ndecision = false\n")
+	a := New(ctx, &mockLogger{})
+	u := config.User{Name: "alice", Scopes: []string{"lab"}}
+
+	h, err := a.New(u, map[string]string{"bundle": path, "reload_interval": "10ms"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusFail, authorize(t, h, "service=shell", "cmd=show").Status)
+
+	writePolicy(t, path, "package tacquito.authz\n\ndecision = true\n")
+	assert.Eventually(t, func() bool {
+		return authorize(t, h, "service=shell", "cmd=show").Status == tq.AuthorStatusPassAdd
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a broken policy keeps the last one loaded
+	writePolicy(t, path, "package tacquito.authz\n\ndecision = \n")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, tq.AuthorStatusPassAdd, authorize(t, h, "service=shell", "cmd=show").Status)
+
+	// users with the same options share the policy
+	h2, err := a.New(u, map[string]string{"bundle": path, "reload_interval": "10ms"})
+	require.NoError(t, err)
+	assert.Same(t, h.(*Authorizer).policy, h2.(*Authorizer).policy)
+
+	// a bundle that never loaded is an error
+	_, err = a.New(u, map[string]string{"bundle": filepath.Join(t.TempDir(), "missing.rego")})
+	assert.Error(t, err)
+}
+
+func TestOPARemoteBundle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var notModified int
+	revision := "1"
+	serve := func(module string) []byte {
+		var buf bytes.Buffer
+		b := bundle.Bundle{
+			Manifest: bundle.Manifest{Revision: revision},
+			Modules:  []bundle.ModuleFile{{URL: "/authz.rego", Path: "/authz.rego", Raw: []byte(module)}},
+			Data:     map[string]interface{}{},
+		}
+		require.NoError(t, bundle.NewWriter(&buf).Write(b))
+		return buf.Bytes()
+	}
+	body := serve("package tacquito.authz\n\ndecision = false\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		if r.Header.Get("If-None-Match") == revision {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", revision)
+		w.Write(body)
+	}))
+	defer server.Close()
+	a := New(ctx, &mockLogger{})
+	u := config.User{Name: "alice", Scopes: []string{"lab"}}
+
+	h, err := a.New(u, map[string]string{"bundle": server.URL + "/bundle.tar.gz", "reload_interval": "10ms", "authorization": "Bearer token"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusFail, authorize(t, h, "service=shell", "cmd=show").Status)
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return notModified > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	revision = "2"
+	body = serve("package tacquito.authz\n\ndecision = true\n")
+	mu.Unlock()
+	assert.Eventually(t, func() bool {
+		return authorize(t, h, "service=shell", "cmd=show").Status == tq.AuthorStatusPassAdd
+	}, 5*time.Second, 10*time.Millisecond)
+	_, got, err := h.(*Authorizer).policy.eval(ctx, policy.Request{})
+	assert.NoError(t, err)
+	assert.Equal(t, "2", got)
+}
+
+func TestOPAOptions(t *testing.T) {
+	o, err := newSupportedOptions(map[string]string{"bundle": "/etc/tacquito/authz.rego"})
+	require.NoError(t, err)
+	assert.Equal(t, supportedOptions{
+		source:  source{bundle: "/etc/tacquito/authz.rego", query: defaultQuery, reloadInterval: defaultReloadInterval},
+		timeout: defaultTimeout,
+	}, o)
+
+	for _, options := range []map[string]string{
+		{},
+		{"bundle": "authz.rego", "reload_interval": "often"},
+		{"bundle": "authz.rego", "reload_interval": "-1s"},
+		{"bundle": "authz.rego", "timeout": "0s"},
+		{"bundle": "authz.rego", "fail_open": "sometimes"},
+		{"bundle": "authz.rego", "decision_log": "sometimes"},
+	} {
+		_, err := newSupportedOptions(options)
+		assert.Error(t, err, "options %v", options)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package opa
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	opaHandlePassAdd = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "opa_handle_pass_add",
+		Help:      "number of opa authorize requests permitted with pass add",
+	})
+	opaHandlePassRepl = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "opa_handle_pass_replace",
+		Help:      "number of opa authorize requests permitted with pass replace",
+	})
+	opaHandleFail = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "opa_handle_fail",
+		Help:      "number of opa authorize requests denied by the policy",
+	})
+	opaHandleError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "opa_handle_error",
+		Help:      "number of opa authorize requests the policy failed to evaluate",
+	})
+	opaHandleFailOpen = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "opa_handle_fail_open",
+		Help:      "number of opa authorize requests permitted as the policy failed to evaluate",
+	})
+	opaBundleLoad = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "opa_bundle_load",
+		Help:      "number of times a changed bundle was loaded",
+	})
+	opaBundleLoadError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "opa_bundle_load_error",
+		Help:      "number of times a bundle failed to load or compile",
+	})
+	opaEvalDuration = prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Namespace:  "tacquito",
+			Name:       "opa_eval_duration_milliseconds",
+			Help:       "the time spent evaluating the policy of an authorize request, in milliseconds",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(opaHandlePassAdd)
+	prometheus.MustRegister(opaHandlePassRepl)
+	prometheus.MustRegister(opaHandleFail)
+	prometheus.MustRegister(opaHandleError)
+	prometheus.MustRegister(opaHandleFailOpen)
+	prometheus.MustRegister(opaBundleLoad)
+	prometheus.MustRegister(opaBundleLoadError)
+	prometheus.MustRegister(opaEvalDuration)
+}
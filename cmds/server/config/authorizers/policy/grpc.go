@@ -0,0 +1,149 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package policy
+
+import (
+	"context"
+	"strings"
+
+	"github.com/facebookincubator/tacquito/cmds/server/grpcwire"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// AuthorizePath is the http path of the Authorize method, appended to the url option
+const AuthorizePath = "/tacquito.policy.v1.Policy/Authorize"
+
+// grpcStatus is the tacquito.policy.v1.Status of each Status
+var grpcStatus = map[Status]uint64{StatusPassAdd: 1, StatusPassRepl: 2, StatusFail: 3}
+
+// decideGRPC calls the Authorize method with r
+func (a *Authorizer) decideGRPC(ctx context.Context, r Request) (Decision, error) {
+	var d Decision
+	b, err := r.MarshalBinary()
+	if err != nil {
+		return d, err
+	}
+	req, err := grpcwire.NewRequest(ctx, strings.TrimSuffix(a.opts.url, "/")+AuthorizePath, b)
+	if err != nil {
+		return d, err
+	}
+	if a.opts.authorization != "" {
+		req.Header.Set("Authorization", a.opts.authorization)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return d, err
+	}
+	defer resp.Body.Close()
+	m, err := grpcwire.ReadResponse(resp, maxResponseSize)
+	if err != nil {
+		return d, err
+	}
+	err = d.UnmarshalBinary(m)
+	return d, err
+}
+
+// MarshalBinary encodes the request as a tacquito.policy.v1.AuthorizeRequest
+func (r Request) MarshalBinary() ([]byte, error) {
+	var b []byte
+	for _, f := range []struct {
+		num protowire.Number
+		v   string
+	}{{1, r.User}, {2, r.Scope}, {4, r.AuthenMethod}, {5, r.AuthenType}, {6, r.AuthenService}, {7, r.Port}, {8, r.RemAddr}, {9, r.Device}} {
+		if f.v != "" {
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendString(b, f.v)
+		}
+	}
+	if r.PrivLvl != 0 {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.PrivLvl))
+	}
+	for _, arg := range r.Args {
+		b = protowire.AppendTag(b, 10, protowire.BytesType)
+		b = protowire.AppendString(b, arg)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a tacquito.policy.v1.AuthorizeRequest
+func (r *Request) UnmarshalBinary(b []byte) error {
+	*r = Request{}
+	strs := map[protowire.Number]*string{1: &r.User, 2: &r.Scope, 4: &r.AuthenMethod, 5: &r.AuthenType, 6: &r.AuthenService, 7: &r.Port, 8: &r.RemAddr, 9: &r.Device}
+	return grpcwire.Walk(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 3 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			r.PrivLvl = uint8(v)
+			return n, nil
+		case num == 10 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			r.Args = append(r.Args, v)
+			return n, nil
+		case strs[num] != nil && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			*strs[num] = v
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+// MarshalBinary encodes the decision as a tacquito.policy.v1.AuthorizeResponse
+func (d Decision) MarshalBinary() ([]byte, error) {
+	var b []byte
+	if s := grpcStatus[d.Status]; s != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, s)
+	}
+	for _, arg := range d.Args {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, arg)
+	}
+	if d.ServerMsg != "" {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, d.ServerMsg)
+	}
+	if d.Data != "" {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, d.Data)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a tacquito.policy.v1.AuthorizeResponse.  An unspecified or unknown
+// status leaves Status empty.
+func (d *Decision) UnmarshalBinary(b []byte) error {
+	*d = Decision{}
+	return grpcwire.Walk(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			for status, s := range grpcStatus {
+				if s == v {
+					d.Status = status
+				}
+			}
+			return n, nil
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			d.Args = append(d.Args, v)
+			return n, nil
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			d.ServerMsg = v
+			return n, nil
+		case num == 4 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			d.Data = v
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
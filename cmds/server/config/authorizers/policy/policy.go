@@ -0,0 +1,300 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package policy authorizes requests by asking an external policy service, such as OPA or an
+// internal policy engine, over http or grpc.  Users select it with an authorizer of type
+// config.POLICY in place of the default stringy authorizer.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+const (
+	defaultTimeout = 2 * time.Second
+	// maxResponseSize bounds the size of a policy service's answer
+	maxResponseSize = 1 << 20
+	// unavailableMsg is the server message of requests failed closed
+	unavailableMsg = "policy service unavailable"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+}
+
+// Status is the decision of a policy service
+type Status string
+
+const (
+	// StatusPassAdd permits the request, adding Decision.Args to those of the request
+	StatusPassAdd Status = "pass_add"
+	// StatusPassRepl permits the request, replacing the args of the request with Decision.Args
+	StatusPassRepl Status = "pass_repl"
+	// StatusFail denies the request
+	StatusFail Status = "fail"
+)
+
+// Request is what the policy service is asked to authorize.  It is POSTed as json over http and
+// sent as tacquito.policy.v1.AuthorizeRequest over grpc, see policy.proto.
+type Request struct {
+	User    string `json:"user"`
+	Scope   string `json:"scope"`
+	PrivLvl uint8  `json:"priv_lvl"`
+	// AuthenMethod, AuthenType and AuthenService are the names of the request's values, eg
+	// AuthenMethodTacacsPlus
+	AuthenMethod  string `json:"authen_method"`
+	AuthenType    string `json:"authen_type"`
+	AuthenService string `json:"authen_service"`
+	Port          string `json:"port"`
+	// RemAddr is the address of the user, as reported by the device
+	RemAddr string `json:"rem_addr"`
+	// Device is the address of the device sending the request
+	Device string   `json:"device"`
+	Args   []string `json:"args"`
+}
+
+// Decision is the policy service's answer to a Request
+type Decision struct {
+	Status    Status   `json:"status"`
+	Args      []string `json:"args,omitempty"`
+	ServerMsg string   `json:"server_msg,omitempty"`
+	Data      string   `json:"data,omitempty"`
+}
+
+// supportedOptions map will be unmarshaled into this type
+//
+// url - the endpoint of the policy service, required.  Requests are POSTed to it over http, and
+// the Authorize method is appended to it over grpc, which requires https
+// protocol - optional, http, the default, or grpc
+// timeout - optional, time to wait for a decision, a go duration, defaults to 2s
+// fail_open - optional, true permits requests when the policy service cannot decide, false, the
+// default, denies them
+// authorization - optional, sent as the Authorization header, eg "Bearer <token>"
+type supportedOptions struct {
+	url           string
+	protocol      string
+	timeout       time.Duration
+	failOpen      bool
+	authorization string
+}
+
+func newSupportedOptions(options map[string]string) (supportedOptions, error) {
+	opts := supportedOptions{url: options["url"], protocol: "http", timeout: defaultTimeout, authorization: options["authorization"]}
+	if opts.url == "" {
+		return opts, fmt.Errorf("missing required option [url] for policy authorizer")
+	}
+	u, err := url.Parse(opts.url)
+	if err != nil {
+		return opts, fmt.Errorf("invalid url option [%v] for policy authorizer; %v", opts.url, err)
+	}
+	if v, ok := options["protocol"]; ok {
+		opts.protocol = v
+	}
+	switch {
+	case opts.protocol == "grpc" && u.Scheme != "https":
+		return opts, fmt.Errorf("url option [%v] for policy authorizer must be https with grpc", opts.url)
+	case opts.protocol == "http" && u.Scheme != "http" && u.Scheme != "https":
+		return opts, fmt.Errorf("url option [%v] for policy authorizer must be http or https", opts.url)
+	case opts.protocol != "http" && opts.protocol != "grpc":
+		return opts, fmt.Errorf("unsupported protocol [%v] for policy authorizer", opts.protocol)
+	}
+	if v, ok := options["timeout"]; ok {
+		if opts.timeout, err = time.ParseDuration(v); err != nil || opts.timeout <= 0 {
+			return opts, fmt.Errorf("invalid timeout option [%v] for policy authorizer", v)
+		}
+	}
+	if v, ok := options["fail_open"]; ok {
+		if opts.failOpen, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid fail_open option [%v] for policy authorizer; %v", v, err)
+		}
+	}
+	return opts, nil
+}
+
+// Option is the setter type for Authorizer
+type Option func(a *Authorizer)
+
+// SetHTTPClient overrides the client used to call the policy service, eg to configure tls
+func SetHTTPClient(c *http.Client) Option {
+	return func(a *Authorizer) {
+		a.client = c
+	}
+}
+
+// New policy Authorizer
+func New(l loggerProvider, opts ...Option) *Authorizer {
+	a := &Authorizer{loggerProvider: l, client: &http.Client{}}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Authorizer asks a policy service to authorize the requests of a user
+type Authorizer struct {
+	loggerProvider
+	client *http.Client
+	opts   supportedOptions
+	user   config.User
+}
+
+// New creates the authorizer of user, configured with options
+func (a Authorizer) New(user config.User, options map[string]string) (tq.Handler, error) {
+	opts, err := newSupportedOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return &Authorizer{loggerProvider: a.loggerProvider, client: a.client, opts: opts, user: user}, nil
+}
+
+// Handle asks the policy service to authorize request and replies with its decision
+func (a *Authorizer) Handle(response tq.Response, request tq.Request) {
+	var body tq.AuthorRequest
+	if err := request.Unmarshal(&body); err != nil {
+		policyHandleError.Inc()
+		response.Reply(
+			tq.NewAuthorReply(
+				tq.SetAuthorReplyStatus(tq.AuthorStatusError),
+				tq.SetAuthorReplyServerMsg("unable to decode AuthorRequest packet"),
+			),
+		)
+		return
+	}
+	ctx, cancel := context.WithTimeout(request.Context, a.opts.timeout)
+	defer cancel()
+	d, err := a.decide(ctx, NewRequest(request.Context, a.user, body))
+	if err != nil {
+		policyHandleError.Inc()
+		a.Errorf(request.Context, "unable to authorize user [%v] with policy service [%v]; %v", body.User, a.opts.url, err)
+		if a.opts.failOpen {
+			policyHandleFailOpen.Inc()
+			response.Reply(tq.NewAuthorReply(tq.SetAuthorReplyStatus(tq.AuthorStatusPassAdd)))
+			return
+		}
+		response.Reply(
+			tq.NewAuthorReply(
+				tq.SetAuthorReplyStatus(tq.AuthorStatusFail),
+				tq.SetAuthorReplyServerMsg(unavailableMsg),
+			),
+		)
+		return
+	}
+	switch d.Status {
+	case StatusPassAdd:
+		policyHandlePassAdd.Inc()
+	case StatusPassRepl:
+		policyHandlePassRepl.Inc()
+	default:
+		policyHandleFail.Inc()
+	}
+	response.Reply(d.Reply())
+}
+
+// Reply is the AuthorReply of the decision.  Args are only relayed when the request is permitted.
+func (d Decision) Reply() *tq.AuthorReply {
+	status := tq.AuthorStatusFail
+	args := d.Args
+	switch d.Status {
+	case StatusPassAdd:
+		status = tq.AuthorStatusPassAdd
+	case StatusPassRepl:
+		status = tq.AuthorStatusPassRepl
+	default:
+		args = nil
+	}
+	return tq.NewAuthorReply(
+		tq.SetAuthorReplyStatus(status),
+		tq.SetAuthorReplyArgs(args...),
+		tq.SetAuthorReplyServerMsg(d.ServerMsg),
+		tq.SetAuthorReplyData(tq.AuthorData(d.Data)),
+	)
+}
+
+// NewRequest builds the Request of user for body.  The device is read from ctx.
+func NewRequest(ctx context.Context, user config.User, body tq.AuthorRequest) Request {
+	r := Request{
+		User:          string(body.User),
+		PrivLvl:       uint8(body.PrivLvl),
+		AuthenMethod:  body.Method.String(),
+		AuthenType:    body.Type.String(),
+		AuthenService: body.Service.String(),
+		Port:          string(body.Port),
+		RemAddr:       string(body.RemAddr),
+		Args:          make([]string, 0, len(body.Args)),
+	}
+	if len(user.Scopes) > 0 {
+		r.Scope = user.Scopes[0]
+	}
+	r.Device, _ = ctx.Value(tq.ContextConnRemoteAddr).(string)
+	for _, arg := range body.Args {
+		r.Args = append(r.Args, arg.String())
+	}
+	return r
+}
+
+// decide asks the policy service for its decision on r
+func (a *Authorizer) decide(ctx context.Context, r Request) (Decision, error) {
+	var d Decision
+	var err error
+	if a.opts.protocol == "grpc" {
+		d, err = a.decideGRPC(ctx, r)
+	} else {
+		d, err = a.decideHTTP(ctx, r)
+	}
+	if err != nil {
+		return d, err
+	}
+	switch d.Status {
+	case StatusPassAdd, StatusPassRepl, StatusFail:
+		return d, nil
+	}
+	return d, fmt.Errorf("unknown decision status [%v]", d.Status)
+}
+
+// decideHTTP POSTs r as json and decodes the Decision in the response
+func (a *Authorizer) decideHTTP(ctx context.Context, r Request) (Decision, error) {
+	var d Decision
+	b, err := json.Marshal(r)
+	if err != nil {
+		return d, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.opts.url, bytes.NewReader(b))
+	if err != nil {
+		return d, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.opts.authorization != "" {
+		req.Header.Set("Authorization", a.opts.authorization)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return d, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+		return d, fmt.Errorf("unexpected status [%v]", resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&d); err != nil {
+		return d, fmt.Errorf("unable to decode decision; %v", err)
+	}
+	return d, nil
+}
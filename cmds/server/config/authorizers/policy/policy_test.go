@@ -0,0 +1,174 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+	"github.com/facebookincubator/tacquito/cmds/server/grpcwire"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (mockLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+// authorize runs an authorization request for user through a with options
+func authorize(t *testing.T, a *Authorizer, options map[string]string, args ...string) *tq.AuthorReply {
+	u := config.User{Name: "alice", Scopes: []string{"lab"}}
+	h, err := a.New(u, options)
+	require.NoError(t, err)
+	body := tq.NewAuthorRequest(
+		tq.SetAuthorRequestMethod(tq.AuthenMethodTacacsPlus),
+		tq.SetAuthorRequestPrivLvl(tq.PrivLvlRoot),
+		tq.SetAuthorRequestType(tq.AuthenTypeASCII),
+		tq.SetAuthorRequestService(tq.AuthenServiceLogin),
+		tq.SetAuthorRequestUser("alice"),
+		tq.SetAuthorRequestPort("tty0"),
+		tq.SetAuthorRequestRemAddr("192.0.2.1"),
+		tq.SetAuthorRequestArgs(tq.Args{}),
+	)
+	for _, arg := range args {
+		body.Args.Append(arg)
+	}
+	b, err := body.MarshalBinary()
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), tq.ContextConnRemoteAddr, "2001:db8::1")
+	r := &configtest.Response{}
+	h.Handle(r, tq.Request{Header: *tq.NewHeader(tq.SetHeaderType(tq.Authorize)), Body: b, Context: ctx})
+	require.NotNil(t, r.Author)
+	return r.Author
+}
+
+func TestPolicyHTTP(t *testing.T) {
+	var got Request
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		d := Decision{Status: StatusFail, ServerMsg: "denied by policy"}
+		switch got.Args[1] {
+		case "cmd=show":
+			d = Decision{Status: StatusPassAdd, Args: []string{"priv-lvl=15"}}
+		case "cmd=configure":
+			d = Decision{Status: StatusPassRepl, Args: []string{"service=shell", "cmd=configure", "cmd-arg=private"}}
+		}
+		json.NewEncoder(w).Encode(d)
+	}))
+	defer server.Close()
+	a := New(mockLogger{})
+	options := map[string]string{"url": server.URL, "authorization": "Bearer token"}
+
+	reply := authorize(t, a, options, "service=shell", "cmd=show")
+	assert.Equal(t, tq.AuthorStatusPassAdd, reply.Status)
+	assert.Equal(t, tq.Args{"priv-lvl=15"}, reply.Args)
+	assert.Equal(t, Request{
+		User:          "alice",
+		Scope:         "lab",
+		PrivLvl:       15,
+		AuthenMethod:  tq.AuthenMethodTacacsPlus.String(),
+		AuthenType:    tq.AuthenTypeASCII.String(),
+		AuthenService: tq.AuthenServiceLogin.String(),
+		Port:          "tty0",
+		RemAddr:       "192.0.2.1",
+		Device:        "2001:db8::1",
+		Args:          []string{"service=shell", "cmd=show"},
+	}, got)
+	assert.Equal(t, "Bearer token", auth)
+
+	reply = authorize(t, a, options, "service=shell", "cmd=configure")
+	assert.Equal(t, tq.AuthorStatusPassRepl, reply.Status)
+	assert.Equal(t, tq.Args{"service=shell", "cmd=configure", "cmd-arg=private"}, reply.Args)
+
+	reply = authorize(t, a, options, "service=shell", "cmd=reload")
+	assert.Equal(t, tq.AuthorStatusFail, reply.Status)
+	assert.Equal(t, tq.AuthorServerMsg("denied by policy"), reply.ServerMsg)
+}
+
+func TestPolicyUnavailable(t *testing.T) {
+	block := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer slow.Close()
+	defer close(block)
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"status": "maybe"}`)
+	}))
+	defer broken.Close()
+	a := New(mockLogger{})
+
+	for _, url := range []string{slow.URL, broken.URL} {
+		reply := authorize(t, a, map[string]string{"url": url, "timeout": "50ms"}, "service=shell", "cmd=show")
+		assert.Equal(t, tq.AuthorStatusFail, reply.Status, "fails closed by default")
+		assert.Equal(t, tq.AuthorServerMsg(unavailableMsg), reply.ServerMsg)
+
+		reply = authorize(t, a, map[string]string{"url": url, "timeout": "50ms", "fail_open": "true"}, "service=shell", "cmd=show")
+		assert.Equal(t, tq.AuthorStatusPassAdd, reply.Status)
+		assert.Empty(t, reply.Args, "failing open permits the request as is")
+	}
+}
+
+func TestPolicyGRPC(t *testing.T) {
+	var got Request
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, AuthorizePath, r.URL.Path)
+		assert.Equal(t, "application/grpc", r.Header.Get("Content-Type"))
+		m, err := grpcwire.ReadMessage(r.Body, maxResponseSize)
+		require.NoError(t, err)
+		require.NoError(t, got.UnmarshalBinary(m))
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		b, _ := Decision{Status: StatusPassAdd, Args: []string{"priv-lvl=15"}, ServerMsg: "ok"}.MarshalBinary()
+		w.Write(grpcwire.Frame(b))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	a := New(mockLogger{}, SetHTTPClient(server.Client()))
+
+	reply := authorize(t, a, map[string]string{"url": server.URL, "protocol": "grpc"}, "service=shell", "cmd=show")
+	assert.Equal(t, tq.AuthorStatusPassAdd, reply.Status)
+	assert.Equal(t, tq.Args{"priv-lvl=15"}, reply.Args)
+	assert.Equal(t, tq.AuthorServerMsg("ok"), reply.ServerMsg)
+	assert.Equal(t, "lab", got.Scope)
+	assert.Equal(t, uint8(15), got.PrivLvl)
+	assert.Equal(t, []string{"service=shell", "cmd=show"}, got.Args)
+}
+
+func TestPolicyOptions(t *testing.T) {
+	o, err := newSupportedOptions(map[string]string{"url": "http://localhost:8181/v1/authorize"})
+	require.NoError(t, err)
+	assert.Equal(t, supportedOptions{url: "http://localhost:8181/v1/authorize", protocol: "http", timeout: defaultTimeout}, o)
+
+	for _, options := range []map[string]string{
+		{},
+		{"url": "ftp://localhost"},
+		{"url": "http://localhost", "protocol": "grpc"},
+		{"url": "https://localhost", "protocol": "thrift"},
+		{"url": "https://localhost", "timeout": "soon"},
+		{"url": "https://localhost", "timeout": "0s"},
+		{"url": "https://localhost", "fail_open": "sometimes"},
+	} {
+		_, err := New(mockLogger{}).New(config.User{}, options)
+		assert.Error(t, err, "options %v", options)
+	}
+}
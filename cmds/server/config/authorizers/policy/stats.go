@@ -0,0 +1,48 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package policy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	policyHandlePassAdd = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "policy_handle_pass_add",
+		Help:      "number of policy authorize requests permitted with pass add",
+	})
+	policyHandlePassRepl = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "policy_handle_pass_replace",
+		Help:      "number of policy authorize requests permitted with pass replace",
+	})
+	policyHandleFail = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "policy_handle_fail",
+		Help:      "number of policy authorize requests denied by the policy service",
+	})
+	policyHandleError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "policy_handle_error",
+		Help:      "number of policy authorize requests the policy service failed to decide",
+	})
+	policyHandleFailOpen = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "policy_handle_fail_open",
+		Help:      "number of policy authorize requests permitted as the policy service failed to decide",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(policyHandlePassAdd)
+	prometheus.MustRegister(policyHandlePassRepl)
+	prometheus.MustRegister(policyHandleFail)
+	prometheus.MustRegister(policyHandleError)
+	prometheus.MustRegister(policyHandleFailOpen)
+}
@@ -0,0 +1,187 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package stringy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// auditLogger is the destination of audit records, eg a log.Logger
+type auditLogger interface {
+	Printf(format string, args ...interface{})
+}
+
+// SetAuditLog writes a Verdict, as json, for every authorization decision to l.  Records say
+// which config rule permitted or denied the request, for compliance reviews.
+func SetAuditLog(l auditLogger) Option {
+	return func(a *Authorizer) {
+		a.audit = &auditor{sink: l}
+	}
+}
+
+// Verdict is the audit record of an authorization decision
+type Verdict struct {
+	Time  time.Time `json:"time"`
+	User  string    `json:"user"`
+	Scope string    `json:"scope,omitempty"`
+	// RemAddr is the address of the user, as reported by the device
+	RemAddr string `json:"rem_addr,omitempty"`
+	// Device is the address of the device sending the request
+	Device   string   `json:"device,omitempty"`
+	Platform string   `json:"platform,omitempty"`
+	Args     []string `json:"args"`
+	Permit   bool     `json:"permit"`
+	// Reason says why the request was permitted or denied, eg matched command
+	Reason string `json:"reason"`
+	// Rules are the config entries that decided, empty when none did, eg the default action
+	Rules []Rule `json:"rules,omitempty"`
+	// Cached is true when the decision was served from the command cache
+	Cached bool `json:"cached,omitempty"`
+}
+
+// Rule identifies a config entry that decided a Verdict
+type Rule struct {
+	// Type is command, service or file_transfer
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	// Position is the index of the entry among the user's entries of its type, in evaluation order
+	Position int `json:"position"`
+	// Source is where the entry is configured, eg group [ops]
+	Source string `json:"source,omitempty"`
+	// Pattern is the regex of the entry that matched, if any
+	Pattern string `json:"pattern,omitempty"`
+	Action  string `json:"action,omitempty"`
+}
+
+// decision is the outcome of an evaluation and why
+type decision struct {
+	permit bool
+	reason string
+	rules  []Rule
+	cached bool
+}
+
+// actionName names a config.Action for audit records
+func actionName(a config.Action) string {
+	switch a {
+	case config.PERMIT:
+		return "permit"
+	case config.DENY:
+		return "deny"
+	}
+	return fmt.Sprint(int(a))
+}
+
+// sources holds where each of a user's commands, services and file transfers is configured, in
+// the order ReduceAll leaves them
+type sources struct {
+	commands, services, fileTransfers []string
+}
+
+// newSources must be called before ReduceAll, while the user's groups are still separate
+func newSources(u config.User) *sources {
+	s := &sources{}
+	add := func(from string, commands, services, fileTransfers int) {
+		for i := 0; i < commands; i++ {
+			s.commands = append(s.commands, from)
+		}
+		for i := 0; i < services; i++ {
+			s.services = append(s.services, from)
+		}
+		for i := 0; i < fileTransfers; i++ {
+			s.fileTransfers = append(s.fileTransfers, from)
+		}
+	}
+	add(fmt.Sprintf("user [%v]", u.Name), len(u.Commands), len(u.Services), len(u.FileTransfers))
+	for _, g := range u.Groups {
+		add(fmt.Sprintf("group [%v]", g.Name), len(g.Commands), len(g.Services), len(g.FileTransfers))
+	}
+	return s
+}
+
+// of returns the source at position i of sources, or an empty string if it is unknown
+func of(sources []string, i int) string {
+	if i < len(sources) {
+		return sources[i]
+	}
+	return ""
+}
+
+// command returns the rule of the user's command at position i
+func (s *sources) command(i int, c config.Command, pattern string) Rule {
+	r := Rule{Type: "command", Name: c.Name, Position: i, Pattern: pattern, Action: actionName(c.Action)}
+	if s != nil {
+		r.Source = of(s.commands, i)
+	}
+	return r
+}
+
+// service returns the rule of the user's service at position i
+func (s *sources) service(i int, c config.Service) Rule {
+	r := Rule{Type: "service", Name: c.Name, Position: i}
+	if s != nil {
+		r.Source = of(s.services, i)
+	}
+	return r
+}
+
+// fileTransfer returns the rule of the user's file transfer at position i
+func (s *sources) fileTransfer(i int, f config.FileTransfer, pattern string) Rule {
+	r := Rule{Type: "file_transfer", Position: i, Pattern: pattern, Action: actionName(f.Action)}
+	if s != nil {
+		r.Source = of(s.fileTransfers, i)
+	}
+	return r
+}
+
+// auditor writes the Verdicts of decisions to its sink
+type auditor struct {
+	loggerProvider
+	sink auditLogger
+}
+
+// record writes the Verdict of d.  A nil auditor records nothing.
+func (a *auditor) record(ctx context.Context, u config.User, body tq.AuthorRequest, d decision) {
+	if a == nil {
+		return
+	}
+	v := Verdict{
+		Time:     time.Now().UTC(),
+		User:     string(body.User),
+		RemAddr:  string(body.RemAddr),
+		Platform: platformFromContext(ctx),
+		Args:     make([]string, 0, len(body.Args)),
+		Permit:   d.permit,
+		Reason:   d.reason,
+		Rules:    d.rules,
+		Cached:   d.cached,
+	}
+	if len(u.Scopes) > 0 {
+		v.Scope = u.Scopes[0]
+	}
+	if ctx != nil {
+		v.Device, _ = ctx.Value(tq.ContextConnRemoteAddr).(string)
+	}
+	for _, arg := range body.Args {
+		v.Args = append(v.Args, arg.String())
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		stringyAuditError.Inc()
+		a.Errorf(ctx, "unable to marshal audit record for user [%v]; %v", v.User, err)
+		return
+	}
+	stringyAuditRecord.Inc()
+	a.sink.Printf("%s", b)
+}
@@ -0,0 +1,68 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package stringy
+
+import (
+	"sync"
+	"time"
+)
+
+// commandKey identifies a command authorization result.  The platform is part of the key since
+// the same command can be permitted on one platform and denied on another.
+type commandKey struct {
+	platform string
+	cmd      string
+	args     string
+}
+
+type commandResult struct {
+	decision decision
+	expires  time.Time
+}
+
+// commandCache holds command authorization results for a single user.  A cache is created with
+// every user instance, so a config reload discards it along with the policy it was built from.
+type commandCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	size    int
+	results map[commandKey]commandResult
+}
+
+func newCommandCache(ttl time.Duration, size int) *commandCache {
+	return &commandCache{ttl: ttl, size: size, results: make(map[commandKey]commandResult)}
+}
+
+// get returns a cached result and true, or false if there is no unexpired result for k
+func (c *commandCache) get(k commandKey) (decision, bool) {
+	c.Lock()
+	defer c.Unlock()
+	r, ok := c.results[k]
+	if !ok {
+		stringyCommandCacheMiss.Inc()
+		return decision{}, false
+	}
+	if time.Now().After(r.expires) {
+		delete(c.results, k)
+		stringyCommandCacheMiss.Inc()
+		return decision{}, false
+	}
+	stringyCommandCacheHit.Inc()
+	return r.decision, true
+}
+
+// set stores a result, dropping every cached result first if the cache is full
+func (c *commandCache) set(k commandKey, d decision) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.results[k]; !ok && len(c.results) >= c.size {
+		stringyCommandCacheFlush.Inc()
+		c.results = make(map[commandKey]commandResult)
+	}
+	c.results[k] = commandResult{decision: d, expires: time.Now().Add(c.ttl)}
+}
@@ -10,7 +10,10 @@ package stringy
 
 import (
 	"context"
+	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	tq "github.com/facebookincubator/tacquito"
 	"github.com/facebookincubator/tacquito/cmds/server/config"
@@ -41,6 +44,15 @@ func NewCommandBasedAuthorizer(ctx context.Context, l loggerProvider, b tq.Autho
 	return &CommandBasedAuthorizer{ctx: ctx, loggerProvider: l, body: b, user: u}
 }
 
+// platformFromContext returns the device platform fingerprint, or an empty string if it is unknown
+func platformFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	platform, _ := ctx.Value(tq.ContextPlatform).(string)
+	return platform
+}
+
 // CommandBasedAuthorizer provides a command based authorizer which only work under the following
 // scenarios:
 //
@@ -55,11 +67,21 @@ type CommandBasedAuthorizer struct {
 	ctx  context.Context
 	body tq.AuthorRequest
 	user config.User
+	// cache if set, holds prior results for this user
+	cache *commandCache
+	// now if set, is the clock command windows are evaluated against
+	now func() time.Time
+	// audit if set, records every decision
+	audit *auditor
+	// sources if set, names where the user's commands are configured in audit records
+	sources *sources
 }
 
 // Handle will respond with failures or accepts as needed
 func (a CommandBasedAuthorizer) Handle(response tq.Response, request tq.Request) {
-	if a.evaluate() {
+	d := a.evaluate()
+	a.audit.record(request.Context, a.user, a.body, d)
+	if d.permit {
 		a.Debugf(request.Context, "authorized user [%v] as command based", a.user.Name)
 		stringyHandleAuthorizeAcceptPassAdd.Inc()
 		response.Reply(
@@ -79,7 +101,27 @@ func (a CommandBasedAuthorizer) Handle(response tq.Response, request tq.Request)
 	)
 }
 
-func (a CommandBasedAuthorizer) evaluate() bool {
+// evaluate returns the cached result for the command if there is one, otherwise it evaluates
+// the command and caches the result
+func (a CommandBasedAuthorizer) evaluate() decision {
+	platform := platformFromContext(a.ctx)
+	if a.cache == nil {
+		return a.evaluateCommands(platform)
+	}
+	k := commandKey{platform: platform, cmd: a.body.Args.Command(), args: a.body.Args.CommandArgsNoLE()}
+	if d, ok := a.cache.get(k); ok {
+		d.cached = true
+		return d
+	}
+	d := a.evaluateCommands(platform)
+	a.cache.set(k, d)
+	return d
+}
+
+// evaluateCommands matches the command against the user's commands that apply to platform.  The
+// first command that matches decides, and the user's default action decides commands that match
+// none.
+func (a CommandBasedAuthorizer) evaluateCommands(platform string) decision {
 	cmd := a.body.Args.Command()
 	returnBool := func(c config.Action) bool {
 		switch c {
@@ -89,38 +131,93 @@ func (a CommandBasedAuthorizer) evaluate() bool {
 			return false
 		}
 	}
-	for _, c := range a.user.Commands {
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	for i, c := range a.user.Commands {
 		c.TrimSpace()
-		if c.Name == "*" {
-			// special condition of allow anything
-			return returnBool(c.Action)
+		if !c.AppliesTo(platform) {
+			continue
+		}
+		if open, err := inWindows(c.Windows, now()); err != nil {
+			a.Errorf(a.ctx, "bad window detected in command [%v]; %v", c.Name, err)
+			return decision{reason: "bad window", rules: []Rule{a.sources.command(i, c, "")}}
+		} else if !open {
+			continue
 		}
-		if c.Name != cmd {
+		if c.Name != "*" && c.Name != cmd {
 			continue
 		}
-		if len(c.Match) == 0 {
-			// cmd matches, but we have no conditions, so match it
-			return returnBool(c.Action)
+		pattern, matched, err := a.matches(c, cmd)
+		if err != nil {
+			a.Errorf(a.ctx, "bad regex detected; %v", err)
+			return decision{reason: "bad regex", rules: []Rule{a.sources.command(i, c, "")}}
+		}
+		if matched {
+			return decision{permit: returnBool(c.Action), reason: "matched command", rules: []Rule{a.sources.command(i, c, pattern)}}
 		}
+	}
+	if a.user.DefaultAction == 0 {
+		return decision{reason: "no command matched"}
+	}
+	return decision{
+		permit: returnBool(a.user.DefaultAction),
+		reason: fmt.Sprintf("no command matched, default action [%v]", actionName(a.user.DefaultAction)),
+	}
+}
 
-		for _, regexish := range c.Match {
-			if len(regexish) == 0 {
-				continue
-			}
-			// guard against regexes that are not anchored to the start and end of the string
-			if regexish[0] != regexStartByte {
-				regexish = regexStartStr + regexish
-			}
-			if regexish[len(regexish)-1] != regexEndByte {
-				regexish = regexish + regexEndStr
-			}
-			if matched, err := regexp.MatchString(regexish, a.body.Args.CommandArgsNoLE()); err != nil {
-				a.Errorf(a.ctx, "bad regex detected; %v", err)
-				return false
-			} else if matched {
-				return returnBool(c.Action)
-			}
+// matches reports whether the args of the request match c, and none of its exceptions, along with
+// the pattern that matched.  The * command matches every command, and its exceptions are matched
+// against the whole command line.
+func (a CommandBasedAuthorizer) matches(c config.Command, cmd string) (string, bool, error) {
+	args := a.body.Args.CommandArgsNoLE()
+	subject := args
+	var pattern string
+	matched := len(c.Match) == 0
+	if c.Name == "*" {
+		// special condition of allow anything
+		subject = strings.TrimSpace(cmd + " " + args)
+		matched = true
+	}
+	for _, regexish := range c.Match {
+		if matched {
+			break
+		}
+		if len(regexish) == 0 {
+			continue
 		}
+		ok, err := regexp.MatchString(anchor(regexish), args)
+		if err != nil {
+			return "", false, err
+		}
+		matched, pattern = ok, regexish
+	}
+	if !matched {
+		return "", false, nil
+	}
+	for _, regexish := range c.Except {
+		if len(regexish) == 0 {
+			continue
+		}
+		excepted, err := regexp.MatchString(anchor(regexish), subject)
+		if err != nil {
+			return "", false, err
+		}
+		if excepted {
+			return "", false, nil
+		}
+	}
+	return pattern, true, nil
+}
+
+// anchor guards against regexes that are not anchored to the start and end of the string
+func anchor(regexish string) string {
+	if regexish[0] != regexStartByte {
+		regexish = regexStartStr + regexish
+	}
+	if regexish[len(regexish)-1] != regexEndByte {
+		regexish = regexish + regexEndStr
 	}
-	return false
+	return regexish
 }
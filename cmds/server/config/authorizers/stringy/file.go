@@ -0,0 +1,148 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package stringy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// fileTransferService is the service requested by clients authorizing scp/sftp operations
+const fileTransferService = "file-transfer"
+
+// NewFileTransferAuthorizer will return a FileTransferAuthorizer. If initial request params
+// are not suitable for file transfers, it returns nil
+func NewFileTransferAuthorizer(ctx context.Context, l loggerProvider, b tq.AuthorRequest, u config.User) *FileTransferAuthorizer {
+	if b.Args.Service() != fileTransferService {
+		return nil
+	}
+	return &FileTransferAuthorizer{ctx: ctx, loggerProvider: l, body: b, user: u}
+}
+
+// FileTransferAuthorizer authorizes file operations against the user's file transfer rules.
+// Requests take the form of:
+//
+// service=file-transfer protocol=scp direction=up path=/harddisk:/images/xr.iso
+//
+// direction is up, onto the device, or down, off of the device.  Every path in the request must
+// be permitted, so a multi file copy fails if any one file is denied.  First match wins.
+type FileTransferAuthorizer struct {
+	loggerProvider
+	ctx  context.Context
+	body tq.AuthorRequest
+	user config.User
+	// audit if set, records every decision
+	audit *auditor
+	// sources if set, names where the user's file transfers are configured in audit records
+	sources *sources
+}
+
+// Handle will respond with failures or accepts as needed
+func (a FileTransferAuthorizer) Handle(response tq.Response, request tq.Request) {
+	d := a.evaluate()
+	a.audit.record(request.Context, a.user, a.body, d)
+	if d.permit {
+		a.Debugf(request.Context, "authorized user [%v] for file transfer", a.user.Name)
+		stringyHandleAuthorizeAcceptPassAdd.Inc()
+		response.Reply(
+			tq.NewAuthorReply(
+				tq.SetAuthorReplyStatus(tq.AuthorStatusPassAdd),
+			),
+		)
+		return
+	}
+	a.Debugf(request.Context, "user [%v] failed file transfer authorization", a.user.Name)
+	stringyHandleAuthorizeFail.Inc()
+	stringyFileTransferDeny.Inc()
+	response.Reply(
+		tq.NewAuthorReply(
+			tq.SetAuthorReplyStatus(tq.AuthorStatusFail),
+			tq.SetAuthorReplyServerMsg("not authorized"),
+		),
+	)
+}
+
+// evaluate permits the request if every path is permitted.  The rules of the decision are those
+// that permitted each path, or the one that denied the first path denied.
+func (a FileTransferAuthorizer) evaluate() decision {
+	var protocol string
+	var direction config.Direction
+	var paths []string
+	for _, arg := range a.body.Args {
+		attr, _, v := arg.ASV()
+		switch attr {
+		case "protocol":
+			protocol = v
+		case "direction":
+			direction = config.Direction(v)
+		case "path":
+			paths = append(paths, v)
+		}
+	}
+	if direction != config.UPLOAD && direction != config.DOWNLOAD {
+		a.Debugf(a.ctx, "file transfer request has an unknown direction [%v]", direction)
+		return decision{reason: "unknown direction"}
+	}
+	if len(paths) == 0 {
+		a.Debugf(a.ctx, "file transfer request has no path")
+		return decision{reason: "no path"}
+	}
+	d := decision{permit: true, reason: "matched file transfer"}
+	for _, path := range paths {
+		permit, rule := a.permitted(protocol, direction, path)
+		if !permit {
+			if rule == nil {
+				return decision{reason: fmt.Sprintf("no file transfer matched path [%v]", path)}
+			}
+			return decision{reason: fmt.Sprintf("file transfer denied path [%v]", path), rules: []Rule{*rule}}
+		}
+		d.rules = append(d.rules, *rule)
+	}
+	return d
+}
+
+// permitted returns the action of the first rule matching the transfer, and the rule, denying if
+// none match
+func (a FileTransferAuthorizer) permitted(protocol string, direction config.Direction, path string) (bool, *Rule) {
+	for i, f := range a.user.FileTransfers {
+		f.TrimSpace()
+		if f.Direction != "" && f.Direction != direction {
+			continue
+		}
+		if len(f.Protocols) > 0 && !contains(f.Protocols, protocol) {
+			continue
+		}
+		for _, regexish := range f.Paths {
+			if len(regexish) == 0 {
+				continue
+			}
+			if matched, err := regexp.MatchString(anchor(regexish), path); err != nil {
+				a.Errorf(a.ctx, "bad regex detected; %v", err)
+				rule := a.sources.fileTransfer(i, f, regexish)
+				return false, &rule
+			} else if matched {
+				rule := a.sources.fileTransfer(i, f, regexish)
+				return f.Action == config.PERMIT, &rule
+			}
+		}
+	}
+	return false, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -44,11 +44,21 @@ type SessionBasedAuthorizer struct {
 	ctx  context.Context
 	body tq.AuthorRequest
 	user config.User
+	// audit if set, records every decision
+	audit *auditor
+	// sources if set, names where the user's services are configured in audit records
+	sources *sources
 }
 
 // Handle will respond with failures or accepts as needed
 func (sa SessionBasedAuthorizer) Handle(response tq.Response, request tq.Request) {
-	if args, status := sa.evaluate(); len(args) > 0 {
+	args, status, rules := sa.evaluate()
+	d := decision{permit: len(args) > 0, reason: "matched services", rules: rules}
+	if !d.permit {
+		d.reason = "no service matched"
+	}
+	sa.audit.record(request.Context, sa.user, sa.body, d)
+	if d.permit {
 		sa.Debugf(request.Context, "authorized user [%v] as session based; args %v", sa.user.Name, args)
 		switch status {
 		case tq.AuthorStatusPassAdd:
@@ -74,18 +84,23 @@ func (sa SessionBasedAuthorizer) Handle(response tq.Response, request tq.Request
 	)
 }
 
-// evaluate is the main entry point for session based auth flows
-func (sa SessionBasedAuthorizer) evaluate() ([]string, tq.AuthorStatus) {
+// evaluate is the main entry point for session based auth flows.  It returns the args of the
+// response, its status and the services that contributed args.
+func (sa SessionBasedAuthorizer) evaluate() ([]string, tq.AuthorStatus, []Rule) {
 	// overload the body.Args fields to include injected arg concepts in them.  Doing so artifically injects avps into the
 	// requested client args and allows them to behave in evaluation the same as if they came from the client.  We do this for
 	// args that will never present in a client request, but for things we'd like to filter on.  A use cases is filtering for scope
 	sa.body.Args = append(sa.body.Args, tq.Arg(sa.user.GetLocalizedScope()))
+	if platform := platformFromContext(sa.ctx); platform != "" {
+		sa.body.Args = append(sa.body.Args, tq.Arg("platform="+platform))
+	}
 
 	args := sa.body.Args.Args()
 	responseArgs := make(tq.Args, 0, len(args))
 	authorStatus := tq.AuthorStatusPassAdd
+	var rules []Rule
 
-	for _, s := range sa.user.Services {
+	for i, s := range sa.user.Services {
 		s.TrimSpace()
 		// optional == true means we hit a client delim of * or we encountered it in our own config
 		// via Optional = true.
@@ -93,9 +108,12 @@ func (sa SessionBasedAuthorizer) evaluate() ([]string, tq.AuthorStatus) {
 		if optional {
 			authorStatus = tq.AuthorStatusPassRepl
 		}
+		if len(matched) > 0 {
+			rules = append(rules, sa.sources.service(i, s))
+		}
 		responseArgs.Append(matched...)
 	}
-	return responseArgs.Args(), authorStatus
+	return responseArgs.Args(), authorStatus, rules
 }
 
 // serviceMatcherModifier matches incoming attribute value pairs from the client against our config
@@ -33,11 +33,46 @@ var (
 		Name:      "stringy_handle_authorize_error",
 		Help:      "number of stringy authorize error packets",
 	})
+	stringyHandleAuthorizeOutsideValidity = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "stringy_handle_authorize_outside_validity",
+		Help:      "number of stringy authorize requests denied as the user is expired or outside of its windows",
+	})
 	stringyHandleUnexpectedPacket = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "stringy_handle_unexpected_packet",
 		Help:      "number of stringy handle unexpected packets",
 	})
+	stringyFileTransferDeny = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "stringy_file_transfer_deny",
+		Help:      "number of denied file transfer authorizations",
+	})
+	stringyCommandCacheHit = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "stringy_command_cache_hit",
+		Help:      "number of command authorizations answered from the cache",
+	})
+	stringyCommandCacheMiss = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "stringy_command_cache_miss",
+		Help:      "number of command authorizations not found in the cache",
+	})
+	stringyCommandCacheFlush = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "stringy_command_cache_flush",
+		Help:      "number of times a full command cache was flushed",
+	})
+	stringyAuditRecord = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "stringy_audit_record",
+		Help:      "number of authorization decisions written to the audit log",
+	})
+	stringyAuditError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "stringy_audit_error",
+		Help:      "number of authorization decisions that could not be written to the audit log",
+	})
 )
 
 func init() {
@@ -45,5 +80,12 @@ func init() {
 	prometheus.MustRegister(stringyHandleAuthorizeAcceptPassAdd)
 	prometheus.MustRegister(stringyHandleAuthorizeFail)
 	prometheus.MustRegister(stringyHandleAuthorizeError)
+	prometheus.MustRegister(stringyHandleAuthorizeOutsideValidity)
 	prometheus.MustRegister(stringyHandleUnexpectedPacket)
+	prometheus.MustRegister(stringyFileTransferDeny)
+	prometheus.MustRegister(stringyCommandCacheHit)
+	prometheus.MustRegister(stringyCommandCacheMiss)
+	prometheus.MustRegister(stringyCommandCacheFlush)
+	prometheus.MustRegister(stringyAuditRecord)
+	prometheus.MustRegister(stringyAuditError)
 }
@@ -11,6 +11,8 @@ package stringy
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	tq "github.com/facebookincubator/tacquito"
 	"github.com/facebookincubator/tacquito/cmds/server/config"
@@ -23,40 +25,104 @@ type loggerProvider interface {
 	Debugf(ctx context.Context, format string, args ...interface{})
 }
 
+// Option provides a way to modify the Authorizer
+type Option func(a *Authorizer)
+
+// SetCommandCache caches up to size command authorization results per user for ttl.  Results are
+// keyed by the device platform, command and command args, and are discarded on config reloads.
+// A ttl or size <= 0 disables the cache, the default.  Users with command windows are never
+// cached, as their results change with time.
+func SetCommandCache(ttl time.Duration, size int) Option {
+	return func(a *Authorizer) {
+		a.cacheTTL = ttl
+		a.cacheSize = size
+	}
+}
+
 // New stringy Authorizer
-func New(l loggerProvider) *Authorizer {
-	return &Authorizer{loggerProvider: l}
+func New(l loggerProvider, opts ...Option) *Authorizer {
+	a := &Authorizer{loggerProvider: l, now: time.Now}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.audit != nil {
+		a.audit.loggerProvider = l
+	}
+	return a
 }
 
 // Authorizer is for authorization of commands and such
 type Authorizer struct {
 	loggerProvider
-	user config.User
+	user      config.User
+	cacheTTL  time.Duration
+	cacheSize int
+	cache     *commandCache
+	now       func() time.Time
+	audit     *auditor
+	sources   *sources
 }
 
 // New creates a new stringy authorizer which implements tq.Handler
 func (a Authorizer) New(user config.User) (tq.Handler, error) {
 	// ReduceAll appends all group level services and commands to the user level
 	// user level overrides for services and commands are processed first, then the groups.
+	var src *sources
+	if a.audit != nil {
+		src = newSources(user)
+	}
 	a.ReduceAll(&user)
-	return &Authorizer{
+	if err := validateWindows(user); err != nil {
+		return nil, fmt.Errorf("user [%v]; %v", user.Name, err)
+	}
+	switch user.DefaultAction {
+	case 0, config.PERMIT, config.DENY:
+	default:
+		return nil, fmt.Errorf("user [%v]; unknown default action [%v]", user.Name, user.DefaultAction)
+	}
+	n := &Authorizer{
 		loggerProvider: a.loggerProvider,
 		user:           user,
-	}, nil
+		now:            a.now,
+		audit:          a.audit,
+		sources:        src,
+	}
+	if a.cacheTTL > 0 && a.cacheSize > 0 && !hasCommandWindows(user) {
+		n.cache = newCommandCache(a.cacheTTL, a.cacheSize)
+	}
+	return n, nil
 }
 
-// ReduceAll will collapse all services and commands down to the user level
+// ReduceAll will collapse all services and commands down to the user level.  The user's validity
+// and default action override the groups', otherwise the first group's apply.
 func (a Authorizer) ReduceAll(u *config.User) {
 	for _, g := range u.Groups {
 		u.Services = append(u.Services, g.Services...)
 		u.Commands = append(u.Commands, g.Commands...)
+		u.FileTransfers = append(u.FileTransfers, g.FileTransfers...)
+		if u.Validity == nil {
+			u.Validity = g.Validity
+		}
+		if u.DefaultAction == 0 {
+			u.DefaultAction = g.DefaultAction
+		}
+	}
+}
+
+// hasCommandWindows reports whether any of the user's commands are limited to windows
+func hasCommandWindows(u config.User) bool {
+	for _, c := range u.Commands {
+		if len(c.Windows) > 0 {
+			return true
+		}
 	}
+	return false
 }
 
 // Handle handles all authenticate message types, scoped to the uid
 func (a Authorizer) Handle(response tq.Response, request tq.Request) {
 	var body tq.AuthorRequest
-	if err := tq.Unmarshal(request.Body, &body); err != nil {
+	if err := request.Unmarshal(&body); err != nil {
 		stringyHandleUnexpectedPacket.Inc()
 		stringyHandleAuthorizeError.Inc()
 		response.Reply(
@@ -80,14 +146,43 @@ func (a Authorizer) Handle(response tq.Response, request tq.Request) {
 		)
 	}
 
+	if reason, err := validityReason(a.user.Validity, a.now()); err != nil || reason != "" {
+		if err != nil {
+			a.Errorf(request.Context, "bad validity on user [%v]; %v", a.user.Name, err)
+			reason = "not authorized"
+		}
+		a.Debugf(request.Context, "user [%v] is not valid at this time; %v", a.user.Name, reason)
+		a.audit.record(request.Context, a.user, body, decision{reason: reason})
+		stringyHandleAuthorizeOutsideValidity.Inc()
+		stringyHandleAuthorizeFail.Inc()
+		response.Reply(
+			tq.NewAuthorReply(
+				tq.SetAuthorReplyStatus(tq.AuthorStatusFail),
+				tq.SetAuthorReplyServerMsg(reason),
+			),
+		)
+		return
+	}
+
 	if authorizer := NewCommandBasedAuthorizer(request.Context, a.loggerProvider, body, a.user); authorizer != nil {
 		a.Debugf(request.Context, "detected user [%v] using command based authorization", a.user.Name)
+		authorizer.cache = a.cache
+		authorizer.now = a.now
+		authorizer.audit, authorizer.sources = a.audit, a.sources
+		authorizer.Handle(response, request)
+		return
+	}
+
+	if authorizer := NewFileTransferAuthorizer(request.Context, a.loggerProvider, body, a.user); authorizer != nil {
+		a.Debugf(request.Context, "detected user [%v] using file transfer authorization", a.user.Name)
+		authorizer.audit, authorizer.sources = a.audit, a.sources
 		authorizer.Handle(response, request)
 		return
 	}
 
 	if authorizer := NewSessionBasedAuthorizer(request.Context, a.loggerProvider, body, a.user); authorizer != nil {
 		a.Debugf(request.Context, "detected user [%v] using session based authorization", a.user.Name)
+		authorizer.audit, authorizer.sources = a.audit, a.sources
 		authorizer.Handle(response, request)
 		return
 	}
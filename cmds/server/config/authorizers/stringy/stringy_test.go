@@ -9,12 +9,15 @@ package stringy
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"math/rand"
 	"testing"
 	"time"
 
 	tq "github.com/facebookincubator/tacquito"
 	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -459,7 +462,374 @@ func TestSpecialMatchers(t *testing.T) {
 	for _, test := range tests {
 		r, u := test.setup()
 		sa := NewSessionBasedAuthorizer(context.Background(), NewDefaultLogger(), *r, u)
-		resp, status := sa.evaluate()
+		resp, status, _ := sa.evaluate()
 		test.expect(t, test.name, resp, status)
 	}
 }
+
+func TestCommandPlatforms(t *testing.T) {
+	u := config.User{
+		Name: "cisco",
+		Commands: []config.Command{
+			{Name: "configure", Match: []string{"exclusive"}, Action: config.PERMIT, Platforms: []string{"ios-xr"}},
+			{Name: "show", Action: config.PERMIT},
+		},
+	}
+	r := tq.NewAuthorRequest(tq.SetAuthorRequestArgs(tq.Args{"service=shell", "cmd=configure", "cmd-arg=exclusive"}))
+	xr := context.WithValue(context.Background(), tq.ContextPlatform, "ios-xr")
+	junos := context.WithValue(context.Background(), tq.ContextPlatform, "junos")
+
+	assert.True(t, NewCommandBasedAuthorizer(xr, NewDefaultLogger(), *r, u).evaluate().permit)
+	assert.False(t, NewCommandBasedAuthorizer(junos, NewDefaultLogger(), *r, u).evaluate().permit)
+	assert.False(t, NewCommandBasedAuthorizer(context.Background(), NewDefaultLogger(), *r, u).evaluate().permit)
+
+	// commands without platforms apply everywhere
+	r = tq.NewAuthorRequest(tq.SetAuthorRequestArgs(tq.Args{"service=shell", "cmd=show"}))
+	assert.True(t, NewCommandBasedAuthorizer(junos, NewDefaultLogger(), *r, u).evaluate().permit)
+	assert.True(t, NewCommandBasedAuthorizer(context.Background(), NewDefaultLogger(), *r, u).evaluate().permit)
+}
+
+func TestCommandCache(t *testing.T) {
+	u := config.User{
+		Name:     "cisco",
+		Commands: []config.Command{{Name: "show", Action: config.PERMIT, Platforms: []string{"eos"}}},
+	}
+	cache := newCommandCache(time.Minute, 2)
+	evaluate := func(platform string, args tq.Args) bool {
+		ctx := context.WithValue(context.Background(), tq.ContextPlatform, platform)
+		a := NewCommandBasedAuthorizer(ctx, NewDefaultLogger(), *tq.NewAuthorRequest(tq.SetAuthorRequestArgs(args)), u)
+		a.cache = cache
+		return a.evaluate().permit
+	}
+	show := tq.Args{"service=shell", "cmd=show", "cmd-arg=version"}
+	assert.True(t, evaluate("eos", show))
+	assert.False(t, evaluate("junos", show))
+	assert.Len(t, cache.results, 2)
+
+	// cached results are served without evaluating the user's commands
+	u.Commands = nil
+	assert.True(t, evaluate("eos", show))
+	assert.False(t, evaluate("junos", show))
+
+	// a full cache is flushed before a new result is added
+	assert.False(t, evaluate("eos", tq.Args{"service=shell", "cmd=show", "cmd-arg=clock"}))
+	assert.Len(t, cache.results, 1)
+	assert.False(t, evaluate("eos", show))
+
+	// expired results are evaluated again
+	u.Commands = []config.Command{{Name: "show", Action: config.PERMIT}}
+	cache.ttl = -time.Second
+	assert.True(t, evaluate("junos", show))
+	assert.True(t, evaluate("junos", show))
+}
+
+func TestSessionPlatform(t *testing.T) {
+	u := config.User{
+		Name: "cisco",
+		Services: []config.Service{
+			{
+				Name:      "shell",
+				Match:     []config.Value{{Name: "platform", Values: []string{"eos"}}},
+				SetValues: []config.Value{{Name: "priv-lvl", Values: []string{"15"}}},
+			},
+		},
+	}
+	r := tq.NewAuthorRequest(tq.SetAuthorRequestArgs(tq.Args{"service=shell"}))
+	eos := context.WithValue(context.Background(), tq.ContextPlatform, "eos")
+	resp, _, _ := NewSessionBasedAuthorizer(eos, NewDefaultLogger(), *r, u).evaluate()
+	assert.Equal(t, []string{"priv-lvl=15"}, resp)
+	resp, _, _ = NewSessionBasedAuthorizer(context.Background(), NewDefaultLogger(), *r, u).evaluate()
+	assert.Empty(t, resp)
+}
+
+func TestFileTransfer(t *testing.T) {
+	u := config.User{
+		Name: "netops",
+		FileTransfers: []config.FileTransfer{
+			{Paths: []string{"/harddisk:/images/secret.*"}, Action: config.DENY},
+			{Paths: []string{"/harddisk:/images/.*\\.iso"}, Direction: config.UPLOAD, Protocols: []string{"scp"}, Action: config.PERMIT},
+			{Paths: []string{"/harddisk:/.*"}, Direction: config.DOWNLOAD, Action: config.PERMIT},
+		},
+	}
+	tests := []struct {
+		name   string
+		args   tq.Args
+		permit bool
+	}{
+		{name: "upload an image", args: tq.Args{"service=file-transfer", "protocol=scp", "direction=up", "path=/harddisk:/images/xr.iso"}, permit: true},
+		{name: "upload an image over sftp", args: tq.Args{"service=file-transfer", "protocol=sftp", "direction=up", "path=/harddisk:/images/xr.iso"}},
+		{name: "upload a config", args: tq.Args{"service=file-transfer", "protocol=scp", "direction=up", "path=/harddisk:/images/startup.cfg"}},
+		{name: "download anything", args: tq.Args{"service=file-transfer", "protocol=sftp", "direction=down", "path=/harddisk:/startup.cfg"}, permit: true},
+		{name: "first match wins", args: tq.Args{"service=file-transfer", "protocol=scp", "direction=down", "path=/harddisk:/images/secret.iso"}},
+		{name: "every path must be permitted", args: tq.Args{"service=file-transfer", "protocol=scp", "direction=up", "path=/harddisk:/images/xr.iso", "path=/harddisk:/images/xr.cfg"}},
+		{name: "paths are anchored", args: tq.Args{"service=file-transfer", "protocol=scp", "direction=up", "path=/tmp/harddisk:/images/xr.iso"}},
+		{name: "missing direction", args: tq.Args{"service=file-transfer", "protocol=scp", "path=/harddisk:/images/xr.iso"}},
+		{name: "missing path", args: tq.Args{"service=file-transfer", "protocol=scp", "direction=down"}},
+	}
+	for _, test := range tests {
+		r := tq.NewAuthorRequest(tq.SetAuthorRequestArgs(test.args))
+		a := NewFileTransferAuthorizer(context.Background(), NewDefaultLogger(), *r, u)
+		if assert.NotNil(t, a, test.name) {
+			assert.Equal(t, test.permit, a.evaluate().permit, test.name)
+		}
+	}
+	r := tq.NewAuthorRequest(tq.SetAuthorRequestArgs(tq.Args{"service=shell", "cmd=copy"}))
+	assert.Nil(t, NewFileTransferAuthorizer(context.Background(), NewDefaultLogger(), *r, u))
+}
+
+func TestWindows(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	// 2024-01-01 is a monday
+	monday := func(hour, min int, loc *time.Location) time.Time {
+		return time.Date(2024, 1, 1, hour, min, 0, 0, loc)
+	}
+	tests := []struct {
+		name     string
+		window   config.Window
+		at       time.Time
+		expected bool
+	}{
+		{name: "office hours", window: config.Window{Days: []string{"mon", "fri"}, Start: "09:00", End: "17:00"}, at: monday(9, 0, time.UTC), expected: true},
+		{name: "end is exclusive", window: config.Window{Days: []string{"mon"}, Start: "09:00", End: "17:00"}, at: monday(17, 0, time.UTC)},
+		{name: "other days", window: config.Window{Days: []string{"tue"}, Start: "09:00", End: "17:00"}, at: monday(12, 0, time.UTC)},
+		{name: "every day", window: config.Window{Start: "09:00"}, at: monday(23, 59, time.UTC), expected: true},
+		{name: "timezone", window: config.Window{Start: "09:00", End: "17:00", Timezone: "America/New_York"}, at: monday(16, 0, time.UTC), expected: true},
+		{name: "timezone closed", window: config.Window{Start: "09:00", End: "17:00", Timezone: "America/New_York"}, at: monday(9, 30, time.UTC)},
+		{name: "overnight start", window: config.Window{Days: []string{"MON"}, Start: "22:00", End: "02:00", Timezone: "America/New_York"}, at: monday(23, 0, ny), expected: true},
+		{name: "overnight belongs to the day it starts", window: config.Window{Days: []string{"sun"}, Start: "22:00", End: "02:00"}, at: monday(1, 0, time.UTC), expected: true},
+		{name: "overnight other day", window: config.Window{Days: []string{"mon"}, Start: "22:00", End: "02:00"}, at: monday(1, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		w, err := parseWindow(test.window)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, w.contains(test.at), test.name)
+	}
+
+	for _, bad := range []config.Window{
+		{Days: []string{"monday"}},
+		{Start: "9am"},
+		{Start: "25:00"},
+		{Start: "09:00", End: "09:00"},
+		{Timezone: "Mars/Olympus_Mons"},
+	} {
+		_, err := parseWindow(bad)
+		assert.Error(t, err, "%+v", bad)
+	}
+}
+
+func TestValidity(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		validity *config.Validity
+		expected string
+	}{
+		{name: "none"},
+		{name: "date expires at the end of the day", validity: &config.Validity{Expires: "2024-01-01"}},
+		{name: "expired date", validity: &config.Validity{Expires: "2023-12-31"}, expected: "account expired"},
+		{name: "expired time", validity: &config.Validity{Expires: "2024-01-01T11:59:59Z"}, expected: "account expired"},
+		{name: "in window", validity: &config.Validity{Expires: "2024-02-01", Windows: []config.Window{{Days: []string{"sat"}}, {Days: []string{"mon"}}}}},
+		{name: "outside windows", validity: &config.Validity{Windows: []config.Window{{Days: []string{"sat", "sun"}}}}, expected: "outside of permitted access window"},
+	}
+	for _, test := range tests {
+		reason, err := validityReason(test.validity, at)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, reason, test.name)
+	}
+
+	// groups provide the validity of users without their own
+	group := config.Group{Name: "contractors", Validity: &config.Validity{Expires: "2023-12-31"}}
+	u := config.User{Name: "temp", Groups: []config.Group{{Name: "noc"}, group}}
+	a := New(NewDefaultLogger())
+	a.ReduceAll(&u)
+	assert.Equal(t, group.Validity, u.Validity)
+	u = config.User{Name: "temp", Groups: []config.Group{group}, Validity: &config.Validity{}}
+	a.ReduceAll(&u)
+	assert.Equal(t, &config.Validity{}, u.Validity)
+
+	// bad windows and expiries are rejected when the user is loaded
+	_, err := a.New(config.User{Name: "temp", Validity: &config.Validity{Expires: "next week"}})
+	assert.Error(t, err)
+	_, err = a.New(config.User{Name: "temp", Commands: []config.Command{{Name: "reload", Windows: []config.Window{{Days: []string{"someday"}}}}}})
+	assert.Error(t, err)
+}
+
+func TestCommandWindows(t *testing.T) {
+	u := config.User{
+		Name: "cisco",
+		Commands: []config.Command{
+			{Name: "configure", Action: config.PERMIT, Windows: []config.Window{{Days: []string{"sat"}, Start: "02:00", End: "04:00"}}},
+			{Name: "show", Action: config.PERMIT},
+		},
+	}
+	evaluate := func(at time.Time, args tq.Args) bool {
+		a := NewCommandBasedAuthorizer(context.Background(), NewDefaultLogger(), *tq.NewAuthorRequest(tq.SetAuthorRequestArgs(args)), u)
+		a.now = func() time.Time { return at }
+		return a.evaluate().permit
+	}
+	configure := tq.Args{"service=shell", "cmd=configure", "cmd-arg=terminal"}
+	// 2024-01-06 is a saturday
+	assert.True(t, evaluate(time.Date(2024, 1, 6, 3, 0, 0, 0, time.UTC), configure))
+	assert.False(t, evaluate(time.Date(2024, 1, 6, 5, 0, 0, 0, time.UTC), configure))
+	assert.False(t, evaluate(time.Date(2024, 1, 8, 3, 0, 0, 0, time.UTC), configure))
+	assert.True(t, evaluate(time.Date(2024, 1, 8, 3, 0, 0, 0, time.UTC), tq.Args{"service=shell", "cmd=show"}))
+
+	// users with command windows are not cached
+	a, err := New(NewDefaultLogger(), SetCommandCache(time.Minute, 10)).New(u)
+	assert.NoError(t, err)
+	assert.Nil(t, a.(*Authorizer).cache)
+}
+
+func TestCommandScopes(t *testing.T) {
+	noc := config.Group{
+		Name:     "noc",
+		Commands: []config.Command{{Name: "show", Action: config.PERMIT}, {Name: "*", Action: config.PERMIT, Scopes: []string{"lab"}}},
+		Services: []config.Service{{Name: "shell", SetValues: []config.Value{{Name: "priv-lvl", Values: []string{"1"}}}, Scopes: []string{"prod"}}},
+	}
+	u := config.User{
+		Name:     "cisco",
+		Scopes:   []string{"lab", "prod"},
+		Groups:   []config.Group{noc},
+		Services: []config.Service{{Name: "shell", SetValues: []config.Value{{Name: "priv-lvl", Values: []string{"15"}}}, Scopes: []string{"lab"}}},
+	}
+	localize := func(scope string) config.User {
+		l := u
+		l.LocalizeToScope(scope)
+		New(NewDefaultLogger()).ReduceAll(&l)
+		return l
+	}
+	evaluate := func(u config.User, args tq.Args) bool {
+		return NewCommandBasedAuthorizer(context.Background(), NewDefaultLogger(), *tq.NewAuthorRequest(tq.SetAuthorRequestArgs(args)), u).evaluate().permit
+	}
+	lab, prod := localize("lab"), localize("prod")
+	configure := tq.Args{"service=shell", "cmd=configure", "cmd-arg=terminal"}
+	assert.True(t, evaluate(lab, configure))
+	assert.False(t, evaluate(prod, configure))
+	assert.True(t, evaluate(prod, tq.Args{"service=shell", "cmd=show"}))
+
+	shell := tq.NewAuthorRequest(tq.SetAuthorRequestArgs(tq.Args{"service=shell"}))
+	resp, _, _ := NewSessionBasedAuthorizer(context.Background(), NewDefaultLogger(), *shell, lab).evaluate()
+	assert.Equal(t, []string{"priv-lvl=15"}, resp)
+	resp, _, _ = NewSessionBasedAuthorizer(context.Background(), NewDefaultLogger(), *shell, prod).evaluate()
+	assert.Equal(t, []string{"priv-lvl=1"}, resp)
+
+	// localizing does not modify the shared groups
+	assert.Len(t, u.Groups[0].Commands, 2)
+	assert.Len(t, noc.Services, 1)
+}
+
+func TestCommandExcept(t *testing.T) {
+	u := config.User{
+		Name: "cisco",
+		Commands: []config.Command{
+			{Name: "show", Match: []string{".*"}, Except: []string{"running-config.*", "tech-support"}, Action: config.PERMIT},
+			{Name: "*", Except: []string{"reload.*", "configure.*"}, Action: config.PERMIT, Platforms: []string{"lab"}},
+			{Name: "configure", Match: []string{"terminal"}, Action: config.DENY},
+		},
+	}
+	evaluate := func(u config.User, platform string, args ...string) bool {
+		ctx := context.WithValue(context.Background(), tq.ContextPlatform, platform)
+		body := tq.Args{"service=shell"}
+		body.Append(args...)
+		r := tq.NewAuthorRequest(tq.SetAuthorRequestArgs(body))
+		return NewCommandBasedAuthorizer(ctx, NewDefaultLogger(), *r, u).evaluate().permit
+	}
+	assert.True(t, evaluate(u, "", "cmd=show", "cmd-arg=version"))
+	assert.False(t, evaluate(u, "", "cmd=show", "cmd-arg=running-config", "cmd-arg=interface"))
+	assert.False(t, evaluate(u, "", "cmd=show", "cmd-arg=tech-support"))
+	assert.True(t, evaluate(u, "", "cmd=show", "cmd-arg=tech-support", "cmd-arg=brief"))
+
+	// exceptions on * match the whole command line
+	assert.True(t, evaluate(u, "lab", "cmd=ping", "cmd-arg=192.0.2.1"))
+	assert.False(t, evaluate(u, "lab", "cmd=reload"))
+
+	// excepted commands fall through to the next command, then the default action
+	assert.False(t, evaluate(u, "lab", "cmd=configure", "cmd-arg=exclusive"))
+	u.DefaultAction = config.PERMIT
+	assert.True(t, evaluate(u, "lab", "cmd=configure", "cmd-arg=exclusive"))
+	assert.False(t, evaluate(u, "lab", "cmd=configure", "cmd-arg=terminal"))
+	assert.True(t, evaluate(u, "", "cmd=show", "cmd-arg=running-config"))
+
+	// the first group default action applies to users without one
+	a := New(NewDefaultLogger())
+	g := config.User{Name: "cisco", Groups: []config.Group{{Name: "noc"}, {Name: "lab", DefaultAction: config.PERMIT}}}
+	a.ReduceAll(&g)
+	assert.Equal(t, config.PERMIT, g.DefaultAction)
+	_, err := a.New(config.User{Name: "cisco", DefaultAction: 3})
+	assert.Error(t, err)
+}
+
+// auditSink records audit lines
+type auditSink struct {
+	lines []string
+}
+
+func (s *auditSink) Printf(format string, args ...interface{}) {
+	s.lines = append(s.lines, fmt.Sprintf(format, args...))
+}
+
+func TestAudit(t *testing.T) {
+	sink := &auditSink{}
+	a := New(NewDefaultLogger(), SetAuditLog(sink), SetCommandCache(time.Minute, 8))
+	ops := config.Group{
+		Name:          "ops",
+		DefaultAction: config.PERMIT,
+		Commands:      []config.Command{{Name: "configure", Action: config.DENY}},
+		Services:      []config.Service{{Name: "shell", SetValues: []config.Value{{Name: "priv-lvl", Values: []string{"15"}}}}},
+		FileTransfers: []config.FileTransfer{{Paths: []string{"/tmp/.*"}, Action: config.PERMIT}},
+	}
+	h, err := a.New(config.User{
+		Name:     "alice",
+		Scopes:   []string{"lab"},
+		Groups:   []config.Group{ops},
+		Commands: []config.Command{{Name: "show", Match: []string{"version"}, Action: config.PERMIT}},
+	})
+	assert.NoError(t, err)
+	audit := func(args ...string) Verdict {
+		body := tq.NewAuthorRequest(tq.SetAuthorRequestUser("alice"), tq.SetAuthorRequestRemAddr("192.0.2.1"), tq.SetAuthorRequestArgs(tq.Args{}))
+		body.Args.Append(args...)
+		b, err := body.MarshalBinary()
+		assert.NoError(t, err)
+		ctx := context.WithValue(context.Background(), tq.ContextConnRemoteAddr, "2001:db8::1")
+		h.Handle(&configtest.Response{}, tq.Request{Header: *tq.NewHeader(tq.SetHeaderType(tq.Authorize)), Body: b, Context: ctx})
+		var v Verdict
+		assert.NoError(t, json.Unmarshal([]byte(sink.lines[len(sink.lines)-1]), &v))
+		return v
+	}
+
+	v := audit("service=shell", "cmd=show", "cmd-arg=version")
+	assert.True(t, v.Permit)
+	assert.Equal(t, "matched command", v.Reason)
+	assert.Equal(t, []Rule{{Type: "command", Name: "show", Position: 0, Source: "user [alice]", Pattern: "version", Action: "permit"}}, v.Rules)
+	assert.Equal(t, "lab", v.Scope)
+	assert.Equal(t, "192.0.2.1", v.RemAddr)
+	assert.Equal(t, "2001:db8::1", v.Device)
+	assert.Equal(t, []string{"service=shell", "cmd=show", "cmd-arg=version"}, v.Args)
+	assert.False(t, v.Cached)
+	v = audit("service=shell", "cmd=show", "cmd-arg=version")
+	assert.True(t, v.Cached)
+	assert.Len(t, v.Rules, 1)
+
+	v = audit("service=shell", "cmd=configure")
+	assert.False(t, v.Permit)
+	assert.Equal(t, []Rule{{Type: "command", Name: "configure", Position: 1, Source: "group [ops]", Action: "deny"}}, v.Rules)
+
+	v = audit("service=shell", "cmd=reload")
+	assert.True(t, v.Permit)
+	assert.Equal(t, "no command matched, default action [permit]", v.Reason)
+	assert.Empty(t, v.Rules)
+
+	v = audit("service=file-transfer", "protocol=scp", "direction=up", "path=/tmp/a", "path=/etc/passwd")
+	assert.False(t, v.Permit)
+	assert.Equal(t, "no file transfer matched path [/etc/passwd]", v.Reason)
+	v = audit("service=file-transfer", "protocol=scp", "direction=up", "path=/tmp/a")
+	assert.True(t, v.Permit)
+	assert.Equal(t, []Rule{{Type: "file_transfer", Position: 0, Source: "group [ops]", Pattern: "/tmp/.*", Action: "permit"}}, v.Rules)
+
+	v = audit("service=shell")
+	assert.True(t, v.Permit)
+	assert.Equal(t, "matched services", v.Reason)
+	assert.Equal(t, []Rule{{Type: "service", Name: "shell", Position: 0, Source: "group [ops]"}}, v.Rules)
+	assert.Len(t, sink.lines, 7)
+}
@@ -190,6 +190,26 @@ func TestCommands(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "cisco; service=shell, cmd=show with an expired account",
+			user: config.User{
+				Name:     "cisco",
+				Validity: &config.Validity{Expires: "2020-01-01"},
+				Commands: []config.Command{
+					{
+						Name:   "show",
+						Action: config.PERMIT,
+					},
+				},
+			},
+			request: newAuthorRequest("cisco", tq.Args{"service=shell", "cmd=show"}),
+			validate: func(name string, response *mockedResponse) {
+				if response.got.Status != tq.AuthorStatusFail {
+					assert.Fail(t, fmt.Sprintf("[%v] should have had a status of [%v] but got [%v]", name, tq.AuthorStatusFail, response.got.Status))
+				}
+				assert.Equal(t, tq.AuthorServerMsg("account expired"), response.got.ServerMsg, name)
+			},
+		},
 	}
 	for _, test := range tests {
 		logger.Infof(ctx, "running test [%v]", test.name)
@@ -536,3 +556,48 @@ func TestSessionsAndServices(t *testing.T) {
 		test.validate(test.name, resp)
 	}
 }
+
+func TestFileTransfers(t *testing.T) {
+	logger := newDefaultLogger(30)
+	s := stringy.New(logger)
+	ctx := context.Background()
+	user := config.User{
+		Name: "netops",
+		Groups: []config.Group{
+			{
+				Name: "images",
+				FileTransfers: []config.FileTransfer{
+					{Paths: []string{"/harddisk:/images/.*"}, Direction: config.UPLOAD, Action: config.PERMIT},
+				},
+			},
+		},
+	}
+	tests := []stringyTest{
+		{
+			name:    "group permits image upload",
+			user:    user,
+			request: newAuthorRequest("netops", tq.Args{"service=file-transfer", "protocol=scp", "direction=up", "path=/harddisk:/images/xr.iso"}),
+			validate: func(name string, response *mockedResponse) {
+				assert.Equal(t, tq.AuthorStatusPassAdd, response.got.Status, name)
+			},
+		},
+		{
+			name:    "config upload is denied",
+			user:    user,
+			request: newAuthorRequest("netops", tq.Args{"service=file-transfer", "protocol=scp", "direction=up", "path=/harddisk:/startup.cfg"}),
+			validate: func(name string, response *mockedResponse) {
+				assert.Equal(t, tq.AuthorStatusFail, response.got.Status, name)
+			},
+		},
+	}
+	for _, test := range tests {
+		logger.Infof(ctx, "running test [%v]", test.name)
+		resp := &mockedResponse{}
+		h, err := s.New(test.user)
+		if err != nil {
+			assert.FailNow(t, "error from stringy factory; %v", err)
+		}
+		h.Handle(resp, test.request)
+		test.validate(test.name, resp)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package stringy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// locations caches loaded time zones, time.LoadLocation reads the zone database on every call
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// window is a parsed config.Window
+type window struct {
+	loc *time.Location
+	// days is indexed by time.Weekday, nil is every day
+	days []bool
+	// start and end are minutes since midnight
+	start, end int
+}
+
+// parseClock parses a 15:04 time of day into minutes since midnight
+func parseClock(v string, empty int) (int, error) {
+	if v == "" {
+		return empty, nil
+	}
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, fmt.Errorf("bad time of day [%v], expected 15:04", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseWindow(w config.Window) (window, error) {
+	var p window
+	var err error
+	if p.loc, err = loadLocation(w.Timezone); err != nil {
+		return p, fmt.Errorf("bad timezone [%v]; %v", w.Timezone, err)
+	}
+	if p.start, err = parseClock(w.Start, 0); err != nil {
+		return p, err
+	}
+	if p.end, err = parseClock(w.End, 24*60); err != nil {
+		return p, err
+	}
+	if p.start == p.end {
+		return p, fmt.Errorf("window start [%v] and end [%v] are the same", w.Start, w.End)
+	}
+	if len(w.Days) > 0 {
+		p.days = make([]bool, 7)
+	}
+	for _, d := range w.Days {
+		day, ok := weekdays[strings.ToLower(strings.TrimSpace(d))]
+		if !ok {
+			return p, fmt.Errorf("bad day [%v], expected one of sun, mon, tue, wed, thu, fri or sat", d)
+		}
+		p.days[day] = true
+	}
+	return p, nil
+}
+
+// open reports whether the window is open on day
+func (w window) open(day time.Weekday) bool {
+	return w.days == nil || w.days[day]
+}
+
+// contains reports whether t falls within the window.  A window spanning midnight belongs to the
+// day it starts on.
+func (w window) contains(t time.Time) bool {
+	t = t.In(w.loc)
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.open(t.Weekday()) && minute >= w.start && minute < w.end
+	}
+	if minute >= w.start {
+		return w.open(t.Weekday())
+	}
+	return minute < w.end && w.open(t.AddDate(0, 0, -1).Weekday())
+}
+
+// inWindows reports whether t falls within any of windows.  No windows contain all times.
+func inWindows(windows []config.Window, t time.Time) (bool, error) {
+	if len(windows) == 0 {
+		return true, nil
+	}
+	for _, w := range windows {
+		p, err := parseWindow(w)
+		if err != nil {
+			return false, err
+		}
+		if p.contains(t) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseExpires parses an RFC3339 time, or a date that expires at the end of the day, UTC
+func parseExpires(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return t, fmt.Errorf("bad expiry [%v], expected an RFC3339 time or a 2006-01-02 date", v)
+	}
+	return t.AddDate(0, 0, 1), nil
+}
+
+// validityReason returns why v does not authorize requests at t, or an empty string if it does
+func validityReason(v *config.Validity, t time.Time) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	if v.Expires != "" {
+		expires, err := parseExpires(v.Expires)
+		if err != nil {
+			return "", err
+		}
+		if !t.Before(expires) {
+			return "account expired", nil
+		}
+	}
+	ok, err := inWindows(v.Windows, t)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "outside of permitted access window", nil
+	}
+	return "", nil
+}
+
+// validateWindows parses every window and expiry of u, so bad config is found when the user is
+// loaded rather than when a request is denied
+func validateWindows(u config.User) error {
+	parse := func(windows []config.Window) error {
+		for _, w := range windows {
+			if _, err := parseWindow(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if u.Validity != nil {
+		if u.Validity.Expires != "" {
+			if _, err := parseExpires(u.Validity.Expires); err != nil {
+				return fmt.Errorf("bad validity; %v", err)
+			}
+		}
+		if err := parse(u.Validity.Windows); err != nil {
+			return fmt.Errorf("bad validity; %v", err)
+		}
+	}
+	for _, c := range u.Commands {
+		if err := parse(c.Windows); err != nil {
+			return fmt.Errorf("bad window in command [%v]; %v", c.Name, err)
+		}
+	}
+	return nil
+}
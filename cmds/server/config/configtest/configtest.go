@@ -0,0 +1,97 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package configtest holds the fixtures shared by the tests of the authenticators, authorizers and
+// accounters.
+package configtest
+
+import (
+	"context"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Response is a tq.Response that keeps the last reply of each type and the handler set for the
+// client's next packet
+type Response struct {
+	Authen *tq.AuthenReply
+	Author *tq.AuthorReply
+	Acct   *tq.AcctReply
+	// NextHandler is nil unless Next was called
+	NextHandler tq.Handler
+}
+
+// Reply implements tq.Response
+func (r *Response) Reply(v tq.EncoderDecoder) (int, error) {
+	switch reply := v.(type) {
+	case *tq.AuthenReply:
+		r.Authen = reply
+	case *tq.AuthorReply:
+		r.Author = reply
+	case *tq.AcctReply:
+		r.Acct = reply
+	}
+	return 0, nil
+}
+
+// ReplyWithContext implements tq.Response
+func (r *Response) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writer ...tq.Writer) (int, error) {
+	return r.Reply(v)
+}
+
+// Write implements tq.Response
+func (r *Response) Write(p *tq.Packet) (int, error) { return 0, nil }
+
+// Next implements tq.Response
+func (r *Response) Next(next tq.Handler) { r.NextHandler = next }
+
+// RegisterWriter implements tq.Response
+func (r *Response) RegisterWriter(mw tq.Writer) {}
+
+// Context implements tq.Response
+func (r *Response) Context(ctx context.Context) {}
+
+// AuthenStart returns the first packet of a pap login by alice with password
+func AuthenStart(password string) tq.Request {
+	return AuthenStartUser(tq.AuthenTypePAP, "alice", password)
+}
+
+// AuthenStartUser returns the first packet of a login of type t by user, with data
+func AuthenStartUser(t tq.AuthenType, user, data string) tq.Request {
+	b, _ := tq.NewAuthenStart(
+		tq.SetAuthenStartAction(tq.AuthenActionLogin),
+		tq.SetAuthenStartPrivLvl(tq.PrivLvlUser),
+		tq.SetAuthenStartType(t),
+		tq.SetAuthenStartService(tq.AuthenServiceLogin),
+		tq.SetAuthenStartUser(tq.AuthenUser(user)),
+		tq.SetAuthenStartPort("tty0"),
+		tq.SetAuthenStartRemAddr("192.0.2.1"),
+		tq.SetAuthenStartData(tq.AuthenData(data)),
+	).MarshalBinary()
+	return tq.Request{Header: *tq.NewHeader(tq.SetHeaderType(tq.Authenticate), tq.SetHeaderSeqNo(1)), Body: b, Context: context.Background()}
+}
+
+// AuthenContinue returns a continue packet answering a prompt with msg
+func AuthenContinue(msg string, flags ...tq.AuthenContinueFlag) tq.Request {
+	opts := []tq.AuthenContinueOption{tq.SetAuthenContinueUserMessage(tq.AuthenUserMessage(msg))}
+	for _, f := range flags {
+		opts = append(opts, tq.SetAuthenContinueFlag(f))
+	}
+	b, _ := tq.NewAuthenContinue(opts...).MarshalBinary()
+	return tq.Request{Header: *tq.NewHeader(tq.SetHeaderType(tq.Authenticate), tq.SetHeaderSeqNo(5)), Body: b, Context: context.Background()}
+}
+
+// Login handles request with h, which must reply to it
+func Login(t *testing.T, h tq.Handler, request tq.Request) *Response {
+	var response Response
+	h.Handle(&response, request)
+	require.NotNil(t, response.Authen)
+	return &response
+}
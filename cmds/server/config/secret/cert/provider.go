@@ -0,0 +1,150 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package cert matches clients connected over mutual tls to a SecretConfig by the identities in
+// their verified client certificate, rather than by their address.
+package cert
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+}
+
+// Field is a certificate field that identities are matched against
+type Field string
+
+const (
+	// DNSName matches the dns subject alternative names, case insensitively
+	DNSName Field = "dns_names"
+	// URI matches the uri subject alternative names, eg spiffe://example.com/router
+	URI Field = "uris"
+	// OrganizationalUnit matches the organizational units of the subject
+	OrganizationalUnit Field = "organizational_units"
+)
+
+// fields are the SecretConfig option keys, in the order they are matched
+var fields = []Field{DNSName, URI, OrganizationalUnit}
+
+// New creates a certificate based secret provider
+func New(l loggerProvider) *Provider {
+	return &Provider{loggerProvider: l}
+}
+
+// Provider ...
+type Provider struct {
+	loggerProvider
+	patterns map[Field][]string
+	secretConfig
+}
+
+// New returns a scoped Provider.  Every option in fields is a json list of patterns, which match
+// exactly or as globs, eg *.routers.example.com.  A client matches if any identity in its
+// certificate matches any pattern.
+func (p *Provider) New(ctx context.Context, provider config.SecretConfig, handler tq.Handler, secret func(context.Context, string) ([]byte, error)) tq.SecretProvider {
+	scoped := &Provider{
+		loggerProvider: p.loggerProvider,
+		patterns:       make(map[Field][]string),
+		secretConfig:   secretConfig{secret: secret, Handler: handler},
+	}
+	for _, f := range fields {
+		raw, ok := provider.Options[string(f)]
+		if !ok {
+			continue
+		}
+		var patterns []string
+		if err := json.Unmarshal([]byte(raw), &patterns); err != nil {
+			certBadConfig.Inc()
+			p.Errorf(ctx, "unable to unmarshal key [%v] on cert based secret provider [%v]; %v", f, provider.Name, err)
+			return nil
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				certBadConfig.Inc()
+				p.Errorf(ctx, "bad pattern [%v] in key [%v] on cert based secret provider [%v]; %v", pattern, f, provider.Name, err)
+				return nil
+			}
+			if f == DNSName {
+				pattern = strings.ToLower(pattern)
+			}
+			scoped.patterns[f] = append(scoped.patterns[f], pattern)
+		}
+	}
+	if len(scoped.patterns) == 0 {
+		certBadConfig.Inc()
+		p.Errorf(ctx, "no patterns provided for cert based secret provider [%v], set one of %v", provider.Name, fields)
+		return nil
+	}
+	return scoped
+}
+
+// Get returns a tq SecretProvider interface and or error.  Only clients with a verified certificate
+// are matched.
+func (p *Provider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler, error) {
+	state, ok := tq.TLSConnectionState(ctx)
+	if !ok || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		certNoCertificate.Inc()
+		return nil, nil, fmt.Errorf("remote [%v] has no verified client certificate", remote)
+	}
+	leaf := state.VerifiedChains[0][0]
+	for _, f := range fields {
+		for _, identity := range identities(leaf, f) {
+			for _, pattern := range p.patterns[f] {
+				if ok, _ := path.Match(pattern, identity); ok {
+					certGetMatch.Inc()
+					p.Debugf(ctx, "cert secret provider matches remote [%v] on [%v] [%v] with pattern [%v]", remote, f, identity, pattern)
+					secret, err := p.secret(ctx, identity)
+					return secret, p.secretConfig, err
+				}
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("no matching cert secret provider found for the certificate of remote [%v]", remote)
+}
+
+// identities returns the values of field in cert
+func identities(cert *x509.Certificate, f Field) []string {
+	switch f {
+	case DNSName:
+		names := make([]string, 0, len(cert.DNSNames))
+		for _, n := range cert.DNSNames {
+			names = append(names, strings.TrimSuffix(strings.ToLower(n), "."))
+		}
+		return names
+	case URI:
+		uris := make([]string, 0, len(cert.URIs))
+		for _, u := range cert.URIs {
+			uris = append(uris, u.String())
+		}
+		return uris
+	case OrganizationalUnit:
+		return cert.Subject.OrganizationalUnit
+	}
+	return nil
+}
+
+// secretConfig holds the secret config needed for the SecretProvider
+type secretConfig struct {
+	// Secret is applied when performing crypt/obfuscation ops
+	secret func(context.Context, string) ([]byte, error)
+	// Handler embeds our Handler interface scoped to this SecretConfig
+	tq.Handler
+}
@@ -0,0 +1,91 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package cert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (mockLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+// withCert returns a context holding a tls state verified with leaf
+func withCert(leaf *x509.Certificate) context.Context {
+	state := &tls.ConnectionState{}
+	if leaf != nil {
+		state.VerifiedChains = [][]*x509.Certificate{{leaf}}
+	}
+	return context.WithValue(context.Background(), tq.ContextConnInfo, tq.ConnectionInfo{TLS: state})
+}
+
+func TestCertProvider(t *testing.T) {
+	handler := tq.HandlerFunc(func(tq.Response, tq.Request) {})
+	secret := func(ctx context.Context, key string) ([]byte, error) { return []byte(key), nil }
+	remote := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 49}
+	spiffe, err := url.Parse("spiffe://example.com/router/rtr1")
+	require.NoError(t, err)
+
+	p := New(mockLogger{})
+	sp := p.New(context.Background(), config.SecretConfig{Name: "routers", Options: map[string]string{
+		"dns_names":            `["*.routers.example.com"]`,
+		"uris":                 `["spiffe://example.com/router/*"]`,
+		"organizational_units": `["network"]`,
+	}}, handler, secret)
+	require.NotNil(t, sp)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{name: "dns san, case insensitive", ctx: withCert(&x509.Certificate{DNSNames: []string{"RTR1.routers.example.com."}}), expected: "rtr1.routers.example.com"},
+		{name: "uri san", ctx: withCert(&x509.Certificate{URIs: []*url.URL{spiffe}}), expected: "spiffe://example.com/router/rtr1"},
+		{name: "ou", ctx: withCert(&x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{"corp", "network"}}}), expected: "network"},
+		{name: "dns names are matched first", ctx: withCert(&x509.Certificate{DNSNames: []string{"a.routers.example.com"}, URIs: []*url.URL{spiffe}}), expected: "a.routers.example.com"},
+		{name: "no match", ctx: withCert(&x509.Certificate{DNSNames: []string{"routers.example.com"}, Subject: pkix.Name{OrganizationalUnit: []string{"corp"}}})},
+		{name: "unverified", ctx: withCert(nil)},
+		{name: "not tls", ctx: context.Background()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, h, err := sp.Get(test.ctx, remote)
+			if test.expected == "" {
+				assert.Error(t, err)
+				assert.Nil(t, h)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(s))
+			assert.NotNil(t, h)
+		})
+	}
+
+	// scopes without patterns, or with bad ones, are not built
+	for _, options := range []map[string]string{
+		nil,
+		{"uris": `not json`},
+		{"dns_names": `["[bad"]`},
+	} {
+		assert.Nil(t, p.New(context.Background(), config.SecretConfig{Name: "bad", Options: options}, handler, secret), options)
+	}
+}
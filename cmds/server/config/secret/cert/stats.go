@@ -0,0 +1,37 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package cert
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// counters
+	certGetMatch = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_cert_get_match",
+		Help:      "number of cert secret provider matches",
+	})
+	certNoCertificate = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_cert_no_certificate",
+		Help:      "number of lookups by clients without a verified tls client certificate",
+	})
+	certBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_cert_bad_config",
+		Help:      "number of cert secret provider scopes rejected for bad options",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(certGetMatch)
+	prometheus.MustRegister(certNoCertificate)
+	prometheus.MustRegister(certBadConfig)
+}
@@ -0,0 +1,121 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cacheEntry is the outcome of resolving an address
+type cacheEntry struct {
+	names   []string
+	err     error
+	expires time.Time
+}
+
+// cachingResolver resolves client addresses to normalized hostnames, caching both successful and
+// failed lookups.  It is shared by every scoped provider so each address is resolved once,
+// regardless of how many dns SecretConfigs are evaluated.
+type cachingResolver struct {
+	Resolver
+	timeout        time.Duration
+	ttl            time.Duration
+	negativeTTL    time.Duration
+	size           int
+	forwardConfirm bool
+	now            func() time.Time
+
+	sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// lookup returns the hostnames of ip
+func (r *cachingResolver) lookup(ctx context.Context, ip net.IP) ([]string, error) {
+	key := ip.String()
+	r.Lock()
+	e, ok := r.cache[key]
+	r.Unlock()
+	if ok && r.now().Before(e.expires) {
+		if e.err != nil {
+			dnsNegativeCacheHit.Inc()
+		} else {
+			dnsCacheHit.Inc()
+		}
+		return e.names, e.err
+	}
+	dnsCacheMiss.Inc()
+
+	names, err := r.resolve(ctx, ip)
+	ttl := r.ttl
+	if err != nil {
+		ttl = r.negativeTTL
+	}
+	if ttl > 0 && r.size > 0 {
+		r.Lock()
+		if len(r.cache) >= r.size {
+			dnsCacheFlush.Inc()
+			r.cache = make(map[string]cacheEntry)
+		}
+		r.cache[key] = cacheEntry{names: names, err: err, expires: r.now().Add(ttl)}
+		r.Unlock()
+	}
+	return names, err
+}
+
+// resolve queries the resolver for the PTR names of ip, keeping those that forward confirm if
+// required
+func (r *cachingResolver) resolve(ctx context.Context, ip net.IP) ([]string, error) {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
+		ms := v * 1000 // make milliseconds
+		dnsDurations.Observe(ms)
+	}))
+	defer timer.ObserveDuration()
+	ptrs, err := r.LookupAddr(ctx, ip.String())
+	if err != nil {
+		dnsError.Inc()
+		return nil, err
+	}
+	var names []string
+	for _, ptr := range ptrs {
+		name := normalize(ptr)
+		if r.forwardConfirm && !r.confirm(ctx, name, ip) {
+			dnsForwardConfirmFail.Inc()
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no forward confirmed names for [%v] in %v", ip, ptrs)
+	}
+	return names, nil
+}
+
+// confirm reports whether name resolves to ip
+func (r *cachingResolver) confirm(ctx context.Context, name string, ip net.IP) bool {
+	addrs, err := r.LookupHost(ctx, name)
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ip.Equal(net.ParseIP(a)) {
+			return true
+		}
+	}
+	return false
+}
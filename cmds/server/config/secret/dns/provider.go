@@ -5,6 +5,7 @@
  LICENSE file in the root directory of this source tree.
 */
 
+// Package dns matches clients to a SecretConfig by the hostnames their address resolves to.
 package dns
 
 import (
@@ -12,11 +13,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"path"
+	"sort"
+	"strings"
+	"time"
 
 	tq "github.com/facebookincubator/tacquito"
 	"github.com/facebookincubator/tacquito/cmds/server/config"
-
-	"github.com/prometheus/client_golang/prometheus"
 )
 
 // loggerProvider provides the logging implementation
@@ -26,15 +29,35 @@ type loggerProvider interface {
 	Debugf(ctx context.Context, format string, args ...interface{})
 }
 
+// Resolver performs the lookups needed to match a client, net.Resolver satisfies it
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
 // ProviderOption is the setter type for Provider
 type ProviderOption func(p *Provider)
 
-// SetDNSSecret will set a secret config for a given hostname
+// SetDNSSecret will set a secret config for the given hosts.  A host is matched exactly, as a
+// suffix if it starts with a dot, eg .example.com, or as a glob if it contains any of *?[, eg
+// rtr-*.example.com.  Exact hosts are preferred, then globs in the order given, then the longest
+// matching suffix.
 func SetDNSSecret(config secretConfig, hosts ...string) ProviderOption {
 	return func(p *Provider) {
 		for _, h := range hosts {
-			p.secrets[h] = config
+			h = normalize(h)
+			switch {
+			case h == "" || h == ".":
+				continue
+			case strings.ContainsAny(h, "*?["):
+				p.globs = append(p.globs, hostRule{pattern: h, secretConfig: config})
+			case strings.HasPrefix(h, "."):
+				p.suffixes = append(p.suffixes, hostRule{pattern: h, secretConfig: config})
+			default:
+				p.secrets[h] = config
+			}
 		}
+		sort.SliceStable(p.suffixes, func(i, j int) bool { return len(p.suffixes[i].pattern) > len(p.suffixes[j].pattern) })
 	}
 }
 
@@ -45,19 +68,90 @@ func SetLoggerProvider(l loggerProvider) ProviderOption {
 	}
 }
 
-// New creates new config sources based on users, groups and services
+// SetResolver sets the resolver used for PTR and forward lookups, defaulting to net.DefaultResolver
+func SetResolver(r Resolver) ProviderOption {
+	return func(p *Provider) {
+		p.resolver.Resolver = r
+	}
+}
+
+// SetTimeout bounds how long a client's lookups may take, defaulting to 2 seconds.  Zero only
+// applies the deadline of the connection's context.
+func SetTimeout(d time.Duration) ProviderOption {
+	return func(p *Provider) {
+		p.resolver.timeout = d
+	}
+}
+
+// SetCacheTTL sets how long resolved hostnames are cached, defaulting to 5 minutes.  Zero disables
+// caching of successful lookups.
+func SetCacheTTL(d time.Duration) ProviderOption {
+	return func(p *Provider) {
+		p.resolver.ttl = d
+	}
+}
+
+// SetNegativeCacheTTL sets how long failed lookups are cached, defaulting to 30 seconds, so an
+// address without a PTR record does not query the resolver on every connection.  Zero disables
+// negative caching.
+func SetNegativeCacheTTL(d time.Duration) ProviderOption {
+	return func(p *Provider) {
+		p.resolver.negativeTTL = d
+	}
+}
+
+// SetCacheSize bounds the number of cached addresses, defaulting to 4096.  The cache is flushed
+// when full.
+func SetCacheSize(n int) ProviderOption {
+	return func(p *Provider) {
+		p.resolver.size = n
+	}
+}
+
+// SetForwardConfirm requires every PTR name to resolve back to the client's address before it is
+// matched, since the owner of an address controls its PTR records.  Names that do not confirm are
+// ignored.
+func SetForwardConfirm(v bool) ProviderOption {
+	return func(p *Provider) {
+		p.resolver.forwardConfirm = v
+	}
+}
+
+// New creates a dns based secret provider.  Its options apply to every scoped provider it creates,
+// which share its resolver cache.
 func New(l loggerProvider, opts ...ProviderOption) *Provider {
-	s := &Provider{loggerProvider: l, secrets: make(map[string]secretConfig)}
+	p := &Provider{
+		loggerProvider: l,
+		secrets:        make(map[string]secretConfig),
+		resolver: &cachingResolver{
+			Resolver:    net.DefaultResolver,
+			timeout:     2 * time.Second,
+			ttl:         5 * time.Minute,
+			negativeTTL: 30 * time.Second,
+			size:        4096,
+			now:         time.Now,
+			cache:       make(map[string]cacheEntry),
+		},
+	}
 	for _, opt := range opts {
-		opt(s)
+		opt(p)
 	}
-	return s
+	return p
 }
 
 // Provider ...
 type Provider struct {
 	loggerProvider
-	secrets map[string]secretConfig
+	resolver *cachingResolver
+	secrets  map[string]secretConfig
+	globs    []hostRule
+	suffixes []hostRule
+}
+
+// hostRule is a glob or suffix host and its secret config
+type hostRule struct {
+	pattern string
+	secretConfig
 }
 
 // New returns a scoped Provider for a given set of users.
@@ -72,16 +166,21 @@ func (p *Provider) New(ctx context.Context, provider config.SecretConfig, handle
 		p.Errorf(ctx, "no host provided for dns based secret provider [%v]", provider.Name)
 		return nil
 	}
+	for _, h := range hosts {
+		if _, err := path.Match(normalize(h), ""); err != nil {
+			p.Errorf(ctx, "bad host [%v] on dns based secret provider [%v]; %v", h, provider.Name, err)
+			return nil
+		}
+	}
 
 	scopedConfig := secretConfig{
 		secret:  secret,
 		Handler: handler,
 	}
 
-	return New(
-		p.loggerProvider,
-		SetDNSSecret(scopedConfig, hosts...),
-	)
+	scoped := &Provider{loggerProvider: p.loggerProvider, resolver: p.resolver, secrets: make(map[string]secretConfig)}
+	SetDNSSecret(scopedConfig, hosts...)(scoped)
+	return scoped
 }
 
 // Get returns a tq SecretProvider interface and or error
@@ -90,21 +189,14 @@ func (p *Provider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler
 	if !ok {
 		return nil, nil, fmt.Errorf("unable to assert [%v] is net.TCPAddr", remote)
 	}
-	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
-		ms := v * 1000 // make milliseconds
-		dnsDurations.Observe(ms)
-	}))
-	names, err := net.LookupAddr(addr.IP.String())
+	names, err := p.resolver.lookup(ctx, addr.IP)
 	if err != nil {
-		timer.ObserveDuration()
-		dnsError.Inc()
 		return nil, nil, err
 	}
-	timer.ObserveDuration()
 	for _, name := range names {
-		if c, ok := p.secrets[name]; ok {
+		if c, pattern, ok := p.match(name); ok {
 			dnsGetMatch.Inc()
-			p.Debugf(ctx, "dns secret provider matches remote [%v] against fqdn [%v]", addr.IP.String(), name)
+			p.Debugf(ctx, "dns secret provider matches remote [%v] against fqdn [%v] with host [%v]", addr.IP.String(), name, pattern)
 			secret, err := c.secret(ctx, name)
 			return secret, c, err
 		}
@@ -112,6 +204,29 @@ func (p *Provider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler
 	return nil, nil, fmt.Errorf("no matching dns secret provider found for names %v, for remote [%v]", names, addr.IP.String())
 }
 
+// match finds the secret config for a normalized hostname
+func (p *Provider) match(name string) (secretConfig, string, bool) {
+	if c, ok := p.secrets[name]; ok {
+		return c, name, true
+	}
+	for _, r := range p.globs {
+		if ok, _ := path.Match(r.pattern, name); ok {
+			return r.secretConfig, r.pattern, true
+		}
+	}
+	for _, r := range p.suffixes {
+		if strings.HasSuffix(name, r.pattern) {
+			return r.secretConfig, r.pattern, true
+		}
+	}
+	return secretConfig{}, "", false
+}
+
+// normalize lower cases a hostname and removes the trailing dot of a fully qualified name
+func normalize(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
 // secretConfig holds the secret config needed for the SecretProvider
 type secretConfig struct {
 	// Secret is applied when performing crypt/obfuscation ops
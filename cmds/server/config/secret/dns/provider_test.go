@@ -0,0 +1,202 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (nopLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (nopLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+// fakeResolver answers from static PTR and forward records, counting PTR queries
+type fakeResolver struct {
+	sync.Mutex
+	ptr     map[string][]string
+	host    map[string][]string
+	queries int
+}
+
+func (f *fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.queries++
+	names, ok := f.ptr[addr]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return names, nil
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, ok := f.host[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+// namedHandler identifies which secret config matched
+type namedHandler string
+
+func (namedHandler) Handle(response tq.Response, request tq.Request) {}
+
+func scope(t *testing.T, p *Provider, name string, hosts string) tq.SecretProvider {
+	sp := p.New(context.Background(), config.SecretConfig{Name: name, Options: map[string]string{"hosts": hosts}}, namedHandler(name), func(ctx context.Context, host string) ([]byte, error) {
+		return []byte(name + ":" + host), nil
+	})
+	if sp == nil {
+		t.Fatalf("unable to create scoped provider [%v]", name)
+	}
+	return sp
+}
+
+func addr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 49}
+}
+
+func TestMatch(t *testing.T) {
+	r := &fakeResolver{ptr: map[string][]string{
+		"192.0.2.1": {"Core1.Example.com."},
+		"192.0.2.2": {"rtr-42.pop1.example.com."},
+		"192.0.2.3": {"sw1.lab.example.com."},
+		"192.0.2.4": {"sw1.example.org."},
+		"192.0.2.5": {"unknown.example.net.", "host.example.org."},
+	}}
+	p := New(nopLogger{}, SetResolver(r))
+	sp := scope(t, p, "mixed", `["core1.example.com", "rtr-*.example.com", ".example.com", ".lab.example.com", "host.example.org"]`)
+
+	tests := []struct {
+		ip     string
+		secret string
+		err    bool
+	}{
+		// case and the trailing dot are ignored
+		{ip: "192.0.2.1", secret: "mixed:core1.example.com"},
+		{ip: "192.0.2.2", secret: "mixed:rtr-42.pop1.example.com"},
+		{ip: "192.0.2.3", secret: "mixed:sw1.lab.example.com"},
+		{ip: "192.0.2.4", err: true},
+		// any of the ptr names may match
+		{ip: "192.0.2.5", secret: "mixed:host.example.org"},
+		{ip: "192.0.2.9", err: true},
+	}
+	for _, test := range tests {
+		secret, handler, err := sp.Get(context.Background(), addr(test.ip))
+		if test.err {
+			assert.Error(t, err, test.ip)
+			continue
+		}
+		if assert.NoError(t, err, test.ip) {
+			assert.Equal(t, test.secret, string(secret), test.ip)
+			assert.Equal(t, namedHandler("mixed"), handler.(secretConfig).Handler, test.ip)
+		}
+	}
+
+	// exact hosts win over globs, and longer suffixes over shorter ones
+	scoped := sp.(*Provider)
+	_, pattern, _ := scoped.match("core1.example.com")
+	assert.Equal(t, "core1.example.com", pattern)
+	_, pattern, _ = scoped.match("sw1.lab.example.com")
+	assert.Equal(t, ".lab.example.com", pattern)
+
+	// bad options do not create a provider
+	assert.Nil(t, p.New(context.Background(), config.SecretConfig{Options: map[string]string{"hosts": `[]`}}, nil, nil))
+	assert.Nil(t, p.New(context.Background(), config.SecretConfig{Options: map[string]string{"hosts": `["[a"]`}}, nil, nil))
+	_, _, err := sp.Get(context.Background(), &net.UnixAddr{Name: "sock"})
+	assert.Error(t, err)
+}
+
+func TestCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := &fakeResolver{ptr: map[string][]string{"192.0.2.1": {"core1.example.com."}}}
+	p := New(nopLogger{}, SetResolver(r), SetCacheTTL(time.Minute), SetNegativeCacheTTL(10*time.Second), SetCacheSize(2))
+	p.resolver.now = func() time.Time { return now }
+	a := scope(t, p, "a", `["core2.example.com"]`)
+	b := scope(t, p, "b", `["core1.example.com"]`)
+
+	get := func(sp tq.SecretProvider, ip string) error {
+		_, _, err := sp.Get(context.Background(), addr(ip))
+		return err
+	}
+
+	// scoped providers share the cache, so the address is resolved once
+	assert.Error(t, get(a, "192.0.2.1"))
+	assert.NoError(t, get(b, "192.0.2.1"))
+	assert.Equal(t, 1, r.queries)
+
+	// failures are cached for the negative ttl
+	assert.Error(t, get(b, "192.0.2.9"))
+	assert.Error(t, get(b, "192.0.2.9"))
+	assert.Equal(t, 2, r.queries)
+	now = now.Add(11 * time.Second)
+	assert.Error(t, get(b, "192.0.2.9"))
+	assert.Equal(t, 3, r.queries)
+
+	// successes for the ttl
+	now = now.Add(time.Minute)
+	assert.NoError(t, get(b, "192.0.2.1"))
+	assert.Equal(t, 4, r.queries)
+
+	// a full cache is flushed
+	assert.Error(t, get(b, "192.0.2.8"))
+	assert.Len(t, p.resolver.cache, 1)
+
+	// no ttl, no caching
+	r.queries = 0
+	uncached := New(nopLogger{}, SetResolver(r), SetCacheTTL(0), SetNegativeCacheTTL(0))
+	sp := scope(t, uncached, "b", `["core1.example.com"]`)
+	assert.NoError(t, get(sp, "192.0.2.1"))
+	assert.NoError(t, get(sp, "192.0.2.1"))
+	assert.Equal(t, 2, r.queries)
+}
+
+func TestForwardConfirm(t *testing.T) {
+	r := &fakeResolver{
+		ptr: map[string][]string{
+			"192.0.2.1":   {"core1.example.com."},
+			"192.0.2.2":   {"spoofed.example.com.", "core2.example.com."},
+			"2001:db8::1": {"core3.example.com."},
+		},
+		host: map[string][]string{
+			"core1.example.com":   {"192.0.2.1"},
+			"spoofed.example.com": {"198.51.100.1"},
+			"core2.example.com":   {"198.51.100.2", "192.0.2.2"},
+			"core3.example.com":   {"2001:0db8:0000::1"},
+		},
+	}
+	p := New(nopLogger{}, SetResolver(r), SetForwardConfirm(true))
+	sp := scope(t, p, "core", `[".example.com"]`)
+	for ip, want := range map[string]string{
+		"192.0.2.1":   "core:core1.example.com",
+		"192.0.2.2":   "core:core2.example.com",
+		"2001:db8::1": "core:core3.example.com",
+	} {
+		secret, _, err := sp.Get(context.Background(), addr(ip))
+		if assert.NoError(t, err, ip) {
+			assert.Equal(t, want, string(secret), ip)
+		}
+	}
+
+	// no name resolves back to the client
+	r.ptr["192.0.2.3"] = []string{"spoofed.example.com."}
+	_, _, err := sp.Get(context.Background(), addr("192.0.2.3"))
+	assert.EqualError(t, err, fmt.Sprintf("no forward confirmed names for [192.0.2.3] in %v", r.ptr["192.0.2.3"]))
+}
@@ -23,6 +23,31 @@ var (
 		Name:      "secret_provider_dns_get_error",
 		Help:      "the number of errors encountered when resolving dns",
 	})
+	dnsCacheHit = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_dns_cache_hit",
+		Help:      "number of addresses resolved from the cache",
+	})
+	dnsNegativeCacheHit = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_dns_negative_cache_hit",
+		Help:      "number of failed lookups returned from the cache",
+	})
+	dnsCacheMiss = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_dns_cache_miss",
+		Help:      "number of addresses not found in the cache and sent to the resolver",
+	})
+	dnsCacheFlush = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_dns_cache_flush",
+		Help:      "number of times the cache was flushed for being full",
+	})
+	dnsForwardConfirmFail = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_dns_forward_confirm_fail",
+		Help:      "number of ptr names ignored for not resolving back to the client address",
+	})
 	// durations
 	dnsDurations = prometheus.NewSummary(
 		prometheus.SummaryOpts{
@@ -38,6 +63,11 @@ func init() {
 	// gauges and counters
 	prometheus.MustRegister(dnsGetMatch)
 	prometheus.MustRegister(dnsError)
+	prometheus.MustRegister(dnsCacheHit)
+	prometheus.MustRegister(dnsNegativeCacheHit)
+	prometheus.MustRegister(dnsCacheMiss)
+	prometheus.MustRegister(dnsCacheFlush)
+	prometheus.MustRegister(dnsForwardConfirmFail)
 	// durations
 	prometheus.MustRegister(dnsDurations)
 }
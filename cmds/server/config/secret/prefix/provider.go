@@ -12,6 +12,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"sort"
+	"strings"
 
 	tq "github.com/facebookincubator/tacquito"
 	"github.com/facebookincubator/tacquito/cmds/server/config"
@@ -31,14 +33,24 @@ type ProviderOption func(p *Provider)
 // SetPrefixSecret will set a secret config for a given prefix source
 // this could be a range that clients call in from or from specific hosts
 func SetPrefixSecret(config secretConfig, prefixes ...string) ProviderOption {
+	return SetPrefixGroup(config, "", prefixes...)
+}
+
+// SetPrefixGroup will set a secret config for the prefixes of a tagged device group.  The
+// keychain is asked for the tag's secret, rather than the client address's, so each device
+// group may have its own secret.  Invalid prefixes are ignored, see newPrefixes to validate them.
+func SetPrefixGroup(config secretConfig, tag string, prefixes ...string) ProviderOption {
 	return func(p *Provider) {
 		for _, prefix := range prefixes {
 			_, ipnet, err := net.ParseCIDR(prefix)
 			if err != nil {
 				continue
 			}
-			p.secrets[ipnet.String()] = config
+			ones, _ := ipnet.Mask.Size()
+			p.prefixes = append(p.prefixes, prefixEntry{ipnet: ipnet, ones: ones, tag: tag, secretConfig: config})
 		}
+		// longest prefix first, so the first match is the most specific
+		sort.SliceStable(p.prefixes, func(i, j int) bool { return p.prefixes[i].ones > p.prefixes[j].ones })
 	}
 }
 
@@ -53,7 +65,6 @@ func SetLoggerProvider(l loggerProvider) ProviderOption {
 func New(l loggerProvider, opts ...ProviderOption) *Provider {
 	s := &Provider{
 		loggerProvider: l,
-		secrets:        make(map[string]secretConfig),
 	}
 	for _, opt := range opts {
 		opt(s)
@@ -64,48 +75,121 @@ func New(l loggerProvider, opts ...ProviderOption) *Provider {
 // Provider ...
 type Provider struct {
 	loggerProvider
-	secrets map[string]secretConfig
+	prefixes []prefixEntry
+}
+
+// prefixEntry is a prefix and the device group it belongs to, if any
+type prefixEntry struct {
+	ipnet *net.IPNet
+	ones  int
+	tag   string
+	secretConfig
 }
 
-// New returns a scoped Provider for a given set of users.
+// New returns a scoped Provider for a given set of users.  Options may set prefixes, a json list
+// of untagged prefixes, and groups, a json object of device group tags to lists of prefixes.  A
+// scope with invalid or conflicting prefixes is rejected.
 func (p *Provider) New(ctx context.Context, provider config.SecretConfig, handler tq.Handler, secret func(context.Context, string) ([]byte, error)) tq.SecretProvider {
 	var prefixes []string
-	raw := provider.Options["prefixes"]
-	if err := json.Unmarshal([]byte(raw), &prefixes); err != nil {
-		p.Errorf(ctx, "missing prefixes key in options for prefix based secret provider [%v]", provider.Name)
-		return nil
+	if raw, ok := provider.Options["prefixes"]; ok {
+		if err := json.Unmarshal([]byte(raw), &prefixes); err != nil {
+			p.Errorf(ctx, "unable to unmarshal key [prefixes] on prefix based secret provider [%v]; %v", provider.Name, err)
+			return nil
+		}
+	}
+	var groups map[string][]string
+	if raw, ok := provider.Options["groups"]; ok {
+		if err := json.Unmarshal([]byte(raw), &groups); err != nil {
+			p.Errorf(ctx, "unable to unmarshal key [groups] on prefix based secret provider [%v]; %v", provider.Name, err)
+			return nil
+		}
 	}
-	if len(prefixes) == 0 {
+	if len(prefixes) == 0 && len(groups) == 0 {
 		p.Errorf(ctx, "no prefixes provided for prefix based secret provider [%v]", provider.Name)
 		return nil
 	}
+	if err := validatePrefixes(prefixes, groups); err != nil {
+		prefixBadConfig.Inc()
+		p.Errorf(ctx, "invalid prefixes on prefix based secret provider [%v]; %v", provider.Name, err)
+		return nil
+	}
 	scopedConfig := secretConfig{
 		secret:  secret,
 		Handler: handler,
 	}
-	return New(
-		p.loggerProvider,
-		SetPrefixSecret(scopedConfig, prefixes...),
-	)
+	opts := []ProviderOption{SetPrefixSecret(scopedConfig, prefixes...)}
+	for _, tag := range sortedTags(groups) {
+		opts = append(opts, SetPrefixGroup(scopedConfig, tag, groups[tag]...))
+	}
+	return New(p.loggerProvider, opts...)
+}
+
+// validatePrefixes reports invalid prefixes and prefixes that are claimed by more than one device
+// group, which would otherwise match whichever group happened to be evaluated first
+func validatePrefixes(prefixes []string, groups map[string][]string) error {
+	owners := make(map[string]string)
+	var problems []string
+	check := func(tag string, prefix string) {
+		_, ipnet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("bad prefix [%v]; %v", prefix, err))
+			return
+		}
+		key := ipnet.String()
+		if owner, ok := owners[key]; ok && owner != tag {
+			prefixConflict.Inc()
+			problems = append(problems, fmt.Sprintf("prefix [%v] is in groups [%v] and [%v]", key, owner, tag))
+			return
+		}
+		owners[key] = tag
+	}
+	for _, prefix := range prefixes {
+		check("", prefix)
+	}
+	for _, tag := range sortedTags(groups) {
+		if tag == "" {
+			problems = append(problems, "group tags must not be empty")
+			continue
+		}
+		for _, prefix := range groups[tag] {
+			check(tag, prefix)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%v", strings.Join(problems, "; "))
 }
 
-// Get returns a tq SecretProvider interface and or error
+// sortedTags returns the tags of groups sorted, so equal length prefixes are evaluated, and
+// conflicts reported, in the same order on every load
+func sortedTags(groups map[string][]string) []string {
+	tags := make([]string, 0, len(groups))
+	for tag := range groups {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Get returns a tq SecretProvider interface and or error.  The longest matching prefix wins.
 func (p *Provider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler, error) {
 	addr, ok := remote.(*net.TCPAddr)
 	if !ok {
 		return nil, nil, fmt.Errorf("unable to assert [%v] is net.TCPAddr", remote)
 	}
-	for cidr, c := range p.secrets {
-		_, ipNet, err := net.ParseCIDR(cidr)
-		if err != nil {
-			p.Errorf(ctx, "error parsing ip from SecretProvider: %v", err)
+	for _, e := range p.prefixes {
+		if !e.ipnet.Contains(addr.IP) {
 			continue
 		}
-		if ipNet.Contains(addr.IP) {
-			p.Debugf(ctx, "prefix secret provider matches remote [%v] against prefix [%v]", addr.IP.String(), cidr)
-			secret, err := c.secret(ctx, addr.IP.String())
-			return secret, c, err
+		prefixGetMatch.Inc()
+		key := addr.IP.String()
+		if e.tag != "" {
+			key = e.tag
 		}
+		p.Debugf(ctx, "prefix secret provider matches remote [%v] against prefix [%v] group [%v]", addr.IP.String(), e.ipnet, e.tag)
+		secret, err := e.secret(ctx, key)
+		return secret, e.secretConfig, err
 	}
 	return nil, nil, fmt.Errorf("no matching prefix secret provider found")
 }
@@ -0,0 +1,102 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package prefix
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Infof(ctx context.Context, format string, args ...interface{})      {}
+func (nopLogger) Errorf(ctx context.Context, format string, args ...interface{})     {}
+func (nopLogger) Debugf(ctx context.Context, format string, args ...interface{})     {}
+func (nopLogger) Record(ctx context.Context, r map[string]string, obscure ...string) {}
+
+// keyed returns the key the keychain was asked for as the secret
+func keyed(ctx context.Context, key string) ([]byte, error) {
+	return []byte(key), nil
+}
+
+func scope(options map[string]string) tq.SecretProvider {
+	return New(nopLogger{}).New(context.Background(), config.SecretConfig{Name: "test", Options: options}, nil, keyed)
+}
+
+func addr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 49}
+}
+
+func TestLongestPrefixMatch(t *testing.T) {
+	sp := scope(map[string]string{
+		"prefixes": `["10.0.0.0/8", "2001:db8::/32"]`,
+		"groups":   `{"core": ["10.1.0.0/16", "10.2.0.0/16"], "oob": ["10.1.2.0/24", "2001:db8:1::/48"], "lab": ["10.1.2.128/25"]}`,
+	})
+	if !assert.NotNil(t, sp) {
+		return
+	}
+	tests := []struct {
+		ip  string
+		key string
+	}{
+		// untagged prefixes are keyed by address, groups by tag
+		{ip: "10.9.9.9", key: "10.9.9.9"},
+		{ip: "10.1.9.9", key: "core"},
+		{ip: "10.2.0.1", key: "core"},
+		{ip: "10.1.2.1", key: "oob"},
+		{ip: "10.1.2.200", key: "lab"},
+		{ip: "2001:db8:1::1", key: "oob"},
+		{ip: "2001:db8:2::1", key: "2001:db8:2::1"},
+	}
+	for _, test := range tests {
+		secret, _, err := sp.Get(context.Background(), addr(test.ip))
+		if assert.NoError(t, err, test.ip) {
+			assert.Equal(t, test.key, string(secret), test.ip)
+		}
+	}
+	_, _, err := sp.Get(context.Background(), addr("192.0.2.1"))
+	assert.Error(t, err)
+}
+
+func TestPrefixConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]string
+		valid   bool
+	}{
+		{name: "prefixes only", options: map[string]string{"prefixes": `["::0/0"]`}, valid: true},
+		{name: "groups only", options: map[string]string{"groups": `{"core": ["10.0.0.0/8"]}`}, valid: true},
+		{name: "repeated within a group", options: map[string]string{"groups": `{"core": ["10.0.0.0/8", "10.1.1.1/8"]}`}, valid: true},
+		{name: "nothing", options: map[string]string{}},
+		{name: "empty", options: map[string]string{"prefixes": `[]`}},
+		{name: "bad json", options: map[string]string{"groups": `["10.0.0.0/8"]`}},
+		{name: "bad prefix", options: map[string]string{"prefixes": `["10.0.0.0/33"]`}},
+		{name: "empty tag", options: map[string]string{"groups": `{"": ["10.0.0.0/8"]}`}},
+		{name: "conflicting groups", options: map[string]string{"groups": `{"core": ["10.0.0.0/8"], "oob": ["10.0.0.0/8"]}`}},
+		// the same network written differently still conflicts
+		{name: "conflicting untagged", options: map[string]string{"prefixes": `["10.0.0.1/8"]`, "groups": `{"core": ["10.0.0.0/8"]}`}},
+	}
+	for _, test := range tests {
+		sp := scope(test.options)
+		if test.valid {
+			assert.NotNil(t, sp, test.name)
+		} else {
+			assert.Nil(t, sp, test.name)
+		}
+	}
+	assert.EqualError(t,
+		validatePrefixes([]string{"bad"}, map[string][]string{"a": {"10.0.0.0/8"}, "b": {"10.0.0.0/8"}}),
+		"bad prefix [bad]; invalid CIDR address: bad; prefix [10.0.0.0/8] is in groups [a] and [b]",
+	)
+}
@@ -0,0 +1,38 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package prefix
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// gauges and counters
+	prefixGetMatch = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_prefix_get_match",
+		Help:      "number of prefix secret provider matches",
+	})
+	prefixBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_prefix_bad_config",
+		Help:      "number of prefix secret providers rejected for invalid or conflicting prefixes",
+	})
+	prefixConflict = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "secret_provider_prefix_conflict",
+		Help:      "number of prefixes claimed by more than one device group",
+	})
+)
+
+func init() {
+	// gauges and counters
+	prometheus.MustRegister(prefixGetMatch)
+	prometheus.MustRegister(prefixBadConfig)
+	prometheus.MustRegister(prefixConflict)
+}
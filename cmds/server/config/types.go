@@ -21,6 +21,9 @@ type AuthenticatorType int
 // AccounterType ...
 type AccounterType int
 
+// AuthorizerType selects the authorizer of a user in place of the default authorizer provider
+type AuthorizerType int
+
 var (
 	// DENY is for Cmd actions
 	DENY Action = 1
@@ -33,12 +36,52 @@ var (
 	// SHA512 is for Authenticators
 	SHA512 AuthenticatorType = 2
 
+	// RADIUS is for Authenticators that proxy to an upstream radius server
+	RADIUS AuthenticatorType = 3
+
+	// ARGON2ID is for Authenticators that verify argon2id PHC string hashes
+	ARGON2ID AuthenticatorType = 4
+
+	// SCRYPT is for Authenticators that verify scrypt PHC string hashes
+	SCRYPT AuthenticatorType = 5
+
+	// PHC is for Authenticators that verify argon2id, scrypt or bcrypt hashes, whichever the hash is
+	PHC AuthenticatorType = 6
+
+	// TOTP is for Authenticators that require a totp code on top of another authenticator's password
+	TOTP AuthenticatorType = 7
+
+	// PUSH is for Authenticators that require a push to be approved on top of another authenticator's password
+	PUSH AuthenticatorType = 8
+
+	// KRB5 is for Authenticators that validate passwords against a kerberos kdc
+	KRB5 AuthenticatorType = 9
+
+	// CACHE is for Authenticators that remember the results of another authenticator for a short time
+	CACHE AuthenticatorType = 10
+
+	// KEYCHAIN is for Authenticators that compare passwords, or chap responses, with a plaintext
+	// password held in the keychain
+	KEYCHAIN AuthenticatorType = 11
+
 	// STDERR is for Logger
 	STDERR AccounterType = 1
 	// SYSLOG is for Logger
 	SYSLOG AccounterType = 2
 	// FILE is for writng logs to local files
 	FILE AccounterType = 3
+	// WEBHOOK is for POSTing logs to an http endpoint
+	WEBHOOK AccounterType = 4
+	// KAFKA is for publishing logs to a kafka topic, only available in builds with the kafka tag
+	KAFKA AccounterType = 5
+	// MULTI is for writing logs to several accounters, listed in the accounter's Accounters
+	MULTI AccounterType = 6
+
+	// POLICY is for Authorizers that ask an external policy service, over http or grpc
+	POLICY AuthorizerType = 1
+	// REGO is for Authorizers that evaluate a rego policy with an embedded open policy agent, only
+	// available in builds with the opa tag
+	REGO AuthorizerType = 2
 )
 
 // User is a fully composed version of all settings a user needs to go through aaa.  All items on the
@@ -50,8 +93,59 @@ type User struct {
 	Groups        []Group        `yaml:"groups,omitempty" json:"groups,omitempty"`
 	Services      []Service      `yaml:"services,omitempty" json:"services,omitempty"`
 	Commands      []Command      `yaml:"commands,omitempty" json:"commands,omitempty"`
+	FileTransfers []FileTransfer `yaml:"file_transfers,omitempty" json:"file_transfers,omitempty"`
 	Authenticator *Authenticator `yaml:"authenticator,omitempty" json:"authenticator,omitempty"`
-	Accounter     *Accounter     `yaml:"accounter,omitempty" json:"accounter,omitempty"`
+	// Enable authenticates enable (AuthenServiceEnable) requests, typically with a distinct enable
+	// secret.  When unset, enable requests are checked by Authenticator.
+	Enable    *Authenticator `yaml:"enable,omitempty" json:"enable,omitempty"`
+	Accounter *Accounter     `yaml:"accounter,omitempty" json:"accounter,omitempty"`
+	// Authorizer replaces the default authorizer, which evaluates Services, Commands and
+	// FileTransfers, with a registered authorizer type
+	Authorizer *Authorizer `yaml:"authorizer,omitempty" json:"authorizer,omitempty"`
+	// Validity limits when the user is authorized, eg for temporary access
+	Validity *Validity `yaml:"validity,omitempty" json:"validity,omitempty"`
+	// DefaultAction is the action of commands that match none of Commands.  Unset denies them.
+	DefaultAction Action `yaml:"default_action,omitempty" json:"default_action,omitempty"`
+	// Template names the entry of ServerConfig.Templates the user inherits unset fields from
+	Template string `yaml:"template,omitempty" json:"template,omitempty"`
+}
+
+// Inherit sets every field of u that is unset, or empty, to the value of t.  Name and Template
+// are never inherited.  Lists are copied, so users that inherit from the same t never share them.
+func (u *User) Inherit(t User) {
+	if len(u.Scopes) == 0 {
+		u.Scopes = append([]string(nil), t.Scopes...)
+	}
+	if len(u.Groups) == 0 {
+		u.Groups = append([]Group(nil), t.Groups...)
+	}
+	if len(u.Services) == 0 {
+		u.Services = append([]Service(nil), t.Services...)
+	}
+	if len(u.Commands) == 0 {
+		u.Commands = append([]Command(nil), t.Commands...)
+	}
+	if len(u.FileTransfers) == 0 {
+		u.FileTransfers = append([]FileTransfer(nil), t.FileTransfers...)
+	}
+	if u.Authenticator == nil {
+		u.Authenticator = t.Authenticator
+	}
+	if u.Enable == nil {
+		u.Enable = t.Enable
+	}
+	if u.Accounter == nil {
+		u.Accounter = t.Accounter
+	}
+	if u.Authorizer == nil {
+		u.Authorizer = t.Authorizer
+	}
+	if u.Validity == nil {
+		u.Validity = t.Validity
+	}
+	if u.DefaultAction == 0 {
+		u.DefaultAction = t.DefaultAction
+	}
 }
 
 // HasScope returns bool if scope is found to be bound to this user
@@ -65,9 +159,64 @@ func (u User) HasScope(scope string) bool {
 }
 
 // LocalizeToScope will set the Scopes field to the supplied scope name
-// no validation is done and the string is accepted as is.
+// no validation is done and the string is accepted as is.  Commands and services, of the user and
+// its groups, that are selected to other scopes are dropped.
 func (u *User) LocalizeToScope(scope string) {
 	u.Scopes = []string{scope}
+	u.Commands = commandsInScope(u.Commands, scope)
+	u.Services = servicesInScope(u.Services, scope)
+	// groups are shared by users, so localize copies of them
+	groups := make([]Group, 0, len(u.Groups))
+	for _, g := range u.Groups {
+		g.Commands = commandsInScope(g.Commands, scope)
+		g.Services = servicesInScope(g.Services, scope)
+		groups = append(groups, g)
+	}
+	if u.Groups != nil {
+		u.Groups = groups
+	}
+}
+
+// inScope reports whether a selector of scopes selects scope.  An empty selector selects every
+// scope.
+func inScope(scopes []string, scope string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// commandsInScope returns a copy of the commands that apply in scope
+func commandsInScope(commands []Command, scope string) []Command {
+	if commands == nil {
+		return nil
+	}
+	scoped := make([]Command, 0, len(commands))
+	for _, c := range commands {
+		if inScope(c.Scopes, scope) {
+			scoped = append(scoped, c)
+		}
+	}
+	return scoped
+}
+
+// servicesInScope returns a copy of the services that apply in scope
+func servicesInScope(services []Service, scope string) []Service {
+	if services == nil {
+		return nil
+	}
+	scoped := make([]Service, 0, len(services))
+	for _, s := range services {
+		if inScope(s.Scopes, scope) {
+			scoped = append(scoped, s)
+		}
+	}
+	return scoped
 }
 
 // GetLocalizedScope will return the singular scope that this user has been localized to
@@ -82,16 +231,24 @@ func (u User) GetLocalizedScope() string {
 }
 
 // Group represents a set of services, commands, authenticators and a logger.
-// groups do not inherit other groups.  All other options will be unique items,
+// groups may include other groups, see Groups.  All other options will be unique items,
 // not duplicated within a given group.  These items are merged into a user level
 // configuration, with user level items taking precedence over any group setting.
 type Group struct {
 	Name          string         `yaml:"name" json:"name"`
 	Services      []Service      `yaml:"services,omitempty" json:"services,omitempty"`
 	Commands      []Command      `yaml:"commands,omitempty" json:"commands,omitempty"`
+	FileTransfers []FileTransfer `yaml:"file_transfers,omitempty" json:"file_transfers,omitempty"`
 	Authenticator *Authenticator `yaml:"authenticator,omitempty" json:"authenticator,omitempty"`
+	Enable        *Authenticator `yaml:"enable,omitempty" json:"enable,omitempty"`
 	Accounter     *Accounter     `yaml:"accounter,omitempty" json:"accounter,omitempty"`
+	Authorizer    *Authorizer    `yaml:"authorizer,omitempty" json:"authorizer,omitempty"`
+	Validity      *Validity      `yaml:"validity,omitempty" json:"validity,omitempty"`
+	DefaultAction Action         `yaml:"default_action,omitempty" json:"default_action,omitempty"`
 	Comment       string         `yaml:"comment,omitempty" json:"comment,omitempty"`
+	// Groups are included by this group, eg oncall may include neteng-senior, which includes
+	// neteng.  The loader flattens them onto users, each after the group that includes it.
+	Groups []Group `yaml:"groups,omitempty" json:"groups,omitempty"`
 }
 
 // Service represents a concept that looks for tacplus attributes, matches them and sets/replaces
@@ -141,6 +298,9 @@ type Service struct {
 	SetValues []Value `yaml:"set_values,omitempty" json:"set_values,omitempty"`
 	Optional  bool    `yaml:"is_optional" json:"is_optional"`
 	Comment   string  `yaml:"comment,omitempty" json:"comment,omitempty"`
+	// Scopes limits the service to users localized to one of these scopes.  Empty applies the
+	// service in every scope.
+	Scopes []string `yaml:"scopes,omitempty" json:"scopes,omitempty"`
 }
 
 // TrimSpace removes all leading and trailing white space removed, as defined by Unicode.
@@ -193,11 +353,49 @@ func (v *Value) String() string {
 //		permit grep.*
 //		permit tail.*
 //	}
+//
+// Commands are evaluated in order, the user's and then each group's, and the first command that
+// matches decides.  Except carves exceptions out of a match without lookaheads, eg
+//
+//	Command{
+//		Name:   "show",
+//		Match:  []string{".*"},
+//		Except: []string{"running-config.*"},
+//		Action: PERMIT,
+//	}
+//
+// permits every show command except show running-config, which falls through to the commands
+// after it and finally the user's DefaultAction.
 type Command struct {
-	Name    string   `yaml:"name" json:"name"`
-	Match   []string `yaml:"match,omitempty" json:"match,omitempty"`
+	Name  string   `yaml:"name" json:"name"`
+	Match []string `yaml:"match,omitempty" json:"match,omitempty"`
+	// Except are regexes of args the command does not match, even when Match does.  On the *
+	// command, they are matched against the whole command line, eg "show running-config".
+	Except  []string `yaml:"except,omitempty" json:"except,omitempty"`
 	Action  Action   `yaml:"action" json:"action"`
 	Comment string   `yaml:"comment,omitempty" json:"comment,omitempty"`
+	// Platforms limits the command to devices with one of these platform fingerprints.  Empty
+	// applies the command to every device.
+	Platforms []string `yaml:"platforms,omitempty" json:"platforms,omitempty"`
+	// Windows limits the command to these windows, eg change windows.  Empty applies the command
+	// at all times.
+	Windows []Window `yaml:"windows,omitempty" json:"windows,omitempty"`
+	// Scopes limits the command to users localized to one of these scopes, eg read only commands
+	// in a prod scope and all commands in a lab scope.  Empty applies the command in every scope.
+	Scopes []string `yaml:"scopes,omitempty" json:"scopes,omitempty"`
+}
+
+// AppliesTo reports whether the command applies to a device with the given platform fingerprint
+func (c Command) AppliesTo(platform string) bool {
+	if len(c.Platforms) == 0 {
+		return true
+	}
+	for _, p := range c.Platforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
 }
 
 // TrimSpace removes all leading and trailing white space removed, as defined by Unicode.
@@ -206,6 +404,82 @@ func (c *Command) TrimSpace() {
 	for i, m := range c.Match {
 		c.Match[i] = strings.TrimSpace(m)
 	}
+	for i, m := range c.Except {
+		c.Except[i] = strings.TrimSpace(m)
+	}
+}
+
+// Direction is the direction of a file transfer, relative to the device
+type Direction string
+
+const (
+	// UPLOAD copies a file onto the device, eg a new software image
+	UPLOAD Direction = "up"
+	// DOWNLOAD copies a file off of the device, eg a config backup
+	DOWNLOAD Direction = "down"
+)
+
+// FileTransfer represents a rule authorizing scp/sftp style file operations, requested by clients
+// with service=file-transfer.  Example:
+//
+//	FileTransfer{
+//		Paths:     []string{"/harddisk:/images/.*\\.iso"},
+//		Direction: UPLOAD,
+//		Action:    PERMIT,
+//	}
+//
+// permits copying iso images into the images directory, but nothing else.
+type FileTransfer struct {
+	// Paths are regexes, anchored to the start and end of the path
+	Paths []string `yaml:"paths" json:"paths"`
+	// Direction empty matches transfers in either direction
+	Direction Direction `yaml:"direction,omitempty" json:"direction,omitempty"`
+	// Protocols eg scp or sftp, empty matches every protocol
+	Protocols []string `yaml:"protocols,omitempty" json:"protocols,omitempty"`
+	Action    Action   `yaml:"action" json:"action"`
+	Comment   string   `yaml:"comment,omitempty" json:"comment,omitempty"`
+}
+
+// TrimSpace removes all leading and trailing white space removed, as defined by Unicode.
+func (f *FileTransfer) TrimSpace() {
+	f.Direction = Direction(strings.TrimSpace(string(f.Direction)))
+	for i, p := range f.Paths {
+		f.Paths[i] = strings.TrimSpace(p)
+	}
+	for i, p := range f.Protocols {
+		f.Protocols[i] = strings.TrimSpace(p)
+	}
+}
+
+// Window is a recurring period of time.  Example:
+//
+//	Window{
+//		Days:     []string{"mon", "tue", "wed", "thu", "fri"},
+//		Start:    "09:00",
+//		End:      "17:00",
+//		Timezone: "America/New_York",
+//	}
+//
+// is open on weekdays during office hours in New York.
+type Window struct {
+	// Days are three letter day names, eg mon.  Empty is every day.
+	Days []string `yaml:"days,omitempty" json:"days,omitempty"`
+	// Start and End are 15:04 times of day.  Empty Start is the start of the day and empty End is
+	// the end of the day.  An End before Start spans midnight, eg 22:00 to 02:00.
+	Start string `yaml:"start,omitempty" json:"start,omitempty"`
+	End   string `yaml:"end,omitempty" json:"end,omitempty"`
+	// Timezone is an IANA time zone name, eg Europe/London.  Defaults to UTC.
+	Timezone string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+}
+
+// Validity limits when a user is authorized.  Requests after Expires, or outside of all Windows,
+// are denied.
+type Validity struct {
+	// Expires is an RFC3339 time, or a 2006-01-02 date that expires at the end of that day, UTC.
+	// Empty never expires.
+	Expires string `yaml:"expires,omitempty" json:"expires,omitempty"`
+	// Windows empty authorizes at all times
+	Windows []Window `yaml:"windows,omitempty" json:"windows,omitempty"`
 }
 
 // Authenticator represents the authenticator backend that is responsible for password validation.
@@ -219,6 +493,14 @@ type Accounter struct {
 	Name    string            `yaml:"name" json:"name"`
 	Type    AccounterType     `yaml:"type" json:"type"`
 	Options map[string]string `yaml:"options" json:"options"`
+	// Accounters are the accounters a MULTI accounter writes to
+	Accounters []Accounter `yaml:"accounters,omitempty" json:"accounters,omitempty"`
+}
+
+// Authorizer is a registered authorizer type and its options
+type Authorizer struct {
+	Type    AuthorizerType    `yaml:"type" json:"type"`
+	Options map[string]string `yaml:"options,omitempty" json:"options,omitempty"`
 }
 
 // ProviderType is associated to a ConfigProvider and indicates what sort of
@@ -230,17 +512,32 @@ type ProviderType int
 // package has one type, START, but you may provide others at your discretion.
 type HandlerType int
 
+// FallbackType is the behavior of a SecretBudget when the keychain is slow or unavailable
+type FallbackType int
+
 var (
 	// PREFIX matches net.Conn.RemAddr addresses to a SecretConfig
 	PREFIX ProviderType = 1
 	// DNS matches a hostname that is resolved from net.Conn.RemAddr
 	DNS ProviderType = 2
+	// CERT matches the identities in a client's verified tls certificate
+	CERT ProviderType = 3
 
 	// START is a handler to use for incoming connections
 	START HandlerType = 1
 	// SPAN is to be used when you wish to replicate packets of a connection
 	// to another host(a development server for example) for inspection/debugging
 	SPAN HandlerType = 2
+	// PROXY forwards the packets of a scope to upstream tacacs servers instead of serving them
+	// locally, relaying their replies back to the client
+	PROXY HandlerType = 3
+
+	// CLOSED fails the lookup, the connection is dropped.  This is the default
+	CLOSED FallbackType = 1
+	// CACHED uses the last secret successfully retrieved for the same key
+	CACHED FallbackType = 2
+	// STATIC uses SecretBudget.FallbackKey
+	STATIC FallbackType = 3
 )
 
 // SecretConfig applies to a group of client devices or even to a single one
@@ -251,6 +548,45 @@ type SecretConfig struct {
 	Handler Handler           `yaml:"handler" json:"handler"`
 	Type    ProviderType      `yaml:"type" json:"type"`
 	Options map[string]string `yaml:"options,omitempty" json:"options,omitempty"`
+	Budget  *SecretBudget     `yaml:"budget,omitempty" json:"budget,omitempty"`
+	// SecondarySecret is tried when a client's packets do not decrypt with Secret, so the
+	// previous secret keeps working while devices are moved to a new one
+	SecondarySecret *Keychain `yaml:"secondary_secret,omitempty" json:"secondary_secret,omitempty"`
+	// Accounter is used by the users of the scope that set no accounter, either themselves or
+	// through their groups
+	Accounter *Accounter `yaml:"accounter,omitempty" json:"accounter,omitempty"`
+	// MaxBodyLength is the longest packet body accepted from the clients of the scope, at most
+	// 65536.  Zero uses the server's limit
+	MaxBodyLength uint32 `yaml:"max_body_length,omitempty" json:"max_body_length,omitempty"`
+	// RemAddrCheck compares the rem_addr and port asserted by the clients of the scope with their
+	// connection and the values expected of them
+	RemAddrCheck *RemAddrCheck `yaml:"rem_addr_check,omitempty" json:"rem_addr_check,omitempty"`
+}
+
+// RemAddrCheck validates the rem_addr and port fields of the first packet of every session, which
+// clients fill in as they please.  Empty fields are not checked.  Mismatches are logged, and with
+// Reject, the session is failed.
+type RemAddrCheck struct {
+	// Source requires rem_addr to be the address the client connects from, eg for clients that are
+	// the user's own terminal
+	Source bool `yaml:"source,omitempty" json:"source,omitempty"`
+	// Prefixes requires rem_addr to be an ip address within one of them
+	Prefixes []string `yaml:"prefixes,omitempty" json:"prefixes,omitempty"`
+	// Ports requires port to match one of these regexes, anchored at both ends, eg tty[0-9]+
+	Ports []string `yaml:"ports,omitempty" json:"ports,omitempty"`
+	// Reject fails the sessions that do not pass, rather than only logging them
+	Reject bool `yaml:"reject,omitempty" json:"reject,omitempty"`
+}
+
+// SecretBudget bounds how long the keychain may take to return a scope's secret, and what
+// to do when it is slow or returns an error.
+type SecretBudget struct {
+	// Timeout is a go duration, eg 250ms.  An empty timeout applies only the fallback on errors
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Fallback defaults to CLOSED
+	Fallback FallbackType `yaml:"fallback,omitempty" json:"fallback,omitempty"`
+	// FallbackKey is required by the STATIC fallback
+	FallbackKey string `yaml:"fallback_key,omitempty" json:"fallback_key,omitempty"`
 }
 
 // Handler instructs the server what handler to use for the given SecretConfig
@@ -272,4 +608,32 @@ type ServerConfig struct {
 	Users       []User         `yaml:"users,omitempty" json:"users,omitempty"`
 	PrefixDeny  []string       `yaml:"prefix_deny,omitempty" json:"prefix_deny,omitempty"`
 	PrefixAllow []string       `yaml:"prefix_allow,omitempty" json:"prefix_allow,omitempty"`
+	// Templates are users that other users reference by name with User.Template, and inherit every
+	// field they leave unset from, so near identical users need only set their name
+	Templates []User `yaml:"templates,omitempty" json:"templates,omitempty"`
+	// Defaults are inherited by every user, for the fields neither the user nor its template set
+	Defaults *User `yaml:"defaults,omitempty" json:"defaults,omitempty"`
+	// PrivLvlCaps bound the privilege level authorized to clients connecting from their prefixes,
+	// whatever the users' config grants
+	PrivLvlCaps []PrivLvlCap `yaml:"priv_lvl_caps,omitempty" json:"priv_lvl_caps,omitempty"`
+}
+
+// PrivLvlCap bounds the privilege level of the authorization requests and replies, and of the
+// enable requests, of clients connecting from Prefixes to MaxPrivLvl, eg so priv 15 is never
+// granted to guest networks.
+// Where several caps match a client, the lowest applies.
+type PrivLvlCap struct {
+	Prefixes   []string `yaml:"prefixes" json:"prefixes"`
+	MaxPrivLvl uint8    `yaml:"max_priv_lvl" json:"max_priv_lvl"`
+}
+
+// Proxies reports whether any scope of the config uses the PROXY handler, whose scopes are
+// served upstream and need no users
+func (c ServerConfig) Proxies() bool {
+	for _, s := range c.Secrets {
+		if s.Handler.Type == PROXY {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,128 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package configpush serves the tacquito.configpush.v1.ConfigPush grpc service, which replaces
+// the running config without distributing files.  The service is a plain http.Handler that speaks
+// the grpc unary protocol over http/2, so it is mounted on the admin api and shares its
+// authentication, authorization and auditing.  See configpush.proto for the messages.
+package configpush
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/grpcwire"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Path is the http path of the Push method
+const Path = "/tacquito.configpush.v1.ConfigPush/Push"
+
+// maxMessageSize bounds the size of a PushRequest
+const maxMessageSize = 64 << 20
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+// pusher validates and applies configs, *loader.Loader implements it
+type pusher interface {
+	Push(ctx context.Context, c config.ServerConfig, dryRun bool) (loader.PushResult, error)
+}
+
+// New returns the config push service, which applies configs with p
+func New(l loggerProvider, p pusher) *Service {
+	return &Service{loggerProvider: l, pusher: p}
+}
+
+// Service is the ConfigPush grpc service
+type Service struct {
+	loggerProvider
+	pusher pusher
+}
+
+// ServeHTTP implements the Push method
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if status, err := grpcwire.CheckRequest(r); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	b, err := grpcwire.ReadMessage(r.Body, maxMessageSize)
+	if err != nil {
+		configPushError.Inc()
+		grpcwire.WriteError(w, err)
+		return
+	}
+	var req PushRequest
+	if err := req.UnmarshalBinary(b); err != nil {
+		configPushError.Inc()
+		grpcwire.WriteStatus(w, grpcwire.CodeInvalidArgument, fmt.Sprintf("unable to decode PushRequest; %v", err))
+		return
+	}
+	c, err := decodeConfig(req.ServerConfig, req.Format)
+	if err != nil {
+		configPushError.Inc()
+		grpcwire.WriteStatus(w, grpcwire.CodeInvalidArgument, err.Error())
+		return
+	}
+	result, err := s.pusher.Push(r.Context(), c, req.DryRun)
+	if err != nil {
+		configPushError.Inc()
+		code := grpcwire.CodeUnavailable
+		if r.Context().Err() != nil {
+			code = grpcwire.CodeCanceled
+		}
+		grpcwire.WriteStatus(w, code, fmt.Sprintf("unable to push config; %v", err))
+		return
+	}
+	resp := PushResponse{Applied: result.Applied}
+	for _, d := range result.Diagnostics {
+		severity := SeverityError
+		if d.Severity == loader.SeverityWarning {
+			severity = SeverityWarning
+		}
+		resp.Diagnostics = append(resp.Diagnostics, Diagnostic{Severity: severity, Message: d.Message})
+	}
+	if resp.Applied {
+		configPushApplied.Inc()
+		s.Infof(r.Context(), "applied pushed config with [%v] secret providers and [%v] users", len(c.Secrets), len(c.Users))
+	} else {
+		configPushNotApplied.Inc()
+		s.Infof(r.Context(), "pushed config not applied, dry run [%v], [%v] diagnostics", req.DryRun, len(resp.Diagnostics))
+	}
+	out, err := resp.MarshalBinary()
+	if err != nil {
+		grpcwire.WriteStatus(w, grpcwire.CodeInternal, fmt.Sprintf("unable to encode PushResponse; %v", err))
+		return
+	}
+	grpcwire.WriteMessage(w, out)
+}
+
+// decodeConfig unmarshals a ServerConfig encoded as format
+func decodeConfig(b []byte, format Format) (config.ServerConfig, error) {
+	var c config.ServerConfig
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal(b, &c); err != nil {
+			return c, fmt.Errorf("unable to unmarshal yaml server config; %v", err)
+		}
+	case FormatJSON:
+		if err := json.Unmarshal(b, &c); err != nil {
+			return c, fmt.Errorf("unable to unmarshal json server config; %v", err)
+		}
+	default:
+		return c, fmt.Errorf("unknown server config format [%v]", format)
+	}
+	return c, nil
+}
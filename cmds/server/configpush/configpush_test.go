@@ -0,0 +1,135 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package configpush
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/grpcwire"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (nopLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// fakePusher applies configs with at least one user and records the last push
+type fakePusher struct {
+	config config.ServerConfig
+	dryRun bool
+}
+
+func (f *fakePusher) Push(ctx context.Context, c config.ServerConfig, dryRun bool) (loader.PushResult, error) {
+	f.config, f.dryRun = c, dryRun
+	if len(c.Users) == 0 {
+		return loader.PushResult{Diagnostics: []loader.Diagnostic{{Severity: loader.SeverityError, Message: "no users in config, cannot serve"}}}, nil
+	}
+	return loader.PushResult{Applied: !dryRun, Diagnostics: []loader.Diagnostic{{Severity: loader.SeverityWarning, Message: "100% fine"}}}, nil
+}
+
+// call makes a grpc unary call, returning the response message and grpc status
+func call(t *testing.T, c *http.Client, url string, body []byte) ([]byte, int, string) {
+	req, err := http.NewRequest(http.MethodPost, url+Path, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", grpcwire.ContentType)
+	req.Header.Set("TE", "trailers")
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	m, err := grpcwire.ReadResponse(resp, maxMessageSize)
+	if e, ok := err.(*grpcwire.Error); ok {
+		return nil, e.Code, e.Message
+	}
+	require.NoError(t, err)
+	return m, grpcwire.CodeOK, ""
+}
+
+func TestPush(t *testing.T) {
+	p := &fakePusher{}
+	server := httptest.NewUnstartedServer(New(nopLogger{}, p))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	client := server.Client()
+
+	push := func(req PushRequest) (PushResponse, int, string) {
+		b, err := req.MarshalBinary()
+		require.NoError(t, err)
+		m, code, msg := call(t, client, server.URL, grpcwire.Frame(b))
+		var resp PushResponse
+		require.NoError(t, resp.UnmarshalBinary(m))
+		return resp, code, msg
+	}
+
+	// applied, with diagnostics passed through
+	resp, code, _ := push(PushRequest{ServerConfig: []byte("users:\n  - name: alice\n")})
+	assert.Equal(t, grpcwire.CodeOK, code)
+	assert.Equal(t, PushResponse{Applied: true, Diagnostics: []Diagnostic{{Severity: SeverityWarning, Message: "100% fine"}}}, resp)
+	assert.Equal(t, "alice", p.config.Users[0].Name)
+
+	resp, code, _ = push(PushRequest{ServerConfig: []byte(`{"users": [{"name": "bob"}]}`), Format: FormatJSON, DryRun: true})
+	assert.Equal(t, grpcwire.CodeOK, code)
+	assert.False(t, resp.Applied)
+	assert.True(t, p.dryRun)
+	assert.Equal(t, "bob", p.config.Users[0].Name)
+
+	// validation errors are diagnostics, not grpc errors
+	resp, code, _ = push(PushRequest{ServerConfig: []byte("secrets: []\n")})
+	assert.Equal(t, grpcwire.CodeOK, code)
+	assert.Equal(t, PushResponse{Diagnostics: []Diagnostic{{Severity: SeverityError, Message: "no users in config, cannot serve"}}}, resp)
+
+	// undecodable configs and requests are
+	_, code, msg := push(PushRequest{ServerConfig: []byte("users: {"), Format: FormatYAML})
+	assert.Equal(t, grpcwire.CodeInvalidArgument, code)
+	assert.Contains(t, msg, "unable to unmarshal yaml server config")
+	_, code, _ = push(PushRequest{ServerConfig: []byte("{}"), Format: Format(7)})
+	assert.Equal(t, grpcwire.CodeInvalidArgument, code)
+	_, code, _ = call(t, client, server.URL, grpcwire.Frame([]byte{0xff}))
+	assert.Equal(t, grpcwire.CodeInvalidArgument, code)
+	compressed := grpcwire.Frame(nil)
+	compressed[0] = 1
+	_, code, _ = call(t, client, server.URL, compressed)
+	assert.Equal(t, grpcwire.CodeUnimplemented, code)
+
+	// grpc requires http/2
+	h1 := httptest.NewServer(New(nopLogger{}, p))
+	defer h1.Close()
+	r, err := http.Post(h1.URL+Path, grpcwire.ContentType, bytes.NewReader(grpcwire.Frame(nil)))
+	require.NoError(t, err)
+	r.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, r.StatusCode)
+}
+
+func TestMessages(t *testing.T) {
+	req := PushRequest{ServerConfig: []byte("users: []"), Format: FormatJSON, DryRun: true}
+	b, err := req.MarshalBinary()
+	require.NoError(t, err)
+	var decoded PushRequest
+	require.NoError(t, decoded.UnmarshalBinary(b))
+	assert.Equal(t, req, decoded)
+
+	resp := PushResponse{Applied: true, Diagnostics: []Diagnostic{{Severity: SeverityError, Message: "a"}, {Severity: SeverityWarning}}}
+	b, err = resp.MarshalBinary()
+	require.NoError(t, err)
+	// unknown fields from newer clients are skipped
+	b = append(b, 0x78, 0x01)
+	var decodedResp PushResponse
+	require.NoError(t, decodedResp.UnmarshalBinary(b))
+	assert.Equal(t, resp, decodedResp)
+
+	assert.Error(t, decoded.UnmarshalBinary([]byte{0x0a, 0x05, 'a'}))
+}
@@ -0,0 +1,151 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package configpush
+
+import (
+	"github.com/facebookincubator/tacquito/cmds/server/grpcwire"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Format is the encoding of PushRequest.ServerConfig
+type Format int32
+
+const (
+	// FormatYAML is the default
+	FormatYAML Format = 0
+	// FormatJSON ...
+	FormatJSON Format = 1
+)
+
+// Severity of a Diagnostic
+type Severity int32
+
+const (
+	// SeverityError rejects the pushed config
+	SeverityError Severity = 0
+	// SeverityWarning does not reject the pushed config
+	SeverityWarning Severity = 1
+)
+
+// PushRequest is tacquito.configpush.v1.PushRequest, see configpush.proto
+type PushRequest struct {
+	ServerConfig []byte
+	Format       Format
+	DryRun       bool
+}
+
+// Diagnostic is tacquito.configpush.v1.Diagnostic
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+}
+
+// PushResponse is tacquito.configpush.v1.PushResponse
+type PushResponse struct {
+	Applied     bool
+	Diagnostics []Diagnostic
+}
+
+// MarshalBinary encodes the request in protobuf wire format
+func (r PushRequest) MarshalBinary() ([]byte, error) {
+	var b []byte
+	if len(r.ServerConfig) > 0 {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, r.ServerConfig)
+	}
+	if r.Format != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.Format))
+	}
+	if r.DryRun {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a request in protobuf wire format
+func (r *PushRequest) UnmarshalBinary(b []byte) error {
+	*r = PushRequest{}
+	return grpcwire.Walk(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			r.ServerConfig = append([]byte(nil), v...)
+			return n, nil
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			r.Format = Format(v)
+			return n, nil
+		case num == 3 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			r.DryRun = protowire.DecodeBool(v)
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+// MarshalBinary encodes the response in protobuf wire format
+func (r PushResponse) MarshalBinary() ([]byte, error) {
+	var b []byte
+	if r.Applied {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	for _, d := range r.Diagnostics {
+		var m []byte
+		if d.Severity != 0 {
+			m = protowire.AppendTag(m, 1, protowire.VarintType)
+			m = protowire.AppendVarint(m, uint64(d.Severity))
+		}
+		if d.Message != "" {
+			m = protowire.AppendTag(m, 2, protowire.BytesType)
+			m = protowire.AppendString(m, d.Message)
+		}
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a response in protobuf wire format
+func (r *PushResponse) UnmarshalBinary(b []byte) error {
+	*r = PushResponse{}
+	return grpcwire.Walk(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			r.Applied = protowire.DecodeBool(v)
+			return n, nil
+		case num == 2 && typ == protowire.BytesType:
+			m, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			var d Diagnostic
+			err := grpcwire.Walk(m, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+				switch {
+				case num == 1 && typ == protowire.VarintType:
+					v, n := protowire.ConsumeVarint(b)
+					d.Severity = Severity(v)
+					return n, nil
+				case num == 2 && typ == protowire.BytesType:
+					v, n := protowire.ConsumeString(b)
+					d.Message = v
+					return n, nil
+				}
+				return protowire.ConsumeFieldValue(num, typ, b), nil
+			})
+			r.Diagnostics = append(r.Diagnostics, d)
+			return n, err
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
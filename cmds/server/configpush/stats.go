@@ -0,0 +1,38 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package configpush
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// gauges and counters
+	configPushApplied = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "configpush_applied",
+		Help:      "number of pushed configs applied",
+	})
+	configPushNotApplied = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "configpush_not_applied",
+		Help:      "number of pushed configs validated but not applied, for errors or being a dry run",
+	})
+	configPushError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "configpush_error",
+		Help:      "number of push calls that failed before validation, eg undecodable requests",
+	})
+)
+
+func init() {
+	// gauges and counters
+	prometheus.MustRegister(configPushApplied)
+	prometheus.MustRegister(configPushNotApplied)
+	prometheus.MustRegister(configPushError)
+}
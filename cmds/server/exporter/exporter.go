@@ -8,25 +8,184 @@
 package exporter
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
-	"log"
+	"fmt"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/facebookincubator/tacquito/cmds/server/tlsreload"
+
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
-	promExportAddress = flag.String("metrics-address", ":8080", "port for promhttp exporter to listen on")
+	promExportAddress = flag.String("metrics-address", ":8080", "address the promhttp exporter listens on; host:port, localhost:port to only serve local scrapers, or unix:/path/to/socket")
 	exportPromHTTP    = flag.Bool("export-promhttp", true, "execute promHttp handler")
+	metricsTLSCert    = flag.String("metrics-tls-cert", "", "serve metrics over tls with this certificate; reloaded when it changes or on SIGHUP")
+	metricsTLSKey     = flag.String("metrics-tls-key", "", "key of -metrics-tls-cert")
+	metricsClientCA   = flag.String("metrics-client-ca", "", "ca bundle that scrapers must present a certificate from; requires -metrics-tls-cert")
 )
 
-// StartPromHTTP will start the prometheus http service that reports our metrics
-func StartPromHTTP() error {
-	if *exportPromHTTP {
-		http.Handle("/metrics", promhttp.Handler())
-		log.Printf("starting prometheus http exporter, listening [%v]/metrics", *promExportAddress)
-		return http.ListenAndServe(*promExportAddress, nil)
+// UnixPrefix marks an exporter address as the path of a unix socket, eg unix:/run/tacquito/metrics.sock
+const UnixPrefix = "unix:"
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+}
+
+// Option configures an Exporter
+type Option func(e *Exporter)
+
+// SetAddress sets the address metrics are served on, a host:port or a unix socket path prefixed
+// with unix:.  Defaults to :8080, every interface; localhost:8080 only serves local scrapers.
+func SetAddress(address string) Option {
+	return func(e *Exporter) {
+		e.address = address
+	}
+}
+
+// SetTLSConfig serves metrics over tls.  Set config.ClientAuth to tls.RequireAndVerifyClientCert
+// to only serve scrapers with a trusted client certificate.
+func SetTLSConfig(config *tls.Config) Option {
+	return func(e *Exporter) {
+		e.tlsConfig = config
+	}
+}
+
+// SetGatherer sets the source of the metrics served, defaulting to the gatherer of this package,
+// which includes counters restored by StartPersistence
+func SetGatherer(g prometheus.Gatherer) Option {
+	return func(e *Exporter) {
+		e.gatherer = g
+	}
+}
+
+// SetStats serves the runtime stats of the servers at /stats, eg a tq.Stats, so scrapers that do
+// not speak prometheus can read them as json
+func SetStats(h http.Handler) Option {
+	return func(e *Exporter) {
+		e.stats = h
+	}
+}
+
+// New creates an Exporter serving /metrics, and the pprof handlers under /debug/pprof/
+func New(l loggerProvider, opts ...Option) *Exporter {
+	e := &Exporter{loggerProvider: l, address: ":8080"}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Exporter is the prometheus http service that reports our metrics
+type Exporter struct {
+	loggerProvider
+	address   string
+	tlsConfig *tls.Config
+	gatherer  prometheus.Gatherer
+	stats     http.Handler
+}
+
+// Handler returns the http handler of the exporter
+func (e *Exporter) Handler() http.Handler {
+	g := e.gatherer
+	if g == nil {
+		g = gatherer
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(g, promhttp.HandlerOpts{})))
+	// net/http/pprof registers itself on the default mux
+	mux.Handle("/debug/pprof/", http.DefaultServeMux)
+	if e.stats != nil {
+		mux.Handle("/stats", e.stats)
+	}
+	return mux
+}
+
+// listen opens the listener of address.  A stale unix socket left behind by a previous process
+// is removed first.
+func (e *Exporter) listen() (net.Listener, error) {
+	if !strings.HasPrefix(e.address, UnixPrefix) {
+		return net.Listen("tcp", e.address)
+	}
+	path := strings.TrimPrefix(e.address, UnixPrefix)
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// ListenAndServe serves metrics until ctx is cancelled
+func (e *Exporter) ListenAndServe(ctx context.Context) error {
+	ln, err := e.listen()
+	if err != nil {
+		return fmt.Errorf("unable to listen on [%v]; %v", e.address, err)
+	}
+	if e.tlsConfig != nil {
+		ln = tls.NewListener(ln, e.tlsConfig)
+	}
+	srv := &http.Server{Handler: e.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	e.Infof(ctx, "starting prometheus http exporter, listening [%v]/metrics, tls [%v]", e.address, e.tlsConfig != nil)
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		return err
 	}
 	return nil
 }
+
+// StartPromHTTP will start the prometheus http service that reports our metrics, configured by
+// flags and opts, until ctx is cancelled
+func StartPromHTTP(ctx context.Context, l loggerProvider, opts ...Option) error {
+	if !*exportPromHTTP {
+		return nil
+	}
+	opts = append([]Option{SetAddress(*promExportAddress)}, opts...)
+	config, err := flagTLSConfig(ctx, l)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		opts = append(opts, SetTLSConfig(config))
+	}
+	return New(l, opts...).ListenAndServe(ctx)
+}
+
+// flagTLSConfig builds the exporter's tls config from flags, nil if tls is not enabled.  With a
+// client ca, scrapers must present a certificate that verifies against it.
+func flagTLSConfig(ctx context.Context, l loggerProvider) (*tls.Config, error) {
+	if *metricsTLSCert == "" && *metricsTLSKey == "" {
+		if *metricsClientCA != "" {
+			return nil, fmt.Errorf("-metrics-client-ca requires -metrics-tls-cert and -metrics-tls-key")
+		}
+		return nil, nil
+	}
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	var opts []tlsreload.Option
+	if *metricsClientCA != "" {
+		opts = append(opts, tlsreload.SetClientCA(*metricsClientCA))
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	reloader, err := tlsreload.New(l, *metricsTLSCert, *metricsTLSKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := reloader.Watch(ctx); err != nil {
+		return nil, err
+	}
+	return reloader.Config(base), nil
+}
@@ -0,0 +1,146 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package exporter
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (mockLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+// issue creates a certificate signed by parent, or self signed if parent is nil
+func issue(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// metrics scrapes /metrics with client, returning the body
+func metrics(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url + "/metrics")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return string(b), err
+}
+
+func serve(t *testing.T, ctx context.Context, e *Exporter) {
+	go func() {
+		assert.NoError(t, e.ListenAndServe(ctx))
+	}()
+}
+
+func TestUnixSocket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Namespace: "tacquito", Name: "exporter_test"})
+	reg.MustRegister(c)
+	c.Inc()
+
+	path := filepath.Join(t.TempDir(), "metrics.sock")
+	serve(t, ctx, New(mockLogger{}, SetAddress(UnixPrefix+path), SetGatherer(reg)))
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	assert.Eventually(t, func() bool {
+		body, err := metrics(client, "http://unix")
+		return err == nil && strings.Contains(body, "tacquito_exporter_test 1")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestClientAuth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ca := issue(t, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ca"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	server := issue(t, &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "localhost"}, IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, &ca)
+	scraper := issue(t, &x509.Certificate{SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "prometheus"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, &ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	// find a free localhost port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := ln.Addr().String()
+	ln.Close()
+	serve(t, ctx, New(mockLogger{}, SetAddress(address), SetTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})))
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs}}}
+	}
+	assert.Eventually(t, func() bool {
+		body, err := metrics(client(scraper), "https://"+address)
+		return err == nil && strings.Contains(body, "promhttp_metric_handler_requests_total")
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = metrics(client(), "https://"+address)
+	assert.Error(t, err, "scrapers without a client certificate are refused")
+}
+
+func TestStats(t *testing.T) {
+	stats := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"connections":1}`))
+	})
+	srv := httptest.NewServer(New(mockLogger{}, SetStats(stats)).Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/stats")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"connections":1}`, string(b))
+
+	// without stats, nothing is served
+	srv = httptest.NewServer(New(mockLogger{}).Handler())
+	defer srv.Close()
+	resp, err = http.Get(srv.URL + "/stats")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,228 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	metricsStateFile     = flag.String("metrics-state-file", "", "path of a file used to persist selected counters across restarts; empty disables")
+	metricsPersist       = flag.String("metrics-persist", "tacquito_response_", "comma separated metric name prefixes of the counters to persist or push")
+	metricsStateInterval = flag.Duration("metrics-state-interval", time.Minute, "how often persisted counters are saved to the state file")
+	pushgatewayAddress   = flag.String("pushgateway-address", "", "url of a prometheus pushgateway that receives final counter values at shutdown; empty disables")
+	pushgatewayJob       = flag.String("pushgateway-job", "tacquito", "the job name used when pushing to the pushgateway")
+)
+
+// gatherer is the source of metrics served and persisted by the exporter.  It is replaced
+// with a persistentGatherer when a state file is configured.
+var gatherer prometheus.Gatherer = prometheus.DefaultGatherer
+
+// state is the on disk representation of persisted counters
+type state struct {
+	Saved    time.Time          `json:"saved"`
+	Counters map[string]float64 `json:"counters"`
+}
+
+// persistentGatherer adds the counter values saved by a previous process to the counters
+// gathered from next, so persisted counters keep increasing across restarts.
+type persistentGatherer struct {
+	next     prometheus.Gatherer
+	prefixes []string
+	path     string
+
+	mu sync.Mutex
+	// offsets are the counter values restored from the state file
+	offsets map[string]float64
+}
+
+// newPersistentGatherer restores offsets from path, if it exists
+func newPersistentGatherer(next prometheus.Gatherer, path string, prefixes []string) (*persistentGatherer, error) {
+	p := &persistentGatherer{next: next, path: path, prefixes: prefixes, offsets: make(map[string]float64)}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read metrics state file [%v]; %v", path, err)
+	}
+	var s state
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("unable to decode metrics state file [%v]; %v", path, err)
+	}
+	for k, v := range s.Counters {
+		p.offsets[k] = v
+	}
+	return p, nil
+}
+
+// persisted reports if a metric family name should be persisted
+func persisted(prefixes []string, name string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// metricKey uniquely identifies a metric by its family name and labels
+func metricKey(name string, m *dto.Metric) string {
+	if len(m.GetLabel()) == 0 {
+		return name
+	}
+	pairs := make([]string, 0, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		pairs = append(pairs, fmt.Sprintf("%v=%q", l.GetName(), l.GetValue()))
+	}
+	sort.Strings(pairs)
+	return fmt.Sprintf("%v{%v}", name, strings.Join(pairs, ","))
+}
+
+// Gather implements prometheus.Gatherer
+func (p *persistentGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := p.next.Gather()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_COUNTER || !persisted(p.prefixes, family.GetName()) {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if offset, ok := p.offsets[metricKey(family.GetName(), m)]; ok && m.Counter != nil {
+				v := m.Counter.GetValue() + offset
+				m.Counter.Value = &v
+			}
+		}
+	}
+	return families, err
+}
+
+// save writes the current value of all persisted counters to the state file
+func (p *persistentGatherer) save() error {
+	families, err := p.Gather()
+	if err != nil {
+		return err
+	}
+	s := state{Saved: time.Now(), Counters: make(map[string]float64)}
+	p.mu.Lock()
+	// carry forward restored counters that have not been observed by this process yet
+	for k, v := range p.offsets {
+		s.Counters[k] = v
+	}
+	p.mu.Unlock()
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_COUNTER || !persisted(p.prefixes, family.GetName()) {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			s.Counters[metricKey(family.GetName(), m)] = m.GetCounter().GetValue()
+		}
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	// write then rename so a crash never leaves a truncated state file
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), filepath.Base(p.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.path)
+}
+
+// filteredGatherer only returns persisted counter families
+type filteredGatherer struct {
+	next     prometheus.Gatherer
+	prefixes []string
+}
+
+// Gather implements prometheus.Gatherer
+func (f filteredGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := f.next.Gather()
+	filtered := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		if family.GetType() == dto.MetricType_COUNTER && persisted(f.prefixes, family.GetName()) {
+			filtered = append(filtered, family)
+		}
+	}
+	return filtered, err
+}
+
+// StartPersistence restores persisted counters from the state file and saves them every
+// metrics-state-interval until ctx is cancelled.  It must be called before StartPromHTTP.
+// Call Shutdown when the server exits to save or push final values.
+func StartPersistence(ctx context.Context) error {
+	if *metricsStateFile == "" {
+		return nil
+	}
+	p, err := newPersistentGatherer(prometheus.DefaultGatherer, *metricsStateFile, strings.Split(*metricsPersist, ","))
+	if err != nil {
+		return err
+	}
+	gatherer = p
+	log.Printf("restored [%v] persisted counters from [%v]", len(p.offsets), *metricsStateFile)
+	go func() {
+		ticker := time.NewTicker(*metricsStateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := p.save(); err != nil {
+					log.Printf("unable to save metrics state file [%v]; %v", *metricsStateFile, err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown saves persisted counters to the state file and pushes them to the pushgateway,
+// if either is configured
+func Shutdown(ctx context.Context) error {
+	var errs []string
+	if p, ok := gatherer.(*persistentGatherer); ok {
+		if err := p.save(); err != nil {
+			errs = append(errs, fmt.Sprintf("unable to save metrics state file [%v]; %v", *metricsStateFile, err))
+		}
+	}
+	if *pushgatewayAddress != "" {
+		g := filteredGatherer{next: gatherer, prefixes: strings.Split(*metricsPersist, ",")}
+		if err := push.New(*pushgatewayAddress, *pushgatewayJob).Gatherer(g).PushContext(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("unable to push to pushgateway [%v]; %v", *pushgatewayAddress, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return nil
+}
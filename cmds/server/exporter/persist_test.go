@@ -0,0 +1,65 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package exporter
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func counterValue(t *testing.T, g prometheus.Gatherer, name string) float64 {
+	families, err := g.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name && family.GetType() == dto.MetricType_COUNTER {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatalf("counter [%v] not found", name)
+	return 0
+}
+
+func TestPersistentGatherer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	prefixes := []string{"tacquito_response_"}
+
+	// first process lifetime
+	reg := prometheus.NewRegistry()
+	kept := prometheus.NewCounter(prometheus.CounterOpts{Namespace: "tacquito", Name: "response_authen_pass"})
+	ignored := prometheus.NewCounter(prometheus.CounterOpts{Namespace: "tacquito", Name: "serve_received"})
+	reg.MustRegister(kept, ignored)
+	kept.Add(5)
+	ignored.Add(3)
+
+	p, err := newPersistentGatherer(reg, path, prefixes)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(5), counterValue(t, p, "tacquito_response_authen_pass"))
+	assert.NoError(t, p.save())
+
+	// second process lifetime, counters start from zero
+	reg = prometheus.NewRegistry()
+	kept = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "tacquito", Name: "response_authen_pass"})
+	ignored = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "tacquito", Name: "serve_received"})
+	reg.MustRegister(kept, ignored)
+	kept.Add(2)
+	ignored.Add(1)
+
+	p, err = newPersistentGatherer(reg, path, prefixes)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(7), counterValue(t, p, "tacquito_response_authen_pass"))
+	assert.Equal(t, float64(1), counterValue(t, p, "tacquito_serve_received"))
+
+	// only persisted counters are pushed
+	families, err := filteredGatherer{next: p, prefixes: prefixes}.Gather()
+	assert.NoError(t, err)
+	assert.Len(t, families, 1)
+}
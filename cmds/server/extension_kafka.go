@@ -0,0 +1,24 @@
+//go:build kafka
+
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/accounters/kafka"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+)
+
+func init() {
+	registerExtension("kafka", func(ctx context.Context, l loggerProvider) ([]loader.Option, error) {
+		return []loader.Option{loader.RegisterAccounter(config.KAFKA, kafka.New(ctx, l))}, nil
+	})
+}
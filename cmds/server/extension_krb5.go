@@ -0,0 +1,24 @@
+//go:build krb5
+
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/krb5"
+)
+
+func init() {
+	registerAuthenticatorExtension("krb5", func(ctx context.Context, l loggerProvider) (map[config.AuthenticatorType]authenticators.Factory, error) {
+		return map[config.AuthenticatorType]authenticators.Factory{config.KRB5: krb5.New(l)}, nil
+	})
+}
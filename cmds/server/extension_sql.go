@@ -0,0 +1,56 @@
+//go:build sql
+
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	sqldir "github.com/facebookincubator/tacquito/cmds/server/loader/sql"
+
+	// drivers selected with -sql-driver
+	_ "github.com/facebookincubator/tacquito/cmds/server/loader/sql/drivers"
+)
+
+var (
+	sqlDriver          = flag.String("sql-driver", "postgres", "database/sql driver of the user directory, postgres or mysql")
+	sqlDSN             = flag.String("sql-dsn", "", "data source name of the user directory database; empty, with no -sql-dsn-file, disables the directory")
+	sqlDSNFile         = flag.String("sql-dsn-file", "", "file holding the data source name of the user directory database, keeps credentials out of the process list")
+	sqlRefreshInterval = flag.Duration("sql-refresh-interval", time.Minute, "how often the user directory is read again, 0 only reads it when the config loads")
+	sqlTimeout         = flag.Duration("sql-timeout", 10*time.Second, "bounds the time taken to read the user directory")
+)
+
+func init() {
+	registerSourceExtension("sql", func(ctx context.Context, l loggerProvider) (sourceWrapper, error) {
+		dsn := *sqlDSN
+		if *sqlDSNFile != "" {
+			b, err := os.ReadFile(*sqlDSNFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read sql dsn file [%v]; %v", *sqlDSNFile, err)
+			}
+			dsn = strings.TrimSpace(string(b))
+		}
+		if dsn == "" {
+			return nil, nil
+		}
+		db, err := sql.Open(*sqlDriver, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open sql directory with driver [%v]; %v", *sqlDriver, err)
+		}
+		return func(s configSource) configSource {
+			return sqldir.New(ctx, l, s, db, sqldir.SetRefreshInterval(*sqlRefreshInterval), sqldir.SetTimeout(*sqlTimeout))
+		}, nil
+	})
+}
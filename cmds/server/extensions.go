@@ -0,0 +1,128 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+)
+
+// configSource loads configs, eg the yaml loader
+type configSource interface {
+	Load(path string) error
+	Config() chan config.ServerConfig
+}
+
+// sourceWrapper returns a configSource that adds to the configs of another, eg users from a
+// directory
+type sourceWrapper func(s configSource) configSource
+
+// extension wires an optional integration into the loader.  Integrations that pull in heavy
+// dependencies (kafka, opa, sql, krb5, etc) register themselves from a file guarded by a
+// build tag, eg extension_kafka.go with //go:build kafka.  Default builds never compile those files,
+// keeping the server a small, static binary; full featured builds enable them with -tags.  The
+// integrations themselves are modules of their own, resolved by the go.work workspace, so this file
+// only holds the registry.
+type extension struct {
+	// name is the build tag that enables this extension
+	name string
+	// options returns loader options that register the extension's handlers, accounters, etc.
+	options func(ctx context.Context, l loggerProvider) ([]loader.Option, error)
+	// source if set, returns a wrapper of the config source, nil leaves the source as is
+	source func(ctx context.Context, l loggerProvider) (sourceWrapper, error)
+	// authenticators if set, returns authenticator types, which the totp, push and cache
+	// authenticators may wrap
+	authenticators func(ctx context.Context, l loggerProvider) (map[config.AuthenticatorType]authenticators.Factory, error)
+}
+
+// extensions holds every extension compiled into this binary
+var extensions []extension
+
+// registerExtension is called from the init func of build tag guarded files
+func registerExtension(name string, options func(ctx context.Context, l loggerProvider) ([]loader.Option, error)) {
+	extensions = append(extensions, extension{name: name, options: options})
+}
+
+// registerSourceExtension is called from the init func of build tag guarded files whose
+// integration adds to the loaded config, eg users from a database
+func registerSourceExtension(name string, source func(ctx context.Context, l loggerProvider) (sourceWrapper, error)) {
+	extensions = append(extensions, extension{name: name, source: source})
+}
+
+// registerAuthenticatorExtension is called from the init func of build tag guarded files whose
+// integration is an authenticator
+func registerAuthenticatorExtension(name string, a func(ctx context.Context, l loggerProvider) (map[config.AuthenticatorType]authenticators.Factory, error)) {
+	extensions = append(extensions, extension{name: name, authenticators: a})
+}
+
+// extensionOptions collects the loader options of all compiled in extensions
+func extensionOptions(ctx context.Context, l loggerProvider) ([]loader.Option, error) {
+	var opts []loader.Option
+	for _, e := range extensions {
+		if e.options == nil {
+			continue
+		}
+		o, err := e.options(ctx, l)
+		if err != nil {
+			return nil, fmt.Errorf("unable to enable extension [%v]; %w", e.name, err)
+		}
+		l.Infof(ctx, "enabled extension [%v]", e.name)
+		opts = append(opts, o...)
+	}
+	return opts, nil
+}
+
+// extensionSources collects the config source wrappers of all compiled in extensions
+func extensionSources(ctx context.Context, l loggerProvider) ([]sourceWrapper, error) {
+	var wrappers []sourceWrapper
+	for _, e := range extensions {
+		if e.source == nil {
+			continue
+		}
+		w, err := e.source(ctx, l)
+		if err != nil {
+			return nil, fmt.Errorf("unable to enable extension [%v]; %w", e.name, err)
+		}
+		if w == nil {
+			continue
+		}
+		l.Infof(ctx, "enabled extension [%v]", e.name)
+		wrappers = append(wrappers, w)
+	}
+	return wrappers, nil
+}
+
+// extensionAuthenticators adds the authenticator types of all compiled in extensions to types
+func extensionAuthenticators(ctx context.Context, l loggerProvider, types map[config.AuthenticatorType]authenticators.Factory) error {
+	for _, e := range extensions {
+		if e.authenticators == nil {
+			continue
+		}
+		a, err := e.authenticators(ctx, l)
+		if err != nil {
+			return fmt.Errorf("unable to enable extension [%v]; %w", e.name, err)
+		}
+		l.Infof(ctx, "enabled extension [%v]", e.name)
+		for t, f := range a {
+			types[t] = f
+		}
+	}
+	return nil
+}
+
+// wrapSource wraps s with every wrapper, in order
+func wrapSource(s configSource, wrappers []sourceWrapper) configSource {
+	for _, w := range wrappers {
+		s = w(s)
+	}
+	return s
+}
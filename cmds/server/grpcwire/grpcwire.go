@@ -0,0 +1,208 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package grpcwire speaks the grpc unary protocol over http/2 with net/http, see
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md, so the server's grpc services
+// and clients need not depend on grpc-go.  Callers encode their messages in protobuf wire format
+// themselves, eg with protowire and Walk.  Only uncompressed messages are supported.  The interop
+// module beside this package tests it against grpc-go.
+package grpcwire
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ContentType is the content-type of grpc requests and responses
+const ContentType = "application/grpc"
+
+// grpc status codes, see https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	CodeOK              = 0
+	CodeCanceled        = 1
+	CodeUnknown         = 2
+	CodeInvalidArgument = 3
+	CodeUnimplemented   = 12
+	CodeInternal        = 13
+	CodeUnavailable     = 14
+)
+
+// Error is a grpc status other than OK
+type Error struct {
+	Code    int
+	Message string
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return fmt.Sprintf("grpc status [%v]; %v", e.Code, e.Message)
+}
+
+// Frame length prefixes an uncompressed message
+func Frame(b []byte) []byte {
+	out := make([]byte, 5, 5+len(b))
+	binary.BigEndian.PutUint32(out[1:], uint32(len(b)))
+	return append(out, b...)
+}
+
+// ReadMessage reads a single length prefixed message of at most max bytes.  Errors are an *Error
+// with the status to answer the peer with.
+func ReadMessage(r io.Reader, max uint32) ([]byte, error) {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, &Error{Code: CodeInvalidArgument, Message: fmt.Sprintf("unable to read message prefix; %v", err)}
+	}
+	if prefix[0] != 0 {
+		return nil, &Error{Code: CodeUnimplemented, Message: "compressed messages are not supported"}
+	}
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > max {
+		return nil, &Error{Code: CodeInvalidArgument, Message: fmt.Sprintf("message of [%v] bytes exceeds the [%v] byte limit", n, max)}
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, &Error{Code: CodeInvalidArgument, Message: fmt.Sprintf("unable to read message; %v", err)}
+	}
+	return b, nil
+}
+
+// CheckRequest returns the http status to refuse r with, and why, if it is not a grpc request
+func CheckRequest(r *http.Request) (int, error) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+		return http.StatusBadRequest, fmt.Errorf("grpc requires http/2 POST requests")
+	}
+	if ct := r.Header.Get("Content-Type"); ct != ContentType && !strings.HasPrefix(ct, ContentType+"+proto") {
+		return http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content-type [%v]", ct)
+	}
+	return http.StatusOK, nil
+}
+
+// WriteMessage writes a response of the message b, with an OK status
+func WriteMessage(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	w.Write(Frame(b))
+	w.Header().Set("Grpc-Status", strconv.Itoa(CodeOK))
+	w.Header().Set("Grpc-Message", "")
+}
+
+// WriteStatus writes a trailers only response of the status code with msg
+func WriteStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", encodeMessage(msg))
+	w.WriteHeader(http.StatusOK)
+}
+
+// WriteError writes a trailers only response of err, an *Error or else an unknown status
+func WriteError(w http.ResponseWriter, err error) {
+	if e, ok := err.(*Error); ok {
+		WriteStatus(w, e.Code, e.Message)
+		return
+	}
+	WriteStatus(w, CodeUnknown, err.Error())
+}
+
+// encodeMessage percent encodes a grpc-message value
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// NewRequest returns a unary call of the method at url, eg https://host/package.Service/Method,
+// with the message b
+func NewRequest(ctx context.Context, url string, b []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(Frame(b)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("TE", "trailers")
+	return req, nil
+}
+
+// ReadResponse reads the message of the response to a unary call, of at most max bytes.  A status
+// other than OK is returned as an *Error.  The caller closes the body.
+func ReadResponse(resp *http.Response, max uint32) ([]byte, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status [%v]", resp.Status)
+	}
+	if resp.ProtoMajor != 2 {
+		return nil, fmt.Errorf("grpc requires http/2, the server answered over [%v]", resp.Proto)
+	}
+	// a trailers only response carries its status in the headers
+	if err := statusError(resp.Header); err != nil {
+		return nil, err
+	}
+	m, err := ReadMessage(resp.Body, max)
+	if err != nil {
+		return nil, err
+	}
+	// trailers are only read once the body is
+	io.Copy(io.Discard, resp.Body)
+	if err := statusError(resp.Trailer); err != nil {
+		return nil, err
+	}
+	if resp.Trailer.Get("Grpc-Status") == "" {
+		return nil, fmt.Errorf("response is missing its grpc-status")
+	}
+	return m, nil
+}
+
+// statusError returns the *Error of a grpc-status that is set and not OK
+func statusError(h http.Header) error {
+	status := h.Get("Grpc-Status")
+	if status == "" || status == "0" {
+		return nil
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		code = CodeUnknown
+	}
+	msg, _ := url.PathUnescape(h.Get("Grpc-Message"))
+	return &Error{Code: code, Message: msg}
+}
+
+// Walk calls field for every field of the protobuf message b.  field consumes the field's value and
+// returns its length, negative on a protowire error.  Unknown fields are skipped by returning
+// protowire.ConsumeFieldValue.
+func Walk(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("bad field tag; %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("bad value for field [%v]; %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
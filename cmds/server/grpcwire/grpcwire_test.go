@@ -0,0 +1,59 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package grpcwire
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestReadMessage(t *testing.T) {
+	m, err := ReadMessage(bytes.NewReader(Frame([]byte("hello"))), 5)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), m)
+
+	code := func(b []byte) int {
+		_, err := ReadMessage(bytes.NewReader(b), 5)
+		e, ok := err.(*Error)
+		require.True(t, ok, "%v", err)
+		return e.Code
+	}
+	assert.Equal(t, CodeInvalidArgument, code(Frame([]byte("hello!"))), "over the limit")
+	assert.Equal(t, CodeInvalidArgument, code(Frame([]byte("hello"))[:7]), "truncated")
+	compressed := Frame(nil)
+	compressed[0] = 1
+	assert.Equal(t, CodeUnimplemented, code(compressed))
+
+	assert.Equal(t, "50%25 done%0A", encodeMessage("50% done\n"))
+}
+
+func TestWalk(t *testing.T) {
+	b := protowire.AppendTag(nil, 1, protowire.BytesType)
+	b = protowire.AppendString(b, "alice")
+	// unknown fields are skipped
+	b = protowire.AppendTag(b, 15, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+	var got []string
+	err := Walk(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeString(b)
+			got = append(got, v)
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, got)
+	assert.Error(t, Walk(b[:3], func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	}))
+}
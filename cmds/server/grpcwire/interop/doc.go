@@ -0,0 +1,10 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package interop tests the grpc services and clients built on grpcwire against grpc-go.  It is a
+// module of its own, so only its tests depend on grpc-go; it holds no code besides them.
+package interop
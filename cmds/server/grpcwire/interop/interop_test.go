@@ -0,0 +1,208 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package interop
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authorizers/policy"
+	"github.com/facebookincubator/tacquito/cmds/server/config/configtest"
+	"github.com/facebookincubator/tacquito/cmds/server/configpush"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})      {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{})     {}
+func (mockLogger) Debugf(ctx context.Context, format string, args ...interface{})     {}
+func (mockLogger) Record(ctx context.Context, r map[string]string, obscure ...string) {}
+func (mockLogger) Set(ctx context.Context, fields map[string]string, keys ...tq.ContextKey) context.Context {
+	return ctx
+}
+
+// codec marshals the messages of the grpcwire services, which implement encoding.BinaryMarshaler
+// and BinaryUnmarshaler rather than proto.Message
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("[%T] is not a BinaryMarshaler", v)
+	}
+	return m.MarshalBinary()
+}
+
+func (codec) Unmarshal(b []byte, v interface{}) error {
+	m, ok := v.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("[%T] is not a BinaryUnmarshaler", v)
+	}
+	return m.UnmarshalBinary(b)
+}
+
+func (codec) Name() string { return "proto" }
+
+// newTLS returns the tls configs of a server with a self signed certificate and of its clients
+func newTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: pool}
+}
+
+// policyServer answers Authorize with decide
+type policyServer struct {
+	decide func(r *policy.Request) (*policy.Decision, error)
+}
+
+// serve starts s as the tacquito.policy.v1.Policy service of a grpc-go server, returning its url
+func (s *policyServer) serve(t *testing.T, serverTLS *tls.Config) string {
+	gs := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)), grpc.ForceServerCodec(codec{}))
+	gs.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "tacquito.policy.v1.Policy",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Authorize",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				var r policy.Request
+				if err := dec(&r); err != nil {
+					return nil, err
+				}
+				return s.decide(&r)
+			},
+		}},
+	}, s)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go gs.Serve(l)
+	t.Cleanup(gs.Stop)
+	return "https://" + l.Addr().String()
+}
+
+// authorize asks a, over grpc, to authorize a shell command by alice
+func authorize(t *testing.T, a *policy.Authorizer, url string) *tq.AuthorReply {
+	h, err := a.New(config.User{Name: "alice", Scopes: []string{"lab"}}, map[string]string{"url": url, "protocol": "grpc"})
+	require.NoError(t, err)
+	b, err := tq.NewAuthorRequest(
+		tq.SetAuthorRequestMethod(tq.AuthenMethodTacacsPlus),
+		tq.SetAuthorRequestPrivLvl(tq.PrivLvlRoot),
+		tq.SetAuthorRequestType(tq.AuthenTypeASCII),
+		tq.SetAuthorRequestService(tq.AuthenServiceLogin),
+		tq.SetAuthorRequestUser("alice"),
+		tq.SetAuthorRequestPort("tty0"),
+		tq.SetAuthorRequestRemAddr("192.0.2.1"),
+		tq.SetAuthorRequestArgs(tq.Args{"service=shell", "cmd=show"}),
+	).MarshalBinary()
+	require.NoError(t, err)
+	r := &configtest.Response{}
+	h.Handle(r, tq.Request{Header: *tq.NewHeader(tq.SetHeaderType(tq.Authorize)), Body: b, Context: context.Background()})
+	require.NotNil(t, r.Author)
+	return r.Author
+}
+
+// TestPolicyClient calls a grpc-go policy service with the policy authorizer
+func TestPolicyClient(t *testing.T) {
+	serverTLS, clientTLS := newTLS(t)
+	var got policy.Request
+	s := &policyServer{decide: func(r *policy.Request) (*policy.Decision, error) {
+		got = *r
+		return &policy.Decision{Status: policy.StatusPassAdd, Args: []string{"priv-lvl=15"}, ServerMsg: "ok"}, nil
+	}}
+	url := s.serve(t, serverTLS)
+	a := policy.New(mockLogger{}, policy.SetHTTPClient(&http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS, ForceAttemptHTTP2: true}}))
+
+	reply := authorize(t, a, url)
+	assert.Equal(t, tq.AuthorStatusPassAdd, reply.Status)
+	assert.Equal(t, tq.Args{"priv-lvl=15"}, reply.Args)
+	assert.Equal(t, tq.AuthorServerMsg("ok"), reply.ServerMsg)
+	assert.Equal(t, "alice", got.User)
+	assert.Equal(t, "lab", got.Scope)
+	assert.Equal(t, []string{"service=shell", "cmd=show"}, got.Args)
+
+	// grpc errors fail closed
+	s.decide = func(r *policy.Request) (*policy.Decision, error) {
+		return nil, status.Error(codes.PermissionDenied, "denied: 100% sure")
+	}
+	assert.Equal(t, tq.AuthorStatusFail, authorize(t, a, url).Status)
+}
+
+// fakePusher applies configs with at least one user
+type fakePusher struct{}
+
+func (fakePusher) Push(ctx context.Context, c config.ServerConfig, dryRun bool) (loader.PushResult, error) {
+	if len(c.Users) == 0 {
+		return loader.PushResult{Diagnostics: []loader.Diagnostic{{Severity: loader.SeverityError, Message: "no users in config, cannot serve"}}}, nil
+	}
+	return loader.PushResult{Applied: !dryRun}, nil
+}
+
+// TestConfigPushServer calls the config push service with a grpc-go client
+func TestConfigPushServer(t *testing.T) {
+	serverTLS, clientTLS := newTLS(t)
+	server := httptest.NewUnstartedServer(configpush.New(mockLogger{}, fakePusher{}))
+	server.EnableHTTP2 = true
+	server.TLS = serverTLS
+	server.StartTLS()
+	defer server.Close()
+	conn, err := grpc.Dial(server.Listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)), grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})))
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resp configpush.PushResponse
+	require.NoError(t, conn.Invoke(ctx, configpush.Path, &configpush.PushRequest{ServerConfig: []byte("users:\n  - name: alice\n")}, &resp))
+	assert.True(t, resp.Applied)
+
+	resp = configpush.PushResponse{}
+	require.NoError(t, conn.Invoke(ctx, configpush.Path, &configpush.PushRequest{ServerConfig: []byte("secrets: []\n")}, &resp))
+	assert.Equal(t, configpush.PushResponse{Diagnostics: []configpush.Diagnostic{{Severity: configpush.SeverityError, Message: "no users in config, cannot serve"}}}, resp)
+
+	// trailers only responses carry the status, with its message percent encoded
+	err = conn.Invoke(ctx, configpush.Path, &configpush.PushRequest{ServerConfig: []byte("users: {")}, &resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "unable to unmarshal yaml server config")
+}
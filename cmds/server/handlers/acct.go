@@ -9,6 +9,7 @@ package handlers
 
 import (
 	"fmt"
+	"time"
 
 	tq "github.com/facebookincubator/tacquito"
 )
@@ -23,12 +24,17 @@ type AccountingRequest struct {
 	loggerProvider
 	configProvider
 	recorderWriter
+	// tasks if set, tracks accounting tasks by task_id
+	tasks *taskTracker
+	// enrichers add metadata to records before they are passed to the accounter
+	enrichers []Enricher
 }
 
 // Handle ...
 func (a *AccountingRequest) Handle(response tq.Response, request tq.Request) {
+	received := time.Now()
 	var body tq.AcctRequest
-	if err := tq.Unmarshal(request.Body, &body); err != nil {
+	if err := request.Unmarshal(&body); err != nil {
 		a.Errorf(request.Context, "unable to unmarshal accounting packet : %v", err)
 		accountingHandleUnexpectedPacket.Inc()
 		accountingHandleError.Inc()
@@ -44,6 +50,10 @@ func (a *AccountingRequest) Handle(response tq.Response, request tq.Request) {
 	}
 
 	a.RecordCtx(&request, tq.ContextUser, tq.ContextRemoteAddr, tq.ContextReqArgs, tq.ContextAcctType, tq.ContextPort, tq.ContextPrivLvl, tq.ContextFlags)
+	if a.tasks != nil {
+		remAddr, _ := request.Context.Value(tq.ContextConnRemoteAddr).(string)
+		a.tasks.track(remAddr, body)
+	}
 	// TODO implement a fallback for cases where a username may not be present.
 	c := a.GetUser(string(body.User))
 	if c == nil {
@@ -61,5 +71,8 @@ func (a *AccountingRequest) Handle(response tq.Response, request tq.Request) {
 		return
 	}
 
+	if len(a.enrichers) > 0 {
+		request.Context = enrich(request, body, received, a.enrichers)
+	}
 	NewResponseLogger(a.Context(), a.loggerProvider, c.Accounting).Handle(response, request)
 }
@@ -0,0 +1,213 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/throttle"
+)
+
+// Enricher adds fields to the metadata of an accounting record before it is passed to the user's
+// accounter.  Deployments may add their own fields with SetStartEnrichers.  Enrich is called on the
+// request's goroutine, so it should not block for long.
+type Enricher interface {
+	Enrich(ctx context.Context, body tq.AcctRequest, m tq.AcctMetadata)
+}
+
+// EnricherFunc is an adapter to use ordinary functions as Enrichers
+type EnricherFunc func(ctx context.Context, body tq.AcctRequest, m tq.AcctMetadata)
+
+// Enrich implements Enricher
+func (f EnricherFunc) Enrich(ctx context.Context, body tq.AcctRequest, m tq.AcctMetadata) {
+	f(ctx, body, m)
+}
+
+// SetStartEnrichers enriches every accounting record with the fields added by e, in order
+func SetStartEnrichers(e ...Enricher) StartOption {
+	return func(s *Start) {
+		s.enrichers = append(s.enrichers, e...)
+	}
+}
+
+// receivedKey is the context key of the time the accounting handler received a request
+type receivedKey struct{}
+
+// enrich returns the context of request with the metadata added by enrichers
+func enrich(request tq.Request, body tq.AcctRequest, received time.Time, enrichers []Enricher) context.Context {
+	ctx := context.WithValue(request.Context, receivedKey{}, received)
+	m := tq.AcctMetadata{}
+	for _, e := range enrichers {
+		e.Enrich(ctx, body, m)
+	}
+	if len(m) == 0 {
+		return request.Context
+	}
+	return tq.WithAcctMetadata(request.Context, m)
+}
+
+// ScopeEnricher adds the name of the scope that matched the device, as scope
+var ScopeEnricher = EnricherFunc(func(ctx context.Context, body tq.AcctRequest, m tq.AcctMetadata) {
+	if scope, _ := ctx.Value(tq.ContextScope).(string); scope != "" {
+		m["scope"] = scope
+	}
+})
+
+// LatencyEnricher adds the milliseconds the server took to handle the request before passing it to
+// the accounter, as latency_ms.  It includes the enrichers before it, so should be added last.
+var LatencyEnricher = EnricherFunc(func(ctx context.Context, body tq.AcctRequest, m tq.AcctMetadata) {
+	if received, ok := ctx.Value(receivedKey{}).(time.Time); ok {
+		m["latency_ms"] = strconv.FormatInt(time.Since(received).Milliseconds(), 10)
+	}
+})
+
+// NewInstanceEnricher adds id, the name of this server instance, as instance
+func NewInstanceEnricher(id string) Enricher {
+	return EnricherFunc(func(ctx context.Context, body tq.AcctRequest, m tq.AcctMetadata) {
+		m["instance"] = id
+	})
+}
+
+// resolver looks up the names of an address
+type resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// DeviceEnricherOption is the setter type for DeviceEnricher
+type DeviceEnricherOption func(d *DeviceEnricher)
+
+// SetDeviceEnricherResolver sets the resolver used for reverse lookups, the system resolver by default
+func SetDeviceEnricherResolver(r resolver) DeviceEnricherOption {
+	return func(d *DeviceEnricher) {
+		d.resolver = r
+	}
+}
+
+// SetDeviceEnricherTimeout sets how long a reverse lookup may take, 250ms by default.  Zero
+// disables reverse lookups, naming devices by their scope.
+func SetDeviceEnricherTimeout(t time.Duration) DeviceEnricherOption {
+	return func(d *DeviceEnricher) {
+		d.timeout = t
+	}
+}
+
+// SetDeviceEnricherCacheTTL sets how long the name of an address is cached, failed lookups
+// included, 10 minutes by default
+func SetDeviceEnricherCacheTTL(t time.Duration) DeviceEnricherOption {
+	return func(d *DeviceEnricher) {
+		d.ttl = t
+	}
+}
+
+// SetDeviceEnricherFeatureGate skips reverse lookups whenever g disallows enrichment, naming devices
+// that are not cached by their scope
+func SetDeviceEnricherFeatureGate(g featureGate) DeviceEnricherOption {
+	return func(d *DeviceEnricher) {
+		d.gate = g
+	}
+}
+
+// NewDeviceEnricher creates a DeviceEnricher
+func NewDeviceEnricher(l loggerProvider, opts ...DeviceEnricherOption) *DeviceEnricher {
+	d := &DeviceEnricher{
+		loggerProvider: l,
+		resolver:       net.DefaultResolver,
+		timeout:        250 * time.Millisecond,
+		ttl:            10 * time.Minute,
+		cache:          make(map[string]deviceName),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// deviceCacheSize is the most addresses a DeviceEnricher caches the names of
+const deviceCacheSize = 65536
+
+// deviceName is a cached reverse lookup
+type deviceName struct {
+	name    string
+	expires time.Time
+}
+
+// DeviceEnricher adds the hostname of the device that sent the record, as device.  Devices are
+// named by reverse dns, or by the name of their scope when the lookup fails.
+type DeviceEnricher struct {
+	loggerProvider
+	resolver resolver
+	gate     featureGate
+	timeout  time.Duration
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	cache map[string]deviceName
+}
+
+// Enrich implements Enricher
+func (d *DeviceEnricher) Enrich(ctx context.Context, body tq.AcctRequest, m tq.AcctMetadata) {
+	addr, _ := ctx.Value(tq.ContextConnRemoteAddr).(string)
+	if name := d.lookup(ctx, addr); name != "" {
+		m["device"] = name
+		return
+	}
+	if scope, _ := ctx.Value(tq.ContextScope).(string); scope != "" {
+		m["device"] = scope
+	}
+}
+
+// lookup returns the name of addr, empty if it has none
+func (d *DeviceEnricher) lookup(ctx context.Context, addr string) string {
+	if addr == "" || d.timeout <= 0 {
+		return ""
+	}
+	now := time.Now()
+	d.mu.Lock()
+	cached, ok := d.cache[addr]
+	d.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.name
+	}
+	if d.gate != nil && !d.gate.Allow(throttle.Enrichment) {
+		acctEnrichThrottled.Inc()
+		return ""
+	}
+	acctEnrichDNSLookup.Inc()
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	var name string
+	names, err := d.resolver.LookupAddr(ctx, addr)
+	if err != nil || len(names) == 0 {
+		acctEnrichDNSError.Inc()
+		d.Debugf(ctx, "unable to resolve the name of device [%v]; %v", addr, err)
+	} else {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ttl <= 0 {
+		return name
+	}
+	if len(d.cache) >= deviceCacheSize {
+		for a, c := range d.cache {
+			if now.After(c.expires) {
+				delete(d.cache, a)
+			}
+		}
+	}
+	if len(d.cache) < deviceCacheSize {
+		d.cache[addr] = deviceName{name: name, expires: now.Add(d.ttl)}
+	}
+	return name
+}
@@ -0,0 +1,120 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/facebookincubator/tacquito/cmds/server/throttle"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})      {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{})     {}
+func (mockLogger) Debugf(ctx context.Context, format string, args ...interface{})     {}
+func (mockLogger) Record(ctx context.Context, r map[string]string, obscure ...string) {}
+func (mockLogger) Set(ctx context.Context, fields map[string]string, keys ...tq.ContextKey) context.Context {
+	return ctx
+}
+
+// fakeResolver names the addresses in names, and counts its lookups
+type fakeResolver struct {
+	names   map[string]string
+	lookups int
+}
+
+func (r *fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	r.lookups++
+	if name, ok := r.names[addr]; ok {
+		return []string{name}, nil
+	}
+	return nil, fmt.Errorf("no ptr for [%v]", addr)
+}
+
+// fakeGate allows the features in allowed
+type fakeGate struct {
+	allowed map[throttle.Feature]bool
+}
+
+func (g *fakeGate) Allow(f throttle.Feature) bool {
+	return g.allowed[f]
+}
+
+func TestEnrich(t *testing.T) {
+	r := &fakeResolver{names: map[string]string{"192.0.2.1": "rtr1.example.com."}}
+	enrichers := []Enricher{
+		NewDeviceEnricher(mockLogger{}, SetDeviceEnricherResolver(r)),
+		ScopeEnricher,
+		NewInstanceEnricher("tacquito-1"),
+		LatencyEnricher,
+	}
+	request := func(addr string) tq.Request {
+		ctx := context.WithValue(context.Background(), tq.ContextConnRemoteAddr, addr)
+		return tq.Request{Context: context.WithValue(ctx, tq.ContextScope, "lab")}
+	}
+
+	m := tq.AcctMetadataFromContext(enrich(request("192.0.2.1"), tq.AcctRequest{}, time.Now(), enrichers))
+	assert.Equal(t, "rtr1.example.com", m["device"])
+	assert.Equal(t, "lab", m["scope"])
+	assert.Equal(t, "tacquito-1", m["instance"])
+	assert.Equal(t, "0", m["latency_ms"])
+
+	// devices without a name are named by their scope
+	m = tq.AcctMetadataFromContext(enrich(request("192.0.2.2"), tq.AcctRequest{}, time.Now(), enrichers))
+	assert.Equal(t, "lab", m["device"])
+
+	// names, and failed lookups, are cached
+	enrich(request("192.0.2.1"), tq.AcctRequest{}, time.Now(), enrichers)
+	enrich(request("192.0.2.2"), tq.AcctRequest{}, time.Now(), enrichers)
+	assert.Equal(t, 2, r.lookups)
+
+	// records without metadata keep their context
+	ctx := enrich(request("192.0.2.1"), tq.AcctRequest{}, time.Now(), nil)
+	assert.Nil(t, tq.AcctMetadataFromContext(ctx))
+
+	custom := EnricherFunc(func(ctx context.Context, body tq.AcctRequest, m tq.AcctMetadata) {
+		m["user"] = string(body.User)
+	})
+	m = tq.AcctMetadataFromContext(enrich(request("192.0.2.1"), tq.AcctRequest{User: "alice"}, time.Now(), []Enricher{custom}))
+	assert.Equal(t, tq.AcctMetadata{"user": "alice"}, m)
+}
+
+func TestDeviceEnricherThrottled(t *testing.T) {
+	r := &fakeResolver{names: map[string]string{"192.0.2.1": "rtr1.example.com.", "192.0.2.2": "rtr2.example.com."}}
+	gate := &fakeGate{allowed: map[throttle.Feature]bool{throttle.Enrichment: true}}
+	enrichers := []Enricher{NewDeviceEnricher(mockLogger{}, SetDeviceEnricherResolver(r), SetDeviceEnricherFeatureGate(gate))}
+	request := func(addr string) tq.Request {
+		ctx := context.WithValue(context.Background(), tq.ContextConnRemoteAddr, addr)
+		return tq.Request{Context: context.WithValue(ctx, tq.ContextScope, "lab")}
+	}
+
+	m := tq.AcctMetadataFromContext(enrich(request("192.0.2.1"), tq.AcctRequest{}, time.Now(), enrichers))
+	assert.Equal(t, "rtr1.example.com", m["device"])
+	assert.Equal(t, 1, r.lookups)
+
+	// while throttled, cached names are still used, but nothing is looked up or cached
+	gate.allowed[throttle.Enrichment] = false
+	m = tq.AcctMetadataFromContext(enrich(request("192.0.2.1"), tq.AcctRequest{}, time.Now(), enrichers))
+	assert.Equal(t, "rtr1.example.com", m["device"])
+	m = tq.AcctMetadataFromContext(enrich(request("192.0.2.2"), tq.AcctRequest{}, time.Now(), enrichers))
+	assert.Equal(t, "lab", m["device"])
+	assert.Equal(t, 1, r.lookups)
+
+	gate.allowed[throttle.Enrichment] = true
+	m = tq.AcctMetadataFromContext(enrich(request("192.0.2.2"), tq.AcctRequest{}, time.Now(), enrichers))
+	assert.Equal(t, "rtr2.example.com", m["device"])
+	assert.Equal(t, 2, r.lookups)
+}
@@ -0,0 +1,119 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// task is an accounting task that has started, but not yet stopped
+type task struct {
+	user     string
+	started  time.Time
+	lastSeen time.Time
+	// updates counts watchdog records that carried updated args
+	updates int
+}
+
+// taskKey identifies a task.  task_ids are only unique per client, so the client address is part of the key
+type taskKey struct {
+	remAddr string
+	taskID  string
+}
+
+// newTaskTracker creates a tracker.  Tasks running longer than longRunning are reported as long
+// running, and tasks not heard from for expiry are dropped.
+func newTaskTracker(longRunning, expiry time.Duration) *taskTracker {
+	return &taskTracker{tasks: make(map[taskKey]*task), longRunning: longRunning, expiry: expiry, now: time.Now}
+}
+
+// taskTracker follows accounting tasks from START, through WATCHDOG updates, to STOP, keyed by
+// task_id.  See https://datatracker.ietf.org/doc/html/rfc8907#section-7.2
+type taskTracker struct {
+	mu          sync.Mutex
+	tasks       map[taskKey]*task
+	longRunning time.Duration
+	expiry      time.Duration
+	lastSweep   time.Time
+	now         func() time.Time
+}
+
+// track records an accounting request from remAddr.  Requests without a task_id are not tracked.
+func (t *taskTracker) track(remAddr string, body tq.AcctRequest) {
+	id := body.Args.TaskID()
+	if id == "" {
+		acctTaskMissingID.Inc()
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	key := taskKey{remAddr: remAddr, taskID: id}
+	existing := t.tasks[key]
+	// flags are compared whole, AcctFlagWatchdogWithUpdate is the watchdog and start bits together
+	switch body.Flags {
+	case tq.AcctFlagStart:
+		acctTaskStart.Inc()
+		if existing != nil {
+			// the client reused a task_id without a stop, the rfc forbids this
+			acctTaskDuplicateStart.Inc()
+		}
+		t.tasks[key] = &task{user: string(body.User), started: now, lastSeen: now}
+	case tq.AcctFlagWatchdog, tq.AcctFlagWatchdogWithUpdate:
+		if body.Flags == tq.AcctFlagWatchdogWithUpdate {
+			acctTaskWatchdogUpdate.Inc()
+		} else {
+			acctTaskWatchdog.Inc()
+		}
+		if existing == nil {
+			// the start was missed, eg the server restarted.  the task has been running for an
+			// unknown time, so it is tracked from now
+			acctTaskUnknownWatchdog.Inc()
+			existing = &task{user: string(body.User), started: now}
+			t.tasks[key] = existing
+		}
+		existing.lastSeen = now
+		if body.Flags == tq.AcctFlagWatchdogWithUpdate {
+			existing.updates++
+		}
+	case tq.AcctFlagStop:
+		acctTaskStop.Inc()
+		if existing == nil {
+			acctTaskUnknownStop.Inc()
+			break
+		}
+		acctTaskDuration.Observe(now.Sub(existing.started).Seconds())
+		delete(t.tasks, key)
+	}
+	t.sweep(now)
+}
+
+// sweep drops expired tasks and refreshes the task gauges, at most once a minute.  callers must hold mu
+func (t *taskTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		acctTaskOutstanding.Set(float64(len(t.tasks)))
+		return
+	}
+	t.lastSweep = now
+	var longRunning int
+	for key, task := range t.tasks {
+		if t.expiry > 0 && now.Sub(task.lastSeen) > t.expiry {
+			acctTaskExpired.Inc()
+			delete(t.tasks, key)
+			continue
+		}
+		if t.longRunning > 0 && now.Sub(task.started) > t.longRunning {
+			longRunning++
+		}
+	}
+	acctTaskOutstanding.Set(float64(len(t.tasks)))
+	acctTaskLongRunning.Set(float64(longRunning))
+}
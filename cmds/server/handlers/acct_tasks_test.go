@@ -0,0 +1,61 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskTracker(t *testing.T) {
+	now := time.Unix(0, 0)
+	tracker := newTaskTracker(time.Hour, 2*time.Hour)
+	tracker.now = func() time.Time { return now }
+	record := func(remAddr string, flags tq.AcctRequestFlag, args ...string) {
+		var a tq.Args
+		a.Append(args...)
+		tracker.track(remAddr, *tq.NewAcctRequest(tq.SetAcctRequestFlag(flags), tq.SetAcctRequestUser("user"), tq.SetAcctRequestArgs(a)))
+	}
+
+	record("192.0.2.1", tq.AcctFlagStart, "task_id=1")
+	// the same task_id from another client is a different task
+	record("192.0.2.2", tq.AcctFlagStart, "task_id=1")
+	// no task_id, not tracked
+	record("192.0.2.1", tq.AcctFlagStart, "service=shell")
+	assert.Len(t, tracker.tasks, 2)
+
+	now = now.Add(30 * time.Minute)
+	record("192.0.2.1", tq.AcctFlagWatchdog, "task_id=1")
+	record("192.0.2.1", tq.AcctFlagWatchdogWithUpdate, "task_id=1", "elapsed_time=1800")
+	task := tracker.tasks[taskKey{remAddr: "192.0.2.1", taskID: "1"}]
+	if assert.NotNil(t, task) {
+		assert.Equal(t, now, task.lastSeen)
+		assert.Equal(t, time.Unix(0, 0), task.started)
+		assert.Equal(t, 1, task.updates)
+	}
+
+	// a watchdog for a task we never saw start is tracked from now
+	record("192.0.2.3", tq.AcctFlagWatchdog, "task_id=7")
+	assert.Len(t, tracker.tasks, 3)
+
+	record("192.0.2.2", tq.AcctFlagStop, "task_id=1")
+	record("192.0.2.2", tq.AcctFlagStop, "task_id=1")
+	assert.Len(t, tracker.tasks, 2)
+
+	// 192.0.2.1 keeps sending watchdogs, 192.0.2.3 goes silent and expires
+	now = now.Add(90 * time.Minute)
+	record("192.0.2.1", tq.AcctFlagWatchdog, "task_id=1")
+	now = now.Add(90 * time.Minute)
+	record("192.0.2.1", tq.AcctFlagWatchdog, "task_id=1")
+	assert.Len(t, tracker.tasks, 1)
+	assert.Contains(t, tracker.tasks, taskKey{remAddr: "192.0.2.1", taskID: "1"})
+}
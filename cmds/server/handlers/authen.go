@@ -15,7 +15,7 @@ import (
 
 // NewAuthenticateStart ...
 func NewAuthenticateStart(l loggerProvider, c configProvider) *AuthenticateStart {
-	return &AuthenticateStart{loggerProvider: l, configProvider: c, recorderWriter: newPacketLogger(l)}
+	return &AuthenticateStart{loggerProvider: l, configProvider: c, recorderWriter: newPacketLogger(l), actions: defaultActionPolicies(), ascii: defaultASCIIOptions()}
 }
 
 // AuthenticateStart is the main entry point for incoming authenstart packets
@@ -23,6 +23,10 @@ type AuthenticateStart struct {
 	loggerProvider
 	configProvider
 	recorderWriter
+	// actions answers the sendauth and chpass requests the server does not implement
+	actions actionPolicies
+	// ascii are the prompts and attempt limit of ascii logins
+	ascii asciiOptions
 }
 
 // authenActionStart is a function map that determines which authenticate handler to call given
@@ -51,22 +55,39 @@ func (a *AuthenticateStart) Handle(response tq.Response, request tq.Request) {
 		return
 	}
 
+	ascii := NewAuthenticateASCII(a.loggerProvider, a.configProvider, string(body.User))
+	ascii.options = a.ascii
+	chpass := NewAuthenticateChpass(a.loggerProvider, a.configProvider, string(body.User))
+	chpass.options = a.ascii
+	if policy, ok := a.actions[tq.AuthenActionPass]; ok {
+		chpass.policy = policy
+	}
 	authenRouter := map[authenActionStart]tq.Handler{
 		// 5.4.2.6.  Enable Requests
-		{action: tq.AuthenActionLogin, service: tq.AuthenServiceEnable, minorVersion: tq.MinorVersionOne}: NewAuthenticateASCII(a.loggerProvider, a.configProvider, string(body.User)),
+		{action: tq.AuthenActionLogin, service: tq.AuthenServiceEnable}: NewAuthenticateEnable(a.loggerProvider, a.configProvider, string(body.User)),
 		// 5.4.2.1.  ASCII Login Requests
-		{action: tq.AuthenActionLogin, atype: tq.AuthenTypeASCII, minorVersion: tq.MinorVersionDefault}: NewAuthenticateASCII(a.loggerProvider, a.configProvider, string(body.User)),
+		{action: tq.AuthenActionLogin, atype: tq.AuthenTypeASCII, minorVersion: tq.MinorVersionDefault}: ascii,
+		// 5.4.2.4.  ASCII Change Password Requests
+		{action: tq.AuthenActionPass, atype: tq.AuthenTypeASCII, minorVersion: tq.MinorVersionDefault}: chpass,
 		// 5.4.2.2.  PAP Login Requests
-		{action: tq.AuthenActionLogin, atype: tq.AuthenTypePAP, minorVersion: tq.MinorVersionOne}:      NewAuthenticatePAP(a.loggerProvider, a.configProvider),
-		{action: tq.AuthenActionLogin, atype: tq.AuthenTypeCHAP, minorVersion: tq.MinorVersionOne}:     nil, //AuthenCHAPStart not implemented
+		{action: tq.AuthenActionLogin, atype: tq.AuthenTypePAP, minorVersion: tq.MinorVersionOne}: NewAuthenticatePAP(a.loggerProvider, a.configProvider),
+		// 5.4.2.3.  CHAP Login Requests
+		{action: tq.AuthenActionLogin, atype: tq.AuthenTypeCHAP, minorVersion: tq.MinorVersionOne}:     NewAuthenticateCHAP(a.loggerProvider, a.configProvider),
 		{action: tq.AuthenActionLogin, atype: tq.AuthenTypeMSCHAP, minorVersion: tq.MinorVersionOne}:   nil, //AuthenMSCHAPStart not implemented
 		{action: tq.AuthenActionLogin, atype: tq.AuthenTypeMSCHAPV2, minorVersion: tq.MinorVersionOne}: nil, //AuthenMSCHAPV2Start not implemented
 	}
 	key := authenActionStart{action: body.Action, atype: body.Type, minorVersion: request.Header.Version.MinorVersion}
+	if body.Service == tq.AuthenServiceEnable {
+		// enable requests are routed by service, whatever their type or minor version
+		key = authenActionStart{action: body.Action, service: body.Service}
+	}
 	if h := authenRouter[key]; h != nil {
 		h.Handle(response, request)
 		return
 	}
+	if a.reject(response, request, body) {
+		return
+	}
 	// we don't know what this packet is, so we log everything in it. this could log passwords but w/o knowing what this
 	// packet was, we can't effectively omit fields, so we guess.  user-msg may contain a password.
 	a.Record(request.Context, request.Fields(tq.ContextConnRemoteAddr, tq.ContextConnLocalAddr), "user-msg")
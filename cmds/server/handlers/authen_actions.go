@@ -0,0 +1,91 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"fmt"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// actionPolicy is how authentication start packets of an action the server does not implement
+// are answered
+type actionPolicy struct {
+	status tq.AuthenStatus
+	msg    string
+}
+
+// actionPolicies are the policies of sendauth and chpass requests
+type actionPolicies map[tq.AuthenAction]actionPolicy
+
+// defaultActionPolicies fail sendauth and chpass requests.  rfc8907 section 10.5.3 recommends
+// against outbound authentication, which hands a client a secret to log in to another system, and
+// section 5.4.2.8 leaves password changes to the server, which has no password store to change.
+// https://datatracker.ietf.org/doc/html/rfc8907#section-10.5.3
+func defaultActionPolicies() actionPolicies {
+	return actionPolicies{
+		tq.AuthenActionSendAuth: {status: tq.AuthenStatusFail, msg: "outbound authentication is not permitted"},
+		tq.AuthenActionPass:     {status: tq.AuthenStatusFail, msg: "password changes are not supported"},
+	}
+}
+
+// newActionPolicies parses the sendauth and chpass policies from Start handler options
+//
+// sendauth, chpass - fail, the default, or error, the status replied to the request
+// sendauth_msg, chpass_msg - the server msg of the reply
+func newActionPolicies(options map[string]string) (actionPolicies, error) {
+	p := defaultActionPolicies()
+	for _, o := range []struct {
+		name   string
+		action tq.AuthenAction
+	}{{"sendauth", tq.AuthenActionSendAuth}, {"chpass", tq.AuthenActionPass}} {
+		policy := p[o.action]
+		switch v := options[o.name]; v {
+		case "", "fail":
+		case "error":
+			policy.status = tq.AuthenStatusError
+		default:
+			return defaultActionPolicies(), fmt.Errorf("bad %v policy [%v], must be fail or error", o.name, v)
+		}
+		if msg, ok := options[o.name+"_msg"]; ok {
+			policy.msg = msg
+		}
+		p[o.action] = policy
+	}
+	return p, nil
+}
+
+// counter is the metric of requests answered by the policy of action
+func (p actionPolicies) counter(action tq.AuthenAction) prometheus.Counter {
+	if action == tq.AuthenActionSendAuth {
+		return authenStartSendAuthRejected
+	}
+	return authenStartChpassRejected
+}
+
+// reject answers a start packet of action with its policy.  It returns false if action has none.
+func (a *AuthenticateStart) reject(response tq.Response, request tq.Request, body tq.AuthenStart) bool {
+	policy, ok := a.actions[body.Action]
+	if !ok {
+		return false
+	}
+	a.actions.counter(body.Action).Inc()
+	// data may carry a password
+	a.Record(request.Context, request.Fields(tq.ContextConnRemoteAddr, tq.ContextConnLocalAddr), "data")
+	a.Infof(request.Context, "[%v] rejecting %v request for user [%v] from rem-addr [%v] with %v", request.Header.SessionID, body.Action, body.User, body.RemAddr, policy.status)
+	response.ReplyWithContext(
+		request.Context,
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(policy.status),
+			tq.SetAuthenReplyServerMsg(policy.msg),
+		),
+		a.recorderWriter,
+	)
+	return true
+}
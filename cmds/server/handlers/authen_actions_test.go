@@ -0,0 +1,36 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionPolicies(t *testing.T) {
+	p, err := newActionPolicies(map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, defaultActionPolicies(), p)
+
+	p, err = newActionPolicies(map[string]string{"sendauth": "error", "chpass": "fail", "chpass_msg": "change your password at https://example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, actionPolicy{status: tq.AuthenStatusError, msg: "outbound authentication is not permitted"}, p[tq.AuthenActionSendAuth])
+	assert.Equal(t, actionPolicy{status: tq.AuthenStatusFail, msg: "change your password at https://example.com"}, p[tq.AuthenActionPass])
+	_, ok := p[tq.AuthenActionLogin]
+	assert.False(t, ok)
+
+	for _, bad := range []map[string]string{{"sendauth": "pass"}, {"chpass": "allow"}} {
+		p, err = newActionPolicies(bad)
+		assert.Error(t, err, bad)
+		assert.Equal(t, defaultActionPolicies(), p)
+	}
+}
@@ -8,14 +8,16 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 
 	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
 )
 
 // NewAuthenticateASCII ...
 func NewAuthenticateASCII(l loggerProvider, c configProvider, username string) *AuthenticateASCII {
-	return &AuthenticateASCII{loggerProvider: l, configProvider: c, username: username, recorderWriter: newPacketLogger(l)}
+	return &AuthenticateASCII{loggerProvider: l, configProvider: c, username: username, recorderWriter: newPacketLogger(l), options: defaultASCIIOptions()}
 }
 
 // AuthenticateASCII is the main entry for ascii flows.  the ascii flows are quite complex compared to some of the
@@ -26,6 +28,14 @@ type AuthenticateASCII struct {
 	recorderWriter
 	configProvider
 	username string
+	// options are the prompts and attempt limit of the login
+	options asciiOptions
+	// promptUser is set if the client did not send a username up front, a retry prompts for it again
+	promptUser bool
+	// attempts is the number of failed attempts so far
+	attempts int
+	// expired if set, changes the password of a user who must change it once the login passes
+	expired *AuthenticateChpass
 }
 
 // Handle is the main entry for ascii flows.
@@ -38,11 +48,12 @@ func (a *AuthenticateASCII) Handle(response tq.Response, request tq.Request) {
 	if a.username == "" {
 		// client didn't send us a username to start with
 		authenASCIIHandleNeedUsername.Inc()
+		a.promptUser = true
 		response.Next(tq.HandlerFunc(a.getUsername))
 		response.Reply(
 			tq.NewAuthenReply(
 				tq.SetAuthenReplyStatus(tq.AuthenStatusGetUser),
-				tq.SetAuthenReplyServerMsg("username:"),
+				tq.SetAuthenReplyServerMsg(a.options.greeting()),
 			),
 		)
 		return
@@ -95,7 +106,7 @@ func (a *AuthenticateASCII) getUsername(response tq.Response, request tq.Request
 	response.Reply(
 		tq.NewAuthenReply(
 			tq.SetAuthenReplyStatus(tq.AuthenStatusGetPass),
-			tq.SetAuthenReplyServerMsg("password:"),
+			tq.SetAuthenReplyServerMsg(a.options.passwordPrompt),
 			tq.SetAuthenReplyFlag(tq.AuthenReplyFlagNoEcho),
 		),
 	)
@@ -108,6 +119,8 @@ func (a *AuthenticateASCII) getPassword(response tq.Response, request tq.Request
 		response.ReplyWithContext(request.Context, reply, a.recorderWriter)
 		return
 	}
+	// failures prompt again until the user is out of attempts
+	response = tq.WrapResponse(&asciiResponse{Response: response, a: a}, response)
 	var body tq.AuthenContinue
 	if err := tq.Unmarshal(request.Body, &body); err != nil {
 		authenASCIIGetPasswordUnexpectedPacket.Inc()
@@ -154,6 +167,12 @@ func (a *AuthenticateASCII) getPassword(response tq.Response, request tq.Request
 		)
 		return
 	}
+	a.expired = nil
+	if w, ok := c.Authenticate.(config.PasswordWriter); ok && w.MustChangePassword(request.Context, a.username) {
+		a.expired = NewAuthenticateChpass(a.loggerProvider, a.configProvider, a.username)
+		a.expired.options = a.options
+		a.expired.old = string(body.UserMessage)
+	}
 	NewResponseLogger(a.Context(), a.loggerProvider, c.Authenticate).Handle(response, request)
 }
 
@@ -161,6 +180,12 @@ func (a *AuthenticateASCII) getPassword(response tq.Response, request tq.Request
 // The rfc stipulates that this may come at anytime.
 // https://datatracker.ietf.org/doc/html/rfc8907#section-5.4.3
 func (a *AuthenticateASCII) authenticateContinueStop(request tq.Request) *tq.AuthenReply {
+	return authenticateContinueStop(request)
+}
+
+// authenticateContinueStop returns the reply ending an ascii flow the client aborted, nil if it
+// did not
+func authenticateContinueStop(request tq.Request) *tq.AuthenReply {
 	var body tq.AuthenContinue
 	if err := tq.Unmarshal(request.Body, &body); err != nil {
 		// not a continue packet, ignore processing here only, later processing still applies
@@ -175,3 +200,71 @@ func (a *AuthenticateASCII) authenticateContinueStop(request tq.Request) *tq.Aut
 	}
 	return nil
 }
+
+// retry returns the prompt for the username, if the client was asked for it, or the password to send
+// instead of the failed attempt reply, and hands the answer to the matching handler.  It returns nil
+// if reply is not a failure or the user is out of attempts.
+func (a *AuthenticateASCII) retry(response tq.Response, reply *tq.AuthenReply) *tq.AuthenReply {
+	if reply.Status != tq.AuthenStatusFail {
+		return nil
+	}
+	a.attempts++
+	if a.attempts >= a.options.maxAttempts {
+		return nil
+	}
+	authenASCIIRetry.Inc()
+	if r, ok := response.(failedAttemptRecorder); ok {
+		r.failedAttempt()
+	}
+	status, msg, next := tq.AuthenStatusGetPass, a.options.passwordPrompt, a.getPassword
+	if a.promptUser {
+		a.username = ""
+		status, msg, next = tq.AuthenStatusGetUser, a.options.userPrompt, a.getUsername
+	}
+	if reply.ServerMsg != "" {
+		msg = string(reply.ServerMsg) + "\n" + msg
+	}
+	opts := []tq.AuthenReplyOption{tq.SetAuthenReplyStatus(status), tq.SetAuthenReplyServerMsg(msg)}
+	if status == tq.AuthenStatusGetPass {
+		opts = append(opts, tq.SetAuthenReplyFlag(tq.AuthenReplyFlagNoEcho))
+	}
+	response.Next(tq.HandlerFunc(next))
+	return tq.NewAuthenReply(opts...)
+}
+
+// intercept returns the reply to send instead of reply, nil to send reply.  Failed attempts prompt
+// again while the user has attempts left, and users who must change their password are prompted
+// for a new one once they pass.
+func (a *AuthenticateASCII) intercept(response tq.Response, reply *tq.AuthenReply) *tq.AuthenReply {
+	if reply.Status == tq.AuthenStatusPass && a.expired != nil {
+		authenChpassExpired.Inc()
+		return a.expired.promptNew(response, "your password has expired\n")
+	}
+	return a.retry(response, reply)
+}
+
+// asciiResponse intercepts the password replies of an ascii login, see intercept
+type asciiResponse struct {
+	tq.Response
+	a *AuthenticateASCII
+}
+
+// Reply implements tq.Response
+func (r *asciiResponse) Reply(v tq.EncoderDecoder) (int, error) {
+	if reply, ok := v.(*tq.AuthenReply); ok {
+		if prompt := r.a.intercept(r.Response, reply); prompt != nil {
+			return r.Response.Reply(prompt)
+		}
+	}
+	return r.Response.Reply(v)
+}
+
+// ReplyWithContext implements tq.Response
+func (r *asciiResponse) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writers ...tq.Writer) (int, error) {
+	if reply, ok := v.(*tq.AuthenReply); ok {
+		if prompt := r.a.intercept(r.Response, reply); prompt != nil {
+			return r.Response.ReplyWithContext(ctx, prompt, writers...)
+		}
+	}
+	return r.Response.ReplyWithContext(ctx, v, writers...)
+}
@@ -0,0 +1,60 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// asciiOptions are the prompts and attempt limit of ascii logins
+type asciiOptions struct {
+	// banner is shown above the first username prompt
+	banner string
+	// userPrompt and passwordPrompt are the server msgs of the GetUser and GetPass replies
+	userPrompt, passwordPrompt string
+	// maxAttempts is how many passwords a user may try before the login fails
+	maxAttempts int
+}
+
+// defaultASCIIOptions prompt for the username and password once, without a banner
+func defaultASCIIOptions() asciiOptions {
+	return asciiOptions{userPrompt: "username:", passwordPrompt: "password:", maxAttempts: 1}
+}
+
+// newASCIIOptions parses the ascii login options from Start handler options
+//
+// ascii_banner - shown with the first username prompt
+// ascii_user_prompt, ascii_password_prompt - the username and password prompts
+// ascii_max_attempts - how many passwords may be tried in one login, 1 by default
+func newASCIIOptions(options map[string]string) (asciiOptions, error) {
+	o := defaultASCIIOptions()
+	o.banner = options["ascii_banner"]
+	if v, ok := options["ascii_user_prompt"]; ok {
+		o.userPrompt = v
+	}
+	if v, ok := options["ascii_password_prompt"]; ok {
+		o.passwordPrompt = v
+	}
+	if v, ok := options["ascii_max_attempts"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return defaultASCIIOptions(), fmt.Errorf("bad ascii_max_attempts [%v], must be a positive integer", v)
+		}
+		o.maxAttempts = n
+	}
+	return o, nil
+}
+
+// greeting is the server msg of the first username prompt
+func (o asciiOptions) greeting() string {
+	if o.banner == "" {
+		return o.userPrompt
+	}
+	return o.banner + "\n" + o.userPrompt
+}
@@ -0,0 +1,33 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestASCIIOptions(t *testing.T) {
+	o, err := newASCIIOptions(map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, defaultASCIIOptions(), o)
+	assert.Equal(t, "username:", o.greeting())
+
+	o, err = newASCIIOptions(map[string]string{"ascii_banner": "authorized access only", "ascii_user_prompt": "login: ", "ascii_password_prompt": "Password: ", "ascii_max_attempts": "3"})
+	require.NoError(t, err)
+	assert.Equal(t, asciiOptions{banner: "authorized access only", userPrompt: "login: ", passwordPrompt: "Password: ", maxAttempts: 3}, o)
+	assert.Equal(t, "authorized access only\nlogin: ", o.greeting())
+
+	for _, bad := range []map[string]string{{"ascii_max_attempts": "0"}, {"ascii_max_attempts": "many"}} {
+		o, err = newASCIIOptions(bad)
+		assert.Error(t, err, bad)
+		assert.Equal(t, defaultASCIIOptions(), o)
+	}
+}
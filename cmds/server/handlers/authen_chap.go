@@ -0,0 +1,96 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"fmt"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+)
+
+// NewAuthenticateCHAP creates a scoped handler for CHAP authentication exchanges
+func NewAuthenticateCHAP(l loggerProvider, c configProvider) *AuthenticateCHAP {
+	return &AuthenticateCHAP{loggerProvider: l, configProvider: c, recorderWriter: newPacketLogger(l)}
+}
+
+// AuthenticateCHAP is the main entry for chap authenticate exchanges.  The ppp id, challenge
+// and response are carried in the data field of a single AuthenStart.  Verification is left to
+// the user's authenticator, which must have access to a plaintext password or proxy the exchange.
+// See https://datatracker.ietf.org/doc/html/rfc8907#section-5.4.2.3
+type AuthenticateCHAP struct {
+	loggerProvider
+	configProvider
+	recorderWriter
+}
+
+// Handle requires that the username and chap data be present in a AuthenStart packet.
+func (a *AuthenticateCHAP) Handle(response tq.Response, request tq.Request) {
+	authenStartHandleCHAP.Inc()
+	var body tq.AuthenStart
+	if err := tq.Unmarshal(request.Body, &body); err != nil {
+		authenCHAPHandleUnexpectedPacket.Inc()
+		authenCHAPHandleAuthenError.Inc()
+		response.ReplyWithContext(
+			request.Context,
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("unable to decode authenticate start packet"),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	// missing username
+	if len(body.User) == 0 {
+		a.Debugf(request.Context, "[%v] username is missing for rem-addr: [%v]", request.Header.SessionID, body.RemAddr)
+		authenCHAPHandleAuthenError.Inc()
+		authenCHAPHandleMissingUsername.Inc()
+		response.ReplyWithContext(
+			request.Context,
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("missing username"),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	a.RecordCtx(&request, tq.ContextUser, tq.ContextRemoteAddr, tq.ContextPort, tq.ContextPrivLvl)
+	// malformed id, challenge and response
+	if _, err := authenticators.ParseCHAP([]byte(body.Data)); err != nil {
+		a.Debugf(request.Context, "[%v] username [%v] sent malformed chap data for rem-addr: [%v]; %v", request.Header.SessionID, body.User, body.RemAddr, err)
+		authenCHAPHandleMalformed.Inc()
+		authenCHAPHandleAuthenError.Inc()
+		response.ReplyWithContext(
+			a.Context(),
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+				tq.SetAuthenReplyServerMsg("malformed chap data"),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	c := a.GetUser(string(body.User))
+	if c == nil {
+		a.Debugf(request.Context, "[%v] user [%v] does not have an authenticator associated", request.Header.SessionID, body.User)
+		authenCHAPHandleAuthenFail.Inc()
+		authenCHAPHandleAuthenticatorNil.Inc()
+		response.ReplyWithContext(
+			a.Context(),
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+				tq.SetAuthenReplyServerMsg(fmt.Sprintf("authentication denied [%s]", string(body.User))),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	NewResponseLogger(a.Context(), a.loggerProvider, c.Authenticate).Handle(response, request)
+}
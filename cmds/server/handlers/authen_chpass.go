@@ -0,0 +1,214 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// NewAuthenticateChpass ...
+func NewAuthenticateChpass(l loggerProvider, c configProvider, username string) *AuthenticateChpass {
+	return &AuthenticateChpass{
+		loggerProvider: l,
+		configProvider: c,
+		recorderWriter: newPacketLogger(l),
+		username:       username,
+		options:        defaultASCIIOptions(),
+		policy:         defaultActionPolicies()[tq.AuthenActionPass],
+	}
+}
+
+// AuthenticateChpass walks a user through an ascii password change, prompting for the old password
+// and the new one twice, and changes it with the user's authenticator if it is a
+// config.PasswordWriter.  Users whose authenticator is not are answered with the chpass policy.
+// https://datatracker.ietf.org/doc/html/rfc8907#section-5.4.2.4
+type AuthenticateChpass struct {
+	loggerProvider
+	recorderWriter
+	configProvider
+	username string
+	// options are the ascii login prompts
+	options asciiOptions
+	// policy answers users whose authenticator cannot change passwords
+	policy actionPolicy
+	// old and new are the passwords collected so far
+	old, new string
+}
+
+// Handle is the entry point of ascii chpass requests
+func (a *AuthenticateChpass) Handle(response tq.Response, request tq.Request) {
+	a.RecordCtx(&request, tq.ContextUser, tq.ContextRemoteAddr, tq.ContextPort, tq.ContextPrivLvl)
+	if a.username == "" {
+		response.Next(tq.HandlerFunc(a.getUsername))
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusGetUser),
+				tq.SetAuthenReplyServerMsg(a.options.greeting()),
+			),
+		)
+		return
+	}
+	a.promptOld(response)
+}
+
+// getUsername collects a username
+func (a *AuthenticateChpass) getUsername(response tq.Response, request tq.Request) {
+	username, ok := a.userMessage(response, request)
+	if !ok {
+		return
+	}
+	if username == "" {
+		authenChpassError.Inc()
+		response.ReplyWithContext(
+			request.Context,
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("missing UserMessage, containing the username"),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	a.username = username
+	a.promptOld(response)
+}
+
+// promptOld asks for the current password.  rfc8907 collects it with GetData, and the new password
+// with GetPass.
+func (a *AuthenticateChpass) promptOld(response tq.Response) {
+	response.Next(tq.HandlerFunc(a.getOld))
+	response.Reply(
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusGetData),
+			tq.SetAuthenReplyServerMsg("old password:"),
+			tq.SetAuthenReplyFlag(tq.AuthenReplyFlagNoEcho),
+		),
+	)
+}
+
+// getOld collects the current password
+func (a *AuthenticateChpass) getOld(response tq.Response, request tq.Request) {
+	old, ok := a.userMessage(response, request)
+	if !ok {
+		return
+	}
+	a.old = old
+	response.Reply(a.promptNew(response, ""))
+}
+
+// promptNew returns the prompt for the new password, preceded by msg if set, and hands the answer
+// to getNew
+func (a *AuthenticateChpass) promptNew(response tq.Response, msg string) *tq.AuthenReply {
+	response.Next(tq.HandlerFunc(a.getNew))
+	return tq.NewAuthenReply(
+		tq.SetAuthenReplyStatus(tq.AuthenStatusGetPass),
+		tq.SetAuthenReplyServerMsg(msg+"new password:"),
+		tq.SetAuthenReplyFlag(tq.AuthenReplyFlagNoEcho),
+	)
+}
+
+// getNew collects the new password
+func (a *AuthenticateChpass) getNew(response tq.Response, request tq.Request) {
+	password, ok := a.userMessage(response, request)
+	if !ok {
+		return
+	}
+	if password == "" {
+		authenChpassFail.Inc()
+		a.fail(response, request, "the new password must not be empty")
+		return
+	}
+	a.new = password
+	response.Next(tq.HandlerFunc(a.getConfirm))
+	response.Reply(
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusGetPass),
+			tq.SetAuthenReplyServerMsg("confirm new password:"),
+			tq.SetAuthenReplyFlag(tq.AuthenReplyFlagNoEcho),
+		),
+	)
+}
+
+// getConfirm collects the new password again, and changes the password if both match
+func (a *AuthenticateChpass) getConfirm(response tq.Response, request tq.Request) {
+	password, ok := a.userMessage(response, request)
+	if !ok {
+		return
+	}
+	if password != a.new {
+		authenChpassMismatch.Inc()
+		a.fail(response, request, "new passwords do not match")
+		return
+	}
+	var w config.PasswordWriter
+	if c := a.GetUser(a.username); c != nil {
+		w, _ = c.Authenticate.(config.PasswordWriter)
+	}
+	if w == nil {
+		authenStartChpassRejected.Inc()
+		a.Infof(request.Context, "[%v] user [%v] does not have an authenticator that changes passwords", request.Header.SessionID, a.username)
+		response.ReplyWithContext(
+			request.Context,
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(a.policy.status),
+				tq.SetAuthenReplyServerMsg(a.policy.msg),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	if err := w.ChangePassword(request.Context, a.username, a.old, a.new); err != nil {
+		authenChpassFail.Inc()
+		a.Errorf(request.Context, "[%v] unable to change the password of user [%v]; %v", request.Header.SessionID, a.username, err)
+		a.fail(response, request, "password change failed")
+		return
+	}
+	authenChpassChanged.Inc()
+	a.Infof(request.Context, "[%v] changed the password of user [%v]", request.Header.SessionID, a.username)
+	response.ReplyWithContext(
+		request.Context,
+		tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusPass)),
+		a.recorderWriter,
+	)
+}
+
+// userMessage returns the user msg of the continue packet answering a prompt.  ok is false if the
+// client aborted or sent another packet, which has been replied to.
+func (a *AuthenticateChpass) userMessage(response tq.Response, request tq.Request) (string, bool) {
+	if reply := authenticateContinueStop(request); reply != nil {
+		response.ReplyWithContext(request.Context, reply, a.recorderWriter)
+		return "", false
+	}
+	var body tq.AuthenContinue
+	if err := tq.Unmarshal(request.Body, &body); err != nil {
+		authenChpassError.Inc()
+		response.ReplyWithContext(
+			request.Context,
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("expected authenticate continue packet"),
+			),
+			a.recorderWriter,
+		)
+		return "", false
+	}
+	return string(body.UserMessage), true
+}
+
+// fail ends the change with msg
+func (a *AuthenticateChpass) fail(response tq.Response, request tq.Request, msg string) {
+	response.ReplyWithContext(
+		request.Context,
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+			tq.SetAuthenReplyServerMsg(msg),
+		),
+		a.recorderWriter,
+	)
+}
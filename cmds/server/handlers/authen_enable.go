@@ -0,0 +1,184 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"fmt"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// NewAuthenticateEnable creates a scoped handler for enable requests
+func NewAuthenticateEnable(l loggerProvider, c configProvider, username string) *AuthenticateEnable {
+	return &AuthenticateEnable{loggerProvider: l, configProvider: c, username: username, recorderWriter: newPacketLogger(l)}
+}
+
+// AuthenticateEnable handles privilege escalation requests, see
+// https://datatracker.ietf.org/doc/html/rfc8907#section-5.4.2.6.  The enable password is checked
+// by the user's enable authenticator, which falls back to the login authenticator if the user has
+// no distinct enable secret.  PAP enable requests carry the password in the start packet, all other
+// types are prompted for it with AuthenStatusGetPass.
+type AuthenticateEnable struct {
+	loggerProvider
+	recorderWriter
+	configProvider
+	username string
+}
+
+// Handle is the main entry for enable flows
+func (a *AuthenticateEnable) Handle(response tq.Response, request tq.Request) {
+	authenStartHandleEnable.Inc()
+	var body tq.AuthenStart
+	if err := tq.Unmarshal(request.Body, &body); err != nil {
+		authenEnableHandleUnexpectedPacket.Inc()
+		response.ReplyWithContext(
+			request.Context,
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("unable to decode authenticate start packet"),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	a.RecordCtx(&request, tq.ContextUser, tq.ContextRemoteAddr, tq.ContextPort, tq.ContextPrivLvl)
+	if body.Type == tq.AuthenTypePAP && a.username != "" && len(body.Data) > 0 {
+		a.authenticate(response, request)
+		return
+	}
+	if a.username == "" {
+		authenEnableHandleNeedUsername.Inc()
+		response.Next(tq.HandlerFunc(a.getUsername))
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusGetUser),
+				tq.SetAuthenReplyServerMsg("username:"),
+			),
+		)
+		return
+	}
+	a.getPassword(response)
+}
+
+// getUsername collects a username
+func (a *AuthenticateEnable) getUsername(response tq.Response, request tq.Request) {
+	if reply := a.authenticateContinueStop(request); reply != nil {
+		response.ReplyWithContext(request.Context, reply, a.recorderWriter)
+		return
+	}
+	var body tq.AuthenContinue
+	if err := tq.Unmarshal(request.Body, &body); err != nil {
+		authenEnableHandleUnexpectedPacket.Inc()
+		response.ReplyWithContext(
+			a.Context(),
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("expected authenticate continue packet for AuthenStatusGetUser"),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	if len(body.UserMessage) == 0 {
+		authenEnableHandleMissingUsername.Inc()
+		response.ReplyWithContext(
+			a.Context(),
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("missing UserMessage, containing the username"),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	a.username = string(body.UserMessage)
+	a.RecordCtx(&request, tq.ContextUserMsg)
+	a.getPassword(response)
+}
+
+// getPassword prompts for the enable password
+func (a *AuthenticateEnable) getPassword(response tq.Response) {
+	response.Next(tq.HandlerFunc(a.checkPassword))
+	response.Reply(
+		tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusGetPass),
+			tq.SetAuthenReplyServerMsg("enable password:"),
+			tq.SetAuthenReplyFlag(tq.AuthenReplyFlagNoEcho),
+		),
+	)
+}
+
+// checkPassword receives the enable password in an authenticate continue packet
+func (a *AuthenticateEnable) checkPassword(response tq.Response, request tq.Request) {
+	if reply := a.authenticateContinueStop(request); reply != nil {
+		response.ReplyWithContext(request.Context, reply, a.recorderWriter)
+		return
+	}
+	var body tq.AuthenContinue
+	if err := tq.Unmarshal(request.Body, &body); err != nil {
+		authenEnableHandleUnexpectedPacket.Inc()
+		response.ReplyWithContext(
+			request.Context,
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusError),
+				tq.SetAuthenReplyServerMsg("expected authenticate continue packet for AuthenStatusGetPass"),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	if len(body.UserMessage) == 0 {
+		authenEnableHandleMissingPassword.Inc()
+		response.ReplyWithContext(
+			a.Context(),
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+				tq.SetAuthenReplyServerMsg("unknown username or password"),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	a.authenticate(response, request)
+}
+
+// authenticate hands the request holding the enable password to the user's enable authenticator
+func (a *AuthenticateEnable) authenticate(response tq.Response, request tq.Request) {
+	c := a.GetUser(a.username)
+	if c == nil || c.Enable == nil {
+		a.Debugf(request.Context, "[%v] user [%v] does not have an enable authenticator associated", request.Header.SessionID, a.username)
+		authenEnableHandleAuthenticatorNil.Inc()
+		response.ReplyWithContext(
+			a.Context(),
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+				tq.SetAuthenReplyServerMsg(fmt.Sprintf("enable denied [%s]", a.username)),
+			),
+			a.recorderWriter,
+		)
+		return
+	}
+	NewResponseLogger(a.Context(), a.loggerProvider, c.Enable).Handle(response, request)
+}
+
+// authenticateContinueStop looks for the abort flag, which the client may send at any time.
+// https://datatracker.ietf.org/doc/html/rfc8907#section-5.4.3
+func (a *AuthenticateEnable) authenticateContinueStop(request tq.Request) *tq.AuthenReply {
+	var body tq.AuthenContinue
+	if err := tq.Unmarshal(request.Body, &body); err != nil {
+		return nil
+	}
+	if body.Flags.Has(tq.AuthenContinueFlagAbort) {
+		authenEnableContinueStop.Inc()
+		return tq.NewAuthenReply(
+			tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+			tq.SetAuthenReplyServerMsg("ending per client request flag AuthenContinueFlagAbort"),
+		)
+	}
+	return nil
+}
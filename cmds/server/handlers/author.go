@@ -8,6 +8,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 
 	tq "github.com/facebookincubator/tacquito"
@@ -23,12 +24,14 @@ type AuthorizeRequest struct {
 	loggerProvider
 	configProvider
 	recorderWriter
+	// platforms if set, adds the device platform to the request context as tq.ContextPlatform
+	platforms *platforms
 }
 
 // Handle ...
 func (a *AuthorizeRequest) Handle(response tq.Response, request tq.Request) {
 	var body tq.AuthorRequest
-	if err := tq.Unmarshal(request.Body, &body); err != nil {
+	if err := request.Unmarshal(&body); err != nil {
 		a.Debugf(request.Context, "failed to unmarshall AuthorRequest [%v]", err)
 		authorizerHandleUnexpectedPacket.Inc()
 		authorizerHandleError.Inc()
@@ -42,6 +45,11 @@ func (a *AuthorizeRequest) Handle(response tq.Response, request tq.Request) {
 		)
 		return
 	}
+	if a.platforms != nil {
+		if platform := a.platforms.fingerprint(string(body.RemAddr), string(body.Port)); platform != "" {
+			request.Context = context.WithValue(request.Context, tq.ContextPlatform, platform)
+		}
+	}
 	a.RecordCtx(&request, tq.ContextUser, tq.ContextRemoteAddr, tq.ContextReqArgs, tq.ContextPort, tq.ContextPrivLvl)
 	c := a.GetUser(string(body.User))
 	if c == nil {
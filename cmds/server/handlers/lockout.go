@@ -0,0 +1,163 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"context"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// lockoutProvider refuses authentication attempts by locked out users and addresses, and records
+// the outcome of those it allows
+type lockoutProvider interface {
+	Locked(user, addr string) (time.Duration, bool)
+	Failure(user, addr string)
+	Success(user, addr string)
+}
+
+// SetStartLockout refuses authentications by users and remote addresses locked out by l, and
+// records the outcome of every other authentication with l
+func SetStartLockout(l lockoutProvider) StartOption {
+	return func(s *Start) {
+		s.lockout = l
+	}
+}
+
+// newLockoutHandler wraps the authentication flow next, started by request.  An ascii login may
+// not carry a username, which is taken from the continue answering the username prompt.
+func newLockoutHandler(l loggerProvider, lockout lockoutProvider, next tq.Handler, request tq.Request) *lockoutHandler {
+	h := &lockoutHandler{loggerProvider: l, recorderWriter: newPacketLogger(l), lockout: lockout, next: next}
+	var body tq.AuthenStart
+	if err := tq.Unmarshal(request.Body, &body); err == nil {
+		h.user = string(body.User)
+		h.addr = string(body.RemAddr)
+		// ascii chpass requests check the old password, other chpass requests are rejected
+		h.byPolicy = body.Action == tq.AuthenActionSendAuth || (body.Action == tq.AuthenActionPass && body.Type != tq.AuthenTypeASCII)
+	}
+	return h
+}
+
+// lockoutHandler is a middleware handler for authentication flows
+type lockoutHandler struct {
+	loggerProvider
+	recorderWriter
+	lockout    lockoutProvider
+	next       tq.Handler
+	user, addr string
+	// wantUser is set once the username is prompted for
+	wantUser bool
+	// byPolicy is set for sendauth and non ascii chpass requests, their failures are set by policy
+	// and do not check credentials
+	byPolicy bool
+}
+
+// Handle refuses the packet if the user or address is locked out, otherwise passes it to next
+func (h *lockoutHandler) Handle(response tq.Response, request tq.Request) {
+	var body tq.AuthenContinue
+	isContinue := request.Header.SeqNo > 1 && tq.Unmarshal(request.Body, &body) == nil
+	if h.wantUser && isContinue {
+		h.wantUser = false
+		h.user = string(body.UserMessage)
+	}
+	if d, locked := h.lockout.Locked(h.user, h.addr); locked {
+		authenLockoutRefused.Inc()
+		h.Infof(request.Context, "[%v] refusing authentication by user [%v] from rem-addr [%v], locked out for %v", request.Header.SessionID, h.user, h.addr, d.Round(time.Second))
+		h.RecordCtx(&request, tq.ContextUser, tq.ContextRemoteAddr, tq.ContextPort, tq.ContextPrivLvl)
+		response.ReplyWithContext(
+			h.Context(),
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+				tq.SetAuthenReplyServerMsg("too many failed authentications; try again later"),
+			),
+			h.recorderWriter,
+		)
+		return
+	}
+	// neither a client abort nor a policy rejection is a failed authentication
+	abort := (isContinue && body.Flags.Has(tq.AuthenContinueFlagAbort)) || h.byPolicy
+	r := &lockoutResponse{Response: response, h: h, abort: abort}
+	if c, ok := response.(tq.SessionCloser); ok {
+		h.next.Handle(&closingLockoutResponse{lockoutResponse: r, closer: c}, request)
+		return
+	}
+	h.next.Handle(r, request)
+}
+
+// lockoutResponse records the status of authenticate replies
+type lockoutResponse struct {
+	tq.Response
+	h     *lockoutHandler
+	abort bool
+}
+
+// Reply implements tq.Response
+func (r *lockoutResponse) Reply(v tq.EncoderDecoder) (int, error) {
+	r.observe(v)
+	return r.Response.Reply(v)
+}
+
+// ReplyWithContext implements tq.Response
+func (r *lockoutResponse) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writers ...tq.Writer) (int, error) {
+	r.observe(v)
+	return r.Response.ReplyWithContext(ctx, v, writers...)
+}
+
+// Next implements tq.Response, keeping the middleware in front of the next packet's handler
+func (r *lockoutResponse) Next(next tq.Handler) {
+	r.h.next = next
+	r.Response.Next(r.h)
+}
+
+// closingLockoutResponse is a lockoutResponse of a response that implements tq.SessionCloser.  It is
+// not built with tq.WrapResponse, which would hide failedAttempt.
+type closingLockoutResponse struct {
+	*lockoutResponse
+	closer tq.SessionCloser
+}
+
+// Close implements tq.SessionCloser
+func (r *closingLockoutResponse) Close() { r.closer.Close() }
+
+// Final implements tq.SessionCloser
+func (r *closingLockoutResponse) Final() bool { return r.closer.Final() }
+
+// Abort implements tq.SessionCloser
+func (r *closingLockoutResponse) Abort(msg string) (int, error) { return r.closer.Abort(msg) }
+
+// failedAttemptRecorder is implemented by responses that record failed authentications, for flows
+// that prompt again after a failure rather than replying with it
+type failedAttemptRecorder interface {
+	failedAttempt()
+}
+
+// failedAttempt implements failedAttemptRecorder
+func (r *lockoutResponse) failedAttempt() {
+	if !r.abort {
+		r.h.lockout.Failure(r.h.user, r.h.addr)
+	}
+}
+
+// observe records the outcome of v with the lockout
+func (r *lockoutResponse) observe(v tq.EncoderDecoder) {
+	reply, ok := v.(*tq.AuthenReply)
+	if !ok {
+		return
+	}
+	switch reply.Status {
+	case tq.AuthenStatusPass:
+		r.h.lockout.Success(r.h.user, r.h.addr)
+	case tq.AuthenStatusFail:
+		if !r.abort {
+			r.h.lockout.Failure(r.h.user, r.h.addr)
+		}
+	case tq.AuthenStatusGetUser:
+		r.h.wantUser = true
+	}
+}
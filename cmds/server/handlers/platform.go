@@ -0,0 +1,91 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// platformRule assigns a platform to requests whose rem-addr and port fields both match.  An
+// empty pattern matches anything.
+type platformRule struct {
+	Name    string `json:"name"`
+	RemAddr string `json:"rem_addr,omitempty"`
+	Port    string `json:"port,omitempty"`
+
+	remAddr *regexp.Regexp
+	port    *regexp.Regexp
+}
+
+// platforms fingerprints the device platform of a request, since identical commands can have
+// different semantics across platforms.  Configured with the scope's handler options:
+//
+//	handler:
+//	  type: *handler_type_start
+//	  options:
+//	    # the platform of every device in the scope
+//	    platform: junos
+//	    # or, evaluated in order before platform, the first match wins
+//	    platform_rules: |
+//	      [
+//	        {"name": "ios-xr", "port": "^(con|vty)[0-9]+$"},
+//	        {"name": "eos", "port": "^tty[0-9]+$"}
+//	      ]
+type platforms struct {
+	fallback string
+	rules    []platformRule
+}
+
+// newPlatforms parses the platform handler options.  It returns nil if none are set.
+func newPlatforms(options map[string]string) (*platforms, error) {
+	p := &platforms{fallback: options["platform"]}
+	if raw := options["platform_rules"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &p.rules); err != nil {
+			return nil, fmt.Errorf("bad platform_rules [%v]; %v", raw, err)
+		}
+	}
+	for i, r := range p.rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("platform rule [%v] is missing a name", i)
+		}
+		var err error
+		if p.rules[i].remAddr, err = compileOptional(r.RemAddr); err != nil {
+			return nil, fmt.Errorf("bad rem_addr in platform rule [%v]; %v", r.Name, err)
+		}
+		if p.rules[i].port, err = compileOptional(r.Port); err != nil {
+			return nil, fmt.Errorf("bad port in platform rule [%v]; %v", r.Name, err)
+		}
+	}
+	if p.fallback == "" && len(p.rules) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+func compileOptional(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// fingerprint returns the platform of a request, or an empty string if it is unknown
+func (p *platforms) fingerprint(remAddr, port string) string {
+	for _, r := range p.rules {
+		if r.remAddr != nil && !r.remAddr.MatchString(remAddr) {
+			continue
+		}
+		if r.port != nil && !r.port.MatchString(port) {
+			continue
+		}
+		return r.Name
+	}
+	return p.fallback
+}
@@ -0,0 +1,43 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlatforms(t *testing.T) {
+	p, err := newPlatforms(map[string]string{})
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	p, err = newPlatforms(map[string]string{
+		"platform": "junos",
+		"platform_rules": `[
+			{"name": "ios-xr", "port": "^(con|vty)[0-9]+$"},
+			{"name": "eos", "rem_addr": "^10\\.", "port": "^tty"}
+		]`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ios-xr", p.fingerprint("192.0.2.1", "vty0"))
+	assert.Equal(t, "eos", p.fingerprint("10.0.0.1", "tty1"))
+	// both patterns of a rule must match
+	assert.Equal(t, "junos", p.fingerprint("192.0.2.1", "tty1"))
+
+	p, err = newPlatforms(map[string]string{"platform_rules": `[{"name": "eos", "port": "^tty"}]`})
+	require.NoError(t, err)
+	assert.Equal(t, "", p.fingerprint("192.0.2.1", "vty0"))
+
+	for _, bad := range []string{`not json`, `[{"port": "^tty"}]`, `[{"name": "eos", "rem_addr": "("}]`} {
+		_, err = newPlatforms(map[string]string{"platform_rules": bad})
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,260 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// proxyTimeout is the default time an upstream server has to answer a packet
+	proxyTimeout = 5 * time.Second
+	// proxyServerMsg is the server message of replies sent when no upstream server answered
+	proxyServerMsg = "upstream server unavailable"
+)
+
+// keychainProvider supplies the secret shared with upstream servers
+type keychainProvider interface {
+	Add(k config.Keychain) func(context.Context, string) ([]byte, error)
+}
+
+// NewProxy creates the proxy handler factory.  k resolves the secret_group and secret_key options
+// of each scope to the secret shared with its upstream servers.
+func NewProxy(l loggerProvider, k keychainProvider) *Proxy {
+	return &Proxy{loggerProvider: l, keychainProvider: k, pools: make(map[string]*proxyPool)}
+}
+
+// Proxy forwards the sessions of a scope to upstream tacacs servers instead of serving them
+// locally.  Each packet is decoded with the client's secret, re-obfuscated with the upstream
+// secret and sent on, and the upstream reply is relayed back to the client.  The options of the
+// scope's handler are:
+//
+//	upstream: comma separated host:port list of servers, sessions are spread across them
+//	secret_group, secret_key: the keychain entry of the secret shared with the upstream servers
+//	network: optional, the network to dial, defaults to tcp
+//	timeout: optional go duration each upstream server has to answer a packet, defaults to 5s
+type Proxy struct {
+	loggerProvider
+	keychainProvider
+	mu sync.Mutex
+	// pools holds the upstream connections of each scope by name, kept across config reloads
+	// unless the scope's options change
+	pools map[string]*proxyPool
+}
+
+// proxyPool is the upstream connection pool of a scope
+type proxyPool struct {
+	*tq.ClientPool
+	// options is the handler options string the pool was created from
+	options string
+	timeout time.Duration
+}
+
+// New creates the proxy handler of the scope in ctx
+func (p *Proxy) New(ctx context.Context, c config.Provider, options map[string]string) tq.Handler {
+	scope, _ := ctx.Value(tq.ContextScope).(string)
+	pool, err := p.pool(ctx, scope, options)
+	if err != nil {
+		p.Errorf(ctx, "unable to create proxy handler for scope [%v]; %v", scope, err)
+		return nil
+	}
+	return &proxyHandler{loggerProvider: p.loggerProvider, pool: pool, scope: scope}
+}
+
+// pool returns the upstream pool of scope, reusing the pool of the previous config if its options
+// did not change and closing it if they did
+func (p *Proxy) pool(ctx context.Context, scope string, options map[string]string) (*proxyPool, error) {
+	var upstream []string
+	for _, address := range strings.Split(options["upstream"], ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			upstream = append(upstream, address)
+		}
+	}
+	if len(upstream) == 0 {
+		return nil, fmt.Errorf("option upstream requires at least one server address")
+	}
+	network := options["network"]
+	if network == "" {
+		network = "tcp"
+	}
+	timeout := proxyTimeout
+	if v, ok := options["timeout"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("bad timeout [%v] in options", v)
+		}
+		timeout = d
+	}
+	keychain := config.Keychain{Group: options["secret_group"], Key: options["secret_key"]}
+	if keychain.Key == "" {
+		return nil, fmt.Errorf("option secret_key is required")
+	}
+	key := fmt.Sprintf("%v|%v|%v|%v|%v", network, strings.Join(upstream, ","), keychain.Group, keychain.Key, timeout)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.pools[scope]; ok {
+		if old.options == key {
+			return old, nil
+		}
+		old.Close()
+		delete(p.pools, scope)
+	}
+	secret := p.Add(keychain)
+	dialer := func(address string) tq.ClientOption {
+		return func(c *tq.Client) error {
+			s, err := secret(ctx, "")
+			if err != nil {
+				return fmt.Errorf("unable to get upstream secret for [%v]; %v", address, err)
+			}
+			return tq.SetClientDialer(network, address, s)(c)
+		}
+	}
+	pool, err := tq.NewClientPool(network, upstream, nil, tq.SetClientPoolDialer(dialer))
+	if err != nil {
+		return nil, err
+	}
+	pp := &proxyPool{ClientPool: pool, options: key, timeout: timeout}
+	p.pools[scope] = pp
+	return pp, nil
+}
+
+// proxyHandler is the proxy handler of a scope
+type proxyHandler struct {
+	loggerProvider
+	pool  *proxyPool
+	scope string
+}
+
+// Handle starts an upstream session for the session request starts.  Upstream sessions get their
+// own SessionID, as the ids chosen by different clients may collide.
+func (h *proxyHandler) Handle(response tq.Response, request tq.Request) {
+	request.Context = context.WithValue(request.Context, tq.ContextScope, h.scope)
+	request.Metadata().Set(tq.ContextScope, h.scope)
+	switch request.Header.Type {
+	case tq.Authenticate, tq.Authorize, tq.Accounting:
+	default:
+		return
+	}
+	s := &proxySession{proxyHandler: h, id: tq.NewHeader(tq.SetHeaderRandomSessionID()).SessionID}
+	newScopeMetricsHandler(h.scope, "proxy", s, request).Handle(response, request)
+}
+
+// proxySession relays the packets of one session to its upstream session
+type proxySession struct {
+	*proxyHandler
+	id tq.SessionID
+}
+
+// Handle forwards request upstream and relays the reply.  Replies prompting for more data keep
+// the session on this handler, so the client's answer follows the same upstream session.
+func (s *proxySession) Handle(response tq.Response, request tq.Request) {
+	proxyHandle.Inc()
+	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
+		proxyDurations.Observe(v * 1000)
+	}))
+	reply, err := s.exchange(request)
+	timer.ObserveDuration()
+	if err != nil {
+		proxyHandleError.Inc()
+		s.Errorf(request.Context, "[%v] unable to proxy packet to upstream session [%v]; %v", request.Header.SessionID, s.id, err)
+		response.ReplyWithContext(request.Context, proxyErrorReply(request.Header.Type))
+		return
+	}
+	if r, ok := reply.(*tq.AuthenReply); ok {
+		switch r.Status {
+		case tq.AuthenStatusGetData, tq.AuthenStatusGetUser, tq.AuthenStatusGetPass:
+			response.Next(s)
+		}
+	}
+	response.Reply(reply)
+}
+
+// exchange sends request upstream and decodes the reply
+func (s *proxySession) exchange(request tq.Request) (tq.EncoderDecoder, error) {
+	body, err := upstreamBody(request)
+	if err != nil {
+		return nil, err
+	}
+	flags := request.Header.Flags
+	flags.Clear(tq.UnencryptedFlag)
+	flags.Clear(tq.SingleConnect)
+	flags.Clear(tq.ExtendedArgLength)
+	p := tq.NewPacket(
+		tq.SetPacketHeader(tq.NewHeader(
+			tq.SetHeaderVersion(request.Header.Version),
+			tq.SetHeaderType(request.Header.Type),
+			tq.SetHeaderSeqNo(int(request.Header.SeqNo)),
+			tq.SetHeaderFlag(flags),
+			tq.SetHeaderSessionID(s.id),
+		)),
+		tq.SetPacketBody(body),
+	)
+	ctx, cancel := context.WithTimeout(request.Context, s.pool.timeout)
+	defer cancel()
+	resp, err := s.pool.Send(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	var reply tq.EncoderDecoder
+	switch resp.Header.Type {
+	case tq.Authenticate:
+		reply = &tq.AuthenReply{}
+	case tq.Authorize:
+		reply = &tq.AuthorReply{}
+	case tq.Accounting:
+		reply = &tq.AcctReply{}
+	default:
+		return nil, fmt.Errorf("unexpected reply type [%v]", resp.Header.Type)
+	}
+	if err := tq.UnmarshalWithFlags(resp.Body, resp.Header.Flags, reply); err != nil {
+		return nil, fmt.Errorf("unable to decode upstream reply; %v", err)
+	}
+	return reply, nil
+}
+
+// upstreamBody returns the body of request as sent upstream.  Bodies using the non-rfc extended
+// arg lengths are re-encoded with standard ones, since upstream servers may not support them.
+func upstreamBody(request tq.Request) ([]byte, error) {
+	if !request.Header.Flags.Has(tq.ExtendedArgLength) {
+		return request.Body, nil
+	}
+	var body tq.EncoderDecoder
+	switch request.Header.Type {
+	case tq.Authorize:
+		body = &tq.AuthorRequest{}
+	case tq.Accounting:
+		body = &tq.AcctRequest{}
+	default:
+		return request.Body, nil
+	}
+	if err := request.Unmarshal(body); err != nil {
+		return nil, fmt.Errorf("unable to decode request; %v", err)
+	}
+	return body.MarshalBinary()
+}
+
+// proxyErrorReply is the reply to a packet of type t that no upstream server answered
+func proxyErrorReply(t tq.HeaderType) tq.EncoderDecoder {
+	switch t {
+	case tq.Authorize:
+		return tq.NewAuthorReply(tq.SetAuthorReplyStatus(tq.AuthorStatusError), tq.SetAuthorReplyServerMsg(proxyServerMsg))
+	case tq.Accounting:
+		return tq.NewAcctReply(tq.SetAcctReplyStatus(tq.AcctReplyStatusError), tq.SetAcctReplyServerMsg(proxyServerMsg))
+	}
+	return tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusError), tq.SetAuthenReplyServerMsg(proxyServerMsg))
+}
@@ -34,6 +34,7 @@ func (l *ResponseLogger) Write(ctx context.Context, p []byte) (int, error) {
 		return 0, err
 	}
 	request := tq.Request{Header: *packet.Header, Body: packet.Body[:], Context: ctx}
+	countReply(request)
 	l.Record(ctx, request.Fields(tq.ContextConnRemoteAddr, tq.ContextConnLocalAddr, tq.ContextUser, tq.ContextRemoteAddr, tq.ContextReqArgs, tq.ContextAcctType, tq.ContextPrivLvl, tq.ContextPort, tq.ContextFlags))
 
 	return 0, nil
@@ -49,6 +50,45 @@ func (l *ResponseLogger) Handle(response tq.Response, request tq.Request) {
 	l.next.Handle(response, request)
 }
 
+// countReply increments the reply status counters for the response being written
+func countReply(request tq.Request) {
+	switch request.Header.Type {
+	case tq.Authenticate:
+		var body tq.AuthenReply
+		if err := tq.Unmarshal(request.Body, &body); err != nil {
+			return
+		}
+		switch body.Status {
+		case tq.AuthenStatusPass:
+			responseAuthenPass.Inc()
+		case tq.AuthenStatusFail, tq.AuthenStatusError:
+			responseAuthenFail.Inc()
+		}
+	case tq.Authorize:
+		var body tq.AuthorReply
+		if err := request.Unmarshal(&body); err != nil {
+			return
+		}
+		switch body.Status {
+		case tq.AuthorStatusPassAdd, tq.AuthorStatusPassRepl:
+			responseAuthorPass.Inc()
+		case tq.AuthorStatusFail, tq.AuthorStatusError:
+			responseAuthorFail.Inc()
+		}
+	case tq.Accounting:
+		var body tq.AcctReply
+		if err := tq.Unmarshal(request.Body, &body); err != nil {
+			return
+		}
+		switch body.Status {
+		case tq.AcctReplyStatusSuccess:
+			responseAcctSuccess.Inc()
+		case tq.AcctReplyStatusError:
+			responseAcctError.Inc()
+		}
+	}
+}
+
 // recorder is a private interface for the handlers package.
 // it lets us abstract an object which can be used to store persistent data
 // also used to intercept the handler state machine. the interface would help
@@ -79,10 +119,20 @@ func (cl *ctxLogger) Context() context.Context {
 
 // RecordCtx receives a request object, and a set of context keys
 // it will call the loggerProvider's Set function to process context keys
-// which store data that is supposed to be persistent for a handler's lifetime
+// which store data that is supposed to be persistent for a handler's lifetime.
+// The non empty fields are also kept in the session's metadata, for the handlers
+// serving the later packets of the session.
 func (cl *ctxLogger) RecordCtx(request *tq.Request, keys ...tq.ContextKey) {
 	if cl.ctx == nil {
 		cl.ctx = request.Context
 	}
-	cl.ctx = cl.Set(cl.ctx, request.Fields(), keys...)
+	fields := request.Fields()
+	cl.ctx = cl.Set(cl.ctx, fields, keys...)
+	if m := tq.SessionMetadataFromContext(request.Context); m != nil {
+		for _, key := range keys {
+			if v := fields[string(key)]; v != "" {
+				m.Set(key, v)
+			}
+		}
+	}
 }
@@ -0,0 +1,211 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+const (
+	// defaultLabelScopes is how many scopes are labeled before new scopes are counted as other
+	defaultLabelScopes = 256
+	// otherLabel replaces label values beyond the cardinality guard
+	otherLabel = "other"
+)
+
+// labels guards the cardinality of the scope and user labels of the scope_* counters
+var labels = newLabelGuard(defaultLabelScopes, 0)
+
+// SetLabelLimits bounds the label values of the per scope counters, scope_authen, scope_author
+// and scope_acct.  The first scopes scopes seen are labeled by name, later ones are counted as
+// other; defaults to 256.  The user label is empty unless users is above zero, in which case the
+// first users usernames seen are labeled by name.  Every scope and user labeled is a time series
+// for each status, so keep users small.  Values already labeled keep their series.
+func SetLabelLimits(scopes, users int) {
+	labels.Lock()
+	defer labels.Unlock()
+	labels.maxScopes, labels.maxUsers = scopes, users
+}
+
+// newLabelGuard creates a labelGuard
+func newLabelGuard(scopes, users int) *labelGuard {
+	return &labelGuard{maxScopes: scopes, maxUsers: users, scopes: map[string]bool{}, users: map[string]bool{}}
+}
+
+// labelGuard remembers the scope and user label values in use, replacing new values with other
+// once its limits are reached
+type labelGuard struct {
+	sync.Mutex
+	maxScopes, maxUsers int
+	scopes, users       map[string]bool
+}
+
+// scope returns the label value of scope
+func (g *labelGuard) scope(scope string) string {
+	g.Lock()
+	defer g.Unlock()
+	return g.value(g.scopes, g.maxScopes, scope)
+}
+
+// user returns the label value of user, empty if users are not labeled
+func (g *labelGuard) user(user string) string {
+	g.Lock()
+	defer g.Unlock()
+	if g.maxUsers <= 0 {
+		return ""
+	}
+	return g.value(g.users, g.maxUsers, user)
+}
+
+// value returns v if it is already in seen, or adds it if seen has room for it
+func (g *labelGuard) value(seen map[string]bool, max int, v string) string {
+	if seen[v] {
+		return v
+	}
+	if len(seen) >= max {
+		scopeLabelOverflow.Inc()
+		return otherLabel
+	}
+	seen[v] = true
+	return v
+}
+
+// newScopeMetricsHandler wraps the flow next, started by request, counting its replies by scope
+// and handler.  An ascii login may not carry a username, which is taken from the continue
+// answering the username prompt.
+func newScopeMetricsHandler(scope, handler string, next tq.Handler, request tq.Request) *scopeMetricsHandler {
+	h := &scopeMetricsHandler{scope: labels.scope(scope), handler: handler, next: next}
+	switch request.Header.Type {
+	case tq.Authenticate:
+		var body tq.AuthenStart
+		if err := tq.Unmarshal(request.Body, &body); err == nil {
+			h.authenType = body.Type.String()
+			h.user = string(body.User)
+		}
+		h.handleType = authenHandleType(body.Type)
+	case tq.Authorize:
+		var body tq.AuthorRequest
+		if err := request.Unmarshal(&body); err == nil {
+			h.user = string(body.User)
+		}
+		h.handleType = "author"
+	case tq.Accounting:
+		var body tq.AcctRequest
+		if err := tq.Unmarshal(request.Body, &body); err == nil {
+			h.user = string(body.User)
+		}
+		h.handleType = "acct"
+	}
+	return h
+}
+
+// authenHandleType is the type label of the handle_duration histogram for logins of type t
+func authenHandleType(t tq.AuthenType) string {
+	switch t {
+	case tq.AuthenTypeASCII:
+		return "authen_ascii"
+	case tq.AuthenTypePAP:
+		return "authen_pap"
+	case tq.AuthenTypeCHAP:
+		return "authen_chap"
+	case tq.AuthenTypeMSCHAP, tq.AuthenTypeMSCHAPV2:
+		return "authen_mschap"
+	}
+	return "authen_other"
+}
+
+// scopeMetricsHandler is a middleware handler counting the replies of a flow with the scope_*
+// counters, and timing the handling of the packet that ends it with the handle_duration histogram
+type scopeMetricsHandler struct {
+	scope, handler, authenType, user string
+	handleType                       string
+	next                             tq.Handler
+	// wantUser is set once the username is prompted for
+	wantUser bool
+	// started is when the packet being handled was passed to next
+	started time.Time
+}
+
+// Handle passes the packet to next
+func (h *scopeMetricsHandler) Handle(response tq.Response, request tq.Request) {
+	if h.wantUser {
+		var body tq.AuthenContinue
+		if err := tq.Unmarshal(request.Body, &body); err == nil {
+			h.wantUser = false
+			h.user = string(body.UserMessage)
+		}
+	}
+	h.started = time.Now()
+	h.next.Handle(tq.WrapResponse(&scopeMetricsResponse{Response: response, h: h}, response), request)
+}
+
+// scopeMetricsResponse counts the status of replies
+type scopeMetricsResponse struct {
+	tq.Response
+	h *scopeMetricsHandler
+}
+
+// Reply implements tq.Response
+func (r *scopeMetricsResponse) Reply(v tq.EncoderDecoder) (int, error) {
+	r.observe(v)
+	return r.Response.Reply(v)
+}
+
+// ReplyWithContext implements tq.Response
+func (r *scopeMetricsResponse) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writers ...tq.Writer) (int, error) {
+	r.observe(v)
+	return r.Response.ReplyWithContext(ctx, v, writers...)
+}
+
+// Next implements tq.Response, keeping the middleware in front of the next packet's handler
+func (r *scopeMetricsResponse) Next(next tq.Handler) {
+	r.h.next = next
+	r.Response.Next(r.h)
+}
+
+// observe counts v.  Authenticate replies prompting for more data are not counted, the reply
+// ending the exchange is, along with the time taken to handle the packet it replies to.
+// Statuses other than a pass or fail, eg a follow, are timed as errors.
+func (r *scopeMetricsResponse) observe(v tq.EncoderDecoder) {
+	outcome := "error"
+	switch reply := v.(type) {
+	case *tq.AuthenReply:
+		switch reply.Status {
+		case tq.AuthenStatusGetUser:
+			r.h.wantUser = true
+			return
+		case tq.AuthenStatusGetData, tq.AuthenStatusGetPass:
+			return
+		case tq.AuthenStatusPass:
+			outcome = "pass"
+		case tq.AuthenStatusFail:
+			outcome = "fail"
+		}
+		scopeAuthen.WithLabelValues(r.h.scope, r.h.handler, r.h.authenType, reply.Status.String(), labels.user(r.h.user)).Inc()
+	case *tq.AuthorReply:
+		switch reply.Status {
+		case tq.AuthorStatusPassAdd, tq.AuthorStatusPassRepl:
+			outcome = "pass"
+		case tq.AuthorStatusFail:
+			outcome = "fail"
+		}
+		scopeAuthor.WithLabelValues(r.h.scope, r.h.handler, reply.Status.String(), labels.user(r.h.user)).Inc()
+	case *tq.AcctReply:
+		if reply.Status == tq.AcctReplyStatusSuccess {
+			outcome = "pass"
+		}
+		scopeAcct.WithLabelValues(r.h.scope, r.h.handler, reply.Status.String(), labels.user(r.h.user)).Inc()
+	default:
+		return
+	}
+	handleDuration.WithLabelValues(r.h.handleType, outcome).Observe(float64(time.Since(r.h.started)) / float64(time.Millisecond))
+}
@@ -0,0 +1,85 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelGuard(t *testing.T) {
+	g := newLabelGuard(2, 0)
+	assert.Equal(t, "a", g.scope("a"))
+	assert.Equal(t, "b", g.scope("b"))
+	assert.Equal(t, otherLabel, g.scope("c"), "the scope limit is reached")
+	assert.Equal(t, "a", g.scope("a"), "labeled scopes keep their series")
+	assert.Equal(t, "", g.user("alice"), "users are not labeled by default")
+
+	g = newLabelGuard(2, 1)
+	assert.Equal(t, "alice", g.user("alice"))
+	assert.Equal(t, otherLabel, g.user("bob"))
+}
+
+// closerResponse discards replies and records how its session was ended
+type closerResponse struct {
+	tq.Response
+	closed  bool
+	aborted string
+}
+
+func (r *closerResponse) Reply(v tq.EncoderDecoder) (int, error) { return 0, nil }
+func (r *closerResponse) Next(next tq.Handler)                   {}
+func (r *closerResponse) Close()                                 { r.closed = true }
+func (r *closerResponse) Final() bool                            { return r.closed }
+func (r *closerResponse) Abort(msg string) (int, error) {
+	r.closed, r.aborted = true, msg
+	return 0, nil
+}
+
+// fakeLockout never locks anyone out
+type fakeLockout struct{}
+
+func (fakeLockout) Locked(user, addr string) (time.Duration, bool) { return 0, false }
+func (fakeLockout) Failure(user, addr string)                      {}
+func (fakeLockout) Success(user, addr string)                      {}
+
+func TestMiddlewareSessionCloser(t *testing.T) {
+	body, err := tq.NewAuthenStart(tq.SetAuthenStartAction(tq.AuthenActionLogin), tq.SetAuthenStartType(tq.AuthenTypePAP), tq.SetAuthenStartUser("alice")).MarshalBinary()
+	require.NoError(t, err)
+	request := tq.Request{Header: *tq.NewHeader(tq.SetHeaderType(tq.Authenticate), tq.SetHeaderSeqNo(1)), Body: body, Context: context.Background()}
+	abort := tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		tq.Abort(response, request, "protocol violation")
+	})
+
+	// the handlers after the scope metrics still end the session
+	r := &closerResponse{}
+	(&scopeMetricsHandler{next: abort}).Handle(r, request)
+	assert.Equal(t, "protocol violation", r.aborted)
+
+	// and after the lockout, whose response also still records failed attempts
+	r = &closerResponse{}
+	next := tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		_, ok := response.(failedAttemptRecorder)
+		assert.True(t, ok)
+		abort(response, request)
+	})
+	newLockoutHandler(mockLogger{}, fakeLockout{}, next, request).Handle(r, request)
+	assert.Equal(t, "protocol violation", r.aborted)
+
+	// responses that cannot end their session are not made to
+	var seen tq.Response
+	(&scopeMetricsHandler{next: tq.HandlerFunc(func(response tq.Response, request tq.Request) { seen = response })}).Handle(struct{ tq.Response }{r}, request)
+	_, ok := seen.(tq.SessionCloser)
+	assert.False(t, ok)
+}
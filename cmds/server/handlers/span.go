@@ -9,37 +9,81 @@ package handlers
 
 import (
 	"context"
-	"fmt"
-	"net"
 	"strings"
+	"sync"
 	"time"
 
 	tq "github.com/facebookincubator/tacquito"
 	"github.com/facebookincubator/tacquito/cmds/server/config"
-
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/facebookincubator/tacquito/cmds/server/throttle"
 )
 
 const (
-	// this is the tcp connection idle timeout. It will act as a initial deadline on the
-	// tcp conn, and the conn Write deadline is reset to this value on every successful write
-	idleTimeout = 5 * time.Second
+	// writeTimeout bounds dialing and each write to a span destination
+	writeTimeout = 5 * time.Second
 )
 
+// featureGate decides if an optional, expensive feature may run
+type featureGate interface {
+	Allow(f throttle.Feature) bool
+}
+
+// handlerFactory creates the handler of a scope
+type handlerFactory interface {
+	New(ctx context.Context, c config.Provider, options map[string]string) tq.Handler
+}
+
+// SpanOption is used to set optional behaviors on the Span handler
+type SpanOption func(s *Span)
+
+// SetSpanFeatureGate will skip span mirroring whenever g disallows packet recording
+func SetSpanFeatureGate(g featureGate) SpanOption {
+	return func(s *Span) {
+		s.gate = g
+	}
+}
+
+// SetSpanHandler sets the handler that serves, and whose sessions are mirrored, defaults to a
+// Start handler without options
+func SetSpanHandler(h handlerFactory) SpanOption {
+	return func(s *Span) {
+		s.handler = h
+	}
+}
+
 // NewSpan ...
-func NewSpan(l loggerProvider) *Span {
-	return &Span{loggerProvider: l}
+func NewSpan(l loggerProvider, opts ...SpanOption) *Span {
+	s := &Span{loggerProvider: l, mirrors: &mirrors{m: make(map[mirrorOptions]*Mirror)}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.handler == nil {
+		s.handler = NewStart(l)
+	}
+	return s
 }
 
-// Span is the main entry point for incoming aaa messages from clients.
+// Span serves a scope with another handler, Start by default, mirroring the decrypted packets of
+// its sessions to a remote collector, eg a development server, for inspection and debugging.  See
+// Mirror for how packets are delivered.  The options of the scope's handler are those of
+// newMirrorOptions, the options of the wrapped handler, and these optional filters, evaluated on
+// the packet starting each session:
+//
+//	switchAddr: only mirror sessions of the device with this address
+//	remAddr: only mirror sessions whose rem-addr, the address of the user, is this
+//	packetType: only mirror sessions of this type, authenticate, authorize or accounting
 type Span struct {
 	loggerProvider
-	configProvider
-	ctx         context.Context
-	destination string
-	switchAddr  string
-	remAddr     string
-	packetType  tq.HeaderType
+	gate    featureGate
+	handler handlerFactory
+	// mirrors holds a mirror per destination, shared by scopes and kept across config reloads
+	mirrors *mirrors
+}
+
+// mirrors holds a Mirror per distinct set of options
+type mirrors struct {
+	sync.Mutex
+	m map[mirrorOptions]*Mirror
 }
 
 func strToHeaderType(packetType string) tq.HeaderType {
@@ -57,136 +101,86 @@ func strToHeaderType(packetType string) tq.HeaderType {
 
 // New ...
 func (s *Span) New(ctx context.Context, c config.Provider, options map[string]string) tq.Handler {
-	destination, ok := options["destination"]
-	if !ok {
-		s.Errorf(ctx, "Unable to find key destination in handler options")
+	next := s.handler.New(ctx, c, options)
+	if next == nil {
 		return nil
 	}
-	return &Span{
-		loggerProvider: s.loggerProvider,
-		ctx:            ctx,
-		configProvider: c, destination: destination,
+	if start, ok := next.(*Start); ok {
+		start.handler = "span"
+	}
+	m, err := s.mirror(ctx, options)
+	if err != nil {
+		spanHandleError.Inc()
+		s.Errorf(ctx, "span mirroring is disabled for this scope; %v", err)
+		return next
+	}
+	return &spanHandler{
+		gate:       s.gate,
+		mirror:     m,
+		next:       next,
 		switchAddr: options["switchAddr"],
 		remAddr:    options["remAddr"],
 		packetType: strToHeaderType(options["packetType"]),
 	}
 }
 
-type writer struct {
-	loggerProvider
-	net.Conn
-	ctx        context.Context
-	switchAddr string
-	remAddr    string
-	packetType tq.HeaderType
-}
-
-// Write sends the req/response from client/server to span host
-// after filtering on fields inside the packet
-// currently supported fields are rem-addr(remote-host), switchAddr(switch to which user is trying to login to)
-// and packet-Type (authenticate/authorise/accounting)
-func (w writer) Write(ctx context.Context, p []byte) (int, error) {
-	if w.Conn == nil {
-		spanHandleWriteError.Inc()
-		w.Errorf(w.ctx, "connection object attached to writer is invalid")
-		return 0, fmt.Errorf("inactive connection object")
-	}
-	remoteAddr := w.RemoteAddr().String()
-	if w.switchAddr != "" && remoteAddr != w.switchAddr {
-		spanHandleWriteError.Inc()
-		s := fmt.Sprintf("Skipping packet, switchAddr don't match, actual addr %v vs configured addr %v", remoteAddr, w.switchAddr)
-		w.Errorf(w.ctx, s)
-		return 0, fmt.Errorf(s)
-	}
-	packet := tq.NewPacket()
-	packet.UnmarshalBinary(p)
-	if w.packetType != 0 && packet.Header.Type != w.packetType {
-		spanHandleWriteError.Inc()
-		s := fmt.Sprintf("Skipping packet, Packet types don't match, actual type %v vs configured type %v", packet.Header.Type, w.packetType)
-		w.Errorf(w.ctx, s)
-		return 0, fmt.Errorf(s)
-	}
-	if w.remAddr != "" {
-		req := tq.Request{Header: *packet.Header, Body: packet.Body[:]}
-		fields := req.Fields()
-		remAddrField, found := fields["rem-addr"]
-		if found && remAddrField != w.remAddr {
-			spanHandleWriteError.Inc()
-			s := fmt.Sprintf("Skipping packet, client IPs don't match, actual client IP %v vs configured IP %v", remAddrField, w.remAddr)
-			w.Errorf(w.ctx, s)
-			return 0, fmt.Errorf(s)
-		}
+// mirror returns the mirror for options, creating it if no scope uses the same destination
+func (s *Span) mirror(ctx context.Context, options map[string]string) (*Mirror, error) {
+	o, err := newMirrorOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	s.mirrors.Lock()
+	defer s.mirrors.Unlock()
+	if m, ok := s.mirrors.m[o]; ok {
+		return m, nil
 	}
-	n, err := w.Conn.Write(p)
+	m, err := newMirror(ctx, s.loggerProvider, o)
 	if err != nil {
-		spanHandleWriteError.Inc()
-		return n, err
-	}
-	// successful write, let's increase the idletimeout
-	w.Infof(w.ctx, "Wrote %v bytes to connection", n)
-	w.SetWriteDeadline(time.Now().Add(idleTimeout))
-	spanHandleWriteSuccess.Inc()
-	return n, err
+		return nil, err
+	}
+	s.mirrors.m[o] = m
+	return m, nil
 }
 
-func (s *Span) dialHost() (net.Conn, error) {
-	c, err := net.Dial("tcp6", s.destination)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't dial the connection to %v due to error %v", s.destination, err)
-	}
-	s.Infof(s.ctx, "Dialled a tcp connection to host %v", s.destination)
-	return c, nil
+// spanHandler mirrors the sessions of a scope that pass its filters
+type spanHandler struct {
+	gate       featureGate
+	mirror     *Mirror
+	next       tq.Handler
+	switchAddr string
+	remAddr    string
+	packetType tq.HeaderType
 }
 
 // Handle ...
-func (s *Span) Handle(response tq.Response, request tq.Request) {
-	spanHandle.Inc()
-	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
-		ms := v * 1000 // make milliseconds
-		spanDurations.Observe(ms)
-	}))
-	start := time.Now()
-	conn, err := s.dialHost()
-	callNextHandler := func() {
-		nextHandler := NewStart(s.loggerProvider).New(request.Context, s.configProvider.(config.Provider), nil)
-		nextHandler.Handle(response, request)
-	}
-	if err != nil {
-		spanHandleError.Inc()
-		s.Errorf(request.Context, "Unable to span connection due to error %v", err)
-		callNextHandler()
+func (s *spanHandler) Handle(response tq.Response, request tq.Request) {
+	if !s.match(request) {
+		s.next.Handle(response, request)
 		return
 	}
-	conn.SetWriteDeadline(time.Now().Add(idleTimeout))
-	w := &writer{loggerProvider: s.loggerProvider,
-		Conn:       conn,
-		ctx:        request.Context,
-		remAddr:    s.remAddr,
-		switchAddr: s.switchAddr,
-		packetType: s.packetType,
+	if s.gate != nil && !s.gate.Allow(throttle.PacketRecording) {
+		spanHandleThrottled.Inc()
+		s.next.Handle(response, request)
+		return
 	}
-	// Write the request to the connection
-	req := tq.Packet{
-		Header: &request.Header,
-		Body:   request.Body[:],
+	s.mirror.Wrap(s.next).Handle(response, request)
+}
+
+// match reports whether the session request starts passes the filters
+func (s *spanHandler) match(request tq.Request) bool {
+	if s.packetType != 0 && request.Header.Type != s.packetType {
+		return false
 	}
-	reqBytes, err := req.MarshalBinary()
-	if err != nil {
-		s.Infof(request.Context, "unable to write request to connection due to error %v. Skipping packet...", err)
-		callNextHandler()
-		return
+	if s.switchAddr != "" {
+		if addr, _ := request.Context.Value(tq.ContextConnRemoteAddr).(string); addr != s.switchAddr {
+			return false
+		}
 	}
-	w.Write(request.Context, reqBytes)
-	// Write responses
-	go func() {
-		for range request.Context.Done() {
-			duration := time.Since(start)
-			timer.ObserveDuration()
-			s.Infof(request.Context, "Request context cancelled, total duration of connection %v", duration)
-			w.Close()
-			return
+	if s.remAddr != "" {
+		if remAddr, found := request.Fields()["rem-addr"]; !found || remAddr != s.remAddr {
+			return false
 		}
-	}()
-	response.RegisterWriter(w)
-	callNextHandler()
+	}
+	return true
 }
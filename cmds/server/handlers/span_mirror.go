@@ -0,0 +1,263 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+const (
+	// mirrorBuffer is the default number of packets a mirror queues for its destination
+	mirrorBuffer = 1024
+	// mirrorRetryInterval is how long a mirror drops packets after failing to dial its
+	// destination, before dialing it again
+	mirrorRetryInterval = time.Second
+)
+
+// mirrorOptions are the options of a mirror's destination.  Mirrors with the same options share a
+// connection.
+type mirrorOptions struct {
+	network, destination string
+	buffer               int
+	tlsCA, tlsServerName string
+	tlsInsecure          bool
+}
+
+// newMirrorOptions reads the mirror options of a span handler:
+//
+//	destination: host:port of the collector
+//	network: optional, tcp, tcp4, tcp6, udp, udp4, udp6 or tls, defaults to tcp
+//	buffer: optional, the number of packets queued for the collector, defaults to 1024
+//	tls_ca: optional, pem file of the CAs verifying the collector, defaults to the system roots
+//	tls_server_name: optional, the name verified in the collector's certificate
+//	tls_insecure_skip_verify: optional, true skips verifying the collector's certificate
+func newMirrorOptions(options map[string]string) (mirrorOptions, error) {
+	o := mirrorOptions{network: "tcp", destination: options["destination"], buffer: mirrorBuffer, tlsCA: options["tls_ca"], tlsServerName: options["tls_server_name"]}
+	if o.destination == "" {
+		return o, fmt.Errorf("missing required option [destination]")
+	}
+	if v, ok := options["network"]; ok {
+		switch v {
+		case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "tls":
+			o.network = v
+		default:
+			return o, fmt.Errorf("unsupported network [%v]", v)
+		}
+	}
+	if v, ok := options["buffer"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return o, fmt.Errorf("bad buffer [%v], must be a positive integer", v)
+		}
+		o.buffer = n
+	}
+	if v, ok := options["tls_insecure_skip_verify"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return o, fmt.Errorf("bad tls_insecure_skip_verify [%v]; %v", v, err)
+		}
+		o.tlsInsecure = b
+	}
+	return o, nil
+}
+
+// tlsConfig builds the tls config of the collector connection, or nil if it is not tls
+func (o mirrorOptions) tlsConfig() (*tls.Config, error) {
+	if o.network != "tls" {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: o.tlsServerName, InsecureSkipVerify: o.tlsInsecure}
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(o.destination)
+	}
+	if o.tlsCA != "" {
+		pem, err := os.ReadFile(o.tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read tls_ca [%v]; %v", o.tlsCA, err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls_ca [%v]", o.tlsCA)
+		}
+	}
+	return cfg, nil
+}
+
+// NewMirror creates a Mirror sending packets to the collector described by options, see the Span
+// handler for the options.  The mirror delivers packets until ctx is done.
+func NewMirror(ctx context.Context, l loggerProvider, options map[string]string) (*Mirror, error) {
+	o, err := newMirrorOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return newMirror(ctx, l, o)
+}
+
+func newMirror(ctx context.Context, l loggerProvider, o mirrorOptions) (*Mirror, error) {
+	cfg, err := o.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	m := &Mirror{loggerProvider: l, opts: o, tls: cfg, queue: make(chan mirrored, o.buffer)}
+	go m.run(ctx)
+	return m, nil
+}
+
+// Mirror copies the decrypted packets of sessions to a remote collector.  Each packet is written
+// as a tacacs packet with the unencrypted flag set, one datagram per packet over udp.  Packets are
+// queued and written in the background, so a slow or unavailable collector never delays a
+// session; packets that do not fit in the queue, or cannot be delivered, are dropped.
+type Mirror struct {
+	loggerProvider
+	opts  mirrorOptions
+	tls   *tls.Config
+	queue chan mirrored
+	// conn is only used by run
+	conn    net.Conn
+	retryAt time.Time
+}
+
+// mirrored is a packet waiting to be written to the collector
+type mirrored struct {
+	b        []byte
+	enqueued time.Time
+}
+
+// Wrap returns a handler that mirrors every packet of the sessions next serves, requests and
+// replies alike
+func (m *Mirror) Wrap(next tq.Handler) tq.Handler {
+	return &mirrorHandler{m: m, next: next}
+}
+
+// Write implements tq.Writer, mirroring the reply packet p
+func (m *Mirror) Write(ctx context.Context, p []byte) (int, error) {
+	if len(p) < tq.MaxHeaderLength {
+		return 0, fmt.Errorf("packet of [%v] bytes is too short", len(p))
+	}
+	b := append([]byte(nil), p...)
+	// the reply is marshalled before it is crypted, mark the copy as such
+	b[3] |= byte(tq.UnencryptedFlag)
+	m.enqueue(b)
+	return len(p), nil
+}
+
+// mirrorRequest mirrors the request packet
+func (m *Mirror) mirrorRequest(request tq.Request) {
+	header := request.Header
+	header.Flags.Set(tq.UnencryptedFlag)
+	b, err := tq.NewPacket(tq.SetPacketHeader(&header), tq.SetPacketBody(request.Body)).MarshalBinary()
+	if err != nil {
+		spanHandleError.Inc()
+		m.Errorf(request.Context, "unable to marshal request to mirror; %v", err)
+		return
+	}
+	m.enqueue(b)
+}
+
+// enqueue queues b for the collector, dropping it if the queue is full
+func (m *Mirror) enqueue(b []byte) {
+	spanHandle.Inc()
+	select {
+	case m.queue <- mirrored{b: b, enqueued: time.Now()}:
+	default:
+		spanHandleDropped.Inc()
+	}
+}
+
+// run writes queued packets to the collector until ctx is done
+func (m *Mirror) run(ctx context.Context) {
+	defer func() {
+		if m.conn != nil {
+			m.conn.Close()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-m.queue:
+			m.write(ctx, p)
+		}
+	}
+}
+
+// write writes p to the collector, dialing it if needed.  p is dropped if the collector cannot be
+// reached.
+func (m *Mirror) write(ctx context.Context, p mirrored) {
+	if m.conn == nil {
+		if time.Now().Before(m.retryAt) {
+			spanHandleWriteError.Inc()
+			return
+		}
+		conn, err := m.dial(ctx)
+		if err != nil {
+			spanHandleError.Inc()
+			spanHandleWriteError.Inc()
+			m.retryAt = time.Now().Add(mirrorRetryInterval)
+			m.Errorf(ctx, "unable to dial span destination [%v]; %v", m.opts.destination, err)
+			return
+		}
+		m.Infof(ctx, "dialed span destination [%v] over [%v]", m.opts.destination, m.opts.network)
+		m.conn = conn
+	}
+	m.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := m.conn.Write(p.b); err != nil {
+		spanHandleWriteError.Inc()
+		m.Errorf(ctx, "unable to write to span destination [%v]; %v", m.opts.destination, err)
+		m.conn.Close()
+		m.conn = nil
+		return
+	}
+	spanHandleWriteSuccess.Inc()
+	spanDurations.Observe(float64(time.Since(p.enqueued)) / float64(time.Millisecond))
+}
+
+// dial connects to the collector
+func (m *Mirror) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+	if m.tls != nil {
+		d := &tls.Dialer{Config: m.tls}
+		return d.DialContext(ctx, "tcp", m.opts.destination)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, m.opts.network, m.opts.destination)
+}
+
+// mirrorHandler is a middleware handler mirroring the packets of a session
+type mirrorHandler struct {
+	m    *Mirror
+	next tq.Handler
+}
+
+// Handle mirrors request and the replies to it, then passes it to next
+func (h *mirrorHandler) Handle(response tq.Response, request tq.Request) {
+	h.m.mirrorRequest(request)
+	response.RegisterWriter(h.m)
+	h.next.Handle(tq.WrapResponse(&mirrorResponse{Response: response, m: h.m}, response), request)
+}
+
+// mirrorResponse keeps the mirror in front of the handlers of the rest of the session
+type mirrorResponse struct {
+	tq.Response
+	m *Mirror
+}
+
+// Next implements tq.Response
+func (r *mirrorResponse) Next(next tq.Handler) {
+	r.Response.Next(&mirrorHandler{m: r.m, next: next})
+}
@@ -0,0 +1,42 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorOptions(t *testing.T) {
+	o, err := newMirrorOptions(map[string]string{"destination": "[::1]:4949"})
+	assert.NoError(t, err)
+	assert.Equal(t, mirrorOptions{network: "tcp", destination: "[::1]:4949", buffer: mirrorBuffer}, o)
+
+	for _, options := range []map[string]string{
+		{},
+		{"destination": "[::1]:4949", "network": "sctp"},
+		{"destination": "[::1]:4949", "buffer": "0"},
+		{"destination": "[::1]:4949", "tls_insecure_skip_verify": "maybe"},
+	} {
+		_, err := newMirrorOptions(options)
+		assert.Error(t, err, "options %v", options)
+	}
+}
+
+func TestMirrorDrops(t *testing.T) {
+	// nothing drains the queue, so packets beyond its size are dropped rather than blocking
+	m := &Mirror{queue: make(chan mirrored, 2)}
+	dropped := testutil.ToFloat64(spanHandleDropped)
+	for i := 0; i < 5; i++ {
+		m.enqueue([]byte{byte(i)})
+	}
+	assert.Equal(t, float64(3), testutil.ToFloat64(spanHandleDropped)-dropped)
+	assert.Len(t, m.queue, 2)
+}
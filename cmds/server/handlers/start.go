@@ -9,13 +9,38 @@ package handlers
 
 import (
 	"context"
+	"time"
+
 	tq "github.com/facebookincubator/tacquito"
 	"github.com/facebookincubator/tacquito/cmds/server/config"
 )
 
+// StartOption is used to set optional behaviors on the Start handler
+type StartOption func(s *Start)
+
+// SetStartTaskLongRunning sets how long an accounting task may run without a stop record before
+// it is reported as long running.  Defaults to 8 hours, zero disables the report.
+func SetStartTaskLongRunning(d time.Duration) StartOption {
+	return func(s *Start) {
+		s.tasks.longRunning = d
+	}
+}
+
+// SetStartTaskExpiry sets how long an accounting task may go without a watchdog or stop record
+// before it is no longer tracked.  Defaults to 24 hours, zero never expires tasks.
+func SetStartTaskExpiry(d time.Duration) StartOption {
+	return func(s *Start) {
+		s.tasks.expiry = d
+	}
+}
+
 // NewStart ...
-func NewStart(l loggerProvider) *Start {
-	return &Start{loggerProvider: l}
+func NewStart(l loggerProvider, opts ...StartOption) *Start {
+	s := &Start{loggerProvider: l, tasks: newTaskTracker(8*time.Hour, 24*time.Hour)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Start is the main entry point for incoming aaa messages from clients.
@@ -23,24 +48,77 @@ type Start struct {
 	loggerProvider
 	configProvider
 	options map[string]string
+	// tasks tracks accounting tasks across all scopes and config reloads
+	tasks *taskTracker
+	// platforms if set, fingerprints the platform of devices sending authorization requests
+	platforms *platforms
+	// actions answers sendauth and chpass requests
+	actions actionPolicies
+	// ascii if set, are the prompts and attempt limit of ascii logins
+	ascii *asciiOptions
+	// lockout if set, refuses authentications by locked out users and addresses
+	lockout lockoutProvider
+	// enrichers add metadata to accounting records
+	enrichers []Enricher
+	// scope is the name of the scope this handler serves, and handler the config handler type
+	// that created it, used to label the scope_* counters
+	scope, handler string
 }
 
 // New creates a new start handler.
 func (s *Start) New(ctx context.Context, c config.Provider, options map[string]string) tq.Handler {
-	return &Start{loggerProvider: s.loggerProvider, configProvider: c}
+	p, err := newPlatforms(options)
+	if err != nil {
+		startPlatformBadConfig.Inc()
+		s.Errorf(ctx, "platform fingerprints are disabled for this scope; %v", err)
+	}
+	actions, err := newActionPolicies(options)
+	if err != nil {
+		startAuthenActionBadConfig.Inc()
+		s.Errorf(ctx, "sendauth and chpass requests use the default policy for this scope; %v", err)
+	}
+	ascii, err := newASCIIOptions(options)
+	if err != nil {
+		startASCIIBadConfig.Inc()
+		s.Errorf(ctx, "ascii logins use the default prompts and attempts for this scope; %v", err)
+	}
+	scope, _ := ctx.Value(tq.ContextScope).(string)
+	return &Start{loggerProvider: s.loggerProvider, configProvider: c, tasks: s.tasks, platforms: p, actions: actions, ascii: &ascii, lockout: s.lockout, enrichers: s.enrichers, scope: scope, handler: "start"}
 }
 
 // Handle implements the tq handler interface
 func (s *Start) Handle(response tq.Response, request tq.Request) {
+	request.Context = context.WithValue(request.Context, tq.ContextScope, s.scope)
+	// the session's middleware learns the scope from its metadata
+	request.Metadata().Set(tq.ContextScope, s.scope)
+	var h tq.Handler
 	switch request.Header.Type {
 	case tq.Authenticate:
 		startAuthenticate.Inc()
-		NewAuthenticateStart(s.loggerProvider, s.configProvider).Handle(response, request)
+		a := NewAuthenticateStart(s.loggerProvider, s.configProvider)
+		if s.actions != nil {
+			a.actions = s.actions
+		}
+		if s.ascii != nil {
+			a.ascii = *s.ascii
+		}
+		h = a
+		if s.lockout != nil {
+			h = newLockoutHandler(s.loggerProvider, s.lockout, h, request)
+		}
 	case tq.Authorize:
 		startAuthorize.Inc()
-		NewAuthorizeRequest(s.loggerProvider, s.configProvider).Handle(response, request)
+		a := NewAuthorizeRequest(s.loggerProvider, s.configProvider)
+		a.platforms = s.platforms
+		h = a
 	case tq.Accounting:
 		startAccounting.Inc()
-		NewAccountingRequest(s.loggerProvider, s.configProvider).Handle(response, request)
+		a := NewAccountingRequest(s.loggerProvider, s.configProvider)
+		a.tasks = s.tasks
+		a.enrichers = s.enrichers
+		h = a
+	default:
+		return
 	}
+	newScopeMetricsHandler(s.scope, s.handler, h, request).Handle(response, request)
 }
@@ -37,6 +37,16 @@ var (
 		Name:      "authenstart_handle_error",
 		Help:      "number of authenstart errors",
 	})
+	authenStartSendAuthRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenstart_sendauth_rejected",
+		Help:      "number of authenstart sendauth requests answered by the sendauth policy",
+	})
+	authenStartChpassRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenstart_chpass_rejected",
+		Help:      "number of authenstart chpass requests answered by the chpass policy",
+	})
 	authenStartHandlePAP = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "authenstart_handle_pap",
@@ -107,6 +117,106 @@ var (
 		Name:      "authenascii_getPassword_missing_password_error",
 		Help:      "number of authen ascii packets where a password is not in the received packet",
 	})
+	authenASCIIRetry = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenascii_retry",
+		Help:      "number of authen ascii logins prompted again after a failed attempt",
+	})
+	authenChpassChanged = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchpass_changed",
+		Help:      "number of passwords changed by ascii chpass requests or expired password logins",
+	})
+	authenChpassFail = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchpass_fail",
+		Help:      "number of password changes the authenticator refused or that had an empty new password",
+	})
+	authenChpassMismatch = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchpass_mismatch",
+		Help:      "number of password changes whose new password and confirmation did not match",
+	})
+	authenChpassError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchpass_error",
+		Help:      "number of password changes ended by an unexpected packet or missing username",
+	})
+	authenChpassExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchpass_expired",
+		Help:      "number of ascii logins prompted for a new password because the user must change it",
+	})
+	authenStartHandleCHAP = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenstart_handle_chap",
+		Help:      "number of authenstart chap flows",
+	})
+	authenCHAPHandleUnexpectedPacket = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchap_handle_unexpected_packet",
+		Help:      "number of authen chap unexpected packets",
+	})
+	authenCHAPHandleAuthenFail = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchap_handle_authen_fail",
+		Help:      "number of authen chap authen fail packets",
+	})
+	authenCHAPHandleAuthenError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchap_handle_authen_error",
+		Help:      "number of authen chap authen error packets",
+	})
+	authenCHAPHandleMalformed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchap_handle_malformed_error",
+		Help:      "number of authen chap packets where the id, challenge and response could not be parsed",
+	})
+	authenCHAPHandleMissingUsername = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchap_handle_missing_username",
+		Help:      "number of authen chap packets where a username is not in the received packet",
+	})
+	authenCHAPHandleAuthenticatorNil = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenchap_handle_authenticator_nil_error",
+		Help:      "number of authen chap packets where we dont have an authenticator for the user",
+	})
+	authenStartHandleEnable = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenstart_handle_enable",
+		Help:      "number of authenstart enable flows",
+	})
+	authenEnableHandleUnexpectedPacket = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenenable_handle_unexpected_packet",
+		Help:      "number of authen enable unexpected packets",
+	})
+	authenEnableHandleNeedUsername = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenenable_handle_need_username",
+		Help:      "number of authen enable packets that require asking for username",
+	})
+	authenEnableHandleMissingUsername = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenenable_handle_missing_username",
+		Help:      "number of authen enable packets where a username is not in the received packet",
+	})
+	authenEnableHandleMissingPassword = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenenable_handle_missing_password",
+		Help:      "number of authen enable packets where the enable password is missing",
+	})
+	authenEnableHandleAuthenticatorNil = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenenable_handle_authenticator_nil_error",
+		Help:      "number of authen enable packets where we dont have an enable authenticator for the user",
+	})
+	authenEnableContinueStop = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authenenable_handle_continuestop",
+		Help:      "number of authen enable continuestop packets",
+	})
 	authenPAPHandleUnexpectedPacket = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "authenpap_handle_unexpected_packet",
@@ -157,6 +267,21 @@ var (
 		Name:      "accountingrequest_handle_unexpected_packet",
 		Help:      "number of accounting unexpected packets",
 	})
+	acctEnrichDNSLookup = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "acct_enrich_dns_lookup",
+		Help:      "number of reverse lookups of device names made to enrich accounting records",
+	})
+	acctEnrichDNSError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "acct_enrich_dns_error",
+		Help:      "number of reverse lookups of device names that failed, the device is named by its scope",
+	})
+	acctEnrichThrottled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "acct_enrich_throttled",
+		Help:      "number of reverse lookups of device names skipped due to throttling, the device is named by its scope",
+	})
 	accountingHandleAccounterNil = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "accountingrequest_handle_accounter_nil",
@@ -172,6 +297,11 @@ var (
 		Name:      "span_handle",
 		Help:      "number of span handle packets",
 	})
+	spanHandleDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "span_handle_dropped",
+		Help:      "number of span handle packets dropped as the mirror queue was full",
+	})
 	spanHandleWriteSuccess = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "span_handle_write_success",
@@ -188,12 +318,178 @@ var (
 		Help:      "number of span handle errors",
 	})
 
+	spanHandleThrottled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "span_handle_throttled",
+		Help:      "number of span handle packets that were not mirrored due to throttling",
+	})
+	proxyHandle = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "proxy_handle",
+		Help:      "number of packets forwarded upstream by the proxy handler",
+	})
+	proxyHandleError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "proxy_handle_error",
+		Help:      "number of proxy handle packets answered with an error as no upstream server replied",
+	})
+	responseAuthenPass = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "response_authen_pass",
+		Help:      "number of authenticate replies sent with a pass status",
+	})
+	responseAuthenFail = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "response_authen_fail",
+		Help:      "number of authenticate replies sent with a fail or error status",
+	})
+	responseAuthorPass = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "response_author_pass",
+		Help:      "number of authorize replies sent with a pass add or pass replace status",
+	})
+	responseAuthorFail = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "response_author_fail",
+		Help:      "number of authorize replies sent with a fail or error status",
+	})
+	responseAcctSuccess = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "response_acct_success",
+		Help:      "number of accounting replies sent with a success status",
+	})
+	responseAcctError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "response_acct_error",
+		Help:      "number of accounting replies sent with an error status",
+	})
+	scopeAuthen = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "scope_authen",
+		Help:      "number of authentication exchanges completed, by scope, handler, authen type, status and user",
+	}, []string{"scope", "handler", "authen_type", "status", "user"})
+	scopeAuthor = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "scope_author",
+		Help:      "number of authorization replies sent, by scope, handler, status and user",
+	}, []string{"scope", "handler", "status", "user"})
+	scopeAcct = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "scope_acct",
+		Help:      "number of accounting replies sent, by scope, handler, status and user",
+	}, []string{"scope", "handler", "status", "user"})
+	scopeLabelOverflow = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "scope_label_overflow",
+		Help:      "number of scope or user label values counted as other because the label limit was reached",
+	})
+	startPlatformBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "start_platform_bad_config",
+		Help:      "number of scopes whose platform handler options failed to parse",
+	})
+	startAuthenActionBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "start_authen_action_bad_config",
+		Help:      "number of scopes whose sendauth or chpass handler options failed to parse",
+	})
+	startASCIIBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "start_ascii_bad_config",
+		Help:      "number of scopes whose ascii login handler options failed to parse",
+	})
+	authenLockoutRefused = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "authen_lockout_refused",
+		Help:      "number of authentication packets refused because the user or rem-addr was locked out",
+	})
+	acctTaskMissingID = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_missing_task_id",
+		Help:      "number of accounting records without a task_id, which are not tracked",
+	})
+	acctTaskStart = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_start",
+		Help:      "number of accounting start records",
+	})
+	acctTaskDuplicateStart = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_duplicate_start",
+		Help:      "number of accounting start records that reused the task_id of an outstanding task",
+	})
+	acctTaskWatchdog = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_watchdog",
+		Help:      "number of accounting watchdog records without updates",
+	})
+	acctTaskWatchdogUpdate = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_watchdog_update",
+		Help:      "number of accounting watchdog records with updates",
+	})
+	acctTaskUnknownWatchdog = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_unknown_watchdog",
+		Help:      "number of accounting watchdog records for a task that was never started",
+	})
+	acctTaskStop = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_stop",
+		Help:      "number of accounting stop records",
+	})
+	acctTaskUnknownStop = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_unknown_stop",
+		Help:      "number of accounting stop records for a task that was never started",
+	})
+	acctTaskExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_expired",
+		Help:      "number of accounting tasks dropped after no stop or watchdog was received within the expiry",
+	})
+	acctTaskOutstanding = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_outstanding",
+		Help:      "number of accounting tasks started but not yet stopped",
+	})
+	acctTaskLongRunning = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "accounting_task_long_running",
+		Help:      "number of outstanding accounting tasks running longer than the long running threshold, without a stop",
+	})
+
 	// durations
 	spanDurations = prometheus.NewSummary(
 		prometheus.SummaryOpts{
 			Namespace:  "tacquito",
 			Name:       "span_handle_duration_milliseconds",
-			Help:       "the time spent on a given span handle call, in milliseconds",
+			Help:       "the time a mirrored packet spent queued and written to the span destination, in milliseconds",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+	)
+	proxyDurations = prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Namespace:  "tacquito",
+			Name:       "proxy_handle_duration_milliseconds",
+			Help:       "the time spent exchanging a packet with the upstream server, in milliseconds",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+	)
+	handleDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "tacquito",
+			Name:      "handle_duration_milliseconds",
+			Help:      "the time taken to handle the packet ending an exchange, by type, authen_ascii, authen_pap, authen_chap, authen_mschap, author or acct, and outcome, pass, fail or error, in milliseconds",
+			Buckets:   prometheus.ExponentialBuckets(0.5, 2, 16),
+		},
+		[]string{"type", "outcome"},
+	)
+	acctTaskDuration = prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Namespace:  "tacquito",
+			Name:       "accounting_task_duration_seconds",
+			Help:       "the time between the start and stop records of an accounting task, in seconds",
 			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
 		},
 	)
@@ -205,6 +501,8 @@ func init() {
 	prometheus.MustRegister(startAccounting)
 	prometheus.MustRegister(authenStartHandleUnexpectedPacket)
 	prometheus.MustRegister(authenStartHandleError)
+	prometheus.MustRegister(authenStartSendAuthRejected)
+	prometheus.MustRegister(authenStartChpassRejected)
 	prometheus.MustRegister(authenStartHandlePAP)
 	prometheus.MustRegister(authenASCIIContinueStop)
 	prometheus.MustRegister(authenASCIIHandleUnexpectedPacket)
@@ -219,6 +517,26 @@ func init() {
 	prometheus.MustRegister(authenASCIIGetPasswordAuthenFail)
 	prometheus.MustRegister(authenASCIIGetPasswordAuthenError)
 	prometheus.MustRegister(authenASCIIGetPasswordMissingPassword)
+	prometheus.MustRegister(authenASCIIRetry)
+	prometheus.MustRegister(authenChpassChanged)
+	prometheus.MustRegister(authenChpassFail)
+	prometheus.MustRegister(authenChpassMismatch)
+	prometheus.MustRegister(authenChpassError)
+	prometheus.MustRegister(authenChpassExpired)
+	prometheus.MustRegister(authenStartHandleCHAP)
+	prometheus.MustRegister(authenCHAPHandleUnexpectedPacket)
+	prometheus.MustRegister(authenCHAPHandleAuthenFail)
+	prometheus.MustRegister(authenCHAPHandleAuthenError)
+	prometheus.MustRegister(authenCHAPHandleMalformed)
+	prometheus.MustRegister(authenCHAPHandleMissingUsername)
+	prometheus.MustRegister(authenCHAPHandleAuthenticatorNil)
+	prometheus.MustRegister(authenStartHandleEnable)
+	prometheus.MustRegister(authenEnableHandleUnexpectedPacket)
+	prometheus.MustRegister(authenEnableHandleNeedUsername)
+	prometheus.MustRegister(authenEnableHandleMissingUsername)
+	prometheus.MustRegister(authenEnableHandleMissingPassword)
+	prometheus.MustRegister(authenEnableHandleAuthenticatorNil)
+	prometheus.MustRegister(authenEnableContinueStop)
 	prometheus.MustRegister(authenPAPHandleUnexpectedPacket)
 	prometheus.MustRegister(authenPAPHandleAuthenFail)
 	prometheus.MustRegister(authenPAPHandleAuthenError)
@@ -230,10 +548,45 @@ func init() {
 	prometheus.MustRegister(authorizerHandleError)
 	prometheus.MustRegister(accountingHandleUnexpectedPacket)
 	prometheus.MustRegister(accountingHandleAccounterNil)
+	prometheus.MustRegister(acctEnrichDNSLookup)
+	prometheus.MustRegister(acctEnrichDNSError)
+	prometheus.MustRegister(acctEnrichThrottled)
 	prometheus.MustRegister(accountingHandleError)
 	prometheus.MustRegister(spanHandle)
 	prometheus.MustRegister(spanHandleError)
+	prometheus.MustRegister(spanHandleDropped)
 	prometheus.MustRegister(spanHandleWriteSuccess)
 	prometheus.MustRegister(spanHandleWriteError)
 	prometheus.MustRegister(spanDurations)
+	prometheus.MustRegister(startPlatformBadConfig)
+	prometheus.MustRegister(startAuthenActionBadConfig)
+	prometheus.MustRegister(startASCIIBadConfig)
+	prometheus.MustRegister(authenLockoutRefused)
+	prometheus.MustRegister(acctTaskMissingID)
+	prometheus.MustRegister(acctTaskStart)
+	prometheus.MustRegister(acctTaskDuplicateStart)
+	prometheus.MustRegister(acctTaskWatchdog)
+	prometheus.MustRegister(acctTaskWatchdogUpdate)
+	prometheus.MustRegister(acctTaskUnknownWatchdog)
+	prometheus.MustRegister(acctTaskStop)
+	prometheus.MustRegister(acctTaskUnknownStop)
+	prometheus.MustRegister(acctTaskExpired)
+	prometheus.MustRegister(acctTaskOutstanding)
+	prometheus.MustRegister(acctTaskLongRunning)
+	prometheus.MustRegister(acctTaskDuration)
+	prometheus.MustRegister(spanHandleThrottled)
+	prometheus.MustRegister(proxyHandle)
+	prometheus.MustRegister(proxyHandleError)
+	prometheus.MustRegister(proxyDurations)
+	prometheus.MustRegister(handleDuration)
+	prometheus.MustRegister(responseAuthenPass)
+	prometheus.MustRegister(responseAuthenFail)
+	prometheus.MustRegister(responseAuthorPass)
+	prometheus.MustRegister(responseAuthorFail)
+	prometheus.MustRegister(responseAcctSuccess)
+	prometheus.MustRegister(responseAcctError)
+	prometheus.MustRegister(scopeAuthen)
+	prometheus.MustRegister(scopeAuthor)
+	prometheus.MustRegister(scopeAcct)
+	prometheus.MustRegister(scopeLabelOverflow)
 }
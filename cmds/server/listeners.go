@@ -0,0 +1,526 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/yang"
+)
+
+// listenerFlags are the flags of a listener serving a subset of packet types.  Each listener runs
+// its own tq.Server, so its rate limit and connection bound are independent of the others.
+type listenerFlags struct {
+	types    []tq.HeaderType
+	address  *string
+	rate     *float64
+	maxConns *int
+}
+
+// newListenerFlags registers the address, rate and connection flags of a listener, prefixed by prefix
+func newListenerFlags(prefix, description string, types ...tq.HeaderType) *listenerFlags {
+	return &listenerFlags{
+		types:    types,
+		address:  flag.String(prefix+"address", "", fmt.Sprintf("listen for %v on the provided address:port; empty serves them on -address", description)),
+		rate:     flag.Float64(prefix+"conn-rate", 0, fmt.Sprintf("connections per second accepted by the %v listener; 0 is unlimited", description)),
+		maxConns: flag.Int(prefix+"max-conns", 0, fmt.Sprintf("connections processed at once by the %v listener; 0 is unlimited", description)),
+	}
+}
+
+var (
+	defaultConnRate     = flag.Float64("conn-rate", 0, "connections per second accepted by the -address listener; 0 is unlimited")
+	defaultMaxConns     = flag.Int("max-conns", 0, "connections processed at once by the -address listener; 0 is unlimited")
+	authenListenerFlags = newListenerFlags("authen-", "authentication", tq.Authenticate)
+	authorListenerFlags = newListenerFlags("author-", "authorization", tq.Authorize)
+	acctListenerFlags   = newListenerFlags("acct-", "accounting", tq.Accounting)
+	sourceConnRate      = flag.Float64("source-conn-rate", 0, "connections per second accepted from each source address by every listener; 0 is unlimited")
+	maxSourceConns      = flag.Int("max-source-conns", 0, "connections processed at once from each source address by every listener; 0 is unlimited")
+	maxSessions         = flag.Int("max-sessions", 0, "single-connect sessions in progress on one connection; 0 is unlimited")
+	maxConcurrent       = flag.Int("max-concurrent-sessions", 0, "session packets handled at once by each listener's worker pool; 0 handles every packet on its connection's goroutine")
+)
+
+// listenSpecs are the values of the repeatable -listen flag
+type listenSpecs []string
+
+// String implements flag.Value
+func (l *listenSpecs) String() string {
+	return strings.Join(*l, " ")
+}
+
+// Set implements flag.Value
+func (l *listenSpecs) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+var listenFlags listenSpecs
+
+func init() {
+	flag.Var(&listenFlags, "listen", "repeatable; a listener as a url, eg tcp4://0.0.0.0:49 or tls6://[::]:300?cert=cert.pem&key=key.pem&types=authenticate; -address is then only served if set explicitly")
+}
+
+// listenSpec is a listener configured with -listen.  The url scheme is the network, tcp, tcp4 or
+// tcp6, tls, tls4 or tls6 for the same served over tls, on port 300 if the url has none, unix for
+// a unix socket at the url's path, or systemd for a socket passed by systemd socket activation, named by its FileDescriptorName or
+// its index among the passed sockets, eg
+//
+//	tcp4://0.0.0.0:49?types=accounting&conn_rate=200
+//	tls6://[::]:300?cert=/etc/tacquito/cert.pem&key=/etc/tacquito/key.pem&client_ca=/etc/tacquito/ca.pem
+//	unix:///run/tacquito/tacquito.sock?mode=0660
+//	systemd://tacquito.socket
+//
+// name - the listener label of the listener_* metrics, defaults to scheme://host:port, or path
+// types - comma separated packet types served, authenticate, authorize and accounting, defaults to all
+// conn_rate, max_conns - as -conn-rate and -max-conns, for this listener alone
+// tls - true serves unix and systemd listeners over tls, the tls schemes imply it
+// cert, key, client_ca - tls only, default to -tls-cert, -tls-key and -tls-client-ca
+// mode - unix only, the permissions of the socket file, in octal
+// source - the ip address unix socket clients are matched by, as they have none, defaults to ::1
+type listenSpec struct {
+	name                string
+	network, address    string
+	tls                 bool
+	cert, key, clientCA string
+	types               []tq.HeaderType
+	rate                float64
+	maxConns            int
+	mode                os.FileMode
+	source              net.IP
+}
+
+// headerTypes are the packet type names of the types option
+var headerTypes = map[string]tq.HeaderType{
+	"authenticate": tq.Authenticate,
+	"authorize":    tq.Authorize,
+	"accounting":   tq.Accounting,
+}
+
+// parseListenSpec parses a -listen value
+func parseListenSpec(v string) (listenSpec, error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		return listenSpec{}, fmt.Errorf("invalid listener [%v]; %v", v, err)
+	}
+	spec := listenSpec{name: u.Scheme + "://" + u.Host, address: u.Host, source: net.IPv6loopback}
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6":
+		spec.network = u.Scheme
+	case "tls", "tls4", "tls6":
+		spec.network, spec.tls = "tcp"+strings.TrimPrefix(u.Scheme, "tls"), true
+		if u.Port() == "" {
+			spec.address = net.JoinHostPort(u.Hostname(), strconv.Itoa(tq.TLSPort))
+			spec.name = u.Scheme + "://" + spec.address
+		}
+	case "unix":
+		if u.Host != "" || u.Path == "" {
+			return listenSpec{}, fmt.Errorf("invalid listener [%v], expected unix:///path", v)
+		}
+		spec.network, spec.address, spec.name = "unix", u.Path, "unix://"+u.Path
+	case "systemd":
+		spec.network = "systemd"
+	default:
+		return listenSpec{}, fmt.Errorf("invalid listener [%v], the scheme must be tcp, tcp4, tcp6, tls, tls4, tls6, unix or systemd", v)
+	}
+	if spec.network != "unix" && (u.Host == "" || u.Path != "") {
+		return listenSpec{}, fmt.Errorf("invalid listener [%v], expected scheme://host:port", v)
+	}
+	for k, values := range u.Query() {
+		value := values[len(values)-1]
+		switch k {
+		case "name":
+			spec.name = value
+		case "types":
+			for _, name := range strings.Split(value, ",") {
+				t, ok := headerTypes[strings.ToLower(strings.TrimSpace(name))]
+				if !ok {
+					return listenSpec{}, fmt.Errorf("invalid packet type [%v] for listener [%v], must be authenticate, authorize or accounting", name, v)
+				}
+				spec.types = append(spec.types, t)
+			}
+		case "conn_rate":
+			if spec.rate, err = strconv.ParseFloat(value, 64); err != nil || spec.rate < 0 {
+				return listenSpec{}, fmt.Errorf("invalid conn_rate [%v] for listener [%v]", value, v)
+			}
+		case "max_conns":
+			if spec.maxConns, err = strconv.Atoi(value); err != nil || spec.maxConns < 0 {
+				return listenSpec{}, fmt.Errorf("invalid max_conns [%v] for listener [%v]", value, v)
+			}
+		case "tls":
+			tlsOption, err := strconv.ParseBool(value)
+			if err != nil || (!tlsOption && spec.tls) {
+				return listenSpec{}, fmt.Errorf("invalid tls [%v] for listener [%v]", value, v)
+			}
+			spec.tls = tlsOption
+		case "mode":
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || spec.network != "unix" || mode > 0777 {
+				return listenSpec{}, fmt.Errorf("invalid mode [%v] for listener [%v], unix sockets only take octal permissions", value, v)
+			}
+			spec.mode = os.FileMode(mode)
+		case "source":
+			if spec.source = net.ParseIP(value); spec.source == nil {
+				return listenSpec{}, fmt.Errorf("invalid source [%v] for listener [%v], must be an ip address", value, v)
+			}
+		case "cert":
+			spec.cert = value
+		case "key":
+			spec.key = value
+		case "client_ca":
+			spec.clientCA = value
+		default:
+			return listenSpec{}, fmt.Errorf("unknown option [%v] for listener [%v]", k, v)
+		}
+	}
+	if !spec.tls && (spec.cert != "" || spec.key != "" || spec.clientCA != "") {
+		return listenSpec{}, fmt.Errorf("the cert, key and client_ca options of listener [%v] require tls", v)
+	}
+	return spec, nil
+}
+
+// listener is a tcp or unix listener and the server options that apply to it alone.  It counts
+// its connections in the listener_* metrics by name, and serves them over tls if tls is set.
+type listener struct {
+	tq.DeadlineListener
+	name string
+	tls  *tls.Config
+	// source is the remote address of unix socket clients, which have none that secret providers
+	// can match
+	source net.Addr
+	opts   []tq.Option
+}
+
+// Accept implements net.Listener
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.DeadlineListener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	listenerAccepted.WithLabelValues(l.name).Inc()
+	listenerConnections.WithLabelValues(l.name).Inc()
+	lc := &listenerConn{Conn: conn, name: l.name, remote: conn.RemoteAddr()}
+	if _, ok := lc.remote.(*net.TCPAddr); !ok && l.source != nil {
+		lc.remote = l.source
+	}
+	if l.tls != nil {
+		return tls.Server(lc, l.tls), nil
+	}
+	return lc, nil
+}
+
+// listenerConn is a connection counted in listener_connections until it is closed
+type listenerConn struct {
+	net.Conn
+	name   string
+	remote net.Addr
+	once   sync.Once
+}
+
+// RemoteAddr implements net.Conn
+func (c *listenerConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Close implements net.Conn
+func (c *listenerConn) Close() error {
+	c.once.Do(func() { listenerConnections.WithLabelValues(c.name).Dec() })
+	return c.Conn.Close()
+}
+
+// connLimits returns the rate limit and connection bound options.  The burst allows one second
+// worth of connections at rate.
+func connLimits(rate float64, maxConns int) []tq.Option {
+	var opts []tq.Option
+	if rate != 0 {
+		opts = append(opts, tq.SetConnectionRateLimit(rate, int(math.Max(1, math.Ceil(rate)))))
+	}
+	if maxConns != 0 {
+		opts = append(opts, tq.SetMaxConnections(maxConns))
+	}
+	return opts
+}
+
+// sourceLimits returns the per source, per connection and worker pool limit options shared by every
+// listener.
+// Like connLimits, the burst allows one second worth of connections at rate.
+func sourceLimits(rate float64, maxConns, sessions, concurrent int) []tq.Option {
+	var opts []tq.Option
+	if rate != 0 {
+		opts = append(opts, tq.SetSourceConnectionRateLimit(rate, int(math.Max(1, math.Ceil(rate)))))
+	}
+	if maxConns != 0 {
+		opts = append(opts, tq.SetMaxSourceConnections(maxConns))
+	}
+	if sessions != 0 {
+		opts = append(opts, tq.SetMaxSessions(sessions))
+	}
+	if concurrent != 0 {
+		opts = append(opts, tq.SetMaxConcurrentSessions(concurrent))
+	}
+	return opts
+}
+
+// unencryptedPolicy returns the unencrypted policy option named policy, shared by every listener.
+// prefixes is a comma separated list of the prefixes the allow policy serves.
+func unencryptedPolicy(policy, prefixes string) (tq.Option, error) {
+	p, err := tq.ParseUnencryptedPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []*net.IPNet
+	for _, cidr := range strings.Split(prefixes, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unencrypted prefix [%v]; %v", cidr, err)
+		}
+		allowed = append(allowed, ipNet)
+	}
+	return tq.SetUnencryptedPolicy(p, allowed...), nil
+}
+
+// yangServers returns the servers of the yang export, a server per tcp listener, with the packet
+// types and single-connect of its server options.  address, if set, replaces the host of every
+// listener; wildcard hosts are otherwise replaced with the hostname.  Tls and unix listeners are
+// left out, rfc 9105 only models tcp with a shared secret.
+func yangServers(listeners []listener, address string, opts []tq.Option) []yang.Server {
+	hostname, _ := os.Hostname()
+	var servers []yang.Server
+	for _, l := range listeners {
+		tcp, ok := l.Addr().(*net.TCPAddr)
+		if !ok || l.tls != nil {
+			continue
+		}
+		host := address
+		if host == "" {
+			host = tcp.IP.String()
+			if tcp.IP == nil || tcp.IP.IsUnspecified() {
+				host = hostname
+			}
+		}
+		o := tq.NewServer(nil, nil, append(append([]tq.Option{}, opts...), l.opts...)...).Options()
+		var types []tq.HeaderType
+		for _, t := range []tq.HeaderType{tq.Authenticate, tq.Authorize, tq.Accounting} {
+			for _, name := range o.PacketTypes {
+				if name == t.String() {
+					types = append(types, t)
+				}
+			}
+		}
+		servers = append(servers, yang.Server{
+			Name:             "tacquito-" + l.name,
+			Address:          host,
+			Port:             uint16(tcp.Port),
+			Types:            types,
+			SingleConnection: o.SingleConnect,
+		})
+	}
+	return servers
+}
+
+// newListeners opens the listeners of -listen, a listener for every packet type split onto its own
+// address, and the default listener for the remaining types.  The default listener is not opened
+// if every type is split, or if -listen is given and -address is not set explicitly.  -tls-cert
+// serves the split and default listeners over tls, the default listener on tq.TLSPort unless
+// -address is set explicitly.
+func newListeners(ctx context.Context, logger loggerProvider, network string, tlsConfig *tls.Config) ([]listener, error) {
+	listeners, err := newListenSpecs(ctx, logger, listenFlags)
+	if err != nil {
+		return nil, err
+	}
+	var remaining []tq.HeaderType
+	for _, f := range []*listenerFlags{authenListenerFlags, authorListenerFlags, acctListenerFlags} {
+		if *f.address == "" {
+			remaining = append(remaining, f.types...)
+			continue
+		}
+		l, err := listen(network, *f.address)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, listener{DeadlineListener: l, name: strings.ToLower(f.types[0].String()), tls: tlsConfig, source: localSource, opts: append(connLimits(*f.rate, *f.maxConns), tq.SetPacketTypes(f.types...))})
+	}
+	if len(remaining) == 0 || (len(listenFlags) > 0 && !isSet("address")) {
+		return listeners, nil
+	}
+	defaultAddress := *address
+	if tlsConfig != nil && !isSet("address") {
+		defaultAddress = ":" + strconv.Itoa(tq.TLSPort)
+	}
+	l, err := listen(network, defaultAddress)
+	if err != nil {
+		closeListeners(listeners)
+		return nil, err
+	}
+	opts := connLimits(*defaultConnRate, *defaultMaxConns)
+	if len(remaining) < 3 {
+		opts = append(opts, tq.SetPacketTypes(remaining...))
+	}
+	return append(listeners, listener{DeadlineListener: l, name: "default", tls: tlsConfig, source: localSource, opts: opts}), nil
+}
+
+// newListenSpecs opens the listeners of specs, each with its own tls config.  Sockets passed by
+// systemd that no spec names are closed.
+func newListenSpecs(ctx context.Context, logger loggerProvider, specs []string) ([]listener, error) {
+	var listeners []listener
+	var sockets *activation
+	defer func() {
+		if sockets != nil {
+			sockets.closeUnused(ctx, logger)
+		}
+	}()
+	names := make(map[string]bool)
+	for _, v := range specs {
+		spec, err := parseListenSpec(v)
+		if err == nil && names[spec.name] {
+			err = fmt.Errorf("listener name [%v] is used more than once", spec.name)
+		}
+		var config *tls.Config
+		if err == nil && spec.tls {
+			config, err = specTLS(ctx, logger, spec)
+		}
+		var l tq.DeadlineListener
+		switch {
+		case err != nil:
+		case spec.network == "systemd":
+			if sockets == nil {
+				sockets, err = systemdSockets()
+			}
+			if err == nil {
+				l, err = sockets.listener(spec.address)
+			}
+		default:
+			l, err = listen(spec.network, spec.address)
+			if err == nil && spec.mode != 0 {
+				if err = os.Chmod(spec.address, spec.mode); err != nil {
+					l.Close()
+				}
+			}
+		}
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		names[spec.name] = true
+		opts := connLimits(spec.rate, spec.maxConns)
+		if len(spec.types) > 0 {
+			opts = append(opts, tq.SetPacketTypes(spec.types...))
+		}
+		listeners = append(listeners, listener{DeadlineListener: l, name: spec.name, tls: config, source: &net.TCPAddr{IP: spec.source}, opts: opts})
+	}
+	return listeners, nil
+}
+
+// specTLS builds the tls config of a tls listener, falling back to the -tls-* flags for the files
+// it does not set
+func specTLS(ctx context.Context, logger loggerProvider, spec listenSpec) (*tls.Config, error) {
+	cert, key, clientCA := spec.cert, spec.key, spec.clientCA
+	if cert == "" && key == "" {
+		cert, key = *tlsCert, *tlsKey
+	}
+	if clientCA == "" {
+		clientCA = *tlsClientCA
+	}
+	if cert == "" || key == "" {
+		return nil, fmt.Errorf("tls listener [%v] requires cert and key options, or -tls-cert and -tls-key", spec.name)
+	}
+	config, err := loadTLS(ctx, logger, cert, key, clientCA)
+	if err != nil {
+		return nil, fmt.Errorf("tls listener [%v]; %v", spec.name, err)
+	}
+	return config, nil
+}
+
+// isSet reports if the flag name was set on the command line
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// localSource is the remote address of unix socket clients of the -address and packet type
+// listeners
+var localSource = &net.TCPAddr{IP: net.IPv6loopback}
+
+// listen opens a tcp or unix listener on address.  A unix socket left behind by a process that is
+// no longer listening on it is removed first.
+func listen(network, address string) (tq.DeadlineListener, error) {
+	if network == "unix" {
+		removeStaleSocket(address)
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("error reading address [%v]; %v", address, err)
+	}
+	dl, ok := l.(tq.DeadlineListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("listener [%v] must be a tcp or unix listener", address)
+	}
+	return dl, nil
+}
+
+// removeStaleSocket removes the unix socket at path if nothing accepts connections on it
+func removeStaleSocket(path string) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return
+	}
+	os.Remove(path)
+}
+
+func closeListeners(listeners []listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// serveListeners runs a server on every listener until ctx is done.  A server that fails to start
+// cancels the others, so a misconfigured listener is not silently left out.
+func serveListeners(ctx context.Context, logger loggerProvider, sp tq.SecretProvider, listeners []listener, opts ...tq.Option) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := range listeners {
+		l := &listeners[i]
+		s := tq.NewServer(logger, sp, append(append([]tq.Option{}, opts...), l.opts...)...)
+		logger.Infof(ctx, "serve listener [%v] on %v, tls [%v], with server options %+v", l.name, l.Addr().String(), l.tls != nil, s.Options())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Serve(ctx, l); err != nil {
+				logger.Errorf(ctx, "error listening on %v: %v", l.Addr().String(), err)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,113 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/yang"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListenSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want listenSpec
+		err  bool
+	}{
+		{spec: "tcp4://0.0.0.0:49", want: listenSpec{name: "tcp4://0.0.0.0:49", network: "tcp4", address: "0.0.0.0:49", source: net.IPv6loopback}},
+		{spec: "tcp6://[::]:49?types=Accounting&conn_rate=200&max_conns=64&name=acct", want: listenSpec{name: "acct", network: "tcp6", address: "[::]:49", types: []tq.HeaderType{tq.Accounting}, rate: 200, maxConns: 64, source: net.IPv6loopback}},
+		{spec: "tls://:300?cert=c.pem&key=k.pem&client_ca=ca.pem&types=authenticate,authorize", want: listenSpec{name: "tls://:300", network: "tcp", address: ":300", tls: true, cert: "c.pem", key: "k.pem", clientCA: "ca.pem", types: []tq.HeaderType{tq.Authenticate, tq.Authorize}, source: net.IPv6loopback}},
+		{spec: "tls6://[::1]:300", want: listenSpec{name: "tls6://[::1]:300", network: "tcp6", address: "[::1]:300", tls: true, source: net.IPv6loopback}},
+		{spec: "tls4://0.0.0.0", want: listenSpec{name: "tls4://0.0.0.0:300", network: "tcp4", address: "0.0.0.0:300", tls: true, source: net.IPv6loopback}},
+		{spec: "tls6://[::1]?name=tls", want: listenSpec{name: "tls", network: "tcp6", address: "[::1]:300", tls: true, source: net.IPv6loopback}},
+		{spec: "unix:///run/tacquito.sock?mode=0660&source=10.0.0.1", want: listenSpec{name: "unix:///run/tacquito.sock", network: "unix", address: "/run/tacquito.sock", mode: 0660, source: net.ParseIP("10.0.0.1")}},
+		{spec: "unix:///run/tacquito.sock?tls=true&cert=c.pem", want: listenSpec{name: "unix:///run/tacquito.sock", network: "unix", address: "/run/tacquito.sock", tls: true, cert: "c.pem", source: net.IPv6loopback}},
+		{spec: "systemd://tacquito.socket?types=accounting", want: listenSpec{name: "systemd://tacquito.socket", network: "systemd", address: "tacquito.socket", types: []tq.HeaderType{tq.Accounting}, source: net.IPv6loopback}},
+		{spec: "systemd://0?tls=true", want: listenSpec{name: "systemd://0", network: "systemd", address: "0", tls: true, source: net.IPv6loopback}},
+		{spec: "udp://:49", err: true},
+		{spec: "unix://host/run/tacquito.sock", err: true},
+		{spec: "unix://", err: true},
+		{spec: "unix:///run/tacquito.sock?mode=0999", err: true},
+		{spec: "unix:///run/tacquito.sock?source=localhost", err: true},
+		{spec: "tcp://:49?mode=0660", err: true},
+		{spec: "tls://:49?tls=false", err: true},
+		{spec: "systemd://", err: true},
+		{spec: ":49", err: true},
+		{spec: "tcp://", err: true},
+		{spec: "tcp://:49/path", err: true},
+		{spec: "tcp://:49?types=enable", err: true},
+		{spec: "tcp://:49?conn_rate=-1", err: true},
+		{spec: "tcp://:49?max_conns=many", err: true},
+		{spec: "tcp://:49?cert=c.pem", err: true},
+		{spec: "tcp://:49?secret=fooman", err: true},
+	}
+	for _, test := range tests {
+		got, err := parseListenSpec(test.spec)
+		if test.err {
+			assert.Error(t, err, test.spec)
+			continue
+		}
+		assert.NoError(t, err, test.spec)
+		assert.Equal(t, test.want, got, test.spec)
+	}
+}
+
+func TestUnencryptedPolicy(t *testing.T) {
+	opt, err := unencryptedPolicy("allow", "10.0.0.0/8, 2001:db8::/32")
+	assert.NoError(t, err)
+	o := tq.NewServer(nil, nil, opt).Options()
+	assert.Equal(t, "allow", o.UnencryptedPolicy)
+	assert.Equal(t, []string{"10.0.0.0/8", "2001:db8::/32"}, o.UnencryptedPrefixes)
+
+	opt, err = unencryptedPolicy("Log", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "log", tq.NewServer(nil, nil, opt).Options().UnencryptedPolicy)
+
+	_, err = unencryptedPolicy("permit", "")
+	assert.Error(t, err)
+	_, err = unencryptedPolicy("allow", "10.0.0.0/33")
+	assert.Error(t, err)
+}
+
+func TestTLSPeerPolicy(t *testing.T) {
+	p, err := tlsPeerPolicy("dns:*.example.com, ip:10.0.0.0/8,uri:spiffe://example.com/router")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dns:*.example.com", "ip:10.0.0.0/8", "uri:spiffe://example.com/router"}, tq.NewServer(nil, nil, tq.SetTLSPeerPolicy(p)).Options().TLSPeers)
+
+	p, err = tlsPeerPolicy("")
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+
+	_, err = tlsPeerPolicy("example.com")
+	assert.Error(t, err)
+	_, err = tlsPeerPolicy("ip:10.0.0.0/33")
+	assert.Error(t, err)
+}
+
+func TestYangServers(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+	listeners := []listener{
+		{DeadlineListener: l.(*net.TCPListener), name: "default"},
+		{DeadlineListener: l.(*net.TCPListener), name: "accounting", opts: []tq.Option{tq.SetPacketTypes(tq.Accounting)}},
+		{DeadlineListener: l.(*net.TCPListener), name: "tls", tls: &tls.Config{}},
+	}
+	servers := yangServers(listeners, "", []tq.Option{tq.SetSingleConnect(true)})
+	assert.Equal(t, []yang.Server{
+		{Name: "tacquito-default", Address: "127.0.0.1", Port: port, SingleConnection: true},
+		{Name: "tacquito-accounting", Address: "127.0.0.1", Port: port, Types: []tq.HeaderType{tq.Accounting}, SingleConnection: true},
+	}, servers)
+	assert.Equal(t, "tacacs.example.com", yangServers(listeners, "tacacs.example.com", nil)[0].Address)
+}
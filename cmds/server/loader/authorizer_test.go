@@ -0,0 +1,67 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// typedAuthorizer records the options it was created with
+type typedAuthorizer struct {
+	options map[string]string
+}
+
+func (a *typedAuthorizer) New(user config.User, options map[string]string) (tq.Handler, error) {
+	if options["fail"] != "" {
+		return nil, fmt.Errorf("bad options")
+	}
+	a.options = options
+	return tq.HandlerFunc(func(tq.Response, tq.Request) {}), nil
+}
+
+func TestNewAuthorizer(t *testing.T) {
+	typed := &typedAuthorizer{}
+	l := Loader{
+		authorizerProvider: stubAuthorizer{},
+		authorizerTypes:    map[config.AuthorizerType]authorizerTypeFactory{config.POLICY: typed},
+	}
+	group := config.Group{Name: "noc", Authorizer: &config.Authorizer{Type: config.POLICY, Options: map[string]string{"url": "group"}}}
+
+	// users without an authorizer use the authorizer provider
+	u := config.User{Name: "alice"}
+	reduceAuthorizerFromGroups(&u)
+	_, err := l.newAuthorizer(u)
+	assert.NoError(t, err)
+	assert.Nil(t, typed.options)
+
+	// group authorizers are inherited
+	u = config.User{Name: "alice", Groups: []config.Group{{Name: "empty"}, group}}
+	reduceAuthorizerFromGroups(&u)
+	_, err = l.newAuthorizer(u)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"url": "group"}, typed.options)
+
+	// user authorizers override groups
+	u = config.User{Name: "alice", Groups: []config.Group{group}, Authorizer: &config.Authorizer{Type: config.POLICY, Options: map[string]string{"url": "user"}}}
+	reduceAuthorizerFromGroups(&u)
+	_, err = l.newAuthorizer(u)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"url": "user"}, typed.options)
+
+	// unregistered types and bad options are errors
+	_, err = l.newAuthorizer(config.User{Name: "alice", Authorizer: &config.Authorizer{Type: 42}})
+	assert.Error(t, err)
+	_, err = l.newAuthorizer(config.User{Name: "alice", Authorizer: &config.Authorizer{Type: config.POLICY, Options: map[string]string{"fail": "true"}}})
+	assert.Error(t, err)
+}
@@ -40,11 +40,12 @@ type Watcher struct {
 	ctx      context.Context
 	watchman *fsnotify.Watcher
 	config   chan config.ServerConfig
+	reload   chan chan error
 }
 
 // New ...
 func New(ctx context.Context, l loader, logger loggerProvider) *Watcher {
-	return &Watcher{ctx: ctx, loader: l, loggerProvider: logger, config: make(chan config.ServerConfig, 1)}
+	return &Watcher{ctx: ctx, loader: l, loggerProvider: logger, config: make(chan config.ServerConfig, 1), reload: make(chan chan error)}
 }
 
 // Load ...
@@ -90,6 +91,9 @@ func (w *Watcher) watch(path string) {
 				w.Debugf(w.ctx, "config file changed from event %v", ev)
 				pending++ //track num of changes
 			}
+		case cb := <-w.reload:
+			w.Infof(w.ctx, "reloading config [%v] on request", path)
+			cb <- w.loader.Load(path)
 		case err := <-w.watchman.Errors:
 			w.Errorf(w.ctx, "Error: ", err)
 		case <-ticker.C:
@@ -104,6 +108,21 @@ func (w *Watcher) watch(path string) {
 	}
 }
 
+// Reload loads the watched config again, as if it had changed.  Loads happen in the watch loop, so
+// they never race with those of file changes.
+func (w *Watcher) Reload() error {
+	if w.watchman == nil {
+		return fmt.Errorf("config is not loaded")
+	}
+	cb := make(chan error, 1)
+	select {
+	case w.reload <- cb:
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+	return <-cb
+}
+
 // Config ...
 func (w *Watcher) Config() chan config.ServerConfig {
 	return w.loader.Config()
@@ -0,0 +1,54 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// resolveGroups flattens the groups of u, and the groups they include, into a single ordered list.
+// Groups are listed depth first, each followed by the groups it includes, in the order they are
+// configured.  The order decides the merge, as the first group to set an authenticator, accounter
+// or similar wins and commands are evaluated in order, so a group is always ahead of the groups
+// it includes.  A group reached more than once, by name, is only listed where it is first reached.
+// A group that includes itself, directly or not, is an error.
+func resolveGroups(u config.User) ([]config.Group, error) {
+	var resolved []config.Group
+	seen := map[string]bool{}
+	var visit func(g config.Group, path []string) error
+	visit = func(g config.Group, path []string) error {
+		for _, p := range path {
+			if p == g.Name {
+				return fmt.Errorf("group cycle [%v]", strings.Join(append(path, g.Name), " -> "))
+			}
+		}
+		if seen[g.Name] {
+			return nil
+		}
+		seen[g.Name] = true
+		included := g.Groups
+		g.Groups = nil
+		resolved = append(resolved, g)
+		path = append(path, g.Name)
+		for _, i := range included {
+			if err := visit(i, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, g := range u.Groups {
+		if err := visit(g, nil); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
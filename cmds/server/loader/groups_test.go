@@ -0,0 +1,57 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"testing"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveGroups(t *testing.T) {
+	neteng := config.Group{Name: "neteng", Commands: []config.Command{{Name: "show", Action: config.PERMIT}}}
+	senior := config.Group{Name: "neteng-senior", Groups: []config.Group{neteng}, Commands: []config.Command{{Name: "configure", Action: config.PERMIT}}}
+	oncall := config.Group{Name: "oncall", Groups: []config.Group{senior}, Commands: []config.Command{{Name: "reload", Action: config.PERMIT}}}
+	audit := config.Group{Name: "audit", Groups: []config.Group{neteng}}
+
+	names := func(groups []config.Group) []string {
+		var n []string
+		for _, g := range groups {
+			assert.Empty(t, g.Groups, "included groups are flattened")
+			n = append(n, g.Name)
+		}
+		return n
+	}
+
+	// each group is followed by the groups it includes, depth first
+	groups, err := resolveGroups(config.User{Name: "alice", Groups: []config.Group{oncall}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"oncall", "neteng-senior", "neteng"}, names(groups))
+	assert.Equal(t, oncall.Commands, groups[0].Commands)
+
+	// groups reached twice are only listed where they are first reached
+	groups, err = resolveGroups(config.User{Name: "alice", Groups: []config.Group{audit, oncall, neteng}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"audit", "neteng", "oncall", "neteng-senior"}, names(groups))
+
+	// the config is left as it was
+	assert.Len(t, oncall.Groups, 1)
+
+	groups, err = resolveGroups(config.User{Name: "alice"})
+	assert.NoError(t, err)
+	assert.Empty(t, groups)
+
+	// cycles are errors
+	cycle := config.Group{Name: "a", Groups: []config.Group{{Name: "b", Groups: []config.Group{{Name: "a"}}}}}
+	_, err = resolveGroups(config.User{Name: "alice", Groups: []config.Group{cycle}})
+	assert.EqualError(t, err, "group cycle [a -> b -> a]")
+	_, err = resolveGroups(config.User{Name: "alice", Groups: []config.Group{{Name: "self", Groups: []config.Group{{Name: "self"}}}}})
+	assert.EqualError(t, err, "group cycle [self -> self]")
+}
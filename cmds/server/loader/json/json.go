@@ -49,7 +49,7 @@ func (l *JSON) Unmarshal(b []byte) error {
 	if len(l.ServerConfig.Secrets) < 1 {
 		return fmt.Errorf("no secret providers were unmarshalled from config, cannot serve")
 	}
-	if len(l.ServerConfig.Users) < 1 {
+	if len(l.ServerConfig.Users) < 1 && !l.Proxies() {
 		return fmt.Errorf("no users were unmarshalled from config, cannot serve")
 	}
 	l.config <- l.ServerConfig
@@ -60,6 +60,12 @@ type authorizerFactory interface {
 	New(user config.User) (tq.Handler, error)
 }
 
+// authorizerTypeFactory provides the authorizer types users may select in place of the default
+// authorizer provider
+type authorizerTypeFactory interface {
+	New(user config.User, options map[string]string) (tq.Handler, error)
+}
+
 // localloader represents a config loader
 type localloader interface {
 	Load(path string) error
@@ -67,6 +73,11 @@ type localloader interface {
 }
 
 // unmarshaled represents a config unmarshaller that provides an unmarshalled config
+// reloader is a config source that loads its config again on demand, eg fsnotify.Watcher
+type reloader interface {
+	Reload() error
+}
+
 type unmarshaled interface {
 	Config() chan config.ServerConfig
 }
@@ -123,6 +134,14 @@ func RegisterAuthenticator(t config.AuthenticatorType, a authenticatorFactory) O
 	}
 }
 
+// RegisterAuthorizer registers an authorizer type, used by users and groups that select it
+// instead of the authorizer provider
+func RegisterAuthorizer(t config.AuthorizerType, a authorizerTypeFactory) Option {
+	return func(l *Loader) {
+		l.authorizerTypes[t] = a
+	}
+}
+
 // RegisterAccounter ...
 func RegisterAccounter(t config.AccounterType, a accounterFactory) Option {
 	return func(l *Loader) {
@@ -136,19 +155,46 @@ func NewLocalConfig(ctx context.Context, path string, ll localloader, opts ...Op
 	if err := ll.Load(path); err != nil {
 		return nil, err
 	}
-	return NewLoader(ctx, ll, opts...)
+	wl, err := newLoader(ctx, ll, opts...)
+	if err != nil {
+		return nil, err
+	}
+	wl.reload = func() error {
+		// sources that watch the file reload it themselves, loading it again would watch it twice
+		if r, ok := ll.(reloader); ok {
+			return r.Reload()
+		}
+		return ll.Load(path)
+	}
+	go wl.updates()
+	return wl, nil
 }
 
 // NewLoader ...
 func NewLoader(ctx context.Context, l unmarshaled, opts ...Option) (*Loader, error) {
+	wl, err := newLoader(ctx, l, opts...)
+	if err != nil {
+		return nil, err
+	}
+	go wl.updates()
+	return wl, nil
+}
+
+// newLoader applies opts and checks the required dependencies are set, without starting the
+// update loop
+func newLoader(ctx context.Context, l unmarshaled, opts ...Option) (*Loader, error) {
 	wl := &Loader{
 		ctx:                ctx,
 		unmarshaled:        l,
 		providerTypes:      make(map[config.ProviderType]secretProviderFactory),
 		authenticatorTypes: make(map[config.AuthenticatorType]authenticatorFactory),
 		accounterTypes:     make(map[config.AccounterType]accounterFactory),
+		authorizerTypes:    make(map[config.AuthorizerType]authorizerTypeFactory),
 		handlerTypes:       make(map[config.HandlerType]handlerFactory),
 		query:              make(chan queryGet),
+		push:               make(chan pushRequest),
+		changes:            make(chan changeRequest),
+		snapshots:          make(chan chan Snapshot),
 		warm:               make(chan struct{}),
 	}
 	for _, opt := range opts {
@@ -166,7 +212,6 @@ func NewLoader(ctx context.Context, l unmarshaled, opts ...Option) (*Loader, err
 	if wl.authorizerProvider == nil {
 		return nil, fmt.Errorf("please provide an authorizer provider")
 	}
-	go wl.updates()
 	return wl, nil
 }
 
@@ -181,9 +226,15 @@ type Loader struct {
 	providerTypes      map[config.ProviderType]secretProviderFactory
 	authenticatorTypes map[config.AuthenticatorType]authenticatorFactory
 	accounterTypes     map[config.AccounterType]accounterFactory
+	authorizerTypes    map[config.AuthorizerType]authorizerTypeFactory
 	handlerTypes       map[config.HandlerType]handlerFactory
 	query              chan queryGet
+	push               chan pushRequest
+	changes            chan changeRequest
+	snapshots          chan chan Snapshot
 	warm               chan struct{}
+	// reload loads the config from its source again, nil if the source cannot
+	reload func() error
 }
 
 // BlockUntilLoaded will block until we are warmed up with parsed config
@@ -205,6 +256,14 @@ func (l Loader) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler, e
 	return sp.secret, sp.handler, sp.err
 }
 
+// GetSecrets implements tq.RotatingSecretProvider.  The secondary secret is only looked up for
+// scopes that configure one.
+func (l Loader) GetSecrets(ctx context.Context, remote net.Addr) ([]byte, []byte, tq.Handler, error) {
+	slot := &secondarySlot{}
+	secret, handler, err := l.Get(withSecondarySlot(ctx, slot), remote)
+	return secret, slot.get(), handler, err
+}
+
 // get is a protected method that searches for a matching provider.  we first check the
 // remote connection should even be allowed.
 func (l Loader) get(ctx context.Context, providers []tq.SecretProvider, remote net.Addr) ([]byte, tq.Handler, error) {
@@ -228,16 +287,63 @@ func (l *Loader) updates() {
 	providers := []tq.SecretProvider{}
 	// prefix filters are here for the same reason, race condition protection
 	prefixDeny, prefixAllow := newPrefixFilter(nil), newPrefixFilter(nil)
+	// current is the config last loaded or pushed, overlay the runtime changes layered on it and
+	// known the errors of both, found when a change is first validated
+	var current config.ServerConfig
+	var overlay Overlay
+	var known map[string]bool
 	for {
 		select {
 		case c := <-l.Config():
-			providers = l.build(c)
+			current, known = c, nil
+			providers = l.build(overlay.apply(c))
 			l.Infof(l.ctx, "updated all providers from config source")
 			prefixDeny, prefixAllow = l.createPrefixFilters(c)
 			l.Infof(l.ctx, "updated all prefix filters, where available, from config source")
 			buildUpdate.Inc()
 			// notify that we are warmed, but one time only
 			warm.Do(func() { close(l.warm) })
+		case p := <-l.push:
+			built, diagnostics := l.validate(overlay.apply(p.config))
+			result := PushResult{Diagnostics: diagnostics}
+			if !p.dryRun && !HasErrors(diagnostics) {
+				current, known = p.config, nil
+				providers = built
+				prefixDeny, prefixAllow = l.createPrefixFilters(p.config)
+				l.Infof(l.ctx, "updated all providers and prefix filters from pushed config")
+				buildUpdate.Inc()
+				configPushApplied.Inc()
+				warm.Do(func() { close(l.warm) })
+				result.Applied = true
+			} else {
+				configPushRejected.Inc()
+			}
+			p.cb <- result
+		case c := <-l.changes:
+			next := overlay.copy()
+			if err := c.change(&next); err != nil {
+				c.cb <- changeResult{err: err}
+				continue
+			}
+			if known == nil {
+				_, diagnostics := l.validate(overlay.apply(current))
+				known = errorSet(diagnostics)
+			}
+			built, diagnostics := l.validate(next.apply(current))
+			result := PushResult{Diagnostics: diagnostics}
+			if !introducesErrors(known, diagnostics) {
+				overlay, known = next, errorSet(diagnostics)
+				providers = built
+				l.Infof(l.ctx, "updated all providers from config overlay; [%v] users, [%v] disabled users and [%v] scopes", len(overlay.Users), len(overlay.Disabled), len(overlay.Secrets))
+				buildUpdate.Inc()
+				overlayApplied.Inc()
+				result.Applied = true
+			} else {
+				overlayRejected.Inc()
+			}
+			c.cb <- changeResult{result: result}
+		case cb := <-l.snapshots:
+			cb <- Snapshot{Config: overlay.apply(current), Overlay: overlay.copy()}
 		case q := <-l.query:
 			go func() {
 				// prefixFilter will log to prom counters and also act as a quick fail for prefixes that do not pass
@@ -301,12 +407,22 @@ type queryGet struct {
 // without any config.  In that case, all client calls to the service will fail closed.
 func (l Loader) build(c config.ServerConfig) []tq.SecretProvider {
 	providers := make([]tq.SecretProvider, 0, len(c.Secrets))
+	expanded, errs := expandUsers(c)
+	for _, err := range errs {
+		userTemplateError.Inc()
+		l.Errorf(l.ctx, "%v", err)
+	}
+	caps, errs := newPrivLvlCaps(c.PrivLvlCaps)
+	for _, err := range errs {
+		privLvlCapBadConfig.Inc()
+		l.Errorf(l.ctx, "%v", err)
+	}
 	for _, provider := range c.Secrets {
 		// TODO add stringer to provider.Type
 		l.Infof(l.ctx, "processing secret config [%v:%v]", provider.Name, provider.Type)
 		// extract scoped user map
 		users := map[string]*config.AAA{}
-		for _, u := range c.Users {
+		for _, u := range expanded {
 			// does this user belong to this scope?
 			if !u.HasScope(provider.Name) {
 				// nope, skip
@@ -314,8 +430,23 @@ func (l Loader) build(c config.ServerConfig) []tq.SecretProvider {
 			}
 			scope.Inc()
 
-			// localize the user to this scope
-			u.LocalizeToScope(provider.Name)
+			if u.Authenticator != nil {
+				userOverrideAuthenticator.Inc()
+			}
+			if u.Accounter != nil {
+				userOverrideAccounter.Inc()
+			}
+			u, err := l.localize(provider, u)
+			if err != nil {
+				userGroupCycle.Inc()
+				l.Errorf(l.ctx, "user [%v] will not be added to scope [%v]; %v", u.Name, provider.Name, err)
+				continue
+			}
+
+			// users with no accounter of their own, nor from their groups, are accounted by the scope
+			if provider.Accounter != nil && u.Accounter == provider.Accounter {
+				scopeAccounter.Inc()
+			}
 
 			if _, exists := users[u.Name]; exists {
 				// we do we do this? it allows for users overrides to be applied on top
@@ -323,18 +454,17 @@ func (l Loader) build(c config.ServerConfig) []tq.SecretProvider {
 				l.Errorf(l.ctx, "duplicate username detected, overwriting previous entry; scope [%v] user [%v]", provider.Name, u.Name)
 				userScopeDuplicate.Inc()
 			}
-			l.reduceAuthenticatorAccounterFromGroups(provider.Name, &u)
 
 			// general flow here is that we opportunistically build the three As of AAA.  If we hit an error
 			// we try to keep going, providing a default implementation which fails closed.  Since all three
 			// As are not required by the rfc.
 
 			opts := []config.AAAOption{}
-			if a, err := l.authorizerProvider.New(u); err == nil {
-				opts = append(opts, config.SetAAAAuthorizer(a))
+			if a, err := l.newAuthorizer(u); err == nil {
+				opts = append(opts, config.SetAAAAuthorizer(caps.wrap(a)))
 			} else {
 				userAuthorizerUnassigned.Inc()
-				l.Errorf(l.ctx, "no authorizer available in scope [%v] for user [%v]", provider.Name, u.Name)
+				l.Errorf(l.ctx, "no authorizer available in scope [%v] for user [%v]; %v", provider.Name, u.Name, err)
 			}
 
 			if u.Authenticator != nil {
@@ -353,20 +483,35 @@ func (l Loader) build(c config.ServerConfig) []tq.SecretProvider {
 					l.Errorf(l.ctx, "no authenticator assigned to authenticator type [%v] in scope [%v] on user [%v]", u.Authenticator.Type, provider.Name, u.Name)
 				}
 			}
+			if u.Enable != nil {
+				af := l.authenticatorTypes[u.Enable.Type]
+				if af != nil {
+					a, err := af.New(u.Name, u.Enable.Options)
+					if err != nil {
+						userEnableBadConfigRef.Inc()
+						l.Errorf(l.ctx, "enable authenticator factory error in scope [%v], user [%v] will not be added; %v", provider.Name, u.Name, err)
+						continue
+					}
+					opts = append(opts, config.SetAAAEnable(a))
+				} else {
+					userEnableUnassigned.Inc()
+					l.Errorf(l.ctx, "no authenticator assigned to enable type [%v] in scope [%v] on user [%v]", u.Enable.Type, provider.Name, u.Name)
+				}
+			}
 			if u.Accounter != nil {
-				acf := l.accounterTypes[u.Accounter.Type]
-				if acf != nil {
-					opts = append(opts, config.SetAAAAccounter(acf.New(u.Accounter.Options)))
+				if a, err := l.newAccounter(*u.Accounter); err == nil {
+					opts = append(opts, config.SetAAAAccounter(a))
 				} else {
 					userAccounterUnassigned.Inc()
-					l.Errorf(l.ctx, "no accounter assigned to accounter type [%v] in scope [%v] on user [%v]", u.Accounter.Type, provider.Name, u.Name)
+					l.Errorf(l.ctx, "no accounter available in scope [%v] for user [%v]; %v", provider.Name, u.Name, err)
 				}
 			}
 			l.Debugf(l.ctx, "loaded user [%v] into scope [%v]", u.Name, provider.Name)
 			users[u.Name] = config.NewAAA(opts...)
 			userTotal.Inc()
 		}
-		if len(users) == 0 {
+		// proxied scopes are served upstream, they need no local users
+		if len(users) == 0 && provider.Handler.Type != config.PROXY {
 			l.Errorf(l.ctx, "no users associated to scope [%v]; skipping scope", provider.Name)
 			userScopeUnassigned.Inc()
 			continue
@@ -377,14 +522,46 @@ func (l Loader) build(c config.ServerConfig) []tq.SecretProvider {
 			continue
 		}
 		userConfig := l.configProvider.New(users)
-		handler := handlerType.New(l.ctx, userConfig, provider.Handler.Options)
+		handler := handlerType.New(context.WithValue(l.ctx, tq.ContextScope, provider.Name), userConfig, provider.Handler.Options)
+		if provider.RemAddrCheck != nil {
+			checked, err := newRemAddrCheck(l.loggerProvider, provider.Name, *provider.RemAddrCheck, handler)
+			if err != nil {
+				l.Errorf(l.ctx, "rem_addr_check error in scope [%v]; no users will be added; %v", provider.Name, err)
+				remAddrCheckBadConfig.Inc()
+				continue
+			}
+			handler = checked
+		}
+		handler = caps.wrapEnable(handler)
 		providerType := l.providerTypes[provider.Type]
 		if providerType == nil {
 			l.Errorf(l.ctx, "no provider assigned to provider type [%v] in scope [%v]; [%v] users not added", provider.Type, provider.Name, len(users))
 			secretProviderMissing.Inc()
 			continue
 		}
-		secretFunc := l.keychainProvider.Add(provider.Secret)
+		secretFunc, err := newSecretBudget(l.loggerProvider, provider.Name, provider.Budget, l.keychainProvider.Add(provider.Secret))
+		if err != nil {
+			l.Errorf(l.ctx, "secret budget error in scope [%v]; no users will be added; %v", provider.Name, err)
+			secretBudgetBadConfig.Inc()
+			continue
+		}
+		if provider.SecondarySecret != nil {
+			secondary, err := newSecretBudget(l.loggerProvider, provider.Name, provider.Budget, l.keychainProvider.Add(*provider.SecondarySecret))
+			if err != nil {
+				l.Errorf(l.ctx, "secret budget error in scope [%v]; no users will be added; %v", provider.Name, err)
+				secretBudgetBadConfig.Inc()
+				continue
+			}
+			secretFunc = withSecondary(l.loggerProvider, provider.Name, secretFunc, secondary)
+		}
+		if provider.MaxBodyLength > tq.MaxBodyLength {
+			l.Errorf(l.ctx, "max body length [%v] in scope [%v] exceeds [%v]; no users will be added", provider.MaxBodyLength, provider.Name, tq.MaxBodyLength)
+			maxBodyLengthBadConfig.Inc()
+			continue
+		}
+		if provider.MaxBodyLength > 0 {
+			secretFunc = withMaxBodyLength(provider.MaxBodyLength, secretFunc)
+		}
 		p := providerType.New(l.ctx, provider, handler, secretFunc)
 		if p == nil {
 			l.Errorf(l.ctx, "provider factory is nil in scope [%v]; no users will be added", provider.Name)
@@ -396,17 +573,70 @@ func (l Loader) build(c config.ServerConfig) []tq.SecretProvider {
 	return providers
 }
 
+// localize returns u as it is served in scope: its nested groups flattened, localized to the
+// scope and with the authenticators, accounter and authorizer of its groups reduced onto it.  A
+// group cycle is an error.
+func (l Loader) localize(scope config.SecretConfig, u config.User) (config.User, error) {
+	groups, err := resolveGroups(u)
+	if err != nil {
+		return u, err
+	}
+	u.Groups = groups
+	u.LocalizeToScope(scope.Name)
+	l.reduceAuthenticatorAccounterFromGroups(scope.Name, &u)
+	reduceAccounterFromScope(scope, &u)
+	reduceEnableFromGroups(&u)
+	reduceAuthorizerFromGroups(&u)
+	return u, nil
+}
+
+// reduceAccounterFromScope applies the scope accounter to the user, unless the user or one of its
+// groups sets one.  The user's accounter takes precedence, then its first group's, then the scope's.
+func reduceAccounterFromScope(scope config.SecretConfig, u *config.User) {
+	if u.Accounter == nil {
+		u.Accounter = scope.Accounter
+	}
+}
+
+// newAuthorizer creates the authorizer of u, the authorizer type it selects or the authorizer
+// provider
+func (l Loader) newAuthorizer(u config.User) (tq.Handler, error) {
+	if u.Authorizer == nil {
+		return l.authorizerProvider.New(u)
+	}
+	af := l.authorizerTypes[u.Authorizer.Type]
+	if af == nil {
+		return nil, fmt.Errorf("no authorizer assigned to authorizer type [%v]", u.Authorizer.Type)
+	}
+	return af.New(u, u.Authorizer.Options)
+}
+
+// reduceAuthorizerFromGroups applies the first group authorizer to the user, unless the user sets
+// its own
+func reduceAuthorizerFromGroups(u *config.User) {
+	for _, g := range u.Groups {
+		if u.Authorizer != nil {
+			return
+		}
+		u.Authorizer = g.Authorizer
+	}
+}
+
+// reduceEnableFromGroups applies the first group enable authenticator to the user, unless the
+// user sets its own
+func reduceEnableFromGroups(u *config.User) {
+	for _, g := range u.Groups {
+		if u.Enable != nil {
+			return
+		}
+		u.Enable = g.Enable
+	}
+}
+
 // reduceAuthenticatorAccounterFromGroups applies authenticators and accounters from groups down to the user level.
 // the first occurence of either will be used exclusively over any others that subsequent groups may contain.
 // When both an authenticator and accounter have been set on the user, this loop exits.
 func (l Loader) reduceAuthenticatorAccounterFromGroups(scope string, u *config.User) {
-	if u.Authenticator != nil {
-		userOverrideAuthenticator.Inc()
-
-	}
-	if u.Accounter != nil {
-		userOverrideAccounter.Inc()
-	}
 	if u.Authenticator != nil && u.Accounter != nil {
 		l.Debugf(l.ctx, "skipping authenticator and accounter for scope [%v] user [%v], both are already set at the user level", scope, u.Name)
 		return
@@ -0,0 +1,47 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"testing"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalizeScopeAccounter(t *testing.T) {
+	l := Loader{loggerProvider: mockLogger{}}
+	scopeAccounter := &config.Accounter{Name: "prod", Type: config.FILE}
+	groupAccounter := &config.Accounter{Name: "noc", Type: config.FILE}
+	userAccounter := &config.Accounter{Name: "alice", Type: config.FILE}
+	prod := config.SecretConfig{Name: "prod", Accounter: scopeAccounter}
+
+	// the user's accounter comes first, then its groups', then the scope's
+	for _, test := range []struct {
+		name     string
+		user     config.User
+		expected *config.Accounter
+	}{
+		{"user", config.User{Name: "alice", Accounter: userAccounter, Groups: []config.Group{{Name: "noc", Accounter: groupAccounter}}}, userAccounter},
+		{"group", config.User{Name: "alice", Groups: []config.Group{{Name: "noc", Accounter: groupAccounter}}}, groupAccounter},
+		{"scope", config.User{Name: "alice", Groups: []config.Group{{Name: "noc"}}}, scopeAccounter},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := l.localize(prod, test.user)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, u.Accounter)
+		})
+	}
+
+	// scopes without an accounter leave users without one
+	u, err := l.localize(config.SecretConfig{Name: "lab"}, config.User{Name: "alice"})
+	require.NoError(t, err)
+	assert.Nil(t, u.Accounter)
+}
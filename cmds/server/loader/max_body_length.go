@@ -0,0 +1,26 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// withMaxBodyLength wraps a scope's secret func so that the connections it returns a secret for
+// accept bodies of at most n bytes, in place of the server's limit
+func withMaxBodyLength(n uint32, fn secretFunc) secretFunc {
+	return func(ctx context.Context, key string) ([]byte, error) {
+		secret, err := fn(ctx, key)
+		if err == nil && secret != nil {
+			tq.SetConnMaxBodyLength(ctx, n)
+		}
+		return secret, err
+	}
+}
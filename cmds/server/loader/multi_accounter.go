@@ -0,0 +1,186 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+const defaultMultiAccounterTimeout = 2 * time.Second
+
+// newAccounter creates the accounter a selects from the registered accounter types.  MULTI
+// accounters are built here, from the accounter types of their sinks.
+func (l Loader) newAccounter(a config.Accounter) (tq.Handler, error) {
+	if a.Type != config.MULTI {
+		acf := l.accounterTypes[a.Type]
+		if acf == nil {
+			return nil, fmt.Errorf("no accounter assigned to accounter type [%v]", a.Type)
+		}
+		return acf.New(a.Options), nil
+	}
+	m, err := newMultiAccounter(l.loggerProvider, a.Options)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range a.Accounters {
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("%v", i)
+		}
+		if s.Type == config.MULTI {
+			return nil, fmt.Errorf("multi accounter [%v] cannot write to multi accounter [%v]", a.Name, name)
+		}
+		h, err := l.newAccounter(s)
+		if err != nil {
+			return nil, fmt.Errorf("sink [%v] of multi accounter [%v]; %v", name, a.Name, err)
+		}
+		m.sinks = append(m.sinks, sink{name: name, handler: h})
+	}
+	if len(m.sinks) == 0 {
+		return nil, fmt.Errorf("multi accounter [%v] has no accounters", a.Name)
+	}
+	return m, nil
+}
+
+// newMultiAccounter reads the options of a MULTI accounter
+//
+// timeout - how long to wait for the sinks before replying to the device, a go duration, eg 2s
+// require - any (the default) replies success once any sink succeeds, all only once every sink does
+func newMultiAccounter(l loggerProvider, options map[string]string) (*multiAccounter, error) {
+	m := &multiAccounter{loggerProvider: l, timeout: defaultMultiAccounterTimeout}
+	if v, ok := options["timeout"]; ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout option [%v] for multi accounter, a positive duration is required", v)
+		}
+		m.timeout = timeout
+	}
+	switch options["require"] {
+	case "", "any":
+	case "all":
+		m.requireAll = true
+	default:
+		return nil, fmt.Errorf("invalid require option [%v] for multi accounter, any or all are supported", options["require"])
+	}
+	return m, nil
+}
+
+// sink is an accounter a multiAccounter writes to
+type sink struct {
+	name    string
+	handler tq.Handler
+}
+
+// multiAccounter writes every accounting record to each of its sinks concurrently.  A slow sink
+// never holds up the others, nor the reply to the device for longer than the timeout; sinks that
+// have not replied by then are counted as timed out and left to finish in the background.
+type multiAccounter struct {
+	loggerProvider
+	sinks      []sink
+	timeout    time.Duration
+	requireAll bool
+}
+
+// sinkResult is the outcome of writing a record to the sink at index
+type sinkResult struct {
+	index int
+	ok    bool
+}
+
+// Handle implements tq.Handler
+func (m *multiAccounter) Handle(response tq.Response, request tq.Request) {
+	// sinks may outlive Handle, when the request's body is reused
+	request.Body = append([]byte(nil), request.Body...)
+	// buffered so sinks that finish after the timeout do not block
+	results := make(chan sinkResult, len(m.sinks))
+	for i, s := range m.sinks {
+		go func(i int, s sink) {
+			r := &sinkResponse{}
+			s.handler.Handle(r, request)
+			results <- sinkResult{index: i, ok: r.succeeded()}
+		}(i, s)
+	}
+	timer := time.NewTimer(m.timeout)
+	defer timer.Stop()
+	done := make([]bool, len(m.sinks))
+	succeeded := 0
+wait:
+	for pending := len(m.sinks); pending > 0; pending-- {
+		select {
+		case r := <-results:
+			done[r.index] = true
+			if r.ok {
+				succeeded++
+				continue
+			}
+			multiAccounterSinkError.WithLabelValues(m.sinks[r.index].name).Inc()
+			m.Errorf(request.Context, "accounting sink [%v] failed to write record", m.sinks[r.index].name)
+		case <-timer.C:
+			for i, d := range done {
+				if !d {
+					multiAccounterSinkTimeout.WithLabelValues(m.sinks[i].name).Inc()
+					m.Errorf(request.Context, "accounting sink [%v] did not reply within [%v]", m.sinks[i].name, m.timeout)
+				}
+			}
+			break wait
+		}
+	}
+	if succeeded == 0 || (m.requireAll && succeeded < len(m.sinks)) {
+		multiAccounterFailed.Inc()
+		response.Reply(
+			tq.NewAcctReply(
+				tq.SetAcctReplyStatus(tq.AcctReplyStatusError),
+				tq.SetAcctReplyServerMsg("accounting failure"),
+			),
+		)
+		return
+	}
+	response.Reply(
+		tq.NewAcctReply(
+			tq.SetAcctReplyStatus(tq.AcctReplyStatusSuccess),
+		),
+	)
+}
+
+// sinkResponse captures the reply of a sink in place of the device
+type sinkResponse struct {
+	reply *tq.AcctReply
+}
+
+// succeeded reports whether the sink replied success
+func (r *sinkResponse) succeeded() bool {
+	return r.reply != nil && r.reply.Status == tq.AcctReplyStatusSuccess
+}
+
+// Reply implements tq.Response
+func (r *sinkResponse) Reply(v tq.EncoderDecoder) (int, error) {
+	r.reply, _ = v.(*tq.AcctReply)
+	return 0, nil
+}
+
+// ReplyWithContext implements tq.Response
+func (r *sinkResponse) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writers ...tq.Writer) (int, error) {
+	return r.Reply(v)
+}
+
+// Write implements tq.Response, sinks write nothing to the device
+func (r *sinkResponse) Write(p *tq.Packet) (int, error) { return 0, nil }
+
+// Next implements tq.Response, accounting exchanges are a single packet
+func (r *sinkResponse) Next(next tq.Handler) {}
+
+// RegisterWriter implements tq.Response
+func (r *sinkResponse) RegisterWriter(tq.Writer) {}
+
+// Context implements tq.Response
+func (r *sinkResponse) Context(ctx context.Context) {}
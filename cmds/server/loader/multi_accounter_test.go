@@ -0,0 +1,95 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAccounter replies with the status in its options, after the delay in its options
+type stubAccounter struct {
+	written chan string
+}
+
+func (a stubAccounter) New(options map[string]string) tq.Handler {
+	return tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		if d, err := time.ParseDuration(options["delay"]); err == nil {
+			time.Sleep(d)
+		}
+		status := tq.AcctReplyStatusSuccess
+		if options["fail"] != "" {
+			status = tq.AcctReplyStatusError
+		}
+		a.written <- options["name"]
+		response.Reply(tq.NewAcctReply(tq.SetAcctReplyStatus(status)))
+	})
+}
+
+func TestMultiAccounter(t *testing.T) {
+	written := make(chan string, 10)
+	l := Loader{
+		loggerProvider: mockLogger{},
+		accounterTypes: map[config.AccounterType]accounterFactory{config.FILE: stubAccounter{written}},
+	}
+	multi := func(options map[string]string, sinks ...config.Accounter) tq.Handler {
+		h, err := l.newAccounter(config.Accounter{Name: "multi", Type: config.MULTI, Options: options, Accounters: sinks})
+		require.NoError(t, err)
+		return h
+	}
+	status := func(h tq.Handler) tq.AcctReplyStatus {
+		r := &sinkResponse{}
+		h.Handle(r, tq.Request{Context: context.Background()})
+		require.NotNil(t, r.reply)
+		return r.reply.Status
+	}
+	file := func(name string, options ...string) config.Accounter {
+		a := config.Accounter{Name: name, Type: config.FILE, Options: map[string]string{"name": name}}
+		for i := 0; i+1 < len(options); i += 2 {
+			a.Options[options[i]] = options[i+1]
+		}
+		return a
+	}
+
+	// every sink is written to
+	assert.Equal(t, tq.AcctReplyStatusSuccess, status(multi(nil, file("a"), file("b"))))
+	assert.ElementsMatch(t, []string{"a", "b"}, []string{<-written, <-written})
+
+	// a failed sink only fails the record when every sink is required
+	assert.Equal(t, tq.AcctReplyStatusSuccess, status(multi(nil, file("a"), file("b", "fail", "true"))))
+	assert.Equal(t, tq.AcctReplyStatusError, status(multi(map[string]string{"require": "all"}, file("a"), file("b", "fail", "true"))))
+	assert.Equal(t, tq.AcctReplyStatusError, status(multi(nil, file("a", "fail", "true"))))
+	for i := 0; i < 5; i++ {
+		<-written
+	}
+
+	// slow sinks do not hold up the reply
+	start := time.Now()
+	assert.Equal(t, tq.AcctReplyStatusSuccess, status(multi(map[string]string{"timeout": "50ms"}, file("a"), file("slow", "delay", "5s"))))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, "a", <-written)
+	assert.Equal(t, tq.AcctReplyStatusError, status(multi(map[string]string{"timeout": "50ms", "require": "all"}, file("a"), file("slow", "delay", "5s"))))
+
+	for _, bad := range []config.Accounter{
+		{Type: config.MULTI},
+		{Type: config.MULTI, Accounters: []config.Accounter{{Type: config.WEBHOOK}}},
+		{Type: config.MULTI, Accounters: []config.Accounter{{Type: config.MULTI}}},
+		{Type: config.MULTI, Options: map[string]string{"timeout": "soon"}, Accounters: []config.Accounter{file("a")}},
+		{Type: config.MULTI, Options: map[string]string{"require": "most"}, Accounters: []config.Accounter{file("a")}},
+	} {
+		_, err := l.newAccounter(bad)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,327 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// ErrNotInOverlay is returned when removing a user, scope or disabled user the overlay does not hold
+var ErrNotInOverlay = errors.New("not in overlay")
+
+// Overlay holds the changes made to the running config at runtime, eg through the admin api when
+// the config pipeline is down.  The overlay is layered on every config the loader builds, so
+// changes survive config reloads and pushes, but it is only held in memory and is lost on restart.
+type Overlay struct {
+	// Users replace every user of the config with the same name, or are added
+	Users []config.User `json:"users,omitempty"`
+	// Disabled names users that are not loaded, including those of Users
+	Disabled []string `json:"disabled,omitempty"`
+	// Secrets replace the scope of the config with the same name, or are added
+	Secrets []config.SecretConfig `json:"secrets,omitempty"`
+}
+
+// copy returns an overlay that shares no lists with o
+func (o Overlay) copy() Overlay {
+	return Overlay{
+		Users:    append([]config.User(nil), o.Users...),
+		Disabled: append([]string(nil), o.Disabled...),
+		Secrets:  append([]config.SecretConfig(nil), o.Secrets...),
+	}
+}
+
+// apply returns c with the overlay layered on top
+func (o Overlay) apply(c config.ServerConfig) config.ServerConfig {
+	if len(o.Users) == 0 && len(o.Disabled) == 0 && len(o.Secrets) == 0 {
+		return c
+	}
+	replaced := map[string]bool{}
+	for _, u := range o.Users {
+		replaced[u.Name] = true
+	}
+	disabled := map[string]bool{}
+	for _, name := range o.Disabled {
+		disabled[name] = true
+	}
+	users := make([]config.User, 0, len(c.Users)+len(o.Users))
+	for _, u := range c.Users {
+		if !replaced[u.Name] && !disabled[u.Name] {
+			users = append(users, u)
+		}
+	}
+	for _, u := range o.Users {
+		if !disabled[u.Name] {
+			users = append(users, u)
+		}
+	}
+	c.Users = users
+
+	secrets := make([]config.SecretConfig, 0, len(c.Secrets)+len(o.Secrets))
+	secrets = append(secrets, c.Secrets...)
+	for _, s := range o.Secrets {
+		i := 0
+		for ; i < len(secrets); i++ {
+			if secrets[i].Name == s.Name {
+				break
+			}
+		}
+		if i < len(secrets) {
+			secrets[i] = s
+			continue
+		}
+		secrets = append(secrets, s)
+	}
+	c.Secrets = secrets
+	return c
+}
+
+// setUser replaces the overlay user named u.Name, or adds u
+func (o *Overlay) setUser(u config.User) {
+	for i := range o.Users {
+		if o.Users[i].Name == u.Name {
+			o.Users[i] = u
+			return
+		}
+	}
+	o.Users = append(o.Users, u)
+}
+
+// removeUser removes the overlay user named name
+func (o *Overlay) removeUser(name string) error {
+	for i := range o.Users {
+		if o.Users[i].Name == name {
+			o.Users = append(o.Users[:i], o.Users[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("user [%v] %w", name, ErrNotInOverlay)
+}
+
+// disable disables the user named name, wherever it is configured
+func (o *Overlay) disable(name string) {
+	for _, d := range o.Disabled {
+		if d == name {
+			return
+		}
+	}
+	o.Disabled = append(o.Disabled, name)
+}
+
+// enable reverses disable
+func (o *Overlay) enable(name string) error {
+	for i, d := range o.Disabled {
+		if d == name {
+			o.Disabled = append(o.Disabled[:i], o.Disabled[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("disabled user [%v] %w", name, ErrNotInOverlay)
+}
+
+// setSecret replaces the overlay scope named s.Name, or adds s
+func (o *Overlay) setSecret(s config.SecretConfig) {
+	for i := range o.Secrets {
+		if o.Secrets[i].Name == s.Name {
+			o.Secrets[i] = s
+			return
+		}
+	}
+	o.Secrets = append(o.Secrets, s)
+}
+
+// removeSecret removes the overlay scope named name
+func (o *Overlay) removeSecret(name string) error {
+	for i := range o.Secrets {
+		if o.Secrets[i].Name == name {
+			o.Secrets = append(o.Secrets[:i], o.Secrets[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("scope [%v] %w", name, ErrNotInOverlay)
+}
+
+// changeRequest is an overlay change waiting to be validated and applied by the update loop
+type changeRequest struct {
+	change func(o *Overlay) error
+	cb     chan changeResult
+}
+
+type changeResult struct {
+	result PushResult
+	err    error
+}
+
+// Snapshot is the config the loader is serving
+type Snapshot struct {
+	// Config is the config last loaded or pushed, with the overlay applied
+	Config  config.ServerConfig
+	Overlay Overlay
+}
+
+// change applies change to a copy of the overlay and validates the config it layers on.  The change
+// is kept, and the running providers replaced, unless it introduces errors the config did not
+// already have; errors that predate it never block a break glass change.
+func (l *Loader) change(ctx context.Context, change func(o *Overlay) error) (PushResult, error) {
+	c := changeRequest{change: change, cb: make(chan changeResult, 1)}
+	select {
+	case l.changes <- c:
+	case <-ctx.Done():
+		return PushResult{}, ctx.Err()
+	case <-l.ctx.Done():
+		return PushResult{}, fmt.Errorf("loader is stopped")
+	}
+	select {
+	case r := <-c.cb:
+		return r.result, r.err
+	case <-ctx.Done():
+		return PushResult{}, ctx.Err()
+	}
+}
+
+// SetUser adds u to the overlay, replacing every configured user of the same name
+func (l *Loader) SetUser(ctx context.Context, u config.User) (PushResult, error) {
+	if u.Name == "" {
+		return PushResult{}, fmt.Errorf("user has no name")
+	}
+	return l.change(ctx, func(o *Overlay) error {
+		o.setUser(u)
+		return nil
+	})
+}
+
+// RemoveUser removes the user named name from the overlay, configured users of the same name are
+// served again
+func (l *Loader) RemoveUser(ctx context.Context, name string) (PushResult, error) {
+	return l.change(ctx, func(o *Overlay) error { return o.removeUser(name) })
+}
+
+// DisableUser stops serving the user named name until it is enabled again
+func (l *Loader) DisableUser(ctx context.Context, name string) (PushResult, error) {
+	if name == "" {
+		return PushResult{}, fmt.Errorf("user has no name")
+	}
+	return l.change(ctx, func(o *Overlay) error {
+		o.disable(name)
+		return nil
+	})
+}
+
+// EnableUser serves a user disabled with DisableUser again
+func (l *Loader) EnableUser(ctx context.Context, name string) (PushResult, error) {
+	return l.change(ctx, func(o *Overlay) error { return o.enable(name) })
+}
+
+// SetSecret adds s to the overlay, replacing the configured scope of the same name
+func (l *Loader) SetSecret(ctx context.Context, s config.SecretConfig) (PushResult, error) {
+	if s.Name == "" {
+		return PushResult{}, fmt.Errorf("scope has no name")
+	}
+	return l.change(ctx, func(o *Overlay) error {
+		o.setSecret(s)
+		return nil
+	})
+}
+
+// RemoveSecret removes the scope named name from the overlay, a configured scope of the same name
+// is served again
+func (l *Loader) RemoveSecret(ctx context.Context, name string) (PushResult, error) {
+	return l.change(ctx, func(o *Overlay) error { return o.removeSecret(name) })
+}
+
+// ClearOverlay drops every runtime change, eg once the config pipeline has caught up
+func (l *Loader) ClearOverlay(ctx context.Context) (PushResult, error) {
+	return l.change(ctx, func(o *Overlay) error {
+		*o = Overlay{}
+		return nil
+	})
+}
+
+// Snapshot returns the config the loader is serving
+func (l *Loader) Snapshot(ctx context.Context) (Snapshot, error) {
+	cb := make(chan Snapshot, 1)
+	select {
+	case l.snapshots <- cb:
+	case <-ctx.Done():
+		return Snapshot{}, ctx.Err()
+	case <-l.ctx.Done():
+		return Snapshot{}, fmt.Errorf("loader is stopped")
+	}
+	select {
+	case s := <-cb:
+		return s, nil
+	case <-ctx.Done():
+		return Snapshot{}, ctx.Err()
+	}
+}
+
+// Reload loads the config from its source again, as if the config file had changed.  Only loaders
+// created with NewLocalConfig can reload.
+func (l *Loader) Reload() error {
+	if l.reload == nil {
+		return fmt.Errorf("config source cannot be reloaded")
+	}
+	return l.reload()
+}
+
+// EffectiveUser is a user as it is served in a scope
+type EffectiveUser struct {
+	Scope string      `json:"scope"`
+	User  config.User `json:"user"`
+	// Error says why the user is not served in the scope, eg a group cycle
+	Error string `json:"error,omitempty"`
+}
+
+// Effective returns the users named name in c as they are served, in each of their scopes: with
+// their template and the defaults applied, their groups resolved, and localized to the scope.
+func (l *Loader) Effective(c config.ServerConfig, name string) []EffectiveUser {
+	expanded, _ := expandUsers(c)
+	var effective []EffectiveUser
+	for _, provider := range c.Secrets {
+		var e *EffectiveUser
+		for _, u := range expanded {
+			if u.Name != name || !u.HasScope(provider.Name) {
+				continue
+			}
+			// later users of the same name replace earlier ones, as they do in build
+			localized, err := l.localize(provider, u)
+			e = &EffectiveUser{Scope: provider.Name, User: localized}
+			if err != nil {
+				e.Error = err.Error()
+			}
+		}
+		if e != nil {
+			effective = append(effective, *e)
+		}
+	}
+	return effective
+}
+
+// errorSet returns the messages of the errors among diagnostics
+func errorSet(diagnostics []Diagnostic) map[string]bool {
+	errs := map[string]bool{}
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			errs[d.Message] = true
+		}
+	}
+	return errs
+}
+
+// introducesErrors reports whether diagnostics has errors that are not in known
+func introducesErrors(known map[string]bool, diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError && !known[d.Message] {
+			return true
+		}
+	}
+	return false
+}
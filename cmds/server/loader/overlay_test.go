@@ -0,0 +1,135 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chanSource serves the configs sent on it
+type chanSource chan config.ServerConfig
+
+func (s chanSource) Config() chan config.ServerConfig { return s }
+
+func userNames(c config.ServerConfig) []string {
+	var names []string
+	for _, u := range c.Users {
+		names = append(names, u.Name)
+	}
+	return names
+}
+
+func TestOverlayApply(t *testing.T) {
+	c := config.ServerConfig{
+		Secrets: []config.SecretConfig{{Name: "lab", Type: config.PREFIX}, {Name: "prod", Type: config.PREFIX}},
+		Users:   []config.User{{Name: "alice", Scopes: []string{"lab"}}, {Name: "alice", Scopes: []string{"prod"}}, {Name: "bob"}},
+	}
+	assert.Equal(t, c, Overlay{}.apply(c))
+
+	o := Overlay{
+		Users:    []config.User{{Name: "alice", Scopes: []string{"prod"}, DefaultAction: config.PERMIT}, {Name: "carol"}, {Name: "dave"}},
+		Disabled: []string{"bob", "dave"},
+		Secrets:  []config.SecretConfig{{Name: "prod", Type: config.DNS}, {Name: "dr", Type: config.PREFIX}},
+	}
+	got := o.apply(c)
+	// every user of a replaced name is replaced, disabled users are dropped wherever they are from
+	assert.Equal(t, []config.User{{Name: "alice", Scopes: []string{"prod"}, DefaultAction: config.PERMIT}, {Name: "carol"}}, got.Users)
+	assert.Equal(t, []config.SecretConfig{{Name: "lab", Type: config.PREFIX}, {Name: "prod", Type: config.DNS}, {Name: "dr", Type: config.PREFIX}}, got.Secrets)
+	// the config applied to is not changed
+	assert.Len(t, c.Users, 3)
+	assert.Equal(t, config.PREFIX, c.Secrets[1].Type)
+
+	assert.True(t, errors.Is(o.removeUser("erin"), ErrNotInOverlay))
+	assert.True(t, errors.Is(o.enable("carol"), ErrNotInOverlay))
+	assert.True(t, errors.Is(o.removeSecret("staging"), ErrNotInOverlay))
+	require.NoError(t, o.enable("dave"))
+	assert.Equal(t, []string{"alice", "carol", "dave"}, userNames(o.apply(c)))
+}
+
+func TestOverlayChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	source := make(chanSource, 1)
+	l, err := NewLoader(
+		ctx,
+		source,
+		SetLoggerProvider(mockLogger{}),
+		SetKeychainProvider(stubKeychain{}),
+		SetConfigProvider(config.New()),
+		SetAuthorizerProvider(stubAuthorizer{}),
+		RegisterHandlerType(config.START, stubHandler{}),
+		RegisterSecretProviderType(config.PREFIX, stubSecretProvider{}),
+	)
+	require.NoError(t, err)
+	localhost := config.SecretConfig{Name: "localhost", Type: config.PREFIX, Handler: config.Handler{Type: config.START}}
+	source <- config.ServerConfig{
+		Secrets: []config.SecretConfig{localhost},
+		Users: []config.User{
+			{Name: "alice", Scopes: []string{"localhost"}},
+			{Name: "bob", Scopes: []string{"localhost"}, Groups: []config.Group{{Name: "noc", DefaultAction: config.PERMIT}}},
+		},
+	}
+	l.BlockUntilLoaded()
+
+	result, err := l.SetUser(ctx, config.User{Name: "carol", Scopes: []string{"localhost"}})
+	require.NoError(t, err)
+	assert.True(t, result.Applied)
+	result, err = l.DisableUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.True(t, result.Applied)
+	snapshot, err := l.Snapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob", "carol"}, userNames(snapshot.Config))
+	assert.Equal(t, []string{"alice"}, snapshot.Overlay.Disabled)
+
+	// effective users are localized with their groups reduced
+	effective := l.Effective(snapshot.Config, "bob")
+	require.Len(t, effective, 1)
+	assert.Equal(t, "localhost", effective[0].Scope)
+	assert.Equal(t, []string{"localhost"}, effective[0].User.Scopes)
+	require.Len(t, effective[0].User.Groups, 1)
+	assert.Equal(t, "noc", effective[0].User.Groups[0].Name)
+	assert.Empty(t, l.Effective(snapshot.Config, "alice"))
+
+	// changes that introduce errors are not applied
+	result, err = l.SetUser(ctx, config.User{Name: "dave", Scopes: []string{"localhost"}, Authenticator: &config.Authenticator{Type: config.BCRYPT}})
+	require.NoError(t, err)
+	assert.False(t, result.Applied)
+	assert.True(t, HasErrors(result.Diagnostics))
+	_, err = l.RemoveUser(ctx, "dave")
+	assert.True(t, errors.Is(err, ErrNotInOverlay))
+
+	// the overlay is layered on configs loaded later
+	source <- config.ServerConfig{
+		Secrets: []config.SecretConfig{localhost},
+		Users:   []config.User{{Name: "alice", Scopes: []string{"localhost"}}, {Name: "erin", Scopes: []string{"localhost"}}},
+	}
+	assert.Eventually(t, func() bool {
+		snapshot, err := l.Snapshot(ctx)
+		return err == nil && assert.ObjectsAreEqual([]string{"erin", "carol"}, userNames(snapshot.Config))
+	}, time.Second*5, time.Millisecond*10)
+
+	result, err = l.ClearOverlay(ctx)
+	require.NoError(t, err)
+	assert.True(t, result.Applied)
+	snapshot, err = l.Snapshot(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "erin"}, userNames(snapshot.Config))
+	assert.Equal(t, Overlay{}, snapshot.Overlay)
+
+	// only local configs reload
+	assert.Error(t, l.Reload())
+}
@@ -0,0 +1,190 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// privLvlCap is the highest privilege level authorized to clients in prefix
+type privLvlCap struct {
+	prefix *net.IPNet
+	max    tq.PrivLvl
+}
+
+// privLvlCaps bound the privilege level authorized by source prefix, regardless of user config
+type privLvlCaps []privLvlCap
+
+// newPrivLvlCaps parses the caps of the config, skipping and reporting the invalid ones
+func newPrivLvlCaps(caps []config.PrivLvlCap) (privLvlCaps, []error) {
+	var parsed privLvlCaps
+	var errs []error
+	for _, c := range caps {
+		if err := tq.PrivLvl(c.MaxPrivLvl).Validate(nil); err != nil {
+			errs = append(errs, fmt.Errorf("bad priv_lvl_caps max_priv_lvl [%v] for prefixes %v; %v", c.MaxPrivLvl, c.Prefixes, err))
+			continue
+		}
+		for _, cidr := range c.Prefixes {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("bad priv_lvl_caps prefix [%v]; %v", cidr, err))
+				continue
+			}
+			parsed = append(parsed, privLvlCap{prefix: ipNet, max: tq.PrivLvl(c.MaxPrivLvl)})
+		}
+	}
+	return parsed, errs
+}
+
+// max returns the lowest cap of the prefixes that contain remote, ok is false if none do
+func (c privLvlCaps) max(remote string) (max tq.PrivLvl, ok bool) {
+	ip := net.ParseIP(remote)
+	if ip == nil {
+		return 0, false
+	}
+	for _, limit := range c {
+		if limit.prefix.Contains(ip) && (!ok || limit.max < max) {
+			max, ok = limit.max, true
+		}
+	}
+	return max, ok
+}
+
+// wrap returns next bounded by the caps, or next itself if there are none
+func (c privLvlCaps) wrap(next tq.Handler) tq.Handler {
+	if len(c) == 0 {
+		return next
+	}
+	return &privLvlCapHandler{caps: c, next: next}
+}
+
+// privLvlCapHandler wraps an authorizer.  Requests made at a privilege level above the cap of
+// the client fail, and the priv-lvl args of the replies are lowered to the cap.
+type privLvlCapHandler struct {
+	caps privLvlCaps
+	next tq.Handler
+}
+
+// Handle implements tq.Handler
+func (h *privLvlCapHandler) Handle(response tq.Response, request tq.Request) {
+	remote, _ := request.Context.Value(tq.ContextConnRemoteAddr).(string)
+	max, ok := h.caps.max(remote)
+	if !ok {
+		h.next.Handle(response, request)
+		return
+	}
+	// requests that do not decode are left for the authorizer to fail
+	var body tq.AuthorRequest
+	if err := request.Unmarshal(&body); err == nil && body.PrivLvl > max {
+		privLvlCapDenied.Inc()
+		response.Reply(
+			tq.NewAuthorReply(
+				tq.SetAuthorReplyStatus(tq.AuthorStatusFail),
+				tq.SetAuthorReplyServerMsg(fmt.Sprintf("privilege level %d is not allowed from this network", body.PrivLvl)),
+			),
+		)
+		return
+	}
+	h.next.Handle(tq.WrapResponse(&privLvlCapResponse{Response: response, max: max}, response), request)
+}
+
+// wrapEnable returns the handler of a scope bounded by the caps, or next itself if there are none
+func (c privLvlCaps) wrapEnable(next tq.Handler) tq.Handler {
+	if len(c) == 0 {
+		return next
+	}
+	return &privLvlCapEnable{caps: c, next: next}
+}
+
+// privLvlCapEnable wraps the handler of a scope.  Enable requests, which ask the client to grant
+// the privilege level of their start packet once authenticated, fail when that level is above the
+// cap of the client.  The scope handler only sees the first packet of a session, the only one
+// carrying the level.
+type privLvlCapEnable struct {
+	caps privLvlCaps
+	next tq.Handler
+}
+
+// Handle implements tq.Handler
+func (h *privLvlCapEnable) Handle(response tq.Response, request tq.Request) {
+	if request.Header.Type != tq.Authenticate {
+		h.next.Handle(response, request)
+		return
+	}
+	remote, _ := request.Context.Value(tq.ContextConnRemoteAddr).(string)
+	max, ok := h.caps.max(remote)
+	if !ok {
+		h.next.Handle(response, request)
+		return
+	}
+	// starts that do not decode are left for the scope handler to fail
+	var body tq.AuthenStart
+	if err := request.Unmarshal(&body); err == nil && body.Service == tq.AuthenServiceEnable && body.PrivLvl > max {
+		privLvlCapDenied.Inc()
+		response.Reply(
+			tq.NewAuthenReply(
+				tq.SetAuthenReplyStatus(tq.AuthenStatusFail),
+				tq.SetAuthenReplyServerMsg(fmt.Sprintf("privilege level %d is not allowed from this network", body.PrivLvl)),
+			),
+		)
+		return
+	}
+	h.next.Handle(response, request)
+}
+
+// privLvlCapResponse lowers the priv-lvl args of authorization replies to max
+type privLvlCapResponse struct {
+	tq.Response
+	max tq.PrivLvl
+}
+
+// Reply implements tq.Response
+func (r *privLvlCapResponse) Reply(v tq.EncoderDecoder) (int, error) {
+	return r.Response.Reply(r.lower(v))
+}
+
+// ReplyWithContext implements tq.Response
+func (r *privLvlCapResponse) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writers ...tq.Writer) (int, error) {
+	return r.Response.ReplyWithContext(ctx, r.lower(v), writers...)
+}
+
+// lower returns a copy of v with its priv-lvl args lowered to max.  An arg that is not a valid
+// level is replaced by max too, as the client's reading of it is unknown.
+func (r *privLvlCapResponse) lower(v tq.EncoderDecoder) tq.EncoderDecoder {
+	reply, ok := v.(*tq.AuthorReply)
+	if !ok {
+		return v
+	}
+	var args tq.Args
+	for i, arg := range reply.Args {
+		a, s, value := arg.ASV()
+		if a != "priv-lvl" {
+			continue
+		}
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 && n <= int(r.max) {
+			continue
+		}
+		if args == nil {
+			args = append(tq.Args{}, reply.Args...)
+		}
+		args[i] = tq.Arg(a + s + strconv.Itoa(int(r.max)))
+	}
+	if args == nil {
+		return v
+	}
+	privLvlCapLowered.Inc()
+	lowered := *reply
+	lowered.Args = args
+	return &lowered
+}
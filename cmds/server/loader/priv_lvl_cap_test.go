@@ -0,0 +1,139 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authorRecorder records the authorization reply it is given
+type authorRecorder struct {
+	tq.Response
+	reply *tq.AuthorReply
+}
+
+func (r *authorRecorder) Reply(v tq.EncoderDecoder) (int, error) {
+	r.reply, _ = v.(*tq.AuthorReply)
+	return 0, nil
+}
+
+func TestPrivLvlCaps(t *testing.T) {
+	caps, errs := newPrivLvlCaps([]config.PrivLvlCap{
+		{Prefixes: []string{"10.0.0.0/8", "2001:db8::/32"}, MaxPrivLvl: 7},
+		{Prefixes: []string{"10.1.0.0/16"}, MaxPrivLvl: 1},
+		{Prefixes: []string{"bad"}, MaxPrivLvl: 1},
+		{Prefixes: []string{"192.168.0.0/16"}, MaxPrivLvl: 16},
+	})
+	assert.Len(t, errs, 2)
+	assert.Len(t, caps, 3)
+
+	for remote, want := range map[string]tq.PrivLvl{"10.2.3.4": 7, "10.1.2.3": 1, "2001:db8::1": 7} {
+		max, ok := caps.max(remote)
+		assert.True(t, ok, remote)
+		assert.Equal(t, want, max, remote)
+	}
+	for _, remote := range []string{"192.168.1.1", "::1", ""} {
+		_, ok := caps.max(remote)
+		assert.False(t, ok, remote)
+	}
+
+	// the authorizer grants priv 15 to anyone
+	authorizer := tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		response.Reply(tq.NewAuthorReply(tq.SetAuthorReplyStatus(tq.AuthorStatusPassAdd), tq.SetAuthorReplyArgs("priv-lvl=15", "priv-lvl*15", "priv-lvl=0", "acl=2")))
+	})
+	_, wrapped := privLvlCaps(nil).wrap(authorizer).(*privLvlCapHandler)
+	assert.False(t, wrapped)
+	h := caps.wrap(authorizer)
+	authorize := func(remote string, privLvl tq.PrivLvl) *tq.AuthorReply {
+		body, err := tq.NewAuthorRequest(tq.SetAuthorRequestPrivLvl(privLvl), tq.SetAuthorRequestArgs(tq.Args{"service=shell", "cmd="})).MarshalBinary()
+		require.NoError(t, err)
+		r := &authorRecorder{}
+		h.Handle(r, tq.Request{Body: body, Context: context.WithValue(context.Background(), tq.ContextConnRemoteAddr, remote)})
+		require.NotNil(t, r.reply)
+		return r.reply
+	}
+
+	// clients outside every prefix get what the authorizer grants
+	assert.Equal(t, tq.Args{"priv-lvl=15", "priv-lvl*15", "priv-lvl=0", "acl=2"}, authorize("192.168.1.1", tq.PrivLvlUser).Args)
+	// the others are lowered to their cap
+	reply := authorize("10.2.3.4", tq.PrivLvlUser)
+	assert.Equal(t, tq.AuthorStatusPassAdd, reply.Status)
+	assert.Equal(t, tq.Args{"priv-lvl=7", "priv-lvl*7", "priv-lvl=0", "acl=2"}, reply.Args)
+	// and cannot run commands above it
+	reply = authorize("10.1.2.3", tq.PrivLvlRoot)
+	assert.Equal(t, tq.AuthorStatusFail, reply.Status)
+	assert.Empty(t, reply.Args)
+}
+
+// authenRecorder records the authentication reply it is given
+type authenRecorder struct {
+	tq.Response
+	reply *tq.AuthenReply
+}
+
+func (r *authenRecorder) Reply(v tq.EncoderDecoder) (int, error) {
+	r.reply, _ = v.(*tq.AuthenReply)
+	return 0, nil
+}
+
+func TestPrivLvlCapsEnable(t *testing.T) {
+	caps, errs := newPrivLvlCaps([]config.PrivLvlCap{{Prefixes: []string{"10.0.0.0/8"}, MaxPrivLvl: 1}})
+	require.Empty(t, errs)
+	_, wrapped := privLvlCaps(nil).wrapEnable(tq.HandlerFunc(func(tq.Response, tq.Request) {})).(*privLvlCapEnable)
+	assert.False(t, wrapped)
+
+	handled := false
+	h := caps.wrapEnable(tq.HandlerFunc(func(tq.Response, tq.Request) { handled = true }))
+	start := func(remote string, service tq.AuthenService, privLvl tq.PrivLvl) (bool, *tq.AuthenReply) {
+		body, err := tq.NewAuthenStart(
+			tq.SetAuthenStartAction(tq.AuthenActionLogin),
+			tq.SetAuthenStartType(tq.AuthenTypeASCII),
+			tq.SetAuthenStartService(service),
+			tq.SetAuthenStartPrivLvl(privLvl),
+		).MarshalBinary()
+		require.NoError(t, err)
+		handled = false
+		r := &authenRecorder{}
+		h.Handle(r, tq.Request{
+			Header:  *tq.NewHeader(tq.SetHeaderType(tq.Authenticate)),
+			Body:    body,
+			Context: context.WithValue(context.Background(), tq.ContextConnRemoteAddr, remote),
+		})
+		return handled, r.reply
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		service tq.AuthenService
+		privLvl tq.PrivLvl
+		handled bool
+	}{
+		{name: "enable above the cap", remote: "10.1.2.3", service: tq.AuthenServiceEnable, privLvl: tq.PrivLvlRoot},
+		{name: "enable at the cap", remote: "10.1.2.3", service: tq.AuthenServiceEnable, privLvl: tq.PrivLvlUser, handled: true},
+		{name: "enable outside every prefix", remote: "192.168.1.1", service: tq.AuthenServiceEnable, privLvl: tq.PrivLvlRoot, handled: true},
+		{name: "login", remote: "10.1.2.3", service: tq.AuthenServiceLogin, privLvl: tq.PrivLvlRoot, handled: true},
+	}
+	for _, test := range tests {
+		handled, reply := start(test.remote, test.service, test.privLvl)
+		assert.Equal(t, test.handled, handled, test.name)
+		if test.handled {
+			assert.Nil(t, reply, test.name)
+			continue
+		}
+		require.NotNil(t, reply, test.name)
+		assert.Equal(t, tq.AuthenStatusFail, reply.Status, test.name)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// PushResult is the outcome of Push
+type PushResult struct {
+	// Applied is true if the config replaced the running one
+	Applied     bool
+	Diagnostics []Diagnostic
+}
+
+// pushRequest is a config waiting to be validated and applied by the update loop
+type pushRequest struct {
+	config config.ServerConfig
+	dryRun bool
+	cb     chan PushResult
+}
+
+// Push validates c and, unless dryRun is set or validation found errors, atomically replaces the
+// running providers and prefix filters with those built from c.  The swap happens in the update
+// loop, so every connection is served with either the old config or the new one in full.  A
+// config loaded from the config source later replaces a pushed config, as any other update does.
+func (l *Loader) Push(ctx context.Context, c config.ServerConfig, dryRun bool) (PushResult, error) {
+	p := pushRequest{config: c, dryRun: dryRun, cb: make(chan PushResult, 1)}
+	select {
+	case l.push <- p:
+	case <-ctx.Done():
+		return PushResult{}, ctx.Err()
+	case <-l.ctx.Done():
+		return PushResult{}, fmt.Errorf("loader is stopped")
+	}
+	select {
+	case r := <-p.cb:
+		return r, nil
+	case <-ctx.Done():
+		return PushResult{}, ctx.Err()
+	}
+}
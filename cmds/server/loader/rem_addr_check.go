@@ -0,0 +1,111 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// newRemAddrCheck wraps the handler of a scope with the checks of c
+func newRemAddrCheck(l loggerProvider, scope string, c config.RemAddrCheck, next tq.Handler) (tq.Handler, error) {
+	r := &remAddrCheck{loggerProvider: l, scope: scope, source: c.Source, reject: c.Reject, next: next}
+	for _, cidr := range c.Prefixes {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("bad rem_addr_check prefix [%v]; %v", cidr, err)
+		}
+		r.prefixes = append(r.prefixes, ipNet)
+	}
+	for _, port := range c.Ports {
+		re, err := regexp.Compile("^(?:" + port + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("bad rem_addr_check port regex [%v]; %v", port, err)
+		}
+		r.ports = append(r.ports, re)
+	}
+	return r, nil
+}
+
+// remAddrCheck validates the rem_addr and port a client asserts in the packets starting a session.
+// Devices sometimes fill them with misleading values, eg their own address or a stale one, which
+// then pollute the audit logs.
+type remAddrCheck struct {
+	loggerProvider
+	scope    string
+	source   bool
+	prefixes []*net.IPNet
+	ports    []*regexp.Regexp
+	reject   bool
+	next     tq.Handler
+}
+
+// Handle implements tq.Handler.  The scope handler only sees the first packet of a session, the
+// only one carrying rem_addr and port.
+func (r *remAddrCheck) Handle(response tq.Response, request tq.Request) {
+	fields := request.Fields()
+	remote, _ := request.Context.Value(tq.ContextConnRemoteAddr).(string)
+	check, err := r.verify(fields["rem-addr"], fields["port"], remote)
+	if err == nil {
+		r.next.Handle(response, request)
+		return
+	}
+	remAddrMismatch.WithLabelValues(r.scope, check).Inc()
+	r.Errorf(request.Context, "client [%v] in scope [%v] asserted rem_addr [%v] port [%v] for user [%v]; %v", remote, r.scope, fields["rem-addr"], fields["port"], fields["user"], err)
+	if !r.reject {
+		r.next.Handle(response, request)
+		return
+	}
+	remAddrRejected.Inc()
+	tq.Abort(response, request, "rem_addr or port does not match this client")
+}
+
+// verify returns the check that remAddr and port fail, and why
+func (r *remAddrCheck) verify(remAddr, port, remote string) (string, error) {
+	if remAddr != "" && (r.source || len(r.prefixes) > 0) {
+		ip := net.ParseIP(strings.TrimSpace(remAddr))
+		if ip == nil {
+			return "address", fmt.Errorf("rem_addr is not an ip address")
+		}
+		if r.source && !ip.Equal(net.ParseIP(remote)) {
+			return "source", fmt.Errorf("rem_addr is not the connection source")
+		}
+		if len(r.prefixes) > 0 && !containsIP(r.prefixes, ip) {
+			return "prefix", fmt.Errorf("rem_addr is not within the expected prefixes")
+		}
+	}
+	if port != "" && len(r.ports) > 0 && !matchesAny(r.ports, port) {
+		return "port", fmt.Errorf("port does not match the expected ports")
+	}
+	return "", nil
+}
+
+// containsIP reports if any of prefixes contains ip
+func containsIP(prefixes []*net.IPNet, ip net.IP) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports if any of res matches s
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
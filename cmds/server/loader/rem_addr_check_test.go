@@ -0,0 +1,86 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// abortRecorder records whether the session was aborted
+type abortRecorder struct {
+	tq.Response
+	aborted bool
+}
+
+func (r *abortRecorder) Abort(msg string) (int, error) {
+	r.aborted = true
+	return 0, nil
+}
+
+func (r *abortRecorder) Close()      {}
+func (r *abortRecorder) Final() bool { return true }
+
+func TestRemAddrCheck(t *testing.T) {
+	_, err := newRemAddrCheck(mockLogger{}, "lab", config.RemAddrCheck{Prefixes: []string{"bad"}}, nil)
+	assert.Error(t, err)
+	_, err = newRemAddrCheck(mockLogger{}, "lab", config.RemAddrCheck{Ports: []string{"tty[0-9"}}, nil)
+	assert.Error(t, err)
+
+	handled := false
+	next := tq.HandlerFunc(func(tq.Response, tq.Request) { handled = true })
+	check := func(c config.RemAddrCheck, remAddr, port string) (bool, bool) {
+		h, err := newRemAddrCheck(mockLogger{}, "lab", c, next)
+		require.NoError(t, err)
+		body, err := tq.NewAuthorRequest(
+			tq.SetAuthorRequestUser("alice"),
+			tq.SetAuthorRequestRemAddr(tq.AuthenRemAddr(remAddr)),
+			tq.SetAuthorRequestPort(tq.AuthenPort(port)),
+			tq.SetAuthorRequestArgs(tq.Args{"service=shell", "cmd="}),
+		).MarshalBinary()
+		require.NoError(t, err)
+		handled = false
+		r := &abortRecorder{}
+		h.Handle(r, tq.Request{
+			Header:  *tq.NewHeader(tq.SetHeaderType(tq.Authorize)),
+			Body:    body,
+			Context: context.WithValue(context.Background(), tq.ContextConnRemoteAddr, "10.0.0.1"),
+		})
+		return handled, r.aborted
+	}
+
+	source := config.RemAddrCheck{Source: true, Reject: true}
+	prefixes := config.RemAddrCheck{Prefixes: []string{"192.168.0.0/16"}, Ports: []string{"tty[0-9]+", "vty[0-9]+"}, Reject: true}
+	tests := []struct {
+		name    string
+		c       config.RemAddrCheck
+		remAddr string
+		port    string
+		pass    bool
+	}{
+		{name: "source", c: source, remAddr: "10.0.0.1", port: "tty0", pass: true},
+		{name: "not source", c: source, remAddr: "10.0.0.2", port: "tty0"},
+		{name: "not an address", c: source, remAddr: "async", port: "tty0"},
+		{name: "empty fields", c: source, pass: true},
+		{name: "prefix and port", c: prefixes, remAddr: "192.168.1.1", port: "vty3", pass: true},
+		{name: "outside prefixes", c: prefixes, remAddr: "172.16.0.1", port: "vty3"},
+		{name: "unexpected port", c: prefixes, remAddr: "192.168.1.1", port: "xtty3"},
+		{name: "logged only", c: config.RemAddrCheck{Source: true}, remAddr: "10.0.0.2", pass: true},
+	}
+	for _, test := range tests {
+		handled, aborted := check(test.c, test.remAddr, test.port)
+		assert.Equal(t, test.pass, handled, test.name)
+		assert.Equal(t, !test.pass, aborted, test.name)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"sync"
+)
+
+// secondarySlotKey is the context key of a secondarySlot
+type secondarySlotKey struct{}
+
+// secondarySlot receives the secondary secret of the scope that matched a client.  The secret
+// providers only return one secret, so the secondary is passed back through the context of the
+// lookup instead.
+type secondarySlot struct {
+	sync.Mutex
+	secret []byte
+}
+
+func (s *secondarySlot) set(secret []byte) {
+	s.Lock()
+	defer s.Unlock()
+	s.secret = secret
+}
+
+func (s *secondarySlot) get() []byte {
+	s.Lock()
+	defer s.Unlock()
+	return s.secret
+}
+
+// withSecondarySlot requests the secondary secret of the matching scope be stored in slot
+func withSecondarySlot(ctx context.Context, slot *secondarySlot) context.Context {
+	return context.WithValue(ctx, secondarySlotKey{}, slot)
+}
+
+// withSecondary wraps a scope's secret func so that, when the lookup requested it, the secondary
+// secret for the same key is stored in the lookup's slot.  A failed secondary lookup is logged and
+// the client is served with the primary secret only.
+func withSecondary(l loggerProvider, scope string, primary, secondary secretFunc) secretFunc {
+	return func(ctx context.Context, key string) ([]byte, error) {
+		secret, err := primary(ctx, key)
+		if err != nil || secret == nil {
+			return secret, err
+		}
+		slot, ok := ctx.Value(secondarySlotKey{}).(*secondarySlot)
+		if !ok {
+			return secret, err
+		}
+		s, serr := secondary(ctx, key)
+		if serr != nil {
+			secondarySecretError.Inc()
+			l.Errorf(ctx, "unable to get secondary secret in scope [%v]; %v", scope, serr)
+			return secret, err
+		}
+		if len(s) > 0 {
+			slot.set(s)
+		}
+		return secret, err
+	}
+}
@@ -0,0 +1,52 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSecondary(t *testing.T) {
+	static := func(secret string, err error) secretFunc {
+		return func(ctx context.Context, key string) ([]byte, error) {
+			if err != nil {
+				return nil, err
+			}
+			return []byte(secret + ":" + key), nil
+		}
+	}
+	ctx := context.Background()
+
+	// the secondary is only looked up when the caller asks for it
+	secret, err := withSecondary(mockLogger{}, "scope", static("new", nil), static("old", nil))(ctx, "192.0.2.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "new:192.0.2.1", string(secret))
+
+	slot := &secondarySlot{}
+	secret, err = withSecondary(mockLogger{}, "scope", static("new", nil), static("old", nil))(withSecondarySlot(ctx, slot), "192.0.2.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "new:192.0.2.1", string(secret))
+	assert.Equal(t, "old:192.0.2.1", string(slot.get()))
+
+	// a failed secondary leaves the client with the primary secret
+	slot = &secondarySlot{}
+	secret, err = withSecondary(mockLogger{}, "scope", static("new", nil), static("", fmt.Errorf("unavailable")))(withSecondarySlot(ctx, slot), "192.0.2.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "new:192.0.2.1", string(secret))
+	assert.Nil(t, slot.get())
+
+	// a failed primary does not look up the secondary
+	slot = &secondarySlot{}
+	_, err = withSecondary(mockLogger{}, "scope", static("", fmt.Errorf("unavailable")), static("old", nil))(withSecondarySlot(ctx, slot), "192.0.2.1")
+	assert.Error(t, err)
+	assert.Nil(t, slot.get())
+}
@@ -0,0 +1,128 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// secretFunc is the secret callback produced by a keychainProvider
+type secretFunc func(context.Context, string) ([]byte, error)
+
+// newSecretBudget wraps secret with the scope's latency budget and fallback behavior.  If the
+// scope has no budget, secret is returned as is.
+func newSecretBudget(l loggerProvider, scope string, b *config.SecretBudget, secret secretFunc) (secretFunc, error) {
+	if b == nil {
+		return secret, nil
+	}
+	sb := &secretBudget{loggerProvider: l, scope: scope, fallback: b.Fallback, secret: secret, cache: make(map[string][]byte)}
+	if b.Timeout != "" {
+		d, err := time.ParseDuration(b.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret budget timeout [%v]; %v", b.Timeout, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("secret budget timeout must be positive [%v]", b.Timeout)
+		}
+		sb.timeout = d
+	}
+	switch b.Fallback {
+	case 0:
+		sb.fallback = config.CLOSED
+	case config.CLOSED, config.CACHED:
+	case config.STATIC:
+		if b.FallbackKey == "" {
+			return nil, fmt.Errorf("secret budget STATIC fallback requires a fallback_key")
+		}
+		sb.static = []byte(b.FallbackKey)
+	default:
+		return nil, fmt.Errorf("unknown secret budget fallback [%v]", b.Fallback)
+	}
+	return sb.get, nil
+}
+
+// secretBudget bounds the time spent in a keychain callback so that a slow or hung secret
+// backend cannot stall every connection in a scope
+type secretBudget struct {
+	loggerProvider
+	scope    string
+	timeout  time.Duration
+	fallback config.FallbackType
+	static   []byte
+	secret   secretFunc
+
+	mu    sync.RWMutex
+	cache map[string][]byte
+}
+
+type secretResult struct {
+	secret []byte
+	err    error
+}
+
+// get implements secretFunc
+func (b *secretBudget) get(ctx context.Context, key string) ([]byte, error) {
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	result := make(chan secretResult, 1)
+	go func() {
+		// a callback that ignores ctx may finish after the budget; its result still
+		// refreshes the cache for the next lookup
+		secret, err := b.secret(ctx, key)
+		if err == nil && secret != nil {
+			b.mu.Lock()
+			b.cache[key] = secret
+			b.mu.Unlock()
+		}
+		result <- secretResult{secret: secret, err: err}
+	}()
+	var err error
+	select {
+	case r := <-result:
+		secretBudgetDuration.Observe(float64(time.Since(start).Milliseconds()))
+		if r.err == nil && r.secret != nil {
+			return r.secret, nil
+		}
+		secretBudgetError.Inc()
+		err = fmt.Errorf("keychain error; %v", r.err)
+	case <-ctx.Done():
+		secretBudgetExceeded.Inc()
+		err = fmt.Errorf("keychain exceeded budget [%v]; %v", b.timeout, ctx.Err())
+	}
+	return b.fallbackSecret(ctx, key, err)
+}
+
+// fallbackSecret applies the scope's fallback behavior after the keychain failed with cause
+func (b *secretBudget) fallbackSecret(ctx context.Context, key string, cause error) ([]byte, error) {
+	switch b.fallback {
+	case config.CACHED:
+		b.mu.RLock()
+		secret, ok := b.cache[key]
+		b.mu.RUnlock()
+		if ok {
+			secretFallbackCached.Inc()
+			b.Errorf(ctx, "using cached secret in scope [%v] for [%v]; %v", b.scope, key, cause)
+			return secret, nil
+		}
+	case config.STATIC:
+		secretFallbackStatic.Inc()
+		b.Errorf(ctx, "using static fallback secret in scope [%v] for [%v]; %v", b.scope, key, cause)
+		return b.static, nil
+	}
+	secretFallbackClosed.Inc()
+	return nil, fmt.Errorf("no secret available in scope [%v] for [%v]; %v", b.scope, key, cause)
+}
@@ -0,0 +1,125 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (mockLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+// keychain returns secret after delay, or an error if fail is set
+type keychain struct {
+	sync.Mutex
+	delay time.Duration
+	fail  bool
+}
+
+func (k *keychain) set(delay time.Duration, fail bool) {
+	k.Lock()
+	defer k.Unlock()
+	k.delay, k.fail = delay, fail
+}
+
+func (k *keychain) get(ctx context.Context, key string) ([]byte, error) {
+	k.Lock()
+	delay, fail := k.delay, k.fail
+	k.Unlock()
+	if fail {
+		return nil, fmt.Errorf("keychain unavailable")
+	}
+	select {
+	case <-time.After(delay):
+		return []byte("fooman"), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestSecretBudget(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		budget   config.SecretBudget
+		expected []byte
+	}{
+		{
+			name:   "fail closed",
+			budget: config.SecretBudget{Timeout: "20ms"},
+		},
+		{
+			name:     "cached",
+			budget:   config.SecretBudget{Timeout: "20ms", Fallback: config.CACHED},
+			expected: []byte("fooman"),
+		},
+		{
+			name:     "static",
+			budget:   config.SecretBudget{Timeout: "20ms", Fallback: config.STATIC, FallbackKey: "static"},
+			expected: []byte("static"),
+		},
+	}
+	for _, test := range tests {
+		kc := &keychain{}
+		get, err := newSecretBudget(mockLogger{}, "test", &test.budget, kc.get)
+		assert.NoError(t, err, test.name)
+
+		// a healthy keychain is used as is
+		secret, err := get(ctx, "192.0.2.1")
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, []byte("fooman"), secret, test.name)
+
+		for _, fail := range []bool{false, true} {
+			kc.set(time.Second, fail)
+			start := time.Now()
+			secret, err = get(ctx, "192.0.2.1")
+			assert.Less(t, time.Since(start), 500*time.Millisecond, test.name)
+			if test.expected == nil {
+				assert.Error(t, err, test.name)
+				continue
+			}
+			assert.NoError(t, err, test.name)
+			assert.Equal(t, test.expected, secret, test.name)
+		}
+	}
+
+	// the cache is keyed, an unseen key has nothing to fall back to
+	kc := &keychain{}
+	kc.set(0, true)
+	get, err := newSecretBudget(mockLogger{}, "test", &config.SecretBudget{Fallback: config.CACHED}, kc.get)
+	assert.NoError(t, err)
+	_, err = get(ctx, "192.0.2.2")
+	assert.Error(t, err)
+}
+
+func TestSecretBudgetConfig(t *testing.T) {
+	kc := &keychain{}
+	for _, b := range []config.SecretBudget{
+		{Timeout: "soon"},
+		{Timeout: "-1s"},
+		{Fallback: config.STATIC},
+		{Fallback: config.FallbackType(42)},
+	} {
+		_, err := newSecretBudget(mockLogger{}, "test", &b, kc.get)
+		assert.Error(t, err, b)
+	}
+	get, err := newSecretBudget(mockLogger{}, "test", nil, kc.get)
+	assert.NoError(t, err)
+	assert.NotNil(t, get)
+}
@@ -0,0 +1,17 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package drivers registers the database/sql drivers the sql user directory may be read with,
+// postgres and mysql.  It is a module of its own so importers of tacquito do not pull in the
+// drivers; the server links it in when built with the sql tag.
+package drivers
+
+import (
+	// registered with database/sql as postgres and mysql
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
@@ -0,0 +1,10 @@
+module github.com/facebookincubator/tacquito/cmds/server/loader/sql/drivers
+
+go 1.18
+
+require (
+	github.com/go-sql-driver/mysql v1.7.1
+	github.com/lib/pq v1.10.9
+)
+
+replace github.com/facebookincubator/tacquito => ../../../../..
@@ -0,0 +1,377 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package sql serves users from a sql database, eg postgres or mysql, alongside the users of a
+// config file.  The directory wraps a config loader, such as the yaml loader, and adds the users,
+// groups and commands read from its tables to every config it loads.  Tables are read again every
+// refresh interval and the config is only published again when they change.
+//
+// The default queries read these tables, custom queries must return the same columns:
+//
+//	tacquito_users(name, scopes, member_of, template, hash)
+//	tacquito_groups(name, default_action)
+//	tacquito_commands(group_name, position, name, match_args, except_args, action)
+//
+// scopes and member_of are comma separated scope and group names, template names one of the
+// config's templates and hash is a bcrypt hash, which sets a bcrypt authenticator.  match_args and
+// except_args are json arrays of regexes, see config.Command.  Actions are config.Action values, 1
+// denies and 2 permits.  A group with a bad command is dropped, along with its members, rather
+// than served without it.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+const (
+	defaultUsersQuery    = "SELECT name, scopes, member_of, template, hash FROM tacquito_users ORDER BY name"
+	defaultGroupsQuery   = "SELECT name, default_action FROM tacquito_groups"
+	defaultCommandsQuery = "SELECT group_name, name, match_args, except_args, action FROM tacquito_commands ORDER BY group_name, position"
+	defaultRefresh       = time.Minute
+	defaultTimeout       = 10 * time.Second
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+}
+
+// loader is the config source the directory adds its users to
+type loader interface {
+	Load(path string) error
+	Config() chan config.ServerConfig
+}
+
+// reloader is a loader that loads its config again on demand, eg fsnotify.Watcher
+type reloader interface {
+	Reload() error
+}
+
+// Option is the setter type for Directory
+type Option func(d *Directory)
+
+// SetRefreshInterval sets how often the tables are read again, defaults to a minute.  0 disables
+// refreshing, users are then only read when the config is loaded.
+func SetRefreshInterval(interval time.Duration) Option {
+	return func(d *Directory) {
+		d.refresh = interval
+	}
+}
+
+// SetTimeout bounds the time taken to read every table, defaults to 10s
+func SetTimeout(timeout time.Duration) Option {
+	return func(d *Directory) {
+		d.timeout = timeout
+	}
+}
+
+// SetQueries replaces the default queries, eg to read views or differently named tables.  Empty
+// queries keep the default.
+func SetQueries(users, groups, commands string) Option {
+	return func(d *Directory) {
+		if users != "" {
+			d.usersQuery = users
+		}
+		if groups != "" {
+			d.groupsQuery = groups
+		}
+		if commands != "" {
+			d.commandsQuery = commands
+		}
+	}
+}
+
+// New returns a Directory adding the users of db to the configs of base.  Tables are refreshed
+// until ctx is done.
+func New(ctx context.Context, l loggerProvider, base loader, db *sql.DB, opts ...Option) *Directory {
+	d := &Directory{
+		loggerProvider: l,
+		ctx:            ctx,
+		base:           base,
+		db:             db,
+		refresh:        defaultRefresh,
+		timeout:        defaultTimeout,
+		usersQuery:     defaultUsersQuery,
+		groupsQuery:    defaultGroupsQuery,
+		commandsQuery:  defaultCommandsQuery,
+		config:         make(chan config.ServerConfig, 1),
+		refreshNow:     make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Directory loads users from a sql database
+type Directory struct {
+	loggerProvider
+	ctx           context.Context
+	base          loader
+	db            *sql.DB
+	refresh       time.Duration
+	timeout       time.Duration
+	usersQuery    string
+	groupsQuery   string
+	commandsQuery string
+	config        chan config.ServerConfig
+	refreshNow    chan struct{}
+	start         sync.Once
+	path          string
+}
+
+// Load loads path with the base loader and reads the tables.  An error is returned if either
+// fails, later refreshes that fail keep the users last read.
+func (d *Directory) Load(path string) error {
+	if err := d.base.Load(path); err != nil {
+		return err
+	}
+	file := <-d.base.Config()
+	users, err := d.read(d.ctx)
+	if err != nil {
+		return fmt.Errorf("unable to read users from sql directory; %v", err)
+	}
+	d.publish(file, users)
+	d.start.Do(func() {
+		d.path = path
+		go d.run(file, users)
+	})
+	return nil
+}
+
+// Reload loads the config of the base loader again and reads the tables without waiting for the
+// refresh interval
+func (d *Directory) Reload() error {
+	if d.path == "" {
+		return fmt.Errorf("config is not loaded")
+	}
+	var err error
+	if r, ok := d.base.(reloader); ok {
+		err = r.Reload()
+	} else {
+		err = d.base.Load(d.path)
+	}
+	select {
+	case d.refreshNow <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// Config returns the channel configs, with the users of the directory, are published on
+func (d *Directory) Config() chan config.ServerConfig {
+	return d.config
+}
+
+// run publishes the config again when the base loader reloads it, or when the tables change
+func (d *Directory) run(file config.ServerConfig, users []config.User) {
+	var refresh <-chan time.Time
+	if d.refresh > 0 {
+		t := time.NewTicker(d.refresh)
+		defer t.Stop()
+		refresh = t.C
+	}
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case file = <-d.base.Config():
+			d.publish(file, users)
+		case <-d.refreshNow:
+			users = d.reread(file, users)
+		case <-refresh:
+			users = d.reread(file, users)
+		}
+	}
+}
+
+// reread reads the tables and publishes the config again if they changed since users were read
+func (d *Directory) reread(file config.ServerConfig, users []config.User) []config.User {
+	next, err := d.read(d.ctx)
+	if err != nil {
+		d.Errorf(d.ctx, "unable to refresh users from sql directory, keeping the [%v] users last read; %v", len(users), err)
+		return users
+	}
+	if reflect.DeepEqual(next, users) {
+		return users
+	}
+	d.Infof(d.ctx, "sql directory changed, publishing [%v] users", len(next))
+	d.publish(file, next)
+	return next
+}
+
+// publish replaces any config not yet consumed with file and the users of the directory
+func (d *Directory) publish(file config.ServerConfig, users []config.User) {
+	c := file
+	c.Users = make([]config.User, 0, len(file.Users)+len(users))
+	c.Users = append(c.Users, file.Users...)
+	c.Users = append(c.Users, users...)
+	select {
+	case <-d.config:
+	default:
+	}
+	d.config <- c
+}
+
+// read returns the users of the directory.  Rows that reference unknown groups, or hold bad
+// values, are skipped and logged rather than failing the whole read.  Skipping never widens what a
+// user is permitted, as groups with a bad command are skipped whole.
+func (d *Directory) read(ctx context.Context) ([]config.User, error) {
+	start := time.Now()
+	defer func() {
+		sqlDirectoryReadDuration.Observe(float64(time.Since(start).Milliseconds()))
+	}()
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	users, err := d.readAll(ctx)
+	if err != nil {
+		sqlDirectoryReadError.Inc()
+		return nil, err
+	}
+	sqlDirectoryRead.Inc()
+	sqlDirectoryUsers.Set(float64(len(users)))
+	return users, nil
+}
+
+func (d *Directory) readAll(ctx context.Context) ([]config.User, error) {
+	groups, err := d.readGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("groups query failed; %v", err)
+	}
+	if err := d.readCommands(ctx, groups); err != nil {
+		return nil, fmt.Errorf("commands query failed; %v", err)
+	}
+	rows, err := d.db.QueryContext(ctx, d.usersQuery)
+	if err != nil {
+		return nil, fmt.Errorf("users query failed; %v", err)
+	}
+	defer rows.Close()
+	var users []config.User
+	for rows.Next() {
+		var name string
+		var scopes, memberOf, template, hash sql.NullString
+		if err := rows.Scan(&name, &scopes, &memberOf, &template, &hash); err != nil {
+			return nil, fmt.Errorf("users query failed; %v", err)
+		}
+		u := config.User{Name: name, Scopes: split(scopes.String), Template: template.String}
+		if hash.String != "" {
+			u.Authenticator = &config.Authenticator{Type: config.BCRYPT, Options: map[string]string{"hash": hash.String}}
+		}
+		skip := false
+		for _, name := range split(memberOf.String) {
+			g, ok := groups[name]
+			if !ok {
+				sqlDirectorySkipped.Inc()
+				d.Errorf(ctx, "sql directory user [%v] references unknown or invalid group [%v] and will not be added", u.Name, name)
+				skip = true
+				break
+			}
+			u.Groups = append(u.Groups, *g)
+		}
+		if !skip {
+			users = append(users, u)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("users query failed; %v", err)
+	}
+	return users, nil
+}
+
+// readGroups returns the groups of the directory by name
+func (d *Directory) readGroups(ctx context.Context) (map[string]*config.Group, error) {
+	rows, err := d.db.QueryContext(ctx, d.groupsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	groups := make(map[string]*config.Group)
+	for rows.Next() {
+		var g config.Group
+		var action sql.NullInt64
+		if err := rows.Scan(&g.Name, &action); err != nil {
+			return nil, err
+		}
+		g.DefaultAction = config.Action(action.Int64)
+		groups[g.Name] = &g
+	}
+	return groups, rows.Err()
+}
+
+// readCommands adds the commands of the directory to their groups, in order.  Groups with a bad
+// command are removed from groups.
+func (d *Directory) readCommands(ctx context.Context, groups map[string]*config.Group) error {
+	rows, err := d.db.QueryContext(ctx, d.commandsQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	invalid := map[string]bool{}
+	for rows.Next() {
+		var group, name string
+		var match, except sql.NullString
+		var action int64
+		if err := rows.Scan(&group, &name, &match, &except, &action); err != nil {
+			return err
+		}
+		if invalid[group] {
+			continue
+		}
+		g, ok := groups[group]
+		if !ok {
+			sqlDirectorySkipped.Inc()
+			d.Errorf(ctx, "sql directory command [%v] references unknown group [%v] and will not be added", name, group)
+			continue
+		}
+		c := config.Command{Name: name, Action: config.Action(action)}
+		c.Match, err = regexes(match.String)
+		if err == nil {
+			c.Except, err = regexes(except.String)
+		}
+		if err != nil {
+			sqlDirectorySkipped.Inc()
+			d.Errorf(ctx, "sql directory command [%v] of group [%v] has bad args and the group will not be added; %v", name, group, err)
+			invalid[group] = true
+			delete(groups, group)
+			continue
+		}
+		g.Commands = append(g.Commands, c)
+	}
+	return rows.Err()
+}
+
+// split splits a comma separated list, dropping empty entries
+func split(v string) []string {
+	var values []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// regexes decodes a json array of regexes, empty values have none
+func regexes(v string) ([]string, error) {
+	if strings.TrimSpace(v) == "" {
+		return nil, nil
+	}
+	var r []string
+	err := json.Unmarshal([]byte(v), &r)
+	return r, err
+}
@@ -0,0 +1,281 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (m mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (m mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (m mockLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+// fakeDB answers the directory queries from tables held in memory
+type fakeDB struct {
+	sync.Mutex
+	tables map[string][][]driver.Value
+	err    error
+}
+
+func (f *fakeDB) set(query string, rows ...[]driver.Value) {
+	f.Lock()
+	defer f.Unlock()
+	f.tables[query] = rows
+}
+
+func (f *fakeDB) fail(err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.err = err
+}
+
+var (
+	fakeMu  sync.Mutex
+	fakeDBs = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("tacquito-fake", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+	db, ok := fakeDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake db [%v]", name)
+	}
+	return fakeConn{db}, nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, fmt.Errorf("not supported") }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("not supported")
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+	if s.db.err != nil {
+		return nil, s.db.err
+	}
+	rows := s.db.tables[s.query]
+	return &fakeRows{rows: append([][]driver.Value(nil), rows...)}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return make([]string, 5)
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newFakeDB returns a fake database, with the tables of a single group and user, and a handle to it
+func newFakeDB(t *testing.T) (*fakeDB, *sql.DB) {
+	f := &fakeDB{tables: map[string][][]driver.Value{}}
+	f.set(defaultGroupsQuery, []driver.Value{"ops", int64(config.DENY)})
+	f.set(defaultCommandsQuery,
+		[]driver.Value{"ops", "show", `["version"]`, nil, int64(config.PERMIT)},
+		[]driver.Value{"ops", "configure", nil, nil, int64(config.DENY)},
+	)
+	f.set(defaultUsersQuery, []driver.Value{"alice", "lab, core", "ops", nil, "$2a$10$hash"})
+	fakeMu.Lock()
+	fakeDBs[t.Name()] = f
+	fakeMu.Unlock()
+	db, err := sql.Open("tacquito-fake", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return f, db
+}
+
+// fakeLoader publishes its config on every load
+type fakeLoader struct {
+	c      config.ServerConfig
+	config chan config.ServerConfig
+}
+
+func newFakeLoader() *fakeLoader {
+	return &fakeLoader{
+		c:      config.ServerConfig{Users: []config.User{{Name: "bob", Scopes: []string{"lab"}}}},
+		config: make(chan config.ServerConfig, 1),
+	}
+}
+
+func (l *fakeLoader) Load(path string) error {
+	l.config <- l.c
+	return nil
+}
+
+func (l *fakeLoader) Config() chan config.ServerConfig { return l.config }
+
+func names(c config.ServerConfig) []string {
+	var n []string
+	for _, u := range c.Users {
+		n = append(n, u.Name)
+	}
+	return n
+}
+
+func TestDirectoryLoad(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, db := newFakeDB(t)
+	d := New(ctx, mockLogger{}, newFakeLoader(), db, SetRefreshInterval(0))
+	require.NoError(t, d.Load("tacquito.yaml"))
+
+	c := <-d.Config()
+	require.Equal(t, []string{"bob", "alice"}, names(c))
+	assert.Equal(t, config.User{
+		Name:   "alice",
+		Scopes: []string{"lab", "core"},
+		Groups: []config.Group{{
+			Name:          "ops",
+			DefaultAction: config.DENY,
+			Commands: []config.Command{
+				{Name: "show", Match: []string{"version"}, Action: config.PERMIT},
+				{Name: "configure", Action: config.DENY},
+			},
+		}},
+		Authenticator: &config.Authenticator{Type: config.BCRYPT, Options: map[string]string{"hash": "$2a$10$hash"}},
+	}, c.Users[1])
+}
+
+func TestDirectorySkipped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, db := newFakeDB(t)
+	f.set(defaultGroupsQuery, []driver.Value{"ops", int64(config.DENY)}, []driver.Value{"noc", nil})
+	f.set(defaultCommandsQuery,
+		[]driver.Value{"ops", "show", `["version"]`, nil, int64(config.PERMIT)},
+		[]driver.Value{"noc", "configure", `not json`, nil, int64(config.DENY)},
+		[]driver.Value{"noc", "show", nil, nil, int64(config.PERMIT)},
+		[]driver.Value{"missing", "show", nil, nil, int64(config.PERMIT)},
+	)
+	f.set(defaultUsersQuery,
+		[]driver.Value{"alice", "lab", "ops", nil, nil},
+		[]driver.Value{"carol", "lab", "ops,missing", nil, nil},
+		[]driver.Value{"dave", "lab", "noc", nil, nil},
+	)
+	d := New(ctx, mockLogger{}, newFakeLoader(), db, SetRefreshInterval(0))
+	require.NoError(t, d.Load("tacquito.yaml"))
+
+	// unknown groups, and groups with a bad command, drop their members
+	assert.Equal(t, []string{"bob", "alice"}, names(<-d.Config()))
+}
+
+func TestDirectoryRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, db := newFakeDB(t)
+	base := newFakeLoader()
+	d := New(ctx, mockLogger{}, base, db, SetRefreshInterval(10*time.Millisecond))
+	require.NoError(t, d.Load("tacquito.yaml"))
+	assert.Equal(t, []string{"bob", "alice"}, names(<-d.Config()))
+
+	// failed refreshes keep the users last read
+	f.fail(fmt.Errorf("connection refused"))
+	time.Sleep(50 * time.Millisecond)
+	f.fail(nil)
+	select {
+	case c := <-d.Config():
+		t.Fatalf("unexpected config published %v", names(c))
+	default:
+	}
+
+	f.set(defaultUsersQuery,
+		[]driver.Value{"alice", "lab", "ops", nil, nil},
+		[]driver.Value{"erin", "lab", nil, nil, nil},
+	)
+	select {
+	case c := <-d.Config():
+		assert.Equal(t, []string{"bob", "alice", "erin"}, names(c))
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not published after the directory changed")
+	}
+
+	// reloads of the base config keep the directory users
+	base.c.Users = append(base.c.Users, config.User{Name: "frank"})
+	base.config <- base.c
+	select {
+	case c := <-d.Config():
+		assert.Equal(t, []string{"bob", "frank", "alice", "erin"}, names(c))
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not published after the base config changed")
+	}
+}
+
+func TestDirectoryLoadError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, db := newFakeDB(t)
+	f.fail(fmt.Errorf("connection refused"))
+	d := New(ctx, mockLogger{}, newFakeLoader(), db)
+	assert.Error(t, d.Load("tacquito.yaml"))
+}
+
+func TestDirectoryReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, db := newFakeDB(t)
+	d := New(ctx, mockLogger{}, newFakeLoader(), db, SetRefreshInterval(0))
+	assert.Error(t, d.Reload())
+	require.NoError(t, d.Load("tacquito.yaml"))
+	assert.Equal(t, []string{"bob", "alice"}, names(<-d.Config()))
+
+	// reloads read the tables without waiting for a refresh
+	f.set(defaultUsersQuery, []driver.Value{"erin", "lab", nil, nil, nil})
+	require.NoError(t, d.Reload())
+	assert.Eventually(t, func() bool {
+		select {
+		case c := <-d.Config():
+			return assert.ObjectsAreEqual([]string{"bob", "erin"}, names(c))
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
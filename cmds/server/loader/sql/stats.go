@@ -0,0 +1,51 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package sql
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	sqlDirectoryRead = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "sql_directory_read",
+		Help:      "number of times users were read from the sql directory",
+	})
+	sqlDirectoryReadError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "sql_directory_read_error",
+		Help:      "number of times users could not be read from the sql directory",
+	})
+	sqlDirectorySkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "sql_directory_skipped",
+		Help:      "number of sql directory rows skipped for referencing unknown groups or holding bad values",
+	})
+	sqlDirectoryUsers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "sql_directory_users",
+		Help:      "number of users last read from the sql directory",
+	})
+	sqlDirectoryReadDuration = prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Namespace:  "tacquito",
+			Name:       "sql_directory_read_duration_milliseconds",
+			Help:       "the time taken to read users from the sql directory, in milliseconds",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(sqlDirectoryRead)
+	prometheus.MustRegister(sqlDirectoryReadError)
+	prometheus.MustRegister(sqlDirectorySkipped)
+	prometheus.MustRegister(sqlDirectoryUsers)
+	prometheus.MustRegister(sqlDirectoryReadDuration)
+}
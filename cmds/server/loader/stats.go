@@ -27,6 +27,16 @@ var (
 		Name:      "loader_build_scope",
 		Help:      "number of scopes processed",
 	})
+	userTemplateError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_build_user_template_error",
+		Help:      "number of bad templates, and users dropped for referencing unknown templates",
+	})
+	userGroupCycle = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_build_user_group_cycle",
+		Help:      "number of users not added to a scope as their groups include themselves",
+	})
 	userScopeDuplicate = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "loader_build_user_scope_duplicate",
@@ -52,6 +62,16 @@ var (
 		Name:      "loader_build_user_authenticator_bad_configref",
 		Help:      "number of user with bad config ref authenticators",
 	})
+	userEnableUnassigned = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_build_user_enable_unassigned",
+		Help:      "number of user with unassigned enable authenticators",
+	})
+	userEnableBadConfigRef = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_build_user_enable_bad_configref",
+		Help:      "number of user with bad config ref enable authenticators",
+	})
 	userAccounterUnassigned = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "loader_build_user_accounter_unassigned",
@@ -107,6 +127,11 @@ var (
 		Name:      "loader_loader_reduceAuthenticatorAccounterFromGroups_user_override_accounter",
 		Help:      "number of user overrides for accounter",
 	})
+	scopeAccounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_loader_reduceAccounterFromScope_scope_accounter",
+		Help:      "number of users accounted by the accounter of their scope",
+	})
 	prefixFilterAllowed = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "prefixFilter_allowed",
@@ -117,17 +142,134 @@ var (
 		Name:      "prefixFilter_denied",
 		Help:      "when prefixFilter denies a remote net.Addr, this is incremented",
 	})
+	secretBudgetBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_secret_budget_bad_config",
+		Help:      "number of scopes skipped due to an invalid secret budget",
+	})
+	maxBodyLengthBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_max_body_length_bad_config",
+		Help:      "number of scopes skipped due to a max body length over the protocol maximum",
+	})
+	privLvlCapDenied = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_priv_lvl_cap_denied",
+		Help:      "number of authorization and enable requests failed for a privilege level above the cap of their source prefix",
+	})
+	privLvlCapLowered = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_priv_lvl_cap_lowered",
+		Help:      "number of authorization replies whose priv-lvl was lowered to the cap of their source prefix",
+	})
+	privLvlCapBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_priv_lvl_cap_bad_config",
+		Help:      "number of invalid priv_lvl_caps prefixes or levels skipped",
+	})
+	remAddrMismatch = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_rem_addr_mismatch",
+		Help:      "number of sessions whose rem_addr or port failed the rem_addr_check of their scope, by scope and check: address, source, prefix or port",
+	}, []string{"scope", "check"})
+	remAddrRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_rem_addr_rejected",
+		Help:      "number of sessions failed because their rem_addr or port did not pass the rem_addr_check of their scope",
+	})
+	remAddrCheckBadConfig = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_rem_addr_check_bad_config",
+		Help:      "number of scopes skipped due to an invalid rem_addr_check",
+	})
+	configPushApplied = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_config_push_applied",
+		Help:      "number of pushed configs that replaced the running config",
+	})
+	configPushRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_config_push_rejected",
+		Help:      "number of pushed configs that were not applied, for failing validation or being a dry run",
+	})
+	overlayApplied = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_overlay_applied",
+		Help:      "number of runtime config changes applied",
+	})
+	overlayRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_overlay_rejected",
+		Help:      "number of runtime config changes rejected for introducing errors",
+	})
+	secondarySecretError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_secondary_secret_error",
+		Help:      "number of secondary secret lookups that failed, the client is served with the primary secret only",
+	})
+	secretBudgetExceeded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_secret_budget_exceeded",
+		Help:      "number of keychain lookups that exceeded their scope's budget",
+	})
+	secretBudgetError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_secret_budget_error",
+		Help:      "number of keychain lookups that returned an error within their budget",
+	})
+	secretFallbackCached = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_secret_fallback_cached",
+		Help:      "number of lookups served from the last known secret",
+	})
+	secretFallbackStatic = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_secret_fallback_static",
+		Help:      "number of lookups served from a static fallback secret",
+	})
+	secretFallbackClosed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_secret_fallback_closed",
+		Help:      "number of lookups that failed closed after a keychain failure",
+	})
+	multiAccounterSinkError = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_multi_accounter_sink_error",
+		Help:      "number of records a sink of a multi accounter failed to write, by sink name",
+	}, []string{"sink"})
+	multiAccounterSinkTimeout = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_multi_accounter_sink_timeout",
+		Help:      "number of records a sink of a multi accounter did not write within the timeout, by sink name",
+	}, []string{"sink"})
+	multiAccounterFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "loader_multi_accounter_failed",
+		Help:      "number of records a multi accounter replied to with an error, too few of its sinks wrote them",
+	})
+	secretBudgetDuration = prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Namespace:  "tacquito",
+			Name:       "loader_secret_budget_duration_milliseconds",
+			Help:       "the time keychain lookups with a budget took to complete, in milliseconds",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(secretKnown)
 	prometheus.MustRegister(secretUnknown)
 	prometheus.MustRegister(scope)
+	prometheus.MustRegister(userTemplateError)
+	prometheus.MustRegister(userGroupCycle)
 	prometheus.MustRegister(userScopeDuplicate)
 	prometheus.MustRegister(userAuthorizerUnassigned)
 	prometheus.MustRegister(userAuthorizerBadConfigRef)
 	prometheus.MustRegister(userAuthenticatorUnassigned)
 	prometheus.MustRegister(userAuthenticatorBadConfigRef)
+	prometheus.MustRegister(userEnableUnassigned)
+	prometheus.MustRegister(userEnableBadConfigRef)
 	prometheus.MustRegister(userAccounterUnassigned)
 	prometheus.MustRegister(userAccounterBadConfigRef)
 	prometheus.MustRegister(userTotal)
@@ -139,6 +281,29 @@ func init() {
 	prometheus.MustRegister(buildGet)
 	prometheus.MustRegister(userOverrideAuthenticator)
 	prometheus.MustRegister(userOverrideAccounter)
+	prometheus.MustRegister(scopeAccounter)
 	prometheus.MustRegister(prefixFilterAllowed)
 	prometheus.MustRegister(prefixFilterDenied)
+	prometheus.MustRegister(secretBudgetBadConfig)
+	prometheus.MustRegister(maxBodyLengthBadConfig)
+	prometheus.MustRegister(secondarySecretError)
+	prometheus.MustRegister(privLvlCapDenied)
+	prometheus.MustRegister(privLvlCapLowered)
+	prometheus.MustRegister(privLvlCapBadConfig)
+	prometheus.MustRegister(remAddrMismatch)
+	prometheus.MustRegister(remAddrRejected)
+	prometheus.MustRegister(remAddrCheckBadConfig)
+	prometheus.MustRegister(configPushApplied)
+	prometheus.MustRegister(configPushRejected)
+	prometheus.MustRegister(overlayApplied)
+	prometheus.MustRegister(overlayRejected)
+	prometheus.MustRegister(secretBudgetExceeded)
+	prometheus.MustRegister(secretBudgetError)
+	prometheus.MustRegister(secretFallbackCached)
+	prometheus.MustRegister(secretFallbackStatic)
+	prometheus.MustRegister(secretFallbackClosed)
+	prometheus.MustRegister(multiAccounterSinkError)
+	prometheus.MustRegister(multiAccounterSinkTimeout)
+	prometheus.MustRegister(multiAccounterFailed)
+	prometheus.MustRegister(secretBudgetDuration)
 }
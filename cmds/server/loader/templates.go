@@ -0,0 +1,56 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"fmt"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// expandUsers returns the users of c, each having inherited the fields it leaves unset from its
+// template, and then from the defaults.  Users that reference an unknown template are dropped.
+// The errors returned report dropped users, and templates that are unnamed, duplicated or that
+// reference a template themselves, as templates do not nest.
+func expandUsers(c config.ServerConfig) ([]config.User, []error) {
+	if len(c.Templates) == 0 && c.Defaults == nil {
+		return c.Users, nil
+	}
+	var errs []error
+	templates := make(map[string]config.User, len(c.Templates))
+	for _, t := range c.Templates {
+		switch {
+		case t.Name == "":
+			errs = append(errs, fmt.Errorf("template without a name is ignored"))
+			continue
+		case t.Template != "":
+			errs = append(errs, fmt.Errorf("template [%v] references template [%v]; templates do not nest", t.Name, t.Template))
+		}
+		if _, ok := templates[t.Name]; ok {
+			errs = append(errs, fmt.Errorf("duplicate template [%v], the first is used", t.Name))
+			continue
+		}
+		templates[t.Name] = t
+	}
+	users := make([]config.User, 0, len(c.Users))
+	for _, u := range c.Users {
+		if u.Template != "" {
+			t, ok := templates[u.Template]
+			if !ok {
+				errs = append(errs, fmt.Errorf("user [%v] references unknown template [%v] and will not be added", u.Name, u.Template))
+				continue
+			}
+			u.Inherit(t)
+		}
+		if c.Defaults != nil {
+			u.Inherit(*c.Defaults)
+		}
+		users = append(users, u)
+	}
+	return users, errs
+}
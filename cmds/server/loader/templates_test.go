@@ -0,0 +1,66 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"testing"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandUsers(t *testing.T) {
+	bcrypt := &config.Authenticator{Type: config.BCRYPT, Options: map[string]string{"hash": "abc"}}
+	stderr := &config.Accounter{Name: "stderr", Type: config.STDERR}
+	c := config.ServerConfig{
+		Templates: []config.User{
+			{
+				Name:          "noc",
+				Scopes:        []string{"prod"},
+				Groups:        []config.Group{{Name: "neteng"}},
+				Authenticator: bcrypt,
+			},
+			{Name: "noc", Scopes: []string{"lab"}},
+			{Name: "nested", Template: "noc"},
+			{Scopes: []string{"lab"}},
+		},
+		Defaults: &config.User{Scopes: []string{"lab"}, Accounter: stderr, DefaultAction: config.DENY},
+		Users: []config.User{
+			{Name: "alice", Template: "noc"},
+			{Name: "bob", Template: "noc", Scopes: []string{"lab", "prod"}, Commands: []config.Command{{Name: "show"}}},
+			{Name: "carol"},
+			{Name: "dave", Template: "missing"},
+		},
+	}
+	users, errs := expandUsers(c)
+	assert.Equal(t, []config.User{
+		{Name: "alice", Template: "noc", Scopes: []string{"prod"}, Groups: []config.Group{{Name: "neteng"}}, Authenticator: bcrypt, Accounter: stderr, DefaultAction: config.DENY},
+		{Name: "bob", Template: "noc", Scopes: []string{"lab", "prod"}, Groups: []config.Group{{Name: "neteng"}}, Commands: []config.Command{{Name: "show"}}, Authenticator: bcrypt, Accounter: stderr, DefaultAction: config.DENY},
+		{Name: "carol", Scopes: []string{"lab"}, Accounter: stderr, DefaultAction: config.DENY},
+	}, users)
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assert.Equal(t, []string{
+		"duplicate template [noc], the first is used",
+		"template [nested] references template [noc]; templates do not nest",
+		"template without a name is ignored",
+		"user [dave] references unknown template [missing] and will not be added",
+	}, messages)
+
+	// users do not share the lists they inherit
+	users[0].Scopes[0] = "staging"
+	assert.Equal(t, []string{"prod"}, c.Templates[0].Scopes)
+
+	// configs without templates or defaults are left as they are
+	users, errs = expandUsers(config.ServerConfig{Users: []config.User{{Name: "alice", Template: "noc"}}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []config.User{{Name: "alice", Template: "noc"}}, users)
+}
@@ -0,0 +1,226 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sync"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+)
+
+// Severity of a Diagnostic
+type Severity int
+
+const (
+	// SeverityError rejects a config
+	SeverityError Severity = iota
+	// SeverityWarning is reported but does not reject a config
+	SeverityWarning
+)
+
+// String returns the severity as a string
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("unknown severity[%d]", int(s))
+}
+
+// Diagnostic is a problem found while validating a config
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+}
+
+// HasErrors reports whether any diagnostic is an error
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate builds c with the dependencies set by opts, exactly as a running server would, without
+// serving it, and reports every problem found.  An error is returned if opts are missing a
+// required dependency.
+func Validate(ctx context.Context, c config.ServerConfig, opts ...Option) ([]Diagnostic, error) {
+	l, err := newLoader(ctx, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	_, diagnostics := l.validate(c)
+	return diagnostics, nil
+}
+
+// validate builds the providers of c, reporting every problem found along the way
+func (l *Loader) validate(c config.ServerConfig) ([]tq.SecretProvider, []Diagnostic) {
+	d := &diagnosticLogger{loggerProvider: l.loggerProvider}
+	if len(c.Secrets) < 1 {
+		d.add(SeverityError, "no secret providers in config, cannot serve")
+	}
+	if len(c.Users) < 1 && !c.Proxies() {
+		d.add(SeverityError, "no users in config, cannot serve")
+	}
+	for _, prefixes := range [][]string{c.PrefixDeny, c.PrefixAllow} {
+		for _, cidr := range prefixes {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				d.add(SeverityError, fmt.Sprintf("bad prefix filter [%v]; %v", cidr, err))
+			}
+		}
+	}
+	// users are checked as they are built, with their templates and the defaults applied.  build
+	// reports template errors.
+	expanded := c
+	expanded.Users, _ = expandUsers(c)
+	validateScopes(d, expanded)
+	validateRegexes(d, expanded)
+	// build logs every scope, user and handler it has to skip as an error
+	scoped := *l
+	scoped.loggerProvider = d
+	providers := scoped.build(c)
+	if len(c.Secrets) > 0 && len(providers) == 0 {
+		d.add(SeverityError, "no secret providers could be built from config")
+	}
+	return providers, d.diagnostics
+}
+
+// validateScopes reports duplicate scopes, users that no client can ever be served with and
+// command or service scope selectors that never apply
+func validateScopes(d *diagnosticLogger, c config.ServerConfig) {
+	scopes := make(map[string]bool, len(c.Secrets))
+	for _, s := range c.Secrets {
+		if scopes[s.Name] {
+			d.add(SeverityWarning, fmt.Sprintf("duplicate scope [%v]; clients are served by the first secret config that matches them", s.Name))
+		}
+		scopes[s.Name] = true
+	}
+	groups := map[string]bool{}
+	for _, u := range c.Users {
+		reachable := false
+		for _, s := range u.Scopes {
+			if !scopes[s] {
+				d.add(SeverityWarning, fmt.Sprintf("user [%v] references unknown scope [%v]", u.Name, s))
+				continue
+			}
+			reachable = true
+		}
+		if !reachable {
+			d.add(SeverityWarning, fmt.Sprintf("user [%v] is not in any configured scope and is unreachable", u.Name))
+		}
+		checkSelectors(d, fmt.Sprintf("user [%v]", u.Name), scopes, u.Commands, u.Services)
+		// cycles are reported as the config is built
+		resolved, _ := resolveGroups(u)
+		for _, g := range resolved {
+			if groups[g.Name] {
+				continue
+			}
+			groups[g.Name] = true
+			checkSelectors(d, fmt.Sprintf("group [%v]", g.Name), scopes, g.Commands, g.Services)
+		}
+	}
+}
+
+// checkSelectors reports commands and services selected to scopes that do not exist, as they
+// never apply
+func checkSelectors(d *diagnosticLogger, owner string, scopes map[string]bool, commands []config.Command, services []config.Service) {
+	for _, c := range commands {
+		for _, s := range c.Scopes {
+			if !scopes[s] {
+				d.add(SeverityWarning, fmt.Sprintf("command [%v] of %v selects unknown scope [%v]", c.Name, owner, s))
+			}
+		}
+	}
+	for _, svc := range services {
+		for _, s := range svc.Scopes {
+			if !scopes[s] {
+				d.add(SeverityWarning, fmt.Sprintf("service [%v] of %v selects unknown scope [%v]", svc.Name, owner, s))
+			}
+		}
+	}
+}
+
+// validateRegexes reports command and file transfer patterns that do not compile.  Groups are
+// shared by users, so each group is only checked once.
+func validateRegexes(d *diagnosticLogger, c config.ServerConfig) {
+	groups := map[string]bool{}
+	for _, u := range c.Users {
+		checkRegexes(d, fmt.Sprintf("user [%v]", u.Name), u.Commands, u.FileTransfers)
+		resolved, _ := resolveGroups(u)
+		for _, g := range resolved {
+			if groups[g.Name] {
+				continue
+			}
+			groups[g.Name] = true
+			checkRegexes(d, fmt.Sprintf("group [%v]", g.Name), g.Commands, g.FileTransfers)
+		}
+	}
+}
+
+// checkRegexes compiles patterns the way the stringy authorizer does, anchored to the start and
+// end of the string
+func checkRegexes(d *diagnosticLogger, owner string, commands []config.Command, transfers []config.FileTransfer) {
+	for _, cmd := range commands {
+		cmd.TrimSpace()
+		for _, m := range append(cmd.Match, cmd.Except...) {
+			if err := compileAnchored(m); err != nil {
+				d.add(SeverityError, fmt.Sprintf("bad regex [%v] in command [%v] of %v; %v", m, cmd.Name, owner, err))
+			}
+		}
+	}
+	for _, f := range transfers {
+		f.TrimSpace()
+		for _, p := range f.Paths {
+			if err := compileAnchored(p); err != nil {
+				d.add(SeverityError, fmt.Sprintf("bad regex [%v] in file transfer path of %v; %v", p, owner, err))
+			}
+		}
+	}
+}
+
+func compileAnchored(regexish string) error {
+	if len(regexish) == 0 {
+		return nil
+	}
+	if regexish[0] != '^' {
+		regexish = "^" + regexish
+	}
+	if regexish[len(regexish)-1] != '$' {
+		regexish = regexish + "$"
+	}
+	_, err := regexp.Compile(regexish)
+	return err
+}
+
+// diagnosticLogger records the errors logged while building a config as diagnostics
+type diagnosticLogger struct {
+	loggerProvider
+	sync.Mutex
+	diagnostics []Diagnostic
+}
+
+func (d *diagnosticLogger) add(s Severity, msg string) {
+	d.Lock()
+	defer d.Unlock()
+	d.diagnostics = append(d.diagnostics, Diagnostic{Severity: s, Message: msg})
+}
+
+// Errorf implements loggerProvider
+func (d *diagnosticLogger) Errorf(ctx context.Context, format string, args ...interface{}) {
+	d.loggerProvider.Errorf(ctx, format, args...)
+	d.add(SeverityError, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,192 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package loader
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubKeychain struct{}
+
+func (stubKeychain) Add(k config.Keychain) func(context.Context, string) ([]byte, error) {
+	return func(context.Context, string) ([]byte, error) { return []byte(k.Key), nil }
+}
+
+type stubAuthorizer struct{}
+
+func (stubAuthorizer) New(user config.User) (tq.Handler, error) {
+	return tq.HandlerFunc(func(tq.Response, tq.Request) {}), nil
+}
+
+type stubHandler struct{}
+
+func (stubHandler) New(ctx context.Context, cp config.Provider, options map[string]string) tq.Handler {
+	return tq.HandlerFunc(func(tq.Response, tq.Request) {})
+}
+
+type stubSecretProvider struct{}
+
+func (stubSecretProvider) New(ctx context.Context, sc config.SecretConfig, h tq.Handler, secret func(context.Context, string) ([]byte, error)) tq.SecretProvider {
+	return stubSecretProvider{}
+}
+
+func (stubSecretProvider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler, error) {
+	return nil, nil, nil
+}
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	opts := []Option{
+		SetLoggerProvider(mockLogger{}),
+		SetKeychainProvider(stubKeychain{}),
+		SetConfigProvider(config.New()),
+		SetAuthorizerProvider(stubAuthorizer{}),
+		RegisterHandlerType(config.START, stubHandler{}),
+		RegisterSecretProviderType(config.PREFIX, stubSecretProvider{}),
+	}
+	scope := func(name string, h config.HandlerType) config.SecretConfig {
+		return config.SecretConfig{Name: name, Type: config.PREFIX, Handler: config.Handler{Type: h}}
+	}
+	tests := []struct {
+		name     string
+		config   config.ServerConfig
+		expected []Diagnostic
+	}{
+		{
+			name: "valid",
+			config: config.ServerConfig{
+				Secrets: []config.SecretConfig{scope("localhost", config.START)},
+				Users:   []config.User{{Name: "alice", Scopes: []string{"localhost"}}},
+			},
+		},
+		{
+			name: "unreachable users and duplicate scopes",
+			config: config.ServerConfig{
+				Secrets: []config.SecretConfig{scope("localhost", config.START), scope("localhost", config.START)},
+				Users: []config.User{
+					{Name: "alice", Scopes: []string{"localhost", "elsewhere"}},
+					{Name: "bob", Scopes: []string{"elsewhere"}},
+					{Name: "carol"},
+				},
+			},
+			expected: []Diagnostic{
+				{SeverityWarning, "duplicate scope [localhost]; clients are served by the first secret config that matches them"},
+				{SeverityWarning, "user [alice] references unknown scope [elsewhere]"},
+				{SeverityWarning, "user [bob] references unknown scope [elsewhere]"},
+				{SeverityWarning, "user [bob] is not in any configured scope and is unreachable"},
+				{SeverityWarning, "user [carol] is not in any configured scope and is unreachable"},
+			},
+		},
+		{
+			name: "unknown scope selectors",
+			config: config.ServerConfig{
+				Secrets: []config.SecretConfig{scope("lab", config.START), scope("prod", config.START)},
+				Users: []config.User{
+					{
+						Name:     "alice",
+						Scopes:   []string{"lab", "prod"},
+						Commands: []config.Command{{Name: "show", Scopes: []string{"prod"}}, {Name: "configure", Scopes: []string{"staging"}}},
+						Groups:   []config.Group{{Name: "noc", Services: []config.Service{{Name: "shell", Scopes: []string{"lab", "dev"}}}}},
+					},
+					{
+						Name:   "bob",
+						Scopes: []string{"lab"},
+						Groups: []config.Group{{Name: "noc", Services: []config.Service{{Name: "shell", Scopes: []string{"lab", "dev"}}}}},
+					},
+				},
+			},
+			expected: []Diagnostic{
+				{SeverityWarning, "command [configure] of user [alice] selects unknown scope [staging]"},
+				{SeverityWarning, "service [shell] of group [noc] selects unknown scope [dev]"},
+			},
+		},
+		{
+			name: "group cycle",
+			config: config.ServerConfig{
+				Secrets: []config.SecretConfig{scope("localhost", config.START)},
+				Users: []config.User{
+					{Name: "alice", Scopes: []string{"localhost"}},
+					{
+						Name:   "bob",
+						Scopes: []string{"localhost"},
+						Groups: []config.Group{{Name: "oncall", Groups: []config.Group{{Name: "neteng", Groups: []config.Group{{Name: "oncall"}}}}}},
+					},
+				},
+			},
+			expected: []Diagnostic{
+				{SeverityError, "user [bob] will not be added to scope [localhost]; group cycle [oncall -> neteng -> oncall]"},
+			},
+		},
+		{
+			name: "templates",
+			config: config.ServerConfig{
+				Secrets:   []config.SecretConfig{scope("localhost", config.START)},
+				Templates: []config.User{{Name: "noc", Scopes: []string{"localhost"}}},
+				Users:     []config.User{{Name: "alice", Template: "noc"}, {Name: "bob", Template: "nco"}},
+			},
+			expected: []Diagnostic{
+				{SeverityError, "user [bob] references unknown template [nco] and will not be added"},
+			},
+		},
+		{
+			name: "missing handler type",
+			config: config.ServerConfig{
+				Secrets: []config.SecretConfig{scope("localhost", config.SPAN)},
+				Users:   []config.User{{Name: "alice", Scopes: []string{"localhost"}}},
+			},
+			expected: []Diagnostic{
+				{SeverityError, "no handler assigned to provider type [1] in scope [localhost]. Skipping scope..."},
+				{SeverityError, "no secret providers could be built from config"},
+			},
+		},
+		{
+			name: "bad regexes",
+			config: config.ServerConfig{
+				Secrets: []config.SecretConfig{scope("localhost", config.START)},
+				Users: []config.User{
+					{
+						Name:          "alice",
+						Scopes:        []string{"localhost"},
+						Commands:      []config.Command{{Name: "show", Match: []string{"version", "(ip"}, Except: []string{"run+++"}}},
+						FileTransfers: []config.FileTransfer{{Paths: []string{"/images/[a-z.iso"}}},
+						Groups:        []config.Group{{Name: "noc", Commands: []config.Command{{Name: "configure", Match: []string{"a**"}}}}},
+					},
+					{
+						Name:   "bob",
+						Scopes: []string{"localhost"},
+						Groups: []config.Group{{Name: "noc", Commands: []config.Command{{Name: "configure", Match: []string{"a**"}}}}},
+					},
+				},
+			},
+			expected: []Diagnostic{
+				{SeverityError, "bad regex [(ip] in command [show] of user [alice]; error parsing regexp: missing closing ): `^(ip$`"},
+				{SeverityError, "bad regex [run+++] in command [show] of user [alice]; error parsing regexp: invalid nested repetition operator: `++`"},
+				{SeverityError, "bad regex [/images/[a-z.iso] in file transfer path of user [alice]; error parsing regexp: missing closing ]: `[a-z.iso$`"},
+				{SeverityError, "bad regex [a**] in command [configure] of group [noc]; error parsing regexp: invalid nested repetition operator: `**`"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diagnostics, err := Validate(ctx, test.config, opts...)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, diagnostics)
+		})
+	}
+
+	_, err := Validate(ctx, config.ServerConfig{}, SetLoggerProvider(mockLogger{}))
+	assert.Error(t, err)
+}
@@ -17,16 +17,32 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// Option is the setter type for YAML
+type Option func(l *YAML)
+
+// SetUsersOptional allows configs without users, for when users are added by another source, eg
+// a sql directory wrapping the loader
+func SetUsersOptional(optional bool) Option {
+	return func(l *YAML) {
+		l.usersOptional = optional
+	}
+}
+
 // New returns a new yaml config unmarshaller
-func New() *YAML {
+func New(opts ...Option) *YAML {
 	// TODO move channel to inotify
-	return &YAML{config: make(chan config.ServerConfig, 1)}
+	l := &YAML{config: make(chan config.ServerConfig, 1)}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // YAML loads all users from a given config filename
 type YAML struct {
 	config.ServerConfig
-	config chan config.ServerConfig
+	config        chan config.ServerConfig
+	usersOptional bool
 }
 
 // Load given a filename from disk, read all user data from it and unmarshal it
@@ -51,7 +67,7 @@ func (l *YAML) Unmarshal(b []byte) error {
 	if len(l.Secrets) < 1 {
 		return fmt.Errorf("no secret providers were unmarshalled from config, cannot serve")
 	}
-	if len(l.Users) < 1 {
+	if len(l.Users) < 1 && !l.Proxies() && !l.usersOptional {
 		return fmt.Errorf("no users were unmarshalled from config, cannot serve")
 	}
 	l.config <- l.ServerConfig
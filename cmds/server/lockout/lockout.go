@@ -0,0 +1,300 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package lockout defends against brute force authentication.  Failed authentications are counted
+// per username and per remote address, the rem-addr of the authentication start packet, and once
+// either reaches its threshold further attempts are refused for an exponentially growing delay.
+// Operators may list and clear lockouts through the admin api.
+package lockout
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kind is what a failure is counted against
+type Kind string
+
+const (
+	// User counts failures per username
+	User Kind = "user"
+	// Address counts failures per remote address, the rem-addr sent by the device
+	Address Kind = "address"
+)
+
+const (
+	// ListPath lists the tracked users and addresses
+	ListPath = "/v1/lockouts"
+	// UnlockPath clears the failures of a user or address, given as the user or address query
+	// parameter
+	UnlockPath = "/v1/lockouts/unlock"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+}
+
+// Option is used to set optional behaviors on the Lockout
+type Option func(l *Lockout)
+
+// SetThreshold sets how many consecutive failures lock out a user or address.  Zero stops
+// tracking that kind.  Defaults to 5 for users and 20 for addresses, which are shared by every user
+// behind them.
+func SetThreshold(k Kind, n int) Option {
+	return func(l *Lockout) {
+		l.thresholds[k] = n
+	}
+}
+
+// SetDelay sets the first lockout, which doubles on every failure past the threshold up to max.
+// Defaults to 1 second and 15 minutes.
+func SetDelay(initial, max time.Duration) Option {
+	return func(l *Lockout) {
+		l.initial = initial
+		l.max = max
+	}
+}
+
+// SetWindow sets how long failures are remembered after the last one, or after the lockout it
+// caused ends.  Defaults to 15 minutes.
+func SetWindow(d time.Duration) Option {
+	return func(l *Lockout) {
+		l.window = d
+	}
+}
+
+// New creates a Lockout
+func New(l loggerProvider, opts ...Option) *Lockout {
+	lo := &Lockout{
+		loggerProvider: l,
+		thresholds:     map[Kind]int{User: 5, Address: 20},
+		initial:        time.Second,
+		max:            15 * time.Minute,
+		window:         15 * time.Minute,
+		entries:        make(map[key]*entry),
+		now:            time.Now,
+	}
+	for _, opt := range opts {
+		opt(lo)
+	}
+	return lo
+}
+
+// Lockout tracks failed authentications
+type Lockout struct {
+	loggerProvider
+	thresholds map[Kind]int
+	initial    time.Duration
+	max        time.Duration
+	window     time.Duration
+
+	mu        sync.Mutex
+	entries   map[key]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// key identifies a tracked user or address
+type key struct {
+	kind Kind
+	name string
+}
+
+// entry is the failure history of a key
+type entry struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// Entry describes a tracked user or address
+type Entry struct {
+	Kind     Kind      `json:"kind"`
+	Name     string    `json:"name"`
+	Failures int       `json:"failures"`
+	Last     time.Time `json:"last"`
+	// Until is when the lockout ends, nil unless locked out
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// keys returns the tracked keys of user and addr, skipping empty values and kinds without a threshold
+func (l *Lockout) keys(user, addr string) []key {
+	var keys []key
+	if user != "" && l.thresholds[User] > 0 {
+		keys = append(keys, key{kind: User, name: user})
+	}
+	if addr != "" && l.thresholds[Address] > 0 {
+		keys = append(keys, key{kind: Address, name: addr})
+	}
+	return keys
+}
+
+// Locked reports whether user or addr are locked out, and for how long.  Either may be empty.
+func (l *Lockout) Locked(user, addr string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var remaining time.Duration
+	for _, k := range l.keys(user, addr) {
+		if e, ok := l.entries[k]; ok && e.until.After(now) && e.until.Sub(now) > remaining {
+			remaining = e.until.Sub(now)
+		}
+	}
+	if remaining > 0 {
+		lockoutRefused.Inc()
+		return remaining, true
+	}
+	return 0, false
+}
+
+// Failure records a failed authentication by user from addr
+func (l *Lockout) Failure(user, addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	lockoutFailure.Inc()
+	for _, k := range l.keys(user, addr) {
+		e, ok := l.entries[k]
+		if !ok || l.expired(e, now) {
+			e = &entry{}
+			l.entries[k] = e
+		}
+		e.failures++
+		e.last = now
+		if over := e.failures - l.thresholds[k.kind]; over >= 0 {
+			e.until = now.Add(l.delay(over))
+			lockoutLocked.Inc()
+			l.Infof(context.Background(), "%v [%v] is locked out until %v after %v failed authentications", k.kind, k.name, e.until.Format(time.RFC3339), e.failures)
+		}
+	}
+}
+
+// Success records a successful authentication by user, clearing the user's failures.  The
+// address's failures are kept, one valid account must not hide a password spray.
+func (l *Lockout) Success(user, addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key{kind: User, name: user})
+}
+
+// Unlock clears the failures of name, reporting whether it was tracked
+func (l *Lockout) Unlock(k Kind, name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.entries[key{kind: k, name: name}]
+	delete(l.entries, key{kind: k, name: name})
+	if ok {
+		lockoutUnlocked.Inc()
+	}
+	return ok
+}
+
+// Entries returns the tracked users and addresses, locked out ones first
+func (l *Lockout) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	entries := make([]Entry, 0, len(l.entries))
+	for k, e := range l.entries {
+		if l.expired(e, now) {
+			continue
+		}
+		entry := Entry{Kind: k.kind, Name: k.name, Failures: e.failures, Last: e.last}
+		if e.until.After(now) {
+			until := e.until
+			entry.Until = &until
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if (entries[i].Until == nil) != (entries[j].Until == nil) {
+			return entries[i].Until != nil
+		}
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// delay returns the lockout for a failure over failures past the threshold
+func (l *Lockout) delay(over int) time.Duration {
+	d := l.initial
+	for i := 0; i < over && d < l.max; i++ {
+		d *= 2
+	}
+	if d > l.max {
+		d = l.max
+	}
+	return d
+}
+
+// expired reports whether e is no longer locked out and its failures have been forgotten
+func (l *Lockout) expired(e *entry, now time.Time) bool {
+	last := e.last
+	if e.until.After(last) {
+		last = e.until
+	}
+	return now.Sub(last) >= l.window
+}
+
+// sweep drops expired entries, at most once a window, so random usernames cannot grow the
+// entries without bound.  The caller must hold the lock.
+func (l *Lockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for k, e := range l.entries {
+		if l.expired(e, now) {
+			delete(l.entries, k)
+		}
+	}
+	lockoutTracked.Set(float64(len(l.entries)))
+}
+
+// ServeList writes the tracked users and addresses as json
+func (l *Lockout) ServeList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.Entries())
+}
+
+// ServeUnlock clears the failures of the user or address query parameter
+func (l *Lockout) ServeUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	k, name := User, q.Get(string(User))
+	if name == "" {
+		k, name = Address, q.Get(string(Address))
+	}
+	if name == "" {
+		http.Error(w, "one of the user or address query parameters is required", http.StatusBadRequest)
+		return
+	}
+	if !l.Unlock(k, name) {
+		http.Error(w, "not tracked", http.StatusNotFound)
+		return
+	}
+	l.Infof(r.Context(), "%v [%v] was unlocked by the admin api", k, name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package lockout
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (mockLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+func TestLockout(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(mockLogger{}, SetThreshold(User, 2), SetThreshold(Address, 0), SetDelay(time.Second, 5*time.Second), SetWindow(time.Minute))
+	l.now = func() time.Time { return now }
+
+	l.Failure("alice", "192.0.2.1")
+	_, locked := l.Locked("alice", "")
+	assert.False(t, locked)
+
+	// the lockout doubles with every failure past the threshold, up to the max
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		l.Failure("alice", "192.0.2.1")
+		d, locked := l.Locked("alice", "")
+		assert.True(t, locked)
+		assert.Equal(t, want, d)
+	}
+	now = now.Add(5 * time.Second)
+	_, locked = l.Locked("alice", "")
+	assert.False(t, locked)
+
+	// addresses are not tracked without a threshold
+	_, locked = l.Locked("", "192.0.2.1")
+	assert.False(t, locked)
+	assert.Len(t, l.Entries(), 1)
+
+	// failures are forgotten a window after the lockout ends, so the next failure starts over
+	now = now.Add(time.Minute)
+	assert.Empty(t, l.Entries())
+	l.Failure("alice", "")
+	_, locked = l.Locked("alice", "")
+	assert.False(t, locked)
+
+	// success clears the user's failures
+	l.Failure("bob", "")
+	l.Success("bob", "")
+	l.Failure("bob", "")
+	_, locked = l.Locked("bob", "")
+	assert.False(t, locked)
+
+	// expired entries are swept
+	assert.Len(t, l.entries, 2)
+	now = now.Add(2 * time.Minute)
+	l.Failure("carol", "")
+	assert.Len(t, l.entries, 1)
+}
+
+func TestHandlers(t *testing.T) {
+	l := New(mockLogger{}, SetThreshold(Address, 1), SetDelay(time.Hour, time.Hour))
+	l.Failure("alice", "192.0.2.1")
+
+	list := httptest.NewRecorder()
+	l.ServeList(list, httptest.NewRequest(http.MethodGet, ListPath, nil))
+	require.Equal(t, http.StatusOK, list.Code)
+	var entries []Entry
+	require.NoError(t, json.Unmarshal(list.Body.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	assert.Equal(t, "192.0.2.1", entries[0].Name)
+	assert.NotNil(t, entries[0].Until)
+	assert.Equal(t, "alice", entries[1].Name)
+	assert.Nil(t, entries[1].Until)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+	}{
+		{name: "wrong method", method: http.MethodGet, target: UnlockPath + "?address=192.0.2.1", status: http.StatusMethodNotAllowed},
+		{name: "no parameter", method: http.MethodPost, target: UnlockPath, status: http.StatusBadRequest},
+		{name: "unlock", method: http.MethodPost, target: UnlockPath + "?address=192.0.2.1", status: http.StatusNoContent},
+		{name: "not tracked", method: http.MethodPost, target: UnlockPath + "?address=192.0.2.1", status: http.StatusNotFound},
+		{name: "unlock user", method: http.MethodPost, target: UnlockPath + "?user=alice", status: http.StatusNoContent},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		l.ServeUnlock(w, httptest.NewRequest(test.method, test.target, nil))
+		assert.Equal(t, test.status, w.Code, test.name)
+	}
+	assert.Empty(t, l.Entries())
+}
@@ -0,0 +1,49 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package lockout
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// gauges and counters
+	lockoutFailure = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "lockout_failure",
+		Help:      "number of failed authentications recorded",
+	})
+	lockoutLocked = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "lockout_locked",
+		Help:      "number of times a user or address was locked out",
+	})
+	lockoutRefused = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "lockout_refused",
+		Help:      "number of authentication attempts refused because the user or address was locked out",
+	})
+	lockoutUnlocked = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "lockout_unlocked",
+		Help:      "number of users or addresses unlocked by an operator",
+	})
+	lockoutTracked = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "lockout_tracked",
+		Help:      "number of users and addresses with recent failures, as of the last sweep",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(lockoutFailure)
+	prometheus.MustRegister(lockoutLocked)
+	prometheus.MustRegister(lockoutRefused)
+	prometheus.MustRegister(lockoutUnlocked)
+	prometheus.MustRegister(lockoutTracked)
+}
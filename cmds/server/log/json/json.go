@@ -0,0 +1,197 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package json provides a structured logger that writes a json object per line.  Each line carries
+// the level, caller and message, the request fields saved to the context by Set, such as the
+// session id, user and remote address, and for Record, the packet fields.
+package json
+
+import (
+	"context"
+	stdjson "encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// contextKeys are the context values included in every line, when set
+var contextKeys = []tq.ContextKey{
+	tq.ContextReqID,
+	tq.ContextSessionID,
+	tq.ContextConnRemoteAddr,
+	tq.ContextConnLocalAddr,
+	tq.ContextUser,
+	tq.ContextRemoteAddr,
+	tq.ContextPort,
+	tq.ContextPrivLvl,
+}
+
+// Option is used to set optional behaviors on the Logger
+type Option func(l *Logger)
+
+// SetSampling limits repeated messages.  Each message format is logged first times every tick,
+// then only every thereafter-th time, so a storm of identical errors cannot drown out the rest of
+// the log.  Fatal lines are never sampled.  thereafter of zero drops everything past first.
+func SetSampling(first, thereafter int, tick time.Duration) Option {
+	return func(l *Logger) {
+		l.sampler = &sampler{first: first, thereafter: thereafter, tick: tick, counts: make(map[string]int)}
+	}
+}
+
+// New creates a json logger writing to w.  levels match the default logger: 10 error, 20 info,
+// 30 debug.  fatal has no level.
+func New(level int, w io.Writer, opts ...Option) *Logger {
+	l := &Logger{level: level, w: w, now: time.Now}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Logger writes json lines
+type Logger struct {
+	level   int
+	sampler *sampler
+	now     func() time.Time
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// line is a single log entry
+type line struct {
+	Time    string            `json:"time"`
+	Level   string            `json:"level"`
+	Caller  string            `json:"caller,omitempty"`
+	Msg     string            `json:"msg,omitempty"`
+	Context map[string]string `json:"context,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Errorf ...
+func (l *Logger) Errorf(ctx context.Context, format string, args ...interface{}) {
+	if l.level >= 10 {
+		l.write(ctx, "error", format, args, nil)
+	}
+}
+
+// Infof ...
+func (l *Logger) Infof(ctx context.Context, format string, args ...interface{}) {
+	if l.level >= 20 {
+		l.write(ctx, "info", format, args, nil)
+	}
+}
+
+// Debugf ...
+func (l *Logger) Debugf(ctx context.Context, format string, args ...interface{}) {
+	if l.level >= 30 {
+		l.write(ctx, "debug", format, args, nil)
+	}
+}
+
+// Fatalf ...
+func (l *Logger) Fatalf(ctx context.Context, format string, args ...interface{}) {
+	l.write(ctx, "fatal", format, args, nil)
+}
+
+// Record writes r as the fields of a debug line, replacing the values of obscure
+func (l *Logger) Record(ctx context.Context, r map[string]string, obscure ...string) {
+	if l.level < 30 {
+		return
+	}
+	for _, key := range obscure {
+		if _, ok := r[key]; ok {
+			r[key] = "<obscured>"
+		}
+	}
+	l.write(ctx, "debug", "record", nil, r)
+}
+
+// Set saves the fields named by keys, and the session id, to ctx so they are included in every
+// line logged with it
+func (l *Logger) Set(ctx context.Context, fields map[string]string, keys ...tq.ContextKey) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if v, ok := fields["header-session-id"]; ok {
+		ctx = context.WithValue(ctx, tq.ContextSessionID, v)
+	}
+	for _, key := range keys {
+		if v, ok := fields[string(key)]; ok {
+			ctx = context.WithValue(ctx, key, v)
+		}
+	}
+	return ctx
+}
+
+// write encodes and writes a line, unless it is sampled out
+func (l *Logger) write(ctx context.Context, level, format string, args []interface{}, fields map[string]string) {
+	now := l.now()
+	if level != "fatal" && l.sampler != nil && !l.sampler.allow(format, now) {
+		logSampled.Inc()
+		return
+	}
+	entry := line{Time: now.UTC().Format(time.RFC3339Nano), Level: level, Msg: format, Fields: fields}
+	if args != nil {
+		entry.Msg = fmt.Sprintf(format, args...)
+	}
+	// skip write and the level method
+	if _, file, no, ok := runtime.Caller(2); ok {
+		entry.Caller = filepath.Base(filepath.Dir(file)) + "/" + filepath.Base(file) + ":" + strconv.Itoa(no)
+	}
+	if ctx != nil {
+		for _, key := range contextKeys {
+			if v, ok := ctx.Value(key).(string); ok && v != "" {
+				if entry.Context == nil {
+					entry.Context = make(map[string]string)
+				}
+				entry.Context[string(key)] = v
+			}
+		}
+	}
+	b, err := stdjson.Marshal(entry)
+	if err != nil {
+		logEncodeError.Inc()
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(b, '\n'))
+}
+
+// sampler counts messages by format within each tick
+type sampler struct {
+	first      int
+	thereafter int
+	tick       time.Duration
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+// allow reports whether the n-th message of format in the current tick is logged
+func (s *sampler) allow(format string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.start) >= s.tick {
+		s.start = now
+		s.counts = make(map[string]int, len(s.counts))
+	}
+	s.counts[format]++
+	n := s.counts[format]
+	if n <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
@@ -0,0 +1,95 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package json
+
+import (
+	"bytes"
+	"context"
+	stdjson "encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lines decodes every line written to b
+func lines(t *testing.T, b *bytes.Buffer) []line {
+	var out []line
+	for _, s := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if s == "" {
+			continue
+		}
+		var l line
+		require.NoError(t, stdjson.Unmarshal([]byte(s), &l), s)
+		out = append(out, l)
+	}
+	b.Reset()
+	return out
+}
+
+func TestLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := New(20, &b)
+	l.now = func() time.Time { return time.Unix(0, 0) }
+
+	ctx := context.WithValue(context.Background(), tq.ContextConnRemoteAddr, "192.0.2.1")
+	l.Errorf(ctx, "closing connection to %v", "192.0.2.1:49")
+	l.Infof(ctx, "hello")
+	l.Debugf(ctx, "filtered by level")
+	out := lines(t, &b)
+	require.Len(t, out, 2)
+	assert.Equal(t, line{
+		Time:    "1970-01-01T00:00:00Z",
+		Level:   "error",
+		Caller:  "json/json_test.go:45",
+		Msg:     "closing connection to 192.0.2.1:49",
+		Context: map[string]string{"conn-remote-addr": "192.0.2.1"},
+	}, out[0])
+	assert.Equal(t, "info", out[1].Level)
+
+	// fields saved by Set, and the session id, are carried by the context
+	l = New(30, &b)
+	fields := tq.NewHeader(tq.SetHeaderType(tq.Authenticate), tq.SetHeaderSessionID(123)).Fields()
+	fields[string(tq.ContextUser)] = "alice"
+	fields[string(tq.ContextPort)] = "tty0"
+	ctx = l.Set(ctx, fields, tq.ContextUser)
+	l.Record(ctx, map[string]string{"user-msg": "secret", "status": "AuthenStatusPass"}, "user-msg")
+	out = lines(t, &b)
+	require.Len(t, out, 1)
+	assert.Equal(t, "debug", out[0].Level)
+	assert.Equal(t, "record", out[0].Msg)
+	assert.Equal(t, map[string]string{"conn-remote-addr": "192.0.2.1", "session-id": "123", "user": "alice"}, out[0].Context)
+	assert.Equal(t, map[string]string{"user-msg": "<obscured>", "status": "AuthenStatusPass"}, out[0].Fields)
+}
+
+func TestSampling(t *testing.T) {
+	var b bytes.Buffer
+	now := time.Unix(0, 0)
+	l := New(30, &b, SetSampling(2, 3, time.Second))
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		l.Errorf(context.Background(), "ignoring request: %v", i)
+	}
+	l.Infof(context.Background(), "another message")
+	var msgs []string
+	for _, l := range lines(t, &b) {
+		msgs = append(msgs, l.Msg)
+	}
+	// the first two, then every third
+	assert.Equal(t, []string{"ignoring request: 0", "ignoring request: 1", "ignoring request: 4", "ignoring request: 7", "another message"}, msgs)
+
+	// counts reset every tick
+	now = now.Add(time.Second)
+	l.Errorf(context.Background(), "ignoring request: %v", 10)
+	assert.Len(t, lines(t, &b), 1)
+}
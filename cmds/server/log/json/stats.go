@@ -0,0 +1,31 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package json
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// gauges and counters
+	logSampled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "log_sampled",
+		Help:      "number of log lines dropped by sampling",
+	})
+	logEncodeError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "log_encode_error",
+		Help:      "number of log lines that could not be encoded",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(logSampled)
+	prometheus.MustRegister(logEncodeError)
+}
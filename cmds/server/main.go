@@ -11,95 +11,393 @@ import (
 	"context"
 
 	"flag"
-	"net"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/admin"
+	"github.com/facebookincubator/tacquito/cmds/server/breakglass"
 	"github.com/facebookincubator/tacquito/cmds/server/config"
 	"github.com/facebookincubator/tacquito/cmds/server/config/accounters/local"
+	"github.com/facebookincubator/tacquito/cmds/server/config/accounters/webhook"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
 	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/bcrypt"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/cache"
+	keychainauth "github.com/facebookincubator/tacquito/cmds/server/config/authenticators/keychain"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/phc"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/push"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/radius"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/totp"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authorizers/policy"
 	"github.com/facebookincubator/tacquito/cmds/server/config/authorizers/stringy"
-	"github.com/facebookincubator/tacquito/cmds/server/log"
-
 	"github.com/facebookincubator/tacquito/cmds/server/config/secret"
+	"github.com/facebookincubator/tacquito/cmds/server/config/secret/cert"
 	"github.com/facebookincubator/tacquito/cmds/server/config/secret/prefix"
+	"github.com/facebookincubator/tacquito/cmds/server/configpush"
 	"github.com/facebookincubator/tacquito/cmds/server/exporter"
 	"github.com/facebookincubator/tacquito/cmds/server/handlers"
 	"github.com/facebookincubator/tacquito/cmds/server/loader"
 	"github.com/facebookincubator/tacquito/cmds/server/loader/fsnotify"
 	"github.com/facebookincubator/tacquito/cmds/server/loader/yaml"
+	"github.com/facebookincubator/tacquito/cmds/server/lockout"
+	"github.com/facebookincubator/tacquito/cmds/server/throttle"
+	"github.com/facebookincubator/tacquito/cmds/server/transcript"
+	"github.com/facebookincubator/tacquito/cmds/server/yang"
 )
 
 var (
-	network           = flag.String("network", "tcp6", "listen on tcp or tcp6")
+	network           = flag.String("network", "tcp6", "listen on tcp, tcp4, tcp6 or unix; with unix, addresses are socket paths")
 	address           = flag.String("address", ":2046", "listen on the provided address:port")
 	proxy             = flag.Bool("proxy", false, "proxy enables proxy header processing")
+	singleConnect     = flag.Bool("single-connect", false, "negotiate rfc8907 single-connect; connections that do not request it close after one session")
+	drainTimeout      = flag.Duration("drain-timeout", 10*time.Second, "on SIGINT or SIGTERM, how long connections may finish the sessions they have in progress; 0 closes them once their current packet is served")
+	maxBodyLength     = flag.Uint("max-body-length", uint(tq.MaxBodyLength), "the longest packet body accepted, at most 65536; scopes may set their own with max_body_length")
+	strictSequence    = flag.Bool("strict-sequence", false, "terminate sessions that break the rfc8907 sequence number rules, replying with an error status where possible")
+	unencrypted       = flag.String("unencrypted-policy", "reject", "how packets with the unencrypted flag are treated on non-tls connections; reject, allow from -unencrypted-prefixes, or log and serve them")
+	unencryptedCIDRs  = flag.String("unencrypted-prefixes", "", "comma separated prefixes, eg lab networks, that -unencrypted-policy allow serves unencrypted packets from")
+	sessionRegistry   = flag.Bool("session-registry", false, "reject new sessions whose id is in progress on another connection, or completed from another source within -session-registry-grace")
+	sessionGrace      = flag.Duration("session-registry-grace", 30*time.Second, "how long the session registry holds the id of a completed session")
+	readTimeout       = flag.Duration("read-timeout", 15*time.Second, "how long a connection may idle between packets; 0 disables, which single-connect does not allow")
+	extendedArgLength = flag.Bool("extended-arg-length", false, "experimental, non-rfc; accept uint16 arg lengths from tacquito peers that set the ExtendedArgLength flag")
 	configPath        = flag.String("config", "tacquito.yaml", "the string path representing the storage location of the server config")
 	accountingLogPath = flag.String("acct-log-path", "/tmp/tacquito_accounting.log", "the string path representing the storage location of the server accounting logs")
+	acctHashChain     = flag.Bool("acct-hash-chain", false, "chain accounting records together with sha256 hashes for tamper evidence")
+	acctAnchorLogPath = flag.String("acct-anchor-log-path", "", "the string path where hash chain anchors are written; ship this file off host")
+	acctAnchorEvery   = flag.Uint64("acct-anchor-every", 1000, "the number of accounting records written between hash chain anchors")
+	acctSummarize     = flag.Bool("acct-summarize", false, "roll up accounting watchdog records into a single summary record written when the task stops")
+	acctSummaryExpiry = flag.Duration("acct-summary-expiry", 24*time.Hour, "summarized tasks with no record for this long are written as expired; 0 never expires")
+	acctRawLogPath    = flag.String("acct-raw-log-path", "", "the string path where every accounting record is written when summarizing; empty disables")
+	acctTaskLong      = flag.Duration("acct-task-long-running", 8*time.Hour, "accounting tasks running longer than this without a stop are reported as long running; 0 disables")
+	acctTaskExpiry    = flag.Duration("acct-task-expiry", 24*time.Hour, "accounting tasks with no watchdog or stop for this long are no longer tracked; 0 never expires")
+	acctEnrich        = flag.Bool("acct-enrich", false, "add the device hostname, scope, instance id and handler latency to accounting records, under metadata")
+	acctEnrichDNS     = flag.Duration("acct-enrich-dns-timeout", 250*time.Millisecond, "how long the reverse lookup of a device hostname may take; 0 names devices by their scope")
+	instanceID        = flag.String("instance-id", "", "the name of this server instance in accounting records; empty uses the hostname")
+	authorCacheTTL    = flag.Duration("author-cache-ttl", 0, "how long command authorization results are cached per user; 0 disables")
+	authorCacheSize   = flag.Int("author-cache-size", 1024, "the number of command authorization results cached per user")
+	authorAuditPath   = flag.String("author-audit-log-path", "", "the string path where every stringy authorization decision, and the rule that made it, is written as json; empty disables")
+	bcryptWorkers     = flag.Int("bcrypt-workers", 0, "the number of workers dedicated to bcrypt verification; 0 verifies on the request goroutine, unbounded")
+	bcryptQueue       = flag.Int("bcrypt-queue", 64, "the number of bcrypt verifications that may wait for a worker before logins are rejected")
+	bcryptQueueWait   = flag.Duration("bcrypt-queue-wait", 2*time.Second, "how long a bcrypt verification may wait for a worker; 0 waits as long as the request allows")
+	dnsResolver       = flag.String("dns-resolver", "", "address:port of the resolver used by DNS secret providers; empty uses the system resolver")
+	dnsTimeout        = flag.Duration("dns-timeout", 2*time.Second, "how long DNS secret providers may take to resolve a client")
+	dnsCacheTTL       = flag.Duration("dns-cache-ttl", 5*time.Minute, "how long DNS secret providers cache resolved client hostnames; 0 disables")
+	dnsNegativeTTL    = flag.Duration("dns-negative-cache-ttl", 30*time.Second, "how long DNS secret providers cache failed lookups; 0 disables")
+	dnsForwardConfirm = flag.Bool("dns-forward-confirm", true, "only match DNS secret providers on PTR names that resolve back to the client address")
 	level             = flag.Int("level", 30, "log levels; 10 = error, 20 = info, 30 = debug")
+	logFormat         = flag.String("log-format", "text", "text or json; json writes a structured object per line")
+	logSampleFirst    = flag.Int("log-sample-first", 0, "json only; each message is logged this many times a second before sampling; 0 disables sampling")
+	logSampleAfter    = flag.Int("log-sample-thereafter", 100, "json only; once sampling, every nth repeat of a message is logged")
+	lockoutUsers      = flag.Int("lockout-user-threshold", 0, "consecutive failed authentications that lock out a username; 0 disables")
+	lockoutAddresses  = flag.Int("lockout-address-threshold", 0, "consecutive failed authentications that lock out a rem-addr; 0 disables")
+	lockoutDelay      = flag.Duration("lockout-delay", time.Second, "the first lockout, doubling on every further failure")
+	lockoutMaxDelay   = flag.Duration("lockout-max-delay", 15*time.Minute, "the longest lockout")
+	lockoutWindow     = flag.Duration("lockout-window", 15*time.Minute, "how long failures are remembered after the last one, or after the lockout they caused")
+	transcriptScopes  = flag.String("transcript-scopes", "", "comma separated scopes whose sessions are recorded as decoded packet transcripts, passwords redacted; more may be added through the admin api")
+	transcriptUsers   = flag.String("transcript-users", "", "comma separated users whose sessions are recorded as decoded packet transcripts, passwords redacted")
+	transcriptKeep    = flag.Int("transcript-sessions", 100, "the number of session transcripts kept for the admin api")
+	transcriptPath    = flag.String("transcript-log-path", "", "the string path where every completed session transcript is written as json; empty disables")
+	otelEndpoint      = flag.String("otel-endpoint", "", "otlp/http collector url spans are exported to, eg http://localhost:4318; empty disables tracing")
+	otelSampleRatio   = flag.Float64("otel-sample-ratio", 1, "the fraction of connections traced, from 0 to 1")
+	otelServiceName   = flag.String("otel-service-name", "tacquito", "the service.name resource attribute of exported spans")
+	otelHeaders       = flag.String("otel-headers", "", "comma separated key=value headers sent with every export, eg authorization")
+	otelBatchSize     = flag.Int("otel-batch-size", 512, "spans are exported once this many are waiting")
+	otelFlushInterval = flag.Duration("otel-flush-interval", 5*time.Second, "how often waiting spans are exported")
+	labelScopes       = flag.Int("metrics-label-scopes", 256, "scopes labeled by name in the scope_* counters; later scopes are counted as other")
+	labelUsers        = flag.Int("metrics-label-users", 0, "usernames labeled by name in the scope_* counters; 0 leaves the user label empty")
+	throttleLatency   = flag.Duration("throttle-latency", 0, "average handler latency that disables optional features such as span mirroring; 0 disables")
+	tlsCert           = flag.String("tls-cert", "", "serve tacacs+ over tls with this certificate on every listener; reloaded when it changes or on SIGHUP")
+	tlsKey            = flag.String("tls-key", "", "key of -tls-cert")
+	tlsClientCA       = flag.String("tls-client-ca", "", "ca bundle that tls client certificates must verify against; CERT secret providers only match verified certificates")
+	tlsPeers          = flag.String("tls-peers", "", "comma separated subject alternative names a tls client certificate must have one of, eg dns:*.example.com,ip:10.0.0.0/8,uri:spiffe://example.com/router; requires a client ca")
+	adminAddress      = flag.String("admin-address", "", "listen address for the admin api; empty disables it")
+	adminTokens       = flag.String("admin-tokens", "", "file of 'role name token' lines granting admin api bearer tokens")
+	adminIdentities   = flag.String("admin-identities", "", "file of 'role identity' lines mapping admin api client certificates to roles")
+	adminTLSCert      = flag.String("admin-tls-cert", "", "certificate used by the admin api listener")
+	adminTLSKey       = flag.String("admin-tls-key", "", "key used by the admin api listener")
+	configPush        = flag.Bool("config-push", false, "serve the grpc config push service on the admin api; pushed configs are replaced by later changes to -config")
+	breakGlass        = flag.Bool("admin-break-glass", false, "serve the admin api endpoints that list scopes, report effective user policy, reload config and change users and scopes at runtime; changes are held in memory only")
+	yangAddress       = flag.String("yang-server-address", "", "the host devices reach this server at in the rfc 9105 yang export of the admin api; empty uses each listener's address, or the hostname for wildcard addresses")
+	adminClientCA     = flag.String("admin-client-ca", "", "ca bundle used to verify admin api client certificates")
+	printVersion      = flag.Bool("version", false, "print the release version and capabilities of this build, then exit")
+	validateConfig    = flag.Bool("validate", false, "build -config as the server would and print every problem found, then exit; exits 1 on errors")
+	throttleCPU       = flag.Float64("throttle-cpu", 0, "process cpu percent, of all cpus, that disables optional features such as span mirroring; 0 disables")
 )
 
 func main() {
 	flag.Parse()
-	logger := log.New(*level, os.Stderr)
+	if *printVersion {
+		fmt.Println(tq.ReleaseVersion(), tq.Capabilities())
+		return
+	}
+	logger, err := newLogger()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	// we need thrift running to collect Prometheus stats for ODS
-	go func() {
-		defer cancel()
-		if err := exporter.StartPromHTTP(); err != nil {
-			logger.Errorf(ctx, "failed to start prometheus http exporter: %v", err)
+	// stats are shared by the servers of every listener
+	stats := tq.NewStats()
+
+	// validation must not export, or overwrite, the metrics of a running server
+	if !*validateConfig {
+		// restore persisted counters before they are exported
+		if err := exporter.StartPersistence(ctx); err != nil {
+			logger.Fatalf(ctx, "error restoring persisted metrics; %v", err)
+			return
 		}
-	}()
+		defer func() {
+			// ctx is already cancelled during shutdown
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := exporter.Shutdown(shutdownCtx); err != nil {
+				logger.Errorf(shutdownCtx, "unable to persist metrics; %v", err)
+			}
+		}()
+
+		// we need thrift running to collect Prometheus stats for ODS
+		go func() {
+			defer cancel()
+			if err := exporter.StartPromHTTP(ctx, logger, exporter.SetStats(stats)); err != nil {
+				logger.Errorf(ctx, "failed to start prometheus http exporter: %v", err)
+			}
+		}()
+	}
 
-	accountingLogger, err := local.New(logger, local.SetLogSinkDefault(*accountingLogPath, "tacquito"))
+	accountingOpts := []local.Option{local.SetLogSinkDefault(*accountingLogPath, "tacquito")}
+	if *acctHashChain {
+		chain := local.NewChain(nil, 0)
+		if *acctAnchorLogPath != "" {
+			anchors, err := local.NewLogSink(*acctAnchorLogPath, "tacquito-anchor")
+			if err != nil {
+				logger.Fatalf(ctx, "error opening accounting anchor log; %v", err)
+				return
+			}
+			chain = local.NewChain(anchors, *acctAnchorEvery)
+		}
+		accountingOpts = append(accountingOpts, local.SetHashChain(chain))
+	}
+	if *acctSummarize {
+		accountingOpts = append(accountingOpts, local.SetSummarizer(local.NewSummarizer(*acctSummaryExpiry)))
+		if *acctRawLogPath != "" {
+			raw, err := local.NewLogSink(*acctRawLogPath, "tacquito-raw")
+			if err != nil {
+				logger.Fatalf(ctx, "error opening raw accounting log; %v", err)
+				return
+			}
+			accountingOpts = append(accountingOpts, local.SetRawSink(raw))
+		}
+	}
+	accountingLogger, err := local.New(logger, accountingOpts...)
 	if err != nil {
 		logger.Fatalf(ctx, "error building accounting logger; %v", err)
 		return
 	}
+	defer func() {
+		// flush batched accounting records
+		if err := accountingLogger.Close(); err != nil {
+			logger.Errorf(context.Background(), "%v", err)
+		}
+	}()
+
+	// the governor only engages when a threshold is configured
+	governor := throttle.New(logger, throttle.SetLatencyThreshold(*throttleLatency), throttle.SetCPUThreshold(*throttleCPU))
+
+	// optional integrations compiled in with build tags
+	extended, err := extensionOptions(ctx, logger)
+	if err != nil {
+		logger.Fatalf(ctx, "error enabling extensions; %v", err)
+		return
+	}
+
+	handlers.SetLabelLimits(*labelScopes, *labelUsers)
+	startOpts := []handlers.StartOption{handlers.SetStartTaskLongRunning(*acctTaskLong), handlers.SetStartTaskExpiry(*acctTaskExpiry)}
+	var lockouts *lockout.Lockout
+	if *lockoutUsers > 0 || *lockoutAddresses > 0 {
+		lockouts = lockout.New(
+			logger,
+			lockout.SetThreshold(lockout.User, *lockoutUsers),
+			lockout.SetThreshold(lockout.Address, *lockoutAddresses),
+			lockout.SetDelay(*lockoutDelay, *lockoutMaxDelay),
+			lockout.SetWindow(*lockoutWindow),
+		)
+		startOpts = append(startOpts, handlers.SetStartLockout(lockouts))
+	}
+	if *acctEnrich {
+		id := *instanceID
+		if id == "" {
+			id, _ = os.Hostname()
+		}
+		startOpts = append(startOpts, handlers.SetStartEnrichers(
+			handlers.NewDeviceEnricher(logger, handlers.SetDeviceEnricherTimeout(*acctEnrichDNS), handlers.SetDeviceEnricherFeatureGate(governor)),
+			handlers.ScopeEnricher,
+			handlers.NewInstanceEnricher(id),
+			handlers.LatencyEnricher,
+		))
+	}
 
 	shhh := &shh{}
-	sp, err := loader.NewLocalConfig(
-		ctx,
-		*configPath,
-		fsnotify.New(ctx, yaml.New(), logger),
+	var bcryptOpts []bcrypt.Option
+	if *bcryptWorkers > 0 {
+		bcryptOpts = append(bcryptOpts, bcrypt.SetPool(bcrypt.NewPool(*bcryptWorkers, *bcryptQueue, *bcryptQueueWait)))
+	}
+	stringyOpts := []stringy.Option{stringy.SetCommandCache(*authorCacheTTL, *authorCacheSize)}
+	if *authorAuditPath != "" {
+		audit, err := local.NewLogSink(*authorAuditPath, "tacquito-author-audit")
+		if err != nil {
+			logger.Fatalf(ctx, "error opening authorization audit log; %v", err)
+			return
+		}
+		stringyOpts = append(stringyOpts, stringy.SetAuditLog(audit))
+	}
+	keychain := secret.New()
+	start := handlers.NewStart(logger, startOpts...)
+	opts := []loader.Option{
 		loader.SetLoggerProvider(logger),
-		loader.SetKeychainProvider(secret.New()),
+		loader.SetKeychainProvider(keychain),
 		loader.SetConfigProvider(config.New()),
-		loader.SetAuthorizerProvider(stringy.New(logger)),
+		loader.SetAuthorizerProvider(stringy.New(logger, stringyOpts...)),
 		loader.RegisterSecretProviderType(config.PREFIX, prefix.New(logger)),
-		loader.RegisterHandlerType(config.START, handlers.NewStart(logger)),
-		loader.RegisterAuthenticator(config.BCRYPT, bcrypt.New(logger, shhh)),
+		loader.RegisterSecretProviderType(config.DNS, newDNSProvider(logger)),
+		loader.RegisterSecretProviderType(config.CERT, cert.New(logger)),
+		loader.RegisterHandlerType(config.START, start),
+		loader.RegisterHandlerType(config.SPAN, handlers.NewSpan(logger, handlers.SetSpanFeatureGate(governor), handlers.SetSpanHandler(start))),
+		loader.RegisterHandlerType(config.PROXY, handlers.NewProxy(logger, keychain)),
 		loader.RegisterAccounter(config.FILE, accountingLogger),
+		loader.RegisterAccounter(config.WEBHOOK, webhook.New(ctx, logger)),
+		loader.RegisterAuthorizer(config.POLICY, policy.New(logger)),
+	}
+	authenticatorTypes := map[config.AuthenticatorType]authenticators.Factory{
+		config.BCRYPT:   bcrypt.New(logger, shhh, bcryptOpts...),
+		config.RADIUS:   radius.New(logger),
+		config.ARGON2ID: phc.NewArgon2id(logger, shhh),
+		config.SCRYPT:   phc.NewScrypt(logger, shhh),
+		config.PHC:      phc.New(logger, shhh),
+		config.KEYCHAIN: keychainauth.New(logger, shhh),
+	}
+	if err := extensionAuthenticators(ctx, logger, authenticatorTypes); err != nil {
+		logger.Fatalf(ctx, "error enabling extensions; %v", err)
+		return
+	}
+	for t, a := range authenticatorTypes {
+		opts = append(opts, loader.RegisterAuthenticator(t, a))
+	}
+	// the totp, push and cache authenticators wrap any of the others
+	authCache := cache.New(logger, authenticatorTypes)
+	opts = append(opts, loader.RegisterAuthenticator(config.TOTP, totp.New(logger, shhh, authenticatorTypes)))
+	opts = append(opts, loader.RegisterAuthenticator(config.PUSH, push.New(logger, authenticatorTypes)))
+	opts = append(opts, loader.RegisterAuthenticator(config.CACHE, authCache))
+	sources, err := extensionSources(ctx, logger)
+	if err != nil {
+		logger.Fatalf(ctx, "error enabling extensions; %v", err)
+		return
+	}
+	// users may come from a directory alone, the config file then needs none
+	usersOptional := yaml.SetUsersOptional(len(sources) > 0)
+	if *validateConfig {
+		os.Exit(validate(ctx, *configPath, wrapSource(yaml.New(usersOptional), sources), append(opts, extended...)))
+	}
+	sp, err := loader.NewLocalConfig(
+		ctx,
+		*configPath,
+		wrapSource(fsnotify.New(ctx, yaml.New(usersOptional), logger), sources),
+		append(opts, extended...)...,
 	)
 	if err != nil {
 		logger.Fatalf(ctx, "error fetching config; %v", err)
 		return
 	}
 
-	// setup our listener
-	listener, err := net.Listen(*network, *address)
+	tlsConfig, err := newTLS(ctx, logger)
+	if err != nil {
+		logger.Fatalf(ctx, "error building tls config; %v", err)
+		return
+	}
+
+	// setup our listeners, those of -listen, one per packet type split onto its own address plus the default
+	listeners, err := newListeners(ctx, logger, *network, tlsConfig)
+	if err != nil {
+		logger.Fatalf(ctx, "%v", err)
+		return
+	}
+
+	var secretProvider tq.SecretProvider = sp
+	if *throttleLatency > 0 || *throttleCPU > 0 {
+		go governor.Run(ctx)
+		secretProvider = governor.NewSecretProvider(sp)
+	}
+
+	transcripts, err := newTranscripts(logger, governor)
 	if err != nil {
-		logger.Fatalf(ctx, "error reading address: %v", err)
+		logger.Fatalf(ctx, "error opening transcript log; %v", err)
 		return
 	}
 
-	tcpListener, ok := listener.(*net.TCPListener)
-	if !ok {
-		logger.Fatalf(ctx, "listener must be a tcp based listener")
+	serverOpts := append([]tq.Option{tq.SetUseProxy(*proxy), tq.SetExtendedArgLength(*extendedArgLength), tq.SetSingleConnect(*singleConnect), tq.SetReadTimeout(*readTimeout), tq.SetDrainTimeout(*drainTimeout), tq.SetMaxBodyLength(uint32(*maxBodyLength)), tq.SetStrictSequence(*strictSequence), tq.SetMiddleware(transcripts.Middleware), tq.SetStats(stats)}, sourceLimits(*sourceConnRate, *maxSourceConns, *maxSessions, *maxConcurrent)...)
+	if *sessionRegistry {
+		serverOpts = append(serverOpts, tq.SetSessionRegistry(*sessionGrace))
+	}
+	unencryptedOpt, err := unencryptedPolicy(*unencrypted, *unencryptedCIDRs)
+	if err != nil {
+		logger.Fatalf(ctx, "error reading the unencrypted policy; %v", err)
+		return
+	}
+	serverOpts = append(serverOpts, unencryptedOpt)
+	peerPolicy, err := tlsPeerPolicy(*tlsPeers)
+	if err != nil {
+		logger.Fatalf(ctx, "error reading the tls peer policy; %v", err)
 		return
 	}
-	logger.Infof(ctx, "serve on %v", tcpListener.Addr().String())
+	if peerPolicy != nil {
+		serverOpts = append(serverOpts, tq.SetTLSPeerPolicy(peerPolicy))
+	}
+
+	if *adminAddress != "" {
+		api, tlsConfig, err := newAdmin(ctx, logger)
+		if err != nil {
+			logger.Fatalf(ctx, "error building admin api; %v", err)
+			return
+		}
+		if *configPush {
+			if tlsConfig == nil {
+				logger.Fatalf(ctx, "-config-push requires -admin-tls-cert and -admin-tls-key, grpc needs http/2")
+				return
+			}
+			api.Handle(configpush.Path, "config-push", admin.Admin, configpush.New(logger, sp))
+		}
+		if *breakGlass {
+			breakglass.New(logger, sp).Register(api)
+		}
+		api.Handle(admin.StatsPath, "stats", admin.ReadOnly, stats)
+		api.Handle(yang.Path, "yang-export", admin.ReadOnly, yang.NewHandler(sp, yangServers(listeners, *yangAddress, serverOpts)))
+		api.Handle(cache.FlushPath, "authenticator-cache-flush", admin.Operator, http.HandlerFunc(authCache.ServeFlush))
+		api.Handle(transcript.ListPath, "transcript-list", admin.Operator, http.HandlerFunc(transcripts.ServeList))
+		api.Handle(transcript.EnablePath, "transcript-enable", admin.Operator, http.HandlerFunc(transcripts.ServeEnable))
+		api.Handle(transcript.DisablePath, "transcript-disable", admin.Operator, http.HandlerFunc(transcripts.ServeDisable))
+		if lockouts != nil {
+			api.Handle(lockout.ListPath, "lockout-list", admin.ReadOnly, http.HandlerFunc(lockouts.ServeList))
+			api.Handle(lockout.UnlockPath, "lockout-unlock", admin.Operator, http.HandlerFunc(lockouts.ServeUnlock))
+		}
+		go func() {
+			if err := api.ListenAndServe(ctx, *adminAddress, tlsConfig); err != nil {
+				logger.Errorf(ctx, "admin api stopped; %v", err)
+			}
+		}()
+	}
 
-	s := tq.NewServer(logger, sp, tq.SetUseProxy(*proxy))
-	if err := s.Serve(ctx, tcpListener); err != nil {
-		logger.Errorf(ctx, "error listening: %v", err)
+	tracing, err := newTracer(ctx, logger)
+	if err != nil {
+		logger.Fatalf(ctx, "error enabling tracing; %v", err)
 		return
 	}
+	serveListeners(ctx, logger, secretProvider, listeners, append(serverOpts, tracing...)...)
 }
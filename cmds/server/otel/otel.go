@@ -0,0 +1,455 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package otel exports the spans of tacquito's tq.Tracer hook to an opentelemetry collector.  It
+// speaks just enough of otlp, json over http, to export spans, so it carries no third party
+// dependencies.  Spans are batched and exported in the background; when the export queue is full
+// spans are dropped rather than slowing down the server.
+package otel
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+const (
+	// TracesPath is the otlp/http path spans are posted to, appended to endpoints without a path
+	TracesPath = "/v1/traces"
+
+	defaultServiceName   = "tacquito"
+	defaultQueueSize     = 2048
+	defaultBatchSize     = 512
+	defaultFlushInterval = 5 * time.Second
+	defaultTimeout       = 10 * time.Second
+)
+
+// otlp span kinds and status codes
+const (
+	kindInternal    = 1
+	kindServer      = 2
+	statusCodeOK    = 1
+	statusCodeError = 2
+)
+
+// Option configures a Tracer
+type Option func(t *Tracer)
+
+// SetSampleRatio sets the fraction of connections that are traced, from 0 to 1.  Sampling is
+// decided once per connection, so every span of a traced connection is exported.  Defaults to 1.
+func SetSampleRatio(ratio float64) Option {
+	return func(t *Tracer) {
+		t.ratio = ratio
+	}
+}
+
+// SetServiceName sets the service.name resource attribute, defaulting to tacquito
+func SetServiceName(name string) Option {
+	return func(t *Tracer) {
+		t.serviceName = name
+	}
+}
+
+// SetHeaders adds headers, eg authorization, to every export request
+func SetHeaders(headers map[string]string) Option {
+	return func(t *Tracer) {
+		t.headers = headers
+	}
+}
+
+// SetBatch exports spans once size spans are waiting, or every interval.  Defaults to 512 spans
+// and 5 seconds.
+func SetBatch(size int, interval time.Duration) Option {
+	return func(t *Tracer) {
+		t.batchSize = size
+		t.flushInterval = interval
+	}
+}
+
+// SetQueueSize bounds how many ended spans may wait to be batched, defaulting to 2048
+func SetQueueSize(n int) Option {
+	return func(t *Tracer) {
+		t.queueSize = n
+	}
+}
+
+// SetHTTPClient sets the client used to export spans, eg to configure tls
+func SetHTTPClient(c *http.Client) Option {
+	return func(t *Tracer) {
+		t.client = c
+	}
+}
+
+// New creates a Tracer exporting to endpoint, an otlp/http url such as http://collector:4318.
+// Spans are exported until ctx is done, when the spans still queued are flushed.
+func New(ctx context.Context, l loggerProvider, endpoint string, opts ...Option) (*Tracer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otel endpoint [%v]; %v", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid otel endpoint [%v]; scheme must be http or https", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = TracesPath
+	}
+	t := &Tracer{
+		loggerProvider: l,
+		endpoint:       u.String(),
+		ratio:          1,
+		serviceName:    defaultServiceName,
+		queueSize:      defaultQueueSize,
+		batchSize:      defaultBatchSize,
+		flushInterval:  defaultFlushInterval,
+		client:         &http.Client{Timeout: defaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.ratio < 0 || t.ratio > 1 {
+		return nil, fmt.Errorf("invalid otel sample ratio [%v], must be from 0 to 1", t.ratio)
+	}
+	if t.batchSize < 1 || t.flushInterval <= 0 || t.queueSize < 1 {
+		return nil, fmt.Errorf("invalid otel batch size [%v], flush interval [%v] or queue size [%v]", t.batchSize, t.flushInterval, t.queueSize)
+	}
+	t.queue = make(chan *span, t.queueSize)
+	t.done = make(chan struct{})
+	go t.run(ctx)
+	return t, nil
+}
+
+// Tracer implements tq.Tracer
+type Tracer struct {
+	loggerProvider
+	endpoint      string
+	ratio         float64
+	serviceName   string
+	headers       map[string]string
+	queueSize     int
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+
+	// queue holds ended, sampled spans waiting to be exported
+	queue chan *span
+	// done is closed once the export loop has flushed and returned
+	done chan struct{}
+}
+
+type spanKey struct{}
+
+// spanContext identifies a span and carries the sampling decision of its trace
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+// Start begins a span, the child of the span in ctx if there is one.  Spans without a parent are
+// server spans, sampled by the configured ratio.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, tq.Span) {
+	s := &span{tracer: t, name: name, kind: kindInternal, start: time.Now()}
+	if parent, ok := ctx.Value(spanKey{}).(spanContext); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+		s.sampled = parent.sampled
+		s.hasParent = true
+	} else {
+		rand.Read(s.traceID[:])
+		s.kind = kindServer
+		s.sampled = t.sample(s.traceID)
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s.spanContext), s
+}
+
+// sample deterministically samples traceID by ratio, the way otel's TraceIDRatioBased sampler does
+func (t *Tracer) sample(traceID [16]byte) bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	return binary.BigEndian.Uint64(traceID[8:])>>1 < uint64(t.ratio*(1<<63))
+}
+
+// Flush waits for the export loop to return after its ctx is done, so queued spans are exported
+// before the process exits
+func (t *Tracer) Flush() {
+	<-t.done
+}
+
+// end queues a sampled span for export, dropping it if the queue is full
+func (t *Tracer) end(s *span) {
+	select {
+	case t.queue <- s:
+	default:
+		otelSpanDropped.Inc()
+	}
+}
+
+// run batches queued spans until ctx is done
+func (t *Tracer) run(ctx context.Context) {
+	defer close(t.done)
+	ticker := time.NewTicker(t.flushInterval)
+	defer ticker.Stop()
+	var batch []*span
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.batchSize {
+				t.export(ctx, batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				t.export(ctx, batch)
+				batch = nil
+			}
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					break drain
+				}
+			}
+			if len(batch) > 0 {
+				flushCtx, cancel := context.WithTimeout(context.Background(), t.client.Timeout+time.Second)
+				t.export(flushCtx, batch)
+				cancel()
+			}
+			return
+		}
+	}
+}
+
+// export posts a batch of spans to the collector
+func (t *Tracer) export(ctx context.Context, batch []*span) {
+	b, err := json.Marshal(t.request(batch))
+	if err != nil {
+		otelExportError.Inc()
+		t.Errorf(ctx, "unable to encode otel spans; %v", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(b))
+	if err != nil {
+		otelExportError.Inc()
+		t.Errorf(ctx, "unable to create otel export request; %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		otelExportError.Inc()
+		t.Errorf(ctx, "unable to export [%v] otel spans to [%v]; %v", len(batch), t.endpoint, err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		otelExportError.Inc()
+		t.Errorf(ctx, "unable to export [%v] otel spans to [%v]; status [%v]", len(batch), t.endpoint, resp.Status)
+		return
+	}
+	otelSpanExported.Add(float64(len(batch)))
+}
+
+// request builds an otlp ExportTraceServiceRequest holding batch
+func (t *Tracer) request(batch []*span) exportRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		spans = append(spans, s.otlp())
+	}
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource: resource{Attributes: []keyValue{attribute("service.name", t.serviceName)}},
+		ScopeSpans: []scopeSpans{{
+			Scope: scope{Name: "github.com/facebookincubator/tacquito", Version: tq.ReleaseVersion()},
+			Spans: spans,
+		}},
+	}}}
+}
+
+// span implements tq.Span
+type span struct {
+	spanContext
+	tracer    *Tracer
+	name      string
+	kind      int
+	parentID  [8]byte
+	hasParent bool
+	start     time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []keyValue
+	err        error
+	ended      bool
+}
+
+// SetAttribute annotates the span, ignored once the span has ended or if it is not sampled
+func (s *span) SetAttribute(key string, value interface{}) {
+	if !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.attributes = append(s.attributes, attribute(key, value))
+	}
+}
+
+// End completes the span, queueing it for export if it is sampled
+func (s *span) End(err error) {
+	if !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.end, s.err = true, time.Now(), err
+	s.mu.Unlock()
+	s.tracer.end(s)
+}
+
+// otlp converts an ended span to its otlp json representation
+func (s *span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        s.attributes,
+		Status:            status{Code: statusCodeOK},
+	}
+	if s.hasParent {
+		o.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if s.err != nil {
+		o.Status = status{Code: statusCodeError, Message: s.err.Error()}
+	}
+	return o
+}
+
+// attribute converts value to an otlp AnyValue
+func attribute(key string, value interface{}) keyValue {
+	var v anyValue
+	switch t := value.(type) {
+	case string:
+		v.StringValue = &t
+	case bool:
+		v.BoolValue = &t
+	case int:
+		v.IntValue = strconv.FormatInt(int64(t), 10)
+	case int8:
+		v.IntValue = strconv.FormatInt(int64(t), 10)
+	case int16:
+		v.IntValue = strconv.FormatInt(int64(t), 10)
+	case int32:
+		v.IntValue = strconv.FormatInt(int64(t), 10)
+	case int64:
+		v.IntValue = strconv.FormatInt(t, 10)
+	case uint8:
+		v.IntValue = strconv.FormatUint(uint64(t), 10)
+	case uint16:
+		v.IntValue = strconv.FormatUint(uint64(t), 10)
+	case uint32:
+		v.IntValue = strconv.FormatUint(uint64(t), 10)
+	case float32:
+		f := float64(t)
+		v.DoubleValue = &f
+	case float64:
+		v.DoubleValue = &t
+	default:
+		s := fmt.Sprint(t)
+		v.StringValue = &s
+	}
+	return keyValue{Key: key, Value: v}
+}
+
+// the otlp json encoding of an ExportTraceServiceRequest, see
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+// anyValue sets exactly one field.  int64 values are strings in otlp json
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    string   `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
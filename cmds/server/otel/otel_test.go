@@ -0,0 +1,154 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package otel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// collector records the spans posted to it
+type collector struct {
+	sync.Mutex
+	spans   []otlpSpan
+	headers http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req exportRequest
+	if r.URL.Path != TracesPath || json.NewDecoder(r.Body).Decode(&req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.headers = r.Header
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+}
+
+func (c *collector) collected() []otlpSpan {
+	c.Lock()
+	defer c.Unlock()
+	return append([]otlpSpan(nil), c.spans...)
+}
+
+func TestExport(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tracer, err := New(ctx, mockLogger{}, srv.URL, SetBatch(3, time.Hour), SetHeaders(map[string]string{"Authorization": "Bearer foo"}))
+	require.NoError(t, err)
+
+	connCtx, conn := tracer.Start(context.Background(), "tacacs.connection")
+	conn.SetAttribute("net.peer.addr", "[::1]:1234")
+	packetCtx, packet := tracer.Start(connCtx, "tacacs.packet")
+	packet.SetAttribute("tacacs.seq_no", uint8(1))
+	_, handler := tracer.Start(packetCtx, "tacacs.handler")
+	handler.End(errors.New("bad things"))
+	packet.End(nil)
+	conn.End(nil)
+
+	// the batch size is reached, so the spans are exported without waiting for the interval
+	assert.Eventually(t, func() bool { return len(c.collected()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	spans := c.collected()
+	byName := map[string]otlpSpan{}
+	for _, s := range spans {
+		byName[s.Name] = s
+		assert.Equal(t, spans[0].TraceID, s.TraceID, "every span shares the trace")
+	}
+	assert.Empty(t, byName["tacacs.connection"].ParentSpanID)
+	assert.Equal(t, kindServer, byName["tacacs.connection"].Kind)
+	assert.Equal(t, byName["tacacs.connection"].SpanID, byName["tacacs.packet"].ParentSpanID)
+	assert.Equal(t, byName["tacacs.packet"].SpanID, byName["tacacs.handler"].ParentSpanID)
+	assert.Equal(t, kindInternal, byName["tacacs.handler"].Kind)
+	assert.Equal(t, status{Code: statusCodeError, Message: "bad things"}, byName["tacacs.handler"].Status)
+	assert.Equal(t, status{Code: statusCodeOK}, byName["tacacs.packet"].Status)
+	assert.Equal(t, "1", byName["tacacs.packet"].Attributes[0].Value.IntValue)
+	assert.Equal(t, "[::1]:1234", *byName["tacacs.connection"].Attributes[0].Value.StringValue)
+	assert.Equal(t, "Bearer foo", c.headers.Get("Authorization"))
+
+	// spans still queued are flushed when ctx is done
+	_, last := tracer.Start(context.Background(), "tacacs.connection")
+	last.End(nil)
+	last.End(nil)
+	cancel()
+	tracer.Flush()
+	assert.Len(t, c.collected(), 4, "a span is only exported once")
+}
+
+func TestSampleRatio(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	tracer, err := New(ctx, mockLogger{}, srv.URL, SetSampleRatio(0))
+	require.NoError(t, err)
+
+	connCtx, conn := tracer.Start(context.Background(), "tacacs.connection")
+	_, packet := tracer.Start(connCtx, "tacacs.packet")
+	packet.End(nil)
+	conn.End(nil)
+	cancel()
+	tracer.Flush()
+	assert.Empty(t, c.collected(), "children follow the sampling decision of their connection")
+
+	always := &Tracer{ratio: 1}
+	never := &Tracer{ratio: 0}
+	half := &Tracer{ratio: 0.5}
+	low, high := [16]byte{}, [16]byte{8: 0xff}
+	assert.True(t, always.sample(high))
+	assert.False(t, never.sample(low))
+	assert.True(t, half.sample(low))
+	assert.False(t, half.sample(high))
+}
+
+func TestNew(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tests := []struct {
+		name     string
+		endpoint string
+		opts     []Option
+		want     string
+	}{
+		{name: "path appended", endpoint: "http://localhost:4318", want: "http://localhost:4318/v1/traces"},
+		{name: "path kept", endpoint: "https://localhost/otlp/traces", want: "https://localhost/otlp/traces"},
+		{name: "bad scheme", endpoint: "localhost:4318"},
+		{name: "bad ratio", endpoint: "http://localhost:4318", opts: []Option{SetSampleRatio(2)}},
+		{name: "bad batch", endpoint: "http://localhost:4318", opts: []Option{SetBatch(0, time.Second)}},
+	}
+	for _, test := range tests {
+		tracer, err := New(ctx, mockLogger{}, test.endpoint, test.opts...)
+		if test.want == "" {
+			assert.Error(t, err, test.name)
+			continue
+		}
+		require.NoError(t, err, test.name)
+		assert.Equal(t, test.want, tracer.endpoint, test.name)
+	}
+}
@@ -0,0 +1,36 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package otel
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	otelSpanExported = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "otel_span_exported",
+		Help:      "number of spans exported to the otel collector",
+	})
+	otelSpanDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "otel_span_dropped",
+		Help:      "number of spans dropped because the export queue was full",
+	})
+	otelExportError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "otel_export_error",
+		Help:      "number of span batches that could not be exported to the otel collector",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(otelSpanExported)
+	prometheus.MustRegister(otelSpanDropped)
+	prometheus.MustRegister(otelExportError)
+}
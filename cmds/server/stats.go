@@ -0,0 +1,30 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	listenerAccepted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "listener_accepted",
+		Help:      "number of connections accepted by each listener, before any limit applies",
+	}, []string{"listener"})
+	listenerConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "listener_connections",
+		Help:      "number of connections open on each listener",
+	}, []string{"listener"})
+)
+
+func init() {
+	prometheus.MustRegister(listenerAccepted)
+	prometheus.MustRegister(listenerConnections)
+}
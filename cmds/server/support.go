@@ -9,11 +9,54 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/facebookincubator/tacquito/cmds/server/admin"
+	"github.com/facebookincubator/tacquito/cmds/server/config/accounters/local"
+	"github.com/facebookincubator/tacquito/cmds/server/config/secret/dns"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+	jsonlog "github.com/facebookincubator/tacquito/cmds/server/log/json"
+	"github.com/facebookincubator/tacquito/cmds/server/otel"
+	"github.com/facebookincubator/tacquito/cmds/server/throttle"
+	"github.com/facebookincubator/tacquito/cmds/server/tlsreload"
+	"github.com/facebookincubator/tacquito/cmds/server/transcript"
 )
 
 // The code here supports instantiation of types within the main func.
 // We keep items here to avoid cluttering the main func.
 
+// loggerProvider is the logging implementation selected by -log-format
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+	Fatalf(ctx context.Context, format string, args ...interface{})
+	Record(ctx context.Context, r map[string]string, obscure ...string)
+	Set(ctx context.Context, fields map[string]string, keys ...tq.ContextKey) context.Context
+}
+
+// newLogger builds the logger selected by -log-format
+func newLogger() (loggerProvider, error) {
+	switch *logFormat {
+	case "text":
+		return log.New(*level, os.Stderr), nil
+	case "json":
+		var opts []jsonlog.Option
+		if *logSampleFirst > 0 {
+			opts = append(opts, jsonlog.SetSampling(*logSampleFirst, *logSampleAfter, time.Second))
+		}
+		return jsonlog.New(*level, os.Stderr, opts...), nil
+	}
+	return nil, fmt.Errorf("unknown log format [%v], expected text or json", *logFormat)
+}
+
 // shh is a example implementation of a simple secret provider that fulfills the private getSecret interface
 type shh struct{}
 
@@ -21,3 +64,184 @@ type shh struct{}
 func (s *shh) GetSecret(ctx context.Context, name, group string) ([]byte, error) {
 	return []byte("cisco"), nil
 }
+
+// newAdmin builds the admin api from flags.  mTLS identities require a client ca.  The tls
+// certificate is reloaded until ctx is cancelled.
+func newAdmin(ctx context.Context, logger loggerProvider) (*admin.Server, *tls.Config, error) {
+	var providers []admin.IdentityProvider
+	if *adminTokens != "" {
+		tokens, err := admin.LoadStaticTokens(*adminTokens)
+		if err != nil {
+			return nil, nil, err
+		}
+		providers = append(providers, tokens)
+	}
+	if *adminIdentities != "" {
+		if *adminClientCA == "" {
+			return nil, nil, fmt.Errorf("-admin-identities requires -admin-client-ca")
+		}
+		identities, err := admin.LoadCertIdentities(*adminIdentities)
+		if err != nil {
+			return nil, nil, err
+		}
+		providers = append(providers, identities)
+	}
+	if len(providers) == 0 {
+		return nil, nil, fmt.Errorf("the admin api requires -admin-tokens or -admin-identities")
+	}
+	var tlsConfig *tls.Config
+	if *adminTLSCert != "" || *adminTLSKey != "" {
+		base := &tls.Config{MinVersion: tls.VersionTLS12}
+		var opts []tlsreload.Option
+		if *adminClientCA != "" {
+			opts = append(opts, tlsreload.SetClientCA(*adminClientCA))
+			// token callers may not have a certificate, but any presented one must verify
+			base.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		// the certificate, key and client ca are reloaded when they change or on SIGHUP
+		reloader, err := tlsreload.New(logger, *adminTLSCert, *adminTLSKey, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := reloader.Watch(ctx); err != nil {
+			return nil, nil, err
+		}
+		tlsConfig = reloader.Config(base)
+	} else if *adminClientCA != "" {
+		return nil, nil, fmt.Errorf("-admin-client-ca requires -admin-tls-cert and -admin-tls-key")
+	}
+	return admin.New(logger, admin.SetIdentityProviders(providers...)), tlsConfig, nil
+}
+
+// newTranscripts builds the session transcript recorder from flags.  It is always built, so
+// operators may start recording through the admin api.
+func newTranscripts(logger loggerProvider, gate *throttle.Governor) (*transcript.Recorder, error) {
+	opts := []transcript.Option{
+		transcript.SetFeatureGate(gate),
+		transcript.SetScopes(splitList(*transcriptScopes)...),
+		transcript.SetUsers(splitList(*transcriptUsers)...),
+		transcript.SetCapacity(*transcriptKeep),
+	}
+	if *transcriptPath != "" {
+		sink, err := local.NewLogSink(*transcriptPath, "tacquito-transcript")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, transcript.SetSink(sink))
+	}
+	return transcript.New(logger, opts...), nil
+}
+
+// newTracer returns the server options that export spans to an otel collector, none if
+// -otel-endpoint is not set
+func newTracer(ctx context.Context, logger loggerProvider) ([]tq.Option, error) {
+	if *otelEndpoint == "" {
+		return nil, nil
+	}
+	headers := map[string]string{}
+	for _, h := range splitList(*otelHeaders) {
+		k, v, ok := strings.Cut(h, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid otel header [%v], must be key=value", h)
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	tracer, err := otel.New(
+		ctx,
+		logger,
+		*otelEndpoint,
+		otel.SetSampleRatio(*otelSampleRatio),
+		otel.SetServiceName(*otelServiceName),
+		otel.SetHeaders(headers),
+		otel.SetBatch(*otelBatchSize, *otelFlushInterval),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return []tq.Option{tq.SetTracer(tracer)}, nil
+}
+
+// splitList splits a comma separated flag, dropping empty items
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newTLS builds the tls config of the tacacs+ listeners from flags, nil if tls is not enabled.
+// Clients that present a certificate must verify against the client ca, but clients without one
+// are still served, so they may be matched by address.
+func newTLS(ctx context.Context, logger loggerProvider) (*tls.Config, error) {
+	if *tlsCert == "" && *tlsKey == "" {
+		if *tlsClientCA != "" {
+			return nil, fmt.Errorf("-tls-client-ca requires -tls-cert and -tls-key")
+		}
+		return nil, nil
+	}
+	return loadTLS(ctx, logger, *tlsCert, *tlsKey, *tlsClientCA)
+}
+
+// loadTLS builds a tls 1.3 config serving cert and key, verifying client certificates against
+// clientCA when clients present one, or always if -tls-peers is set.  The files are reloaded when
+// they change or on SIGHUP.
+func loadTLS(ctx context.Context, logger loggerProvider, cert, key, clientCA string) (*tls.Config, error) {
+	base := &tls.Config{MinVersion: tls.VersionTLS13}
+	var opts []tlsreload.Option
+	if clientCA != "" {
+		opts = append(opts, tlsreload.SetClientCA(clientCA))
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+		if *tlsPeers != "" {
+			base.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if *tlsPeers != "" {
+		return nil, fmt.Errorf("-tls-peers requires a client ca to verify client certificates with")
+	}
+	reloader, err := tlsreload.New(logger, cert, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := reloader.Watch(ctx); err != nil {
+		return nil, err
+	}
+	return reloader.Config(base), nil
+}
+
+// tlsPeerPolicy parses the comma separated entries of -tls-peers, nil if there are none
+func tlsPeerPolicy(entries string) (*tq.TLSPeerPolicy, error) {
+	var list []string
+	for _, entry := range strings.Split(entries, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return tq.ParseTLSPeerPolicy(list...)
+}
+
+// newDNSProvider builds the dns secret provider from flags.  An empty resolver address uses the
+// system resolver.
+func newDNSProvider(logger loggerProvider) *dns.Provider {
+	opts := []dns.ProviderOption{
+		dns.SetTimeout(*dnsTimeout),
+		dns.SetCacheTTL(*dnsCacheTTL),
+		dns.SetNegativeCacheTTL(*dnsNegativeTTL),
+		dns.SetForwardConfirm(*dnsForwardConfirm),
+	}
+	if *dnsResolver != "" {
+		server := *dnsResolver
+		opts = append(opts, dns.SetResolver(&net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}))
+	}
+	return dns.New(logger, opts...)
+}
@@ -68,6 +68,48 @@ func acctFlagStart(t *testing.T) []Test {
 
 }
 
+// acctTaskFlow sends a task through start, both watchdog kinds and stop.  Every accounting record
+// is its own session, so each is seqno 1.
+func acctTaskFlow(t *testing.T) []Test {
+	var seq []Sequence
+	for i, f := range []tq.AcctRequestFlag{tq.AcctFlagStart, tq.AcctFlagWatchdog, tq.AcctFlagWatchdogWithUpdate, tq.AcctFlagStop} {
+		seq = append(seq, Sequence{
+			Packet: tq.NewPacket(
+				tq.SetPacketHeader(
+					tq.NewHeader(
+						tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionDefault}),
+						tq.SetHeaderType(tq.Accounting),
+						tq.SetHeaderSessionID(tq.SessionID(100+i)),
+					),
+				),
+				tq.SetPacketBodyUnsafe(
+					tq.NewAcctRequest(
+						tq.SetAcctRequestFlag(f),
+						tq.SetAcctRequestMethod(tq.AuthenMethodTacacsPlus),
+						tq.SetAcctRequestPrivLvl(tq.PrivLvlRoot),
+						tq.SetAcctRequestType(tq.AuthenTypeASCII),
+						tq.SetAcctRequestService(tq.AuthenServiceLogin),
+						tq.SetAcctRequestUser("mr_uses_group"),
+						tq.SetAcctRequestArgs(tq.Args{"task_id=42", "service=shell", tq.Arg(fmt.Sprintf("elapsed_time=%d", i*60))}),
+					),
+				),
+			),
+			ValidateBody: func(response []byte) error {
+				var body tq.AcctReply
+				if err := tq.Unmarshal(response, &body); err != nil {
+					return err
+				}
+				if body.Status != tq.AcctReplyStatusSuccess {
+					spew.Dump(body)
+					return fmt.Errorf("failed to match AcctReplyStatusSuccess")
+				}
+				return nil
+			},
+		})
+	}
+	return []Test{{Name: "accounting task start, watchdogs and stop", Secret: []byte("fooman"), Seq: seq}}
+}
+
 func TestAccounting(t *testing.T) {
 	logger := log.New(30, os.Stderr)
 	ctx := context.Background()
@@ -90,6 +132,7 @@ func TestAccounting(t *testing.T) {
 	// append tests
 	tests := []Test{}
 	tests = append(tests, acctFlagStart(t)...)
+	tests = append(tests, acctTaskFlow(t)...)
 
 	for _, test := range tests {
 		c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), test.Secret))
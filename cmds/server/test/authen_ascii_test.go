@@ -0,0 +1,74 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestASCIILoginAttempts configures the localhost scope with a banner, custom prompts and three
+// attempts, and checks failed passwords prompt again until the attempts run out
+func TestASCIILoginAttempts(t *testing.T) {
+	b, err := os.ReadFile("testdata/test_config.yaml")
+	require.NoError(t, err)
+	handler := "    handler:\n      type: *handler_type_start\n"
+	configured := strings.Replace(string(b), handler, handler+`      options:
+        ascii_banner: authorized access only
+        ascii_user_prompt: "login: "
+        ascii_password_prompt: "Password: "
+        ascii_max_attempts: "3"
+`, 1)
+	require.NotEqual(t, string(b), configured)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(configured), 0644))
+
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, path)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	go func() {
+		assert.NoError(t, tq.NewServer(logger, sp).Serve(ctx, listener.(*net.TCPListener)))
+	}()
+
+	login := func(t *testing.T, passwords ...string) tq.AuthenReply {
+		e := newASCIIExchange(t, listener.Addr().String(), BuildASCIIStartPacket())
+		reply := e.send("")
+		require.Equal(t, tq.AuthenStatusGetUser, reply.Status)
+		assert.Equal(t, "authorized access only\nlogin: ", string(reply.ServerMsg))
+		for i, password := range passwords {
+			reply = e.send("mr_uses_group")
+			require.Equal(t, tq.AuthenStatusGetPass, reply.Status)
+			assert.Equal(t, "Password: ", string(reply.ServerMsg))
+			reply = e.send(password)
+			if i < len(passwords)-1 {
+				require.Equal(t, tq.AuthenStatusGetUser, reply.Status, "a failed attempt prompts again")
+				assert.True(t, strings.HasSuffix(string(reply.ServerMsg), "\nlogin: "), string(reply.ServerMsg))
+			}
+		}
+		return reply
+	}
+
+	assert.Equal(t, tq.AuthenStatusPass, login(t, "password").Status)
+	assert.Equal(t, tq.AuthenStatusPass, login(t, "wrong", "wrong", "password").Status)
+	assert.Equal(t, tq.AuthenStatusFail, login(t, "wrong", "wrong", "wrong").Status)
+}
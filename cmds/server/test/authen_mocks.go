@@ -11,6 +11,7 @@ import (
 	"fmt"
 
 	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
 
 	"github.com/davecgh/go-spew/spew"
 )
@@ -698,3 +699,203 @@ func GetASCIIEnableAbortTests() []Test {
 	}
 	return tests
 }
+
+// chapLoginPacket builds a chap authenstart of user with the provided data field
+func chapLoginPacket(user string, data []byte) *tq.Packet {
+	return tq.NewPacket(
+		tq.SetPacketHeader(
+			tq.NewHeader(
+				tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionOne}),
+				tq.SetHeaderType(tq.Authenticate),
+				tq.SetHeaderRandomSessionID(),
+			),
+		),
+		tq.SetPacketBodyUnsafe(
+			tq.NewAuthenStart(
+				tq.SetAuthenStartType(tq.AuthenTypeCHAP),
+				tq.SetAuthenStartAction(tq.AuthenActionLogin),
+				tq.SetAuthenStartPrivLvl(tq.PrivLvl(15)),
+				tq.SetAuthenStartPort("tty0"),
+				tq.SetAuthenStartRemAddr("rem port"),
+				tq.SetAuthenStartUser(tq.AuthenUser(user)),
+				tq.SetAuthenStartData(tq.AuthenData(data)),
+			),
+		),
+	)
+}
+
+// expectAuthenStatus validates an AuthenReply status
+func expectAuthenStatus(status tq.AuthenStatus) func(response []byte) error {
+	return func(response []byte) error {
+		var body tq.AuthenReply
+		if err := tq.Unmarshal(response, &body); err != nil {
+			return err
+		}
+		if body.Status != status {
+			spew.Dump(body)
+			return fmt.Errorf("failed to match %v", status)
+		}
+		return nil
+	}
+}
+
+// CHAPLoginFlows exercise chap routing.  The bcrypt authenticator cannot verify chap since it
+// has no plaintext password, the keychain authenticator can.
+func CHAPLoginFlows() []Test {
+	challenge := []byte("0123456789abcdef")
+	chap := func(password string) []byte {
+		data := append([]byte{1}, challenge...)
+		return append(data, authenticators.NewCHAPResponse(1, password, challenge)...)
+	}
+	return []Test{
+		{
+			Name:   "chap login with a hashed password authenticator",
+			Secret: []byte("fooman"),
+			Seq:    []Sequence{{Packet: chapLoginPacket("mr_uses_group", chap("cisco")), ValidateBody: expectAuthenStatus(tq.AuthenStatusError)}},
+		},
+		{
+			Name:   "chap login with malformed data",
+			Secret: []byte("fooman"),
+			Seq:    []Sequence{{Packet: chapLoginPacket("mr_uses_group", []byte("short")), ValidateBody: expectAuthenStatus(tq.AuthenStatusFail)}},
+		},
+		{
+			Name:   "chap login with a keychain authenticator",
+			Secret: []byte("fooman"),
+			Seq:    []Sequence{{Packet: chapLoginPacket("mr_chap", chap("cisco")), ValidateBody: expectAuthenStatus(tq.AuthenStatusPass)}},
+		},
+		{
+			Name:   "chap login with a keychain authenticator and a wrong password",
+			Secret: []byte("fooman"),
+			Seq:    []Sequence{{Packet: chapLoginPacket("mr_chap", chap("wrong")), ValidateBody: expectAuthenStatus(tq.AuthenStatusFail)}},
+		},
+	}
+}
+
+// enableStartPacket builds an enable authenstart for user, with the password in data for pap
+func enableStartPacket(user string, atype tq.AuthenType, data string) *tq.Packet {
+	minor := uint8(tq.MinorVersionDefault)
+	if atype != tq.AuthenTypeASCII {
+		minor = tq.MinorVersionOne
+	}
+	return tq.NewPacket(
+		tq.SetPacketHeader(
+			tq.NewHeader(
+				tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: minor}),
+				tq.SetHeaderType(tq.Authenticate),
+				tq.SetHeaderRandomSessionID(),
+			),
+		),
+		tq.SetPacketBodyUnsafe(
+			tq.NewAuthenStart(
+				tq.SetAuthenStartAction(tq.AuthenActionLogin),
+				tq.SetAuthenStartPrivLvl(tq.PrivLvlRoot),
+				tq.SetAuthenStartType(atype),
+				tq.SetAuthenStartService(tq.AuthenServiceEnable),
+				tq.SetAuthenStartPort("tty0"),
+				tq.SetAuthenStartRemAddr("foo"),
+				tq.SetAuthenStartUser(tq.AuthenUser(user)),
+				tq.SetAuthenStartData(tq.AuthenData(data)),
+			),
+		),
+	)
+}
+
+// enableContinuePacket answers the enable password prompt of start
+func enableContinuePacket(start *tq.Packet, password string) *tq.Packet {
+	return tq.NewPacket(
+		tq.SetPacketHeader(
+			tq.NewHeader(
+				tq.SetHeaderVersion(start.Header.Version),
+				tq.SetHeaderType(tq.Authenticate),
+				tq.SetHeaderSeqNo(3),
+				tq.SetHeaderSessionID(start.Header.SessionID),
+			),
+		),
+		tq.SetPacketBodyUnsafe(
+			tq.NewAuthenContinue(
+				tq.SetAuthenContinueUserMessage(tq.AuthenUserMessage(password)),
+			),
+		),
+	)
+}
+
+// EnableFlows exercise the enable handler.  mr_enable inherits a distinct enable secret, "enable",
+// from its group while mr_uses_group falls back to its login password.
+func EnableFlows() []Test {
+	ascii := func(name, user, password string, status tq.AuthenStatus) Test {
+		start := enableStartPacket(user, tq.AuthenTypeASCII, "")
+		return Test{
+			Name:   name,
+			Secret: []byte("fooman"),
+			Seq: []Sequence{
+				{Packet: start, ValidateBody: expectAuthenStatus(tq.AuthenStatusGetPass)},
+				{Packet: enableContinuePacket(start, password), ValidateBody: expectAuthenStatus(status)},
+			},
+		}
+	}
+	return []Test{
+		ascii("ascii enable with the enable secret", "mr_enable", "enable", tq.AuthenStatusPass),
+		ascii("ascii enable with the login password", "mr_enable", "password", tq.AuthenStatusFail),
+		ascii("ascii enable falls back to the login authenticator", "mr_uses_group", "password", tq.AuthenStatusPass),
+		ascii("ascii enable for an unknown user", "mr_nobody", "enable", tq.AuthenStatusFail),
+		{
+			Name:   "pap enable with the enable secret",
+			Secret: []byte("fooman"),
+			Seq:    []Sequence{{Packet: enableStartPacket("mr_enable", tq.AuthenTypePAP, "enable"), ValidateBody: expectAuthenStatus(tq.AuthenStatusPass)}},
+		},
+	}
+}
+
+// unimplementedActionFlow is a pap start of action, which the server answers by policy
+func unimplementedActionFlow(name string, action tq.AuthenAction, msg string) Test {
+	return Test{
+		Name:   name,
+		Secret: []byte("fooman"),
+		Seq: []Sequence{
+			{
+				Packet: tq.NewPacket(
+					tq.SetPacketHeader(
+						tq.NewHeader(
+							tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionOne}),
+							tq.SetHeaderType(tq.Authenticate),
+							tq.SetHeaderRandomSessionID(),
+						),
+					),
+					tq.SetPacketBodyUnsafe(
+						tq.NewAuthenStart(
+							tq.SetAuthenStartAction(action),
+							tq.SetAuthenStartPrivLvl(tq.PrivLvlUser),
+							tq.SetAuthenStartType(tq.AuthenTypePAP),
+							tq.SetAuthenStartService(tq.AuthenServiceLogin),
+							tq.SetAuthenStartUser("mr_uses_group"),
+							tq.SetAuthenStartPort("tty0"),
+							tq.SetAuthenStartRemAddr("foo"),
+							tq.SetAuthenStartData("password"),
+						),
+					),
+				),
+				ValidateBody: func(response []byte) error {
+					var body tq.AuthenReply
+					if err := tq.Unmarshal(response, &body); err != nil {
+						return err
+					}
+					if body.Status != tq.AuthenStatusFail || string(body.ServerMsg) != msg {
+						spew.Dump(body)
+						return fmt.Errorf("failed to match AuthenStatusFail with server msg [%v]", msg)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// SendAuthFlow is an outbound authentication request, failed by the default policy
+func SendAuthFlow() Test {
+	return unimplementedActionFlow("sendauth rejected", tq.AuthenActionSendAuth, "outbound authentication is not permitted")
+}
+
+// ChpassFlow is a password change request, failed by the default policy
+func ChpassFlow() Test {
+	return unimplementedActionFlow("chpass rejected", tq.AuthenActionPass, "password changes are not supported")
+}
@@ -42,10 +42,14 @@ func TestAuthenticate(t *testing.T) {
 		ASCIILoginFullFlow(),
 		ASCIILoginEnable(),
 		PapLoginFlow(),
+		SendAuthFlow(),
+		ChpassFlow(),
 	}
 
 	tests = append(tests, GetASCIIEnableAbortTests()...)
 	tests = append(tests, GetASCIILoginAbortTests()...)
+	tests = append(tests, CHAPLoginFlows()...)
+	tests = append(tests, EnableFlows()...)
 	for _, test := range tests {
 		c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), test.Secret))
 		assert.NoError(t, err)
@@ -0,0 +1,226 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// passwordStore is an authenticator backed by a map of passwords, which it can change
+type passwordStore struct {
+	sync.Mutex
+	passwords map[string]string
+	// expired users must change their password
+	expired map[string]bool
+}
+
+// New implements the loader's authenticatorFactory
+func (s *passwordStore) New(username string, options map[string]string) (tq.Handler, error) {
+	return &storeAuthenticator{passwordStore: s, username: username}, nil
+}
+
+// password returns the password of user
+func (s *passwordStore) password(user string) string {
+	s.Lock()
+	defer s.Unlock()
+	return s.passwords[user]
+}
+
+// storeAuthenticator authenticates one user of a passwordStore
+type storeAuthenticator struct {
+	*passwordStore
+	authenticators.Methods
+	username string
+}
+
+// Handle implements tq.Handler
+func (a *storeAuthenticator) Handle(response tq.Response, request tq.Request) {
+	password, err := a.GetPassword(request)
+	a.Lock()
+	defer a.Unlock()
+	if err != nil || a.passwords[a.username] != password {
+		response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusFail), tq.SetAuthenReplyServerMsg("login failure")))
+		return
+	}
+	response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusPass)))
+}
+
+// MustChangePassword implements config.PasswordWriter
+func (a *storeAuthenticator) MustChangePassword(ctx context.Context, username string) bool {
+	a.Lock()
+	defer a.Unlock()
+	return a.expired[username]
+}
+
+// ChangePassword implements config.PasswordWriter
+func (a *storeAuthenticator) ChangePassword(ctx context.Context, username, old, new string) error {
+	a.Lock()
+	defer a.Unlock()
+	if a.passwords[username] != old {
+		return fmt.Errorf("wrong password")
+	}
+	a.passwords[username] = new
+	delete(a.expired, username)
+	return nil
+}
+
+// asciiExchange sends the packets of one ascii authentication session
+type asciiExchange struct {
+	t     *testing.T
+	c     *tq.Client
+	start *tq.Packet
+	seqNo int
+}
+
+// newASCIIExchange starts a session with the server at addr, start is sent by the first send
+func newASCIIExchange(t *testing.T, addr string, start *tq.Packet) *asciiExchange {
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", addr, []byte("fooman")))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return &asciiExchange{t: t, c: c, start: start, seqNo: -1}
+}
+
+// send sends the start packet first, then continues carrying msg
+func (e *asciiExchange) send(msg string) tq.AuthenReply {
+	p := e.start
+	e.seqNo += 2
+	if e.seqNo > 1 {
+		p = tq.NewPacket(
+			tq.SetPacketHeader(
+				tq.NewHeader(
+					tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionDefault}),
+					tq.SetHeaderType(tq.Authenticate),
+					tq.SetHeaderSeqNo(e.seqNo),
+					tq.SetHeaderSessionID(e.start.Header.SessionID),
+				),
+			),
+			tq.SetPacketBodyUnsafe(tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage(tq.AuthenUserMessage(msg)))),
+		)
+	}
+	resp, err := e.c.Send(p)
+	require.NoError(e.t, err)
+	var reply tq.AuthenReply
+	require.NoError(e.t, tq.Unmarshal(resp.Body, &reply))
+	return reply
+}
+
+// chpassStartPacket is an ascii chpass request by user
+func chpassStartPacket(user string) *tq.Packet {
+	return tq.NewPacket(
+		tq.SetPacketHeader(
+			tq.NewHeader(
+				tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionDefault}),
+				tq.SetHeaderType(tq.Authenticate),
+				tq.SetHeaderRandomSessionID(),
+			),
+		),
+		tq.SetPacketBodyUnsafe(
+			tq.NewAuthenStart(
+				tq.SetAuthenStartAction(tq.AuthenActionPass),
+				tq.SetAuthenStartPrivLvl(tq.PrivLvlUser),
+				tq.SetAuthenStartType(tq.AuthenTypeASCII),
+				tq.SetAuthenStartService(tq.AuthenServiceLogin),
+				tq.SetAuthenStartPort("tty0"),
+				tq.SetAuthenStartRemAddr("foo"),
+				tq.SetAuthenStartUser(tq.AuthenUser(user)),
+			),
+		),
+	)
+}
+
+// TestChpass changes passwords with ascii chpass requests, and walks a user who must change their
+// password through it at login
+func TestChpass(t *testing.T) {
+	store := &passwordStore{
+		passwords: map[string]string{"mr_uses_group": "password", "mr_no_group": "password"},
+		expired:   map[string]bool{"mr_no_group": true},
+	}
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml", loader.RegisterAuthenticator(config.BCRYPT, store))
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	go func() {
+		assert.NoError(t, tq.NewServer(logger, sp).Serve(ctx, listener.(*net.TCPListener)))
+	}()
+	addr := listener.Addr().String()
+
+	chpass := func(user, old, new, confirm string) tq.AuthenReply {
+		e := newASCIIExchange(t, addr, chpassStartPacket(user))
+		reply := e.send("")
+		require.Equal(t, tq.AuthenStatusGetData, reply.Status)
+		assert.True(t, reply.Flags.Has(tq.AuthenReplyFlagNoEcho))
+		reply = e.send(old)
+		require.Equal(t, tq.AuthenStatusGetPass, reply.Status)
+		reply = e.send(new)
+		require.Equal(t, tq.AuthenStatusGetPass, reply.Status)
+		return e.send(confirm)
+	}
+	assert.Equal(t, tq.AuthenStatusFail, chpass("mr_uses_group", "password", "secret", "typo").Status)
+	assert.Equal(t, tq.AuthenStatusFail, chpass("mr_uses_group", "wrong", "secret", "secret").Status)
+	assert.Equal(t, "password", store.password("mr_uses_group"))
+	assert.Equal(t, tq.AuthenStatusPass, chpass("mr_uses_group", "password", "secret", "secret").Status)
+	assert.Equal(t, "secret", store.password("mr_uses_group"))
+
+	// an expired password is changed once the login passes
+	e := newASCIIExchange(t, addr, BuildASCIIStartPacket())
+	require.Equal(t, tq.AuthenStatusGetUser, e.send("").Status)
+	require.Equal(t, tq.AuthenStatusGetPass, e.send("mr_no_group").Status)
+	reply := e.send("password")
+	require.Equal(t, tq.AuthenStatusGetPass, reply.Status)
+	assert.True(t, strings.HasPrefix(string(reply.ServerMsg), "your password has expired"), string(reply.ServerMsg))
+	require.Equal(t, tq.AuthenStatusGetPass, e.send("fresh").Status)
+	assert.Equal(t, tq.AuthenStatusPass, e.send("fresh").Status)
+	assert.Equal(t, "fresh", store.password("mr_no_group"))
+
+	// and no longer needs changing
+	e = newASCIIExchange(t, addr, BuildASCIIStartPacket())
+	require.Equal(t, tq.AuthenStatusGetUser, e.send("").Status)
+	require.Equal(t, tq.AuthenStatusGetPass, e.send("mr_no_group").Status)
+	assert.Equal(t, tq.AuthenStatusPass, e.send("fresh").Status)
+}
+
+// TestChpassUnsupported answers ascii chpass requests by users whose authenticator cannot change
+// passwords with the chpass policy
+func TestChpassUnsupported(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	go func() {
+		assert.NoError(t, tq.NewServer(logger, sp).Serve(ctx, listener.(*net.TCPListener)))
+	}()
+
+	e := newASCIIExchange(t, listener.Addr().String(), chpassStartPacket("mr_uses_group"))
+	for _, msg := range []string{"", "password", "secret"} {
+		e.send(msg)
+	}
+	reply := e.send("secret")
+	assert.Equal(t, tq.AuthenStatusFail, reply.Status)
+	assert.Equal(t, "password changes are not supported", string(reply.ServerMsg))
+}
@@ -0,0 +1,53 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientAAA(t *testing.T) {
+	address, stop := poolServer(t, "[::1]:0", tq.SetSingleConnect(true))
+	defer stop()
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", address, []byte("fooman")), tq.SetClientSingleConnect())
+	require.NoError(t, err)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pap, err := c.AuthenticatePAP(ctx, "mr_uses_group", "password")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusPass, pap.Status)
+	pap, err = c.AuthenticatePAP(ctx, "mr_uses_group", "wrong")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusFail, pap.Status)
+
+	ascii, err := c.AuthenticateASCII(ctx, "mr_uses_group", "password", tq.SetAuthenStartPort("tty0"))
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusPass, ascii.Status)
+	ascii, err = c.AuthenticateASCII(ctx, "mr_uses_group", "wrong")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusFail, ascii.Status)
+
+	author, err := c.Authorize(ctx, "mr_uses_group", tq.Args{"service=shell", "cmd=configure", "cmd-arg=terminal", "cmd-arg=<cr>"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusPassAdd, author.Status)
+
+	var flags tq.AcctRequestFlag
+	flags.Set(tq.AcctFlagStart)
+	acct, err := c.Account(ctx, "mr_uses_group", flags, tq.Args{"cmd=show", "cmd-arg=system"}, tq.SetAcctRequestPrivLvl(tq.PrivLvlRoot))
+	require.NoError(t, err)
+	assert.Equal(t, tq.AcctReplyStatusSuccess, acct.Status)
+}
@@ -0,0 +1,71 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// silentServer accepts connections and never replies
+func silentServer(t *testing.T) string {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestSendContext(t *testing.T) {
+	address := silentServer(t)
+	tests := []struct {
+		name string
+		opts []tq.ClientOption
+	}{
+		{name: "connection"},
+		{name: "single-connect", opts: []tq.ClientOption{tq.SetClientSingleConnect()}},
+	}
+	for _, test := range tests {
+		c, err := tq.NewClient(append([]tq.ClientOption{tq.SetClientDialer("tcp6", address, []byte("fooman"))}, test.opts...)...)
+		require.NoError(t, err, test.name)
+		defer c.Close()
+		packet := PapLoginFlow().Seq[0].Packet
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		_, err = c.SendContext(ctx, packet)
+		cancel()
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v: %v", test.name, err)
+		assert.Less(t, time.Since(start), 3*time.Second, test.name)
+
+		// the session is no longer waited on, so it may be sent again
+		ctx, cancel = context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		_, err = c.SendContext(ctx, packet)
+		assert.True(t, errors.Is(err, context.Canceled), "%v: %v", test.name, err)
+
+		_, err = c.SendContext(ctx, packet)
+		assert.Equal(t, context.Canceled, err, "%v: a done context is not sent", test.name)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// refusedAddress returns an address nothing listens on
+func refusedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	listener.Close()
+	return listener.Addr().String()
+}
+
+func TestClientFailover(t *testing.T) {
+	live, stop := poolServer(t, "[::1]:0")
+	defer stop()
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		servers []tq.ClientServer
+	}{
+		{name: "refused", servers: []tq.ClientServer{{Address: refusedAddress(t), Secret: []byte("fooman")}, {Address: live, Secret: []byte("fooman")}}},
+		{name: "timeout", servers: []tq.ClientServer{{Address: silentServer(t), Secret: []byte("fooman")}, {Address: live, Secret: []byte("fooman")}}},
+		{name: "bad secret", servers: []tq.ClientServer{{Address: live, Secret: []byte("wrong")}, {Address: live, Secret: []byte("fooman")}}},
+	}
+	for _, test := range tests {
+		failovers := counter(t, "tacquito_client_failover", nil)
+		c, err := tq.NewClient(tq.SetClientServers("tcp6", test.servers...), tq.SetClientServerTimeout(200*time.Millisecond))
+		require.NoError(t, err, test.name)
+		reply, err := c.AuthenticatePAP(ctx, "mr_uses_group", "password")
+		if assert.NoError(t, err, test.name) {
+			assert.Equal(t, tq.AuthenStatusPass, reply.Status, test.name)
+		}
+		assert.Equal(t, live, c.Server(), test.name)
+		if test.name != "refused" {
+			// a refused server is already skipped when the client is created
+			assert.Equal(t, float64(1), counter(t, "tacquito_client_failover", nil)-failovers, test.name)
+		}
+		c.Close()
+	}
+
+	// a policy without bad secrets returns the failure instead
+	c, err := tq.NewClient(tq.SetClientServers("tcp6", tests[2].servers...), tq.SetClientFailoverPolicy(tq.FailoverTimeout|tq.FailoverRefused))
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.AuthenticatePAP(ctx, "mr_uses_group", "password")
+	assert.Error(t, err)
+}
+
+func TestClientFailoverRestore(t *testing.T) {
+	primary := refusedAddress(t)
+	backup, stopBackup := poolServer(t, "[::1]:0")
+	defer stopBackup()
+	c, err := tq.NewClient(
+		tq.SetClientServers("tcp6", tq.ClientServer{Address: primary, Secret: []byte("fooman")}, tq.ClientServer{Address: backup, Secret: []byte("fooman")}),
+		tq.SetClientDeadTime(200*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+	_, err = c.AuthenticatePAP(ctx, "mr_uses_group", "password")
+	require.NoError(t, err)
+	assert.Equal(t, backup, c.Server())
+
+	// the primary comes back, and is used again once its dead time passes
+	_, stopPrimary := poolServer(t, primary)
+	defer stopPrimary()
+	_, err = c.AuthenticatePAP(ctx, "mr_uses_group", "password")
+	require.NoError(t, err)
+	assert.Equal(t, backup, c.Server(), "the primary is still marked down")
+	time.Sleep(250 * time.Millisecond)
+	restored := counter(t, "tacquito_client_failover_restored", nil)
+	reply, err := c.AuthenticatePAP(ctx, "mr_uses_group", "password")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusPass, reply.Status)
+	assert.Equal(t, primary, c.Server())
+	assert.Equal(t, float64(1), counter(t, "tacquito_client_failover_restored", nil)-restored)
+
+	// an ascii login stays on the server it started on
+	reply, err = c.AuthenticateASCII(ctx, "mr_uses_group", "password")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusPass, reply.Status)
+}
@@ -0,0 +1,130 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// poolServer serves the test config on address until the returned stop is called, which closes
+// the pool's idle connections right away
+func poolServer(t *testing.T, address string, opts ...tq.Option) (string, func()) {
+	opts = append(opts, tq.SetDrainTimeout(time.Second))
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp6", address)
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, tq.NewServer(logger, sp, opts...).Serve(ctx, listener.(*net.TCPListener)))
+	}()
+	return listener.Addr().String(), func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestClientPool(t *testing.T) {
+	address, stop := poolServer(t, "[::1]:0", tq.SetSingleConnect(true))
+	defer stop()
+	pool, err := tq.NewClientPool("tcp6", []string{address}, []byte("fooman"), tq.SetClientPoolSize(2))
+	require.NoError(t, err)
+	defer pool.Close()
+	ctx := context.Background()
+	dialed := counter(t, "tacquito_client_pool_dialed", nil)
+
+	// an ascii login keeps every packet of its session on one connection, while pap logins
+	// share the pool with it
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := PapLoginFlow().Seq[0].Packet
+			p.Header.SessionID = tq.SessionID(1000 + i)
+			resp, err := pool.Send(ctx, p)
+			if assert.NoError(t, err) {
+				assert.NoError(t, PapLoginFlow().Seq[0].ValidateBody(resp.Body))
+			}
+		}(i)
+	}
+	ascii := ASCIILoginFullFlow()
+	for _, s := range ascii.Seq {
+		resp, err := pool.Send(ctx, s.Packet)
+		require.NoError(t, err)
+		assert.NoError(t, s.ValidateBody(resp.Body))
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, counter(t, "tacquito_client_pool_dialed", nil)-dialed, float64(2), "sessions are multiplexed on the pool's connections")
+}
+
+func TestClientPoolReconnect(t *testing.T) {
+	// nothing listens on the first address, so sessions fail over to the second
+	down, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	down.Close()
+	address, stop := poolServer(t, "[::1]:0")
+	pool, err := tq.NewClientPool("tcp6", []string{down.Addr().String(), address}, []byte("fooman"), tq.SetClientPoolSize(1))
+	require.NoError(t, err)
+	defer pool.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	send := func(id tq.SessionID) error {
+		p := PapLoginFlow().Seq[0].Packet
+		p.Header.SessionID = id
+		resp, err := pool.Send(ctx, p)
+		if err != nil {
+			return err
+		}
+		return PapLoginFlow().Seq[0].ValidateBody(resp.Body)
+	}
+	for id := tq.SessionID(1); id <= 4; id++ {
+		assert.NoError(t, send(id))
+	}
+
+	// the server restarts on the same address, dropping every connection.  a packet sent as the
+	// server closes its connection fails, so let the pool see the close first
+	stop()
+	_, stop = poolServer(t, address, tq.SetSingleConnect(true))
+	defer stop()
+	time.Sleep(100 * time.Millisecond)
+	for id := tq.SessionID(1); id <= 4; id++ {
+		assert.NoError(t, send(id))
+	}
+}
+
+func TestClientPoolUnavailable(t *testing.T) {
+	down, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	down.Close()
+	pool, err := tq.NewClientPool("tcp6", []string{down.Addr().String()}, []byte("fooman"))
+	require.NoError(t, err)
+	defer pool.Close()
+	_, err = pool.Send(context.Background(), PapLoginFlow().Seq[0].Packet)
+	assert.Error(t, err, "every connection failed to dial")
+
+	_, err = tq.NewClientPool("tcp6", nil, []byte("fooman"))
+	assert.Error(t, err)
+	_, err = tq.NewClientPool("tcp6", []string{down.Addr().String()}, []byte("fooman"), tq.SetClientPoolSize(0))
+	assert.Error(t, err)
+}
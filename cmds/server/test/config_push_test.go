@@ -0,0 +1,96 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// TestConfigPush pushes configs to a running loader and checks only valid, non dry run pushes
+// change what clients are served with
+func TestConfigPush(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+	l, ok := sp.(*loader.Loader)
+	require.True(t, ok)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	s := tq.NewServer(logger, sp)
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+
+	login := func(secret string) error {
+		c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte(secret)))
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		test := PapLoginFlow()
+		resp, err := c.Send(test.Seq[0].Packet)
+		if err != nil {
+			return err
+		}
+		return test.Seq[0].ValidateBody(resp.Body)
+	}
+	load := func(replace string) config.ServerConfig {
+		b, err := os.ReadFile("testdata/test_config.yaml")
+		require.NoError(t, err)
+		var c config.ServerConfig
+		require.NoError(t, yamlv3.Unmarshal([]byte(strings.Replace(string(b), "      key: fooman\n", replace, 1)), &c))
+		return c
+	}
+	require.NoError(t, login("fooman"))
+
+	// invalid configs are rejected with diagnostics
+	result, err := l.Push(ctx, config.ServerConfig{}, false)
+	require.NoError(t, err)
+	assert.False(t, result.Applied)
+	assert.Len(t, result.Diagnostics, 2)
+	bad := load("      key: fooman\n")
+	bad.PrefixDeny = []string{"not a prefix"}
+	result, err = l.Push(ctx, bad, false)
+	require.NoError(t, err)
+	assert.False(t, result.Applied)
+	require.Len(t, result.Diagnostics, 1)
+	assert.Equal(t, loader.SeverityError, result.Diagnostics[0].Severity)
+	assert.Contains(t, result.Diagnostics[0].Message, "not a prefix")
+	assert.NoError(t, login("fooman"))
+
+	// dry runs validate without applying
+	rotated := load("      key: rotated\n")
+	result, err = l.Push(ctx, rotated, true)
+	require.NoError(t, err)
+	assert.False(t, result.Applied)
+	assert.Empty(t, result.Diagnostics)
+	assert.NoError(t, login("fooman"))
+	assert.Error(t, login("rotated"))
+
+	result, err = l.Push(ctx, rotated, false)
+	require.NoError(t, err)
+	assert.True(t, result.Applied)
+	assert.NoError(t, login("rotated"))
+	assert.Error(t, login("fooman"))
+}
@@ -0,0 +1,128 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDrain lets a session in progress complete once the server is stopped, while idle
+// connections are closed
+func TestDrain(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	serveCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, tq.NewServer(logger, sp, tq.SetDrainTimeout(5*time.Second)).Serve(serveCtx, listener.(*net.TCPListener)))
+	}()
+
+	// an ascii login waits for its username
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+	ascii := ASCIILoginFullFlow()
+	resp, err := c.Send(ascii.Seq[0].Packet)
+	require.NoError(t, err)
+	require.NoError(t, ascii.Seq[0].ValidateBody(resp.Body))
+
+	// while another connection has nothing in progress
+	idle, err := net.Dial("tcp6", listener.Addr().String())
+	require.NoError(t, err)
+	defer idle.Close()
+	// give the server a moment to accept it before draining
+	time.Sleep(100 * time.Millisecond)
+
+	stop()
+	idle.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, err = idle.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err, "idle connections are closed as soon as the drain starts")
+
+	// the login in progress still completes
+	for _, s := range ascii.Seq[1:] {
+		resp, err := c.Send(s.Packet)
+		require.NoError(t, err)
+		assert.NoError(t, s.ValidateBody(resp.Body))
+	}
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the server did not stop once its sessions completed")
+	}
+}
+
+// slowProvider serves every client with a handler that does not reply until release is closed
+type slowProvider struct {
+	release chan struct{}
+}
+
+// Get ...
+func (p slowProvider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler, error) {
+	return []byte("fooman"), tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		<-p.release
+		// too late, the server already replied
+		response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusPass)))
+	}), nil
+}
+
+// TestDrainTimeout answers a handler still running at the drain deadline with an error
+func TestDrainTimeout(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	sp := slowProvider{release: make(chan struct{})}
+	defer close(sp.release)
+	go func() {
+		assert.NoError(t, tq.NewServer(logger, sp, tq.SetDrainTimeout(200*time.Millisecond)).Serve(ctx, listener.(*net.TCPListener)))
+	}()
+
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+	replies := make(chan *tq.Packet, 1)
+	go func() {
+		resp, err := c.Send(PapLoginFlow().Seq[0].Packet)
+		assert.NoError(t, err)
+		replies <- resp
+	}()
+	// let the handler start before draining
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	var resp *tq.Packet
+	select {
+	case resp = <-replies:
+	case <-time.After(3 * time.Second):
+		t.Fatal("no reply at the drain deadline")
+	}
+	require.NotNil(t, resp)
+	var body tq.AuthenReply
+	require.NoError(t, tq.Unmarshal(resp.Body, &body))
+	assert.Equal(t, tq.AuthenStatusError, body.Status)
+	assert.Equal(t, tq.SequenceNumber(2), resp.Header.SeqNo)
+}
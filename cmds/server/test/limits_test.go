@@ -0,0 +1,75 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSourceLimits bounds the connections of a single source and the sessions of a single
+// connection
+func TestSourceLimits(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	s := tq.NewServer(logger, sp, tq.SetSingleConnect(true), tq.SetReadTimeout(time.Second), tq.SetMaxSourceConnections(1), tq.SetMaxSessions(1))
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+	dial := func() *tq.Client {
+		c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+		require.NoError(t, err)
+		return c
+	}
+	singleConnect := func(p *tq.Packet) *tq.Packet {
+		p.Header.Flags.Set(tq.SingleConnect)
+		return p
+	}
+
+	// an ascii login waiting for its username holds the only session on the connection
+	c := dial()
+	defer c.Close()
+	ascii := ASCIILoginFullFlow()
+	resp, err := c.Send(singleConnect(ascii.Seq[0].Packet))
+	require.NoError(t, err)
+	assert.NoError(t, ascii.Seq[0].ValidateBody(resp.Body))
+
+	// so does the only connection of the source
+	other := dial()
+	defer other.Close()
+	_, err = other.Send(singleConnect(PapLoginFlow().Seq[0].Packet))
+	assert.Error(t, err, "the source is at its connection bound")
+
+	// a second session is dropped, and the connection idles out
+	_, err = c.Send(singleConnect(PapLoginFlow().Seq[0].Packet))
+	assert.Error(t, err, "the connection is at its session bound")
+
+	// which frees the source to connect again
+	assert.Eventually(t, func() bool {
+		c := dial()
+		defer c.Close()
+		test := PapLoginFlow()
+		resp, err := c.Send(singleConnect(test.Seq[0].Packet))
+		return err == nil && test.Seq[0].ValidateBody(resp.Body) == nil
+	}, 5*time.Second, 100*time.Millisecond)
+}
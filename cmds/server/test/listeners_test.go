@@ -0,0 +1,63 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPacketTypeListeners serves authentication and accounting on separate listeners
+func TestPacketTypeListeners(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	assert.NoError(t, err)
+
+	serve := func(types ...tq.HeaderType) string {
+		listener, err := net.Listen("tcp6", "[::1]:0")
+		assert.NoError(t, err)
+		s := tq.NewServer(logger, sp, tq.SetPacketTypes(types...), tq.SetMaxConnections(4), tq.SetConnectionRateLimit(100, 100))
+		go func() {
+			assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+		}()
+		return listener.Addr().String()
+	}
+	authen := serve(tq.Authenticate)
+	acct := serve(tq.Accounting)
+
+	send := func(address string, test Test) error {
+		c, err := tq.NewClient(tq.SetClientDialer("tcp6", address, test.Secret))
+		if !assert.NoError(t, err) {
+			return err
+		}
+		defer c.Close()
+		resp, err := c.Send(test.Seq[0].Packet)
+		if err != nil {
+			return err
+		}
+		return test.Seq[0].ValidateBody(resp.Body)
+	}
+
+	login := PapLoginFlow()
+	start := acctFlagStart(t)[0]
+	assert.NoError(t, send(authen, login))
+	assert.NoError(t, send(acct, start))
+
+	// packet types the listener does not serve close the connection without a reply
+	assert.Error(t, send(acct, login))
+	assert.Error(t, send(authen, start))
+}
@@ -0,0 +1,115 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/handlers"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+	"github.com/facebookincubator/tacquito/cmds/server/lockout"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLockout locks out users and rem-addrs after repeated failed authentications
+func TestLockout(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lo := lockout.New(logger, lockout.SetThreshold(lockout.User, 2), lockout.SetThreshold(lockout.Address, 3), lockout.SetDelay(time.Hour, time.Hour))
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml", loader.RegisterHandlerType(config.START, handlers.NewStart(logger, handlers.SetStartLockout(lo))))
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	go func() {
+		assert.NoError(t, tq.NewServer(logger, sp).Serve(ctx, listener.(*net.TCPListener)))
+	}()
+	send := func(p *tq.Packet) tq.AuthenReply {
+		c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+		require.NoError(t, err)
+		defer c.Close()
+		resp, err := c.Send(p)
+		require.NoError(t, err)
+		var reply tq.AuthenReply
+		require.NoError(t, tq.Unmarshal(resp.Body, &reply))
+		return reply
+	}
+	pap := func(user, password, remAddr string) tq.AuthenReply {
+		p := PapLoginFlow().Seq[0].Packet
+		p.Body, err = tq.NewAuthenStart(
+			tq.SetAuthenStartType(tq.AuthenTypePAP),
+			tq.SetAuthenStartAction(tq.AuthenActionLogin),
+			tq.SetAuthenStartPrivLvl(tq.PrivLvl(15)),
+			tq.SetAuthenStartPort("tty0"),
+			tq.SetAuthenStartRemAddr(tq.AuthenRemAddr(remAddr)),
+			tq.SetAuthenStartUser(tq.AuthenUser(user)),
+			tq.SetAuthenStartData(tq.AuthenData(password)),
+		).MarshalBinary()
+		require.NoError(t, err)
+		return send(p)
+	}
+
+	// a success clears earlier failures of the user
+	assert.Equal(t, tq.AuthenStatusFail, pap("mr_uses_group", "wrong", "192.0.2.1").Status)
+	assert.Equal(t, tq.AuthenStatusPass, pap("mr_uses_group", "password", "192.0.2.1").Status)
+	assert.Equal(t, tq.AuthenStatusFail, pap("mr_uses_group", "wrong", "192.0.2.2").Status)
+	assert.Equal(t, tq.AuthenStatusFail, pap("mr_uses_group", "wrong", "192.0.2.3").Status)
+
+	// the user is now locked out, from any address, even with the right password
+	reply := pap("mr_uses_group", "password", "192.0.2.4")
+	assert.Equal(t, tq.AuthenStatusFail, reply.Status)
+	assert.Contains(t, string(reply.ServerMsg), "too many failed authentications")
+	assert.Equal(t, tq.AuthenStatusPass, pap("mr_no_group", "password", "192.0.2.4").Status)
+
+	// until an operator unlocks it
+	assert.True(t, lo.Unlock(lockout.User, "mr_uses_group"))
+	assert.Equal(t, tq.AuthenStatusPass, pap("mr_uses_group", "password", "192.0.2.4").Status)
+
+	// ascii logins are counted against the username given in the continue, and unknown users
+	// count against their rem-addr.  the third failure from foo locks out the address.
+	ascii := ASCIILoginFullFlow()
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+	for i, seq := range ascii.Seq[:2] {
+		resp, err := c.Send(seq.Packet)
+		require.NoError(t, err)
+		require.NoError(t, seq.ValidateBody(resp.Body), i)
+	}
+	wrong := ascii.Seq[2].Packet
+	wrong.Body, err = tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage("wrong")).MarshalBinary()
+	require.NoError(t, err)
+	resp, err := c.Send(wrong)
+	require.NoError(t, err)
+	require.NoError(t, tq.Unmarshal(resp.Body, &reply))
+	assert.Equal(t, tq.AuthenStatusFail, reply.Status)
+	assert.Equal(t, tq.AuthenStatusFail, pap("nobody", "wrong", "foo").Status)
+	assert.Equal(t, tq.AuthenStatusFail, pap("nobody_else", "wrong", "foo").Status)
+
+	entries := lo.Entries()
+	require.Len(t, entries, 7)
+	assert.Equal(t, lockout.Address, entries[0].Kind)
+	assert.Equal(t, "foo", entries[0].Name)
+	assert.Equal(t, 3, entries[0].Failures)
+	assert.NotNil(t, entries[0].Until)
+	for _, e := range entries[1:] {
+		assert.Nil(t, e.Until, e.Name)
+	}
+	assert.Equal(t, tq.AuthenStatusFail, pap("mr_no_group", "password", "foo").Status)
+	assert.Equal(t, tq.AuthenStatusPass, pap("mr_no_group", "password", "192.0.2.5").Status)
+}
@@ -0,0 +1,68 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMaxBodyLength limits the localhost scope to small packets, and checks a pathological
+// cmd-arg list is rejected with an error reply while the connection keeps serving
+func TestMaxBodyLength(t *testing.T) {
+	b, err := os.ReadFile("testdata/test_config.yaml")
+	require.NoError(t, err)
+	limited := strings.Replace(string(b), "      key: fooman\n", "      key: fooman\n    max_body_length: 512\n", 1)
+	require.NotEqual(t, string(b), limited)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(limited), 0644))
+
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, path)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	s := tq.NewServer(logger, sp)
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+
+	args := tq.Args{"service=shell", "cmd=show"}
+	for i := 0; i < 64; i++ {
+		args = append(args, tq.Arg(fmt.Sprintf("cmd-arg=interface%v", i)))
+	}
+	resp, err := c.Send(basicAuthorPacket("mr_uses_group", args))
+	require.NoError(t, err)
+	var reply tq.AuthorReply
+	require.NoError(t, tq.Unmarshal(resp.Body, &reply))
+	assert.Equal(t, tq.AuthorStatusError, reply.Status)
+	assert.Equal(t, tq.AuthorServerMsg("packet body exceeds the maximum length"), reply.ServerMsg)
+
+	// the oversize body was discarded, so the next packet on the connection is served
+	resp, err = c.Send(basicAuthorPacket("mr_uses_group", tq.Args{"service=shell", "cmd=configure\n", "cmd-arg=terminal\n", "cmd-arg=<cr>"}))
+	require.NoError(t, err)
+	require.NoError(t, tq.Unmarshal(resp.Body, &reply))
+	assert.Equal(t, tq.AuthorStatusPassAdd, reply.Status)
+}
@@ -0,0 +1,76 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMiddleware logs in over ascii through a chain of two middleware, which must see every packet
+// of the login in order, and share a counter through the session's metadata
+func TestMiddleware(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	const packets tq.ContextKey = "test-packets"
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) tq.Middleware {
+		return func(next tq.Handler) tq.Handler {
+			return tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+				mu.Lock()
+				calls = append(calls, name)
+				mu.Unlock()
+				next.Handle(response, request)
+			})
+		}
+	}
+	count := func(next tq.Handler) tq.Handler {
+		return tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+			m := request.Metadata()
+			n, _ := m.Get(packets)
+			seen, _ := n.(int)
+			m.Set(packets, seen+1)
+			mu.Lock()
+			calls = append(calls, "count")
+			assert.Equal(t, int(request.Header.SeqNo)/2, seen, "packets seen before this one")
+			mu.Unlock()
+			next.Handle(response, request)
+		})
+	}
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	s := tq.NewServer(logger, sp, tq.SetMiddleware(record("outer")), tq.SetMiddleware(count))
+	assert.Equal(t, 2, s.Options().Middleware)
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+
+	e := newASCIIExchange(t, listener.Addr().String(), BuildASCIIStartPacket())
+	require.Equal(t, tq.AuthenStatusGetUser, e.send("").Status)
+	require.Equal(t, tq.AuthenStatusGetPass, e.send("mr_uses_group").Status)
+	require.Equal(t, tq.AuthenStatusPass, e.send("password").Status)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"outer", "count", "outer", "count", "outer", "count"}, calls)
+}
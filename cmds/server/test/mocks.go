@@ -16,8 +16,10 @@ import (
 
 	"github.com/facebookincubator/tacquito/cmds/server/config/accounters/local"
 	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/bcrypt"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/keychain"
 	"github.com/facebookincubator/tacquito/cmds/server/config/authorizers/stringy"
 	"github.com/facebookincubator/tacquito/cmds/server/config/secret"
+	"github.com/facebookincubator/tacquito/cmds/server/config/secret/cert"
 	"github.com/facebookincubator/tacquito/cmds/server/config/secret/prefix"
 	"github.com/facebookincubator/tacquito/cmds/server/handlers"
 	"github.com/facebookincubator/tacquito/cmds/server/loader"
@@ -49,25 +51,26 @@ type Sequence struct {
 	Validate       func(p *tq.Packet) error
 }
 
-// MockSecretProvider creates a mock secret provider
-func MockSecretProvider(ctx context.Context, logger loggerProvider, configPath string) (tq.SecretProvider, error) {
+// MockSecretProvider creates a mock secret provider.  opts are applied after the defaults, so
+// they may replace a registered type.
+func MockSecretProvider(ctx context.Context, logger loggerProvider, configPath string, opts ...loader.Option) (tq.SecretProvider, error) {
 	accountingLogger, err := local.New(logger, local.SetLogSinkDefault("/tmp/tacquito_accounting.log", "tacquito"))
 	if err != nil {
 		return nil, fmt.Errorf("error building accounting logger; %v", err)
 	}
-	sp, err := loader.NewLocalConfig(
-		ctx,
-		configPath,
-		yaml.New(),
+	defaults := []loader.Option{
 		loader.SetLoggerProvider(logger),
 		loader.SetKeychainProvider(secret.New()),
 		loader.SetConfigProvider(config.New()),
 		loader.SetAuthorizerProvider(stringy.New(logger)),
 		loader.RegisterSecretProviderType(config.PREFIX, prefix.New(logger)),
+		loader.RegisterSecretProviderType(config.CERT, cert.New(logger)),
 		loader.RegisterAuthenticator(config.BCRYPT, bcrypt.New(logger, &shh{})),
+		loader.RegisterAuthenticator(config.KEYCHAIN, keychain.New(logger, &shh{})),
 		loader.RegisterAccounter(config.FILE, accountingLogger),
 		loader.RegisterHandlerType(config.START, handlers.NewStart(logger)),
-	)
+	}
+	sp, err := loader.NewLocalConfig(ctx, configPath, yaml.New(), append(defaults, opts...)...)
 	if err != nil {
 		return nil, err
 	}
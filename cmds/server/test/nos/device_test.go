@@ -0,0 +1,151 @@
+//go:build nos
+
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package nos
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// device is an interactive cli session on a device under test
+type device struct {
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.Writer
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+	// eof is closed when the device closes stdout
+	eof chan struct{}
+}
+
+// dial logs in over ssh and opens a shell.  the password is offered both as a plain password and
+// through keyboard-interactive, since vendors differ in which one they hand to tacacs
+func dial(address string, l login, timeout time.Duration) (*device, error) {
+	cfg := &ssh.ClientConfig{
+		User: l.Username,
+		Auth: []ssh.AuthMethod{
+			ssh.Password(l.Password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = l.Password
+				}
+				return answers, nil
+			}),
+		},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         timeout,
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(address, "22"), cfg)
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err := session.RequestPty("vt100", 0, 512, ssh.TerminalModes{ssh.ECHO: 0}); err != nil {
+		client.Close()
+		return nil, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err := session.Shell(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	d := &device{client: client, session: session, stdin: stdin, eof: make(chan struct{})}
+	go d.read(stdout)
+	return d, nil
+}
+
+// waitForDevice retries dial until the device accepts a login or the timeout expires.  booting
+// devices refuse connections, and reject logins until their aaa config is applied
+func waitForDevice(address string, l login, timeout time.Duration) (*device, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		d, err := dial(address, l, 10*time.Second)
+		if err == nil {
+			return d, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("device [%v] not ready after %v; %v", address, timeout, err)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+func (d *device) read(r io.Reader) {
+	defer close(d.eof)
+	b := make([]byte, 4096)
+	for {
+		n, err := r.Read(b)
+		d.mu.Lock()
+		d.buf.Write(b[:n])
+		d.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// expect waits for re to match the output received since the last expect, and returns that output
+func (d *device) expect(re *regexp.Regexp, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		d.mu.Lock()
+		if loc := re.FindIndex(d.buf.Bytes()); loc != nil {
+			out := string(d.buf.Next(loc[1]))
+			d.mu.Unlock()
+			return out, nil
+		}
+		pending := d.buf.String()
+		d.mu.Unlock()
+		select {
+		case <-d.eof:
+			return pending, fmt.Errorf("device closed the session waiting for [%v]", re)
+		default:
+		}
+		if time.Now().After(deadline) {
+			return pending, fmt.Errorf("timed out waiting for [%v]", re)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// send writes a line to the cli and waits for re
+func (d *device) send(line string, re *regexp.Regexp, timeout time.Duration) (string, error) {
+	if _, err := fmt.Fprintf(d.stdin, "%s\n", line); err != nil {
+		return "", err
+	}
+	return d.expect(re, timeout)
+}
+
+func (d *device) Close() error {
+	d.session.Close()
+	return d.client.Close()
+}
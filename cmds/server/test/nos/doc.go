@@ -0,0 +1,24 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package nos is an integration test suite that drives network operating system images through
+// login, enable, command authorization and accounting against a live tacquito server.  Devices are
+// deployed with containerlab, using cEOS or vrnetlab images, and every vendor is described by a
+// fixture in testdata/fixtures.
+//
+// The suite is guarded by the nos build tag and requires containerlab, docker, root privileges and
+// locally available device images:
+//
+//	sudo -E go test -tags nos -v -timeout 60m ./cmds/server/test/nos/
+//
+// Environment variables tune the run:
+//
+//	NOS_FIXTURES     comma separated fixture names to run, all fixtures by default
+//	NOS_LISTEN       address tacquito listens on, default :49
+//	NOS_TACACS_HOST  address devices use to reach tacquito, default 172.20.20.1, the containerlab mgmt gateway
+//	NOS_KEEP_LAB     if set, labs are not destroyed after the test for debugging
+package nos
@@ -0,0 +1,186 @@
+//go:build nos
+
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package nos
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// permit and deny are the expected outcomes of a fixture command
+const (
+	permit = "permit"
+	deny   = "deny"
+)
+
+// fixture describes how to boot a vendor image and what a tacquito backed session on it looks like
+type fixture struct {
+	Name string `yaml:"name"`
+	// Kind is the containerlab node kind, eg ceos, cisco_xrv9k, juniper_vmx
+	Kind  string `yaml:"kind"`
+	Image string `yaml:"image"`
+	// StartupConfig is a text/template, relative to the fixtures dir, rendered with a startupData
+	StartupConfig string `yaml:"startup_config"`
+	// BootTimeout is a go duration, vrnetlab vm based images can take many minutes to boot
+	BootTimeout string `yaml:"boot_timeout"`
+	// Prompt matches the cli prompt after login and after every command
+	Prompt   string    `yaml:"prompt"`
+	Login    login     `yaml:"login"`
+	Enable   *enable   `yaml:"enable,omitempty"`
+	Setup    []string  `yaml:"setup,omitempty"`
+	Commands []command `yaml:"commands"`
+	// Accounting lists substrings that must appear in accounting records once the session ends
+	Accounting []string `yaml:"accounting,omitempty"`
+}
+
+type login struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// enable is the privilege escalation step, absent for vendors that assign privilege at login
+type enable struct {
+	Command  string `yaml:"command"`
+	Password string `yaml:"password,omitempty"`
+	// PasswordPrompt is matched before the enable password is sent
+	PasswordPrompt string `yaml:"password_prompt,omitempty"`
+	// Prompt is the cli prompt once enabled
+	Prompt string `yaml:"prompt"`
+}
+
+type command struct {
+	Command string `yaml:"command"`
+	// Expect is permit or deny
+	Expect string `yaml:"expect"`
+	// Denied matches the vendor's authorization failure message
+	Denied string `yaml:"denied,omitempty"`
+}
+
+// startupData is passed to the startup config template
+type startupData struct {
+	Server string
+	Secret string
+}
+
+// loadFixtures reads every fixture in dir, filtered by names if any are provided
+func loadFixtures(dir string, names ...string) ([]fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(names))
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n != "" {
+			wanted[n] = true
+		}
+	}
+	var fixtures []fixture
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var f fixture
+		if err := yaml.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("bad fixture [%v]; %v", p, err)
+		}
+		if err := f.validate(); err != nil {
+			return nil, fmt.Errorf("bad fixture [%v]; %v", p, err)
+		}
+		if len(wanted) > 0 && !wanted[f.Name] {
+			continue
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
+
+func (f fixture) validate() error {
+	if f.Name == "" || f.Kind == "" || f.Image == "" {
+		return fmt.Errorf("name, kind and image are required")
+	}
+	if _, err := f.bootTimeout(); err != nil {
+		return err
+	}
+	if _, err := regexp.Compile(f.Prompt); err != nil {
+		return fmt.Errorf("bad prompt [%v]; %v", f.Prompt, err)
+	}
+	if f.Enable != nil {
+		if _, err := regexp.Compile(f.Enable.Prompt); err != nil {
+			return fmt.Errorf("bad enable prompt [%v]; %v", f.Enable.Prompt, err)
+		}
+	}
+	for _, c := range f.Commands {
+		if c.Expect != permit && c.Expect != deny {
+			return fmt.Errorf("command [%v] must expect %v or %v", c.Command, permit, deny)
+		}
+		if c.Expect == deny && c.Denied == "" {
+			return fmt.Errorf("command [%v] expects deny but sets no denied pattern", c.Command)
+		}
+	}
+	return nil
+}
+
+func (f fixture) bootTimeout() (time.Duration, error) {
+	if f.BootTimeout == "" {
+		return 5 * time.Minute, nil
+	}
+	d, err := time.ParseDuration(f.BootTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("bad boot_timeout [%v]; %v", f.BootTimeout, err)
+	}
+	return d, nil
+}
+
+// renderStartupConfig writes the fixture's startup config, pointed at tacquito, into dir
+func (f fixture) renderStartupConfig(fixtures, dir string, data startupData) (string, error) {
+	if f.StartupConfig == "" {
+		return "", nil
+	}
+	t, err := template.ParseFiles(filepath.Join(fixtures, f.StartupConfig))
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	p := filepath.Join(dir, f.Name+".cfg")
+	return p, os.WriteFile(p, b.Bytes(), 0644)
+}
+
+// TestFixtures validates every fixture and renders its startup config, without booting anything
+func TestFixtures(t *testing.T) {
+	fixtures, err := loadFixtures(fixturesDir)
+	require.NoError(t, err)
+	require.NotEmpty(t, fixtures)
+	for _, f := range fixtures {
+		p, err := f.renderStartupConfig(fixturesDir, t.TempDir(), startupData{Server: "192.0.2.1", Secret: psk})
+		require.NoError(t, err, f.Name)
+		if p == "" {
+			continue
+		}
+		b, err := os.ReadFile(p)
+		require.NoError(t, err, f.Name)
+		assert.Contains(t, string(b), "192.0.2.1", f.Name)
+		assert.Contains(t, string(b), psk, f.Name)
+	}
+}
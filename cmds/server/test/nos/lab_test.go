@@ -0,0 +1,89 @@
+//go:build nos
+
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package nos
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lab is a single node containerlab topology running a fixture's image
+type lab struct {
+	name     string
+	topology string
+}
+
+// clabTopology is the subset of the containerlab topology file we generate
+type clabTopology struct {
+	Name     string `yaml:"name"`
+	Topology struct {
+		Nodes map[string]clabNode `yaml:"nodes"`
+	} `yaml:"topology"`
+}
+
+type clabNode struct {
+	Kind          string `yaml:"kind"`
+	Image         string `yaml:"image"`
+	StartupConfig string `yaml:"startup-config,omitempty"`
+}
+
+// newLab writes a topology for f into dir.  startupConfig may be empty
+func newLab(f fixture, dir, startupConfig string) (*lab, error) {
+	var t clabTopology
+	t.Name = "tq-" + strings.ReplaceAll(f.Name, "_", "-")
+	t.Topology.Nodes = map[string]clabNode{
+		"dut": {Kind: f.Kind, Image: f.Image, StartupConfig: startupConfig},
+	}
+	b, err := yaml.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	p := filepath.Join(dir, t.Name+".clab.yml")
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		return nil, err
+	}
+	return &lab{name: t.Name, topology: p}, nil
+}
+
+func (l *lab) deploy(ctx context.Context) error {
+	return run(ctx, "containerlab", "deploy", "--reconfigure", "-t", l.topology)
+}
+
+func (l *lab) destroy(ctx context.Context) error {
+	return run(ctx, "containerlab", "destroy", "--cleanup", "-t", l.topology)
+}
+
+// address returns the mgmt address of the device under test
+func (l *lab) address(ctx context.Context) (string, error) {
+	container := fmt.Sprintf("clab-%s-dut", l.name)
+	out, err := exec.CommandContext(ctx, "docker", "inspect", "-f", "{{range .NetworkSettings.Networks}}{{.IPAddress}}{{end}}", container).Output()
+	if err != nil {
+		return "", fmt.Errorf("unable to inspect [%v]; %v", container, err)
+	}
+	addr := strings.TrimSpace(string(out))
+	if addr == "" {
+		return "", fmt.Errorf("no mgmt address found for [%v]", container)
+	}
+	return addr, nil
+}
+
+func run(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v %v failed; %v\n%s", name, strings.Join(args, " "), err, out)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+//go:build nos
+
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package nos
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/accounters/local"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authenticators/bcrypt"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authorizers/stringy"
+	"github.com/facebookincubator/tacquito/cmds/server/config/secret"
+	"github.com/facebookincubator/tacquito/cmds/server/config/secret/prefix"
+	"github.com/facebookincubator/tacquito/cmds/server/handlers"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+	"github.com/facebookincubator/tacquito/cmds/server/loader/yaml"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	fixturesDir = "testdata/fixtures"
+	// psk every fixture's startup config is rendered with, it must match testdata/nos_config.yaml
+	psk = "tacquito"
+	// commandTimeout bounds every cli interaction once the device is up
+	commandTimeout = 30 * time.Second
+)
+
+// keychain satisfies the bcrypt authenticator, the psk itself comes from testdata/nos_config.yaml
+type keychain struct{}
+
+// GetSecret ...
+func (keychain) GetSecret(ctx context.Context, name, group string) ([]byte, error) {
+	return []byte(psk), nil
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// startServer runs tacquito with testdata/nos_config.yaml, writing accounting records to acctPath
+func startServer(ctx context.Context, t *testing.T, address, acctPath string) {
+	logger := log.New(30, os.Stderr)
+	accounter, err := local.New(logger, local.SetLogSinkDefault(acctPath, "tacquito"))
+	require.NoError(t, err)
+	sp, err := loader.NewLocalConfig(
+		ctx,
+		"testdata/nos_config.yaml",
+		yaml.New(),
+		loader.SetLoggerProvider(logger),
+		loader.SetKeychainProvider(secret.New()),
+		loader.SetConfigProvider(config.New()),
+		loader.SetAuthorizerProvider(stringy.New(logger)),
+		loader.RegisterSecretProviderType(config.PREFIX, prefix.New(logger)),
+		loader.RegisterAuthenticator(config.BCRYPT, bcrypt.New(logger, keychain{})),
+		loader.RegisterAccounter(config.FILE, accounter),
+		loader.RegisterHandlerType(config.START, handlers.NewStart(logger)),
+	)
+	require.NoError(t, err)
+	sp.BlockUntilLoaded()
+
+	listener, err := net.Listen("tcp", address)
+	require.NoError(t, err, "tacacs usually needs root to listen on port 49, see NOS_LISTEN")
+	s := tq.NewServer(logger, sp)
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+}
+
+// TestNOSMatrix boots every fixture and drives a full aaa session on it
+func TestNOSMatrix(t *testing.T) {
+	for _, bin := range []string{"containerlab", "docker"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%v is required to run the nos matrix", bin)
+		}
+	}
+	fixtures, err := loadFixtures(fixturesDir, strings.Split(os.Getenv("NOS_FIXTURES"), ",")...)
+	require.NoError(t, err)
+	require.NotEmpty(t, fixtures, "no fixtures selected")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	acctPath := filepath.Join(t.TempDir(), "accounting.log")
+	startServer(ctx, t, getenv("NOS_LISTEN", ":49"), acctPath)
+
+	data := startupData{Server: getenv("NOS_TACACS_HOST", "172.20.20.1"), Secret: psk}
+	for _, f := range fixtures {
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			runFixture(ctx, t, f, data, acctPath)
+		})
+	}
+}
+
+func runFixture(ctx context.Context, t *testing.T, f fixture, data startupData, acctPath string) {
+	dir := t.TempDir()
+	startup, err := f.renderStartupConfig(fixturesDir, dir, data)
+	require.NoError(t, err)
+	l, err := newLab(f, dir, startup)
+	require.NoError(t, err)
+	require.NoError(t, l.deploy(ctx))
+	if os.Getenv("NOS_KEEP_LAB") == "" {
+		defer func() {
+			assert.NoError(t, l.destroy(context.Background()))
+		}()
+	}
+	address, err := l.address(ctx)
+	require.NoError(t, err)
+
+	// login
+	boot, _ := f.bootTimeout()
+	d, err := waitForDevice(address, f.Login, boot)
+	require.NoError(t, err, "login")
+	defer d.Close()
+	prompt := regexp.MustCompile(f.Prompt)
+	out, err := d.expect(prompt, commandTimeout)
+	require.NoError(t, err, "login prompt; %s", out)
+	for _, s := range f.Setup {
+		out, err := d.send(s, prompt, commandTimeout)
+		require.NoError(t, err, "setup [%v]; %s", s, out)
+	}
+
+	// enable
+	if f.Enable != nil {
+		prompt = regexp.MustCompile(f.Enable.Prompt)
+		next := prompt
+		if f.Enable.PasswordPrompt != "" {
+			next = regexp.MustCompile(f.Enable.PasswordPrompt)
+		}
+		out, err := d.send(f.Enable.Command, next, commandTimeout)
+		require.NoError(t, err, "enable; %s", out)
+		if f.Enable.PasswordPrompt != "" {
+			out, err = d.send(f.Enable.Password, prompt, commandTimeout)
+			require.NoError(t, err, "enable password; %s", out)
+		}
+	}
+
+	// command authorization
+	for _, c := range f.Commands {
+		out, err := d.send(c.Command, prompt, commandTimeout)
+		if !assert.NoError(t, err, "command [%v]; %s", c.Command, out) {
+			continue
+		}
+		denied := c.Denied != "" && regexp.MustCompile(c.Denied).MatchString(out)
+		switch c.Expect {
+		case permit:
+			assert.False(t, denied, "command [%v] should be permitted; %s", c.Command, out)
+		case deny:
+			assert.True(t, denied, "command [%v] should be denied; %s", c.Command, out)
+		}
+	}
+
+	// accounting records are sent asynchronously by most devices
+	assert.NoError(t, waitForAccounting(acctPath, f.Accounting, commandTimeout))
+}
+
+// waitForAccounting polls the accounting log until every substring in want is present
+func waitForAccounting(path string, want []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var missing []string
+		for _, w := range want {
+			if !strings.Contains(string(b), w) {
+				missing = append(missing, w)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("accounting records missing %q", missing)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/secret"
+	"github.com/facebookincubator/tacquito/cmds/server/handlers"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// proxyConfig is a config proxying every client, sharing secret proxyman, to upstream
+const proxyConfig = `
+secrets:
+  - name: proxied
+    secret:
+      group: tacquito
+      key: proxyman
+    handler:
+      type: 3
+      options:
+        upstream: "%v"
+        secret_group: tacquito
+        secret_key: fooman
+        timeout: 1s
+    type: 1
+    options:
+      prefixes: |
+        [
+          "::0/0"
+        ]
+`
+
+// proxyServer serves a config proxying to upstream until the returned stop is called
+func proxyServer(t *testing.T, upstream string) (string, func()) {
+	logger := log.New(30, os.Stderr)
+	return configServer(t, fmt.Sprintf(proxyConfig, upstream), loader.RegisterHandlerType(config.PROXY, handlers.NewProxy(logger, secret.New())))
+}
+
+// configServer serves the yaml config c until the returned stop is called.  opts are added to
+// those of MockSecretProvider.
+func configServer(t *testing.T, c string, opts ...loader.Option) (string, func()) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(c), 0600))
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	sp, err := MockSecretProvider(ctx, logger, path, opts...)
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, tq.NewServer(logger, sp, tq.SetDrainTimeout(time.Second)).Serve(ctx, listener.(*net.TCPListener)))
+	}()
+	return listener.Addr().String(), func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestProxy(t *testing.T) {
+	upstream, stop := poolServer(t, "[::1]:0", tq.SetSingleConnect(true))
+	defer stop()
+	address, stopProxy := proxyServer(t, upstream)
+	defer stopProxy()
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", address, []byte("proxyman")))
+	require.NoError(t, err)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	handled := counter(t, "tacquito_proxy_handle", nil)
+
+	pap, err := c.AuthenticatePAP(ctx, "mr_uses_group", "password")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusPass, pap.Status)
+	pap, err = c.AuthenticatePAP(ctx, "mr_uses_group", "wrong")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusFail, pap.Status)
+
+	// every prompt of an ascii login is answered on the same upstream session
+	ascii, err := c.AuthenticateASCII(ctx, "mr_uses_group", "password")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusPass, ascii.Status)
+
+	author, err := c.Authorize(ctx, "mr_uses_group", tq.Args{"service=shell", "cmd=configure", "cmd-arg=terminal", "cmd-arg=<cr>"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusPassAdd, author.Status)
+
+	var flags tq.AcctRequestFlag
+	flags.Set(tq.AcctFlagStart)
+	acct, err := c.Account(ctx, "mr_uses_group", flags, tq.Args{"cmd=show", "cmd-arg=system"}, tq.SetAcctRequestPrivLvl(tq.PrivLvlRoot))
+	require.NoError(t, err)
+	assert.Equal(t, tq.AcctReplyStatusSuccess, acct.Status)
+	assert.Greater(t, counter(t, "tacquito_proxy_handle", nil)-handled, float64(5))
+}
+
+func TestProxyUpstreamUnavailable(t *testing.T) {
+	down, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	down.Close()
+	address, stop := proxyServer(t, down.Addr().String())
+	defer stop()
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", address, []byte("proxyman")))
+	require.NoError(t, err)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pap, err := c.AuthenticatePAP(ctx, "mr_uses_group", "password")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusError, pap.Status)
+	author, err := c.Authorize(ctx, "mr_uses_group", tq.Args{"service=shell"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusError, author.Status)
+}
@@ -0,0 +1,115 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/handlers"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// counter returns the value of the series of the named counter family matching labels
+func counter(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+					continue metrics
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// observations returns the sample count of the series of the named histogram family matching labels
+func observations(t *testing.T, name string, labels map[string]string) uint64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+					continue metrics
+				}
+			}
+			return m.GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+// TestScopeMetrics counts completed exchanges by scope, authen type, status and user
+func TestScopeMetrics(t *testing.T) {
+	handlers.SetLabelLimits(256, 10)
+	defer handlers.SetLabelLimits(256, 0)
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	s := tq.NewServer(logger, sp)
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+
+	ascii := map[string]string{"scope": "localhost", "handler": "start", "authen_type": "AuthenTypeASCII", "status": "AuthenStatusPass", "user": "mr_uses_group"}
+	pap := map[string]string{"scope": "localhost", "handler": "start", "authen_type": "AuthenTypePAP", "status": "AuthenStatusPass", "user": "mr_uses_group"}
+	asciiBefore, papBefore := counter(t, "tacquito_scope_authen", ascii), counter(t, "tacquito_scope_authen", pap)
+	timed := func(handleType, outcome string) uint64 {
+		return observations(t, "tacquito_handle_duration_milliseconds", map[string]string{"type": handleType, "outcome": outcome})
+	}
+	asciiTimed, papTimed, authorTimed := timed("authen_ascii", "pass"), timed("authen_pap", "pass"), timed("author", "fail")
+	for _, test := range []Test{ASCIILoginFullFlow(), PapLoginFlow()} {
+		c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), test.Secret))
+		require.NoError(t, err)
+		for _, s := range test.Seq {
+			resp, err := c.Send(s.Packet)
+			require.NoError(t, err, test.Name)
+			assert.NoError(t, s.ValidateBody(resp.Body), test.Name)
+		}
+		c.Close()
+	}
+	assert.Equal(t, asciiBefore+1, counter(t, "tacquito_scope_authen", ascii), "the username is taken from the continue")
+	assert.Equal(t, papBefore+1, counter(t, "tacquito_scope_authen", pap))
+
+	// only the packet ending the login is timed
+	assert.Equal(t, asciiTimed+1, timed("authen_ascii", "pass"))
+	assert.Equal(t, papTimed+1, timed("authen_pap", "pass"))
+
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+	reply, err := c.Authorize(ctx, "mr_uses_group", tq.Args{"service=shell", "cmd=reload"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusFail, reply.Status)
+	assert.Equal(t, authorTimed+1, timed("author", "fail"))
+}
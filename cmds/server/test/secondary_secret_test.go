@@ -0,0 +1,66 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSecondarySecret rotates the localhost scope to a new secret, keeping the previous one as
+// the secondary, and checks clients on either secret are served
+func TestSecondarySecret(t *testing.T) {
+	b, err := os.ReadFile("testdata/test_config.yaml")
+	require.NoError(t, err)
+	rotated := strings.Replace(string(b), "      key: fooman\n", "      key: rotated\n    secondary_secret:\n      group: tacquito\n      key: fooman\n", 1)
+	require.NotEqual(t, string(b), rotated)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(rotated), 0644))
+
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, path)
+	require.NoError(t, err)
+	_, ok := sp.(tq.RotatingSecretProvider)
+	require.True(t, ok)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	s := tq.NewServer(logger, sp)
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+
+	login := func(secret string) error {
+		c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte(secret)))
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		test := PapLoginFlow()
+		resp, err := c.Send(test.Seq[0].Packet)
+		if err != nil {
+			return err
+		}
+		return test.Seq[0].ValidateBody(resp.Body)
+	}
+	assert.NoError(t, login("rotated"))
+	assert.NoError(t, login("fooman"))
+	assert.Error(t, login("wrong"))
+}
@@ -0,0 +1,73 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStrictSequence checks a session that does not start at sequence number 1 is terminated
+// with an error reply in strict sequence mode, and that valid sessions are still served
+func TestStrictSequence(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	s := tq.NewServer(logger, sp, tq.SetStrictSequence(true))
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+
+	p := basicAuthorPacket("mr_uses_group", tq.Args{"service=shell", "cmd=configure\n", "cmd-arg=terminal\n", "cmd-arg=<cr>"})
+	p.Header.SeqNo = 3
+	resp, err := c.Send(p)
+	require.NoError(t, err)
+	assert.Equal(t, tq.SequenceNumber(4), resp.Header.SeqNo)
+	var reply tq.AuthorReply
+	require.NoError(t, tq.Unmarshal(resp.Body, &reply))
+	assert.Equal(t, tq.AuthorStatusError, reply.Status)
+
+	// even sequence numbers have no valid reply, the session is dropped
+	p = basicAuthorPacket("mr_uses_group", tq.Args{"service=shell", "cmd=configure\n", "cmd-arg=terminal\n", "cmd-arg=<cr>"})
+	p.Header.SeqNo = 2
+	_, err = c.SendContext(timeout(t, 200*time.Millisecond), p)
+	assert.Error(t, err)
+
+	// a session starting at 1 is served
+	c, err = tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+	resp, err = c.Send(basicAuthorPacket("mr_uses_group", tq.Args{"service=shell", "cmd=configure\n", "cmd-arg=terminal\n", "cmd-arg=<cr>"}))
+	require.NoError(t, err)
+	require.NoError(t, tq.Unmarshal(resp.Body, &reply))
+	assert.Equal(t, tq.AuthorStatusPassAdd, reply.Status)
+}
+
+// timeout is a context cancelled after d or at the end of the test
+func timeout(t *testing.T, d time.Duration) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	t.Cleanup(cancel)
+	return ctx
+}
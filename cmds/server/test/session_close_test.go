@@ -0,0 +1,87 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closingProvider serves every client with a handler that prompts for a password, then ends the
+// session on the client's answer: with Abort if it is "abort", with Close otherwise
+type closingProvider struct {
+	t *testing.T
+}
+
+// Get ...
+func (p closingProvider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler, error) {
+	return []byte("fooman"), tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		closer, ok := response.(tq.SessionCloser)
+		require.True(p.t, ok, "the server's response implements tq.SessionCloser")
+		assert.True(p.t, closer.Final(), "no next handler was set yet")
+		response.Next(tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+			closer := response.(tq.SessionCloser)
+			var body tq.AuthenContinue
+			if !assert.NoError(p.t, tq.Unmarshal(request.Body, &body)) {
+				return
+			}
+			if string(body.UserMessage) == "abort" {
+				_, err := closer.Abort("protocol violation")
+				assert.NoError(p.t, err)
+			} else {
+				closer.Close()
+			}
+			assert.True(p.t, closer.Final())
+		}))
+		assert.False(p.t, closer.Final(), "the client's next packet is expected")
+		response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusGetPass)))
+	}), nil
+}
+
+// TestSessionClose ends sessions from their handler, which must close the connection
+func TestSessionClose(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	go func() {
+		assert.NoError(t, tq.NewServer(logger, closingProvider{t: t}).Serve(ctx, listener.(*net.TCPListener)))
+	}()
+
+	// abort replies with an error before closing
+	e := newASCIIExchange(t, listener.Addr().String(), BuildASCIIStartPacket())
+	require.Equal(t, tq.AuthenStatusGetPass, e.send("").Status)
+	reply := e.send("abort")
+	assert.Equal(t, tq.AuthenStatusError, reply.Status)
+	assert.Equal(t, "protocol violation", string(reply.ServerMsg))
+	_, err = e.c.Send(BuildASCIIStartPacket())
+	assert.Error(t, err, "the connection was closed")
+
+	// close does not reply
+	e = newASCIIExchange(t, listener.Addr().String(), BuildASCIIStartPacket())
+	require.Equal(t, tq.AuthenStatusGetPass, e.send("").Status)
+	_, err = e.c.Send(tq.NewPacket(
+		tq.SetPacketHeader(tq.NewHeader(
+			tq.SetHeaderVersion(tq.Version{MajorVersion: tq.MajorVersion, MinorVersion: tq.MinorVersionDefault}),
+			tq.SetHeaderType(tq.Authenticate),
+			tq.SetHeaderSeqNo(3),
+			tq.SetHeaderSessionID(e.start.Header.SessionID),
+		)),
+		tq.SetPacketBodyUnsafe(tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage("close"))),
+	))
+	assert.Error(t, err, "the connection was closed without a reply")
+}
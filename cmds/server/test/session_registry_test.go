@@ -0,0 +1,71 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSessionRegistry starts an ascii login and checks its session id is refused on another
+// connection while the login is in progress
+func TestSessionRegistry(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	s := tq.NewServer(logger, sp, tq.SetSessionRegistry(time.Minute))
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+	dial := func() *tq.Client {
+		c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+		require.NoError(t, err)
+		return c
+	}
+
+	// the login waits for its username, holding its session id
+	c := dial()
+	defer c.Close()
+	ascii := ASCIILoginFullFlow()
+	resp, err := c.Send(ascii.Seq[0].Packet)
+	require.NoError(t, err)
+	assert.NoError(t, ascii.Seq[0].ValidateBody(resp.Body))
+
+	spoofed := PapLoginFlow().Seq[0].Packet
+	spoofed.Header.SessionID = ascii.Seq[0].Packet.Header.SessionID
+	other := dial()
+	defer other.Close()
+	resp, err = other.Send(spoofed)
+	require.NoError(t, err)
+	var reply tq.AuthenReply
+	require.NoError(t, tq.Unmarshal(resp.Body, &reply))
+	assert.Equal(t, tq.AuthenStatusError, reply.Status)
+	assert.Equal(t, tq.AuthenServerMsg("session id is in use"), reply.ServerMsg)
+
+	// other ids are served
+	other = dial()
+	defer other.Close()
+	test := PapLoginFlow()
+	resp, err = other.Send(test.Seq[0].Packet)
+	require.NoError(t, err)
+	assert.NoError(t, test.Seq[0].ValidateBody(resp.Body))
+}
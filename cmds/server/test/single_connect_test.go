@@ -0,0 +1,112 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSingleConnect(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx := context.Background()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	assert.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	assert.NoError(t, err)
+	tcpListener := listener.(*net.TCPListener)
+
+	s := tq.NewServer(logger, sp, tq.SetSingleConnect(true))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		if err := s.Serve(ctx, tcpListener); err != nil {
+			assert.NoError(t, err)
+		}
+	}()
+
+	newPacket := func(singleConnect bool) *tq.Packet {
+		p := PapLoginFlow().Seq[0].Packet
+		if singleConnect {
+			p.Header.Flags.Set(tq.SingleConnect)
+		}
+		return p
+	}
+
+	// the client requests single-connect, so the server advertises it and multiplexes sessions
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		resp, err := c.Send(newPacket(true))
+		if assert.NoError(t, err) {
+			assert.True(t, resp.Header.Flags.Has(tq.SingleConnect))
+			assert.NoError(t, PapLoginFlow().Seq[0].ValidateBody(resp.Body))
+		}
+	}
+	c.Close()
+
+	// without the flag, the server does not advertise it and closes after the session
+	c, err = tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	assert.NoError(t, err)
+	resp, err := c.Send(newPacket(false))
+	if assert.NoError(t, err) {
+		assert.False(t, resp.Header.Flags.Has(tq.SingleConnect))
+	}
+	_, err = c.Send(newPacket(false))
+	assert.Error(t, err, "connection should be closed after the first session")
+	c.Close()
+}
+
+func TestClientSingleConnect(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx := context.Background()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	assert.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	assert.NoError(t, err)
+	tcpListener := listener.(*net.TCPListener)
+
+	s := tq.NewServer(logger, sp, tq.SetSingleConnect(true))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		if err := s.Serve(ctx, tcpListener); err != nil {
+			assert.NoError(t, err)
+		}
+	}()
+
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")), tq.SetClientSingleConnect())
+	assert.NoError(t, err)
+	defer c.Close()
+	assert.False(t, c.Multiplexed(), "nothing is negotiated before the first reply")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			test := PapLoginFlow()
+			resp, err := c.Send(test.Seq[0].Packet)
+			if assert.NoError(t, err) {
+				assert.NoError(t, test.Seq[0].ValidateBody(resp.Body))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.True(t, c.Multiplexed())
+}
@@ -0,0 +1,155 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/handlers"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// spanServer serves the test config through a span handler with options, mirroring to a
+// collector
+func spanServer(t *testing.T, options map[string]string) (string, func()) {
+	b, err := os.ReadFile("testdata/test_config.yaml")
+	require.NoError(t, err)
+	handler := "type: 2\n      options:"
+	for k, v := range options {
+		handler += fmt.Sprintf("\n        %v: %q", k, v)
+	}
+	c := strings.Replace(string(b), "type: *handler_type_start", handler, 1)
+	logger := log.New(30, os.Stderr)
+	return configServer(t, c, loader.RegisterHandlerType(config.SPAN, handlers.NewSpan(logger)))
+}
+
+// mirroredPacket reads the next packet of a stream collector
+func mirroredPacket(t *testing.T, r io.Reader) *tq.Packet {
+	b := make([]byte, tq.MaxHeaderLength)
+	_, err := io.ReadFull(r, b)
+	require.NoError(t, err)
+	b = append(b, make([]byte, binary.BigEndian.Uint32(b[8:]))...)
+	_, err = io.ReadFull(r, b[tq.MaxHeaderLength:])
+	require.NoError(t, err)
+	p := tq.NewPacket()
+	require.NoError(t, p.UnmarshalBinary(b))
+	return p
+}
+
+func TestSpanTCP(t *testing.T) {
+	collector, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	defer collector.Close()
+	address, stop := spanServer(t, map[string]string{"destination": collector.Addr().String(), "network": "tcp6"})
+	defer stop()
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", address, []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reply, err := c.AuthenticateASCII(ctx, "mr_uses_group", "password")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusPass, reply.Status)
+
+	conn, err := collector.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	// every packet of the login is mirrored decrypted, including the continue answering the
+	// password prompt
+	var start tq.AuthenStart
+	p := mirroredPacket(t, conn)
+	assert.True(t, p.Header.Flags.Has(tq.UnencryptedFlag))
+	require.NoError(t, tq.Unmarshal(p.Body, &start))
+	assert.Equal(t, tq.AuthenUser("mr_uses_group"), start.User)
+
+	var status []tq.AuthenStatus
+	for seq := 2; seq <= 4; seq++ {
+		p := mirroredPacket(t, conn)
+		assert.Equal(t, tq.SequenceNumber(seq), p.Header.SeqNo)
+		assert.True(t, p.Header.Flags.Has(tq.UnencryptedFlag))
+		if seq%2 == 0 {
+			var body tq.AuthenReply
+			require.NoError(t, tq.Unmarshal(p.Body, &body))
+			status = append(status, body.Status)
+			continue
+		}
+		var body tq.AuthenContinue
+		require.NoError(t, tq.Unmarshal(p.Body, &body))
+		assert.Equal(t, tq.AuthenUserMessage("password"), body.UserMessage)
+	}
+	assert.Equal(t, []tq.AuthenStatus{tq.AuthenStatusGetPass, tq.AuthenStatusPass}, status)
+}
+
+func TestSpanUDP(t *testing.T) {
+	collector, err := net.ListenPacket("udp6", "[::1]:0")
+	require.NoError(t, err)
+	defer collector.Close()
+	address, stop := spanServer(t, map[string]string{"destination": collector.LocalAddr().String(), "network": "udp6", "packetType": "authorize"})
+	defer stop()
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", address, []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// only authorization sessions pass the filter
+	pap, err := c.AuthenticatePAP(ctx, "mr_uses_group", "password")
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthenStatusPass, pap.Status)
+	author, err := c.Authorize(ctx, "mr_uses_group", tq.Args{"service=shell", "cmd=configure", "cmd-arg=terminal", "cmd-arg=<cr>"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusPassAdd, author.Status)
+
+	collector.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var types []tq.HeaderType
+	for i := 0; i < 2; i++ {
+		b := make([]byte, 4096)
+		n, _, err := collector.ReadFrom(b)
+		require.NoError(t, err)
+		p := tq.NewPacket()
+		require.NoError(t, p.UnmarshalBinary(b[:n]))
+		types = append(types, p.Header.Type)
+	}
+	assert.Equal(t, []tq.HeaderType{tq.Authorize, tq.Authorize}, types)
+}
+
+func TestSpanUnreachable(t *testing.T) {
+	down, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	down.Close()
+	address, stop := spanServer(t, map[string]string{"destination": down.Addr().String()})
+	defer stop()
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", address, []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// sessions are served while the destination is down
+	for i := 0; i < 3; i++ {
+		pap, err := c.AuthenticatePAP(ctx, "mr_uses_group", "password")
+		require.NoError(t, err)
+		assert.Equal(t, tq.AuthenStatusPass, pap.Status)
+	}
+}
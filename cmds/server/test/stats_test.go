@@ -0,0 +1,77 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStats checks the stats shared by two servers count the connections, sessions and handlers
+// of both
+func TestStats(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	stats := tq.NewStats()
+	var addresses []string
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("tcp6", "[::1]:0")
+		require.NoError(t, err)
+		addresses = append(addresses, listener.Addr().String())
+		s := tq.NewServer(logger, sp, tq.SetStats(stats))
+		require.Equal(t, stats, s.Stats())
+		go s.Serve(ctx, listener.(*net.TCPListener))
+	}
+
+	// an ascii login waits for its password on the first server
+	first, err := tq.NewClient(tq.SetClientDialer("tcp6", addresses[0], []byte("fooman")))
+	require.NoError(t, err)
+	defer first.Close()
+	ascii := ASCIILoginFullFlow()
+	for _, seq := range ascii.Seq[:2] {
+		resp, err := first.Send(seq.Packet)
+		require.NoError(t, err)
+		require.NoError(t, seq.ValidateBody(resp.Body))
+	}
+	// while an authorization completes on the second
+	second, err := tq.NewClient(tq.SetClientDialer("tcp6", addresses[1], []byte("fooman")))
+	require.NoError(t, err)
+	reply, err := second.Authorize(ctx, "mr_uses_group", tq.Args{"service=shell", "cmd=configure", "cmd-arg=terminal", "cmd-arg=<cr>"})
+	require.NoError(t, err)
+	assert.Equal(t, tq.AuthorStatusPassAdd, reply.Status)
+
+	s := stats.Snapshot()
+	assert.Equal(t, int64(2), s.Connections)
+	assert.Equal(t, int64(1), s.Sessions)
+	assert.Equal(t, tq.SessionStats{Active: 1, Total: 1}, s.SessionsByType["Authenticate"])
+	assert.Equal(t, tq.SessionStats{Active: 0, Total: 1}, s.SessionsByType["Authorize"])
+	assert.Equal(t, int64(2), s.Handlers["Authenticate"].Count)
+	assert.Equal(t, int64(1), s.Handlers["Authorize"].Count)
+	assert.NotZero(t, s.Handlers["Authorize"].Max)
+
+	// closing the connection ends the login in progress
+	second.Close()
+	first.Close()
+	assert.Eventually(t, func() bool {
+		s := stats.Snapshot()
+		return s.Connections == 0 && s.Sessions == 0 && s.ConnectionsTotal == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
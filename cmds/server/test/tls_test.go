@@ -0,0 +1,316 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// issue creates a certificate from template, signed by parent, or self signed if parent is nil
+func issue(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// TestTLSCertScope matches clients to a scope by the uri in their client certificate.  Clients
+// without a certificate fall through to the localhost prefix scope.  mr_uses_group is only granted
+// the localhost scope, so its logins only pass without a certificate.  Packets over tls are not
+// obfuscated, the secret of the client does not matter.
+func TestTLSCertScope(t *testing.T) {
+	b, err := os.ReadFile("testdata/test_config.yaml")
+	require.NoError(t, err)
+	cfg := strings.Replace(string(b), "secrets:\n", `secrets:
+  - name: routers
+    secret:
+      group: tacquito
+      key: routerkey
+    handler:
+      type: *handler_type_start
+    type: 3
+    options:
+      uris: '["spiffe://example.com/router/*"]'
+`, 1)
+	cfg = strings.Replace(cfg, "mr_no_group\n    scopes: [\"localhost\"]", "mr_no_group\n    scopes: [\"routers\"]", 1)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(cfg), 0644))
+
+	ca := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ca"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	server := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "tacquito"}, IPAddresses: []net.IP{net.IPv6loopback}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, &ca)
+	router, err := url.Parse("spiffe://example.com/router/rtr1")
+	require.NoError(t, err)
+	client := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "rtr1"}, URIs: []*url.URL{router}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, &ca)
+
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, path)
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	listener := tq.NewTLSListener(l.(*net.TCPListener), &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	})
+	s := tq.NewServer(logger, sp, tq.SetReadTimeout(time.Second))
+	require.NoError(t, s.Validate(listener))
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener))
+	}()
+
+	login := func(secret string, certs ...tls.Certificate) error {
+		c, err := tq.NewClient(tq.SetClientTLSDialer("tcp6", listener.Addr().String(), &tls.Config{RootCAs: pool, Certificates: certs}, []byte(secret)))
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		test := PapLoginFlow()
+		resp, err := c.Send(test.Seq[0].Packet)
+		if err != nil {
+			return err
+		}
+		return test.Seq[0].ValidateBody(resp.Body)
+	}
+	assert.Error(t, login("routerkey", client))
+	assert.NoError(t, login("fooman"))
+	assert.NoError(t, login("routerkey"))
+
+	// certificates from an untrusted ca are not presented, the client falls through to localhost
+	untrusted := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "rtr1"}, URIs: []*url.URL{router}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, nil)
+	assert.NoError(t, login("routerkey", untrusted))
+}
+
+// connInfoProvider serves every client, recording the ConnectionInfo seen by Get and by the handler
+type connInfoProvider struct {
+	infos chan tq.ConnectionInfo
+}
+
+// Get ...
+func (p connInfoProvider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler, error) {
+	info, _ := tq.ConnInfo(ctx)
+	p.infos <- info
+	return []byte("fooman"), tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		info, _ := tq.ConnInfo(request.Context)
+		p.infos <- info
+		response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(tq.AuthenStatusPass)))
+	}), nil
+}
+
+// TestConnectionInfo checks the transport properties of a tls client reach both the secret
+// provider and handlers
+func TestConnectionInfo(t *testing.T) {
+	ca := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ca"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	server := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "tacquito"}, IPAddresses: []net.IP{net.IPv6loopback}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, &ca)
+	client := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "rtr1"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, &ca)
+
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	listener := tq.NewTLSListener(l.(*net.TCPListener), &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		NextProtos:   []string{"tacacs"},
+	})
+	sp := connInfoProvider{infos: make(chan tq.ConnectionInfo, 2)}
+	go func() {
+		assert.NoError(t, tq.NewServer(logger, sp).Serve(ctx, listener))
+	}()
+
+	c, err := tq.NewClient(tq.SetClientTLSDialer("tcp6", listener.Addr().String(), &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{client},
+		NextProtos:   []string{"tacacs"},
+		MinVersion:   tls.VersionTLS13,
+	}, []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Send(PapLoginFlow().Seq[0].Packet)
+	require.NoError(t, err)
+
+	for _, seen := range []string{"secret provider", "handler"} {
+		info := <-sp.infos
+		require.NotNil(t, info.TLS, seen)
+		assert.Equal(t, listener.Addr().String(), info.LocalAddr.String(), seen)
+		assert.Equal(t, c.Options().LocalAddr, info.RemoteAddr.String(), seen)
+		assert.Equal(t, uint16(tls.VersionTLS13), info.TLS.Version, seen)
+		assert.Equal(t, "tacacs", info.TLS.NegotiatedProtocol, seen)
+		require.Len(t, info.TLS.PeerCertificates, 1, seen)
+		assert.Equal(t, "rtr1", info.TLS.PeerCertificates[0].Subject.CommonName, seen)
+	}
+}
+
+// tls12Listener serves tls with config as is, unlike tq.NewTLSListener which raises it to tls 1.3
+type tls12Listener struct {
+	*net.TCPListener
+	config *tls.Config
+}
+
+// Accept implements net.Listener
+func (l tls12Listener) Accept() (net.Conn, error) {
+	conn, err := l.TCPListener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return tls.Server(conn, l.config), nil
+}
+
+// TestTLS13 checks tls sessions are tls 1.3 or later and are not obfuscated, per
+// draft-ietf-opsawg-tacacs-tls13
+func TestTLS13(t *testing.T) {
+	ca := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ca"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	server := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "tacquito"}, IPAddresses: []net.IP{net.IPv6loopback}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, &ca)
+
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	// the server refuses tls 1.2 even if its listener's config allows it
+	l, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	go tq.NewServer(logger, sp, tq.SetReadTimeout(time.Second)).Serve(ctx, tls12Listener{TCPListener: l.(*net.TCPListener), config: &tls.Config{Certificates: []tls.Certificate{server}}})
+	conn, err := tls.Dial("tcp6", l.Addr().String(), &tls.Config{RootCAs: pool, MaxVersion: tls.VersionTLS12})
+	require.NoError(t, err)
+	b, err := PapLoginFlow().Seq[0].Packet.MarshalBinary()
+	require.NoError(t, err)
+	conn.Write(b)
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+	conn.Close()
+
+	// tq.NewTLSListener does not negotiate tls 1.2 at all
+	l, err = net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	listener := tq.NewTLSListener(l.(*net.TCPListener), &tls.Config{Certificates: []tls.Certificate{server}, MinVersion: tls.VersionTLS12})
+	go tq.NewServer(logger, sp, tq.SetReadTimeout(time.Second)).Serve(ctx, listener)
+	_, err = tls.Dial("tcp6", listener.Addr().String(), &tls.Config{RootCAs: pool, MaxVersion: tls.VersionTLS12})
+	assert.Error(t, err)
+
+	// an obfuscated packet is answered with an unencrypted error status, then the connection closes
+	conn, err = tls.Dial("tcp6", listener.Addr().String(), &tls.Config{RootCAs: pool})
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write(b)
+	require.NoError(t, err)
+	raw := make([]byte, tq.MaxHeaderLength)
+	_, err = io.ReadFull(conn, raw)
+	require.NoError(t, err)
+	var h tq.Header
+	require.NoError(t, h.UnmarshalBinary(raw))
+	assert.True(t, h.Flags.Has(tq.UnencryptedFlag))
+	body := make([]byte, h.Length)
+	_, err = io.ReadFull(conn, body)
+	require.NoError(t, err)
+	var reply tq.AuthenReply
+	require.NoError(t, tq.Unmarshal(body, &reply))
+	assert.Equal(t, tq.AuthenStatusError, reply.Status)
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+
+	// clients set the unencrypted flag on every packet, and so does the server
+	c, err := tq.NewClient(tq.SetClientTLSDialer("tcp6", listener.Addr().String(), &tls.Config{RootCAs: pool}, []byte("fooman")))
+	require.NoError(t, err)
+	defer c.Close()
+	resp, err := c.Send(PapLoginFlow().Seq[0].Packet)
+	require.NoError(t, err)
+	assert.True(t, resp.Header.Flags.Has(tq.UnencryptedFlag))
+	assert.NoError(t, PapLoginFlow().Seq[0].ValidateBody(resp.Body))
+}
+
+// TestTLSPeerPolicy checks only clients whose verified certificate has a subject alternative name
+// allowed by the policy are served
+func TestTLSPeerPolicy(t *testing.T) {
+	ca := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ca"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	server := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "tacquito"}, IPAddresses: []net.IP{net.IPv6loopback}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, &ca)
+	client := func(dnsName string) tls.Certificate {
+		return issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: dnsName}, DNSNames: []string{dnsName}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, &ca)
+	}
+
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+	policy, err := tq.ParseTLSPeerPolicy("dns:*.routers.example.com")
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	listener := tq.NewTLSListener(l.(*net.TCPListener), &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	})
+	s := tq.NewServer(logger, sp, tq.SetReadTimeout(time.Second), tq.SetTLSPeerPolicy(policy))
+	require.NoError(t, s.Validate(listener))
+	go s.Serve(ctx, listener)
+
+	login := func(certs ...tls.Certificate) error {
+		c, err := tq.NewClient(tq.SetClientTLSDialer("tcp6", listener.Addr().String(), &tls.Config{RootCAs: pool, Certificates: certs}, nil))
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		test := PapLoginFlow()
+		resp, err := c.Send(test.Seq[0].Packet)
+		if err != nil {
+			return err
+		}
+		return test.Seq[0].ValidateBody(resp.Body)
+	}
+	assert.NoError(t, login(client("rtr1.routers.example.com")))
+	assert.Error(t, login(client("rtr1.switches.example.com")))
+	assert.Error(t, login(client("rtr1.pod1.routers.example.com")))
+	assert.Error(t, login())
+}
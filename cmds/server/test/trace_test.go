@@ -0,0 +1,120 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type spanKey struct{}
+
+// recordedSpan is a span recorded by recordingTracer
+type recordedSpan struct {
+	tracer     *recordingTracer
+	name       string
+	parent     string
+	attributes map[string]interface{}
+	err        error
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+	s.attributes[key] = value
+}
+
+func (s *recordedSpan) End(err error) {
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+	s.err = err
+	s.tracer.ended = append(s.tracer.ended, s)
+}
+
+// recordingTracer keeps every span that ends
+type recordingTracer struct {
+	sync.Mutex
+	ended []*recordedSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string) (context.Context, tq.Span) {
+	s := &recordedSpan{tracer: r, name: name, attributes: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		s.parent = parent.name
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// parents maps the name of every ended span to the name of its parent
+func (r *recordingTracer) parents() map[string]string {
+	r.Lock()
+	defer r.Unlock()
+	p := map[string]string{}
+	for _, s := range r.ended {
+		p[s.name] = s.parent
+	}
+	return p
+}
+
+// TestTracer traces a pap login from accept to reply
+func TestTracer(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	tracer := &recordingTracer{}
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	s := tq.NewServer(logger, sp, tq.SetTracer(tracer))
+	go func() {
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+
+	c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+	require.NoError(t, err)
+	test := PapLoginFlow()
+	resp, err := c.Send(test.Seq[0].Packet)
+	require.NoError(t, err)
+	assert.NoError(t, test.Seq[0].ValidateBody(resp.Body))
+	c.Close()
+
+	assert.Eventually(t, func() bool {
+		_, ok := tracer.parents()["tacacs.connection"]
+		return ok
+	}, 5*time.Second, 10*time.Millisecond, "the connection span ends when the client closes")
+	assert.Equal(t, map[string]string{
+		"tacacs.connection": "",
+		"tacacs.secrets":    "tacacs.connection",
+		"tacacs.packet":     "tacacs.connection",
+		"tacacs.decrypt":    "tacacs.packet",
+		"tacacs.handler":    "tacacs.packet",
+		"tacacs.reply":      "tacacs.handler",
+	}, tracer.parents())
+
+	tracer.Lock()
+	defer tracer.Unlock()
+	for _, span := range tracer.ended {
+		assert.NoError(t, span.err, span.name)
+		if span.name == "tacacs.packet" {
+			assert.Equal(t, "Authenticate", span.attributes["tacacs.type"])
+			assert.Equal(t, uint8(1), span.attributes["tacacs.seq_no"])
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUnencryptedPolicy checks unencrypted sessions are refused by default, served from the
+// prefixes of the allow policy only, and served by the log policy
+func TestUnencryptedPolicy(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+	_, loopback, err := net.ParseCIDR("::1/128")
+	require.NoError(t, err)
+	_, lab, err := net.ParseCIDR("2001:db8::/32")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		opts   []tq.Option
+		status tq.AuthorStatus
+	}{
+		{name: "reject by default", status: tq.AuthorStatusError},
+		{name: "allow from the client's prefix", opts: []tq.Option{tq.SetUnencryptedPolicy(tq.UnencryptedAllow, lab, loopback)}, status: tq.AuthorStatusPassAdd},
+		{name: "allow from other prefixes", opts: []tq.Option{tq.SetUnencryptedPolicy(tq.UnencryptedAllow, lab)}, status: tq.AuthorStatusError},
+		{name: "log", opts: []tq.Option{tq.SetUnencryptedPolicy(tq.UnencryptedLog)}, status: tq.AuthorStatusPassAdd},
+	}
+	args := tq.Args{"service=shell", "cmd=configure", "cmd-arg=terminal", "cmd-arg=<cr>"}
+	for _, test := range tests {
+		listener, err := net.Listen("tcp6", "[::1]:0")
+		require.NoError(t, err)
+		go tq.NewServer(logger, sp, test.opts...).Serve(ctx, listener.(*net.TCPListener))
+
+		c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")), tq.SetClientUnencrypted())
+		require.NoError(t, err, test.name)
+		reply, err := c.Authorize(ctx, "mr_uses_group", args)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, test.status, reply.Status, test.name)
+		c.Close()
+
+		// obfuscated sessions are served whatever the policy
+		c, err = tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+		require.NoError(t, err, test.name)
+		reply, err = c.Authorize(ctx, "mr_uses_group", args)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, tq.AuthorStatusPassAdd, reply.Status, test.name)
+		c.Close()
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMaxConcurrentSessions floods a server with a small worker pool with concurrent logins, each
+// must be served once the pool catches up
+func TestMaxConcurrentSessions(t *testing.T) {
+	logger := log.New(30, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sp, err := MockSecretProvider(ctx, logger, "testdata/test_config.yaml")
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	require.NoError(t, err)
+	s := tq.NewServer(logger, sp, tq.SetMaxConcurrentSessions(2))
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		assert.NoError(t, s.Serve(ctx, listener.(*net.TCPListener)))
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := tq.NewClient(tq.SetClientDialer("tcp6", listener.Addr().String(), []byte("fooman")))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer c.Close()
+			test := PapLoginFlow()
+			resp, err := c.Send(test.Seq[0].Packet)
+			if assert.NoError(t, err) {
+				assert.NoError(t, test.Seq[0].ValidateBody(resp.Body))
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+	<-served
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package throttle
+
+import (
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// newCPUSampler returns a func that reports process cpu utilization since its last call,
+// as a percentage of all available cpus
+func newCPUSampler() func() float64 {
+	var mu sync.Mutex
+	lastWall := time.Now()
+	lastCPU := processCPU()
+	return func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		now, cpu := time.Now(), processCPU()
+		wall := now.Sub(lastWall)
+		used := cpu - lastCPU
+		lastWall, lastCPU = now, cpu
+		if wall <= 0 {
+			return 0
+		}
+		return float64(used) / float64(wall) / float64(runtime.NumCPU()) * 100
+	}
+}
+
+// processCPU returns the user and system cpu time consumed by this process
+func processCPU() time.Duration {
+	var r syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &r); err != nil {
+		return 0
+	}
+	return time.Duration(r.Utime.Nano() + r.Stime.Nano())
+}
@@ -0,0 +1,13 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package throttle
+
+// newCPUSampler is not supported on windows; cpu based throttling never engages
+func newCPUSampler() func() float64 {
+	return func() float64 { return 0 }
+}
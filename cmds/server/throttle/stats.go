@@ -0,0 +1,55 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package throttle
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// gauges and counters
+	throttleEngaged = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "throttle_engaged",
+		Help:      "set to 1 while optional features are disabled due to load",
+	})
+	throttleEngage = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "throttle_engage",
+		Help:      "number of times the throttle engaged and disabled optional features",
+	})
+	throttleRelease = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "throttle_release",
+		Help:      "number of times the throttle released and re-enabled optional features",
+	})
+	throttleShed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "throttle_shed",
+		Help:      "number of optional feature invocations skipped while the throttle was engaged",
+	})
+	throttleLatency = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "throttle_latency_milliseconds",
+		Help:      "the average handler latency seen at the last throttle evaluation, in milliseconds",
+	})
+	throttleCPU = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "throttle_cpu_percent",
+		Help:      "the process cpu utilization seen at the last throttle evaluation, as a percent of all cpus",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(throttleEngaged)
+	prometheus.MustRegister(throttleEngage)
+	prometheus.MustRegister(throttleRelease)
+	prometheus.MustRegister(throttleShed)
+	prometheus.MustRegister(throttleLatency)
+	prometheus.MustRegister(throttleCPU)
+}
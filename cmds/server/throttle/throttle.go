@@ -0,0 +1,252 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package throttle provides an error budget driven governor that disables expensive, optional
+// features while the server is under load.  AAA availability always wins over features like packet
+// mirroring or enrichment lookups; when request latency or cpu use crosses a threshold, the
+// governor engages and Allow returns false until load subsides.
+package throttle
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// Feature names an optional, expensive code path that may be shed under load
+type Feature string
+
+const (
+	// PacketRecording covers mirroring or recording of raw packets, such as the span handler
+	PacketRecording Feature = "packet_recording"
+	// ShadowEvaluation covers evaluating a candidate policy alongside the active one
+	ShadowEvaluation Feature = "shadow_evaluation"
+	// Enrichment covers lookups that decorate records with external data
+	Enrichment Feature = "enrichment"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+}
+
+// Option is used to set optional behaviors on the Governor
+type Option func(g *Governor)
+
+// SetLatencyThreshold sets the average handler latency that engages the governor.
+// zero disables latency based throttling.
+func SetLatencyThreshold(v time.Duration) Option {
+	return func(g *Governor) {
+		g.latencyThreshold = v
+	}
+}
+
+// SetCPUThreshold sets the process cpu utilization, as a percentage of all available cpus,
+// that engages the governor.  zero disables cpu based throttling.
+func SetCPUThreshold(v float64) Option {
+	return func(g *Governor) {
+		g.cpuThreshold = v
+	}
+}
+
+// SetInterval sets how often load is evaluated
+func SetInterval(v time.Duration) Option {
+	return func(g *Governor) {
+		g.interval = v
+	}
+}
+
+// SetCooldown sets how long load must remain below the recovery thresholds before
+// features are re-enabled
+func SetCooldown(v time.Duration) Option {
+	return func(g *Governor) {
+		g.cooldown = v
+	}
+}
+
+// SetRecovery sets the fraction of each threshold that load must fall under before the
+// cooldown starts.  this hysteresis prevents features from flapping near a threshold.
+func SetRecovery(v float64) Option {
+	return func(g *Governor) {
+		g.recovery = v
+	}
+}
+
+// New creates a new Governor.  Call Run to begin evaluating load.
+func New(l loggerProvider, opts ...Option) *Governor {
+	g := &Governor{
+		loggerProvider: l,
+		interval:       5 * time.Second,
+		cooldown:       30 * time.Second,
+		recovery:       0.8,
+		cpu:            newCPUSampler(),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Governor tracks request latency and process cpu, and sheds optional features when
+// either exceeds its threshold
+type Governor struct {
+	loggerProvider
+	latencyThreshold time.Duration
+	cpuThreshold     float64
+	interval         time.Duration
+	cooldown         time.Duration
+	recovery         float64
+	cpu              func() float64
+
+	mu sync.RWMutex
+	// latency totals observed since the last evaluation
+	total   time.Duration
+	samples int
+	// engaged is true while optional features are disabled
+	engaged bool
+	// calmSince is when load first fell below the recovery thresholds while engaged
+	calmSince time.Time
+}
+
+// Observe records the latency of a single request
+func (g *Governor) Observe(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.total += d
+	g.samples++
+}
+
+// Allow reports if feature f may run.  Every optional feature is shed while the governor is engaged.
+func (g *Governor) Allow(f Feature) bool {
+	if g == nil {
+		return true
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.engaged {
+		throttleShed.Inc()
+		return false
+	}
+	return true
+}
+
+// Engaged reports if the governor is currently shedding optional features
+func (g *Governor) Engaged() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.engaged
+}
+
+// Run evaluates load every interval until ctx is cancelled.  This is a blocking call.
+func (g *Governor) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			g.evaluate(ctx, now, g.cpu())
+		}
+	}
+}
+
+// evaluate compares the load observed since the last evaluation against the thresholds and
+// engages or releases the governor
+func (g *Governor) evaluate(ctx context.Context, now time.Time, cpu float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var latency time.Duration
+	if g.samples > 0 {
+		latency = g.total / time.Duration(g.samples)
+	}
+	g.total, g.samples = 0, 0
+	throttleLatency.Set(float64(latency.Milliseconds()))
+	throttleCPU.Set(cpu)
+
+	overLatency := g.latencyThreshold > 0 && latency > g.latencyThreshold
+	overCPU := g.cpuThreshold > 0 && cpu > g.cpuThreshold
+	if overLatency || overCPU {
+		g.calmSince = time.Time{}
+		if !g.engaged {
+			g.engaged = true
+			throttleEngaged.Set(1)
+			throttleEngage.Inc()
+			g.Infof(ctx, "throttle engaged, optional features disabled; latency [%v] threshold [%v], cpu [%.1f%%] threshold [%.1f%%]", latency, g.latencyThreshold, cpu, g.cpuThreshold)
+		}
+		return
+	}
+	if !g.engaged {
+		return
+	}
+	calmLatency := g.latencyThreshold == 0 || float64(latency) <= float64(g.latencyThreshold)*g.recovery
+	calmCPU := g.cpuThreshold == 0 || cpu <= g.cpuThreshold*g.recovery
+	if !calmLatency || !calmCPU {
+		g.calmSince = time.Time{}
+		return
+	}
+	if g.calmSince.IsZero() {
+		g.calmSince = now
+	}
+	if now.Sub(g.calmSince) < g.cooldown {
+		return
+	}
+	g.engaged = false
+	g.calmSince = time.Time{}
+	throttleEngaged.Set(0)
+	throttleRelease.Inc()
+	g.Infof(ctx, "throttle released, optional features re-enabled; latency [%v], cpu [%.1f%%]", latency, cpu)
+}
+
+// Handler returns a middleware handler that records the latency of next
+func (g *Governor) Handler(next tq.Handler) tq.Handler {
+	return tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		start := time.Now()
+		next.Handle(response, request)
+		g.Observe(time.Since(start))
+	})
+}
+
+// NewSecretProvider wraps sp so that every handler it provides reports its latency to g
+func (g *Governor) NewSecretProvider(sp tq.SecretProvider) tq.SecretProvider {
+	return &secretProvider{SecretProvider: sp, governor: g}
+}
+
+// secretProvider decorates the handlers returned by another SecretProvider
+type secretProvider struct {
+	tq.SecretProvider
+	governor *Governor
+}
+
+// Get implements tq.SecretProvider
+func (s *secretProvider) Get(ctx context.Context, remote net.Addr) ([]byte, tq.Handler, error) {
+	secret, handler, err := s.SecretProvider.Get(ctx, remote)
+	if handler != nil {
+		handler = s.governor.Handler(handler)
+	}
+	return secret, handler, err
+}
+
+// GetSecrets implements tq.RotatingSecretProvider, the secondary secret is nil if the wrapped
+// SecretProvider does not support one
+func (s *secretProvider) GetSecrets(ctx context.Context, remote net.Addr) ([]byte, []byte, tq.Handler, error) {
+	rp, ok := s.SecretProvider.(tq.RotatingSecretProvider)
+	if !ok {
+		secret, handler, err := s.Get(ctx, remote)
+		return secret, nil, handler, err
+	}
+	secret, secondary, handler, err := rp.GetSecrets(ctx, remote)
+	if handler != nil {
+		handler = s.governor.Handler(handler)
+	}
+	return secret, secondary, handler, err
+}
@@ -0,0 +1,78 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (nopLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (nopLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+func TestGovernor(t *testing.T) {
+	type step struct {
+		latency time.Duration
+		cpu     float64
+		engaged bool
+	}
+	tests := []struct {
+		name  string
+		opts  []Option
+		steps []step
+	}{
+		{
+			name: "latency engages and releases after cooldown",
+			opts: []Option{SetLatencyThreshold(100 * time.Millisecond), SetCooldown(2 * time.Second)},
+			steps: []step{
+				{latency: 50 * time.Millisecond, engaged: false},
+				{latency: 150 * time.Millisecond, engaged: true},
+				// above the recovery threshold, stays engaged
+				{latency: 90 * time.Millisecond, engaged: true},
+				// calm, cooldown starts
+				{latency: 10 * time.Millisecond, engaged: true},
+				{latency: 10 * time.Millisecond, engaged: true},
+				{latency: 10 * time.Millisecond, engaged: false},
+			},
+		},
+		{
+			name: "cpu engages",
+			opts: []Option{SetCPUThreshold(50), SetCooldown(0)},
+			steps: []step{
+				{cpu: 10, engaged: false},
+				{cpu: 75, engaged: true},
+				{cpu: 10, engaged: false},
+			},
+		},
+		{
+			name: "no thresholds never engage",
+			steps: []step{
+				{latency: time.Hour, cpu: 100, engaged: false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		g := New(nopLogger{}, test.opts...)
+		now := time.Now()
+		for i, s := range test.steps {
+			g.Observe(s.latency)
+			g.evaluate(context.Background(), now, s.cpu)
+			assert.Equal(t, s.engaged, g.Engaged(), fmt.Sprintf("%v: step %v", test.name, i))
+			assert.Equal(t, !s.engaged, g.Allow(PacketRecording), fmt.Sprintf("%v: step %v", test.name, i))
+			now = now.Add(time.Second)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tlsreload
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// counters
+	tlsReloadSuccess = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "tlsreload_success",
+		Help:      "number of times tls certificates were loaded from disk",
+	})
+	tlsReloadError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "tlsreload_error",
+		Help:      "number of times tls certificates failed to load from disk, the previous ones are kept",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(tlsReloadSuccess)
+	prometheus.MustRegister(tlsReloadError)
+}
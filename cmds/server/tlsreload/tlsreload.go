@@ -0,0 +1,185 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package tlsreload serves tls certificates that are reloaded from disk while the server runs, so
+// certificates may be rotated without a restart and without dropping established connections.
+package tlsreload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+}
+
+// Option sets optional behaviors on the Reloader
+type Option func(r *Reloader)
+
+// SetClientCA reloads the ca bundle used to verify client certificates from path
+func SetClientCA(path string) Option {
+	return func(r *Reloader) {
+		r.caFile = path
+	}
+}
+
+// New loads the certificate and key, and the client ca if set, returning an error if they do not
+// load.  Call Watch to reload them when they change.
+func New(l loggerProvider, certFile, keyFile string, opts ...Option) (*Reloader, error) {
+	r := &Reloader{loggerProvider: l, certFile: certFile, keyFile: keyFile, delay: time.Second}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reloader holds the current certificate and client ca.  A reload that fails keeps serving the
+// previous ones.
+type Reloader struct {
+	loggerProvider
+	certFile string
+	keyFile  string
+	caFile   string
+	// delay debounces file events, rotations often write the cert and key separately
+	delay time.Duration
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+// Reload reads the certificate, key and client ca from disk.  Nothing is swapped unless all of
+// them load.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		tlsReloadError.Inc()
+		return fmt.Errorf("unable to load certificate [%v] and key [%v]; %v", r.certFile, r.keyFile, err)
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			tlsReloadError.Inc()
+			return fmt.Errorf("unable to read client ca [%v]; %v", r.caFile, err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			tlsReloadError.Inc()
+			return fmt.Errorf("no certificates found in client ca [%v]", r.caFile)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.pool = &cert, pool
+	tlsReloadSuccess.Inc()
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Config returns a copy of base that serves the current certificate and, if a client ca is set,
+// verifies clients with the current ca.  Handshakes already completed are not affected by a reload.
+func (r *Reloader) Config(base *tls.Config) *tls.Config {
+	c := base.Clone()
+	c.GetCertificate = r.GetCertificate
+	if r.caFile == "" {
+		return c
+	}
+	// ClientCAs can only be changed per handshake by returning a whole config
+	template := c.Clone()
+	c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		hc := template.Clone()
+		hc.ClientCAs = r.pool
+		return hc, nil
+	}
+	return c
+}
+
+// Watch reloads the files when they change, or when the process receives SIGHUP, until ctx is
+// cancelled.  The directories of the files are watched, so files replaced by a rename, or by a
+// kubernetes style symlink swap, are picked up.
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher; %v", err)
+	}
+	files := map[string]bool{}
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		files[filepath.Base(f)] = true
+		if err := watcher.Add(filepath.Dir(f)); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed watching [%v]; %v", f, err)
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go r.watch(ctx, watcher, files, hup)
+	return nil
+}
+
+func (r *Reloader) watch(ctx context.Context, watcher *fsnotify.Watcher, files map[string]bool, hup chan os.Signal) {
+	defer watcher.Close()
+	defer signal.Stop(hup)
+	timer := time.NewTimer(r.delay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-watcher.Events:
+			// kubernetes mounts swap a ..data symlink rather than writing the files
+			if name := filepath.Base(ev.Name); !files[name] && !strings.HasPrefix(name, "..") {
+				continue
+			}
+			r.Debugf(ctx, "tls file changed from event %v", ev)
+			timer.Reset(r.delay)
+		case err := <-watcher.Errors:
+			r.Errorf(ctx, "error watching tls files; %v", err)
+		case <-hup:
+			r.Infof(ctx, "SIGHUP received, reloading tls certificate [%v]", r.certFile)
+			r.reload(ctx)
+		case <-timer.C:
+			r.Infof(ctx, "tls files changed, reloading tls certificate [%v]", r.certFile)
+			r.reload(ctx)
+		}
+	}
+}
+
+func (r *Reloader) reload(ctx context.Context) {
+	if err := r.Reload(); err != nil {
+		r.Errorf(ctx, "keeping the previous tls certificate; %v", err)
+	}
+}
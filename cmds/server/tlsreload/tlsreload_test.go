@@ -0,0 +1,126 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tlsreload
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (mockLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+// writeCert writes a self signed certificate with the given common name to dir
+func writeCert(t *testing.T, dir, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cert.pem"), certPem, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.pem"), certPem, 0600))
+}
+
+func commonName(t *testing.T, r *Reloader) string {
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	cert, key, ca := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	_, err := New(mockLogger{}, cert, key)
+	assert.Error(t, err)
+
+	writeCert(t, dir, "first")
+	r, err := New(mockLogger{}, cert, key, SetClientCA(ca))
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, r))
+
+	config := r.Config(&tls.Config{MinVersion: tls.VersionTLS12, ClientAuth: tls.VerifyClientCertIfGiven})
+	hc, err := config.GetConfigForClient(nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), hc.MinVersion)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, hc.ClientAuth)
+	first := hc.ClientCAs
+
+	writeCert(t, dir, "second")
+	require.NoError(t, r.Reload())
+	assert.Equal(t, "second", commonName(t, r))
+	hc, err = config.GetConfigForClient(nil)
+	require.NoError(t, err)
+	assert.False(t, first.Equal(hc.ClientCAs))
+
+	// bad files keep the previous certificate
+	require.NoError(t, os.WriteFile(key, []byte("garbage"), 0600))
+	assert.Error(t, r.Reload())
+	assert.Equal(t, "second", commonName(t, r))
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "first")
+	r, err := New(mockLogger{}, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	require.NoError(t, err)
+	r.delay = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, r.Watch(ctx))
+
+	writeCert(t, dir, "second")
+	assert.Eventually(t, func() bool { return commonName(t, r) == "second" }, 5*time.Second, 10*time.Millisecond)
+
+}
+
+func TestWatchSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "first")
+	r, err := New(mockLogger{}, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	require.NoError(t, err)
+	// file events alone never reload within the test
+	r.delay = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, r.Watch(ctx))
+
+	writeCert(t, dir, "second")
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool { return commonName(t, r) == "second" }, 5*time.Second, 10*time.Millisecond)
+}
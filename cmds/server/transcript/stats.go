@@ -0,0 +1,36 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package transcript
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	transcriptRecorded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "transcript_recorded",
+		Help:      "number of completed sessions whose transcript was recorded",
+	})
+	transcriptThrottled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "transcript_throttled",
+		Help:      "number of sessions that were not transcribed due to throttling",
+	})
+	transcriptTargets = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "transcript_targets",
+		Help:      "number of scopes and users whose sessions are recorded",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(transcriptRecorded)
+	prometheus.MustRegister(transcriptThrottled)
+	prometheus.MustRegister(transcriptTargets)
+}
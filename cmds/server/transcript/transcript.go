@@ -0,0 +1,476 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package transcript records the decoded packets of the AAA sessions of chosen scopes and users, to
+// troubleshoot interop with a vendor's devices without packet captures and manual decryption.
+// Passwords are redacted.  Transcripts are kept in a ring buffer that operators read through the
+// admin api, where recording is also turned on and off, and may be written to a log as sessions
+// complete.
+package transcript
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/throttle"
+)
+
+const (
+	// ListPath lists the recorded transcripts, newest first, and the scopes and users recorded.
+	// The scope, user and session query parameters filter the transcripts.
+	ListPath = "/v1/transcripts"
+	// EnablePath records the sessions of the scope or user query parameter
+	EnablePath = "/v1/transcripts/enable"
+	// DisablePath stops recording the sessions of the scope or user query parameter
+	DisablePath = "/v1/transcripts/disable"
+)
+
+// redacted replaces the passwords of recorded packets
+const redacted = "redacted"
+
+// sessionKey holds the session's transcript in its metadata
+const sessionKey tq.ContextKey = "transcript"
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+// sinkLogger is the destination of completed transcripts, eg a log.Logger
+type sinkLogger interface {
+	Printf(format string, args ...interface{})
+}
+
+// featureGate decides if an optional, expensive feature may run
+type featureGate interface {
+	Allow(f throttle.Feature) bool
+}
+
+// Option is used to set optional behaviors on the Recorder
+type Option func(r *Recorder)
+
+// SetScopes records the sessions of the clients of scopes
+func SetScopes(scopes ...string) Option {
+	return func(r *Recorder) {
+		for _, s := range scopes {
+			r.scopes[s] = true
+		}
+	}
+}
+
+// SetUsers records the sessions of users
+func SetUsers(users ...string) Option {
+	return func(r *Recorder) {
+		for _, u := range users {
+			r.users[u] = true
+		}
+	}
+}
+
+// SetCapacity sets how many transcripts are kept, the oldest are dropped first.  Defaults to 100.
+func SetCapacity(n int) Option {
+	return func(r *Recorder) {
+		r.capacity = n
+	}
+}
+
+// SetSink writes every completed transcript, as json, to l
+func SetSink(l sinkLogger) Option {
+	return func(r *Recorder) {
+		r.sink = l
+	}
+}
+
+// SetFeatureGate stops transcribing new sessions whenever g disallows packet recording.  Sessions
+// already transcribed are finished.
+func SetFeatureGate(g featureGate) Option {
+	return func(r *Recorder) {
+		r.gate = g
+	}
+}
+
+// New creates a Recorder
+func New(l loggerProvider, opts ...Option) *Recorder {
+	r := &Recorder{loggerProvider: l, scopes: make(map[string]bool), users: make(map[string]bool), capacity: 100, now: time.Now}
+	for _, opt := range opts {
+		opt(r)
+	}
+	transcriptTargets.Set(float64(len(r.scopes) + len(r.users)))
+	return r
+}
+
+// Recorder records the sessions of its scopes and users, see Middleware
+type Recorder struct {
+	loggerProvider
+	sink     sinkLogger
+	gate     featureGate
+	capacity int
+	now      func() time.Time
+
+	mu     sync.RWMutex
+	scopes map[string]bool
+	users  map[string]bool
+	// ring holds the recorded sessions, next is where the next one is stored
+	ring []*session
+	next int
+}
+
+// Transcript is the record of a session
+type Transcript struct {
+	SessionID string `json:"session_id"`
+	// Client is the address of the device
+	Client string    `json:"client,omitempty"`
+	Scope  string    `json:"scope,omitempty"`
+	User   string    `json:"user,omitempty"`
+	Start  time.Time `json:"start"`
+	// End is unset while the session is in progress
+	End     *time.Time `json:"end,omitempty"`
+	Packets []Packet   `json:"packets"`
+}
+
+// Packet is a decoded packet of a Transcript
+type Packet struct {
+	Time time.Time `json:"time"`
+	// Direction is request for the packets of the client, and reply for those of the server
+	Direction string            `json:"direction"`
+	Fields    map[string]string `json:"fields"`
+}
+
+// session is the transcript of a session in progress.  Every session is transcribed until it is
+// known whether its scope or user is recorded, as the user of an ascii login comes after its first
+// packet; the transcripts of the others are dropped.
+type session struct {
+	Transcript
+	recorded bool
+	// status is the status of the last authentication reply, to tell usernames from passwords in
+	// the continue packets answering it
+	status tq.AuthenStatus
+}
+
+// Middleware records the packets of the sessions of the Recorder's scopes and users.  Set it on
+// the server with tq.SetMiddleware.  Sessions are not transcribed while nothing is recorded.
+func (r *Recorder) Middleware(next tq.Handler) tq.Handler {
+	return tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		if !r.enabled() {
+			next.Handle(response, request)
+			return
+		}
+		s := r.session(request)
+		if s == nil {
+			next.Handle(response, request)
+			return
+		}
+		r.request(s, request)
+		w := &recordingResponse{Response: response, r: r, s: s, request: request}
+		if c, ok := response.(tq.SessionCloser); ok {
+			next.Handle(&closingRecordingResponse{recordingResponse: w, closer: c}, request)
+			return
+		}
+		next.Handle(w, request)
+	})
+}
+
+// enabled reports if any scope or user is recorded
+func (r *Recorder) enabled() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.scopes) > 0 || len(r.users) > 0
+}
+
+// session returns the transcript of the request's session, started by its first packet, nil if the
+// governor disallows starting one
+func (r *Recorder) session(request tq.Request) *session {
+	m := request.Metadata()
+	if v, ok := m.Get(sessionKey); ok {
+		if s, ok := v.(*session); ok {
+			return s
+		}
+	}
+	if r.gate != nil && !r.gate.Allow(throttle.PacketRecording) {
+		transcriptThrottled.Inc()
+		return nil
+	}
+	client, _ := request.Context.Value(tq.ContextConnRemoteAddr).(string)
+	s := &session{Transcript: Transcript{SessionID: request.Header.SessionID.String(), Client: client, Start: r.now()}}
+	m.Set(sessionKey, s)
+	return s
+}
+
+// request adds the packet of request to s
+func (r *Recorder) request(s *session, request tq.Request) {
+	fields, user := decode(request, s.status)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user != "" {
+		s.User = user
+	}
+	s.Packets = append(s.Packets, Packet{Time: r.now(), Direction: "request", Fields: fields})
+}
+
+// reply adds the reply to s
+func (r *Recorder) reply(s *session, request tq.Request, v tq.EncoderDecoder) {
+	fields := map[string]string{}
+	if f, ok := v.(interface{ Fields() map[string]string }); ok {
+		fields = f.Fields()
+	}
+	final := true
+	if reply, ok := v.(*tq.AuthenReply); ok {
+		switch reply.Status {
+		case tq.AuthenStatusGetData, tq.AuthenStatusGetUser, tq.AuthenStatusGetPass:
+			final = false
+		}
+		r.mu.Lock()
+		s.status = reply.Status
+		r.mu.Unlock()
+	}
+	r.add(s, request, fields, final)
+}
+
+// add adds a reply's fields to s, and completes s if the reply ends the session.  The scope is
+// known by now, as the handler serving the first packet sets it in the session metadata.
+func (r *Recorder) add(s *session, request tq.Request, fields map[string]string, final bool) {
+	m := request.Metadata()
+	scope, _ := m.String(tq.ContextScope)
+	user, _ := m.String(tq.ContextUser)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s.Packets = append(s.Packets, Packet{Time: r.now(), Direction: "reply", Fields: fields})
+	if s.User == "" {
+		s.User = user
+	}
+	if !s.recorded && (r.scopes[scope] || r.users[s.User]) {
+		s.Scope, s.recorded = scope, true
+		r.push(s)
+	}
+	if !final {
+		return
+	}
+	m.Delete(sessionKey)
+	end := r.now()
+	s.End = &end
+	if !s.recorded {
+		return
+	}
+	transcriptRecorded.Inc()
+	if r.sink != nil {
+		b, err := json.Marshal(s.Transcript)
+		if err != nil {
+			r.Errorf(request.Context, "unable to marshal the transcript of session [%v]; %v", s.SessionID, err)
+			return
+		}
+		r.sink.Printf("%s", b)
+	}
+}
+
+// push stores s in the ring, replacing the oldest transcript if it is full.  The caller must hold
+// the lock.
+func (r *Recorder) push(s *session) {
+	if r.capacity < 1 {
+		return
+	}
+	if len(r.ring) < r.capacity {
+		r.ring = append(r.ring, s)
+		r.next = len(r.ring) % r.capacity
+		return
+	}
+	r.ring[r.next] = s
+	r.next = (r.next + 1) % r.capacity
+}
+
+// recordingResponse records the replies to a packet
+type recordingResponse struct {
+	tq.Response
+	r       *Recorder
+	s       *session
+	request tq.Request
+}
+
+// Reply implements tq.Response
+func (w *recordingResponse) Reply(v tq.EncoderDecoder) (int, error) {
+	w.r.reply(w.s, w.request, v)
+	return w.Response.Reply(v)
+}
+
+// ReplyWithContext implements tq.Response
+func (w *recordingResponse) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writers ...tq.Writer) (int, error) {
+	w.r.reply(w.s, w.request, v)
+	return w.Response.ReplyWithContext(ctx, v, writers...)
+}
+
+// closingRecordingResponse is a recordingResponse of a response that implements tq.SessionCloser
+type closingRecordingResponse struct {
+	*recordingResponse
+	closer tq.SessionCloser
+}
+
+// Close implements tq.SessionCloser
+func (w *closingRecordingResponse) Close() { w.closer.Close() }
+
+// Final implements tq.SessionCloser
+func (w *closingRecordingResponse) Final() bool { return w.closer.Final() }
+
+// Abort implements tq.SessionCloser
+func (w *closingRecordingResponse) Abort(msg string) (int, error) {
+	w.r.add(w.s, w.request, map[string]string{"packet-type": "Abort", "server-msg": msg}, true)
+	return w.closer.Abort(msg)
+}
+
+// decode returns the fields of the packet of request, with its passwords redacted, and the user it
+// names, if any.  status is the last authentication reply of the session.
+func decode(request tq.Request, status tq.AuthenStatus) (map[string]string, string) {
+	fields := request.Header.Fields()
+	delete(fields, "header-length")
+	var body interface{ Fields() map[string]string }
+	switch {
+	case request.Header.Type == tq.Authenticate && request.Header.SeqNo == 1:
+		body = &tq.AuthenStart{}
+	case request.Header.Type == tq.Authenticate:
+		body = &tq.AuthenContinue{}
+	case request.Header.Type == tq.Authorize:
+		body = &tq.AuthorRequest{}
+	case request.Header.Type == tq.Accounting:
+		body = &tq.AcctRequest{}
+	default:
+		return fields, ""
+	}
+	if err := request.Unmarshal(body.(tq.EncoderDecoder)); err != nil {
+		fields["error"] = fmt.Sprintf("unable to decode the packet; %v", err)
+		return fields, ""
+	}
+	for k, v := range body.Fields() {
+		fields[k] = v
+	}
+	user := fields["user"]
+	switch b := body.(type) {
+	case *tq.AuthenStart:
+		// pap passwords, chap responses and the like
+		if len(b.Data) > 0 {
+			fields["data"] = redacted
+		}
+	case *tq.AuthenContinue:
+		// user-msg is a password, or for a chpass, the old or new one, unless the username was asked
+		if status == tq.AuthenStatusGetUser {
+			user = string(b.UserMessage)
+		} else if len(b.UserMessage) > 0 {
+			fields["user-msg"] = redacted
+		}
+		if len(b.Data) > 0 {
+			fields["data"] = redacted
+		}
+	}
+	return fields, user
+}
+
+// Enable records the sessions of scope or user, whichever is not empty
+func (r *Recorder) Enable(scope, user string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if scope != "" {
+		r.scopes[scope] = true
+	}
+	if user != "" {
+		r.users[user] = true
+	}
+	transcriptTargets.Set(float64(len(r.scopes) + len(r.users)))
+}
+
+// Disable stops recording the sessions of scope or user, whichever is not empty.  Transcripts
+// already recorded are kept.
+func (r *Recorder) Disable(scope, user string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.scopes, scope)
+	delete(r.users, user)
+	transcriptTargets.Set(float64(len(r.scopes) + len(r.users)))
+}
+
+// Listing is the response of ListPath
+type Listing struct {
+	Scopes      []string     `json:"scopes"`
+	Users       []string     `json:"users"`
+	Transcripts []Transcript `json:"transcripts"`
+}
+
+// List returns the recorded scopes and users, and copies of the transcripts matching the filters
+// that are not empty, newest first
+func (r *Recorder) List(scope, user, sessionID string) Listing {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	l := Listing{Scopes: keys(r.scopes), Users: keys(r.users), Transcripts: []Transcript{}}
+	for i := 1; i <= len(r.ring); i++ {
+		s := r.ring[(r.next-i+len(r.ring))%len(r.ring)]
+		if (scope != "" && s.Scope != scope) || (user != "" && s.User != user) || (sessionID != "" && s.SessionID != sessionID) {
+			continue
+		}
+		t := s.Transcript
+		t.Packets = append([]Packet(nil), s.Packets...)
+		l.Transcripts = append(l.Transcripts, t)
+	}
+	return l
+}
+
+// keys returns the keys of m, sorted
+func keys(m map[string]bool) []string {
+	k := make([]string, 0, len(m))
+	for v := range m {
+		k = append(k, v)
+	}
+	sort.Strings(k)
+	return k
+}
+
+// ServeList writes the Listing of the scope, user and session query parameters as json
+func (r *Recorder) ServeList(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.List(q.Get("scope"), q.Get("user"), q.Get("session")))
+}
+
+// ServeEnable records the sessions of the scope or user query parameter
+func (r *Recorder) ServeEnable(w http.ResponseWriter, req *http.Request) {
+	scope, user, ok := targets(w, req)
+	if !ok {
+		return
+	}
+	r.Enable(scope, user)
+	r.Infof(req.Context(), "transcripts of scope [%v] user [%v] enabled by the admin api", scope, user)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeDisable stops recording the sessions of the scope or user query parameter
+func (r *Recorder) ServeDisable(w http.ResponseWriter, req *http.Request) {
+	scope, user, ok := targets(w, req)
+	if !ok {
+		return
+	}
+	r.Disable(scope, user)
+	r.Infof(req.Context(), "transcripts of scope [%v] user [%v] disabled by the admin api", scope, user)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// targets returns the scope and user query parameters of a POST, at least one of which is required
+func targets(w http.ResponseWriter, req *http.Request) (string, string, bool) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return "", "", false
+	}
+	q := req.URL.Query()
+	scope, user := q.Get("scope"), q.Get("user")
+	if scope == "" && user == "" {
+		http.Error(w, "a scope or user query parameter is required", http.StatusBadRequest)
+		return "", "", false
+	}
+	return scope, user, true
+}
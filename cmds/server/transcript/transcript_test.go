@@ -0,0 +1,171 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package transcript
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/throttle"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})  {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+
+// mockSink collects the transcripts written to it
+type mockSink struct {
+	lines []string
+}
+
+func (s *mockSink) Printf(format string, args ...interface{}) {
+	s.lines = append(s.lines, fmt.Sprintf(format, args...))
+}
+
+// mockResponse discards replies
+type mockResponse struct {
+	tq.Response
+}
+
+func (mockResponse) Reply(v tq.EncoderDecoder) (int, error) { return 0, nil }
+
+// client sends the packets of one session through h, sharing its metadata as a server would
+type client struct {
+	t        *testing.T
+	h        tq.Handler
+	id       tq.SessionID
+	metadata *tq.SessionMetadata
+	seqNo    int
+}
+
+func newClient(t *testing.T, h tq.Handler, id tq.SessionID) *client {
+	return &client{t: t, h: h, id: id, metadata: tq.NewSessionMetadata(), seqNo: 1}
+}
+
+func (s *client) send(typ tq.HeaderType, body tq.EncoderDecoder) {
+	b, err := body.MarshalBinary()
+	require.NoError(s.t, err)
+	ctx := tq.WithSessionMetadata(context.WithValue(context.Background(), tq.ContextConnRemoteAddr, "10.0.0.1"), s.metadata)
+	header := tq.NewHeader(tq.SetHeaderType(typ), tq.SetHeaderSeqNo(s.seqNo), tq.SetHeaderSessionID(s.id))
+	s.h.Handle(mockResponse{}, tq.Request{Header: *header, Body: b, Context: ctx})
+	s.seqNo += 2
+}
+
+// login answers an ascii login, asking for the username and password
+var login = tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+	status := tq.AuthenStatusPass
+	switch request.Header.SeqNo {
+	case 1:
+		status = tq.AuthenStatusGetUser
+	case 3:
+		status = tq.AuthenStatusGetPass
+	}
+	response.Reply(tq.NewAuthenReply(tq.SetAuthenReplyStatus(status)))
+})
+
+func TestRecordUser(t *testing.T) {
+	sink := &mockSink{}
+	r := New(mockLogger{}, SetUsers("alice"), SetSink(sink))
+	h := r.Middleware(login)
+	for i, user := range []string{"alice", "bob"} {
+		s := newClient(t, h, tq.SessionID(i+1))
+		s.send(tq.Authenticate, tq.NewAuthenStart(tq.SetAuthenStartAction(tq.AuthenActionLogin), tq.SetAuthenStartType(tq.AuthenTypeASCII), tq.SetAuthenStartService(tq.AuthenServiceLogin)))
+		s.send(tq.Authenticate, tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage(tq.AuthenUserMessage(user))))
+		s.send(tq.Authenticate, tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage("hunter2")))
+	}
+
+	// the username came after the first packet, which was still recorded
+	l := r.List("", "", "")
+	assert.Equal(t, []string{"alice"}, l.Users)
+	require.Len(t, l.Transcripts, 1)
+	transcript := l.Transcripts[0]
+	assert.Equal(t, "alice", transcript.User)
+	assert.Equal(t, "10.0.0.1", transcript.Client)
+	assert.NotNil(t, transcript.End)
+	require.Len(t, transcript.Packets, 6)
+	assert.Equal(t, "request", transcript.Packets[0].Direction)
+	assert.Equal(t, "AuthenStart", transcript.Packets[0].Fields["packet-type"])
+	assert.Equal(t, "alice", transcript.Packets[2].Fields["user-msg"])
+	// passwords are redacted
+	assert.Equal(t, redacted, transcript.Packets[4].Fields["user-msg"])
+	assert.Equal(t, "reply", transcript.Packets[5].Direction)
+	require.Len(t, sink.lines, 1)
+	assert.NotContains(t, sink.lines[0], "hunter2")
+}
+
+func TestRecordScope(t *testing.T) {
+	r := New(mockLogger{}, SetCapacity(2))
+	// the scope handler names the scope, as the start handler does
+	author := tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		request.Metadata().Set(tq.ContextScope, "lab")
+		response.Reply(tq.NewAuthorReply(tq.SetAuthorReplyStatus(tq.AuthorStatusPassAdd)))
+	})
+	h := r.Middleware(author)
+	authorize := func(id tq.SessionID) {
+		newClient(t, h, id).send(tq.Authorize, tq.NewAuthorRequest(tq.SetAuthorRequestUser("bob"), tq.SetAuthorRequestArgs(tq.Args{"service=shell", "cmd=show"})))
+	}
+
+	// nothing is recorded until enabled
+	authorize(1)
+	assert.Empty(t, r.List("", "", "").Transcripts)
+	r.Enable("lab", "")
+	for id := tq.SessionID(2); id <= 4; id++ {
+		authorize(id)
+	}
+	// the ring keeps the newest
+	l := r.List("lab", "", "")
+	require.Len(t, l.Transcripts, 2)
+	assert.Equal(t, tq.SessionID(4).String(), l.Transcripts[0].SessionID)
+	assert.Equal(t, tq.SessionID(3).String(), l.Transcripts[1].SessionID)
+	assert.Contains(t, l.Transcripts[0].Packets[0].Fields["args"], "cmd=show")
+	assert.Len(t, r.List("", "", tq.SessionID(3).String()).Transcripts, 1)
+	assert.Empty(t, r.List("", "alice", "").Transcripts)
+
+	r.Disable("lab", "")
+	authorize(5)
+	assert.Equal(t, tq.SessionID(4).String(), r.List("", "", "").Transcripts[0].SessionID)
+}
+
+// mockGate allows packet recording while allowed is set
+type mockGate struct {
+	allowed bool
+}
+
+func (g *mockGate) Allow(f throttle.Feature) bool { return g.allowed || f != throttle.PacketRecording }
+
+func TestRecordThrottled(t *testing.T) {
+	gate := &mockGate{allowed: true}
+	r := New(mockLogger{}, SetUsers("alice"), SetFeatureGate(gate))
+	h := r.Middleware(login)
+	start := tq.NewAuthenStart(tq.SetAuthenStartAction(tq.AuthenActionLogin), tq.SetAuthenStartType(tq.AuthenTypeASCII), tq.SetAuthenStartService(tq.AuthenServiceLogin))
+
+	// a session in progress is finished once the governor engages
+	s := newClient(t, h, 1)
+	s.send(tq.Authenticate, start)
+	gate.allowed = false
+	s.send(tq.Authenticate, tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage("alice")))
+	s.send(tq.Authenticate, tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage("hunter2")))
+
+	// but new sessions are not transcribed
+	s = newClient(t, h, 2)
+	s.send(tq.Authenticate, start)
+	s.send(tq.Authenticate, tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage("alice")))
+	s.send(tq.Authenticate, tq.NewAuthenContinue(tq.SetAuthenContinueUserMessage("hunter2")))
+
+	l := r.List("", "alice", "")
+	require.Len(t, l.Transcripts, 1)
+	assert.Equal(t, tq.SessionID(1).String(), l.Transcripts[0].SessionID)
+	assert.Len(t, l.Transcripts[0].Packets, 6)
+	assert.NotNil(t, l.Transcripts[0].End)
+}
@@ -0,0 +1,37 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+)
+
+// validate loads the config at path from source, builds it with opts and prints every problem
+// found.  It returns the exit code of the process, 1 if the config has errors.
+func validate(ctx context.Context, path string, source configSource, opts []loader.Option) int {
+	if err := source.Load(path); err != nil {
+		fmt.Printf("error: %v\n", err)
+		return 1
+	}
+	diagnostics, err := loader.Validate(ctx, <-source.Config(), opts...)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return 1
+	}
+	for _, d := range diagnostics {
+		fmt.Printf("%v: %v\n", d.Severity, d.Message)
+	}
+	if loader.HasErrors(diagnostics) {
+		return 1
+	}
+	fmt.Printf("config [%v] is valid\n", path)
+	return 0
+}
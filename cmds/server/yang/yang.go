@@ -0,0 +1,206 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package yang renders the running config as the tacacs+ client config its devices are expected
+// to have, in the json encoding of the ietf-system-tacacs-plus yang module of rfc 9105,
+// https://datatracker.ietf.org/doc/html/rfc9105.  Network wide config audit tools that consume
+// yang data can then compare each device with the scope it falls in.
+//
+// rfc 9105 models tacacs+ over tcp with a shared secret, so tls listeners, and the cert scopes
+// that are only matched over tls, are left out.  Shared secrets are always redacted.
+package yang
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+)
+
+// Path serves the export of the running config
+const Path = "/v1/yang"
+
+// redacted replaces the shared secret of every server
+const redacted = "redacted"
+
+// Server is an address devices reach tacquito at, one per listener
+type Server struct {
+	// Name is the key of the server in the yang server list
+	Name    string
+	Address string
+	Port    uint16
+	// Types are the packet types served at the address, every type if empty
+	Types []tq.HeaderType
+	// SingleConnection is set when the listener negotiates single-connect
+	SingleConnection bool
+}
+
+// Document is the export of a config, the devices of each scope being configured with Servers
+type Document struct {
+	Scopes []Scope `json:"scopes"`
+}
+
+// Scope is the expected tacacs+ config of the devices of a scope.  Name, Provider and Clients
+// identify the devices, System is their config as rfc 9105 yang data.
+type Scope struct {
+	Name string `json:"name"`
+	// Provider is prefix or dns, the type of the scope's secret provider
+	Provider string `json:"provider"`
+	// Clients are the prefixes or host patterns the scope's devices match
+	Clients []string `json:"clients,omitempty"`
+	System  System   `json:"ietf-system:system"`
+}
+
+// System is the augmentation of ietf-system by ietf-system-tacacs-plus
+type System struct {
+	TacacsPlus TacacsPlus `json:"ietf-system-tacacs-plus:tacacs-plus"`
+}
+
+// TacacsPlus is the tacacs-plus container
+type TacacsPlus struct {
+	Server []ServerEntry `json:"server"`
+}
+
+// ServerEntry is an entry of the tacacs-plus server list
+type ServerEntry struct {
+	Name string `json:"name"`
+	// ServerType is the tacacs-plus-server-type bits, space separated as rfc 7951 encodes bits
+	ServerType   string `json:"server-type"`
+	Address      string `json:"address"`
+	Port         uint16 `json:"port"`
+	SharedSecret string `json:"shared-secret"`
+	// SourceIP is set for scopes of a single host, the address it connects from
+	SourceIP         string `json:"source-ip,omitempty"`
+	SingleConnection bool   `json:"single-connection"`
+}
+
+// Export renders c as the config of the devices of each of its scopes, configured with servers.
+// Scopes are sorted by name.
+func Export(c config.ServerConfig, servers []Server) Document {
+	d := Document{Scopes: []Scope{}}
+	for _, sc := range c.Secrets {
+		var provider string
+		var clients []string
+		switch sc.Type {
+		case config.PREFIX:
+			provider, clients = "prefix", prefixes(sc.Options)
+		case config.DNS:
+			provider, clients = "dns", jsonList(sc.Options["hosts"])
+		default:
+			continue
+		}
+		scope := Scope{Name: sc.Name, Provider: provider, Clients: clients}
+		scope.System.TacacsPlus.Server = make([]ServerEntry, 0, len(servers))
+		source := sourceIP(sc.Type, clients)
+		for _, s := range servers {
+			scope.System.TacacsPlus.Server = append(scope.System.TacacsPlus.Server, ServerEntry{
+				Name:             s.Name,
+				ServerType:       serverType(s.Types),
+				Address:          s.Address,
+				Port:             s.Port,
+				SharedSecret:     redacted,
+				SourceIP:         source,
+				SingleConnection: s.SingleConnection,
+			})
+		}
+		d.Scopes = append(d.Scopes, scope)
+	}
+	sort.SliceStable(d.Scopes, func(i, j int) bool { return d.Scopes[i].Name < d.Scopes[j].Name })
+	return d
+}
+
+// prefixes returns the untagged and device group prefixes of the options of a prefix scope
+func prefixes(options map[string]string) []string {
+	clients := jsonList(options["prefixes"])
+	var groups map[string][]string
+	if err := json.Unmarshal([]byte(options["groups"]), &groups); err == nil {
+		for _, prefixes := range groups {
+			clients = append(clients, prefixes...)
+		}
+	}
+	sort.Strings(clients)
+	return clients
+}
+
+// jsonList decodes a json list of strings, nil if it is not one
+func jsonList(raw string) []string {
+	var list []string
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil
+	}
+	return list
+}
+
+// sourceIP is the address a scope's device connects from, if the scope matches a single host
+func sourceIP(t config.ProviderType, clients []string) string {
+	if t != config.PREFIX || len(clients) != 1 {
+		return ""
+	}
+	ip, ipNet, err := net.ParseCIDR(clients[0])
+	if err != nil {
+		return ""
+	}
+	if ones, bits := ipNet.Mask.Size(); ones != bits {
+		return ""
+	}
+	return ip.String()
+}
+
+// serverType encodes types as tacacs-plus-server-type bits
+func serverType(types []tq.HeaderType) string {
+	serves := func(t tq.HeaderType) bool {
+		if len(types) == 0 {
+			return true
+		}
+		for _, v := range types {
+			if v == t {
+				return true
+			}
+		}
+		return false
+	}
+	var bits []string
+	for _, b := range []struct {
+		t    tq.HeaderType
+		name string
+	}{{tq.Authenticate, "authentication"}, {tq.Authorize, "authorization"}, {tq.Accounting, "accounting"}} {
+		if serves(b.t) {
+			bits = append(bits, b.name)
+		}
+	}
+	return strings.Join(bits, " ")
+}
+
+// snapshotter returns the running config, *loader.Loader implements it
+type snapshotter interface {
+	Snapshot(ctx context.Context) (loader.Snapshot, error)
+}
+
+// NewHandler serves the export of the config held by s, devices being configured with servers
+func NewHandler(s snapshotter, servers []Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		snapshot, err := s.Snapshot(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yang-data+json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(Export(snapshot.Config, servers))
+	})
+}
@@ -0,0 +1,119 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package yang
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() config.ServerConfig {
+	return config.ServerConfig{Secrets: []config.SecretConfig{
+		{
+			Name:    "lab",
+			Secret:  config.Keychain{Group: "tacquito", Key: "fooman"},
+			Handler: config.Handler{Type: config.START},
+			Type:    config.PREFIX,
+			Options: map[string]string{"prefixes": `["10.1.1.1/32"]`},
+		},
+		{
+			Name:    "core",
+			Secret:  config.Keychain{Group: "tacquito", Key: "core"},
+			Handler: config.Handler{Type: config.START},
+			Type:    config.PREFIX,
+			Options: map[string]string{"prefixes": `["10.2.0.0/16"]`, "groups": `{"edge": ["10.3.0.0/16"]}`},
+		},
+		{
+			Name:    "hosts",
+			Secret:  config.Keychain{Group: "tacquito", Key: "hosts"},
+			Handler: config.Handler{Type: config.START},
+			Type:    config.DNS,
+			Options: map[string]string{"hosts": `["*.example.com"]`},
+		},
+		{
+			Name:    "certs",
+			Secret:  config.Keychain{Group: "tacquito", Key: "certs"},
+			Handler: config.Handler{Type: config.START},
+			Type:    config.CERT,
+			Options: map[string]string{"dns": `["*.example.com"]`},
+		},
+	}}
+}
+
+var testServers = []Server{
+	{Name: "tacquito-default", Address: "tacacs.example.com", Port: 49},
+	{Name: "tacquito-accounting", Address: "tacacs.example.com", Port: 4949, Types: []tq.HeaderType{tq.Accounting}, SingleConnection: true},
+}
+
+func TestExport(t *testing.T) {
+	d := Export(testConfig(), testServers)
+	require.Len(t, d.Scopes, 3, "cert scopes are left out")
+	assert.Equal(t, []string{"core", "hosts", "lab"}, []string{d.Scopes[0].Name, d.Scopes[1].Name, d.Scopes[2].Name})
+
+	core := d.Scopes[0]
+	assert.Equal(t, "prefix", core.Provider)
+	assert.Equal(t, []string{"10.2.0.0/16", "10.3.0.0/16"}, core.Clients)
+	assert.Equal(t, []ServerEntry{
+		{Name: "tacquito-default", ServerType: "authentication authorization accounting", Address: "tacacs.example.com", Port: 49, SharedSecret: "redacted"},
+		{Name: "tacquito-accounting", ServerType: "accounting", Address: "tacacs.example.com", Port: 4949, SharedSecret: "redacted", SingleConnection: true},
+	}, core.System.TacacsPlus.Server)
+
+	assert.Equal(t, "dns", d.Scopes[1].Provider)
+	assert.Equal(t, []string{"*.example.com"}, d.Scopes[1].Clients)
+	assert.Empty(t, d.Scopes[1].System.TacacsPlus.Server[0].SourceIP)
+
+	// a scope of a single host is the source of its device
+	assert.Equal(t, "10.1.1.1", d.Scopes[2].System.TacacsPlus.Server[0].SourceIP)
+
+	// the json is encoded as rfc 7951 yang data, and never carries a secret
+	b, err := json.Marshal(d)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"ietf-system:system":{"ietf-system-tacacs-plus:tacacs-plus":{"server":[`)
+	assert.NotContains(t, string(b), "fooman")
+
+	assert.Equal(t, Document{Scopes: []Scope{}}, Export(config.ServerConfig{}, testServers))
+}
+
+type fakeSnapshotter struct {
+	config config.ServerConfig
+	err    error
+}
+
+func (f fakeSnapshotter) Snapshot(ctx context.Context) (loader.Snapshot, error) {
+	return loader.Snapshot{Config: f.config}, f.err
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(fakeSnapshotter{config: testConfig()}, testServers)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, Path, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/yang-data+json", w.Header().Get("Content-Type"))
+	var d Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &d))
+	assert.Equal(t, Export(testConfig(), testServers), d)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, Path, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httptest.NewRecorder()
+	NewHandler(fakeSnapshotter{err: errors.New("loader is stopped")}, testServers).ServeHTTP(w, httptest.NewRequest(http.MethodGet, Path, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,63 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main provides a live terminal view of a running tacquito server, built from
+// the server's prometheus metrics endpoint.  It is intended for on-call triage when
+// dashboards are not available.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+var (
+	address  = flag.String("address", "http://localhost:8080/metrics", "the metrics endpoint of the tacquito server to monitor")
+	interval = flag.Duration("interval", 2*time.Second, "how often the metrics endpoint is scraped")
+	denials  = flag.Int("denials", 10, "the number of recent denial events to display")
+	once     = flag.Bool("once", false, "scrape twice, print a single frame and exit; useful for scripting")
+)
+
+func main() {
+	flag.Parse()
+	if *interval <= 0 {
+		fmt.Println("interval must be greater than zero")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	s := newScraper(*address)
+	v := newView(*denials)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	frames := 0
+	for {
+		snap, err := s.scrape(ctx)
+		v.update(snap, err)
+		frames++
+		if *once {
+			if frames > 1 {
+				v.render(os.Stdout, false)
+				return
+			}
+		} else {
+			v.render(os.Stdout, true)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
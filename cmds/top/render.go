@@ -0,0 +1,179 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// exact matches a single metric name, after the tacquito_ namespace is removed
+func exact(name string) func(string) bool {
+	return func(n string) bool { return n == name }
+}
+
+// suffix matches any metric name ending in s
+func suffix(s string) func(string) bool {
+	return func(n string) bool { return strings.HasSuffix(n, s) }
+}
+
+// denialSources are the counters that represent a client being refused something.
+// increments between scrapes are recorded as denial events.
+var denialSources = []struct {
+	name  string
+	match func(string) bool
+}{
+	{name: "authentication failure", match: exact("response_authen_fail")},
+	{name: "authorization failure", match: exact("response_author_fail")},
+	{name: "accounting error", match: exact("response_acct_error")},
+	{name: "bad secret", match: exact("crypter_badSecret")},
+	{name: "unknown device", match: exact("loader_get_secret_unknown")},
+	{name: "prefix denied", match: exact("prefixFilter_denied")},
+}
+
+// denial is a single observed increase in a denial counter
+type denial struct {
+	at    time.Time
+	kind  string
+	count float64
+}
+
+// view holds the state needed to render frames
+type view struct {
+	prev, cur *snapshot
+	err       error
+	denials   []denial
+	keep      int
+}
+
+func newView(keep int) *view {
+	return &view{keep: keep}
+}
+
+// update advances the view with the latest scrape
+func (v *view) update(snap *snapshot, err error) {
+	v.err = err
+	if err != nil {
+		return
+	}
+	v.prev, v.cur = v.cur, snap
+	if v.prev == nil {
+		return
+	}
+	for _, src := range denialSources {
+		if delta := v.cur.sum(src.match) - v.prev.sum(src.match); delta > 0 {
+			v.denials = append(v.denials, denial{at: v.cur.at, kind: src.name, count: delta})
+		}
+	}
+	if len(v.denials) > v.keep {
+		v.denials = v.denials[len(v.denials)-v.keep:]
+	}
+}
+
+// rate returns the per second increase of the matched counters between the last two scrapes
+func (v *view) rate(match func(string) bool) float64 {
+	if v.prev == nil || v.cur == nil {
+		return 0
+	}
+	elapsed := v.cur.at.Sub(v.prev.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	delta := v.cur.sum(match) - v.prev.sum(match)
+	if delta < 0 {
+		// counter reset, the server restarted between scrapes
+		return 0
+	}
+	return delta / elapsed
+}
+
+// render writes a single frame to w
+func (v *view) render(w io.Writer, clear bool) {
+	if clear {
+		fmt.Fprint(w, clearScreen)
+	}
+	fmt.Fprintf(w, "tacquito top - %v - %v\n\n", *address, time.Now().Format(time.RFC1123))
+	if v.err != nil {
+		fmt.Fprintf(w, "scrape error: %v\n\n", v.err)
+	}
+	if v.cur == nil {
+		fmt.Fprintln(w, "waiting for metrics...")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONNECTIONS\t\t")
+	fmt.Fprintf(tw, "  open connections\t%.0f\t\n", v.cur.sum(exact("serve_accepted")))
+	fmt.Fprintf(tw, "  active handlers\t%.0f\t\n", v.cur.sum(exact("handle_handlers")))
+	fmt.Fprintf(tw, "  active sessions\t%.0f\t\n", v.cur.sum(exact("sessions_active")))
+	fmt.Fprintf(tw, "  packets/s\t%.2f\t\n", v.rate(exact("crypter_read")))
+	fmt.Fprintln(tw, "\t\t")
+
+	fmt.Fprintln(tw, "AAA\ttotal\trate/s")
+	for _, row := range []struct {
+		name  string
+		match func(string) bool
+	}{
+		{name: "authentication pass", match: exact("response_authen_pass")},
+		{name: "authentication fail", match: exact("response_authen_fail")},
+		{name: "authorization pass", match: exact("response_author_pass")},
+		{name: "authorization fail", match: exact("response_author_fail")},
+		{name: "accounting success", match: exact("response_acct_success")},
+		{name: "accounting error", match: exact("response_acct_error")},
+	} {
+		fmt.Fprintf(tw, "  %v\t%.0f\t%.2f\n", row.name, v.cur.sum(row.match), v.rate(row.match))
+	}
+	fmt.Fprintln(tw, "\t\t")
+	tw.Flush()
+
+	v.renderScopes(w)
+	v.renderDenials(w)
+}
+
+// renderScopes shows totals for any metrics that carry a scope label
+func (v *view) renderScopes(w io.Writer) {
+	fmt.Fprintln(w, "SESSIONS PER SCOPE")
+	scopes := v.cur.byLabel("scope", suffix("sessions_active"))
+	if len(scopes) == 0 {
+		fmt.Fprintf(w, "  no scope labeled session metrics exported\n\n")
+		return
+	}
+	names := make([]string, 0, len(scopes))
+	for name := range scopes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %v\t%.0f\t\n", name, scopes[name])
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// renderDenials shows the most recent denial events, newest first
+func (v *view) renderDenials(w io.Writer) {
+	fmt.Fprintln(w, "RECENT DENIALS")
+	if len(v.denials) == 0 {
+		fmt.Fprintln(w, "  none observed")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i := len(v.denials) - 1; i >= 0; i-- {
+		d := v.denials[i]
+		fmt.Fprintf(tw, "  %v\t%v\t+%.0f\n", d.at.Format("15:04:05"), d.kind, d.count)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,120 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// snap builds a snapshot at the given second from name value pairs
+func snap(at int, values map[string]float64) *snapshot {
+	s := &snapshot{at: time.Unix(int64(at), 0), samples: map[string]sample{}}
+	for name, v := range values {
+		s.samples[name] = sample{name: name, value: v}
+	}
+	return s
+}
+
+func TestViewDenials(t *testing.T) {
+	tests := []struct {
+		name  string
+		snaps []*snapshot
+		want  []denial
+	}{
+		{
+			name:  "the first scrape has nothing to compare with",
+			snaps: []*snapshot{snap(0, map[string]float64{"response_authen_fail": 5})},
+		},
+		{
+			name: "increases are denials",
+			snaps: []*snapshot{
+				snap(0, map[string]float64{"response_authen_fail": 5, "crypter_badSecret": 1}),
+				snap(1, map[string]float64{"response_authen_fail": 7, "crypter_badSecret": 1, "prefixFilter_denied": 3}),
+			},
+			want: []denial{
+				{at: time.Unix(1, 0), kind: "authentication failure", count: 2},
+				{at: time.Unix(1, 0), kind: "prefix denied", count: 3},
+			},
+		},
+		{
+			name: "counter resets are not denials",
+			snaps: []*snapshot{
+				snap(0, map[string]float64{"response_author_fail": 9}),
+				snap(1, map[string]float64{"response_author_fail": 1}),
+			},
+		},
+		{
+			name: "only the newest are kept",
+			snaps: []*snapshot{
+				snap(0, nil),
+				snap(1, map[string]float64{"response_acct_error": 1}),
+				snap(2, map[string]float64{"response_acct_error": 2}),
+				snap(3, map[string]float64{"response_acct_error": 3, "loader_get_secret_unknown": 1}),
+			},
+			want: []denial{
+				{at: time.Unix(3, 0), kind: "accounting error", count: 1},
+				{at: time.Unix(3, 0), kind: "unknown device", count: 1},
+			},
+		},
+	}
+	for _, test := range tests {
+		v := newView(2)
+		for _, s := range test.snaps {
+			v.update(s, nil)
+		}
+		assert.Equal(t, test.want, v.denials, test.name)
+	}
+}
+
+func TestViewRate(t *testing.T) {
+	v := newView(10)
+	assert.Equal(t, float64(0), v.rate(exact("crypter_read")))
+	v.update(snap(0, map[string]float64{"crypter_read": 10}), nil)
+	assert.Equal(t, float64(0), v.rate(exact("crypter_read")), "a single scrape has no rate")
+	v.update(snap(4, map[string]float64{"crypter_read": 30}), nil)
+	assert.Equal(t, float64(5), v.rate(exact("crypter_read")))
+	v.update(snap(5, map[string]float64{"crypter_read": 2}), nil)
+	assert.Equal(t, float64(0), v.rate(exact("crypter_read")), "counter reset")
+
+	// a failed scrape keeps the previous snapshots
+	v.update(nil, errors.New("connection refused"))
+	assert.Equal(t, time.Unix(5, 0), v.cur.at)
+}
+
+func TestViewRender(t *testing.T) {
+	var out bytes.Buffer
+	v := newView(10)
+	v.render(&out, false)
+	assert.Contains(t, out.String(), "waiting for metrics...")
+
+	v.update(snap(0, map[string]float64{"response_authen_pass": 1, "response_authen_fail": 1}), nil)
+	s := snap(2, map[string]float64{"response_authen_pass": 5, "response_authen_fail": 2, "serve_accepted": 3})
+	s.samples[`scope_sessions_active{scope="routers"}`] = sample{name: "scope_sessions_active", labels: map[string]string{"scope": "routers"}, value: 4}
+	v.update(s, nil)
+	v.update(nil, errors.New("timeout"))
+
+	out.Reset()
+	v.render(&out, true)
+	frame := out.String()
+	assert.True(t, bytes.HasPrefix(out.Bytes(), []byte(clearScreen)))
+	assert.Contains(t, frame, "scrape error: timeout")
+	assert.Regexp(t, `open connections\s+3`, frame)
+	assert.Regexp(t, `authentication pass\s+5\s+2.00`, frame)
+	assert.Regexp(t, `authentication fail\s+2\s+0.50`, frame)
+	assert.Regexp(t, `routers\s+4`, frame)
+	assert.Regexp(t, `\d\d:\d\d:\d\d\s+authentication failure\s+\+1`, frame)
+
+	out.Reset()
+	newView(10).renderDenials(&out)
+	assert.Contains(t, out.String(), "none observed")
+}
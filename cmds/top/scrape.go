@@ -0,0 +1,145 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// sample is a single metric value, identified by its name and labels
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// key uniquely identifies a sample across scrapes
+func (s sample) key() string {
+	if len(s.labels) == 0 {
+		return s.name
+	}
+	pairs := make([]string, 0, len(s.labels))
+	for k, v := range s.labels {
+		pairs = append(pairs, fmt.Sprintf("%v=%q", k, v))
+	}
+	sort.Strings(pairs)
+	return fmt.Sprintf("%v{%v}", s.name, strings.Join(pairs, ","))
+}
+
+// snapshot holds all tacquito samples from a single scrape
+type snapshot struct {
+	at      time.Time
+	samples map[string]sample
+}
+
+// sum will add all samples whose name matches fn
+func (s *snapshot) sum(fn func(name string) bool) float64 {
+	var total float64
+	if s == nil {
+		return total
+	}
+	for _, v := range s.samples {
+		if fn(v.name) {
+			total += v.value
+		}
+	}
+	return total
+}
+
+// byLabel will sum all samples whose name matches fn, grouped by the value of label
+func (s *snapshot) byLabel(label string, fn func(name string) bool) map[string]float64 {
+	grouped := make(map[string]float64)
+	if s == nil {
+		return grouped
+	}
+	for _, v := range s.samples {
+		lv, ok := v.labels[label]
+		if !ok || !fn(v.name) {
+			continue
+		}
+		grouped[lv] += v.value
+	}
+	return grouped
+}
+
+// scraper fetches and decodes the prometheus text exposition format
+type scraper struct {
+	address string
+	client  *http.Client
+}
+
+func newScraper(address string) *scraper {
+	return &scraper{address: address, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// scrape fetches the metrics endpoint and keeps only tacquito samples
+func (s *scraper) scrape(ctx context.Context) (*snapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.address, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status from [%v]: %v", s.address, resp.Status)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse metrics from [%v]; %v", s.address, err)
+	}
+	snap := &snapshot{at: time.Now(), samples: make(map[string]sample)}
+	for name, family := range families {
+		if !strings.HasPrefix(name, "tacquito_") {
+			continue
+		}
+		name = strings.TrimPrefix(name, "tacquito_")
+		for _, m := range family.GetMetric() {
+			v, ok := value(family.GetType(), m)
+			if !ok {
+				continue
+			}
+			labels := make(map[string]string, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			s := sample{name: name, labels: labels, value: v}
+			snap.samples[s.key()] = s
+		}
+	}
+	return snap, nil
+}
+
+// value extracts a single float from the supported metric types.  summaries and
+// histograms are reduced to their observation count.
+func value(t dto.MetricType, m *dto.Metric) (float64, bool) {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return m.GetCounter().GetValue(), true
+	case dto.MetricType_GAUGE:
+		return m.GetGauge().GetValue(), true
+	case dto.MetricType_UNTYPED:
+		return m.GetUntyped().GetValue(), true
+	case dto.MetricType_SUMMARY:
+		return float64(m.GetSummary().GetSampleCount()), true
+	case dto.MetricType_HISTOGRAM:
+		return float64(m.GetHistogram().GetSampleCount()), true
+	}
+	return 0, false
+}
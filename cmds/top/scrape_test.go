@@ -0,0 +1,118 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrape(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want map[string]float64
+		err  bool
+	}{
+		{
+			name: "counters and gauges",
+			body: `# TYPE tacquito_response_authen_pass counter
+tacquito_response_authen_pass 12
+# TYPE tacquito_serve_accepted gauge
+tacquito_serve_accepted 3
+`,
+			want: map[string]float64{"response_authen_pass": 12, "serve_accepted": 3},
+		},
+		{
+			name: "labels are part of the key",
+			body: `# TYPE tacquito_scope_sessions_active gauge
+tacquito_scope_sessions_active{scope="localhost"} 2
+tacquito_scope_sessions_active{scope="routers",device="rtr1"} 5
+`,
+			want: map[string]float64{`scope_sessions_active{scope="localhost"}`: 2, `scope_sessions_active{device="rtr1",scope="routers"}`: 5},
+		},
+		{
+			name: "histograms and summaries are their observation count",
+			body: `# TYPE tacquito_handler_duration histogram
+tacquito_handler_duration_bucket{le="+Inf"} 7
+tacquito_handler_duration_sum 1.5
+tacquito_handler_duration_count 7
+# TYPE tacquito_connection_duration summary
+tacquito_connection_duration_sum 10
+tacquito_connection_duration_count 4
+`,
+			want: map[string]float64{"handler_duration": 7, "connection_duration": 4},
+		},
+		{
+			name: "other namespaces are dropped",
+			body: `# TYPE go_goroutines gauge
+go_goroutines 42
+# TYPE tacquito_crypter_read counter
+tacquito_crypter_read 9
+`,
+			want: map[string]float64{"crypter_read": 9},
+		},
+		{
+			name: "untyped",
+			body: "tacquito_loader_get_secret_unknown 1\n",
+			want: map[string]float64{"loader_get_secret_unknown": 1},
+		},
+		{name: "malformed", body: "tacquito_response_authen_pass{ 1\n", err: true},
+	}
+	for _, test := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, test.body)
+		}))
+		snap, err := newScraper(srv.URL).scrape(context.Background())
+		srv.Close()
+		if test.err {
+			assert.Error(t, err, test.name)
+			continue
+		}
+		require.NoError(t, err, test.name)
+		got := map[string]float64{}
+		for k, s := range snap.samples {
+			got[k] = s.value
+		}
+		assert.Equal(t, test.want, got, test.name)
+	}
+}
+
+func TestScrapeStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	_, err := newScraper(srv.URL).scrape(context.Background())
+	assert.Error(t, err)
+}
+
+func TestSnapshotSums(t *testing.T) {
+	snap := &snapshot{samples: map[string]sample{}}
+	for _, s := range []sample{
+		{name: "scope_sessions_active", labels: map[string]string{"scope": "a"}, value: 1},
+		{name: "scope_sessions_active", labels: map[string]string{"scope": "a", "user": "x"}, value: 2},
+		{name: "scope_sessions_active", labels: map[string]string{"scope": "b"}, value: 4},
+		{name: "sessions_active", value: 8},
+	} {
+		snap.samples[s.key()] = s
+	}
+	assert.Equal(t, float64(15), snap.sum(suffix("sessions_active")))
+	assert.Equal(t, float64(8), snap.sum(exact("sessions_active")))
+	assert.Equal(t, map[string]float64{"a": 3, "b": 4}, snap.byLabel("scope", suffix("sessions_active")))
+
+	var empty *snapshot
+	assert.Equal(t, float64(0), empty.sum(exact("sessions_active")))
+	assert.Empty(t, empty.byLabel("scope", exact("sessions_active")))
+}
@@ -0,0 +1,134 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package main evaluates an authorization request offline against a tacquito server config and
+// reports whether it would pass, and the rules that decided
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/facebookincubator/tacquito/cmds/server/loader/yaml"
+	"github.com/facebookincubator/tacquito/cmds/server/log"
+)
+
+var (
+	configPath = flag.String("config", "tacquito.yaml", "the tacquito yaml config to evaluate against")
+	user       = flag.String("user", "", "the user to authorize")
+	device     = flag.String("device", "", "the address of the device sending the request")
+	scope      = flag.String("scope", "", "evaluate in this scope whatever the device address, required for scopes not matched by prefix")
+	remAddr    = flag.String("rem-addr", "", "the address of the user, as reported by the device")
+	port       = flag.String("port", "tty0", "the port of the user, as reported by the device")
+	service    = flag.String("service", "shell", "the service requested")
+	level      = flag.Int("level", 0, "log level of the loader and authorizers, 10 error, 20 info, 30 debug")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %v -config tacquito.yaml -user name -device address [command ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	q := query{
+		user:    *user,
+		scope:   *scope,
+		remAddr: *remAddr,
+		port:    *port,
+		service: *service,
+		command: strings.Join(flag.Args(), " "),
+	}
+	if q.user == "" {
+		fmt.Fprintf(os.Stderr, "-user is required\n")
+		os.Exit(2)
+	}
+	if q.device = net.ParseIP(*device); q.device == nil {
+		if *device != "" || q.scope == "" {
+			fmt.Fprintf(os.Stderr, "invalid -device [%v], an ip address is required unless -scope is set\n", *device)
+			os.Exit(2)
+		}
+		q.device = net.IPv6loopback
+	}
+
+	y := yaml.New()
+	if err := y.Load(*configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to load [%v]; %v\n", *configPath, err)
+		os.Exit(2)
+	}
+	c, warnings, err := prepare(<-y.Config(), q)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", w)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, err := evaluate(ctx, log.New(*level, os.Stderr), c, q)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	report(os.Stdout, q, r)
+	if !r.permitted() {
+		os.Exit(1)
+	}
+}
+
+// report writes the outcome of q to w
+func report(w io.Writer, q query, r result) {
+	outcome := "fail"
+	if r.permitted() {
+		outcome = "pass"
+	}
+	fmt.Fprintf(w, "user:    %v\n", q.user)
+	fmt.Fprintf(w, "device:  %v\n", q.device)
+	if r.verdict != nil && r.verdict.Scope != "" {
+		fmt.Fprintf(w, "scope:   %v\n", r.verdict.Scope)
+	}
+	// evaluate has already rejected invalid args
+	args, _ := q.args()
+	fmt.Fprintf(w, "args:    %v\n", strings.Join(args.Args(), " "))
+	fmt.Fprintf(w, "result:  %v (%v)\n", outcome, r.status)
+	if r.verdict == nil {
+		if r.msg != "" {
+			fmt.Fprintf(w, "message: %v\n", r.msg)
+		}
+		fmt.Fprintf(w, "no stringy verdict was recorded, the user is unknown or authorized by another authorizer\n")
+		return
+	}
+	fmt.Fprintf(w, "reason:  %v\n", r.verdict.Reason)
+	if len(r.verdict.Rules) == 0 {
+		fmt.Fprintf(w, "no rule matched\n")
+		return
+	}
+	fmt.Fprintf(w, "rules:\n")
+	for _, rule := range r.verdict.Rules {
+		fmt.Fprintf(w, "  - %v", rule.Type)
+		if rule.Name != "" {
+			fmt.Fprintf(w, " [%v]", rule.Name)
+		}
+		fmt.Fprintf(w, " #%v", rule.Position)
+		if rule.Source != "" {
+			fmt.Fprintf(w, " from %v", rule.Source)
+		}
+		if rule.Pattern != "" {
+			fmt.Fprintf(w, " matching [%v]", rule.Pattern)
+		}
+		if rule.Action != "" {
+			fmt.Fprintf(w, " %v", rule.Action)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
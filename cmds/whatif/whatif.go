@@ -0,0 +1,239 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authorizers/policy"
+	"github.com/facebookincubator/tacquito/cmds/server/config/authorizers/stringy"
+	"github.com/facebookincubator/tacquito/cmds/server/config/secret/prefix"
+	"github.com/facebookincubator/tacquito/cmds/server/handlers"
+	"github.com/facebookincubator/tacquito/cmds/server/loader"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+	Record(ctx context.Context, r map[string]string, obscure ...string)
+	Set(ctx context.Context, fields map[string]string, keys ...tq.ContextKey) context.Context
+}
+
+// query is the authorization request to evaluate
+type query struct {
+	user string
+	// device is the address of the device sending the request
+	device net.IP
+	// scope, if set, evaluates the request in this scope whatever the device address
+	scope   string
+	remAddr string
+	port    string
+	service string
+	// command is the command line, eg show running-config; empty authorizes the session
+	command string
+}
+
+// args returns the av pairs a device sends for q
+func (q query) args() (tq.Args, error) {
+	service, err := tq.NewArgService(q.service)
+	if err != nil {
+		return nil, err
+	}
+	args := tq.Args{service}
+	fields := strings.Fields(q.command)
+	if len(fields) == 0 {
+		return args, nil
+	}
+	cmd, err := tq.NewArgCmd(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, cmd)
+	for _, f := range fields[1:] {
+		arg, err := tq.NewArgCmdArg(f)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// result is the outcome of a query
+type result struct {
+	status tq.AuthorStatus
+	msg    string
+	// verdict is the audit record of the stringy authorizer, nil if it did not decide, eg the user
+	// is unknown or uses another authorizer
+	verdict *stringy.Verdict
+}
+
+// permitted reports whether the request would pass
+func (r result) permitted() bool {
+	return r.status == tq.AuthorStatusPassAdd || r.status == tq.AuthorStatusPassRepl
+}
+
+// keychain returns the same secret for every scope, the secret is never used offline
+type keychain struct{}
+
+func (keychain) Add(k config.Keychain) func(context.Context, string) ([]byte, error) {
+	return func(context.Context, string) ([]byte, error) { return []byte("whatif"), nil }
+}
+
+// source serves a single config to the loader
+type source chan config.ServerConfig
+
+func (s source) Config() chan config.ServerConfig { return s }
+
+// verdicts collects the audit records written by the stringy authorizer
+type verdicts struct {
+	sync.Mutex
+	lines []string
+}
+
+func (v *verdicts) Printf(format string, args ...interface{}) {
+	v.Lock()
+	defer v.Unlock()
+	v.lines = append(v.lines, fmt.Sprintf(format, args...))
+}
+
+// last returns the last verdict recorded, nil if there is none
+func (v *verdicts) last() (*stringy.Verdict, error) {
+	v.Lock()
+	defer v.Unlock()
+	if len(v.lines) == 0 {
+		return nil, nil
+	}
+	var verdict stringy.Verdict
+	if err := json.Unmarshal([]byte(v.lines[len(v.lines)-1]), &verdict); err != nil {
+		return nil, fmt.Errorf("unable to decode verdict; %v", err)
+	}
+	return &verdict, nil
+}
+
+// everywhere are the prefixes a scope selected with -scope is served to
+var everywhere = `["0.0.0.0/0", "::/0"]`
+
+// prepare returns c ready to be served offline, and warnings about the scopes that cannot be.
+// Scopes are matched by device address with the prefix secret provider, so scopes of other types
+// can only be selected by name.  A selected scope is served to every address.
+func prepare(c config.ServerConfig, q query) (config.ServerConfig, []string, error) {
+	var warnings []string
+	var secrets []config.SecretConfig
+	for _, s := range c.Secrets {
+		if q.scope != "" && s.Name != q.scope {
+			continue
+		}
+		if s.Handler.Type == config.PROXY {
+			warnings = append(warnings, fmt.Sprintf("scope [%v] is proxied upstream and is not evaluated", s.Name))
+			continue
+		}
+		// secrets are not needed offline, nor are budgets for them
+		s.Budget, s.SecondarySecret = nil, nil
+		if q.scope != "" {
+			s.Type = config.PREFIX
+			s.Options = map[string]string{"prefixes": everywhere}
+		} else if s.Type != config.PREFIX {
+			warnings = append(warnings, fmt.Sprintf("scope [%v] is not matched by prefix and is not evaluated, select it with -scope", s.Name))
+			continue
+		}
+		secrets = append(secrets, s)
+	}
+	if q.scope != "" && len(secrets) == 0 {
+		return c, warnings, fmt.Errorf("unknown scope [%v]", q.scope)
+	}
+	c.Secrets = secrets
+	// devices are matched by the scopes alone
+	c.PrefixAllow, c.PrefixDeny = nil, nil
+	return c, warnings, nil
+}
+
+// evaluate builds c as the server would and authorizes q with it
+func evaluate(ctx context.Context, l loggerProvider, c config.ServerConfig, q query) (result, error) {
+	args, err := q.args()
+	if err != nil {
+		return result{}, err
+	}
+	audit := &verdicts{}
+	start := handlers.NewStart(l)
+	s := make(source, 1)
+	s <- c
+	sp, err := loader.NewLoader(
+		ctx,
+		s,
+		loader.SetLoggerProvider(l),
+		loader.SetKeychainProvider(keychain{}),
+		loader.SetConfigProvider(config.New()),
+		loader.SetAuthorizerProvider(stringy.New(l, stringy.SetAuditLog(audit))),
+		loader.RegisterSecretProviderType(config.PREFIX, prefix.New(l)),
+		loader.RegisterHandlerType(config.START, start),
+		// span scopes are served by the start handler, without mirroring anything
+		loader.RegisterHandlerType(config.SPAN, start),
+		loader.RegisterAuthorizer(config.POLICY, policy.New(l)),
+	)
+	if err != nil {
+		return result{}, err
+	}
+	sp.BlockUntilLoaded()
+
+	ctx = context.WithValue(ctx, tq.ContextConnRemoteAddr, q.device.String())
+	_, handler, err := sp.Get(ctx, &net.TCPAddr{IP: q.device})
+	if err != nil {
+		return result{}, fmt.Errorf("device [%v] is not served by any scope; %v", q.device, err)
+	}
+	body := tq.NewAuthorRequest(
+		tq.SetAuthorRequestMethod(tq.AuthenMethodTacacsPlus),
+		tq.SetAuthorRequestPrivLvl(tq.PrivLvlUser),
+		tq.SetAuthorRequestType(tq.AuthenTypeASCII),
+		tq.SetAuthorRequestService(tq.AuthenServiceLogin),
+		tq.SetAuthorRequestUser(tq.AuthenUser(q.user)),
+		tq.SetAuthorRequestPort(tq.AuthenPort(q.port)),
+		tq.SetAuthorRequestRemAddr(tq.AuthenRemAddr(q.remAddr)),
+		tq.SetAuthorRequestArgs(args),
+	)
+	b, err := body.MarshalBinary()
+	if err != nil {
+		return result{}, err
+	}
+	r := &response{}
+	handler.Handle(r, tq.Request{Header: *tq.NewHeader(tq.SetHeaderType(tq.Authorize)), Body: b, Context: ctx})
+	if r.reply == nil {
+		return result{}, fmt.Errorf("no reply was sent")
+	}
+	verdict, err := audit.last()
+	if err != nil {
+		return result{}, err
+	}
+	return result{status: r.reply.Status, msg: string(r.reply.ServerMsg), verdict: verdict}, nil
+}
+
+// response captures the reply of the authorizer
+type response struct {
+	reply *tq.AuthorReply
+}
+
+func (r *response) Reply(v tq.EncoderDecoder) (int, error) {
+	r.reply, _ = v.(*tq.AuthorReply)
+	return 0, nil
+}
+func (r *response) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writer ...tq.Writer) (int, error) {
+	return r.Reply(v)
+}
+func (r *response) Write(p *tq.Packet) (int, error) { return 0, nil }
+func (r *response) Next(next tq.Handler)            {}
+func (r *response) RegisterWriter(mw tq.Writer)     {}
+func (r *response) Context(ctx context.Context)     {}
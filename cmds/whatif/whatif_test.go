@@ -0,0 +1,106 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/facebookincubator/tacquito/cmds/server/config"
+	"github.com/facebookincubator/tacquito/cmds/server/loader/yaml"
+
+	tq "github.com/facebookincubator/tacquito"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogger struct{}
+
+func (mockLogger) Infof(ctx context.Context, format string, args ...interface{})      {}
+func (mockLogger) Errorf(ctx context.Context, format string, args ...interface{})     {}
+func (mockLogger) Debugf(ctx context.Context, format string, args ...interface{})     {}
+func (mockLogger) Record(ctx context.Context, r map[string]string, obscure ...string) {}
+func (mockLogger) Set(ctx context.Context, fields map[string]string, keys ...tq.ContextKey) context.Context {
+	return ctx
+}
+
+func load(t *testing.T) config.ServerConfig {
+	y := yaml.New()
+	require.NoError(t, y.Load("testdata/tacquito.yaml"))
+	return <-y.Config()
+}
+
+func whatif(t *testing.T, q query) (result, error) {
+	c, _, err := prepare(load(t), q)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	return evaluate(ctx, mockLogger{}, c, q)
+}
+
+func TestPrepare(t *testing.T) {
+	c, warnings, err := prepare(load(t), query{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"scope [dr] is not matched by prefix and is not evaluated, select it with -scope"}, warnings)
+	require.Len(t, c.Secrets, 1)
+	assert.Equal(t, "lab", c.Secrets[0].Name)
+
+	c, warnings, err = prepare(load(t), query{scope: "dr"})
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	require.Len(t, c.Secrets, 1)
+	assert.Equal(t, config.PREFIX, c.Secrets[0].Type)
+	assert.Equal(t, everywhere, c.Secrets[0].Options["prefixes"])
+
+	_, _, err = prepare(load(t), query{scope: "staging"})
+	assert.Error(t, err)
+}
+
+func TestEvaluate(t *testing.T) {
+	q := query{user: "alice", device: net.ParseIP("10.1.1.1"), service: "shell", command: "show version"}
+	r, err := whatif(t, q)
+	require.NoError(t, err)
+	assert.True(t, r.permitted())
+	require.NotNil(t, r.verdict)
+	assert.Equal(t, "lab", r.verdict.Scope)
+	require.Len(t, r.verdict.Rules, 1)
+	assert.Equal(t, "show", r.verdict.Rules[0].Name)
+	assert.Equal(t, "group [ops]", r.verdict.Rules[0].Source)
+
+	var b bytes.Buffer
+	report(&b, q, r)
+	assert.Contains(t, b.String(), "result:  pass")
+	assert.Contains(t, b.String(), "args:    service=shell cmd=show cmd-arg=version")
+
+	q.command = "configure terminal"
+	r, err = whatif(t, q)
+	require.NoError(t, err)
+	assert.False(t, r.permitted())
+	require.NotNil(t, r.verdict)
+	assert.False(t, r.verdict.Permit)
+
+	// scopes not matched by prefix are evaluated when selected, whatever the device
+	q = query{user: "alice", device: net.ParseIP("192.0.2.1"), scope: "dr", service: "shell", command: "show version"}
+	r, err = whatif(t, q)
+	require.NoError(t, err)
+	assert.True(t, r.permitted())
+	assert.Equal(t, "dr", r.verdict.Scope)
+
+	// unknown users are denied without a verdict
+	q.user = "mallory"
+	r, err = whatif(t, q)
+	require.NoError(t, err)
+	assert.False(t, r.permitted())
+	assert.Nil(t, r.verdict)
+
+	// devices outside every scope are not served
+	_, err = whatif(t, query{user: "alice", device: net.ParseIP("192.0.2.1"), service: "shell"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+// Package compat supports gradual migration between releases of the public api.  When an api
+// is replaced, the old one keeps working through an adapter in this package for at least one
+// release.  Adapters are constructed once, when a server or handler is built, and report their
+// Deprecation with Warn at that time, never per request, so the hot path pays nothing for them.
+//
+// Middleware is such an adapter: it keeps middleware whose response wrappers predate
+// tq.SessionCloser from hiding it from the handlers they wrap.
+package compat
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// loggerProvider provides the logging implementation
+type loggerProvider interface {
+	Infof(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+	Debugf(ctx context.Context, format string, args ...interface{})
+}
+
+// Deprecation describes a public api that is scheduled for removal
+type Deprecation struct {
+	// API is the deprecated symbol, eg tq.Response.Context
+	API string `json:"api"`
+	// Since is the release that deprecated API
+	Since string `json:"since"`
+	// Removal is the release that will remove API, empty if not yet scheduled
+	Removal string `json:"removal,omitempty"`
+	// Replacement is what callers should migrate to
+	Replacement string `json:"replacement"`
+}
+
+// String returns the warning logged for d
+func (d Deprecation) String() string {
+	s := fmt.Sprintf("%v is deprecated since %v", d.API, d.Since)
+	if d.Removal != "" {
+		s += fmt.Sprintf(" and will be removed in %v", d.Removal)
+	}
+	return fmt.Sprintf("%v; use %v instead", s, d.Replacement)
+}
+
+var used = struct {
+	sync.Mutex
+	set map[string]Deprecation
+}{set: make(map[string]Deprecation)}
+
+// Warn records that a deprecated api is in use.  It logs d the first time it is called for
+// d.API and counts every call.  Call it when an adapter is constructed, not when it handles a
+// request.
+func Warn(ctx context.Context, l loggerProvider, d Deprecation) {
+	compatDeprecated.WithLabelValues(d.API).Inc()
+	used.Lock()
+	_, seen := used.set[d.API]
+	used.set[d.API] = d
+	used.Unlock()
+	if !seen && l != nil {
+		l.Infof(ctx, "deprecated api in use; %v", d)
+	}
+}
+
+// Used returns every deprecation warned about by this process, sorted by API.  Operators can
+// check it before upgrading to learn which integrations still need to migrate.
+func Used() []Deprecation {
+	used.Lock()
+	defer used.Unlock()
+	d := make([]Deprecation, 0, len(used.set))
+	for _, v := range used.set {
+		d = append(d, v)
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i].API < d[j].API })
+	return d
+}
@@ -0,0 +1,46 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package compat
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type captureLogger struct {
+	infos []string
+}
+
+func (c *captureLogger) Infof(ctx context.Context, format string, args ...interface{}) {
+	c.infos = append(c.infos, fmt.Sprintf(format, args...))
+}
+func (c *captureLogger) Errorf(ctx context.Context, format string, args ...interface{}) {}
+func (c *captureLogger) Debugf(ctx context.Context, format string, args ...interface{}) {}
+
+func TestWarn(t *testing.T) {
+	old := Deprecation{API: "tq.Old", Since: "v0.6.0", Removal: "v0.8.0", Replacement: "tq.New"}
+	unscheduled := Deprecation{API: "tq.Another", Since: "v0.6.0", Replacement: "tq.Other"}
+	assert.Equal(t, "tq.Old is deprecated since v0.6.0 and will be removed in v0.8.0; use tq.New instead", old.String())
+	assert.Equal(t, "tq.Another is deprecated since v0.6.0; use tq.Other instead", unscheduled.String())
+
+	l := &captureLogger{}
+	for i := 0; i < 3; i++ {
+		Warn(context.Background(), l, old)
+	}
+	Warn(context.Background(), l, unscheduled)
+	Warn(context.Background(), nil, unscheduled)
+
+	// logged once per api, counted every time
+	assert.Equal(t, []string{"deprecated api in use; " + old.String(), "deprecated api in use; " + unscheduled.String()}, l.infos)
+	assert.Equal(t, float64(3), testutil.ToFloat64(compatDeprecated.WithLabelValues(old.API)))
+	assert.Equal(t, []Deprecation{unscheduled, old}, Used())
+}
@@ -0,0 +1,40 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package compat
+
+import (
+	"context"
+
+	tq "github.com/facebookincubator/tacquito"
+)
+
+// opaqueMiddleware is the deprecation of middleware whose response wrappers hide tq.SessionCloser
+var opaqueMiddleware = Deprecation{
+	API:         "tq.Middleware wrapping tq.Response without tq.SessionCloser",
+	Since:       "v0.6.0",
+	Replacement: "response wrappers passed on with tq.WrapResponse",
+}
+
+// Middleware adapts m, a middleware written before tq.SessionCloser whose response wrapper only
+// implements tq.Response.  The handlers after m see a response that implements SessionCloser
+// again whenever the response given to m does, so they can still end their session.  Close and
+// Final go to that response directly, as does Abort, whose reply therefore bypasses m's wrapper.
+func Middleware(ctx context.Context, l loggerProvider, m tq.Middleware) tq.Middleware {
+	Warn(ctx, l, opaqueMiddleware)
+	return func(next tq.Handler) tq.Handler {
+		return tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+			if _, ok := response.(tq.SessionCloser); !ok {
+				m(next).Handle(response, request)
+				return
+			}
+			m(tq.HandlerFunc(func(wrapped tq.Response, request tq.Request) {
+				next.Handle(tq.WrapResponse(wrapped, response), request)
+			})).Handle(response, request)
+		})
+	}
+}
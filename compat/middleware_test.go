@@ -0,0 +1,74 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package compat
+
+import (
+	"context"
+	"testing"
+
+	tq "github.com/facebookincubator/tacquito"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// plainResponse implements tq.Response only
+type plainResponse struct{}
+
+func (plainResponse) Reply(v tq.EncoderDecoder) (int, error) { return 0, nil }
+func (plainResponse) ReplyWithContext(ctx context.Context, v tq.EncoderDecoder, writers ...tq.Writer) (int, error) {
+	return 0, nil
+}
+func (plainResponse) Write(p *tq.Packet) (int, error) { return 0, nil }
+func (plainResponse) Next(next tq.Handler)            {}
+func (plainResponse) RegisterWriter(tq.Writer)        {}
+func (plainResponse) Context(ctx context.Context)     {}
+
+// serverResponse implements tq.SessionCloser as the server's responses do
+type serverResponse struct {
+	plainResponse
+	closed bool
+}
+
+func (r *serverResponse) Close()                        { r.closed = true }
+func (r *serverResponse) Abort(msg string) (int, error) { r.closed = true; return 0, nil }
+func (r *serverResponse) Final() bool                   { return r.closed }
+
+// legacy wraps the response in a type that hides tq.SessionCloser
+func legacy(next tq.Handler) tq.Handler {
+	return tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		next.Handle(struct{ tq.Response }{response}, request)
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	closing := tq.HandlerFunc(func(response tq.Response, request tq.Request) {
+		if c, ok := response.(tq.SessionCloser); ok {
+			c.Close()
+		}
+	})
+
+	// without the adapter the handler cannot close its session
+	r := &serverResponse{}
+	legacy(closing).Handle(r, tq.Request{})
+	assert.False(t, r.closed)
+
+	l := &captureLogger{}
+	adapted := Middleware(context.Background(), l, legacy)
+	r = &serverResponse{}
+	adapted(closing).Handle(r, tq.Request{})
+	assert.True(t, r.closed)
+	assert.Len(t, l.infos, 1)
+	assert.Equal(t, float64(1), testutil.ToFloat64(compatDeprecated.WithLabelValues(opaqueMiddleware.API)))
+
+	// responses that cannot close their session are passed through as is
+	var seen tq.Response
+	adapted(tq.HandlerFunc(func(response tq.Response, request tq.Request) { seen = response })).Handle(plainResponse{}, tq.Request{})
+	_, ok := seen.(tq.SessionCloser)
+	assert.False(t, ok)
+}
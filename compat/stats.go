@@ -0,0 +1,26 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package compat
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// gauges and counters
+	compatDeprecated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "compat_deprecated",
+		Help:      "number of times a deprecated api was constructed, by api",
+	}, []string{"api"})
+)
+
+func init() {
+	// gauges and counters
+	prometheus.MustRegister(compatDeprecated)
+}
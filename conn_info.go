@@ -0,0 +1,43 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// ConnectionInfo describes the transport a client connected over.  The server stores it in the
+// context passed to SecretProvider.Get and in every Request.Context on the connection, so handlers
+// and authorizers may make policy decisions on transport properties, see ConnInfo.
+type ConnectionInfo struct {
+	// RemoteAddr is the address of the peer.  When proxy headers are enabled this is the proxy's
+	// address, the header is not used to rewrite it
+	RemoteAddr net.Addr
+	// LocalAddr is the address of the listener the client connected to
+	LocalAddr net.Addr
+	// TLS is the state of a completed handshake, nil unless the client connected to a listener
+	// created with NewTLSListener.  It holds the peer certificates, verified chains, negotiated
+	// version and alpn protocol.
+	TLS *tls.ConnectionState
+}
+
+// ConnInfo returns the ConnectionInfo of the connection ctx was derived from
+func ConnInfo(ctx context.Context) (ConnectionInfo, bool) {
+	if ctx == nil {
+		return ConnectionInfo{}, false
+	}
+	info, ok := ctx.Value(ContextConnInfo).(ConnectionInfo)
+	return info, ok
+}
+
+// newConnectionInfo creates the ConnectionInfo of conn, with state set for tls connections
+func newConnectionInfo(conn net.Conn, state *tls.ConnectionState) ConnectionInfo {
+	return ConnectionInfo{RemoteAddr: conn.RemoteAddr(), LocalAddr: conn.LocalAddr(), TLS: state}
+}
@@ -13,8 +13,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net"
+	"sync"
 
 	"github.com/facebookincubator/tacquito/proxy"
 )
@@ -48,46 +50,60 @@ func crypt(secret []byte, p *Packet) error {
 	if p.Header.Flags.Has(UnencryptedFlag) {
 		return nil
 	}
-
-	sessionID, err := p.Header.SessionID.MarshalBinary()
-	if err != nil {
+	if err := p.Header.Version.Validate(nil); err != nil {
 		return err
 	}
 
-	version, err := p.Header.Version.MarshalBinary()
-	if err != nil {
-		return err
+	ps := padPool.Get().(*padState)
+	defer padPool.Put(ps)
+	// session_id, key, version and seq_no, the input every hash of the pad starts with
+	ps.prefix = append(ps.prefix[:0], 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(ps.prefix, uint32(p.Header.SessionID))
+	ps.prefix = append(ps.prefix, secret...)
+	ps.prefix = append(ps.prefix, p.Header.Version.MajorVersion<<4|p.Header.Version.MinorVersion, byte(p.Header.SeqNo))
+
+	// the pad is truncated to the length of the body, and xor'd onto it a hash at a time
+	body := p.Body
+	if int(p.Header.Length) < len(body) {
+		body = body[:p.Header.Length]
 	}
-
-	headerLen := int(p.Header.Length)
-	seqNo := []byte{byte(p.Header.SeqNo)}
-	lastHash := make([]byte, 0, 16)
-	pad := make([]byte, 0, 80)
-	h := md5.New()
-	for len(pad) < headerLen {
-		h.Reset()
-		h.Write(sessionID)
-		h.Write(secret)
-		h.Write(version)
-		h.Write(seqNo)
-		h.Write(lastHash)
-
-		lastHash = h.Sum(nil)
-
-		pad = append(pad, lastHash[:]...)
-
-		// truncate to length of body
-		if len(pad) > headerLen {
-			pad = pad[:headerLen]
+	ps.sum = ps.sum[:0]
+	for i := 0; i < len(body); i += md5.Size {
+		ps.hash.Reset()
+		ps.hash.Write(ps.prefix)
+		ps.hash.Write(ps.sum)
+		ps.sum = ps.hash.Sum(ps.sum[:0])
+		for j, b := range ps.sum {
+			if i+j == len(body) {
+				break
+			}
+			body[i+j] ^= b
 		}
 	}
-	// perform xor ops
-	for i, b := range p.Body {
-		p.Body[i] = b ^ pad[i]
-	}
 	return nil
 }
 
+// Crypt obfuscates the body of p with secret in place, or deobfuscates an obfuscated one, as the
+// pad is xor'd onto it.  Bodies flagged unencrypted are left as they are.  Clients and servers
+// crypt their packets themselves, Crypt is for tools that read packets elsewhere, eg captures.
+func Crypt(secret []byte, p *Packet) error {
+	return crypt(secret, p)
+}
+
+// padState is the scratch space crypt generates a pad with.  Every packet is crypted, so states
+// are pooled rather than allocated per packet.
+type padState struct {
+	hash   hash.Hash
+	prefix []byte
+	sum    []byte
+}
+
+var padPool = sync.Pool{
+	New: func() interface{} {
+		return &padState{hash: md5.New(), prefix: make([]byte, 0, 64), sum: make([]byte, 0, md5.Size)}
+	},
+}
+
 // newCrypter makes a new crypter
 func newCrypter(secret []byte, c net.Conn, proxy bool) *crypter {
 	return &crypter{secret: secret, Conn: c, Reader: bufio.NewReaderSize(c, 107), proxy: proxy}
@@ -104,33 +120,57 @@ type crypter struct {
 
 	// secret is the tacacs psk used in crypt ops
 	secret []byte
-	// proxy if set, will strip the ha-proxy style ascii header
+	// secondary if set, is tried when a packet does not decrypt with secret.  this allows a psk
+	// to be rotated without dropping clients that still use the previous one
+	secondary []byte
+	// proxy if set, will strip the ha-proxy style ascii or binary header
 	proxy bool
+	// maxBodyLength if set, is the longest body receive accepts, MaxBodyLength otherwise
+	maxBodyLength uint32
+	// pooled if set, reads packets into buffers borrowed from packetPool, which the reader must
+	// Release
+	pooled bool
+	// proxyHeader if set, is written before every packet.  this is the client side
+	// counterpart to proxy
+	proxyHeader []byte
+	// unencrypted if set, sets the UnencryptedFlag on every packet written, which is then not
+	// crypted.  this is client side only, servers reply with the flags of the request
+	unencrypted bool
+	// tls is set on tls connections, where obfuscation is prohibited.  every packet written
+	// carries the UnencryptedFlag, and packets read without it are refused with ErrObfuscatedTLS
+	tls bool
 }
 
 // read will read a packet from the underlying net.Conn and decyrpt it
 func (c *crypter) read() (*Packet, error) {
+	p, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	return c.decrypt(p)
+}
+
+// receive reads a crypted packet from the underlying net.Conn
+func (c *crypter) receive() (*Packet, error) {
 	// strip proxy header and record metrics
 	if c.proxy {
-		line, err := c.ReadBytes('\000') // octal null byte
-		if err != nil {
-			if err == io.EOF {
-				return nil, err
-			}
-			crypterReadError.Inc()
-			return nil, fmt.Errorf("unable to read header proxy line; %w", err)
-		}
-		p := proxy.NewHeader(c.LocalAddr(), c.RemoteAddr())
-		if _, err := p.Write(line); err != nil {
-			crypterReadError.Inc()
-			return nil, fmt.Errorf("unable to extract proxy header; %w", err)
+		if err := c.stripProxyHeader(); err != nil {
+			return nil, err
 		}
-		// TODO add metrics for reporting in next diff
 	}
 
-	// allocate a tacacs header
-	h := make([]byte, MaxHeaderLength)
+	// the server reads packets into buffers borrowed from the pool.  clients hold on to replies,
+	// so they are read into buffers sized to fit once the length is known
+	var buf *[]byte
+	if c.pooled {
+		buf = packetPool.Get().(*[]byte)
+	} else {
+		b := make([]byte, MaxHeaderLength)
+		buf = &b
+	}
+	h := (*buf)[:MaxHeaderLength]
 	if _, err := io.ReadFull(c.Reader, h); err != nil {
+		c.unborrow(buf)
 		if err != io.EOF {
 			crypterReadError.Inc()
 		}
@@ -138,24 +178,78 @@ func (c *crypter) read() (*Packet, error) {
 	}
 
 	// read the length field from the bytes of the header to know how many more bytes we need to get
-	s := int(binary.BigEndian.Uint32(h[8:]))
-	if s > int(MaxBodyLength) {
-		return nil, fmt.Errorf("max header length exceeded in crypt read, aborting")
+	s := binary.BigEndian.Uint32(h[8:])
+	limit := c.maxBodyLength
+	if limit == 0 || limit > MaxBodyLength {
+		limit = MaxBodyLength
+	}
+	if s > limit {
+		crypterBodyTooLarge.Inc()
+		defer c.unborrow(buf)
+		// bodies within the protocol maximum are dropped to keep the stream in sync, larger
+		// ones are not worth reading
+		discarded := s <= MaxBodyLength
+		if discarded {
+			if _, err := c.Discard(int(s)); err != nil {
+				crypterReadError.Inc()
+				return nil, err
+			}
+		}
+		return nil, newBodyLengthError(h, limit, discarded)
 	}
-	b := make([]byte, s)
-	if _, err := io.ReadFull(c.Reader, b); err != nil {
+	n := MaxHeaderLength + int(s)
+	if !c.pooled {
+		b := make([]byte, n)
+		copy(b, h)
+		buf = &b
+	}
+	if _, err := io.ReadFull(c.Reader, (*buf)[MaxHeaderLength:n]); err != nil {
+		c.unborrow(buf)
 		crypterReadError.Inc()
 		return nil, err
 	}
-
 	var p Packet
-	err := Unmarshal(append(h, b...), &p)
-	if err != nil {
+	if err := Unmarshal((*buf)[:n], &p); err != nil {
+		c.unborrow(buf)
 		crypterUnmarshalError.Inc()
 		return nil, err
 	}
+	if c.pooled {
+		p.buf = buf
+	}
+	return &p, nil
+}
+
+// unborrow returns buf to the pool if it was borrowed from it
+func (c *crypter) unborrow(buf *[]byte) {
+	if c.pooled {
+		packetPool.Put(buf)
+	}
+}
+
+// decrypt decrypts a packet returned by receive, replying to the client if it uses the wrong secret
+func (c *crypter) decrypt(p *Packet) (*Packet, error) {
+	if c.tls && !p.Header.Flags.Has(UnencryptedFlag) {
+		crypterObfuscatedTLS.Inc()
+		// only requests, which have odd sequence numbers, are answered
+		if p.Header.SeqNo%2 == 1 {
+			reply, err := c.errorStatusReply(p.Header, obfuscatedTLSServerMsg)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := c.write(reply); err != nil {
+				return nil, fmt.Errorf("obfuscated packet over tls, crypt write fail for ip [%s]: %v", c.RemoteAddr().String(), err)
+			}
+		}
+		return nil, fmt.Errorf("%w from ip [%s]", ErrObfuscatedTLS, c.RemoteAddr().String())
+	}
+	// keep the crypted body in case the secondary secret is needed
+	var crypted []byte
+	if c.secondary != nil {
+		crypted = append(crypted, p.Body...)
+	}
 	// run crypt first before we look for bad secrets
-	if err := crypt(c.secret, &p); err != nil {
+	if err := crypt(c.secret, p); err != nil {
 		crypterCryptError.Inc()
 		return nil, err
 	}
@@ -163,17 +257,84 @@ func (c *crypter) read() (*Packet, error) {
 	// if reply is != nil, we found a bad secret.
 	// if both are non nil, we only inspect the error as that
 	// is a higher error condition in the server than a bad secret is
-	if reply, err := c.detectBadSecret(&p); err != nil {
+	reply, err := c.detectBadSecret(p)
+	if err != nil {
 		return nil, err
-	} else if reply != nil {
+	}
+	if reply != nil && c.secondary != nil {
+		copy(p.Body, crypted)
+		if err := crypt(c.secondary, p); err != nil {
+			crypterCryptError.Inc()
+			return nil, err
+		}
+		if reply, err = c.detectBadSecret(p); err != nil {
+			return nil, err
+		}
+		if reply == nil {
+			// the client uses the secondary secret, prefer it for the rest of the connection
+			crypterSecondarySecret.Inc()
+			c.secret, c.secondary = c.secondary, c.secret
+		}
+	}
+	if reply != nil {
+		crypterBadSecret.Inc()
 		if _, err := c.write(reply); err != nil {
 			return nil, fmt.Errorf("bad secret, crypt write fail for ip [%s]: %v", c.RemoteAddr().String(), err)
 		}
-		return nil, fmt.Errorf("bad secret detected for ip [%s]", c.RemoteAddr().String())
+		return nil, fmt.Errorf("%w detected for ip [%s]", ErrBadSecret, c.RemoteAddr().String())
 	}
 
 	crypterRead.Inc()
-	return &p, nil
+	return p, nil
+}
+
+// stripProxyHeader reads and discards a v1 ascii or v2 binary proxy header
+func (c *crypter) stripProxyHeader() error {
+	signature, err := c.Peek(len(proxy.V2Signature))
+	if err != nil {
+		if err == io.EOF {
+			return err
+		}
+		crypterReadError.Inc()
+		return fmt.Errorf("unable to read header proxy line; %w", err)
+	}
+	p := proxy.NewHeader(c.LocalAddr(), c.RemoteAddr())
+	if proxy.IsV2(signature) {
+		fixed, err := c.Peek(proxy.V2HeaderLength)
+		if err != nil {
+			crypterReadError.Inc()
+			return fmt.Errorf("unable to read proxy v2 header; %w", err)
+		}
+		n, err := proxy.V2Length(fixed)
+		if err != nil {
+			crypterReadError.Inc()
+			return fmt.Errorf("unable to extract proxy header; %w", err)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(c.Reader, b); err != nil {
+			crypterReadError.Inc()
+			return fmt.Errorf("unable to read proxy v2 header; %w", err)
+		}
+		if err := p.UnmarshalV2(b); err != nil {
+			crypterReadError.Inc()
+			return fmt.Errorf("unable to extract proxy header; %w", err)
+		}
+		return nil
+	}
+	line, err := c.ReadBytes('\000') // octal null byte
+	if err != nil {
+		if err == io.EOF {
+			return err
+		}
+		crypterReadError.Inc()
+		return fmt.Errorf("unable to read header proxy line; %w", err)
+	}
+	if _, err := p.Write(line); err != nil {
+		crypterReadError.Inc()
+		return fmt.Errorf("unable to extract proxy header; %w", err)
+	}
+	// TODO add metrics for reporting in next diff
+	return nil
 }
 
 // write takes a packet, marshals and crypts it
@@ -185,6 +346,9 @@ func (c *crypter) write(p *Packet) (int, error) {
 		return 0, fmt.Errorf("handler error, packet.Body cannot be nil")
 	}
 	p.Header.Length = uint32(len(p.Body))
+	if c.unencrypted || c.tls {
+		p.Header.Flags.Set(UnencryptedFlag)
+	}
 	if err := crypt(c.secret, p); err != nil {
 		crypterCryptError.Inc()
 		return 0, err
@@ -194,6 +358,9 @@ func (c *crypter) write(p *Packet) (int, error) {
 		crypterMarshalError.Inc()
 		return 0, err
 	}
+	if c.proxyHeader != nil {
+		b = append(append(make([]byte, 0, len(c.proxyHeader)+len(b)), c.proxyHeader...), b...)
+	}
 
 	n, err := c.Write(b)
 	if err != nil {
@@ -228,52 +395,50 @@ func (c crypter) detectBadSecret(p *Packet) (*Packet, error) {
 			errCnt++
 		}
 		if errCnt == 3 {
-			crypterBadSecret.Inc()
 			// all packet types failed, most likley a bad secret
-			return c.badSecretReply(p.Header)
+			return c.errorStatusReply(p.Header, "bad secret")
 		}
 	case Authorize:
 		errCnt := 0
 		var ar AuthorRequest
-		if err := Unmarshal(p.Body, &ar); errors.As(err, &badSecret) {
+		if err := UnmarshalWithFlags(p.Body, p.Header.Flags, &ar); errors.As(err, &badSecret) {
 			errCnt++
 		}
 		var arr AuthorReply
-		if err := Unmarshal(p.Body, &arr); errors.As(err, &badSecret) {
+		if err := UnmarshalWithFlags(p.Body, p.Header.Flags, &arr); errors.As(err, &badSecret) {
 			errCnt++
 		}
 		if errCnt == 2 {
-			crypterBadSecret.Inc()
 			// all packet types failed, most likley a bad secret
-			return c.badSecretReply(p.Header)
+			return c.errorStatusReply(p.Header, "bad secret")
 		}
 	case Accounting:
 		errCnt := 0
 		var ar AcctRequest
-		if err := Unmarshal(p.Body, &ar); errors.As(err, &badSecret) {
+		if err := UnmarshalWithFlags(p.Body, p.Header.Flags, &ar); errors.As(err, &badSecret) {
 			errCnt++
 		}
 		var arr AcctReply
-		if err := Unmarshal(p.Body, &arr); errors.As(err, &badSecret) {
+		if err := UnmarshalWithFlags(p.Body, p.Header.Flags, &arr); errors.As(err, &badSecret) {
 			errCnt++
 		}
 		if errCnt == 2 {
-			crypterBadSecret.Inc()
 			// all packet types failed, most likley a bad secret
-			return c.badSecretReply(p.Header)
+			return c.errorStatusReply(p.Header, "bad secret")
 		}
 	}
 	return nil, nil
 }
 
-func (c crypter) badSecretReply(h *Header) (*Packet, error) {
+// errorStatusReply returns an error status reply to the packet with header h, with server msg msg
+func (c crypter) errorStatusReply(h *Header, msg string) (*Packet, error) {
 	var b []byte
 	var err error
 	switch h.Type {
 	case Authenticate:
 		b, err = NewAuthenReply(
 			SetAuthenReplyStatus(AuthenStatusError),
-			SetAuthenReplyServerMsg("bad secret"),
+			SetAuthenReplyServerMsg(msg),
 		).MarshalBinary()
 		if err != nil {
 			crypterMarshalError.Inc()
@@ -282,7 +447,7 @@ func (c crypter) badSecretReply(h *Header) (*Packet, error) {
 	case Authorize:
 		b, err = NewAuthorReply(
 			SetAuthorReplyStatus(AuthorStatusError),
-			SetAuthorReplyServerMsg("bad secret"),
+			SetAuthorReplyServerMsg(msg),
 		).MarshalBinary()
 		if err != nil {
 			crypterMarshalError.Inc()
@@ -291,7 +456,7 @@ func (c crypter) badSecretReply(h *Header) (*Packet, error) {
 	case Accounting:
 		b, err = NewAcctReply(
 			SetAcctReplyStatus(AcctReplyStatusError),
-			SetAcctReplyServerMsg("bad secret"),
+			SetAcctReplyServerMsg(msg),
 		).MarshalBinary()
 		if err != nil {
 			crypterMarshalError.Inc()
@@ -303,10 +468,12 @@ func (c crypter) badSecretReply(h *Header) (*Packet, error) {
 	// reset some flags and state for this error reply.
 	// under error conditions it can be common in the rfc to reset the sequence to 1
 	// if the error is particularly egregious.  a bad secret seems like it fits and
-	// the rfc is unclear for this particular condition on what to do
-	h.SeqNo = SequenceNumber(1)
+	// the rfc is unclear for this particular condition on what to do.  the reply gets its
+	// own header so the request may still be decrypted with a secondary secret
+	reply := *h
+	reply.SeqNo = SequenceNumber(1)
 	p := NewPacket(
-		SetPacketHeader(h),
+		SetPacketHeader(&reply),
 		SetPacketBody(b),
 	)
 	if err != nil {
@@ -314,18 +481,3 @@ func (c crypter) badSecretReply(h *Header) (*Packet, error) {
 	}
 	return p, nil
 }
-
-// BadSecretErr ...
-type BadSecretErr struct {
-	msg string
-}
-
-// NewBadSecretErr ...
-func NewBadSecretErr(msg string) *BadSecretErr {
-	return &BadSecretErr{msg: msg}
-}
-
-// Error ...
-func (b BadSecretErr) Error() string {
-	return b.msg
-}
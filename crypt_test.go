@@ -8,9 +8,17 @@
 package tacquito
 
 import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"net"
 	"testing"
 
+	"github.com/facebookincubator/tacquito/proxy"
+
 	"github.com/davecgh/go-spew/spew"
 	"github.com/stretchr/testify/assert"
 )
@@ -164,7 +172,8 @@ func TestCrypterAllocation(t *testing.T) {
 			fn:   BenchmarkCrypterAllocation,
 			expected: func(name string, r testing.BenchmarkResult) {
 				t.Log(spew.Sdump(r))
-				expectedAllocs := 4
+				// the pad is generated with pooled scratch space and xor'd in place
+				expectedAllocs := 0
 				actual := r.AllocsPerOp()
 				assert.EqualValues(t, expectedAllocs, actual, fmt.Sprintf("%s allocations were not nominal; wanted %v got %v", name, expectedAllocs, actual))
 			},
@@ -191,3 +200,308 @@ func BenchmarkCrypterAllocation(b *testing.B) {
 		crypt(secret, packet)
 	}
 }
+
+// BenchmarkCrypt benchmarks crypt across body sizes, from a typical authorization to the largest
+// body allowed
+func BenchmarkCrypt(b *testing.B) {
+	secret := []byte("fooman")
+	for _, size := range []int{64, 1024, int(MaxBodyLength)} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			packet := NewPacket(
+				SetPacketHeader(NewHeader(
+					SetHeaderVersion(Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionDefault}),
+					SetHeaderType(Authorize),
+					SetHeaderSeqNo(1),
+					SetHeaderSessionID(12345),
+					SetHeaderLen(size),
+				)),
+				SetPacketBody(make([]byte, size)),
+			)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				crypt(secret, packet)
+			}
+		})
+	}
+}
+
+// TestCryptPad compares crypt with the pad of rfc 8907 section 4.5 built naively, across body
+// lengths on either side of the md5 block size
+func TestCryptPad(t *testing.T) {
+	secret := []byte("fooman")
+	version := Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionOne}
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 33, 1000} {
+		body := make([]byte, size)
+		for i := range body {
+			body[i] = byte(i)
+		}
+		// pseudo_pad = {MD5_1 [,MD5_2 [ ... ,MD5_n]]} truncated to len(data)
+		var pad, last []byte
+		for len(pad) < size {
+			input := []byte{0, 0, 0x30, 0x39}
+			input = append(input, secret...)
+			input = append(input, MajorVersion<<4|MinorVersionOne, 3)
+			sum := md5.Sum(append(input, last...))
+			last = sum[:]
+			pad = append(pad, last...)
+		}
+		want := make([]byte, size)
+		for i := range body {
+			want[i] = body[i] ^ pad[i]
+		}
+		packet := NewPacket(
+			SetPacketHeader(NewHeader(SetHeaderVersion(version), SetHeaderType(Authorize), SetHeaderSeqNo(3), SetHeaderSessionID(12345), SetHeaderLen(size))),
+			SetPacketBody(body),
+		)
+		assert.NoError(t, crypt(secret, packet), size)
+		assert.Equal(t, want, packet.Body, size)
+	}
+}
+
+func TestCrypterProxyHeader(t *testing.T) {
+	source := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 40000}
+	destination := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 49}
+	for _, v := range []proxy.Version{proxy.V1, proxy.V2} {
+		header, err := proxy.NewHeader(source, destination).Marshal(v)
+		assert.NoError(t, err)
+
+		client, server := net.Pipe()
+		c := newCrypter([]byte("fooman"), client, false)
+		c.proxyHeader = header
+		s := newCrypter([]byte("fooman"), server, true)
+
+		body, err := NewAuthenStart(
+			SetAuthenStartAction(AuthenActionLogin),
+			SetAuthenStartPrivLvl(PrivLvlUser),
+			SetAuthenStartType(AuthenTypePAP),
+			SetAuthenStartService(AuthenServiceLogin),
+			SetAuthenStartUser("admin"),
+		).MarshalBinary()
+		assert.NoError(t, err)
+		// two packets on one connection, each carries its own proxy header
+		for i := 0; i < 2; i++ {
+			written := make(chan error, 1)
+			go func() {
+				_, err := c.write(NewPacket(
+					SetPacketHeader(NewHeader(
+						SetHeaderVersion(Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionOne}),
+						SetHeaderType(Authenticate),
+						SetHeaderSeqNo(1),
+						SetHeaderSessionID(12345),
+					)),
+					SetPacketBody(append([]byte(nil), body...)),
+				))
+				written <- err
+				if err != nil {
+					client.Close()
+				}
+			}()
+			p, err := s.read()
+			assert.NoError(t, <-written, v)
+			assert.NoError(t, err, v)
+			if assert.NotNil(t, p, v) {
+				assert.Equal(t, body, p.Body, v)
+			}
+		}
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestCrypterSecondarySecret(t *testing.T) {
+	body, err := NewAuthenStart(
+		SetAuthenStartAction(AuthenActionLogin),
+		SetAuthenStartPrivLvl(PrivLvlUser),
+		SetAuthenStartType(AuthenTypePAP),
+		SetAuthenStartService(AuthenServiceLogin),
+		SetAuthenStartUser("admin"),
+	).MarshalBinary()
+	assert.NoError(t, err)
+
+	// send writes a packet with secret and returns what the server read
+	send := func(s *crypter, secret string) (*Packet, error) {
+		client, server := net.Pipe()
+		defer client.Close()
+		s.Conn, s.Reader = server, bufio.NewReader(server)
+		c := newCrypter([]byte(secret), client, false)
+		go func() {
+			c.write(NewPacket(
+				SetPacketHeader(NewHeader(
+					SetHeaderVersion(Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionOne}),
+					SetHeaderType(Authenticate),
+					SetHeaderSeqNo(1),
+					SetHeaderSessionID(12345),
+				)),
+				SetPacketBody(append([]byte(nil), body...)),
+			))
+			// drain any bad secret reply
+			io.Copy(io.Discard, client)
+		}()
+		p, err := s.read()
+		server.Close()
+		return p, err
+	}
+
+	s := newCrypter([]byte("new"), nil, false)
+	s.secondary = []byte("old")
+	p, err := send(s, "new")
+	if assert.NoError(t, err) {
+		assert.Equal(t, body, p.Body)
+	}
+	assert.Equal(t, []byte("new"), s.secret)
+
+	// the secondary decrypts, and is preferred from then on
+	p, err = send(s, "old")
+	if assert.NoError(t, err) {
+		assert.Equal(t, body, p.Body)
+	}
+	assert.Equal(t, []byte("old"), s.secret)
+	assert.Equal(t, []byte("new"), s.secondary)
+
+	_, err = send(s, "wrong")
+	assert.EqualError(t, err, "bad secret detected for ip [pipe]")
+
+	// without a secondary, only the secret is tried
+	_, err = send(newCrypter([]byte("new"), nil, false), "old")
+	assert.Error(t, err)
+}
+
+func TestCrypterMaxBodyLength(t *testing.T) {
+	header := func(length uint32) []byte {
+		h, err := NewHeader(
+			SetHeaderVersion(Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionDefault}),
+			SetHeaderType(Authorize),
+			SetHeaderSeqNo(1),
+			SetHeaderSessionID(12345),
+		).MarshalBinary()
+		assert.NoError(t, err)
+		binary.BigEndian.PutUint32(h[8:], length)
+		return h
+	}
+	tests := []struct {
+		name   string
+		limit  uint32
+		length uint32
+		err    bool
+	}{
+		{name: "default limit", length: MaxBodyLength},
+		{name: "over the default limit", length: MaxBodyLength + 1, err: true},
+		{name: "within the connection limit", limit: 64, length: 64},
+		{name: "over the connection limit", limit: 64, length: 65, err: true},
+		{name: "connection limit is capped", limit: MaxBodyLength * 2, length: MaxBodyLength + 1, err: true},
+	}
+	for _, test := range tests {
+		client, server := net.Pipe()
+		s := newCrypter([]byte("fooman"), server, false)
+		s.maxBodyLength = test.limit
+		written := make(chan struct{})
+		go func(length uint32) {
+			defer close(written)
+			// bodies beyond the protocol maximum are left unread
+			if _, err := client.Write(header(length)); err == nil && length <= MaxBodyLength {
+				client.Write(make([]byte, length))
+			}
+		}(test.length)
+		p, err := s.receive()
+		client.Close()
+		server.Close()
+		<-written
+		if !test.err {
+			assert.NoError(t, err, test.name)
+			assert.Equal(t, test.length, p.Header.Length, test.name)
+			continue
+		}
+		var tooLarge *bodyLengthError
+		if assert.ErrorAs(t, err, &tooLarge, test.name) {
+			assert.Equal(t, test.length, tooLarge.length, test.name)
+			assert.Equal(t, Authorize, tooLarge.header.Type, test.name)
+			assert.Equal(t, SessionID(12345), tooLarge.header.SessionID, test.name)
+			assert.Equal(t, test.length <= MaxBodyLength, tooLarge.discarded, test.name)
+		}
+	}
+}
+
+func TestSetConnMaxBodyLength(t *testing.T) {
+	// no effect outside of a secret lookup
+	SetConnMaxBodyLength(context.Background(), 64)
+
+	limit := &bodyLimit{}
+	SetConnMaxBodyLength(context.WithValue(context.Background(), bodyLimitKey{}, limit), 64)
+	assert.Equal(t, uint32(64), limit.get())
+}
+
+func TestCrypterPooled(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	c := newCrypter([]byte("fooman"), client, false)
+	s := newCrypter([]byte("fooman"), server, false)
+	s.pooled = true
+	body := []byte("borrowed")
+	go c.write(NewPacket(
+		SetPacketHeader(NewHeader(
+			SetHeaderVersion(Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionDefault}),
+			SetHeaderType(Authorize),
+			SetHeaderSeqNo(1),
+			SetHeaderSessionID(12345),
+			SetHeaderFlag(UnencryptedFlag),
+		)),
+		SetPacketBody(append([]byte(nil), body...)),
+	))
+	p, err := s.receive()
+	assert.NoError(t, err)
+	assert.Equal(t, body, p.Body)
+	buf := p.buf
+	if assert.NotNil(t, buf) {
+		p.Release()
+		assert.Nil(t, p.Body)
+		assert.Equal(t, make([]byte, MaxHeaderLength+len(body)), (*buf)[:MaxHeaderLength+len(body)], "released buffers are cleared")
+	}
+	// releasing twice, or packets that were not borrowed, does nothing
+	p.Release()
+	(&Packet{Body: body}).Release()
+	assert.Equal(t, []byte("borrowed"), body)
+}
+
+// repeatReader reads b over and over
+type repeatReader struct {
+	b   []byte
+	off int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.b[r.off:])
+	r.off = (r.off + n) % len(r.b)
+	return n, nil
+}
+
+// BenchmarkCrypterReceive benchmarks the allocs/op of reading a packet, with and without the
+// buffers of the server's pool
+func BenchmarkCrypterReceive(b *testing.B) {
+	packet, err := NewPacket(
+		SetPacketHeader(NewHeader(
+			SetHeaderVersion(Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionDefault}),
+			SetHeaderType(Authorize),
+			SetHeaderSeqNo(1),
+			SetHeaderSessionID(12345),
+			SetHeaderLen(1024),
+		)),
+		SetPacketBody(make([]byte, 1024)),
+	).MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pooled=%v", pooled), func(b *testing.B) {
+			c := &crypter{Reader: bufio.NewReader(&repeatReader{b: packet}), pooled: pooled}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p, err := c.receive()
+				if err != nil {
+					b.Fatal(err)
+				}
+				p.Release()
+			}
+		})
+	}
+}
@@ -49,6 +49,28 @@ const ContextPrivLvl ContextKey = "priv-lvl"
 // ContextPort ...
 const ContextPort ContextKey = "port"
 
+// ContextPlatform is the platform fingerprint of the device that sent an authorization request,
+// eg junos or ios-xr, when one is configured for its scope
+const ContextPlatform ContextKey = "platform"
+
+// ContextConnInfo is the ConnectionInfo of the client's connection, available to SecretProviders
+// and handlers
+const ContextConnInfo ContextKey = "conn-info"
+
+// ContextScope is the name of the scope, the SecretConfig, that matched the client.  It is set on
+// the context handlers are created with, and on the contexts of the requests they serve
+const ContextScope ContextKey = "scope"
+
+// ContextTracer is the Tracer of the server that is serving a request, used by StartSpan
+const ContextTracer ContextKey = "tracer"
+
+// ContextAcctMetadata is the AcctMetadata of an accounting request, see WithAcctMetadata
+const ContextAcctMetadata ContextKey = "acct-metadata"
+
+// ContextSessionMetadata is the SessionMetadata of the session a request belongs to, see
+// Request.Metadata
+const ContextSessionMetadata ContextKey = "session-metadata"
+
 /* durations
 these ctx keys are being stored for request specific tracking of
 expensive operations. We already have prometheus Summary metrics tracking
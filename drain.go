@@ -0,0 +1,74 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"time"
+)
+
+// drainServerMsg is the server message of replies refused while draining
+const drainServerMsg = "server is shutting down"
+
+// SetDrainTimeout lets connections finish the sessions they have in progress for up to d once the
+// context given to Serve is done.  The server stops accepting immediately, idle connections are
+// closed, and packets starting new sessions are answered with an error status.  Handlers still
+// running at the deadline are answered with AuthenStatusError, AuthorStatusError or
+// AcctReplyStatusError, and every remaining connection is closed.  Handlers see their context
+// cancelled at the deadline, not before.  Zero, the default, closes each connection once it has
+// served the packet it is reading.
+func SetDrainTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.drainTimeout = d
+	}
+}
+
+// drainContext detaches connections from the cancellation of the context given to Serve.  It
+// carries the values of its parent, but is only done timeout after the parent is.
+type drainContext struct {
+	context.Context
+	done chan struct{}
+}
+
+// newDrainContext returns a drainContext of parent
+func newDrainContext(parent context.Context, timeout time.Duration) *drainContext {
+	d := &drainContext{Context: parent, done: make(chan struct{})}
+	go func() {
+		<-parent.Done()
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		<-timer.C
+		close(d.done)
+	}()
+	return d
+}
+
+// Deadline implements context.Context.  The parent's deadline starts the drain, it does not end it
+func (d *drainContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done implements context.Context
+func (d *drainContext) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err implements context.Context
+func (d *drainContext) Err() error {
+	select {
+	case <-d.done:
+		return context.Canceled
+	default:
+		return nil
+	}
+}
+
+// drainReply is the error reply of a packet of type t refused while draining
+func drainReply(t HeaderType) EncoderDecoder {
+	return errorReply(t, drainServerMsg)
+}
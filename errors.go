@@ -0,0 +1,70 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The errors of the packet codecs, the crypter and the session checks wrap one of these, so
+// callers can tell failures apart with errors.Is and errors.As rather than by their message.
+var (
+	// ErrBadSecret is wrapped by the error of a packet that does not decrypt with the secret
+	ErrBadSecret = errors.New("bad secret")
+	// ErrTruncatedPacket is wrapped by the error of a packet, header or body shorter than its
+	// fixed fields or its length field
+	ErrTruncatedPacket = errors.New("truncated packet")
+	// ErrOversizePacket is wrapped by the error of a packet whose body is longer than
+	// MaxBodyLength, or the limit of its connection
+	ErrOversizePacket = errors.New("oversize packet")
+	// ErrSequence is wrapped by the error of a packet whose sequence number breaks the rules of
+	// rfc 8907, eg an even number from a client
+	ErrSequence = errors.New("invalid sequence number")
+	// ErrObfuscatedTLS is wrapped by the error of a packet read over tls without the
+	// UnencryptedFlag, tls sessions must not be obfuscated
+	ErrObfuscatedTLS = errors.New("obfuscated packet over tls")
+)
+
+// ErrInvalidField is the error of a field whose value is not valid, eg an unknown AuthenType or
+// an Arg that is not all ascii.  Field is the name of the field's type.
+type ErrInvalidField struct {
+	Field  string
+	Reason string
+}
+
+// invalidField returns an ErrInvalidField for field, its reason formatted per format
+func invalidField(field, format string, args ...interface{}) error {
+	return &ErrInvalidField{Field: field, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Error ...
+func (e *ErrInvalidField) Error() string {
+	return e.Field + " " + e.Reason
+}
+
+// BadSecretErr is the error of a body whose field lengths do not add up, most likely because it
+// was decrypted with the wrong secret.  It matches ErrBadSecret.
+type BadSecretErr struct {
+	msg string
+}
+
+// NewBadSecretErr ...
+func NewBadSecretErr(msg string) *BadSecretErr {
+	return &BadSecretErr{msg: msg}
+}
+
+// Error ...
+func (b BadSecretErr) Error() string {
+	return b.msg
+}
+
+// Is reports whether target is ErrBadSecret
+func (b BadSecretErr) Is(target error) bool {
+	return target == ErrBadSecret
+}
@@ -0,0 +1,81 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrTruncatedPacket(t *testing.T) {
+	p := NewPacket(
+		SetPacketHeader(NewHeader(SetHeaderVersion(Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionOne}), SetHeaderType(Authenticate), SetHeaderSeqNo(1), SetHeaderSessionID(12345))),
+		SetPacketBodyUnsafe(NewAuthenStart(SetAuthenStartType(AuthenTypePAP), SetAuthenStartAction(AuthenActionLogin), SetAuthenStartService(AuthenServiceLogin), SetAuthenStartData("secret"))),
+	)
+	b, err := p.MarshalBinary()
+	require.NoError(t, err)
+
+	// a body shorter than its header's length field
+	var truncated Packet
+	err = truncated.UnmarshalBinary(b[:len(b)-1])
+	assert.ErrorIs(t, err, ErrTruncatedPacket)
+	// a packet shorter than a header
+	assert.ErrorIs(t, truncated.UnmarshalBinary(b[:MaxHeaderLength-1]), ErrTruncatedPacket)
+	// bodies shorter than their fixed fields
+	assert.ErrorIs(t, Unmarshal([]byte{0x01}, &AuthenStart{}), ErrTruncatedPacket)
+	assert.ErrorIs(t, Unmarshal([]byte{0x01}, &AuthorRequest{}), ErrTruncatedPacket)
+	assert.ErrorIs(t, Unmarshal([]byte{0x01}, &AcctReply{}), ErrTruncatedPacket)
+}
+
+func TestErrOversizePacket(t *testing.T) {
+	h := NewHeader(SetHeaderVersion(Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionOne}), SetHeaderType(Authenticate), SetHeaderSeqNo(1), SetHeaderSessionID(12345))
+	h.Length = MaxBodyLength + 1
+	_, err := h.MarshalBinary()
+	assert.ErrorIs(t, err, ErrOversizePacket)
+
+	h.Length = 0
+	b, err := h.MarshalBinary()
+	require.NoError(t, err)
+	assert.ErrorIs(t, newBodyLengthError(b, 10, false), ErrOversizePacket)
+}
+
+func TestErrInvalidField(t *testing.T) {
+	body := NewAuthenStart(SetAuthenStartType(AuthenTypePAP), SetAuthenStartAction(AuthenActionLogin), SetAuthenStartService(AuthenServiceLogin), SetAuthenStartPrivLvl(PrivLvl(42)))
+	_, err := body.MarshalBinary()
+	var invalid *ErrInvalidField
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "PrivLvl", invalid.Field)
+
+	err = AuthenType(42).Validate(nil)
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "AuthenType", invalid.Field)
+	assert.EqualError(t, err, "AuthenType value [unknown AuthenType[42]] is unknown")
+
+	err = Args{"service=shell", "cmd=\x80"}.Validate(nil)
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "Args", invalid.Field)
+}
+
+func TestErrSequence(t *testing.T) {
+	assert.ErrorIs(t, ClientSequenceNumber(2).Validate(nil), ErrSequence)
+	assert.ErrorIs(t, SequenceNumber(0).Validate(nil), ErrSequence)
+	assert.ErrorIs(t, sequenceOrder, ErrSequence)
+
+	s := newSessionProvider()
+	_, err := s.get(*NewHeader(SetHeaderVersion(Version{MajorVersion: MajorVersion, MinorVersion: MinorVersionOne}), SetHeaderType(Authenticate), SetHeaderSeqNo(2), SetHeaderSessionID(12345)))
+	assert.ErrorIs(t, err, ErrSequence)
+}
+
+func TestErrBadSecret(t *testing.T) {
+	assert.ErrorIs(t, NewBadSecretErr("lengths do not add up"), ErrBadSecret)
+	var err error = *NewBadSecretErr("lengths do not add up")
+	assert.ErrorIs(t, err, ErrBadSecret)
+}
@@ -0,0 +1,85 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"fmt"
+)
+
+//
+// experimental, non-rfc extended arg length encoding
+//
+// rfc8907 encodes each authorization and accounting arg length in a single byte, limiting args to
+// 255 bytes.  Some vendors exceed this.  When both ends of a link are tacquito, for example a proxy
+// or span destination, the ExtendedArgLength header flag switches every arg length to a big endian
+// uint16.  Nothing else about the body changes.  This is not interoperable with other TACACS+
+// implementations and is disabled by default.
+//
+
+const (
+	// MaxArgLength is the largest arg permitted by rfc8907
+	MaxArgLength = 0xff
+	// MaxExtendedArgLength is the largest arg permitted by the ExtendedArgLength encoding
+	MaxExtendedArgLength = 0xffff
+)
+
+// extendedEncoderDecoder is implemented by packet types that carry args and support the
+// ExtendedArgLength encoding
+type extendedEncoderDecoder interface {
+	MarshalBinaryExtended() ([]byte, error)
+	UnmarshalBinaryExtended(data []byte) error
+}
+
+// MarshalWithFlags will marshal t using the encoding indicated by flags.  Types without args
+// are always marshalled per rfc.
+func MarshalWithFlags(flags HeaderFlag, t EncoderDecoder) ([]byte, error) {
+	if t == nil {
+		return nil, fmt.Errorf("marshal cannot encode")
+	}
+	if e, ok := t.(extendedEncoderDecoder); ok && flags.Has(ExtendedArgLength) {
+		return e.MarshalBinaryExtended()
+	}
+	return t.MarshalBinary()
+}
+
+// UnmarshalWithFlags will unmarshal tacacs bytes using the encoding indicated by flags.  Types
+// without args are always unmarshalled per rfc.
+func UnmarshalWithFlags(v []byte, flags HeaderFlag, t EncoderDecoder) error {
+	if t == nil {
+		return fmt.Errorf("unmarshal cannot decode")
+	}
+	if e, ok := t.(extendedEncoderDecoder); ok && flags.Has(ExtendedArgLength) {
+		return e.UnmarshalBinaryExtended(v)
+	}
+	return t.UnmarshalBinary(v)
+}
+
+// maxArgLen returns the arg length limit for the Validate condition.  A HeaderFlag
+// condition with ExtendedArgLength set raises the limit.
+func maxArgLen(condition interface{}) int {
+	if flags, ok := condition.(HeaderFlag); ok && flags.Has(ExtendedArgLength) {
+		return MaxExtendedArgLength
+	}
+	return MaxArgLength
+}
+
+// appendArgLen appends an arg length using the encoding indicated by flags
+func appendArgLen(buf []byte, n int, flags HeaderFlag) []byte {
+	if flags.Has(ExtendedArgLength) {
+		return appendUint16(buf, n)
+	}
+	return append(buf, uint8(n))
+}
+
+// argLen reads an arg length using the encoding indicated by flags
+func (b *readBuffer) argLen(flags HeaderFlag) int {
+	if flags.Has(ExtendedArgLength) {
+		return b.uint16()
+	}
+	return b.int()
+}
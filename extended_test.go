@@ -0,0 +1,86 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtendedArgLength(t *testing.T) {
+	long := Arg("cmd-arg=" + stringOfLength(1000))
+	tests := []struct {
+		name    string
+		encoded EncoderDecoder
+		decoded EncoderDecoder
+	}{
+		{
+			name: "AuthorRequest",
+			encoded: NewAuthorRequest(
+				SetAuthorRequestMethod(AuthenMethodTacacsPlus),
+				SetAuthorRequestPrivLvl(PrivLvlUser),
+				SetAuthorRequestType(AuthenTypeASCII),
+				SetAuthorRequestService(AuthenServiceLogin),
+				SetAuthorRequestUser("user"),
+				SetAuthorRequestArgs(Args{"service=shell", "cmd=show", long}),
+			),
+			decoded: &AuthorRequest{},
+		},
+		{
+			name:    "AuthorReply",
+			encoded: NewAuthorReply(SetAuthorReplyStatus(AuthorStatusPassAdd), SetAuthorReplyArgs("priv-lvl=15", string(long))),
+			decoded: &AuthorReply{},
+		},
+		{
+			name: "AcctRequest",
+			encoded: NewAcctRequest(
+				SetAcctRequestFlag(AcctFlagStart),
+				SetAcctRequestMethod(AuthenMethodTacacsPlus),
+				SetAcctRequestPrivLvl(PrivLvlUser),
+				SetAcctRequestType(AuthenTypeASCII),
+				SetAcctRequestService(AuthenServiceLogin),
+				SetAcctRequestUser("user"),
+				SetAcctRequestArgs(Args{"task_id=1", long}),
+			),
+			decoded: &AcctRequest{},
+		},
+	}
+	for _, test := range tests {
+		// rfc encoding must reject args over 255 bytes
+		_, err := test.encoded.MarshalBinary()
+		assert.Error(t, err, test.name)
+
+		b, err := MarshalWithFlags(ExtendedArgLength, test.encoded)
+		assert.NoError(t, err, test.name)
+
+		// the extended encoding is not readable by a peer that did not negotiate it
+		assert.Error(t, Unmarshal(b, test.decoded), test.name)
+
+		assert.NoError(t, UnmarshalWithFlags(b, ExtendedArgLength, test.decoded), test.name)
+		assert.Equal(t, test.encoded, test.decoded, test.name)
+	}
+}
+
+func TestExtendedArgLengthRequest(t *testing.T) {
+	body := NewAuthorRequest(
+		SetAuthorRequestMethod(AuthenMethodTacacsPlus),
+		SetAuthorRequestPrivLvl(PrivLvlUser),
+		SetAuthorRequestType(AuthenTypeASCII),
+		SetAuthorRequestService(AuthenServiceLogin),
+		SetAuthorRequestUser("user"),
+		SetAuthorRequestArgs(Args{"service=shell", "cmd=show"}),
+	)
+	b, err := body.MarshalBinaryExtended()
+	assert.NoError(t, err)
+	request := Request{Header: *NewHeader(SetHeaderType(Authorize), SetHeaderFlag(ExtendedArgLength)), Body: b}
+	var decoded AuthorRequest
+	assert.NoError(t, request.Unmarshal(&decoded))
+	assert.Equal(t, body, &decoded)
+	assert.Equal(t, "user", request.Fields()["user"])
+}
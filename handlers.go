@@ -9,6 +9,8 @@ package tacquito
 
 import (
 	"context"
+	"errors"
+	"sync"
 )
 
 // Writer is an abstraction used for adding Writers to the response object
@@ -27,6 +29,44 @@ type response struct {
 	header Header
 	// slice of writers to write back the response
 	writers []Writer
+	// trace carries the handler span that reply spans belong to.  unlike ctx, handlers never replace it
+	trace context.Context
+
+	// mu serializes writes with abort
+	mu sync.Mutex
+	// replied is set by the first write, aborted once the server replied on the handler's behalf
+	replied, aborted bool
+	// closed is set once the handler ends the session and its connection, see Close
+	closed bool
+}
+
+// errAborted is returned by writes of a handler the server already replied for
+var errAborted = errors.New("the server replied on behalf of this handler, the response is discarded")
+
+// abort replies v to the request with header on behalf of a handler that has not replied yet.
+// Later writes by the handler are discarded.
+func (r *response) abort(header Header, v EncoderDecoder) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.aborted = true
+	if r.replied {
+		return nil
+	}
+	b, err := MarshalWithFlags(header.Flags, v)
+	if err != nil {
+		return err
+	}
+	_, err = r.crypter.write(NewPacket(
+		SetPacketHeader(NewHeader(
+			SetHeaderVersion(header.Version),
+			SetHeaderType(header.Type),
+			SetHeaderSeqNo(int(header.SeqNo)+1),
+			SetHeaderFlag(header.Flags),
+			SetHeaderSessionID(header.SessionID),
+		)),
+		SetPacketBody(b),
+	))
+	return err
 }
 
 // Reply will write the provided EncoderDecoder to the underlying net.Conn.  This method handles
@@ -52,7 +92,7 @@ func (r *response) Reply(v EncoderDecoder) (int, error) {
 		SetHeaderFlag(r.header.Flags),
 		SetHeaderSessionID(r.header.SessionID),
 	)
-	b, err := v.MarshalBinary()
+	b, err := MarshalWithFlags(r.header.Flags, v)
 	if err != nil {
 		r.Errorf(r.ctx, "unable to marshal packet; %v", err)
 		return 0, err
@@ -73,10 +113,35 @@ func (r *response) Reply(v EncoderDecoder) (int, error) {
 	return r.Write(p)
 }
 
+// errorReply is the reply to a packet of type t that the server refuses, with an error status
+// and msg
+func errorReply(t HeaderType, msg string) EncoderDecoder {
+	switch t {
+	case Authorize:
+		return NewAuthorReply(SetAuthorReplyStatus(AuthorStatusError), SetAuthorReplyServerMsg(msg))
+	case Accounting:
+		return NewAcctReply(SetAcctReplyStatus(AcctReplyStatusError), SetAcctReplyServerMsg(msg))
+	}
+	return NewAuthenReply(SetAuthenReplyStatus(AuthenStatusError), SetAuthenReplyServerMsg(msg))
+}
+
 // Write will write the packet to the underlying net.Conn.  If you are expecting another packet
 // to return from the client after writing a response, call Next(handler) to provide a next Handler.
 func (r *response) Write(p *Packet) (int, error) {
-	return r.crypter.write(p)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.aborted {
+		return 0, errAborted
+	}
+	r.replied = true
+	if r.trace == nil {
+		return r.crypter.write(p)
+	}
+	_, span := StartSpan(r.trace, "tacacs.reply")
+	span.SetAttribute("tacacs.seq_no", uint8(p.Header.SeqNo))
+	n, err := r.crypter.write(p)
+	span.End(err)
+	return n, err
 }
 
 // Next sets the incoming handler to next. This is only used for exchange sequences within the authenticate
@@ -85,6 +150,36 @@ func (r *response) Next(next Handler) {
 	r.next = next
 }
 
+// Close ends the session once the handler returns, and closes the connection along with any
+// other session multiplexed on it.  A reply written before or after Close is still sent, but the
+// client's next packet is never read; without one, the client sees the connection close.
+func (r *response) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+}
+
+// Abort replies with the error status of the request's packet type and msg, then ends the session
+// and closes the connection as Close does.  Use it on protocol violations the handler cannot
+// recover from.
+func (r *response) Abort(msg string) (int, error) {
+	r.Close()
+	return r.Reply(errorReply(r.header.Type, msg))
+}
+
+// Final reports if the session ends once the handler returns, either because it was closed or
+// because no Next handler was set for the client's next packet
+func (r *response) Final() bool {
+	return r.isClosed() || r.next == nil
+}
+
+// isClosed reports if the handler called Close
+func (r *response) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
 func (r *response) RegisterWriter(mw Writer) {
 	r.writers = append(r.writers, mw)
 }
@@ -119,22 +214,76 @@ type Response interface {
 	Context(ctx context.Context)
 }
 
-// Request provides access to the config for this net.Conn and also the packet itself
+// SessionCloser lets a handler end its session explicitly.  The server's Response implements it,
+// but it is not part of Response so that existing implementations of Response keep compiling;
+// handlers check for it with a type assertion.  A wrapper of Response should implement it only
+// when the Response it wraps does.
+type SessionCloser interface {
+	// Close ends the session and closes the connection once the handler returns
+	Close()
+	// Abort replies with an error status and msg, then ends the session as Close does
+	Abort(msg string) (int, error)
+	// Final reports if the session ends once the handler returns
+	Final() bool
+}
+
+// Abort ends the session of response with msg.  A response that implements SessionCloser is
+// aborted, closing the connection, while any other only gets the error reply for the packet type
+// of request and its session ends as any session without a Next handler does.
+func Abort(response Response, request Request, msg string) (int, error) {
+	if c, ok := response.(SessionCloser); ok {
+		return c.Abort(msg)
+	}
+	return response.Reply(errorReply(request.Header.Type, msg))
+}
+
+// WrapResponse returns wrapper, a Response wrapping response, such that it implements SessionCloser
+// when response does.  Middleware passes the result to the handlers after it, so a wrapper only has
+// to override the methods of Response it intercepts; Close, Abort and Final go straight to response.
+// A wrapper that implements SessionCloser itself is returned as is.
+func WrapResponse(wrapper, response Response) Response {
+	if _, ok := wrapper.(SessionCloser); ok {
+		return wrapper
+	}
+	if c, ok := response.(SessionCloser); ok {
+		return closingResponse{Response: wrapper, SessionCloser: c}
+	}
+	return wrapper
+}
+
+// closingResponse is a Response wrapper with the SessionCloser of the response it wraps
+type closingResponse struct {
+	Response
+	SessionCloser
+}
+
+// Request provides access to the config for this net.Conn and also the packet itself.  The server
+// reads Body into a pooled buffer that is reused once Handle returns, so handlers that use Body
+// after returning, eg from another goroutine, must copy it.
 type Request struct {
 	Header  Header
 	Body    []byte
 	Context context.Context
 }
 
+// Unmarshal will decode the request body into t, honoring any encoding flags set in the header
+func (r Request) Unmarshal(t EncoderDecoder) error {
+	return UnmarshalWithFlags(r.Body, r.Header.Flags, t)
+}
+
 // Fields will extract all fields from any packet type and attempt to include any optional
 // ContextKey values
 func (r Request) Fields(keys ...ContextKey) map[string]string {
 	allFields := r.Header.Fields()
 
-	// add optional context values
+	// add optional context values, falling back to the session's metadata
 	if r.Context != nil {
+		m := SessionMetadataFromContext(r.Context)
 		for _, key := range keys {
 			v, ok := r.Context.Value(key).(string)
+			if !ok && m != nil {
+				v, ok = m.String(key)
+			}
 			if ok {
 				allFields[string(key)] = v
 			}
@@ -168,24 +317,24 @@ func (r Request) Fields(keys ...ContextKey) map[string]string {
 
 	case Authorize:
 		var ar AuthorRequest
-		if err := Unmarshal(r.Body, &ar); err == nil {
+		if err := r.Unmarshal(&ar); err == nil {
 			merge(allFields, ar.Fields())
 			return allFields
 		}
 		var arr AuthorReply
-		if err := Unmarshal(r.Body, &arr); err == nil {
+		if err := r.Unmarshal(&arr); err == nil {
 			merge(allFields, arr.Fields())
 			return allFields
 		}
 
 	case Accounting:
 		var ar AcctRequest
-		if err := Unmarshal(r.Body, &ar); err == nil {
+		if err := r.Unmarshal(&ar); err == nil {
 			merge(allFields, ar.Fields())
 			return allFields
 		}
 		var arr AcctReply
-		if err := Unmarshal(r.Body, &arr); err == nil {
+		if err := r.Unmarshal(&arr); err == nil {
 			merge(allFields, arr.Fields())
 			return allFields
 		}
@@ -121,7 +121,7 @@ func (h *Header) Validate() error {
 	}
 	// manually validate Length since it's not a Field interface
 	if h.Length > MaxBodyLength {
-		return fmt.Errorf("length field is too large, max size is 2^(16)")
+		return fmt.Errorf("%w; length field is too large, max size is 2^(16)", ErrOversizePacket)
 	}
 	return nil
 }
@@ -149,7 +149,7 @@ func (h *Header) MarshalBinary() ([]byte, error) {
 // UnmarshalBinary decodes tacacs bytes into Header
 func (h *Header) UnmarshalBinary(data []byte) error {
 	if len(data) < MaxHeaderLength {
-		return fmt.Errorf("Header size [%v] is not matched to expected size [%v]", len(data), MaxHeaderLength)
+		return fmt.Errorf("%w; Header size [%v] is not matched to expected size [%v]", ErrTruncatedPacket, len(data), MaxHeaderLength)
 	}
 	var version Version
 	err := version.UnmarshalBinary(data)
@@ -163,14 +163,6 @@ func (h *Header) UnmarshalBinary(data []byte) error {
 	h.SessionID = SessionID(binary.BigEndian.Uint32(data[4:]))
 	h.Length = binary.BigEndian.Uint32(data[8:])
 
-	// set SingleConnect.  Ignored on all other sequence numbers
-	// see https://datatracker.ietf.org/doc/html/rfc8907#section-4.3
-	// if this is our first response, we always set this. its up to the
-	// client to persist it beyond from seq 2
-	if h.SeqNo == 2 {
-		h.Flags.Set(SingleConnect)
-	}
-
 	// validate
 	if err := h.Validate(); err != nil {
 		return err
@@ -38,14 +38,14 @@ type Version struct {
 // Validate known constants
 func (v Version) Validate(condition interface{}) error {
 	if v.MajorVersion != MajorVersion {
-		return fmt.Errorf("invalid MajorVersion: [%v]", v.MajorVersion)
+		return invalidField("MajorVersion", "[%v] is not supported", v.MajorVersion)
 	}
 
 	switch v.MinorVersion {
 	case MinorVersionDefault, MinorVersionOne:
 		return nil
 	default:
-		return fmt.Errorf("invalid MinorVersion: [%v]", v.MinorVersion)
+		return invalidField("MinorVersion", "[%v] is not supported", v.MinorVersion)
 	}
 
 }
@@ -117,7 +117,7 @@ func (t HeaderType) Validate(condition interface{}) error {
 	case Authenticate, Authorize, Accounting:
 		return nil
 	}
-	return fmt.Errorf("unknown HeaderType value [%v]", t)
+	return invalidField("HeaderType", "value [%v] is unknown", t)
 }
 
 // Len returns the length of HeaderType.
@@ -168,9 +168,9 @@ func (t SequenceNumber) Inc() int {
 func (t SequenceNumber) Validate(condition interface{}) error {
 	switch v := uint16(t); {
 	case v < 1:
-		return fmt.Errorf("sequence number must be greater than zero, [%v]", t)
+		return fmt.Errorf("%w; it must be greater than zero, [%v]", ErrSequence, t)
 	case v > HeaderMaxSequence:
-		return fmt.Errorf("headerMaxSequence exceeded [%v]", t)
+		return fmt.Errorf("%w; headerMaxSequence exceeded [%v]", ErrSequence, t)
 	}
 	return nil
 }
@@ -183,7 +183,7 @@ type ClientSequenceNumber uint8
 func (t ClientSequenceNumber) Validate(condition interface{}) error {
 	switch v := uint8(t); {
 	case v%2 == 0:
-		return fmt.Errorf("client sent an even sequence number")
+		return fmt.Errorf("%w; client sent an even sequence number", ErrSequence)
 	}
 	return nil
 }
@@ -203,7 +203,7 @@ func (t LastSequence) Validate(condition interface{}) error {
 		return fmt.Errorf("invalid type passed as a condition, it must be a SequenceNumber")
 	}
 	if last >= current {
-		return fmt.Errorf("the last sequence number is >= to the current sequence")
+		return fmt.Errorf("%w; the last sequence number is >= to the current sequence", ErrSequence)
 	}
 	return nil
 }
@@ -217,6 +217,12 @@ const (
 	UnencryptedFlag HeaderFlag = 0x01
 	// SingleConnect is used to allow a client and server to negotiate single connection mode
 	SingleConnect HeaderFlag = 0x04
+	// ExtendedArgLength is an experimental, non-rfc flag.  When set, every arg length in
+	// authorization and accounting bodies is encoded as a uint16 instead of a uint8, lifting the
+	// 255 byte arg limit.  It is only meant for links where both peers are tacquito and have
+	// explicitly enabled it; see SetExtendedArgLength.  Servers that have not enabled it close
+	// connections that send it.
+	ExtendedArgLength HeaderFlag = 0x80
 )
 
 // Set HeaderFlag's f bit.
@@ -233,12 +239,15 @@ func (b *HeaderFlag) Has(f HeaderFlag) bool { return *b&f != 0 }
 
 // String to satisfy Fields interface
 func (b HeaderFlag) String() string {
-	flags := make([]string, 0, 2) // 2 supported flags
+	flags := make([]string, 0, 3) // 3 supported flags
 	if b.Has(UnencryptedFlag) {
 		flags = append(flags, "UnencryptedFlag")
 	}
 	if b.Has(SingleConnect) {
 		flags = append(flags, "SingleConnect")
 	}
+	if b.Has(ExtendedArgLength) {
+		flags = append(flags, "ExtendedArgLength")
+	}
 	return strings.Join(flags, "|")
 }
@@ -0,0 +1,35 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+// Middleware wraps a Handler with behavior common to every handler, eg logging, rate limiting,
+// metrics or tracing, in the manner of net/http middleware.  It is given the handler that would
+// serve a packet, and returns the handler to call in its place, which usually calls next.
+type Middleware func(next Handler) Handler
+
+// Chain returns a Middleware applying middleware in order, the first being the outermost
+func Chain(middleware ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+		return next
+	}
+}
+
+// SetMiddleware wraps the handler of every packet with middleware, the first being the outermost.
+// The chain wraps whichever handler serves the packet, the SecretProvider's handler for the first
+// packet of a session, and the handler set with Response.Next for the packets after it.  So unlike
+// middleware baked into a handler, it need not keep itself in front of the next handler, but it is
+// applied again for each packet; state spanning the packets of a session belongs in the session's
+// metadata, see Request.Metadata.  Calling SetMiddleware again appends to the chain.
+func SetMiddleware(middleware ...Middleware) Option {
+	return func(s *Server) {
+		s.middleware = append(s.middleware, middleware...)
+	}
+}
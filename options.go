@@ -0,0 +1,210 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// ServerOptions is the effective configuration of a Server, useful when debugging
+type ServerOptions struct {
+	Proxy                 bool          `json:"proxy"`
+	ExtendedArgLength     bool          `json:"extended_arg_length"`
+	SingleConnect         bool          `json:"single_connect"`
+	ReadTimeout           time.Duration `json:"read_timeout"`
+	PacketTypes           []string      `json:"packet_types,omitempty"`
+	ConnectionRate        float64       `json:"connection_rate,omitempty"`
+	ConnectionBurst       int           `json:"connection_burst,omitempty"`
+	MaxConnections        int           `json:"max_connections,omitempty"`
+	SourceConnectionRate  float64       `json:"source_connection_rate,omitempty"`
+	SourceConnectionBurst int           `json:"source_connection_burst,omitempty"`
+	MaxSourceConnections  int           `json:"max_source_connections,omitempty"`
+	MaxSessions           int           `json:"max_sessions,omitempty"`
+	DrainTimeout          time.Duration `json:"drain_timeout,omitempty"`
+	MaxBodyLength         uint32        `json:"max_body_length,omitempty"`
+	StrictSequence        bool          `json:"strict_sequence,omitempty"`
+	SessionRegistry       bool          `json:"session_registry,omitempty"`
+	SessionGrace          time.Duration `json:"session_grace,omitempty"`
+	MaxConcurrentSessions int           `json:"max_concurrent_sessions,omitempty"`
+	Middleware            int           `json:"middleware,omitempty"`
+	UnencryptedPolicy     string        `json:"unencrypted_policy"`
+	UnencryptedPrefixes   []string      `json:"unencrypted_prefixes,omitempty"`
+	TLSPeers              []string      `json:"tls_peers,omitempty"`
+}
+
+// Options returns the effective options of the server
+func (s *Server) Options() ServerOptions {
+	return ServerOptions{
+		Proxy:                 s.proxy,
+		ExtendedArgLength:     s.extendedArgLength,
+		SingleConnect:         s.singleConnect,
+		ReadTimeout:           s.readTimeout,
+		PacketTypes:           packetTypeNames(s.packetTypes),
+		ConnectionRate:        s.connRate,
+		ConnectionBurst:       s.connBurst,
+		MaxConnections:        s.maxConnections,
+		SourceConnectionRate:  s.sourceRate,
+		SourceConnectionBurst: s.sourceBurst,
+		MaxSourceConnections:  s.maxSourceConnections,
+		MaxSessions:           s.maxSessions,
+		DrainTimeout:          s.drainTimeout,
+		MaxBodyLength:         s.maxBodyLength,
+		StrictSequence:        s.strictSequence,
+		SessionRegistry:       s.sessionRegistry,
+		SessionGrace:          s.sessionGrace,
+		MaxConcurrentSessions: s.maxConcurrentSessions,
+		Middleware:            len(s.middleware),
+		UnencryptedPolicy:     s.unencryptedPolicy.String(),
+		UnencryptedPrefixes:   prefixNames(s.unencryptedPrefixes),
+		TLSPeers:              s.tlsPeerPolicy.Entries(),
+	}
+}
+
+// prefixNames returns the cidr notation of prefixes
+func prefixNames(prefixes []*net.IPNet) []string {
+	var names []string
+	for _, prefix := range prefixes {
+		names = append(names, prefix.String())
+	}
+	return names
+}
+
+// packetTypeNames returns the sorted names of types, nil if all types are served
+func packetTypeNames(types map[HeaderType]bool) []string {
+	if types == nil {
+		return nil
+	}
+	var names []string
+	for _, t := range []HeaderType{Authenticate, Authorize, Accounting} {
+		if types[t] {
+			names = append(names, t.String())
+		}
+	}
+	return names
+}
+
+// Validate reports option combinations that would misbehave at runtime.  listener may be nil
+// to only check the options against each other.
+func (s *Server) Validate(listener net.Listener) error {
+	var problems []string
+	if s.readTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("read timeout [%v] must not be negative", s.readTimeout))
+	}
+	if s.singleConnect && s.readTimeout == 0 {
+		problems = append(problems, "single-connect requires a read timeout, idle connections would never be closed")
+	}
+	for t := range s.packetTypes {
+		if err := t.Validate(nil); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if s.connRate < 0 {
+		problems = append(problems, fmt.Sprintf("connection rate [%v] must not be negative", s.connRate))
+	}
+	if s.connRate > 0 && s.connBurst < 1 {
+		problems = append(problems, fmt.Sprintf("connection burst [%v] must be at least 1 when rate limiting", s.connBurst))
+	}
+	if s.maxConnections < 0 {
+		problems = append(problems, fmt.Sprintf("max connections [%v] must not be negative", s.maxConnections))
+	}
+	if s.sourceRate < 0 {
+		problems = append(problems, fmt.Sprintf("source connection rate [%v] must not be negative", s.sourceRate))
+	}
+	if s.sourceRate > 0 && s.sourceBurst < 1 {
+		problems = append(problems, fmt.Sprintf("source connection burst [%v] must be at least 1 when rate limiting", s.sourceBurst))
+	}
+	if s.maxSourceConnections < 0 {
+		problems = append(problems, fmt.Sprintf("max source connections [%v] must not be negative", s.maxSourceConnections))
+	}
+	if s.maxSessions < 0 {
+		problems = append(problems, fmt.Sprintf("max sessions [%v] must not be negative", s.maxSessions))
+	}
+	if s.maxConcurrentSessions < 0 {
+		problems = append(problems, fmt.Sprintf("max concurrent sessions [%v] must not be negative", s.maxConcurrentSessions))
+	}
+	if s.drainTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("drain timeout [%v] must not be negative", s.drainTimeout))
+	}
+	if s.sessionGrace < 0 {
+		problems = append(problems, fmt.Sprintf("session grace [%v] must not be negative", s.sessionGrace))
+	}
+	if s.maxBodyLength > MaxBodyLength {
+		problems = append(problems, fmt.Sprintf("max body length [%v] must not exceed [%v]", s.maxBodyLength, MaxBodyLength))
+	}
+	if s.unencryptedPolicy > UnencryptedLog {
+		problems = append(problems, fmt.Sprintf("unencrypted policy [%v] is unknown", s.unencryptedPolicy))
+	}
+	if s.unencryptedPolicy == UnencryptedAllow && len(s.unencryptedPrefixes) == 0 {
+		problems = append(problems, "the allow unencrypted policy requires at least one prefix")
+	}
+	if p := s.tlsPeerPolicy; p != nil && len(p.DNSNames)+len(p.IPs)+len(p.URIs) == 0 {
+		problems = append(problems, "the tls peer policy requires at least one dns, ip or uri entry")
+	}
+	if _, ok := listener.(*tlsListener); ok && s.proxy {
+		// the proxy header would have to be read before the handshake, not from within it
+		problems = append(problems, "proxy headers are not supported on tls listeners")
+	}
+	if listener != nil && s.proxy {
+		// the proxy header is stripped, not used for secret lookups, so a peer on a unix
+		// socket never has an address to match a secret config with
+		if network := listener.Addr().Network(); network == "unix" || network == "unixpacket" {
+			problems = append(problems, fmt.Sprintf("proxy headers are not supported on [%v] listeners", network))
+		}
+	}
+	return optionsError("server", problems)
+}
+
+// ClientOptions is the effective configuration of a Client, useful when debugging
+type ClientOptions struct {
+	LocalAddr     string `json:"local_addr"`
+	RemoteAddr    string `json:"remote_addr"`
+	ProxyHeader   bool   `json:"proxy_header"`
+	SingleConnect bool   `json:"single_connect"`
+	Unencrypted   bool   `json:"unencrypted,omitempty"`
+	// Servers is the failover list of the client, in order
+	Servers []string `json:"servers,omitempty"`
+}
+
+// Options returns the effective options of the client
+func (c *Client) Options() ClientOptions {
+	o := ClientOptions{SingleConnect: c.mux != nil, Unencrypted: c.unencrypted}
+	if c.failover != nil {
+		for _, server := range c.failover.servers {
+			o.Servers = append(o.Servers, server.Address)
+		}
+	}
+	if c.crypter != nil {
+		o.LocalAddr = c.crypter.LocalAddr().String()
+		o.RemoteAddr = c.crypter.RemoteAddr().String()
+		o.ProxyHeader = c.crypter.proxyHeader != nil
+	}
+	return o
+}
+
+// validate reports option combinations that would misbehave at runtime
+func (c *Client) validate() error {
+	var problems []string
+	if c.crypter == nil && c.failover == nil {
+		problems = append(problems, "a dialer option is required")
+	}
+	if c.failover != nil && c.mux != nil {
+		problems = append(problems, "single-connect is not supported with a server list")
+	}
+	return optionsError("client", problems)
+}
+
+// optionsError formats every problem found in a set of options as a single error
+func optionsError(kind string, problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid %v options; %v", kind, strings.Join(problems, "; "))
+}
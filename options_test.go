@@ -0,0 +1,127 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerValidate(t *testing.T) {
+	unix, err := net.Listen("unix", filepath.Join(t.TempDir(), "tacquito.sock"))
+	assert.NoError(t, err)
+	defer unix.Close()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer tcp.Close()
+	tlsListener := NewTLSListener(tcp.(*net.TCPListener), &tls.Config{})
+	_, lab, err := net.ParseCIDR("10.0.0.0/8")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		listener net.Listener
+		err      string
+	}{
+		{name: "defaults", listener: tcp},
+		{name: "proxy on tcp", opts: []Option{SetUseProxy(true)}, listener: tcp},
+		{name: "proxy on unix", opts: []Option{SetUseProxy(true)}, listener: unix, err: "proxy headers are not supported on [unix] listeners"},
+		{name: "tls", listener: tlsListener},
+		{name: "proxy on tls", opts: []Option{SetUseProxy(true)}, listener: tlsListener, err: "proxy headers are not supported on tls listeners"},
+		{name: "single-connect without a read timeout", opts: []Option{SetSingleConnect(true), SetReadTimeout(0)}, err: "single-connect requires a read timeout"},
+		{name: "negative read timeout", opts: []Option{SetReadTimeout(-time.Second)}, err: "must not be negative"},
+		{name: "no read timeout", opts: []Option{SetReadTimeout(0)}, listener: tcp},
+		{name: "packet types", opts: []Option{SetPacketTypes(Authenticate, Authorize)}, listener: tcp},
+		{name: "unknown packet type", opts: []Option{SetPacketTypes(HeaderType(9))}, err: "HeaderType value [unknown HeaderType[9]] is unknown"},
+		{name: "negative connection rate", opts: []Option{SetConnectionRateLimit(-1, 1)}, err: "connection rate [-1] must not be negative"},
+		{name: "rate without burst", opts: []Option{SetConnectionRateLimit(10, 0)}, err: "connection burst [0] must be at least 1"},
+		{name: "negative max connections", opts: []Option{SetMaxConnections(-1)}, err: "max connections [-1] must not be negative"},
+		{name: "source limits", opts: []Option{SetSourceConnectionRateLimit(2, 2), SetMaxSourceConnections(4), SetMaxSessions(16)}, listener: tcp},
+		{name: "negative source connection rate", opts: []Option{SetSourceConnectionRateLimit(-1, 1)}, err: "source connection rate [-1] must not be negative"},
+		{name: "source rate without burst", opts: []Option{SetSourceConnectionRateLimit(10, 0)}, err: "source connection burst [0] must be at least 1"},
+		{name: "negative max source connections", opts: []Option{SetMaxSourceConnections(-1)}, err: "max source connections [-1] must not be negative"},
+		{name: "negative max sessions", opts: []Option{SetMaxSessions(-1)}, err: "max sessions [-1] must not be negative"},
+		{name: "drain timeout", opts: []Option{SetDrainTimeout(30 * time.Second)}, listener: tcp},
+		{name: "negative drain timeout", opts: []Option{SetDrainTimeout(-time.Second)}, err: "drain timeout [-1s] must not be negative"},
+		{name: "session registry", opts: []Option{SetSessionRegistry(time.Minute)}, listener: tcp},
+		{name: "negative session grace", opts: []Option{SetSessionRegistry(-time.Second)}, err: "session grace [-1s] must not be negative"},
+		{name: "max body length", opts: []Option{SetMaxBodyLength(8192)}, listener: tcp},
+		{name: "max concurrent sessions", opts: []Option{SetMaxConcurrentSessions(64)}, listener: tcp},
+		{name: "negative max concurrent sessions", opts: []Option{SetMaxConcurrentSessions(-1)}, err: "max concurrent sessions [-1] must not be negative"},
+		{name: "unencrypted allow", opts: []Option{SetUnencryptedPolicy(UnencryptedAllow, lab)}, listener: tcp},
+		{name: "unencrypted allow without prefixes", opts: []Option{SetUnencryptedPolicy(UnencryptedAllow)}, err: "the allow unencrypted policy requires at least one prefix"},
+		{name: "unknown unencrypted policy", opts: []Option{SetUnencryptedPolicy(UnencryptedPolicy(9))}, err: "unencrypted policy [unknown UnencryptedPolicy[9]] is unknown"},
+		{name: "tls peer policy", opts: []Option{SetTLSPeerPolicy(&TLSPeerPolicy{DNSNames: []string{"*.example.com"}})}, listener: tlsListener},
+		{name: "empty tls peer policy", opts: []Option{SetTLSPeerPolicy(&TLSPeerPolicy{})}, err: "the tls peer policy requires at least one dns, ip or uri entry"},
+		{name: "max body length too large", opts: []Option{SetMaxBodyLength(MaxBodyLength + 1)}, err: "max body length [65537] must not exceed [65536]"},
+	}
+	for _, test := range tests {
+		err := NewServer(nil, nil, test.opts...).Validate(test.listener)
+		if test.err == "" {
+			assert.NoError(t, err, test.name)
+			continue
+		}
+		if assert.Error(t, err, test.name) {
+			assert.Contains(t, err.Error(), test.err, test.name)
+		}
+	}
+
+	// Serve refuses to start with invalid options
+	s := NewServer(nil, nil, SetUseProxy(true))
+	assert.Error(t, s.Serve(context.Background(), unix.(*net.UnixListener)))
+
+	assert.Equal(t, ServerOptions{SingleConnect: true, ReadTimeout: 15 * time.Second, UnencryptedPolicy: "reject"}, NewServer(nil, nil, SetSingleConnect(true)).Options())
+	assert.Equal(t,
+		ServerOptions{ReadTimeout: 15 * time.Second, PacketTypes: []string{"Authenticate", "Accounting"}, ConnectionRate: 5, ConnectionBurst: 10, MaxConnections: 3, UnencryptedPolicy: "reject"},
+		NewServer(nil, nil, SetPacketTypes(Accounting, Authenticate), SetConnectionRateLimit(5, 10), SetMaxConnections(3)).Options(),
+	)
+	assert.Equal(t,
+		ServerOptions{ReadTimeout: 15 * time.Second, SourceConnectionRate: 1, SourceConnectionBurst: 2, MaxSourceConnections: 3, MaxSessions: 4, UnencryptedPolicy: "reject"},
+		NewServer(nil, nil, SetSourceConnectionRateLimit(1, 2), SetMaxSourceConnections(3), SetMaxSessions(4)).Options(),
+	)
+}
+
+func TestClientValidate(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	address := listener.Addr().String()
+
+	_, err = NewClient()
+	assert.EqualError(t, err, "invalid client options; a dialer option is required")
+
+	_, err = NewClient(SetClientDialer("tcp", address, nil), SetClientDialer("tcp", address, nil))
+	assert.Equal(t, errDialerSet, err)
+
+	c, err := NewClient(SetClientDialer("tcp", address, nil), SetClientSingleConnect())
+	if assert.NoError(t, err) {
+		o := c.Options()
+		assert.Equal(t, address, o.RemoteAddr)
+		assert.True(t, o.SingleConnect)
+		assert.False(t, o.ProxyHeader)
+		c.Close()
+	}
+
+	_, err = NewClient(SetClientServers("tcp", ClientServer{Address: address}), SetClientSingleConnect())
+	assert.EqualError(t, err, "invalid client options; single-connect is not supported with a server list")
+	_, err = NewClient(SetClientDeadTime(time.Second), SetClientServers("tcp", ClientServer{Address: address}))
+	assert.EqualError(t, err, "SetClientDeadTime must follow SetClientServers")
+	c, err = NewClient(SetClientServers("tcp", ClientServer{Address: address}, ClientServer{Address: "127.0.0.1:1"}))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{address, "127.0.0.1:1"}, c.Options().Servers)
+		assert.Equal(t, address, c.Server())
+		c.Close()
+	}
+}
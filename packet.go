@@ -9,6 +9,7 @@ package tacquito
 
 import (
 	"fmt"
+	"sync"
 	"unicode"
 )
 
@@ -91,6 +92,32 @@ type Packet struct {
 	Header *Header
 	// Body may be crypted or uncrypted bytes of the body, length indicated in the header.Length
 	Body []byte
+	// buf if set, is the pooled buffer Body was read into, see Release
+	buf *[]byte
+}
+
+// packetPool holds buffers large enough for any packet, so the server reads packets without
+// allocating
+var packetPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, MaxHeaderLength+int(MaxBodyLength))
+		return &b
+	},
+}
+
+// Release returns the buffer a packet read by the server borrowed to the pool, clearing the bytes
+// it held.  Body must not be used after Release, nor any slice of it.  It does nothing for other
+// packets, or when called more than once.
+func (p *Packet) Release() {
+	if p == nil || p.buf == nil {
+		return
+	}
+	b := (*p.buf)[:MaxHeaderLength+len(p.Body)]
+	for i := range b {
+		b[i] = 0
+	}
+	packetPool.Put(p.buf)
+	p.buf, p.Body = nil, nil
 }
 
 // MarshalBinary encodes Packet into tacacs bytes. It is unaware of crypt.
@@ -103,7 +130,7 @@ func (p *Packet) MarshalBinary() ([]byte, error) {
 		return nil, fmt.Errorf("body is nil, cannot MarshalBinary")
 	}
 	if p.Header.Length > MaxBodyLength {
-		return nil, fmt.Errorf("indicated size is too large to marshal; max allowed [%v] reported [%v]", MaxBodyLength, p.Header.Length)
+		return nil, fmt.Errorf("%w; indicated size is too large to marshal; max allowed [%v] reported [%v]", ErrOversizePacket, MaxBodyLength, p.Header.Length)
 	}
 	head, err := p.Header.MarshalBinary()
 	if err != nil {
@@ -124,7 +151,7 @@ func (p *Packet) UnmarshalBinary(v []byte) error {
 	var err error
 	var h Header
 	if len(v) < MaxHeaderLength {
-		return fmt.Errorf("data length [%v] is smaller than expected header length [%v]", len(v), MaxHeaderLength)
+		return fmt.Errorf("%w; data length [%v] is smaller than expected header length [%v]", ErrTruncatedPacket, len(v), MaxHeaderLength)
 	}
 	err = Unmarshal(v[:MaxHeaderLength], &h)
 	if err != nil {
@@ -132,7 +159,10 @@ func (p *Packet) UnmarshalBinary(v []byte) error {
 	}
 	p.Header = &h
 	if h.Length > MaxBodyLength {
-		return fmt.Errorf("indicated size is too large to unmarshal; max allowed [%v] reported [%v]", MaxBodyLength, h.Length)
+		return fmt.Errorf("%w; indicated size is too large to unmarshal; max allowed [%v] reported [%v]", ErrOversizePacket, MaxBodyLength, h.Length)
+	}
+	if len(v) < MaxHeaderLength+int(h.Length) {
+		return fmt.Errorf("%w; data length [%v] is smaller than the header and its indicated body length [%v]", ErrTruncatedPacket, len(v), h.Length)
 	}
 	p.Body = v[MaxHeaderLength : MaxHeaderLength+int(h.Length)]
 	return nil
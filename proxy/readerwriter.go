@@ -9,7 +9,8 @@
 // or strip the PROXY ASCII strings from bytes.  The context is appropriately
 // updated against the underlying so as to preserve the remote host's ability to "see" the client
 // address and port.
-// Only the ASCII portion is implemented from http://www.haproxy.org/download/1.8/doc/proxy-protocol.txt
+// The ASCII (v1) and the tcp portion of the binary (v2) formats are implemented from
+// http://www.haproxy.org/download/1.8/doc/proxy-protocol.txt
 package proxy
 
 import (
@@ -52,6 +53,16 @@ func (h *Header) Read(b []byte) (int, error) {
 	return copy(b, header), nil
 }
 
+// MarshalV1 encodes the header as an ASCII PROXY protocol v1 line, including the null byte
+// terminator expected by tacquito's proxy processing
+func (h *Header) MarshalV1() ([]byte, error) {
+	b := h.proxyHeader()
+	if b == nil {
+		return nil, fmt.Errorf("proxy v1 requires tcp addresses")
+	}
+	return b, nil
+}
+
 func (h *Header) proxyHeader() []byte {
 	// spec requires uppercase for network
 	network := strings.ToUpper(h.client.Network())
@@ -100,3 +100,40 @@ func TestPeekHAProxy(t *testing.T) {
 		assert.Equal(t, test.remoteNetwork, pw.remote.Network())
 	}
 }
+
+func TestV2(t *testing.T) {
+	tests := []struct {
+		client net.Addr
+		remote net.Addr
+		want   [2]string
+	}{
+		{
+			client: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 100},
+			remote: &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 49},
+			want:   [2]string{"192.0.2.1:100", "192.0.2.2:49"},
+		},
+		{
+			client: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 100},
+			remote: &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 49},
+			want:   [2]string{"[2001:db8::1]:100", "192.0.2.2:49"},
+		},
+	}
+	for _, test := range tests {
+		b, err := NewHeader(test.client, test.remote).MarshalV2()
+		assert.NoError(t, err)
+		assert.True(t, IsV2(b))
+		n, err := V2Length(b)
+		assert.NoError(t, err)
+		assert.Equal(t, len(b), n)
+
+		var h Header
+		assert.NoError(t, h.UnmarshalV2(b))
+		assert.Equal(t, test.want[0], h.LocalAddr().String())
+		assert.Equal(t, test.want[1], h.RemoteAddr().String())
+
+		var truncated Header
+		assert.Error(t, truncated.UnmarshalV2(b[:n-1]))
+	}
+	_, err := NewHeader(&net.UDPAddr{}, &net.UDPAddr{}).MarshalV2()
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Version is a PROXY protocol version
+type Version int
+
+const (
+	// V1 is the ASCII PROXY protocol
+	V1 Version = 1
+	// V2 is the binary PROXY protocol
+	V2 Version = 2
+)
+
+// Marshal encodes the header using protocol version v
+func (h *Header) Marshal(v Version) ([]byte, error) {
+	switch v {
+	case V1:
+		return h.MarshalV1()
+	case V2:
+		return h.MarshalV2()
+	}
+	return nil, fmt.Errorf("unknown proxy protocol version [%v]", v)
+}
+
+// V2Signature prefixes every binary PROXY protocol v2 header
+const V2Signature = "\r\n\r\n\x00\r\nQUIT\n"
+
+const (
+	// V2HeaderLength is the fixed portion of a v2 header; signature, version/command, family and length
+	V2HeaderLength = 16
+
+	v2VersionLocal = 0x20
+	v2VersionProxy = 0x21
+	v2FamilyTCP4   = 0x11
+	v2FamilyTCP6   = 0x21
+	v2AddrLenTCP4  = 12
+	v2AddrLenTCP6  = 36
+)
+
+// IsV2 reports whether b begins with the v2 signature
+func IsV2(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(V2Signature))
+}
+
+// V2Length returns the total length of the v2 header that starts b.  b must hold at least
+// V2HeaderLength bytes.
+func V2Length(b []byte) (int, error) {
+	if len(b) < V2HeaderLength || !IsV2(b) {
+		return 0, HeaderStringMalformed("no proxy v2 signature detected on header")
+	}
+	return V2HeaderLength + int(binary.BigEndian.Uint16(b[14:16])), nil
+}
+
+// MarshalV2 encodes the header as a binary PROXY protocol v2 PROXY command.  Only tcp over
+// ipv4 and ipv6 are supported.
+func (h *Header) MarshalV2() ([]byte, error) {
+	clientIP, clientPort := getIPPort(h.client)
+	proxyIP, proxyPort := getIPPort(h.remote)
+	if clientIP == nil || proxyIP == nil {
+		return nil, fmt.Errorf("proxy v2 requires tcp addresses")
+	}
+	b := make([]byte, V2HeaderLength, V2HeaderLength+v2AddrLenTCP6)
+	copy(b, V2Signature)
+	b[12] = v2VersionProxy
+	if c4, p4 := clientIP.To4(), proxyIP.To4(); c4 != nil && p4 != nil {
+		b[13] = v2FamilyTCP4
+		binary.BigEndian.PutUint16(b[14:16], v2AddrLenTCP4)
+		b = append(b, c4...)
+		b = append(b, p4...)
+	} else {
+		b[13] = v2FamilyTCP6
+		binary.BigEndian.PutUint16(b[14:16], v2AddrLenTCP6)
+		b = append(b, clientIP.To16()...)
+		b = append(b, proxyIP.To16()...)
+	}
+	b = append(b, byte(clientPort>>8), byte(clientPort), byte(proxyPort>>8), byte(proxyPort))
+	return b, nil
+}
+
+// UnmarshalV2 decodes a complete binary PROXY protocol v2 header into h.  A LOCAL command, used
+// by load balancer health checks, leaves h unchanged.  Unsupported families are rejected.
+func (h *Header) UnmarshalV2(b []byte) error {
+	n, err := V2Length(b)
+	if err != nil {
+		return err
+	}
+	if len(b) < n {
+		return HeaderStringMalformed(fmt.Sprintf("proxy v2 header is truncated, expected [%v] bytes, got [%v]", n, len(b)))
+	}
+	switch b[12] {
+	case v2VersionLocal:
+		return nil
+	case v2VersionProxy:
+	default:
+		return HeaderStringMalformed(fmt.Sprintf("unsupported proxy v2 version/command [%#x]", b[12]))
+	}
+	addrs := b[V2HeaderLength:n]
+	var ipLen int
+	var network string
+	switch b[13] {
+	case v2FamilyTCP4:
+		ipLen, network = 4, "tcp4"
+	case v2FamilyTCP6:
+		ipLen, network = 16, "tcp6"
+	default:
+		return net.UnknownNetworkError(fmt.Sprintf("proxy v2 family [%#x]", b[13]))
+	}
+	// trailing tlvs, if any, are ignored
+	if len(addrs) < 2*ipLen+4 {
+		return HeaderStringMalformed("proxy v2 address block is truncated")
+	}
+	clientIP := net.IP(addrs[:ipLen])
+	proxyIP := net.IP(addrs[ipLen : 2*ipLen])
+	clientPort := binary.BigEndian.Uint16(addrs[2*ipLen:])
+	proxyPort := binary.BigEndian.Uint16(addrs[2*ipLen+2:])
+	h.client = &addr{network: network, address: clientIP.String(), port: fmt.Sprint(clientPort)}
+	h.remote = &addr{network: network, address: proxyIP.String(), port: fmt.Sprint(proxyPort)}
+	return nil
+}
@@ -0,0 +1,135 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"sync"
+	"time"
+)
+
+// newRateLimiter returns a token bucket that refills at rate tokens per second, up to burst
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), now: time.Now}
+}
+
+// rateLimiter is a token bucket
+type rateLimiter struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// allow takes a token, reporting false if none are available
+func (r *rateLimiter) allow() bool {
+	r.Lock()
+	defer r.Unlock()
+	now := r.now()
+	if !r.last.IsZero() {
+		r.tokens += now.Sub(r.last).Seconds() * r.rate
+		if r.tokens > r.burst {
+			r.tokens = r.burst
+		}
+	}
+	r.last = now
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// sourceSweepInterval is how often idle sources are dropped from a sourceLimiter
+const sourceSweepInterval = time.Minute
+
+// newSourceLimiter returns a limiter of connections per source address.  A rate of zero does not
+// limit the rate and a max of zero does not bound concurrent connections.
+func newSourceLimiter(rate float64, burst int, max int) *sourceLimiter {
+	return &sourceLimiter{rate: rate, burst: burst, max: max, sources: make(map[string]*source), now: time.Now}
+}
+
+// sourceLimiter tracks the connection rate and concurrent connections of every source address
+type sourceLimiter struct {
+	sync.Mutex
+	rate      float64
+	burst     int
+	max       int
+	sources   map[string]*source
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// source is the state of one source address
+type source struct {
+	limiter *rateLimiter
+	active  int
+}
+
+// acquire admits a new connection from addr, reporting false if addr is over its rate or already
+// has max connections.  Every admitted connection must be released.
+func (l *sourceLimiter) acquire(addr string) bool {
+	l.Lock()
+	defer l.Unlock()
+	l.sweep()
+	src, ok := l.sources[addr]
+	if !ok {
+		src = &source{}
+		if l.rate > 0 && l.burst > 0 {
+			src.limiter = newRateLimiter(l.rate, l.burst)
+			src.limiter.now = l.now
+		}
+		l.sources[addr] = src
+	}
+	// the bound is checked first so connections it rejects do not spend the rate
+	if l.max > 0 && src.active >= l.max {
+		serveSourceMaxConnectionsReached.Inc()
+		return false
+	}
+	if src.limiter != nil && !src.limiter.allow() {
+		serveSourceRateLimited.Inc()
+		return false
+	}
+	src.active++
+	return true
+}
+
+// release frees a connection admitted by acquire
+func (l *sourceLimiter) release(addr string) {
+	l.Lock()
+	defer l.Unlock()
+	src, ok := l.sources[addr]
+	if !ok {
+		return
+	}
+	src.active--
+	if src.active == 0 && src.limiter == nil {
+		delete(l.sources, addr)
+	}
+}
+
+// sweep drops sources without connections whose rate limit has refilled, so tracking every
+// address that ever connected does not grow without bound.  The caller must hold the lock.
+func (l *sourceLimiter) sweep() {
+	now := l.now()
+	if now.Sub(l.lastSweep) < sourceSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for addr, src := range l.sources {
+		if src.active > 0 {
+			continue
+		}
+		if src.limiter != nil && src.limiter.tokens+now.Sub(src.limiter.last).Seconds()*src.limiter.rate < src.limiter.burst {
+			continue
+		}
+		delete(l.sources, addr)
+	}
+	serveSources.Set(float64(len(l.sources)))
+}
@@ -35,6 +35,11 @@ func TestRequestFields(t *testing.T) {
 		return ctx
 	}
 
+	metadata := NewSessionMetadata()
+	metadata.Set(ContextPlatform, "junos")
+	metadata.Set(ContextConnRemoteAddr, "8.8.8.8")
+	metadata.Set(ContextScope, 15)
+
 	tests := []struct {
 		name     string
 		request  Request
@@ -47,10 +52,19 @@ func TestRequestFields(t *testing.T) {
 			expected: map[string]string{string(ContextSessionID): "123", string(ContextReqID): "1", string(ContextConnRemoteAddr): "9.9.9.9"},
 			ctxKeys:  []ContextKey{ContextSessionID, ContextReqID, ContextConnRemoteAddr},
 		},
+		{
+			name:     "ensure session metadata fills the ContextKeys missing from the context",
+			request:  Request{Header: *NewHeader(SetHeaderType(Accounting)), Body: acctBody, Context: WithSessionMetadata(withValues(context.Background(), map[ContextKey]string{ContextConnRemoteAddr: "9.9.9.9"}), metadata)},
+			expected: map[string]string{string(ContextPlatform): "junos", string(ContextConnRemoteAddr): "9.9.9.9"},
+			ctxKeys:  []ContextKey{ContextPlatform, ContextConnRemoteAddr, ContextScope},
+		},
 	}
 
 	for _, test := range tests {
 		fields := test.request.Fields(test.ctxKeys...)
+		if _, ok := fields[string(ContextScope)]; ok {
+			t.Fatalf("%v: only string values are fields, got %v", test.name, fields)
+		}
 		for expectedKey, expectedValue := range test.expected {
 			if v, ok := fields[expectedKey]; !ok || v != expectedValue {
 				t.Fatalf("request fields dont match, got %v, wanted %v", fields, test.expected)
@@ -18,3 +18,12 @@ import (
 type SecretProvider interface {
 	Get(ctx context.Context, remote net.Addr) ([]byte, Handler, error)
 }
+
+// RotatingSecretProvider is a SecretProvider that may also return a secondary secret for a client,
+// typically the previous secret while a new one is rolled out to devices.  Packets that do not
+// decrypt with the secret are tried with the secondary before the server replies with a bad
+// secret error.  The server uses GetSecrets instead of Get when its provider implements it.
+type RotatingSecretProvider interface {
+	SecretProvider
+	GetSecrets(ctx context.Context, remote net.Addr) (secret, secondary []byte, h Handler, err error)
+}
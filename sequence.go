@@ -0,0 +1,117 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sequenceServerMsg is the server msg of the reply to a packet that breaks the sequence rules
+const sequenceServerMsg = "invalid sequence number"
+
+// SetStrictSequence enforces the sequence number rules of rfc 8907 section 4.1 on every packet,
+// https://datatracker.ietf.org/doc/html/rfc8907#section-4.1.  Clients send odd sequence numbers,
+// sessions start at 1, each packet follows the server's last reply by one, and a session that
+// reaches 255 must restart rather than wrap.  A packet breaking a rule terminates its session,
+// the other sessions on the connection are unaffected.  Packets out of order or starting a session
+// above 1 are replied to with an error status; even and wrapping sequence numbers have no valid
+// reply, so the session is dropped silently.  Disabled by default, the server then closes the
+// connection on even or decreasing sequence numbers and treats any packet of an unknown session
+// as its start.
+func SetStrictSequence(v bool) Option {
+	return func(s *Server) {
+		s.strictSequence = v
+	}
+}
+
+// sequenceViolation is the rfc 8907 sequence rule a client packet breaks
+type sequenceViolation uint8
+
+const (
+	sequenceValid sequenceViolation = iota
+	// sequenceEven packets were sent with the parity of the server
+	sequenceEven
+	// sequenceStart packets are the first of their session, but not numbered 1
+	sequenceStart
+	// sequenceOrder packets do not follow the server's last reply in their session
+	sequenceOrder
+	// sequenceWrap packets are numbered 255, the server's reply would wrap
+	sequenceWrap
+)
+
+func (v sequenceViolation) Error() string {
+	switch v {
+	case sequenceEven:
+		return "client sent an even sequence number"
+	case sequenceStart:
+		return "session did not start at sequence number 1"
+	case sequenceOrder:
+		return "sequence number does not follow the last reply"
+	case sequenceWrap:
+		return "sequence number reached the maximum, the session must restart"
+	}
+	return "valid sequence number"
+}
+
+// Is reports whether target is ErrSequence
+func (v sequenceViolation) Is(target error) bool {
+	return target == ErrSequence
+}
+
+// counter is the metric of v
+func (v sequenceViolation) counter() prometheus.Counter {
+	switch v {
+	case sequenceEven:
+		return handleSequenceEven
+	case sequenceStart:
+		return handleSequenceStart
+	case sequenceOrder:
+		return handleSequenceOrder
+	}
+	return handleSequenceWrap
+}
+
+// replies reports if a packet breaking v can be replied to with a valid sequence number
+func (v sequenceViolation) replies() bool {
+	return v == sequenceStart || v == sequenceOrder
+}
+
+// check returns the sequence rule h breaks, sequenceValid if none.  A session whose last reply
+// was an authentication restart, sequence number 1, starts again at 1.
+func (s *sessions) check(h Header) sequenceViolation {
+	s.RLock()
+	sc, known := s.known[h.SessionID]
+	s.RUnlock()
+	switch {
+	case h.SeqNo%2 == 0:
+		return sequenceEven
+	case h.SeqNo >= HeaderMaxSequence:
+		return sequenceWrap
+	case !known && h.SeqNo != 1:
+		return sequenceStart
+	case known && h.SeqNo != sc.header.SeqNo+1 && !(sc.header.SeqNo == 1 && h.SeqNo == 1):
+		return sequenceOrder
+	}
+	return sequenceValid
+}
+
+// rejectSequence terminates the session of a packet breaking v, replying with an error status if
+// a valid reply exists
+func (s *Server) rejectSequence(ctx context.Context, sessions *sessions, resp *response, h Header, v sequenceViolation) {
+	v.counter().Inc()
+	s.Errorf(ctx, "[%v] terminating session from %v at sequence number [%v]; %v", h.SessionID, resp.crypter.RemoteAddr(), h.SeqNo, v)
+	sessions.delete(h.SessionID)
+	if !v.replies() {
+		return
+	}
+	if _, err := resp.Reply(errorReply(h.Type, sequenceServerMsg)); err != nil {
+		s.Debugf(ctx, "[%v] unable to send sequence error reply; %v", h.SessionID, err)
+	}
+}
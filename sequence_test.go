@@ -0,0 +1,44 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionsCheck(t *testing.T) {
+	header := func(session SessionID, seq int) Header {
+		return *NewHeader(SetHeaderType(Authenticate), SetHeaderSessionID(session), SetHeaderSeqNo(seq))
+	}
+	s := newSessionProvider()
+	defer s.close()
+	// the server's last reply in session 1 was 2, in session 2 it restarted authentication
+	s.set(header(1, 2), nil)
+	s.set(header(2, 1), nil)
+
+	tests := []struct {
+		name   string
+		header Header
+		want   sequenceViolation
+	}{
+		{name: "new session", header: header(3, 1), want: sequenceValid},
+		{name: "new session above 1", header: header(3, 3), want: sequenceStart},
+		{name: "next packet", header: header(1, 3), want: sequenceValid},
+		{name: "skipped packet", header: header(1, 5), want: sequenceOrder},
+		{name: "replayed packet", header: header(1, 1), want: sequenceOrder},
+		{name: "even", header: header(1, 4), want: sequenceEven},
+		{name: "even new session", header: header(3, 2), want: sequenceEven},
+		{name: "wrap", header: header(3, 255), want: sequenceWrap},
+		{name: "restart", header: header(2, 1), want: sequenceValid},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, s.check(test.header), test.name)
+	}
+}
@@ -9,9 +9,11 @@ package tacquito
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,23 +23,138 @@ import (
 // in NewServer. Omitting options will not adversely affect the service
 type Option func(s *Server)
 
-// SetUseProxy will enable ASCII based proxy support defined by
-// http://www.haproxy.org/download/1.8/doc/proxy-protocol.txt
+// SetUseProxy will enable ASCII (v1) and binary (v2) proxy header support defined by
+// http://www.haproxy.org/download/1.8/doc/proxy-protocol.txt.  A header is expected before
+// every packet.
 func SetUseProxy(v bool) Option {
 	return func(s *Server) {
 		s.proxy = v
 	}
 }
 
-// NewServer returns a new server.
+// SetExtendedArgLength will accept packets that set the experimental, non-rfc ExtendedArgLength
+// header flag.  Only enable this for links where the peer is also tacquito.
+func SetExtendedArgLength(v bool) Option {
+	return func(s *Server) {
+		s.extendedArgLength = v
+	}
+}
+
+// SetSingleConnect enables rfc8907 single-connection negotiation, see
+// https://datatracker.ietf.org/doc/html/rfc8907#section-4.3.  The first packet on a connection
+// decides the mode.  If the client sets the SingleConnect flag, the server advertises support by
+// setting it in its replies and multiplexes sessions on the connection by SessionID.  Otherwise,
+// the flag is cleared in replies and the connection is closed once its session completes.
+// When disabled, the server echoes the client's flags and leaves the connection open until the
+// client closes it.
+func SetSingleConnect(v bool) Option {
+	return func(s *Server) {
+		s.singleConnect = v
+	}
+}
+
+// SetReadTimeout bounds how long a connection may be idle waiting for the client's next packet,
+// defaulting to 15 seconds.  Zero disables the timeout, which is incompatible with single-connect
+// since idle multiplexed connections would never be closed.
+func SetReadTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readTimeout = d
+	}
+}
+
+// SetPacketTypes restricts the server to the given packet types, so authentication, authorization
+// and accounting may be served on separate listeners.  A connection that sends any other type is
+// closed.  No types, the default, accepts every type.
+func SetPacketTypes(types ...HeaderType) Option {
+	return func(s *Server) {
+		if len(types) == 0 {
+			s.packetTypes = nil
+			return
+		}
+		s.packetTypes = make(map[HeaderType]bool, len(types))
+		for _, t := range types {
+			s.packetTypes[t] = true
+		}
+	}
+}
+
+// SetConnectionRateLimit limits how many connections per second the server accepts, allowing
+// bursts of up to burst connections.  Connections over the limit are closed as soon as they are
+// accepted.  A rate of zero, the default, is unlimited.
+func SetConnectionRateLimit(rate float64, burst int) Option {
+	return func(s *Server) {
+		s.connRate = rate
+		s.connBurst = burst
+	}
+}
+
+// SetMaxConnections bounds how many connections the server processes at once.  Once the bound is
+// reached the server stops accepting, leaving new connections in the listen backlog until a slot
+// frees up.  Zero, the default, is unlimited.
+func SetMaxConnections(n int) Option {
+	return func(s *Server) {
+		s.maxConnections = n
+	}
+}
+
+// SetSourceConnectionRateLimit limits how many connections per second the server accepts from each
+// source address, allowing bursts of up to burst connections.  Connections over the limit are
+// closed as soon as they are accepted.  Behind a proxy every connection shares the proxy's
+// address.  A rate of zero, the default, is unlimited.
+func SetSourceConnectionRateLimit(rate float64, burst int) Option {
+	return func(s *Server) {
+		s.sourceRate = rate
+		s.sourceBurst = burst
+	}
+}
+
+// SetMaxSourceConnections bounds how many connections the server processes at once from each source
+// address.  Unlike SetMaxConnections, connections over the bound are closed as soon as they are
+// accepted, so a single misbehaving device cannot hold the listen backlog.  Zero, the default, is
+// unlimited.
+func SetMaxSourceConnections(n int) Option {
+	return func(s *Server) {
+		s.maxSourceConnections = n
+	}
+}
+
+// SetMaxSessions bounds how many sessions a single-connect client may have in progress on one
+// connection.  Packets starting a session beyond the bound are dropped without a reply, leaving
+// the sessions in progress unaffected.  Zero, the default, is unlimited.
+func SetMaxSessions(n int) Option {
+	return func(s *Server) {
+		s.maxSessions = n
+	}
+}
+
+// NewServer returns a new server.  Conflicting options are reported by Validate, which Serve
+// calls before accepting any connections.
 // loggerProvider - the logging backend to use
 // listener - net.Listener
 // sp SecretProvider - enables server to translate net.conn.remaddr into associated config for that device
 func NewServer(l loggerProvider, sp SecretProvider, opts ...Option) *Server {
-	s := &Server{loggerProvider: l, SecretProvider: sp}
+	s := &Server{loggerProvider: l, SecretProvider: sp, readTimeout: 15 * time.Second}
 	for _, opt := range opts {
 		opt(s)
 	}
+	if s.connRate > 0 && s.connBurst > 0 {
+		s.limiter = newRateLimiter(s.connRate, s.connBurst)
+	}
+	if s.maxConnections > 0 {
+		s.slots = make(chan struct{}, s.maxConnections)
+	}
+	if (s.sourceRate > 0 && s.sourceBurst > 0) || s.maxSourceConnections > 0 {
+		s.sources = newSourceLimiter(s.sourceRate, s.sourceBurst, s.maxSourceConnections)
+	}
+	if s.sessionRegistry {
+		s.registry = newSessionRegistry(s.sessionGrace)
+	}
+	if s.maxConcurrentSessions > 0 {
+		s.pool = newWorkerPool(s.maxConcurrentSessions)
+	}
+	if s.stats == nil {
+		s.stats = NewStats()
+	}
 	return s
 }
 
@@ -49,6 +166,54 @@ type Server struct {
 
 	// enables ha-proxy ascii proxy header support
 	proxy bool
+	// enables the non-rfc ExtendedArgLength encoding
+	extendedArgLength bool
+	// enables single-connect negotiation
+	singleConnect bool
+	// idle timeout between packets on a connection
+	readTimeout time.Duration
+	// packet types served, nil serves all of them
+	packetTypes map[HeaderType]bool
+	// accepted connections per second and burst, enforced by limiter
+	connRate  float64
+	connBurst int
+	limiter   *rateLimiter
+	// concurrent connections, enforced by slots
+	maxConnections int
+	slots          chan struct{}
+	// accepted connections per second, burst and concurrent connections of each source address,
+	// enforced by sources
+	sourceRate           float64
+	sourceBurst          int
+	maxSourceConnections int
+	sources              *sourceLimiter
+	// sessions in progress on a connection
+	maxSessions int
+	// tracer if set, creates spans for each connection and packet
+	tracer Tracer
+	// how long connections may finish their sessions once Serve's ctx is done
+	drainTimeout time.Duration
+	// longest packet body accepted, unless the SecretProvider sets one for the connection
+	maxBodyLength uint32
+	// enforces the rfc 8907 sequence number rules
+	strictSequence bool
+	// session ids in progress across connections, and how long completed ids are held
+	sessionRegistry bool
+	sessionGrace    time.Duration
+	registry        *sessionRegistry
+	// session packets handled at once, enforced by pool
+	maxConcurrentSessions int
+	pool                  *workerPool
+	// middleware wraps the handler of every packet, see SetMiddleware
+	middleware []Middleware
+	// stats records the server's activity, see SetStats
+	stats *Stats
+	// how unencrypted packets are treated on connections that are not tls, and the clients
+	// UnencryptedAllow serves them from
+	unencryptedPolicy   UnencryptedPolicy
+	unencryptedPrefixes []*net.IPNet
+	// authorizes the client certificates of tls connections, see SetTLSPeerPolicy
+	tlsPeerPolicy *TLSPeerPolicy
 }
 
 // DeadlineListener is a net.Listener that supports Deadlines
@@ -57,23 +222,60 @@ type DeadlineListener interface {
 	SetDeadline(t time.Time) error
 }
 
-// Serve is a blocking method that serves clients
+// Serve is a blocking method that serves clients.  It returns an error without serving if the
+// server's options are invalid for listener, see Validate.
 func (s *Server) Serve(ctx context.Context, listener DeadlineListener) error {
+	if err := s.Validate(listener); err != nil {
+		return err
+	}
+	var closeOnce sync.Once
+	closeListener := func() {
+		closeOnce.Do(func() {
+			s.Infof(ctx, "Stopping server listener for %v...", listener.Addr().String())
+			err := listener.Close()
+			if err != nil {
+				s.Errorf(ctx, "%s", err)
+			}
+		})
+	}
+	if s.pool != nil {
+		s.pool.start()
+	}
 	defer func() {
-		s.Infof(ctx, "Stopping server listener for %v...", listener.Addr().String())
-		err := listener.Close()
-		if err != nil {
-			s.Errorf(ctx, "%s", err)
-		}
-		s.Infof(ctx, "waiting for [%v] connections to close prior to shutdown", s.active)
+		closeListener()
+		s.Infof(ctx, "waiting for [%v] connections to close prior to shutdown", s.count())
 		s.Wait()
+		if s.pool != nil {
+			s.pool.stop()
+		}
+	}()
+	// stop accepting as soon as ctx is done, rather than at the next accept deadline
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			closeListener()
+		case <-stop:
+		}
 	}()
+	// with a drain timeout, connections outlive ctx so sessions in progress may complete
+	connCtx, draining := ctx, (<-chan struct{})(nil)
+	if s.drainTimeout > 0 {
+		connCtx, draining = newDrainContext(ctx, s.drainTimeout), ctx.Done()
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		default:
+			if s.pool != nil && !s.pool.admit(ctx) {
+				return nil
+			}
+			if !s.acquire(ctx) {
+				return nil
+			}
 			serveReceived.Inc()
 			// the 10 second deadline implies there is a limit to how long downstream handlers
 			// may take to respond to a client.  Clients may also give up much sooner than this
@@ -83,6 +285,10 @@ func (s *Server) Serve(ctx context.Context, listener DeadlineListener) error {
 			}
 			conn, err := listener.Accept()
 			if err != nil {
+				s.release()
+				if ctx.Err() != nil {
+					return nil
+				}
 				var opE *net.OpError
 				if errors.As(err, &opE) {
 					if !opE.Temporary() {
@@ -99,59 +305,225 @@ func (s *Server) Serve(ctx context.Context, listener DeadlineListener) error {
 				serveAcceptedError.Inc()
 				continue
 			}
+			if s.limiter != nil && !s.limiter.allow() {
+				serveRateLimited.Inc()
+				s.Debugf(ctx, "connection rate limit exceeded, closing connection from %v", conn.RemoteAddr())
+				conn.Close()
+				s.release()
+				continue
+			}
+			if s.sources != nil && !s.sources.acquire(strip(conn.RemoteAddr().String())) {
+				s.Debugf(ctx, "per source connection limit exceeded, closing connection from %v", conn.RemoteAddr())
+				conn.Close()
+				s.release()
+				continue
+			}
 			s.Add(1)
-			go s.serve(ctx, conn)
+			go s.serve(connCtx, draining, conn)
 		}
 	}
 }
 
-func (s *Server) serve(ctx context.Context, conn net.Conn) {
+// acquire takes a connection slot, waiting for one to free up when the server is at its maximum.
+// It returns false if ctx is cancelled while waiting.
+func (s *Server) acquire(ctx context.Context) bool {
+	if s.slots == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+	}
+	serveMaxConnectionsReached.Inc()
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release returns a connection slot taken by acquire
+func (s *Server) release() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+func (s *Server) serve(ctx context.Context, draining <-chan struct{}, conn net.Conn) {
 	defer s.Done()
+	defer s.release()
+	if s.sources != nil {
+		defer s.sources.release(strip(conn.RemoteAddr().String()))
+	}
 	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
 		ms := v * 1000 // make milliseconds
 		connectionDuration.Observe(ms)
 	}))
 	defer timer.ObserveDuration()
+	ctx, span := s.startSpan(ctx, "tacacs.connection")
+	span.SetAttribute("net.peer.addr", conn.RemoteAddr().String())
+	span.SetAttribute("net.host.addr", conn.LocalAddr().String())
+	var state *tls.ConnectionState
+	if tc, ok := conn.(*tls.Conn); ok {
+		cs, err := handshake(ctx, tc, s.readTimeout)
+		if err != nil {
+			serveTLSHandshakeError.Inc()
+			s.Errorf(ctx, "tls handshake with %v failed; %v", conn.RemoteAddr(), err)
+			span.End(err)
+			conn.Close()
+			return
+		}
+		if err := s.authorizeTLS(cs); err != nil {
+			s.Errorf(ctx, "closing tls connection from %v; %v", conn.RemoteAddr(), err)
+			span.End(err)
+			conn.Close()
+			return
+		}
+		state = &cs
+	}
+	ctx = context.WithValue(ctx, ContextConnInfo, newConnectionInfo(conn, state))
 	// start a timer to measure loader duration
 	loaderStart := time.Now()
-	secret, handler, err := s.Get(ctx, conn.RemoteAddr())
+	_, secretSpan := s.startSpan(ctx, "tacacs.secrets")
+	limit := &bodyLimit{}
+	secret, secondary, handler, err := s.secrets(context.WithValue(ctx, bodyLimitKey{}, limit), conn.RemoteAddr())
+	secretSpan.End(err)
 	if err != nil || secret == nil || handler == nil {
 		s.Errorf(ctx, "ignoring request: %v", err)
+		if err == nil {
+			err = errors.New("no secret provider matched the client")
+		}
+		span.End(err)
 		conn.Close()
 		timer.ObserveDuration()
 		return
 	}
 	ctx = context.WithValue(ctx, ContextLoaderDuration, time.Since(loaderStart).Milliseconds())
 	serveAccepted.Inc()
-	s.handle(ctx, newCrypter(secret, conn, s.proxy), handler)
+	s.stats.connected()
+	c := newCrypter(secret, conn, s.proxy)
+	c.secondary = secondary
+	c.pooled = true
+	c.tls = state != nil
+	c.maxBodyLength = s.maxBodyLength
+	if n := limit.get(); n > 0 {
+		c.maxBodyLength = n
+	}
+	s.handle(ctx, draining, c, handler)
 	serveAccepted.Dec()
+	s.stats.disconnected()
+	span.End(nil)
 }
 
-// handle will process connections on a net.Conn. This is meant to be executed in a goroutine
-func (s *Server) handle(ctx context.Context, c *crypter, h Handler) {
+// secrets looks up the secrets and handler of a client, including the secondary secret if the
+// SecretProvider supports one
+func (s *Server) secrets(ctx context.Context, remote net.Addr) ([]byte, []byte, Handler, error) {
+	if rp, ok := s.SecretProvider.(RotatingSecretProvider); ok {
+		return rp.GetSecrets(ctx, remote)
+	}
+	secret, handler, err := s.Get(ctx, remote)
+	return secret, nil, handler, err
+}
+
+// handle will process connections on a net.Conn. This is meant to be executed in a goroutine.
+// Once draining is closed, the connection is closed as soon as it has no sessions in progress.
+func (s *Server) handle(ctx context.Context, draining <-chan struct{}, c *crypter, h Handler) {
 	// defer closing the connection on return.
 	defer c.Close()
 	// scoped to the entire undelrying net.Conn.  this is needed for single-connect
 	sessionProvider := newSessionProvider()
+	sessionProvider.registry, sessionProvider.source = s.registry, strip(c.RemoteAddr().String())
+	sessionProvider.stats = s.stats
 	defer sessionProvider.close()
+	// deadline serializes read deadline changes with the drain watcher, so a wake up is never
+	// overwritten by the next read's deadline
+	var deadline sync.Mutex
+	if draining != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go s.watchDrain(ctx, draining, stop, &deadline, c, sessionProvider)
+	}
+	// single-connect is negotiated by the first packet on the connection
+	var negotiated, multiplexed bool
+	// borrowed is the packet last read, released once it has been handled
+	var borrowed *Packet
+	defer func() { borrowed.Release() }()
 	for {
+		borrowed.Release()
+		borrowed = nil
 		select {
 		case <-ctx.Done():
+			if draining != nil {
+				handleDrainClosed.Inc()
+			}
 			s.Debugf(ctx, "context cancellation received, closing connection to %v", c.RemoteAddr())
 			return
 		default:
-			if err := c.SetReadDeadline(time.Now().Add(15 * time.Second)); err != nil {
-				s.Errorf(ctx, "unable to set read deadline on connection %v", c.RemoteAddr())
+			deadline.Lock()
+			if isDone(draining) && sessionProvider.len() == 0 {
+				deadline.Unlock()
+				s.Debugf(ctx, "draining, closing idle connection to %v", c.RemoteAddr())
+				return
+			}
+			if s.readTimeout > 0 {
+				if err := c.SetReadDeadline(time.Now().Add(s.readTimeout)); err != nil {
+					s.Errorf(ctx, "unable to set read deadline on connection %v", c.RemoteAddr())
+				}
+			}
+			deadline.Unlock()
+			packet, err := c.receive()
+			borrowed = packet
+			var tooLarge *bodyLengthError
+			if errors.As(err, &tooLarge) && !isDone(draining) {
+				s.Errorf(ctx, "[%v] rejecting packet from %v; %v", tooLarge.header.SessionID, c.RemoteAddr(), err)
+				resp := &response{ctx: ctx, crypter: c, loggerProvider: s.loggerProvider, header: tooLarge.header}
+				if _, err := resp.Reply(errorReply(tooLarge.header.Type, bodyTooLargeServerMsg)); err != nil || !tooLarge.discarded {
+					return
+				}
+				continue
 			}
-			packet, err := c.read()
 			if err != nil {
+				if isDone(draining) {
+					if ctx.Err() != nil {
+						handleDrainClosed.Inc()
+					}
+					s.Debugf(ctx, "draining, closing connection to %v; %v", c.RemoteAddr(), err)
+					return
+				}
 				if err != io.EOF {
 					s.Errorf(ctx, "closing connection, unable to read, %v", err)
 				}
 				return
 			}
+			// the packet span starts once the packet arrives, excluding time spent idle
+			packetCtx, span := s.startSpan(ctx, "tacacs.packet")
+			span.SetAttribute("tacacs.type", packet.Header.Type.String())
+			span.SetAttribute("tacacs.session_id", uint32(packet.Header.SessionID))
+			span.SetAttribute("tacacs.seq_no", uint8(packet.Header.SeqNo))
+			_, decryptSpan := s.startSpan(packetCtx, "tacacs.decrypt")
+			packet, err = c.decrypt(packet)
+			decryptSpan.End(err)
+			if err != nil {
+				s.Errorf(ctx, "closing connection, unable to read, %v", err)
+				span.End(err)
+				return
+			}
+			if packet.Header.Flags.Has(ExtendedArgLength) && !s.extendedArgLength {
+				handleExtendedArgLengthRejected.Inc()
+				s.Errorf(ctx, "closing connection to %v, ExtendedArgLength flag is not enabled", c.RemoteAddr())
+				span.End(errors.New("ExtendedArgLength flag is not enabled"))
+				return
+			}
+			if s.packetTypes != nil && !s.packetTypes[packet.Header.Type] {
+				handlePacketTypeRejected.Inc()
+				s.Errorf(ctx, "closing connection to %v, packet type [%v] is not served on this listener", c.RemoteAddr(), packet.Header.Type)
+				span.End(errors.New("packet type is not served on this listener"))
+				return
+			}
 			// store basic connection parameters into ctx
-			ctxWithAddr := context.WithValue(ctx, ContextConnRemoteAddr, strip(c.RemoteAddr().String()))
+			ctxWithAddr := context.WithValue(packetCtx, ContextConnRemoteAddr, strip(c.RemoteAddr().String()))
 			ctxWithAddr = context.WithValue(ctxWithAddr, ContextConnLocalAddr, c.LocalAddr().String())
 
 			// create our request
@@ -162,22 +534,104 @@ func (s *Server) handle(ctx context.Context, c *crypter, h Handler) {
 			}
 			// create the response
 			resp := &response{ctx: req.Context, crypter: c, loggerProvider: s.loggerProvider, header: req.Header}
+			if s.singleConnect {
+				if !negotiated {
+					negotiated = true
+					multiplexed = req.Header.Flags.Has(SingleConnect)
+					if multiplexed {
+						handleSingleConnectNegotiated.Inc()
+					} else {
+						handleSingleConnectDeclined.Inc()
+					}
+				}
+				if multiplexed {
+					resp.header.Flags.Set(SingleConnect)
+				} else {
+					resp.header.Flags.Clear(SingleConnect)
+				}
+			}
+			if req.Header.Flags.Has(UnencryptedFlag) && !c.tls && !s.acceptUnencrypted(ctx, c.RemoteAddr(), req.Header) {
+				s.rejectUnencrypted(ctx, sessionProvider, resp, req.Header)
+				span.End(errors.New(unencryptedServerMsg))
+				continue
+			}
+			if s.strictSequence {
+				if v := sessionProvider.check(req.Header); v != sequenceValid {
+					s.rejectSequence(ctx, sessionProvider, resp, req.Header, v)
+					span.End(v)
+					continue
+				}
+			}
 			state, err := sessionProvider.get(req.Header)
 			if err != nil {
 				s.Errorf(ctx, "unable to obtain a session; connection will close; %v", err)
+				span.End(err)
 				return
 			}
 			// default to our provided handler for new flows
 			if state == nil {
+				if isDone(draining) {
+					handleDrainRefused.Inc()
+					s.Debugf(ctx, "[%v] draining, refusing new session from %v", req.Header.SessionID, c.RemoteAddr())
+					resp.Reply(drainReply(req.Header.Type))
+					span.End(errors.New("draining"))
+					continue
+				}
+				if s.maxSessions > 0 && sessionProvider.len() >= s.maxSessions {
+					handleMaxSessionsReached.Inc()
+					s.Debugf(ctx, "[%v] dropping new session from %v, %v sessions are already in progress", req.Header.SessionID, c.RemoteAddr(), s.maxSessions)
+					span.End(errors.New("max sessions reached"))
+					continue
+				}
+				if err := sessionProvider.claim(req.Header); err != nil {
+					s.Errorf(ctx, "[%v] rejecting new session from %v; %v", req.Header.SessionID, c.RemoteAddr(), err)
+					resp.Reply(errorReply(req.Header.Type, sessionInUseServerMsg))
+					span.End(err)
+					continue
+				}
 				state = h
 				sessionProvider.set(req.Header, nil)
 			}
+			req.Context = WithSessionMetadata(req.Context, sessionProvider.metadata(req.Header.SessionID))
+			var handlerSpan Span
+			req.Context, handlerSpan = s.startSpan(req.Context, "tacacs.handler")
+			resp.ctx, resp.trace = req.Context, req.Context
+			if s.middleware != nil {
+				state = Chain(s.middleware...)(state)
+			}
 			handlers.Inc()
-			state.Handle(resp, req)
+			started := time.Now()
+			if draining == nil && s.pool == nil {
+				state.Handle(resp, req)
+			} else if err := s.dispatch(ctx, draining != nil, state, resp, req); err != nil {
+				// the abandoned handler may still read the body
+				borrowed = nil
+				handlers.Dec()
+				handlerSpan.End(err)
+				span.End(err)
+				return
+			}
 			handlers.Dec()
+			s.stats.handled(req.Header.Type, time.Since(started))
+			handlerSpan.End(nil)
+			span.End(nil)
+			if resp.isClosed() {
+				handleSessionClosed.Inc()
+				s.Debugf(ctx, "[%v] sessionID was closed by its handler, closing connection to %v", req.Header.SessionID, c.RemoteAddr())
+				sessionProvider.delete(req.Header.SessionID)
+				return
+			}
 			if resp.next == nil {
 				s.Debugf(ctx, "[%v] sessionID is complete", req.Header.SessionID)
 				sessionProvider.delete(req.Header.SessionID)
+				if s.singleConnect && !multiplexed && sessionProvider.len() == 0 {
+					s.Debugf(ctx, "single-connect was not negotiated, closing connection to %v", c.RemoteAddr())
+					return
+				}
+				if isDone(draining) && sessionProvider.len() == 0 {
+					s.Debugf(ctx, "draining, closing connection to %v once its sessions completed", c.RemoteAddr())
+					return
+				}
 				continue
 			}
 			sessionProvider.update(resp.header, resp.next)
@@ -185,6 +639,73 @@ func (s *Server) handle(ctx context.Context, c *crypter, h Handler) {
 	}
 }
 
+// watchDrain wakes the connection's read once draining starts if it has no sessions in progress,
+// and again once the drain deadline passes, ctx being done
+func (s *Server) watchDrain(ctx context.Context, draining, stop <-chan struct{}, deadline *sync.Mutex, c *crypter, sessions *sessions) {
+	wake := func(idleOnly bool) {
+		deadline.Lock()
+		defer deadline.Unlock()
+		if !idleOnly || sessions.len() == 0 {
+			c.SetReadDeadline(time.Now())
+		}
+	}
+	select {
+	case <-draining:
+		wake(true)
+	case <-stop:
+		return
+	}
+	select {
+	case <-ctx.Done():
+		wake(false)
+	case <-stop:
+	}
+}
+
+// dispatch runs h on the worker pool, or on a new goroutine without one.  When drains is set, it
+// replies with an error on the handler's behalf if the drain deadline, ctx being done, passes
+// before h completes.  It returns an error if h was abandoned, or ctx was done before the pool
+// accepted it.
+func (s *Server) dispatch(ctx context.Context, drains bool, h Handler, resp *response, req Request) error {
+	header := resp.header
+	done := make(chan struct{})
+	run := func() {
+		defer close(done)
+		h.Handle(resp, req)
+	}
+	if s.pool == nil {
+		go run()
+	} else if !s.pool.submit(ctx, run) {
+		s.Debugf(ctx, "[%v] server stopped before a worker was free for the session from %v", req.Header.SessionID, resp.crypter.RemoteAddr())
+		return errors.New("server stopped waiting for a worker")
+	}
+	if !drains {
+		<-done
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		handleDrainAborted.Inc()
+		s.Infof(ctx, "[%v] drain timeout, aborting session from %v", req.Header.SessionID, resp.crypter.RemoteAddr())
+		if err := resp.abort(header, drainReply(req.Header.Type)); err != nil {
+			s.Debugf(ctx, "[%v] unable to send drain reply; %v", req.Header.SessionID, err)
+		}
+		return errors.New("drain timeout")
+	}
+}
+
+// isDone reports if ch is closed, never for a nil ch
+func isDone(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
 // strip removes port and [] from an IP address
 // on a best effort basis. In case of any error, the
 // original input is returned
@@ -0,0 +1,233 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statsBucketCount is the number of handler latency buckets
+const statsBucketCount = 20
+
+// statsBuckets are the upper bounds of the handler latency buckets, doubling from 100µs to about
+// 52 seconds.  Quantiles are estimated as the bound of the bucket they fall in.
+var statsBuckets = func() []time.Duration {
+	b := make([]time.Duration, statsBucketCount)
+	b[0] = 100 * time.Microsecond
+	for i := 1; i < len(b); i++ {
+		b[i] = 2 * b[i-1]
+	}
+	return b
+}()
+
+// statsTypes are the packet types stats are kept for, in the order they are indexed
+var statsTypes = []HeaderType{Authenticate, Authorize, Accounting}
+
+// SetStats records the server's activity in st instead of stats of its own, so the servers of
+// several listeners may be observed as one
+func SetStats(st *Stats) Option {
+	return func(s *Server) {
+		s.stats = st
+	}
+}
+
+// NewStats creates an empty Stats
+func NewStats() *Stats {
+	return &Stats{started: time.Now()}
+}
+
+// Stats counts the connections and sessions of one or more servers, and how long their handlers
+// take, so they may be inspected at runtime rather than from prometheus counters.  It is safe for
+// concurrent use and serves its Snapshot as json over http.
+type Stats struct {
+	started time.Time
+	// connections are in progress, accepted are every connection served
+	connections int64
+	accepted    int64
+	// sessions and handlers are indexed as statsTypes
+	sessions [3]sessionStats
+	handlers [3]latencyStats
+}
+
+// sessionStats counts the sessions of a packet type
+type sessionStats struct {
+	active int64
+	total  int64
+}
+
+// latencyStats summarizes the latencies of a packet type's handlers
+type latencyStats struct {
+	sync.Mutex
+	count int64
+	sum   time.Duration
+	max   time.Duration
+	// buckets are counted as statsBuckets, plus one for latencies beyond the last
+	buckets [statsBucketCount + 1]int64
+}
+
+// observe counts latency d
+func (l *latencyStats) observe(d time.Duration) {
+	i := 0
+	for i < len(statsBuckets) && d > statsBuckets[i] {
+		i++
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.count++
+	l.sum += d
+	if d > l.max {
+		l.max = d
+	}
+	l.buckets[i]++
+}
+
+// summary returns the count, mean, quantiles and max of the latencies observed
+func (l *latencyStats) summary() LatencySummary {
+	l.Lock()
+	defer l.Unlock()
+	if l.count == 0 {
+		return LatencySummary{}
+	}
+	quantile := func(q float64) time.Duration {
+		rank := int64(math.Ceil(q * float64(l.count)))
+		var seen int64
+		for i, n := range l.buckets {
+			if seen += n; seen < rank {
+				continue
+			}
+			if i < len(statsBuckets) && statsBuckets[i] < l.max {
+				return statsBuckets[i]
+			}
+			break
+		}
+		return l.max
+	}
+	return LatencySummary{
+		Count: l.count,
+		Mean:  l.sum / time.Duration(l.count),
+		P50:   quantile(0.5),
+		P90:   quantile(0.9),
+		P99:   quantile(0.99),
+		Max:   l.max,
+	}
+}
+
+// statsIndex returns the index of t in statsTypes
+func statsIndex(t HeaderType) (int, bool) {
+	for i, v := range statsTypes {
+		if v == t {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// connected counts a new connection in progress.  All methods of a nil Stats do nothing.
+func (st *Stats) connected() {
+	if st == nil {
+		return
+	}
+	atomic.AddInt64(&st.connections, 1)
+	atomic.AddInt64(&st.accepted, 1)
+}
+
+// disconnected counts the end of a connection
+func (st *Stats) disconnected() {
+	if st == nil {
+		return
+	}
+	atomic.AddInt64(&st.connections, -1)
+}
+
+// sessionStarted counts a new session of type t in progress
+func (st *Stats) sessionStarted(t HeaderType) {
+	if i, ok := statsIndex(t); ok && st != nil {
+		atomic.AddInt64(&st.sessions[i].active, 1)
+		atomic.AddInt64(&st.sessions[i].total, 1)
+	}
+}
+
+// sessionEnded counts the end of a session of type t
+func (st *Stats) sessionEnded(t HeaderType) {
+	if i, ok := statsIndex(t); ok && st != nil {
+		atomic.AddInt64(&st.sessions[i].active, -1)
+	}
+}
+
+// handled counts a handler of a type t packet that took d
+func (st *Stats) handled(t HeaderType, d time.Duration) {
+	if i, ok := statsIndex(t); ok && st != nil {
+		st.handlers[i].observe(d)
+	}
+}
+
+// StatsSnapshot is a copy of Stats at a point in time
+type StatsSnapshot struct {
+	Uptime time.Duration `json:"uptime"`
+	// Connections are in progress, ConnectionsTotal counts every connection accepted
+	Connections      int64 `json:"connections"`
+	ConnectionsTotal int64 `json:"connections_total"`
+	// Sessions are in progress, and SessionsByType breaks them down by packet type
+	Sessions       int64                   `json:"sessions"`
+	SessionsByType map[string]SessionStats `json:"sessions_by_type"`
+	// Handlers summarizes how long the handlers of each packet type took to reply
+	Handlers map[string]LatencySummary `json:"handlers"`
+}
+
+// SessionStats counts the sessions of a packet type in progress, and every one started
+type SessionStats struct {
+	Active int64 `json:"active"`
+	Total  int64 `json:"total"`
+}
+
+// LatencySummary summarizes the latencies of handlers.  Quantiles are estimated from buckets that
+// double from 100µs, so are accurate to within a factor of two.
+type LatencySummary struct {
+	Count int64         `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// Snapshot returns a copy of the stats.  Counters are read one at a time, so a snapshot taken
+// while packets are served may be off by the few sessions that started or ended while it was
+// taken.
+func (st *Stats) Snapshot() StatsSnapshot {
+	s := StatsSnapshot{
+		Uptime:           time.Since(st.started),
+		Connections:      atomic.LoadInt64(&st.connections),
+		ConnectionsTotal: atomic.LoadInt64(&st.accepted),
+		SessionsByType:   make(map[string]SessionStats, len(statsTypes)),
+		Handlers:         make(map[string]LatencySummary, len(statsTypes)),
+	}
+	for i, t := range statsTypes {
+		ss := SessionStats{Active: atomic.LoadInt64(&st.sessions[i].active), Total: atomic.LoadInt64(&st.sessions[i].total)}
+		s.Sessions += ss.Active
+		s.SessionsByType[t.String()] = ss
+		s.Handlers[t.String()] = st.handlers[i].summary()
+	}
+	return s
+}
+
+// ServeHTTP writes the Snapshot as json
+func (st *Stats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st.Snapshot())
+}
+
+// Stats returns the stats the server records its activity in, see SetStats
+func (s *Server) Stats() *Stats {
+	return s.stats
+}
@@ -0,0 +1,67 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	st := NewStats()
+	st.connected()
+	st.connected()
+	st.disconnected()
+	st.sessionStarted(Authenticate)
+	st.sessionStarted(Authorize)
+	st.sessionEnded(Authorize)
+	st.sessionStarted(HeaderType(9))
+	for i := 1; i <= 100; i++ {
+		st.handled(Authorize, time.Duration(i)*time.Millisecond)
+	}
+
+	s := st.Snapshot()
+	assert.Equal(t, int64(1), s.Connections)
+	assert.Equal(t, int64(2), s.ConnectionsTotal)
+	assert.Equal(t, int64(1), s.Sessions)
+	assert.Equal(t, SessionStats{Active: 1, Total: 1}, s.SessionsByType["Authenticate"])
+	assert.Equal(t, SessionStats{Active: 0, Total: 1}, s.SessionsByType["Authorize"])
+	assert.Equal(t, LatencySummary{}, s.Handlers["Accounting"])
+
+	l := s.Handlers["Authorize"]
+	assert.Equal(t, int64(100), l.Count)
+	assert.Equal(t, 50500*time.Microsecond, l.Mean)
+	assert.Equal(t, 100*time.Millisecond, l.Max)
+	// 50ms falls in the bucket up to 51.2ms
+	assert.Equal(t, 51200*time.Microsecond, l.P50)
+	// the top bucket is capped by the largest latency
+	assert.Equal(t, 100*time.Millisecond, l.P99)
+
+	// a nil Stats records nothing
+	var none *Stats
+	none.connected()
+	none.sessionStarted(Authenticate)
+	none.handled(Authenticate, time.Second)
+}
+
+func TestStatsHTTP(t *testing.T) {
+	st := NewStats()
+	NewServer(nil, nil, SetStats(st)).Stats().sessionStarted(Accounting)
+	w := httptest.NewRecorder()
+	st.ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var s StatsSnapshot
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &s))
+	assert.Equal(t, int64(1), s.SessionsByType["Accounting"].Total)
+	assert.Contains(t, s.Handlers, "Authenticate")
+}
@@ -8,7 +8,11 @@
 package tacquito
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestStrip(t *testing.T) {
@@ -32,3 +36,168 @@ func TestStrip(t *testing.T) {
 		}
 	}
 }
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := newRateLimiter(2, 3)
+	r.now = func() time.Time { return now }
+
+	// the bucket starts full
+	for i := 0; i < 3; i++ {
+		assert.True(t, r.allow(), i)
+	}
+	assert.False(t, r.allow())
+
+	// refills at rate, never beyond burst
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, r.allow())
+	assert.False(t, r.allow())
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.True(t, r.allow(), i)
+	}
+	assert.False(t, r.allow())
+}
+
+func TestMaxConnections(t *testing.T) {
+	s := NewServer(nil, nil, SetMaxConnections(2))
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.True(t, s.acquire(ctx))
+	assert.True(t, s.acquire(ctx))
+
+	// a third slot waits until one is released
+	acquired := make(chan bool)
+	go func() { acquired <- s.acquire(ctx) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a slot beyond the maximum")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.release()
+	assert.True(t, <-acquired)
+
+	// or gives up once cancelled
+	go func() { acquired <- s.acquire(ctx) }()
+	cancel()
+	assert.False(t, <-acquired)
+
+	// unlimited servers never wait
+	assert.True(t, NewServer(nil, nil).acquire(ctx))
+}
+
+func TestWorkerPool(t *testing.T) {
+	p := newWorkerPool(1)
+	p.start()
+	defer p.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the worker runs the first job, the queue holds the second
+	block, running := make(chan struct{}), make(chan struct{})
+	assert.True(t, p.submit(ctx, func() { close(running); <-block }))
+	<-running
+	ran := make(chan struct{})
+	assert.True(t, p.submit(ctx, func() { close(ran) }))
+	assert.True(t, p.saturated())
+
+	// a saturated pool holds off new connections and packets until it catches up
+	admitted, submitted := make(chan bool), make(chan bool)
+	go func() { admitted <- p.admit(ctx) }()
+	go func() { submitted <- p.submit(ctx, func() {}) }()
+	select {
+	case <-admitted:
+		t.Fatal("admitted a connection to a saturated pool")
+	case <-submitted:
+		t.Fatal("queued a job beyond the queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(block)
+	<-ran
+	assert.True(t, <-admitted)
+	assert.True(t, <-submitted)
+
+	// or gives up once cancelled
+	block = make(chan struct{})
+	defer close(block)
+	running = make(chan struct{})
+	assert.True(t, p.submit(ctx, func() { close(running); <-block }))
+	<-running
+	assert.True(t, p.submit(ctx, func() {}))
+	go func() { submitted <- p.submit(ctx, func() {}) }()
+	go func() { admitted <- p.admit(ctx) }()
+	cancel()
+	assert.False(t, <-submitted)
+	assert.False(t, <-admitted)
+}
+
+func TestSourceLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newSourceLimiter(1, 2, 3)
+	l.now = func() time.Time { return now }
+
+	// each source has its own bucket
+	assert.True(t, l.acquire("192.0.2.1"))
+	assert.True(t, l.acquire("192.0.2.1"))
+	assert.False(t, l.acquire("192.0.2.1"))
+	assert.True(t, l.acquire("192.0.2.2"))
+
+	// and its own bound on concurrent connections
+	now = now.Add(time.Second)
+	assert.True(t, l.acquire("192.0.2.1"))
+	now = now.Add(time.Second)
+	assert.False(t, l.acquire("192.0.2.1"))
+	l.release("192.0.2.1")
+	assert.True(t, l.acquire("192.0.2.1"))
+
+	// idle sources are swept once their bucket refills
+	for i := 0; i < 3; i++ {
+		l.release("192.0.2.1")
+	}
+	l.release("192.0.2.2")
+	now = now.Add(sourceSweepInterval)
+	assert.True(t, l.acquire("192.0.2.3"))
+	assert.Len(t, l.sources, 1)
+
+	// without a rate, sources are dropped as soon as their last connection is released
+	l = newSourceLimiter(0, 0, 1)
+	assert.True(t, l.acquire("192.0.2.1"))
+	assert.False(t, l.acquire("192.0.2.1"))
+	l.release("192.0.2.1")
+	assert.Empty(t, l.sources)
+}
+
+func TestSessionRegistry(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := newSessionRegistry(time.Minute)
+	r.now = func() time.Time { return now }
+	a, b := newSessionProvider(), newSessionProvider()
+
+	// an id in progress belongs to its connection
+	assert.NoError(t, r.claim(1, a, "192.0.2.1"))
+	assert.Error(t, r.claim(1, b, "192.0.2.1"))
+	assert.Error(t, r.claim(1, b, "192.0.2.2"))
+	assert.NoError(t, r.claim(2, b, "192.0.2.2"))
+
+	// a completed id is held from other sources for the grace window
+	r.release(1, b)
+	assert.Error(t, r.claim(1, b, "192.0.2.2"), "only the owner releases an id")
+	r.release(1, a)
+	assert.Error(t, r.claim(1, b, "192.0.2.2"))
+	assert.NoError(t, r.claim(1, b, "192.0.2.1"))
+	r.release(1, b)
+	now = now.Add(time.Minute)
+	assert.NoError(t, r.claim(1, b, "192.0.2.2"))
+
+	// expired ids are swept
+	r.release(1, b)
+	r.release(2, b)
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, r.claim(3, a, "192.0.2.1"))
+	assert.Len(t, r.ids, 1)
+
+	// without grace, ids are free once released
+	r = newSessionRegistry(0)
+	assert.NoError(t, r.claim(1, a, "192.0.2.1"))
+	r.release(1, a)
+	assert.NoError(t, r.claim(1, b, "192.0.2.2"))
+}
@@ -0,0 +1,96 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"sync"
+)
+
+// SessionMetadata holds values that live as long as a session, across every packet of it, eg the
+// username collected by the first packets of an ascii login.  The server creates it when a session
+// starts and drops it when the session completes.  Handlers reach it with Request.Metadata, and
+// writers with SessionMetadataFromContext.  Keys are ContextKeys, so the values the handlers
+// record, eg ContextUser, ContextRemoteAddr, ContextPort and ContextPrivLvl, share the names of
+// the request fields; custom handlers should declare their own keys to avoid collisions.
+// SessionMetadata is safe for concurrent use.
+type SessionMetadata struct {
+	mu     sync.RWMutex
+	values map[ContextKey]interface{}
+}
+
+// NewSessionMetadata returns empty metadata
+func NewSessionMetadata() *SessionMetadata {
+	return &SessionMetadata{values: make(map[ContextKey]interface{})}
+}
+
+// Get returns the value of key, and if it is set
+func (m *SessionMetadata) Get(key ContextKey) (interface{}, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// String returns the value of key if it is a string, and if it is
+func (m *SessionMetadata) String(key ContextKey) (string, bool) {
+	v, ok := m.Get(key)
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+// Set sets key to v for the rest of the session
+func (m *SessionMetadata) Set(key ContextKey, v interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = v
+}
+
+// Delete unsets key
+func (m *SessionMetadata) Delete(key ContextKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+}
+
+// Keys returns the keys that are set, in no particular order
+func (m *SessionMetadata) Keys() []ContextKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]ContextKey, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// WithSessionMetadata returns a copy of ctx holding m
+func WithSessionMetadata(ctx context.Context, m *SessionMetadata) context.Context {
+	return context.WithValue(ctx, ContextSessionMetadata, m)
+}
+
+// SessionMetadataFromContext returns the metadata held by ctx, nil if there is none
+func SessionMetadataFromContext(ctx context.Context) *SessionMetadata {
+	if ctx == nil {
+		return nil
+	}
+	m, _ := ctx.Value(ContextSessionMetadata).(*SessionMetadata)
+	return m
+}
+
+// Metadata returns the metadata of the session the request belongs to.  Requests that were not
+// read by a server, eg in tests, have no session, and get empty metadata that is not kept.
+func (r Request) Metadata() *SessionMetadata {
+	if m := SessionMetadataFromContext(r.Context); m != nil {
+		return m
+	}
+	return NewSessionMetadata()
+}
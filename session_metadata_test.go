@@ -0,0 +1,57 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionMetadata(t *testing.T) {
+	header := *NewHeader(SetHeaderType(Authenticate), SetHeaderSessionID(1), SetHeaderSeqNo(1))
+	s := newSessionProvider()
+	defer s.close()
+	assert.Nil(t, s.metadata(header.SessionID))
+
+	s.set(header, nil)
+	m := s.metadata(header.SessionID)
+	if !assert.NotNil(t, m) {
+		return
+	}
+	// a later packet of the session sees what the first one set
+	first := Request{Header: header, Context: WithSessionMetadata(context.Background(), m)}
+	first.Metadata().Set(ContextUser, "alice")
+	first.Metadata().Set(ContextPrivLvl, 15)
+	header.SeqNo = 3
+	s.update(header, nil)
+	next := Request{Header: header, Context: WithSessionMetadata(context.Background(), s.metadata(header.SessionID))}
+	user, ok := next.Metadata().String(ContextUser)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", user)
+	_, ok = next.Metadata().String(ContextPrivLvl)
+	assert.False(t, ok, "priv-lvl is not a string")
+	v, ok := next.Metadata().Get(ContextPrivLvl)
+	assert.True(t, ok)
+	assert.Equal(t, 15, v)
+	assert.ElementsMatch(t, []ContextKey{ContextUser, ContextPrivLvl}, next.Metadata().Keys())
+	next.Metadata().Delete(ContextPrivLvl)
+	_, ok = next.Metadata().Get(ContextPrivLvl)
+	assert.False(t, ok)
+
+	// the metadata goes with the session
+	s.delete(header.SessionID)
+	assert.Nil(t, s.metadata(header.SessionID))
+
+	// requests without a session get metadata that is not kept
+	detached := Request{Header: header, Context: context.Background()}
+	detached.Metadata().Set(ContextUser, "bob")
+	_, ok = detached.Metadata().Get(ContextUser)
+	assert.False(t, ok)
+}
@@ -0,0 +1,107 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sessionInUseServerMsg is the server msg of the reply to a session the registry rejects
+const sessionInUseServerMsg = "session id is in use"
+
+// sessionRegistrySweepInterval is the least time between sweeps of expired session ids
+const sessionRegistrySweepInterval = time.Minute
+
+// SetSessionRegistry tracks the session ids in progress across every connection of the server.  A
+// session started with an id that is in progress on another connection is rejected with an error
+// status, as is an id that completed on a connection from another source address within grace.
+// This makes blind spoofing of a session, which relies on guessing an id in use, far harder.
+// Sessions of the same connection are unaffected, those are already kept apart by the connection.
+// Zero grace only rejects ids in progress.  Disabled by default.
+func SetSessionRegistry(grace time.Duration) Option {
+	return func(s *Server) {
+		s.sessionRegistry = true
+		s.sessionGrace = grace
+	}
+}
+
+// newSessionRegistry creates a sessionRegistry that holds completed ids for grace
+func newSessionRegistry(grace time.Duration) *sessionRegistry {
+	return &sessionRegistry{grace: grace, ids: make(map[SessionID]*registeredSession), now: time.Now}
+}
+
+// sessionRegistry records which connection, and source address, each session id belongs to
+type sessionRegistry struct {
+	sync.Mutex
+	grace     time.Duration
+	ids       map[SessionID]*registeredSession
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// registeredSession is the owner of a session id.  expires is zero while the session is in
+// progress on owner.
+type registeredSession struct {
+	owner   *sessions
+	source  string
+	expires time.Time
+}
+
+// claim registers id as in progress on owner, connected from source.  It fails if id is in
+// progress on another connection, or completed within the grace window from another source.
+func (r *sessionRegistry) claim(id SessionID, owner *sessions, source string) error {
+	r.Lock()
+	defer r.Unlock()
+	now := r.now()
+	r.sweep(now)
+	if rs, ok := r.ids[id]; ok {
+		switch {
+		case rs.expires.IsZero() && rs.owner != owner:
+			sessionRegistryInProgress.Inc()
+			return fmt.Errorf("session id [%v] is in progress on another connection from [%v]", id, rs.source)
+		case !rs.expires.IsZero() && now.Before(rs.expires) && rs.source != source:
+			sessionRegistryReplayed.Inc()
+			return fmt.Errorf("session id [%v] completed within [%v] on a connection from [%v]", id, r.grace, rs.source)
+		}
+	}
+	r.ids[id] = &registeredSession{owner: owner, source: source}
+	sessionRegistryIDs.Set(float64(len(r.ids)))
+	return nil
+}
+
+// release marks id as completed on owner, holding it for the grace window
+func (r *sessionRegistry) release(id SessionID, owner *sessions) {
+	r.Lock()
+	defer r.Unlock()
+	rs, ok := r.ids[id]
+	if !ok || rs.owner != owner || !rs.expires.IsZero() {
+		return
+	}
+	if r.grace <= 0 {
+		delete(r.ids, id)
+		sessionRegistryIDs.Set(float64(len(r.ids)))
+		return
+	}
+	rs.expires = r.now().Add(r.grace)
+}
+
+// sweep drops ids whose grace window has passed.  The caller must hold the lock.
+func (r *sessionRegistry) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < sessionRegistrySweepInterval {
+		return
+	}
+	r.lastSweep = now
+	for id, rs := range r.ids {
+		if !rs.expires.IsZero() && !now.Before(rs.expires) {
+			delete(r.ids, id)
+		}
+	}
+	sessionRegistryIDs.Set(float64(len(r.ids)))
+}
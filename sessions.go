@@ -10,6 +10,7 @@ package tacquito
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -24,6 +25,8 @@ type sessionContext struct {
 	header Header
 	Handler
 	timer *prometheus.Timer
+	// metadata is shared by every packet of the session
+	metadata *SessionMetadata
 }
 
 // sessions manages client session ids. we use sessions to know how to
@@ -34,13 +37,26 @@ type sessionContext struct {
 type sessions struct {
 	sync.RWMutex
 	known map[SessionID]*sessionContext
+	// registry if set, is told of the sessions of this connection, connected from source
+	registry *sessionRegistry
+	source   string
+	// stats if set, counts the sessions of this connection
+	stats *Stats
+}
+
+// claim reserves the id of a new session with the registry, if any
+func (s *sessions) claim(h Header) error {
+	if s.registry == nil {
+		return nil
+	}
+	return s.registry.claim(h.SessionID, s, s.source)
 }
 
 // get a session
 func (s *sessions) get(h Header) (Handler, error) {
 	if err := ClientSequenceNumber(h.SeqNo).Validate(nil); err != nil {
 		s.delete(h.SessionID)
-		return nil, fmt.Errorf("sessionID [%v] sequence number is corrupted; %v", h.SessionID, err)
+		return nil, fmt.Errorf("sessionID [%v] sequence number is corrupted; %w", h.SessionID, err)
 	}
 	s.Lock()
 	defer s.Unlock()
@@ -50,7 +66,7 @@ func (s *sessions) get(h Header) (Handler, error) {
 		return nil, nil
 	}
 	if err := LastSequence(sc.header.SeqNo).Validate(h.SeqNo); err != nil {
-		return nil, fmt.Errorf("sessionID [%v] sequence number is mismatched; %v", h.SessionID, err)
+		return nil, fmt.Errorf("sessionID [%v] sequence number is mismatched; %w", h.SessionID, err)
 	}
 	sessionsGetHit.Inc()
 	return sc.Handler, nil
@@ -66,11 +82,22 @@ func (s *sessions) set(h Header, n Handler) {
 	defer s.Unlock()
 	sessionsActive.Inc()
 	sessionsSet.Inc()
+	s.stats.sessionStarted(h.Type)
 	timer := prometheus.NewTimer(prometheus.ObserverFunc(func(v float64) {
 		ms := v * 1000 // make milliseconds
 		sessionDurations.Observe(ms)
 	}))
-	s.known[h.SessionID] = &sessionContext{header: h, Handler: n, timer: timer}
+	s.known[h.SessionID] = &sessionContext{header: h, Handler: n, timer: timer, metadata: NewSessionMetadata()}
+}
+
+// metadata returns the metadata of a session, nil if it is not known
+func (s *sessions) metadata(session SessionID) *SessionMetadata {
+	s.RLock()
+	defer s.RUnlock()
+	if sc := s.known[session]; sc != nil {
+		return sc.metadata
+	}
+	return nil
 }
 
 // update a session id and next handler.
@@ -91,37 +118,59 @@ func (s *sessions) update(h Header, n Handler) {
 func (s *sessions) delete(session SessionID) {
 	s.Lock()
 	defer s.Unlock()
-	sessionsActive.Dec()
 	if sc := s.known[session]; sc != nil {
+		sessionsActive.Dec()
+		s.stats.sessionEnded(sc.header.Type)
 		sc.timer.ObserveDuration()
+		if s.registry != nil {
+			s.registry.release(session, s)
+		}
 	}
 	delete(s.known, session)
 }
 
-// close will stop all prom timers, it's the only reason we have this
+// len returns the number of sessions in progress
+func (s *sessions) len() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.known)
+}
+
+// close will stop all prom timers, and end the sessions in progress and release them from the registry
 func (s *sessions) close() {
-	for _, r := range s.known {
+	for id, r := range s.known {
 		r.timer.ObserveDuration()
+		s.stats.sessionEnded(r.header.Type)
+		if s.registry != nil {
+			s.registry.release(id, s)
+		}
 	}
 }
 
 // waitGroup wraps sync.WaitGroup and exposes
-// a counter that can be used in Serve()
+// a counter that can be used in Serve(). active is
+// only accessed atomically; Add and Done run on
+// connection goroutines while Serve reads it.
 type waitGroup struct {
 	sync.WaitGroup
-	active uint
+	active int64
 }
 
 // Add adds to WaitGroup and increments the count
 func (w *waitGroup) Add(delta int) {
-	waitgroupActive.Inc()
+	waitgroupActive.Add(float64(delta))
+	atomic.AddInt64(&w.active, int64(delta))
 	w.WaitGroup.Add(delta)
-	w.active++
 }
 
 // Done decrements WaitGroup and the counter
 func (w *waitGroup) Done() {
 	waitgroupActive.Dec()
+	atomic.AddInt64(&w.active, -1)
 	w.WaitGroup.Done()
-	w.active--
+}
+
+// count returns the number of active members
+func (w *waitGroup) count() int64 {
+	return atomic.LoadInt64(&w.active)
 }
@@ -58,11 +58,26 @@ var (
 		Name:      "crypter_badSecret",
 		Help:      "number of bad secrets",
 	})
+	crypterObfuscatedTLS = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "crypter_obfuscated_tls",
+		Help:      "number of obfuscated packets refused on tls connections",
+	})
+	crypterSecondarySecret = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "crypter_secondary_secret",
+		Help:      "number of connections that only decrypted with the secondary secret",
+	})
 	crypterUnmarshalError = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "crypter_unmarshal_error",
 		Help:      "number of errors unmarshalling in crypter",
 	})
+	crypterBodyTooLarge = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "crypter_body_too_large",
+		Help:      "number of packets rejected in crypter for a body longer than the connection accepts",
+	})
 	crypterCryptError = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "crypter_crypt_error",
@@ -93,6 +108,186 @@ var (
 		Name:      "sessions_get_miss",
 		Help:      "number of session cache misses within the server",
 	})
+	handleExtendedArgLengthRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_extended_arg_length_rejected",
+		Help:      "number of connections closed for using the ExtendedArgLength flag without it being enabled",
+	})
+	handleUnencryptedRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_unencrypted_rejected",
+		Help:      "number of sessions terminated for an unencrypted packet the unencrypted policy does not accept",
+	})
+	handleUnencryptedAllowed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_unencrypted_allowed",
+		Help:      "number of unencrypted packets served from clients within the prefixes of the allow unencrypted policy",
+	})
+	handleUnencryptedLogged = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_unencrypted_logged",
+		Help:      "number of unencrypted packets served and logged under the log unencrypted policy",
+	})
+	handlePacketTypeRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_packet_type_rejected",
+		Help:      "number of connections closed for sending a packet type the listener does not serve",
+	})
+	serveRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "serve_rate_limited",
+		Help:      "number of connections closed for exceeding the connection rate limit",
+	})
+	serveTLSHandshakeError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "serve_tls_handshake_error",
+		Help:      "number of tls connections closed because the handshake failed",
+	})
+	serveTLSVersionRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "serve_tls_version_rejected",
+		Help:      "number of tls connections closed for negotiating a version below tls 1.3",
+	})
+	serveTLSPeerRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "serve_tls_peer_rejected",
+		Help:      "number of tls connections closed because the peer policy did not authorize the client certificate",
+	})
+	serveMaxConnectionsReached = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "serve_max_connections_reached",
+		Help:      "number of times the server stopped accepting until a connection slot freed up",
+	})
+	serveSourceRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "serve_source_rate_limited",
+		Help:      "number of connections closed for exceeding the per source connection rate limit",
+	})
+	serveSourceMaxConnectionsReached = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "serve_source_max_connections_reached",
+		Help:      "number of connections closed because their source already had the maximum connections open",
+	})
+	serveSources = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "serve_sources",
+		Help:      "number of source addresses tracked by per source limits, as of the last sweep",
+	})
+	handleSequenceEven = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_sequence_even",
+		Help:      "number of sessions terminated in strict sequence mode for an even client sequence number",
+	})
+	handleSequenceStart = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_sequence_start",
+		Help:      "number of sessions terminated in strict sequence mode for not starting at sequence number 1",
+	})
+	handleSequenceOrder = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_sequence_order",
+		Help:      "number of sessions terminated in strict sequence mode for a sequence number not following the last reply",
+	})
+	handleSequenceWrap = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_sequence_wrap",
+		Help:      "number of sessions terminated in strict sequence mode for reaching the maximum sequence number",
+	})
+	sessionRegistryInProgress = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "session_registry_in_progress",
+		Help:      "number of new sessions rejected for an id in progress on another connection",
+	})
+	sessionRegistryReplayed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "session_registry_replayed",
+		Help:      "number of new sessions rejected for an id completed within the grace window from another source",
+	})
+	sessionRegistryIDs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "session_registry_ids",
+		Help:      "number of session ids held by the session registry, in progress or within the grace window",
+	})
+	handleMaxSessionsReached = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_max_sessions_reached",
+		Help:      "number of packets dropped for starting a session on a connection that already has the maximum sessions",
+	})
+	handleDrainRefused = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_drain_refused",
+		Help:      "number of new sessions answered with an error status because the server was draining",
+	})
+	handleDrainAborted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_drain_aborted",
+		Help:      "number of handlers answered with an error status because they were still running at the drain deadline",
+	})
+	handleSessionClosed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_session_closed",
+		Help:      "number of connections closed by a handler ending its session with Close or Abort",
+	})
+	handleDrainClosed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_drain_closed",
+		Help:      "number of connections closed with sessions in progress at the drain deadline",
+	})
+	handleSingleConnectNegotiated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_single_connect_negotiated",
+		Help:      "number of connections that negotiated single-connect mode",
+	})
+	handleSingleConnectDeclined = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_single_connect_declined",
+		Help:      "number of connections that did not request single-connect mode and close after one session",
+	})
+	servePoolSaturated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "serve_pool_saturated",
+		Help:      "number of times the server stopped accepting connections because the session worker pool queue was full",
+	})
+	poolBusy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "handle_pool_busy",
+		Help:      "number of session worker pool workers running a handler",
+	})
+	poolQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "tacquito",
+		Name:      "handle_pool_queued",
+		Help:      "number of session packets waiting for a worker pool worker",
+	})
+	poolQueueFull = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "handle_pool_queue_full",
+		Help:      "number of session packets that waited for room in the full worker pool queue",
+	})
+	clientPoolDialed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "client_pool_dialed",
+		Help:      "number of connections dialed by client pools",
+	})
+	clientPoolDialError = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "client_pool_dial_error",
+		Help:      "number of connections client pools failed to dial",
+	})
+	clientPoolRetried = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "client_pool_retried",
+		Help:      "number of packets client pools sent again because their connection closed before they were written",
+	})
+	clientFailover = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "client_failover",
+		Help:      "number of times a client marked a server down and moved on to the next of its list",
+	})
+	clientFailoverRestored = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "tacquito",
+		Name:      "client_failover_restored",
+		Help:      "number of times a client returned to an earlier server of its list once its dead time passed",
+	})
 	sessionsSet = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "tacquito",
 		Name:      "sessions_set",
@@ -130,14 +325,53 @@ func init() {
 	prometheus.MustRegister(crypterWrite)
 	prometheus.MustRegister(crypterWriteError)
 	prometheus.MustRegister(crypterBadSecret)
+	prometheus.MustRegister(crypterObfuscatedTLS)
+	prometheus.MustRegister(crypterSecondarySecret)
 	prometheus.MustRegister(crypterUnmarshalError)
 	prometheus.MustRegister(crypterMarshalError)
 	prometheus.MustRegister(crypterCryptError)
+	prometheus.MustRegister(crypterBodyTooLarge)
 	prometheus.MustRegister(waitgroupActive)
 	prometheus.MustRegister(sessionsActive)
 	prometheus.MustRegister(sessionsGetHit)
 	prometheus.MustRegister(sessionsGetMiss)
 	prometheus.MustRegister(sessionsSet)
+	prometheus.MustRegister(handleExtendedArgLengthRejected)
+	prometheus.MustRegister(handleSingleConnectNegotiated)
+	prometheus.MustRegister(handlePacketTypeRejected)
+	prometheus.MustRegister(handleUnencryptedRejected)
+	prometheus.MustRegister(handleUnencryptedAllowed)
+	prometheus.MustRegister(handleUnencryptedLogged)
+	prometheus.MustRegister(serveRateLimited)
+	prometheus.MustRegister(serveTLSHandshakeError)
+	prometheus.MustRegister(serveTLSVersionRejected)
+	prometheus.MustRegister(serveTLSPeerRejected)
+	prometheus.MustRegister(serveMaxConnectionsReached)
+	prometheus.MustRegister(serveSourceRateLimited)
+	prometheus.MustRegister(serveSourceMaxConnectionsReached)
+	prometheus.MustRegister(serveSources)
+	prometheus.MustRegister(handleMaxSessionsReached)
+	prometheus.MustRegister(handleSequenceEven)
+	prometheus.MustRegister(sessionRegistryInProgress)
+	prometheus.MustRegister(sessionRegistryReplayed)
+	prometheus.MustRegister(sessionRegistryIDs)
+	prometheus.MustRegister(handleSequenceStart)
+	prometheus.MustRegister(handleSequenceOrder)
+	prometheus.MustRegister(handleSequenceWrap)
+	prometheus.MustRegister(handleSingleConnectDeclined)
+	prometheus.MustRegister(handleDrainRefused)
+	prometheus.MustRegister(handleDrainAborted)
+	prometheus.MustRegister(servePoolSaturated)
+	prometheus.MustRegister(poolBusy)
+	prometheus.MustRegister(poolQueued)
+	prometheus.MustRegister(poolQueueFull)
+	prometheus.MustRegister(handleDrainClosed)
+	prometheus.MustRegister(handleSessionClosed)
+	prometheus.MustRegister(clientPoolDialed)
+	prometheus.MustRegister(clientPoolDialError)
+	prometheus.MustRegister(clientPoolRetried)
+	prometheus.MustRegister(clientFailover)
+	prometheus.MustRegister(clientFailoverRestored)
 	// durations
 	prometheus.MustRegister(sessionDurations)
 	prometheus.MustRegister(connectionDuration)
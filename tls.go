@@ -0,0 +1,275 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterCapability(CapabilityTLS)
+}
+
+// Tacacs+ over tls follows draft-ietf-opsawg-tacacs-tls13,
+// https://datatracker.ietf.org/doc/html/draft-ietf-opsawg-tacacs-tls13.  Sessions are tls 1.3 or
+// later, and packets are not obfuscated: every packet carries the UnencryptedFlag, and packets
+// without it are refused with ErrObfuscatedTLS.
+
+// TLSPort is the port tacacs+ over tls is served on, tacacss as assigned by iana
+const TLSPort = 300
+
+// obfuscatedTLSServerMsg is the server msg of the reply to an obfuscated packet over tls
+const obfuscatedTLSServerMsg = "obfuscated packets are not accepted over tls"
+
+// NewTLSListener returns a DeadlineListener that serves tacacs+ over tls on l.  The handshake is
+// performed by the server before the client's secret is looked up, and the resulting
+// tls.ConnectionState is stored in the context passed to SecretProvider.Get, see
+// TLSConnectionState and ConnInfo.  config is raised to tls 1.3 if it allows older versions.
+func NewTLSListener(l *net.TCPListener, config *tls.Config) DeadlineListener {
+	return &tlsListener{TCPListener: l, config: tls13(config)}
+}
+
+// tls13 returns a copy of config whose minimum version is at least tls 1.3
+func tls13(config *tls.Config) *tls.Config {
+	if config == nil {
+		return &tls.Config{MinVersion: tls.VersionTLS13}
+	}
+	config = config.Clone()
+	if config.MinVersion < tls.VersionTLS13 {
+		config.MinVersion = tls.VersionTLS13
+	}
+	return config
+}
+
+// tlsListener wraps accepted connections in tls
+type tlsListener struct {
+	*net.TCPListener
+	config *tls.Config
+}
+
+// Accept implements net.Listener
+func (l *tlsListener) Accept() (net.Conn, error) {
+	conn, err := l.TCPListener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return tls.Server(conn, l.config), nil
+}
+
+// SetClientTLSDialer dials address like SetClientDialer, then performs a tls 1.3 handshake with
+// config.  address defaults to TLSPort if it has no port.  Set config.Certificates to
+// authenticate with a client certificate.  Packets are sent unobfuscated, secret does not protect
+// them.
+func SetClientTLSDialer(network, address string, config *tls.Config, secret []byte) ClientOption {
+	return func(c *Client) error {
+		if c.crypter != nil || c.failover != nil {
+			return errDialerSet
+		}
+		conn, err := tls.Dial(network, tlsAddress(address), tls13(config))
+		if err != nil {
+			return err
+		}
+		c.crypter = newCrypter(secret, conn, false)
+		c.crypter.tls = true
+		return nil
+	}
+}
+
+// tlsAddress appends TLSPort to address if it has no port
+func tlsAddress(address string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.Trim(address, "[]"), strconv.Itoa(TLSPort))
+}
+
+// TLSPeerPolicy authorizes tls peers by the subject alternative names of their verified
+// certificate, as the peer authorization of draft-ietf-opsawg-tacacs-tls13 requires.  A peer is
+// authorized if any of its names is allowed by any entry.
+type TLSPeerPolicy struct {
+	// DNSNames are allowed dns names, matched case insensitively.  A leading *. matches exactly
+	// one label, eg *.example.com allows a.example.com but neither example.com nor
+	// a.b.example.com.
+	DNSNames []string
+	// IPs are prefixes the ip address names are allowed within
+	IPs []*net.IPNet
+	// URIs are allowed uri names, eg spiffe ids, matched exactly
+	URIs []string
+}
+
+// ParseTLSPeerPolicy returns the policy of entries, each one of dns:<name>, ip:<prefix> or
+// uri:<uri>.  A bare ip address is taken as a single host prefix.
+func ParseTLSPeerPolicy(entries ...string) (*TLSPeerPolicy, error) {
+	p := &TLSPeerPolicy{}
+	for _, entry := range entries {
+		kind, value, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid tls peer entry [%v], expected dns:<name>, ip:<prefix> or uri:<uri>", entry)
+		}
+		switch strings.ToLower(kind) {
+		case "dns":
+			p.DNSNames = append(p.DNSNames, value)
+		case "ip":
+			prefix, err := parsePeerPrefix(value)
+			if err != nil {
+				return nil, err
+			}
+			p.IPs = append(p.IPs, prefix)
+		case "uri":
+			p.URIs = append(p.URIs, value)
+		default:
+			return nil, fmt.Errorf("invalid tls peer entry [%v], expected dns:<name>, ip:<prefix> or uri:<uri>", entry)
+		}
+	}
+	return p, nil
+}
+
+// parsePeerPrefix parses a prefix in cidr notation, or an ip address as a single host prefix
+func parsePeerPrefix(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid tls peer ip [%v]", value)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, prefix, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls peer prefix [%v]; %v", value, err)
+	}
+	return prefix, nil
+}
+
+// Entries returns the entries of the policy in the form ParseTLSPeerPolicy accepts
+func (p *TLSPeerPolicy) Entries() []string {
+	if p == nil {
+		return nil
+	}
+	var entries []string
+	for _, name := range p.DNSNames {
+		entries = append(entries, "dns:"+name)
+	}
+	for _, prefix := range p.IPs {
+		entries = append(entries, "ip:"+prefix.String())
+	}
+	for _, uri := range p.URIs {
+		entries = append(entries, "uri:"+uri)
+	}
+	return entries
+}
+
+// Authorize returns an error unless cert has a subject alternative name the policy allows.  cert
+// must already be verified.
+func (p *TLSPeerPolicy) Authorize(cert *x509.Certificate) error {
+	if cert == nil {
+		return errors.New("no peer certificate")
+	}
+	for _, name := range cert.DNSNames {
+		for _, pattern := range p.DNSNames {
+			if matchDNSName(pattern, name) {
+				return nil
+			}
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		for _, prefix := range p.IPs {
+			if prefix.Contains(ip) {
+				return nil
+			}
+		}
+	}
+	for _, uri := range cert.URIs {
+		for _, allowed := range p.URIs {
+			if uri.String() == allowed {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("peer certificate [%v] has no subject alternative name allowed by the tls peer policy", cert.Subject)
+}
+
+// VerifyConnection authorizes the peer of a verified tls connection.  It may be set as the
+// VerifyConnection of a client tls.Config to authorize servers with the policy.
+func (p *TLSPeerPolicy) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return errors.New("no verified peer certificate")
+	}
+	return p.Authorize(cs.VerifiedChains[0][0])
+}
+
+// matchDNSName reports if name is allowed by pattern
+func matchDNSName(pattern, name string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if suffix := strings.TrimPrefix(pattern, "*"); suffix != pattern && strings.HasPrefix(suffix, ".") {
+		label := strings.TrimSuffix(name, suffix)
+		return label != name && label != "" && !strings.Contains(label, ".")
+	}
+	return pattern == name
+}
+
+// SetTLSPeerPolicy authorizes the client certificate of every tls connection with p.  The
+// server's tls.Config must verify client certificates, eg with ClientAuth set to
+// tls.RequireAndVerifyClientCert, connections without a verified certificate are closed.
+// Rejected connections are counted in serve_tls_peer_rejected.
+func SetTLSPeerPolicy(p *TLSPeerPolicy) Option {
+	return func(s *Server) {
+		s.tlsPeerPolicy = p
+	}
+}
+
+// authorizeTLS returns an error if the connection's tls version is older than tls 1.3, or the
+// peer policy does not authorize its client certificate
+func (s *Server) authorizeTLS(cs tls.ConnectionState) error {
+	if cs.Version < tls.VersionTLS13 {
+		serveTLSVersionRejected.Inc()
+		return fmt.Errorf("tls version [%#04x] is older than tls 1.3", cs.Version)
+	}
+	if s.tlsPeerPolicy == nil {
+		return nil
+	}
+	if err := s.tlsPeerPolicy.VerifyConnection(cs); err != nil {
+		serveTLSPeerRejected.Inc()
+		return err
+	}
+	return nil
+}
+
+// TLSConnectionState returns the tls state of the client's connection, if it was accepted by a
+// listener created with NewTLSListener
+func TLSConnectionState(ctx context.Context) (tls.ConnectionState, bool) {
+	info, ok := ConnInfo(ctx)
+	if !ok || info.TLS == nil {
+		return tls.ConnectionState{}, false
+	}
+	return *info.TLS, true
+}
+
+// handshake completes the tls handshake of conn within timeout, zero only applies ctx
+func handshake(ctx context.Context, conn *tls.Conn, timeout time.Duration) (tls.ConnectionState, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return conn.ConnectionState(), nil
+}
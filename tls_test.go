@@ -0,0 +1,74 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSPeerPolicy(t *testing.T) {
+	p, err := ParseTLSPeerPolicy("dns:*.Example.com", "ip:10.0.0.0/8", "ip:2001:db8::1", "uri:spiffe://example.com/router")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dns:*.Example.com", "ip:10.0.0.0/8", "ip:2001:db8::1/128", "uri:spiffe://example.com/router"}, p.Entries())
+
+	router, _ := url.Parse("spiffe://example.com/router")
+	switches, _ := url.Parse("spiffe://example.com/switch")
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		ok   bool
+	}{
+		{name: "wildcard dns", cert: &x509.Certificate{DNSNames: []string{"rtr1.example.com"}}, ok: true},
+		{name: "wildcard dns is case insensitive", cert: &x509.Certificate{DNSNames: []string{"RTR1.EXAMPLE.COM."}}, ok: true},
+		{name: "wildcard matches one label", cert: &x509.Certificate{DNSNames: []string{"rtr1.pod1.example.com"}}},
+		{name: "wildcard needs a label", cert: &x509.Certificate{DNSNames: []string{"example.com"}}},
+		{name: "ip within prefix", cert: &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.1.2.3")}}, ok: true},
+		{name: "ip host", cert: &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("2001:db8::1")}}, ok: true},
+		{name: "ip outside prefix", cert: &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("192.0.2.1")}}},
+		{name: "uri", cert: &x509.Certificate{URIs: []*url.URL{router}}, ok: true},
+		{name: "other uri", cert: &x509.Certificate{URIs: []*url.URL{switches}}},
+		{name: "any name allowed", cert: &x509.Certificate{DNSNames: []string{"example.org"}, URIs: []*url.URL{router}}, ok: true},
+		{name: "no names", cert: &x509.Certificate{}},
+		{name: "no certificate"},
+	}
+	for _, test := range tests {
+		err := p.Authorize(test.cert)
+		if test.ok {
+			assert.NoError(t, err, test.name)
+		} else {
+			assert.Error(t, err, test.name)
+		}
+	}
+
+	// unverified peers are never authorized
+	assert.Error(t, p.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{tests[0].cert}}))
+	assert.NoError(t, p.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tests[0].cert}}}))
+
+	for _, entry := range []string{"example.com", "dns:", "email:noc@example.com", "ip:10.0.0.0/33", "ip:router"} {
+		_, err := ParseTLSPeerPolicy(entry)
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestTLSDefaults(t *testing.T) {
+	assert.Equal(t, "tacquito.example.com:300", tlsAddress("tacquito.example.com"))
+	assert.Equal(t, "[2001:db8::1]:300", tlsAddress("2001:db8::1"))
+	assert.Equal(t, "[2001:db8::1]:300", tlsAddress("[2001:db8::1]"))
+	assert.Equal(t, "tacquito.example.com:4949", tlsAddress("tacquito.example.com:4949"))
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	assert.Equal(t, uint16(tls.VersionTLS13), tls13(config).MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion, "the config passed is not modified")
+	assert.Equal(t, uint16(tls.VersionTLS13), tls13(nil).MinVersion)
+}
@@ -0,0 +1,68 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+)
+
+// Tracer creates spans for the stages of serving a packet.  tacquito does not depend on any
+// tracing library, implementations adapt one such as opentelemetry, see SetTracer.
+type Tracer interface {
+	// Start begins a span named name.  The span is a child of the span carried by ctx, if any, and
+	// the returned context carries the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation
+type Span interface {
+	// SetAttribute annotates the span with key and value
+	SetAttribute(key string, value interface{})
+	// End completes the span, marking it failed if err is not nil
+	End(err error)
+}
+
+// SetTracer enables tracing of every packet the server serves.  A connection is traced by a
+// tacacs.connection span, which holds a tacacs.secrets span for the SecretProvider lookup and a
+// tacacs.packet span per packet.  Packet spans hold tacacs.decrypt, tacacs.handler and, within
+// the handler, tacacs.reply spans.  The handler span is carried by Request.Context, so handlers
+// may add their own spans with StartSpan.
+func SetTracer(t Tracer) Option {
+	return func(s *Server) {
+		s.tracer = t
+	}
+}
+
+// StartSpan begins a span named name with the Tracer that served the request carrying ctx.  If
+// the server has no Tracer, the span is a no-op.
+func StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	if t, ok := ctx.Value(ContextTracer).(Tracer); ok {
+		return t.Start(ctx, name)
+	}
+	return ctx, noopSpan{}
+}
+
+// startSpan begins a span with the server's Tracer, storing the Tracer in ctx for StartSpan
+func (s *Server) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if s.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	if _, ok := ctx.Value(ContextTracer).(Tracer); !ok {
+		ctx = context.WithValue(ctx, ContextTracer, s.tracer)
+	}
+	return s.tracer.Start(ctx, name)
+}
+
+// noopSpan is used when tracing is disabled
+type noopSpan struct{}
+
+// SetAttribute does nothing
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+
+// End does nothing
+func (noopSpan) End(err error) {}
@@ -0,0 +1,100 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// unencryptedServerMsg is the server msg of the reply to an unencrypted packet that is refused
+const unencryptedServerMsg = "unencrypted packets are not accepted"
+
+// UnencryptedPolicy is how the server treats packets with the UnencryptedFlag set on connections
+// that are not tls.  rfc 8907 only allows unobfuscated bodies for testing,
+// https://datatracker.ietf.org/doc/html/rfc8907#section-4.5, so production servers should
+// leave it at UnencryptedReject.  Tls connections are not subject to the policy.
+type UnencryptedPolicy uint8
+
+const (
+	// UnencryptedReject terminates the session of an unencrypted packet, replying with an error
+	// status.  The other sessions on the connection are unaffected.
+	UnencryptedReject UnencryptedPolicy = iota
+	// UnencryptedAllow serves unencrypted packets from clients within the prefixes given to
+	// SetUnencryptedPolicy, eg a lab network, and rejects them from every other client
+	UnencryptedAllow
+	// UnencryptedLog serves unencrypted packets from every client, logging each one
+	UnencryptedLog
+)
+
+// String returns the name of the policy
+func (p UnencryptedPolicy) String() string {
+	switch p {
+	case UnencryptedReject:
+		return "reject"
+	case UnencryptedAllow:
+		return "allow"
+	case UnencryptedLog:
+		return "log"
+	}
+	return fmt.Sprintf("unknown UnencryptedPolicy[%d]", uint8(p))
+}
+
+// ParseUnencryptedPolicy returns the policy named s, one of reject, allow or log
+func ParseUnencryptedPolicy(s string) (UnencryptedPolicy, error) {
+	for _, p := range []UnencryptedPolicy{UnencryptedReject, UnencryptedAllow, UnencryptedLog} {
+		if strings.EqualFold(s, p.String()) {
+			return p, nil
+		}
+	}
+	return UnencryptedReject, fmt.Errorf("unknown unencrypted policy [%v], expected reject, allow or log", s)
+}
+
+// SetUnencryptedPolicy sets how packets with the UnencryptedFlag set are treated on connections
+// that are not tls, UnencryptedReject by default.  prefixes are the clients UnencryptedAllow serves
+// unencrypted packets from, at least one is required; the other policies ignore them.  Packets
+// rejected, allowed and logged are counted in handle_unencrypted_rejected,
+// handle_unencrypted_allowed and handle_unencrypted_logged.
+func SetUnencryptedPolicy(p UnencryptedPolicy, prefixes ...*net.IPNet) Option {
+	return func(s *Server) {
+		s.unencryptedPolicy = p
+		s.unencryptedPrefixes = prefixes
+	}
+}
+
+// acceptUnencrypted reports if the server serves an unencrypted packet with header h from remote
+func (s *Server) acceptUnencrypted(ctx context.Context, remote net.Addr, h Header) bool {
+	switch s.unencryptedPolicy {
+	case UnencryptedAllow:
+		ip := net.ParseIP(strip(remote.String()))
+		for _, prefix := range s.unencryptedPrefixes {
+			if ip != nil && prefix.Contains(ip) {
+				handleUnencryptedAllowed.Inc()
+				return true
+			}
+		}
+	case UnencryptedLog:
+		handleUnencryptedLogged.Inc()
+		s.Infof(ctx, "[%v] serving unencrypted packet from %v at sequence number [%v]", h.SessionID, remote, h.SeqNo)
+		return true
+	}
+	return false
+}
+
+// rejectUnencrypted terminates the session of an unencrypted packet, replying with an error
+// status.  The reply is unencrypted as well, the client may not hold the secret.
+func (s *Server) rejectUnencrypted(ctx context.Context, sessions *sessions, resp *response, h Header) {
+	handleUnencryptedRejected.Inc()
+	s.Errorf(ctx, "[%v] terminating session from %v, unencrypted packets are not accepted under the [%v] policy", h.SessionID, resp.crypter.RemoteAddr(), s.unencryptedPolicy)
+	sessions.delete(h.SessionID)
+	if _, err := resp.Reply(errorReply(h.Type, unencryptedServerMsg)); err != nil {
+		s.Debugf(ctx, "[%v] unable to send unencrypted error reply; %v", h.SessionID, err)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"sort"
+	"sync"
+)
+
+// release is the semantic version of this build.  Release builds may stamp it with
+//
+//	go build -ldflags "-X github.com/facebookincubator/tacquito.release=v1.2.3"
+var release = "v0.6.0"
+
+// ReleaseVersion returns the semantic version of tacquito compiled into this binary.  It is
+// named ReleaseVersion, not Version, since Version is the tacacs header version field.
+func ReleaseVersion() string {
+	return release
+}
+
+// Capability is an optional feature that a build of tacquito supports.  Orchestration tooling
+// should gate rollouts on capabilities rather than comparing versions, since a capability may be
+// compiled out of, or backported into, any given build.
+type Capability string
+
+const (
+	// CapabilitySingleConnect is rfc8907 single-connect negotiation in the server and session
+	// multiplexing in the client
+	CapabilitySingleConnect Capability = "single-connect"
+	// CapabilityExtendedArgLength is the non-rfc uint16 arg length encoding
+	CapabilityExtendedArgLength Capability = "extended-arg-length"
+	// CapabilityProxyV1 is the ha-proxy ascii proxy header
+	CapabilityProxyV1 Capability = "proxy-v1"
+	// CapabilityProxyV2 is the ha-proxy binary proxy header
+	CapabilityProxyV2 Capability = "proxy-v2"
+	// CapabilityTLS is tacacs+ over tls.  Registered by the package that implements it
+	CapabilityTLS Capability = "tls"
+	// CapabilityCmdV2 is the v2 command authorization model.  Registered by the package that implements it
+	CapabilityCmdV2 Capability = "cmd_v2"
+	// CapabilityAdminAPI is the http admin api.  Registered by the package that implements it
+	CapabilityAdminAPI Capability = "admin-api"
+)
+
+var capabilities = struct {
+	sync.RWMutex
+	set map[Capability]bool
+}{set: map[Capability]bool{
+	CapabilitySingleConnect:     true,
+	CapabilityExtendedArgLength: true,
+	CapabilityProxyV1:           true,
+	CapabilityProxyV2:           true,
+}}
+
+// RegisterCapability advertises c as supported by this build.  Packages that implement optional
+// features call it from their init func, so a capability is only reported when the package is
+// compiled in.
+func RegisterCapability(c Capability) {
+	capabilities.Lock()
+	defer capabilities.Unlock()
+	capabilities.set[c] = true
+}
+
+// HasCapability reports whether c is supported by this build
+func HasCapability(c Capability) bool {
+	capabilities.RLock()
+	defer capabilities.RUnlock()
+	return capabilities.set[c]
+}
+
+// Capabilities returns every capability supported by this build, sorted
+func Capabilities() []Capability {
+	capabilities.RLock()
+	defer capabilities.RUnlock()
+	c := make([]Capability, 0, len(capabilities.set))
+	for k := range capabilities.set {
+		c = append(c, k)
+	}
+	sort.Slice(c, func(i, j int) bool { return c[i] < c[j] })
+	return c
+}
@@ -0,0 +1,27 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	assert.Regexp(t, `^v\d+\.\d+\.\d+`, ReleaseVersion())
+	assert.True(t, HasCapability(CapabilitySingleConnect))
+	assert.False(t, HasCapability("not-a-capability"))
+
+	RegisterCapability("test-capability")
+	assert.True(t, HasCapability("test-capability"))
+	c := Capabilities()
+	assert.Contains(t, c, Capability("test-capability"))
+	assert.True(t, sort.SliceIsSorted(c, func(i, j int) bool { return c[i] < c[j] }))
+}
@@ -0,0 +1,133 @@
+/*
+ Copyright (c) Facebook, Inc. and its affiliates.
+
+ This source code is licensed under the MIT license found in the
+ LICENSE file in the root directory of this source tree.
+*/
+
+package tacquito
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// poolSaturatedPoll is how often the server checks if a saturated pool has room to accept again
+const poolSaturatedPoll = 10 * time.Millisecond
+
+// SetMaxConcurrentSessions bounds how many session packets the server handles at once, across
+// every connection, with a pool of n workers running the handlers.  Up to n more packets wait in a
+// queue for a worker.  Once the queue is full, connections wait to hand over their next packet,
+// leaving it unread, and the server stops accepting new connections, leaving them in the listen
+// backlog, until the pool catches up.  This keeps a flood of reconnecting devices from running an
+// unbounded number of handlers, and their allocations, at once.  Zero, the default, runs every
+// handler on its connection's goroutine.
+func SetMaxConcurrentSessions(n int) Option {
+	return func(s *Server) {
+		s.maxConcurrentSessions = n
+	}
+}
+
+// newWorkerPool returns a pool of n workers with a queue of n jobs.  Workers run between start and
+// stop.
+func newWorkerPool(n int) *workerPool {
+	return &workerPool{workers: n}
+}
+
+// workerPool runs jobs on a fixed number of goroutines
+type workerPool struct {
+	sync.Mutex
+	workers int
+	// users are the Serve calls sharing the pool, the workers stop once the last returns
+	users int
+	jobs  chan func()
+}
+
+// start runs the workers, unless another Serve call already has
+func (p *workerPool) start() {
+	p.Lock()
+	defer p.Unlock()
+	p.users++
+	if p.users > 1 {
+		return
+	}
+	p.jobs = make(chan func(), p.workers)
+	for i := 0; i < p.workers; i++ {
+		go p.work(p.jobs)
+	}
+}
+
+// stop lets the workers exit, once their queued jobs complete, when the last Serve call returns.
+// Every connection must have returned, so no jobs can be submitted.  Handlers abandoned at the
+// drain deadline are not waited for.
+func (p *workerPool) stop() {
+	p.Lock()
+	defer p.Unlock()
+	p.users--
+	if p.users > 0 {
+		return
+	}
+	close(p.jobs)
+}
+
+func (p *workerPool) work(jobs <-chan func()) {
+	for job := range jobs {
+		poolQueued.Dec()
+		poolBusy.Inc()
+		job()
+		poolBusy.Dec()
+	}
+}
+
+// queue returns the job queue of the running pool
+func (p *workerPool) queue() chan func() {
+	p.Lock()
+	defer p.Unlock()
+	return p.jobs
+}
+
+// submit queues job, waiting for room while the queue is full.  It returns false if ctx is done
+// before job is queued.
+func (p *workerPool) submit(ctx context.Context, job func()) bool {
+	jobs := p.queue()
+	poolQueued.Inc()
+	select {
+	case jobs <- job:
+		return true
+	default:
+	}
+	poolQueueFull.Inc()
+	select {
+	case jobs <- job:
+		return true
+	case <-ctx.Done():
+		poolQueued.Dec()
+		return false
+	}
+}
+
+// saturated reports if the queue is full
+func (p *workerPool) saturated() bool {
+	jobs := p.queue()
+	return len(jobs) == cap(jobs)
+}
+
+// admit waits while the pool is saturated, so new connections stay in the listen backlog.  It
+// returns false if ctx is done while waiting.
+func (p *workerPool) admit(ctx context.Context) bool {
+	if !p.saturated() {
+		return true
+	}
+	servePoolSaturated.Inc()
+	ticker := time.NewTicker(poolSaturatedPoll)
+	defer ticker.Stop()
+	for p.saturated() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}